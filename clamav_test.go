@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers the clamd commands used by the server: INSTREAM flags
+// content containing the EICAR test string.
+func fakeClamd(t *testing.T, network, address string) {
+	t.Helper()
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				switch cmd {
+				case "zVERSION\x00":
+					conn.Write([]byte("ClamAV 1.3.1/27300/Mon Jun 10 08:24:53 2024\x00"))
+				case "zINSTREAM\x00":
+					var data bytes.Buffer
+					for {
+						var size uint32
+						if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+							return
+						}
+						if size == 0 {
+							break
+						}
+						if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+							return
+						}
+					}
+					if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+						conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+					} else {
+						conn.Write([]byte("stream: OK\x00"))
+					}
+				default:
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+				}
+			}()
+		}
+	}()
+}
+
+func TestClamAVScanning(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+	fakeClamd(t, "unix", socket)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.ClamAV = config.ClamAVConfig{Network: "unix", Address: socket, Timeout: 5 * time.Second, MaxSize: 1024}
+	})
+
+	var b strings.Builder
+	b.WriteString("From: alice@example.com\r\nTo: bob@example.org\r\nSubject: Files\r\nMIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=B1\r\n\r\n--B1\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n")
+	for _, f := range []struct {
+		name    string
+		content string
+	}{{"eicar.com", eicar}, {"notes.txt", "nothing to see"}, {"backup.bin", strings.Repeat("x", 2048)}} {
+		b.WriteString("--B1\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n")
+		b.WriteString("Content-Disposition: attachment; filename=\"" + f.name + "\"\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString([]byte(f.content)) + "\r\n")
+	}
+	b.WriteString("--B1--\r\n")
+	email := b.String()
+
+	var av handlers.ScanAttachmentsAVResult
+	res := env.call(t, "scan_attachments_av", map[string]any{"content": email}, &av)
+	if res.IsError {
+		t.Fatalf("scan_attachments_av failed: %s", resultText(res))
+	}
+	if len(av.Attachments) != 2 || av.Infected != 1 {
+		t.Fatalf("unexpected findings: %+v", av)
+	}
+	if f := av.Attachments[0]; f.Filename != "eicar.com" || !f.Infected || f.Signature != "Win.Test.EICAR_HDB-1" || f.SHA256 == "" {
+		t.Errorf("unexpected finding on the test file: %+v", f)
+	}
+	if f := av.Attachments[1]; f.Filename != "notes.txt" || f.Infected || f.Signature != "" {
+		t.Errorf("unexpected finding on a clean file: %+v", f)
+	}
+	if len(av.Errors) != 1 || !strings.Contains(av.Errors[0], "backup.bin") || !strings.Contains(av.Errors[0], "exceeds clamav.max_size") {
+		t.Errorf("oversized attachment not reported: %v", av.Errors)
+	}
+	if !strings.HasPrefix(av.Engine, "ClamAV 1.3.1/27300") {
+		t.Errorf("unexpected engine: %q", av.Engine)
+	}
+	if !strings.Contains(resultText(res), "eicar.com: Win.Test.EICAR_HDB-1") {
+		t.Errorf("signature missing from the text result: %s", resultText(res))
+	}
+
+	// Signature hits decide the scan verdict.
+	var scan handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": email}, &scan); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if !scan.IsSpam || len(scan.Malware) != 1 || scan.Malware[0].Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("malware not merged into the verdict: is_spam %v, malware %+v", scan.IsSpam, scan.Malware)
+	}
+
+	// The tool needs a daemon.
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "scan_attachments_av", map[string]any{"content": email}, nil); !res.IsError || !strings.Contains(resultText(res), "clamav.address") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestClamAVConfigValidation(t *testing.T) {
+	yaml := "clamav:\n  network: \"unix\"\n  address: \"clamd.ctl\"\n  timeout: \"0s\"\n  max_size: 0\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`clamav.address: must be an absolute socket path, got "clamd.ctl"`,
+		"clamav.timeout: must be positive, got 0s",
+		"clamav.max_size: must be positive, got 0",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
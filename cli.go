@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamassassin"
+)
+
+// newRootCommand builds the command line. Without a subcommand the server
+// runs as with serve, so existing deployments that start the bare binary
+// keep working.
+func newRootCommand() *cobra.Command {
+	var configFile string
+
+	root := &cobra.Command{
+		Use:          "spamassassin-mcp",
+		Short:        "Defensive email security analysis over MCP, backed by SpamAssassin",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if configFile != "" {
+				config.SetFile(configFile)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			serve()
+		},
+	}
+	root.PersistentFlags().StringVar(&configFile, "config", "", "configuration file (default: config.yaml in the working directory or /etc/spamassassin-mcp)")
+
+	root.AddCommand(newServeCommand(), newScanCommand(), newCheckCommand(), newValidateCommand())
+	return root
+}
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Run the MCP server (the default)",
+		Long: "Run the MCP server: SSE over HTTP when running in a container, " +
+			"otherwise stdio. SIGINT and SIGTERM shut it down gracefully; SIGHUP reloads the configuration.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			serve()
+		},
+	}
+}
+
+func newScanCommand() *cobra.Command {
+	var req handlers.ScanEmailParams
+
+	cmd := &cobra.Command{
+		Use:   "scan [file.eml]",
+		Short: "Scan a message with spamd and print the result as JSON",
+		Long: "Scan a message with spamd and print the result as JSON, in the same form as the scan_email tool. " +
+			"The message is read from standard input when no file or \"-\" is given.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := readMessage(cmd, args)
+			if err != nil {
+				return err
+			}
+			cfg, err := loadCLIConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			saClient, err := spamassassin.NewClient(cfg.SpamAssassin)
+			if err != nil {
+				return err
+			}
+			h := handlers.New(saClient, cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+			defer h.Close()
+
+			req.Content = string(content)
+			result, err := h.Scan(req)
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(result)
+		},
+	}
+	cmd.Flags().BoolVar(&req.Verbose, "verbose", false, "return detailed rule explanations")
+	cmd.Flags().StringVar(&req.Profile, "profile", "", "evaluate under this configured profile")
+	return cmd
+}
+
+func newCheckCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check",
+		Short: "Verify that spamd is reachable and answering",
+		Long:  "Send PING to the configured spamd and report the round trip. Exits non-zero when spamd is unreachable.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadCLIConfig(cmd)
+			if err != nil {
+				return err
+			}
+
+			addr := fmt.Sprintf("%s:%d", cfg.SpamAssassin.Host, cfg.SpamAssassin.Port)
+			start := time.Now()
+			if _, err := spamassassin.NewClient(cfg.SpamAssassin); err != nil {
+				return fmt.Errorf("spamd at %s: %w", addr, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "spamd at %s answered PING in %s\n", addr, time.Since(start).Round(time.Millisecond))
+			return nil
+		},
+	}
+}
+
+func newValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration without starting the server",
+		Long:  "Load the configuration file and environment and report every invalid setting. Exits non-zero when any is found.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := config.Load(); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "configuration is valid")
+			return nil
+		},
+	}
+}
+
+// loadCLIConfig loads the configuration for a one-off command. Logs go to
+// standard error so they never mix with the command's output.
+func loadCLIConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	logrus.SetOutput(cmd.ErrOrStderr())
+	setLogLevel(cfg.LogLevel)
+	return cfg, nil
+}
+
+// readMessage reads the message named by args, or standard input.
+func readMessage(cmd *cobra.Command, args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return os.ReadFile(args[0])
+}
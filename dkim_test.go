@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/dkim"
+	"spamassassin-mcp/internal/dnstest"
+	"spamassassin-mcp/internal/handlers"
+)
+
+// publishKey generates a signing key and publishes it for selector and domain.
+func publishKey(t *testing.T, dns *dnstest.Server, selector, domain string, ed bool) crypto.Signer {
+	t.Helper()
+	var signer crypto.Signer
+	if ed {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer = key
+	} else {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer = key
+	}
+	record, err := dkim.KeyRecord(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dns.AddTXT(selector+"._domainkey."+domain, record)
+	return signer
+}
+
+func signMessage(t *testing.T, raw string, opts dkim.SignOptions) string {
+	t.Helper()
+	signed, err := dkim.Sign(raw, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestCheckDKIM(t *testing.T) {
+	env := newTestEnv(t, nil)
+	rsaKey := publishKey(t, env.dns, "s1", "example.com", false)
+	edKey := publishKey(t, env.dns, "e1", "esp.example", true)
+
+	signed := signMessage(t, testEmail, dkim.SignOptions{Domain: "example.com", Selector: "s1", Signer: rsaKey})
+	signed = signMessage(t, signed, dkim.SignOptions{Domain: "esp.example", Selector: "e1", Signer: edKey, Canonicalization: "simple/simple"})
+
+	check := func(t *testing.T, content string) []*dkim.Signature {
+		t.Helper()
+		var result handlers.DKIMResult
+		if res := env.call(t, "check_dkim", map[string]any{"content": content}, &result); res.IsError {
+			t.Fatalf("check_dkim failed: %s", resultText(res))
+		}
+		return result.Signatures
+	}
+
+	sigs := check(t, signed)
+	if len(sigs) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(sigs))
+	}
+	if s := sigs[0]; s.Domain != "esp.example" || s.Algorithm != "ed25519-sha256" || s.Canonicalization != "simple/simple" || s.Result != dkim.Pass || !s.Valid {
+		t.Errorf("unexpected Ed25519 signature: %+v", s)
+	}
+	if s := sigs[1]; s.Domain != "example.com" || s.Selector != "s1" || s.KeyBits != 2048 || s.Result != dkim.Pass || len(s.SignedHeaders) != 5 {
+		t.Errorf("unexpected RSA signature: %+v", s)
+	}
+
+	// Relaxed canonicalization survives rewrapping by relays; line endings
+	// are normalized before either algorithm is applied.
+	if sigs := check(t, strings.ReplaceAll(signed, "\r\n", "\n")); sigs[0].Result != dkim.Pass || sigs[1].Result != dkim.Pass {
+		t.Errorf("LF line endings: %s, %s", sigs[0].Error, sigs[1].Error)
+	}
+
+	body := check(t, strings.Replace(signed, "the report is", "the invoice is", 1))
+	for _, s := range body {
+		if s.Result != dkim.Fail || !s.BodyHashMismatch || s.Valid {
+			t.Errorf("modified body: %+v", s)
+		}
+	}
+
+	header := check(t, strings.Replace(signed, "Subject: Quarterly report", "Subject: Urgent payment", 1))
+	for _, s := range header {
+		if s.Result != dkim.Fail || s.BodyHashMismatch {
+			t.Errorf("modified header: %+v", s)
+		}
+	}
+
+	unknown := signMessage(t, testEmail, dkim.SignOptions{Domain: "example.com", Selector: "gone", Signer: rsaKey})
+	if s := check(t, unknown)[0]; s.Result != dkim.PermError || !strings.Contains(s.Error, "no key record") {
+		t.Errorf("missing key: %+v", s)
+	}
+
+	if sigs := check(t, testEmail); len(sigs) != 0 {
+		t.Errorf("unsigned message reported %d signatures", len(sigs))
+	}
+
+	// Verbose scans carry the same results.
+	var scan handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": signed, "verbose": true}, &scan)
+	if len(scan.DKIM) != 2 || scan.DKIM[1].Result != dkim.Pass {
+		t.Errorf("verbose scan DKIM results: %+v", scan.DKIM)
+	}
+	var plain handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": signed}, &plain)
+	if plain.DKIM != nil {
+		t.Errorf("non-verbose scan verified DKIM: %+v", plain.DKIM)
+	}
+}
+
+func TestCheckARC(t *testing.T) {
+	env := newTestEnv(t, nil)
+	authorKey := publishKey(t, env.dns, "s1", "example.com", false)
+	listKey := publishKey(t, env.dns, "arc", "list.example", false)
+	forwarderKey := publishKey(t, env.dns, "fwd", "forwarder.example", true)
+
+	seal := func(t *testing.T, raw string, opts dkim.SealOptions) string {
+		t.Helper()
+		sealed, err := dkim.Seal(raw, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sealed
+	}
+
+	// A mailing list receives the signed message, rewrites the subject and
+	// appends a footer, breaking the author's signature, then seals it; a
+	// forwarder seals it again.
+	signed := signMessage(t, testEmail, dkim.SignOptions{Domain: "example.com", Selector: "s1", Signer: authorKey})
+	modified := strings.Replace(signed, "Subject: Quarterly report", "Subject: [team] Quarterly report", 1) + "-- \r\nteam mailing list\r\n"
+	hop1 := seal(t, modified, dkim.SealOptions{
+		Domain: "list.example", Selector: "arc", Signer: listKey,
+		AuthServID: "mx.list.example", Results: "dkim=pass header.d=example.com; spf=pass smtp.mailfrom=example.com",
+	})
+	hop2 := seal(t, hop1, dkim.SealOptions{
+		Domain: "forwarder.example", Selector: "fwd", Signer: forwarderKey,
+		AuthServID: "mx.forwarder.example", Results: "dkim=fail header.d=example.com; arc=pass",
+	})
+
+	check := func(t *testing.T, content string) *dkim.ARCResult {
+		t.Helper()
+		var result dkim.ARCResult
+		if res := env.call(t, "check_arc", map[string]any{"content": content}, &result); res.IsError {
+			t.Fatalf("check_arc failed: %s", resultText(res))
+		}
+		return &result
+	}
+
+	r := check(t, hop2)
+	if r.Result != "pass" || len(r.Hops) != 2 || r.OldestPass != 1 || r.Error != "" {
+		t.Fatalf("unexpected chain: %+v", r)
+	}
+	first, second := r.Hops[0], r.Hops[1]
+	if first.Domain != "list.example" || first.ChainValidation != "none" || first.SealResult != dkim.Pass || first.MessageSignatureResult != dkim.Pass {
+		t.Errorf("unexpected first hop: %+v", first)
+	}
+	if !strings.HasPrefix(first.AuthenticationResults, "mx.list.example; dkim=pass header.d=example.com") {
+		t.Errorf("first hop authentication results = %q", first.AuthenticationResults)
+	}
+	if second.Domain != "forwarder.example" || second.Algorithm != "ed25519-sha256" || second.ChainValidation != "pass" || second.SealResult != dkim.Pass {
+		t.Errorf("unexpected second hop: %+v", second)
+	}
+
+	// The author's signature no longer verifies; ARC explains why.
+	var sigs handlers.DKIMResult
+	env.call(t, "check_dkim", map[string]any{"content": hop2}, &sigs)
+	if len(sigs.Signatures) != 1 || sigs.Signatures[0].Result != dkim.Fail {
+		t.Errorf("author signature after list processing: %+v", sigs.Signatures)
+	}
+
+	// Changes after the last seal break the newest message signature.
+	tampered := check(t, hop2+"click here\r\n")
+	if tampered.Result != "fail" || !tampered.Hops[1].BodyHashMismatch || tampered.OldestPass != 0 {
+		t.Errorf("modified after sealing: %+v", tampered)
+	}
+
+	// An intermediary that saw a broken chain records cv=fail.
+	broken := seal(t, hop1, dkim.SealOptions{
+		Domain: "forwarder.example", Selector: "fwd", Signer: forwarderKey,
+		AuthServID: "mx.forwarder.example", Results: "arc=fail", ChainValidation: "fail",
+	})
+	if r := check(t, broken); r.Result != "fail" || !strings.Contains(r.Error, "failed chain") {
+		t.Errorf("cv=fail chain: %+v", r)
+	}
+
+	// A missing set breaks the chain structure.
+	gap := strings.Replace(hop2, "ARC-Authentication-Results: i=1;", "X-Removed: i=1;", 1)
+	if r := check(t, gap); r.Result != "fail" || !strings.Contains(r.Error, "incomplete") {
+		t.Errorf("incomplete set: %+v", r)
+	}
+
+	if r := check(t, testEmail); r.Result != "none" || len(r.Hops) != 0 {
+		t.Errorf("message without ARC: %+v", r)
+	}
+}
+
+func TestScanDKIMAlignment(t *testing.T) {
+	env := newTestEnv(t, nil)
+	authorKey := publishKey(t, env.dns, "s1", "mail.example.com", true)
+	espKey := publishKey(t, env.dns, "e1", "esp.example", true)
+
+	scan := func(t *testing.T, content string) *handlers.DKIMAlignment {
+		t.Helper()
+		var result handlers.ScanEmailResult
+		if res := env.call(t, "scan_email", map[string]any{"content": content, "verbose": true}, &result); res.IsError {
+			t.Fatalf("scan_email failed: %s", resultText(res))
+		}
+		return result.DKIMAlignment
+	}
+
+	// The author's subdomain aligns in relaxed mode; the provider's
+	// signature is third-party.
+	signed := signMessage(t, testEmail, dkim.SignOptions{Domain: "mail.example.com", Selector: "s1", Signer: authorKey})
+	signed = signMessage(t, signed, dkim.SignOptions{Domain: "esp.example", Selector: "e1", Signer: espKey})
+	a := scan(t, signed)
+	if a == nil || a.FromDomain != "example.com" || len(a.Signatures) != 2 || !a.Aligned || a.ThirdPartyOnly {
+		t.Fatalf("unexpected alignment: %+v", a)
+	}
+	if s := a.Signatures[1]; s.Domain != "mail.example.com" || s.Alignment != handlers.AlignmentRelaxed || s.ThirdParty {
+		t.Errorf("author signature: %+v", s)
+	}
+	if s := a.Signatures[0]; s.Domain != "esp.example" || s.Alignment != handlers.AlignmentNone || !s.Valid || !s.ThirdParty {
+		t.Errorf("provider signature: %+v", s)
+	}
+
+	// Only the provider signs.
+	a = scan(t, signMessage(t, testEmail, dkim.SignOptions{Domain: "esp.example", Selector: "e1", Signer: espKey}))
+	if a == nil || a.Aligned || !a.ThirdPartyOnly {
+		t.Errorf("unexpected alignment: %+v", a)
+	}
+
+	// An unverifiable signature is unaligned but not third-party.
+	a = scan(t, signMessage(t, testEmail, dkim.SignOptions{Domain: "example.com", Selector: "gone", Signer: authorKey}))
+	if a == nil || a.Aligned || a.ThirdPartyOnly || a.Signatures[0].Alignment != handlers.AlignmentStrict || a.Signatures[0].Valid {
+		t.Errorf("unexpected alignment: %+v", a)
+	}
+
+	if a := scan(t, testEmail); a != nil {
+		t.Errorf("alignment reported for an unsigned message: %+v", a)
+	}
+}
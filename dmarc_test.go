@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/dkim"
+	"spamassassin-mcp/internal/dmarc"
+)
+
+func TestCheckDMARC(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.dns.AddTXT("_dmarc.example.com", "v=DMARC1; p=reject; sp=quarantine; adkim=s; pct=50; rua=mailto:agg@example.com,mailto:dmarc@reports.example!10m; ruf=mailto:forensic@example.com")
+	env.dns.AddTXT("example.com", "v=spf1 ip4:192.0.2.0/24 -all")
+	env.dns.Fail("_dmarc.broken.example")
+	ownKey := publishKey(t, env.dns, "s1", "example.com", false)
+	espKey := publishKey(t, env.dns, "e1", "esp.example", true)
+
+	check := func(t *testing.T, args map[string]any) *dmarc.Evaluation {
+		t.Helper()
+		var result dmarc.Evaluation
+		if res := env.call(t, "check_dmarc", args, &result); res.IsError {
+			t.Fatalf("check_dmarc failed: %s", resultText(res))
+		}
+		return &result
+	}
+
+	// Signed by the From domain: aligned DKIM passes DMARC.
+	aligned := signMessage(t, testEmail, dkim.SignOptions{Domain: "example.com", Selector: "s1", Signer: ownKey})
+	if r := check(t, map[string]any{"content": aligned}); r.Result != dmarc.Pass || r.Disposition != "none" || len(r.DKIM) != 1 || !r.DKIM[0].Aligned {
+		t.Errorf("aligned signature: %+v", r)
+	}
+
+	// Signed only by a third party: DMARC fails and the policy applies.
+	thirdParty := signMessage(t, testEmail, dkim.SignOptions{Domain: "esp.example", Selector: "e1", Signer: espKey})
+	r := check(t, map[string]any{"content": thirdParty})
+	if r.Result != dmarc.Fail || r.Disposition != "reject" || r.Percentage != 50 || r.FallbackDisposition != "quarantine" {
+		t.Errorf("unaligned signature: %+v", r)
+	}
+	if r.DKIM[0].Result != "pass" || r.DKIM[0].Aligned || r.PolicyDomain != "example.com" {
+		t.Errorf("unaligned signature details: %+v", r)
+	}
+	if p := r.Policy; len(p.RUA) != 2 || p.RUA[1] != "mailto:dmarc@reports.example" || len(p.RUF) != 1 {
+		t.Errorf("report addresses: rua=%v ruf=%v", p.RUA, p.RUF)
+	}
+
+	// SPF for the Return-Path domain aligns in relaxed mode.
+	withReturnPath := "Return-Path: <bounces@example.com>\r\n" + thirdParty
+	if r := check(t, map[string]any{"content": withReturnPath, "ip": "192.0.2.25"}); r.Result != dmarc.Pass || r.SPF == nil || !r.SPF.Aligned {
+		t.Errorf("aligned SPF: %+v", r)
+	}
+
+	// Subdomains without their own record use the organizational policy;
+	// adkim=s rejects the parent's signature while aspf=r accepts its SPF.
+	r = check(t, map[string]any{
+		"from_domain": "mail.example.com",
+		"dkim":        []map[string]string{{"domain": "example.com", "result": "pass"}},
+	})
+	if r.Result != dmarc.Fail || r.Disposition != "quarantine" || r.DKIM[0].Aligned {
+		t.Errorf("strict DKIM alignment on subdomain: %+v", r)
+	}
+	r = check(t, map[string]any{
+		"from_domain": "mail.example.com",
+		"spf_domain":  "bounces.example.com",
+		"spf_result":  "pass",
+	})
+	if r.Result != dmarc.Pass || !r.SPF.Aligned {
+		t.Errorf("relaxed SPF alignment on subdomain: %+v", r)
+	}
+
+	if r := check(t, map[string]any{"from_domain": "nothing.example"}); r.Result != dmarc.None || r.Policy != nil || r.Disposition != "none" {
+		t.Errorf("no policy: %+v", r)
+	}
+	if r := check(t, map[string]any{"from_domain": "broken.example"}); r.Result != dmarc.TempError || !strings.Contains(r.Error, "broken.example") {
+		t.Errorf("lookup failure: %+v", r)
+	}
+
+	for _, args := range []map[string]any{
+		{},
+		{"content": testEmail, "from_domain": "example.com"},
+		{"from_domain": "example.com", "spf_result": "pass"},
+	} {
+		if res := env.call(t, "check_dmarc", args, nil); !res.IsError {
+			t.Errorf("invalid arguments %v accepted", args)
+		}
+	}
+}
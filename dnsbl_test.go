@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/dnsbl"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/urls"
+)
+
+const dqsKey = "k3y0123456789abcdefghijklm"
+
+func TestSpamhausDQS(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.DNS.DNSBLZones = []string{"zen.spamhaus.org", "bl.spamcop.net"}
+		cfg.DNS.URIBLZones = []string{"dbl.spamhaus.org", "multi.uribl.com"}
+		cfg.DNS.SpamhausDQSKey = dqsKey
+	})
+	env.dns.AddA("7.113.0.203."+dqsKey+".zen.dq.spamhaus.net", "127.0.0.3", "127.0.0.11")
+	env.dns.AddA("spam.example."+dqsKey+".dbl.dq.spamhaus.net", "127.0.1.4")
+	env.dns.AddA("evil.example."+dqsKey+".dbl.dq.spamhaus.net", "127.0.1.2")
+	env.dns.Fail("7.113.0.203.bl.spamcop.net")
+
+	var rep handlers.ReputationResult
+	res := env.call(t, "check_reputation", map[string]any{"sender": "mallory@spam.example", "ip": "203.0.113.7"}, &rep)
+	if res.IsError {
+		t.Fatalf("check_reputation failed: %s", resultText(res))
+	}
+	want := []dnsbl.Result{
+		{Zone: "zen.dq.spamhaus.net", Listed: true, Answers: []string{"127.0.0.3", "127.0.0.11"},
+			Codes: []string{"SBL CSS: snowshoe spam source", "PBL: end-user range, listed by Spamhaus"}},
+		{Zone: "bl.spamcop.net"},
+		{Zone: "dbl.dq.spamhaus.net", Listed: true, Answers: []string{"127.0.1.4"}, Codes: []string{"phishing domain"}},
+		{Zone: "multi.uribl.com"},
+	}
+	if len(rep.DNSBL) != len(want) {
+		t.Fatalf("unexpected results: %+v", rep.DNSBL)
+	}
+	for i, got := range rep.DNSBL {
+		if got.Error != "" {
+			if i != 1 || !strings.Contains(got.Error, "bl.spamcop.net lookup for 203.0.113.7 failed") {
+				t.Errorf("unexpected error: %+v", got)
+			}
+			got.Error = ""
+		}
+		if got.Zone != want[i].Zone || got.Listed != want[i].Listed || !slices.Equal(got.Answers, want[i].Answers) || !slices.Equal(got.Codes, want[i].Codes) {
+			t.Errorf("result %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+	if rep.Reputation != "bad" || !slices.Contains(rep.Reasons, "Listed on dbl.dq.spamhaus.net (phishing domain)") {
+		t.Errorf("listings not reflected: %s %v", rep.Reputation, rep.Reasons)
+	}
+	if !strings.Contains(resultText(res), "Listed on zen.dq.spamhaus.net") {
+		t.Errorf("listings missing from the text result: %s", resultText(res))
+	}
+
+	// URI lookups use DQS too.
+	var links handlers.ExtractURLsResult
+	if res := env.call(t, "extract_urls", map[string]any{"content": "From: a@example.com\r\n\r\nSee https://evil.example/x\r\n"}, &links); res.IsError {
+		t.Fatalf("extract_urls failed: %s", resultText(res))
+	}
+	if len(links.URLs) != 1 || len(links.URLs[0].Listings) != 1 || links.URLs[0].Listings[0] != (urls.Listing{List: "dbl.dq.spamhaus.net", Result: "127.0.1.2"}) {
+		t.Errorf("unexpected URL listings: %+v", links.URLs)
+	}
+
+	// The key is in every query name but never in the output.
+	env.dns.Fail("7.113.0.203." + dqsKey + ".zen.dq.spamhaus.net")
+	res = env.call(t, "check_reputation", map[string]any{"sender": "mallory@spam.example", "ip": "203.0.113.7"}, &rep)
+	out, _ := json.Marshal(res)
+	if strings.Contains(string(out), dqsKey) {
+		t.Errorf("DQS key leaked: %s", out)
+	}
+	if rep.DNSBL[0].Error == "" {
+		t.Errorf("lookup failure not reported: %+v", rep.DNSBL[0])
+	}
+
+	// Private addresses are not queried, and skip_dns skips every lookup.
+	before := len(env.dns.Queries())
+	var skipped, private handlers.ReputationResult
+	env.call(t, "check_reputation", map[string]any{"sender": "bob@example.org", "ip": "203.0.113.7", "skip_dns": true}, &skipped)
+	env.call(t, "check_reputation", map[string]any{"ip": "10.0.0.1"}, &private)
+	if queries := env.dns.Queries()[before:]; len(queries) != 0 || skipped.DNSBL != nil || private.DNSBL != nil {
+		t.Errorf("unexpected lookups: %v", queries)
+	}
+}
+
+func TestSpamhausRefusal(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.DNS.DNSBLZones = []string{"zen.spamhaus.org"}
+	})
+	env.dns.AddA("7.113.0.203.zen.spamhaus.org", "127.255.255.254")
+
+	var rep handlers.ReputationResult
+	env.call(t, "check_reputation", map[string]any{"ip": "203.0.113.7"}, &rep)
+	if len(rep.DNSBL) != 1 || rep.DNSBL[0].Listed || !strings.Contains(rep.DNSBL[0].Error, "public or open resolver; use DQS") {
+		t.Errorf("refusal not reported: %+v", rep.DNSBL)
+	}
+	if rep.Reputation != "unknown" {
+		t.Errorf("refusal counted as a listing: %s", rep.Reputation)
+	}
+}
+
+func TestSpamhausDQSConfigValidation(t *testing.T) {
+	yaml := "dns:\n  spamhaus_dqs_key: \"not.a.key\"\n  dnsbl_zones: [\"zen.spamhaus.org\", \"bad zone\"]\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"dns.spamhaus_dqs_key: must be the 26 character key of the Spamhaus DQS account",
+		`dns.dnsbl_zones: "bad zone" is not a valid DNS zone`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "not.a.key") {
+		t.Errorf("key echoed in validation errors: %v", err)
+	}
+}
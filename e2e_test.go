@@ -0,0 +1,1113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/blocklist"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/dnstest"
+	"spamassassin-mcp/internal/geoip"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/ratelimit"
+	"spamassassin-mcp/internal/siem"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+	"spamassassin-mcp/internal/taxii"
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/urlfeeds"
+	"spamassassin-mcp/internal/welcomelist"
+)
+
+const testEmail = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: Quarterly report\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <report-1@example.com>\r\n" +
+	"\r\n" +
+	"Hi Bob, the report is at https://example.com/q1.\r\n"
+
+func TestMain(m *testing.M) {
+	logrus.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testEnv is a fully wired MCP server backed by a fake spamd and a fake DNS
+// server, connected to an in-memory client session.
+type testEnv struct {
+	spamd    *spamdtest.Server
+	dns      *dnstest.Server
+	handler  *handlers.Handler
+	feed     *taxii.Publisher
+	urlFeeds *urlfeeds.Store
+	peers    *peersync.Syncer
+	server   *mcp.Server
+	ctx      context.Context
+	session  *mcp.ClientSession
+	progress chan *mcp.ProgressNotificationParams
+}
+
+// testConfig mirrors the defaults applied by config.Load.
+func testConfig(t *testing.T, spamd *spamdtest.Server) *config.Config {
+	cfg := &config.Config{
+		SpamAssassin: spamd.Config(),
+		LogLevel:     "error",
+	}
+	cfg.SpamAssassin.RulesDirs = []string{t.TempDir()}
+	cfg.SpamAssassin.Binary = "spamassassin"
+	cfg.SpamAssassin.SandboxTimeout = 10 * time.Second
+	cfg.Security.MaxEmailSize = 10 * 1024 * 1024
+	cfg.Security.RateLimiting = config.RateLimit{
+		RequestsPerMinute: 600,
+		BurstSize:         100,
+		PerClient: config.ClientRateLimit{
+			RequestsPerMinute: 600,
+			BurstSize:         100,
+			IdleTimeout:       10 * time.Minute,
+		},
+	}
+	cfg.Redaction = config.RedactionConfig{Emails: true, Bodies: true}
+	cfg.Welcomelist.Directive = "welcomelist_from"
+	cfg.Blocklist.Directive = "blocklist_from"
+	cfg.Bayes = config.BayesConfig{SaLearn: "sa-learn", Timeout: 10 * time.Second, MinSpam: 200, MinHam: 200, ImportMaxMessages: 1000, ImportMaxSize: 10 * 1024 * 1024}
+	cfg.RuleUpdates = config.RuleUpdatesConfig{
+		SaUpdate:  "sa-update",
+		Channels:  []string{"updates.spamassassin.org"},
+		VerifyGPG: true,
+		Timeout:   10 * time.Second,
+	}
+	cfg.SpamdReload = config.SpamdReloadConfig{
+		SaCompile: "sa-compile",
+		Method:    "none",
+		PIDFile:   "/var/run/spamd.pid",
+		Timeout:   10 * time.Second,
+	}
+	cfg.AsyncScan = config.AsyncScanConfig{
+		Enabled:       true,
+		SizeThreshold: 5 * 1024 * 1024,
+		Workers:       1,
+		QueueSize:     5,
+		ResultTTL:     time.Minute,
+	}
+	cfg.DNS = config.DNSConfig{
+		Timeout:    10 * time.Second,
+		URIBLZones: []string{"multi.uribl.com", "dbl.spamhaus.org", "multi.surbl.org"},
+	}
+	return cfg
+}
+
+func newTestEnv(t *testing.T, configure func(*config.Config)) *testEnv {
+	t.Helper()
+	return newTestEnvContext(t, context.Background(), configure)
+}
+
+// newTestEnvContext is like newTestEnv, but serves the session with ctx so
+// tests can attach a peer identity as the HTTP transport would.
+func newTestEnvContext(t *testing.T, ctx context.Context, configure func(*config.Config)) *testEnv {
+	t.Helper()
+
+	spamd := spamdtest.NewServer()
+	t.Cleanup(spamd.Close)
+
+	dns := dnstest.NewServer()
+	t.Cleanup(dns.Close)
+
+	cfg := testConfig(t, spamd)
+	cfg.DNS.Server = dns.Addr()
+	if configure != nil {
+		configure(cfg)
+	}
+
+	saClient, err := spamassassin.NewClient(cfg.SpamAssassin)
+	if err != nil {
+		t.Fatalf("failed to connect to fake spamd: %v", err)
+	}
+	// Forget the capability probe so tests see only the requests they cause.
+	spamd.ClearRequests()
+
+	var auditLog *audit.Log
+	if cfg.Audit.Path != "" {
+		auditLog, err = audit.Open(cfg.Audit)
+		if err != nil {
+			t.Fatalf("failed to open audit log: %v", err)
+		}
+		t.Cleanup(func() { auditLog.Close() })
+	}
+
+	scanHistory, err := history.Open(cfg.History)
+	if err != nil {
+		t.Fatalf("failed to open scan history: %v", err)
+	}
+	if scanHistory != nil {
+		t.Cleanup(func() { scanHistory.Close() })
+	}
+
+	held, err := quarantine.Open(cfg.Quarantine)
+	if err != nil {
+		t.Fatalf("failed to open quarantine: %v", err)
+	}
+	if held != nil {
+		t.Cleanup(func() { held.Close() })
+	}
+
+	welcome, err := welcomelist.Open(cfg.Welcomelist)
+	if err != nil {
+		t.Fatalf("failed to open welcomelist: %v", err)
+	}
+
+	blocked, err := blocklist.Open(cfg.Blocklist)
+	if err != nil {
+		t.Fatalf("failed to open blocklist: %v", err)
+	}
+
+	exporter, err := siem.New(cfg.SIEM)
+	if err != nil {
+		t.Fatalf("failed to start SIEM export: %v", err)
+	}
+	t.Cleanup(func() { exporter.Close(5 * time.Second) })
+
+	feed, err := taxii.New(cfg.TAXII)
+	if err != nil {
+		t.Fatalf("failed to set up TAXII publishing: %v", err)
+	}
+
+	urlFeeds := urlfeeds.New(cfg.URLFeeds)
+	peers := peersync.New(cfg.PeerSync)
+
+	locator, err := geoip.Open(cfg.GeoIP)
+	if err != nil {
+		t.Fatalf("failed to load GeoIP databases: %v", err)
+	}
+
+	h := handlers.New(saClient, cfg, auditLog, nil, scanHistory, held, welcome, blocked, exporter, feed, urlFeeds, peers, locator)
+	t.Cleanup(h.Close)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "spamassassin-mcp", Version: "test"}, nil)
+	server.AddReceivingMiddleware(h.AuditMiddleware, h.AuthorizationMiddleware, h.ToolLimitMiddleware, h.ErrorMiddleware)
+	server.AddReceivingMiddleware(h.DrainMiddleware)
+	registerTools(server, h)
+	registerResources(server, h)
+	registerPrompts(server, h)
+
+	env := &testEnv{
+		spamd:    spamd,
+		dns:      dns,
+		handler:  h,
+		feed:     feed,
+		urlFeeds: urlFeeds,
+		peers:    peers,
+		server:   server,
+		ctx:      ctx,
+		progress: make(chan *mcp.ProgressNotificationParams, 100),
+	}
+	env.session = env.connect(t, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, _ *mcp.ClientSession, p *mcp.ProgressNotificationParams) {
+			env.progress <- p
+		},
+	})
+	return env
+}
+
+// connect opens another client session to the server. The server handles
+// each session's requests one at a time, so concurrent calls need separate
+// sessions, as separate HTTP clients would have.
+func (e *testEnv) connect(t *testing.T, opts *mcp.ClientOptions) *mcp.ClientSession {
+	t.Helper()
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := e.server.Connect(e.ctx, serverTransport); err != nil {
+		t.Fatalf("server connect failed: %v", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "e2e", Version: "test"}, opts)
+	session, err := client.Connect(context.Background(), clientTransport)
+	if err != nil {
+		t.Fatalf("client connect failed: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+// call invokes a tool and decodes its structured result into out, if non-nil.
+func (e *testEnv) call(t *testing.T, name string, args any, out any) *mcp.CallToolResult {
+	t.Helper()
+	return e.callWithMeta(t, name, args, nil, out)
+}
+
+func (e *testEnv) callWithMeta(t *testing.T, name string, args any, meta mcp.Meta, out any) *mcp.CallToolResult {
+	t.Helper()
+
+	res, err := e.session.CallTool(context.Background(), &mcp.CallToolParams{
+		Meta:      meta,
+		Name:      name,
+		Arguments: args,
+	})
+	if err != nil {
+		t.Fatalf("%s: call failed: %v", name, err)
+	}
+	if out != nil && !res.IsError {
+		data, err := json.Marshal(res.StructuredContent)
+		if err != nil {
+			t.Fatalf("%s: failed to encode result: %v", name, err)
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s: failed to decode result: %v", name, err)
+		}
+	}
+	return res
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func TestScanEmailHam(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 1.2})
+
+	var result handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail}, &result)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+
+	if result.IsSpam || result.Score != 1.2 || result.Threshold != spamdtest.DefaultThreshold {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	requests := env.spamd.Requests()
+	if len(requests) != 1 || requests[0].Command != "CHECK" {
+		t.Fatalf("expected one CHECK request, got %+v", requests)
+	}
+	if string(requests[0].Body) != testEmail {
+		t.Errorf("spamd received a different message body")
+	}
+}
+
+func TestScanEmailVerboseReport(t *testing.T) {
+	minScore := 10.0
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Tags = []config.TagRule{
+			{Tag: "uribl", Rules: []string{"uribl_black"}},
+			{Tag: "high-score", MinScore: &minScore},
+			{Tag: "never", Rules: []string{"NOT_HIT"}},
+		}
+	})
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 12.5,
+		Rules: []spamdtest.Rule{
+			{Name: "URIBL_BLACK", Score: 3.5, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "BAYES_99", Score: 9.0, Description: "Bayes spam probability is 99 to 100%"},
+		},
+	})
+
+	var result handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true}, &result)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+
+	if !result.IsSpam || result.Score != 12.5 {
+		t.Errorf("unexpected verdict: spam=%v score=%v", result.IsSpam, result.Score)
+	}
+	if len(result.RulesHit) != 2 || result.RulesHit[0].Name != "URIBL_BLACK" || result.RulesHit[1].Score != 9.0 {
+		t.Errorf("unexpected rules: %+v", result.RulesHit)
+	}
+	if got := strings.Join(result.Tags, ","); got != "high-score,uribl" {
+		t.Errorf("tags = %q, want %q", got, "high-score,uribl")
+	}
+	if cmd := env.spamd.Requests()[0].Command; cmd != "REPORT" {
+		t.Errorf("verbose scan sent %s, want REPORT", cmd)
+	}
+}
+
+func TestExplainScoreBreakdown(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 14.7,
+		Rules: []spamdtest.Rule{
+			{Name: "BAYES_99", Score: 3.5, Description: "Bayes spam probability is 99 to 100%"},
+			{Name: "BAYES_999", Score: 0.2, Description: "Bayes spam probability is 99.9 to 100%"},
+			{Name: "URIBL_BLACK", Score: 1.7, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "RCVD_IN_SBL", Score: 2.6, Description: "Received via a relay in Spamhaus SBL"},
+			{Name: "HTML_MESSAGE", Score: 0.1, Description: "HTML included in message"},
+			{Name: "LOTS_OF_MONEY", Score: 6.6, Description: "Huge... sums of money"},
+		},
+	})
+
+	var result handlers.ScoreExplanation
+	res := env.call(t, "explain_score", map[string]any{"email_content": testEmail}, &result)
+	if res.IsError {
+		t.Fatalf("explain_score failed: %s", resultText(res))
+	}
+
+	if result.Bayes == nil || len(result.Bayes.Rules) != 2 || result.Bayes.Probability != "99.9-100%" || result.BayesScore != 3.7 {
+		t.Errorf("unexpected bayes section: %+v (bayes_score %v)", result.Bayes, result.BayesScore)
+	}
+	if len(result.NetworkTests) != 2 ||
+		result.NetworkTests[0].Name != "URIBL_BLACK" || result.NetworkTests[0].Kind != spamassassin.NetworkURIBL ||
+		result.NetworkTests[1].Kind != spamassassin.NetworkDNSBL || result.NetworkTests[1].Score != 2.6 {
+		t.Errorf("unexpected network tests: %+v", result.NetworkTests)
+	}
+	if want := (spamassassin.ScoreSplit{Local: 6.7, Bayes: 3.7, Network: 4.3}); result.ScoreSplit != want {
+		t.Errorf("score split = %+v, want %+v", result.ScoreSplit, want)
+	}
+	if text := resultText(res); !strings.Contains(text, "Network Tests:") || !strings.Contains(text, "Score Split: local 6.70, Bayes 3.70, network 4.30") {
+		t.Errorf("explanation lacks the breakdown:\n%s", text)
+	}
+
+	// Without BAYES hits the classifier did not run.
+	env.spamd.SetResponse("REPORT", spamdtest.Response{Score: 0.1, Rules: []spamdtest.Rule{{Name: "HTML_MESSAGE", Score: 0.1, Description: "HTML included in message"}}})
+	result = handlers.ScoreExplanation{}
+	env.call(t, "explain_score", map[string]any{"email_content": testEmail}, &result)
+	if result.Bayes != nil || result.BayesScore != 0 || len(result.NetworkTests) != 0 || result.ScoreSplit.Local != 0.1 {
+		t.Errorf("unexpected breakdown without bayes: %+v", result)
+	}
+}
+
+func TestScanEmailSpamdFaults(t *testing.T) {
+	faults := map[string]spamdtest.Fault{
+		"drop":        spamdtest.FaultDrop,
+		"unavailable": spamdtest.FaultUnavailable,
+		"garbage":     spamdtest.FaultGarbage,
+		"truncate":    spamdtest.FaultTruncate,
+	}
+
+	for name, fault := range faults {
+		t.Run(name, func(t *testing.T) {
+			env := newTestEnv(t, nil)
+			env.spamd.InjectFault(fault, 1)
+
+			res := env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+			if !res.IsError {
+				t.Fatalf("expected error, got %s", resultText(res))
+			}
+
+			// The fault only applies once; the next scan succeeds.
+			res = env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+			if res.IsError {
+				t.Fatalf("scan after fault failed: %s", resultText(res))
+			}
+		})
+	}
+}
+
+func TestScanConcurrencyLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.MaxConcurrentScans = 1
+		cfg.SpamAssassin.QueueTimeout = 500 * time.Millisecond
+	})
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		if strings.Contains(string(req.Body), "Quarterly") {
+			started <- struct{}{}
+			<-release
+		}
+		return spamdtest.Response{Score: 1.0}
+	})
+
+	// Each client gets its own session so their scans run concurrently.
+	client := func() *testEnv {
+		other := *env
+		other.session = env.connect(t, nil)
+		return &other
+	}
+	scan := func(c *testEnv, content string) chan *mcp.CallToolResult {
+		done := make(chan *mcp.CallToolResult, 1)
+		go func() {
+			res, err := c.session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name:      "scan_email",
+				Arguments: map[string]any{"content": content},
+			})
+			if err != nil {
+				t.Errorf("scan failed: %v", err)
+			}
+			done <- res
+		}()
+		return done
+	}
+
+	first := scan(client(), testEmail)
+	<-started
+
+	// The only slot is held; a second scan queues, then gives up.
+	other := strings.Replace(testEmail, "Quarterly", "Annual", 1)
+	start := time.Now()
+	res := client().call(t, "scan_email", map[string]any{"content": other}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "busy") {
+		t.Fatalf("expected busy error, got %s", resultText(res))
+	}
+	if waited := time.Since(start); waited < 500*time.Millisecond {
+		t.Errorf("gave up after %s, before the queue timeout", waited)
+	}
+
+	// A queued scan proceeds as soon as the slot is released.
+	queued := scan(client(), other)
+	waitFor(t, func() bool {
+		var info spamassassin.ConfigInfo
+		env.call(t, "get_config", map[string]any{}, &info)
+		return info.Scans.Active == 1 && info.Scans.Waiting == 1
+	})
+	close(release)
+	for _, done := range []chan *mcp.CallToolResult{first, queued} {
+		if res := <-done; res == nil || res.IsError {
+			t.Errorf("scan was not completed")
+		}
+	}
+}
+
+func TestScanEmailValidation(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	res := env.call(t, "scan_email", map[string]any{"content": ""}, nil)
+	if !res.IsError {
+		t.Fatal("expected empty content to be rejected")
+	}
+	if len(env.spamd.Requests()) != 0 {
+		t.Error("invalid content must not reach spamd")
+	}
+}
+
+func TestAsyncScan(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetLatency(50 * time.Millisecond)
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Spam: true, Score: 7.5})
+
+	var accepted handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "async": true}, &accepted)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if accepted.ScanID == "" || accepted.Status != "pending" {
+		t.Fatalf("expected pending deferred scan, got %+v", accepted)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var status handlers.ScanStatus
+	for time.Now().Before(deadline) {
+		res := env.call(t, "get_scan_result", map[string]any{"scan_id": accepted.ScanID}, &status)
+		if res.IsError {
+			t.Fatalf("get_scan_result failed: %s", resultText(res))
+		}
+		if status.Status == "completed" || status.Status == "failed" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status.Status != "completed" || status.Result == nil || status.Result.Score != 7.5 {
+		t.Fatalf("unexpected final status: %+v", status)
+	}
+
+	var page struct {
+		Items []handlers.ScanStatus `json:"items"`
+		Total int                   `json:"total"`
+	}
+	env.call(t, "list_scans", map[string]any{"filter": map[string]string{"status": "completed"}}, &page)
+	if page.Total != 1 || page.Items[0].ScanID != accepted.ScanID {
+		t.Errorf("list_scans = %+v", page)
+	}
+
+	res = env.call(t, "get_scan_result", map[string]any{"scan_id": "unknown"}, nil)
+	if !res.IsError {
+		t.Error("expected unknown scan_id to be rejected")
+	}
+}
+
+func TestAsyncScanOwnership(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var accepted handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "async": true}, &accepted)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+
+	// Another client can neither fetch nor list the scan
+	other := env.connect(t, nil)
+	ctx := context.Background()
+	res, err := other.CallTool(ctx, &mcp.CallToolParams{Name: "get_scan_result", Arguments: map[string]any{"scan_id": accepted.ScanID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := res.StructuredContent.(map[string]any)["code"]; !res.IsError || code != string(toolerr.NotFound) {
+		t.Errorf("get_scan_result by another client: code %v: %s", code, resultText(res))
+	}
+	res, err = other.CallTool(ctx, &mcp.CallToolParams{Name: "list_scans", Arguments: map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total := res.StructuredContent.(map[string]any)["total"]; res.IsError || total != 0.0 {
+		t.Errorf("list_scans by another client: %s", resultText(res))
+	}
+	if _, err := other.ReadResource(ctx, &mcp.ReadResourceParams{URI: handlers.ScanResourcePrefix + accepted.ScanID}); err == nil {
+		t.Error("another client read the scan resource")
+	}
+
+	// The submitting client still sees it
+	var status handlers.ScanStatus
+	if res := env.call(t, "get_scan_result", map[string]any{"scan_id": accepted.ScanID}, &status); res.IsError || status.ScanID != accepted.ScanID {
+		t.Errorf("get_scan_result by the submitter: %s", resultText(res))
+	}
+	if _, err := env.session.ReadResource(ctx, &mcp.ReadResourceParams{URI: handlers.ScanResourcePrefix + accepted.ScanID}); err != nil {
+		t.Errorf("submitter could not read the scan resource: %v", err)
+	}
+}
+
+func TestAsyncScanPollingRateLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.RateLimiting.PerClient.RequestsPerMinute = 1
+		cfg.Security.RateLimiting.PerClient.BurstSize = 2
+	})
+
+	var accepted handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail, "async": true}, &accepted); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if res := env.call(t, "get_scan_result", map[string]any{"scan_id": accepted.ScanID}, nil); res.IsError {
+		t.Fatalf("first poll rejected: %s", resultText(res))
+	}
+
+	// Polling counts against the client's budget like any other call
+	for _, tc := range []struct {
+		tool string
+		args map[string]any
+	}{
+		{"get_scan_result", map[string]any{"scan_id": accepted.ScanID}},
+		{"list_scans", map[string]any{}},
+	} {
+		if res := env.call(t, tc.tool, tc.args, nil); !res.IsError || !strings.Contains(resultText(res), "per-client rate limit exceeded") {
+			t.Errorf("%s: expected rate limit error, got %s", tc.tool, resultText(res))
+		}
+	}
+	_, err := env.session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: handlers.ScanResourcePrefix + accepted.ScanID})
+	if err == nil || !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Errorf("expected the scan resource read to be rate limited, got %v", err)
+	}
+}
+
+func TestParseEmail(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var parsed struct {
+		Subject string   `json:"subject"`
+		URLs    []string `json:"urls"`
+		From    []struct {
+			Address string `json:"address"`
+		} `json:"from"`
+	}
+	res := env.call(t, "parse_email", map[string]any{"content": testEmail}, &parsed)
+	if res.IsError {
+		t.Fatalf("parse_email failed: %s", resultText(res))
+	}
+
+	if parsed.Subject != "Quarterly report" {
+		t.Errorf("subject = %q", parsed.Subject)
+	}
+	if len(parsed.From) != 1 || parsed.From[0].Address != "alice@example.com" {
+		t.Errorf("from = %+v", parsed.From)
+	}
+	if len(parsed.URLs) != 1 || parsed.URLs[0] != "https://example.com/q1" {
+		t.Errorf("urls = %v", parsed.URLs)
+	}
+	if len(env.spamd.Requests()) != 0 {
+		t.Error("parse_email must not contact spamd")
+	}
+}
+
+func TestTestRulesProgress(t *testing.T) {
+	// The fake tool hits LOCAL_TEST only when the sandbox local.cf defines
+	// it, so the baseline scan scores 1.0 and the test scan 3.0. The first
+	// report line stands in for a report quoted in the message body.
+	binary := fakeSpamAssassin(t, `
+cat >/dev/null
+echo "Content analysis details:   (1.0 points, 5.0 required)"
+if grep -q LOCAL_TEST "$site/local.cf"; then
+	points=3.0
+	rule=" 2.0 LOCAL_TEST             Local test rule"
+fi
+echo "Content analysis details:   (${points:-1.0} points, 5.0 required)"
+echo
+echo " pts rule name              description"
+echo "---- ---------------------- --------------------------------------------------"
+echo " 1.0 HTML_MESSAGE           BODY: HTML included in message"
+[ -n "$rule" ] && echo "$rule"
+exit 0
+`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Binary = binary
+	})
+
+	var result handlers.TestRulesResult
+	res := env.callWithMeta(t, "test_rules", map[string]any{
+		"rules":       "body LOCAL_TEST /report/\nscore LOCAL_TEST 2.0",
+		"test_emails": []string{testEmail, testEmail},
+	}, mcp.Meta{"progressToken": "rules-1"}, &result)
+	if res.IsError {
+		t.Fatalf("test_rules failed: %s", resultText(res))
+	}
+
+	if len(result.Results) != 2 {
+		t.Fatalf("unexpected results: %+v", result.Results)
+	}
+	r := result.Results[0]
+	if r.Error != "" || r.BaselineScore != 1.0 || r.Score != 3.0 || r.ScoreDelta != 2.0 {
+		t.Errorf("unexpected scores: %+v", r)
+	}
+	if len(r.SubmittedRulesHit) != 1 || r.SubmittedRulesHit[0].Name != "LOCAL_TEST" || r.SubmittedRulesHit[0].Score != 2.0 {
+		t.Errorf("submitted rules hit = %+v", r.SubmittedRulesHit)
+	}
+	if strings.Join(r.RulesAdded, ",") != "LOCAL_TEST" || len(r.RulesRemoved) != 0 || len(r.Rules) != 2 {
+		t.Errorf("rules = %v, added %v, removed %v", r.Rules, r.RulesAdded, r.RulesRemoved)
+	}
+	if strings.Join(result.Rules, ",") != "LOCAL_TEST" {
+		t.Errorf("submitted rules = %v", result.Rules)
+	}
+	if len(env.spamd.Requests()) != 0 {
+		t.Error("test_rules must not scan with the live configuration")
+	}
+
+	if res := env.call(t, "test_rules", map[string]any{
+		"rules":       "include /etc/passwd",
+		"test_emails": []string{testEmail},
+	}, nil); !res.IsError {
+		t.Error("expected include to be rejected")
+	}
+
+	var last *mcp.ProgressNotificationParams
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case p := <-env.progress:
+			last = p
+			done = p.Progress == p.Total
+		case <-timeout:
+			t.Fatalf("did not receive final progress notification, last: %+v", last)
+		}
+	}
+	if last.ProgressToken != "rules-1" || last.Total != 2 {
+		t.Errorf("unexpected progress notification: %+v", last)
+	}
+}
+
+func TestPerClientRateLimit(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.RateLimiting.PerClient.RequestsPerMinute = 1
+		cfg.Security.RateLimiting.PerClient.BurstSize = 2
+	})
+
+	for i := 0; i < 2; i++ {
+		if res := env.call(t, "parse_email", map[string]any{"content": testEmail}, nil); res.IsError {
+			t.Fatalf("request %d rejected: %s", i, resultText(res))
+		}
+	}
+	res := env.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "per-client rate limit exceeded") {
+		t.Fatalf("expected rate limit error, got %s", resultText(res))
+	}
+	var r ratelimit.Rejection
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Code != ratelimit.RateLimited || r.Scope != ratelimit.ScopeClient || r.Tool != "parse_email" || r.Limit != 1 ||
+		r.Period != "minute" || r.Remaining != 0 || r.RetryAfterSeconds <= 0 || r.RetryAfterSeconds > 60 {
+		t.Errorf("unexpected rejection: %+v", r)
+	}
+
+	var state struct {
+		Clients []struct {
+			Allowed  int `json:"allowed"`
+			Rejected int `json:"rejected"`
+		} `json:"clients"`
+	}
+	env.call(t, "get_rate_limits", map[string]any{}, &state)
+	if len(state.Clients) != 1 || state.Clients[0].Allowed != 2 || state.Clients[0].Rejected != 1 {
+		t.Errorf("unexpected limiter state: %+v", state)
+	}
+}
+
+func TestDisabledRateLimit(t *testing.T) {
+	// A zero budget would lift the limit rather than block calls, so it is
+	// refused; disabled turns a budget off explicitly
+	err := validateConfig(t, "security:\n  rate_limiting:\n    per_client:\n      requests_per_minute: 0\n")
+	if err == nil || !strings.Contains(err.Error(), "security.rate_limiting.per_client.requests_per_minute: must be at least 1; to lift the limit set security.rate_limiting.per_client.disabled: true") {
+		t.Errorf("zero per-client budget accepted: %v", err)
+	}
+	if err := validateConfig(t, "security:\n  rate_limiting:\n    per_client:\n      disabled: true\n      requests_per_minute: 0\n"); err != nil {
+		t.Errorf("disabled per-client budget refused: %v", err)
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.RateLimiting.PerClient = config.ClientRateLimit{Disabled: true, RequestsPerMinute: 1, BurstSize: 1, IdleTimeout: time.Minute}
+	})
+	for i := 0; i < 5; i++ {
+		if res := env.call(t, "parse_email", map[string]any{"content": testEmail}, nil); res.IsError {
+			t.Fatalf("request %d rejected: %s", i, resultText(res))
+		}
+	}
+}
+
+func TestToolLimits(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.RateLimiting.PerClient.RequestsPerMinute = 1
+		cfg.Security.RateLimiting.PerClient.BurstSize = 3
+		cfg.Security.RateLimiting.Tools = map[string]config.ToolRateLimit{
+			"parse_email":   {DailyQuota: 2},
+			"get_config":    {RequestsPerMinute: 1, BurstSize: 1},
+			"explain_score": {DailyQuota: 1},
+		}
+	})
+
+	rejection := func(res *mcp.CallToolResult) ratelimit.Rejection {
+		t.Helper()
+		var r ratelimit.Rejection
+		data, _ := json.Marshal(res.StructuredContent)
+		if !res.IsError || json.Unmarshal(data, &r) != nil {
+			t.Fatalf("expected structured rejection, got %s", resultText(res))
+		}
+		return r
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := env.call(t, "parse_email", map[string]any{"content": testEmail}, nil); res.IsError {
+			t.Fatalf("call %d rejected: %s", i, resultText(res))
+		}
+	}
+	r := rejection(env.call(t, "parse_email", map[string]any{"content": testEmail}, nil))
+	tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	if r.Code != ratelimit.QuotaExceeded || r.Tool != "parse_email" || r.Limit != 2 || !r.ResetAt.Equal(tomorrow) || r.RetryAfterSeconds <= 0 {
+		t.Errorf("unexpected quota rejection: %+v", r)
+	}
+
+	env.call(t, "get_config", map[string]any{}, nil)
+	r = rejection(env.call(t, "get_config", map[string]any{}, nil))
+	if r.Code != ratelimit.RateLimited || r.Scope != ratelimit.ScopeTool || r.Period != "minute" || !r.ResetAt.After(time.Now()) {
+		t.Errorf("unexpected rate rejection: %+v", r)
+	}
+
+	// The third and last per-client token; explain_score is then refused by
+	// the per-client budget and must not be charged to its quota.
+	env.call(t, "check_reputation", map[string]any{"sender": "alice@example.com"}, nil)
+	r = rejection(env.call(t, "explain_score", map[string]any{"email_content": testEmail}, nil))
+	if r.Scope != ratelimit.ScopeClient || r.Tool != "explain_score" || r.Remaining != 0 {
+		t.Errorf("unexpected per-client rejection: %+v", r)
+	}
+
+	var state ratelimit.State
+	env.call(t, "get_rate_limits", map[string]any{}, &state)
+	used := map[string]int{}
+	for _, tool := range state.Clients[0].Tools {
+		used[tool.Tool] = tool.UsedToday
+	}
+	if used["parse_email"] != 2 || used["explain_score"] != 0 {
+		t.Errorf("unexpected quota usage: %+v", state.Clients[0].Tools)
+	}
+}
+
+func TestResourcesAndPrompts(t *testing.T) {
+	var rulesDir string
+	env := newTestEnv(t, func(cfg *config.Config) {
+		rulesDir = cfg.SpamAssassin.RulesDirs[0]
+		cfg.Auth.APIKeys = []config.APIKey{{Name: "ci", Key: "0123456789abcdef"}}
+	})
+	ctx := context.Background()
+
+	if err := os.WriteFile(filepath.Join(rulesDir, "local.cf"), []byte("score LOCAL_TEST 1.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rule, err := env.session.ReadResource(ctx, &mcp.ReadResourceParams{URI: handlers.RuleResourcePrefix + "local.cf"})
+	if err != nil {
+		t.Fatalf("read rule file failed: %v", err)
+	}
+	if rule.Contents[0].Text != "score LOCAL_TEST 1.0\n" {
+		t.Errorf("rule file contents = %q", rule.Contents[0].Text)
+	}
+	if _, err := env.session.ReadResource(ctx, &mcp.ReadResourceParams{URI: handlers.RuleResourcePrefix + "../etc/passwd"}); err == nil {
+		t.Error("expected path traversal to be rejected")
+	}
+
+	cfgResource, err := env.session.ReadResource(ctx, &mcp.ReadResourceParams{URI: handlers.ConfigResourceURI})
+	if err != nil {
+		t.Fatalf("read config failed: %v", err)
+	}
+	if text := cfgResource.Contents[0].Text; strings.Contains(text, "0123456789abcdef") || !strings.Contains(text, "[REDACTED]") {
+		t.Errorf("config resource leaks secrets or is not redacted: %s", text)
+	}
+
+	prompt, err := env.session.GetPrompt(ctx, &mcp.GetPromptParams{
+		Name:      "triage_email",
+		Arguments: map[string]string{"email": testEmail},
+	})
+	if err != nil {
+		t.Fatalf("get prompt failed: %v", err)
+	}
+	text := prompt.Messages[0].Content.(*mcp.TextContent).Text
+	if !strings.Contains(text, "scan_email") || !strings.Contains(text, "Quarterly report") {
+		t.Errorf("prompt does not reference tools and email: %s", text)
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	env := newTestEnv(t, nil)
+	tools, err := env.session.ListTools(context.Background(), &mcp.ListToolsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotations := make(map[string]*mcp.ToolAnnotations, len(tools.Tools))
+	for _, tool := range tools.Tools {
+		annotations[tool.Name] = tool.Annotations
+	}
+
+	// Scans record history and may quarantine, export and route the message
+	for _, name := range []string{"scan_email", "scan_mailbox", "scan_object"} {
+		a := annotations[name]
+		if a == nil || a.ReadOnlyHint || a.IdempotentHint || a.DestructiveHint == nil || *a.DestructiveHint {
+			t.Errorf("%s: unexpected annotations %+v", name, a)
+		}
+	}
+	if a := annotations["parse_email"]; a == nil || !a.ReadOnlyHint || !a.IdempotentHint {
+		t.Errorf("parse_email: unexpected annotations %+v", a)
+	}
+}
+
+func TestGracefulDrain(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 0.5})
+	env.spamd.SetLatency(300 * time.Millisecond)
+
+	// Start a scan and wait until it is in flight at spamd.
+	scanned := make(chan *mcp.CallToolResult, 1)
+	go func() {
+		res, err := env.session.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "scan_email",
+			Arguments: map[string]any{"content": testEmail},
+		})
+		if err != nil {
+			t.Errorf("in-flight scan failed: %v", err)
+		}
+		scanned <- res
+	}()
+	waitFor(t, func() bool { return len(env.spamd.Requests()) == 1 })
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- env.handler.Drain(ctx)
+	}()
+	waitFor(t, env.handler.Draining)
+
+	// A new call must come from another session; calls on one session are
+	// handled in order and would queue behind the scan.
+	other := *env
+	other.session = env.connect(t, nil)
+	res := other.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "shutting down") {
+		t.Errorf("expected new call to be rejected while draining, got %s", resultText(res))
+	}
+
+	select {
+	case err := <-drained:
+		t.Fatalf("drain finished before the in-flight scan: %v", err)
+	default:
+	}
+
+	if res := <-scanned; res == nil || res.IsError {
+		t.Fatalf("in-flight scan was not completed")
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("drain failed: %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var path string
+	env := newTestEnv(t, func(cfg *config.Config) {
+		path = filepath.Join(t.TempDir(), "audit.jsonl")
+		cfg.Audit.Path = path
+	})
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 1.0})
+
+	start := time.Now().UTC().Add(-time.Second)
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	env.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+	env.call(t, "scan_email", map[string]any{"content": "not an email"}, nil)
+
+	type page struct {
+		Items []audit.Record `json:"items"`
+		Total int            `json:"total"`
+	}
+	var scans page
+	res := env.call(t, "query_audit_log", map[string]any{
+		"filter": map[string]string{"tool": "scan_email", "time_from": start.Format(time.RFC3339)},
+		"sort":   "seq",
+	}, &scans)
+	if res.IsError {
+		t.Fatalf("query_audit_log failed: %s", resultText(res))
+	}
+	if scans.Total != 2 || scans.Items[0].Outcome != "success" || scans.Items[1].Outcome != "error" {
+		t.Fatalf("unexpected scan records: %+v", scans)
+	}
+	rec := scans.Items[0]
+	if rec.Actor == "" || rec.ParamsDigest == "" || rec.Hash == "" || rec.PrevHash == "" {
+		t.Errorf("record missing identity, digest or chain fields: %+v", rec)
+	}
+	if !strings.Contains(resultText(res), "hash chain verified") {
+		t.Errorf("expected verified chain, got %s", resultText(res))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Quarterly report") {
+		t.Error("audit log contains message content")
+	}
+
+	var future page
+	env.call(t, "query_audit_log", map[string]any{
+		"filter": map[string]string{"time_from": time.Now().Add(time.Hour).Format(time.RFC3339)},
+	}, &future)
+	if future.Total != 0 {
+		t.Errorf("expected no records in the future, got %d", future.Total)
+	}
+
+	// Rewrite the outcome of an earlier record; the chain must expose it.
+	tampered := strings.Replace(string(data), `"outcome":"error"`, `"outcome":"success"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	res = env.call(t, "query_audit_log", map[string]any{}, nil)
+	if !strings.Contains(resultText(res), "audit chain broken") {
+		t.Errorf("expected tampering to be detected, got %s", resultText(res))
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	strict := 3.0
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.BlockedDomains = []string{"spam.example"}
+		cfg.Profiles = map[string]config.Profile{
+			"team-a": {Threshold: &strict, SpamdUser: "team-a", BlockedDomains: []string{"phish.example"}},
+			"team-b": {AllowedSenders: []string{"bob@partner.example"}},
+		}
+	})
+	env.spamd.SetResponse("", spamdtest.Response{Score: 4.0})
+
+	var result handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, &result)
+	if result.IsSpam || result.Threshold != spamdtest.DefaultThreshold || result.Profile != "" {
+		t.Errorf("default policy: unexpected result %+v", result)
+	}
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "profile": "team-a"}, &result)
+	if !result.IsSpam || result.Threshold != strict || result.Profile != "team-a" {
+		t.Errorf("team-a: unexpected result %+v", result)
+	}
+	reqs := env.spamd.Requests()
+	if user := reqs[len(reqs)-1].Headers.Get("User"); user != "team-a" {
+		t.Errorf("spamd user = %q, want team-a", user)
+	}
+
+	reputation := func(profile, sender string) handlers.ReputationResult {
+		t.Helper()
+		var rep handlers.ReputationResult
+		env.call(t, "check_reputation", map[string]any{"sender": sender, "profile": profile}, &rep)
+		return rep
+	}
+	if !reputation("", "x@spam.example").Blocked || reputation("team-a", "x@spam.example").Blocked {
+		t.Error("team-a should replace the server-wide blocked domains")
+	}
+	if !reputation("team-a", "x@phish.example").Blocked {
+		t.Error("team-a blocked domain not applied")
+	}
+	if rep := reputation("team-b", "bob@partner.example"); rep.Reputation != "good" || !reputation("team-b", "x@spam.example").Blocked {
+		t.Errorf("team-b: unexpected reputation %+v", rep)
+	}
+
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "profile": "team-c"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), `unknown profile "team-c"`) {
+		t.Errorf("unknown profile: got %s", resultText(res))
+	}
+
+	var info spamassassin.ConfigInfo
+	env.call(t, "get_config", map[string]any{}, &info)
+	if strings.Join(info.Profiles, ",") != "aggressive,balanced,permissive,team-a,team-b" {
+		t.Errorf("get_config profiles = %v", info.Profiles)
+	}
+}
+
+func TestScanAsUser(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.AllowedUsers = []string{"alice", "bob@example.com"}
+		cfg.Profiles = map[string]config.Profile{"team-a": {SpamdUser: "team-a"}}
+	})
+	lastUser := func() string {
+		reqs := env.spamd.Requests()
+		return reqs[len(reqs)-1].Headers.Get("User")
+	}
+
+	// Without a user or profile, spamd scans as its own user.
+	var result handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, &result)
+	if user := lastUser(); user != "" || result.User != "" {
+		t.Errorf("expected spamd's own user, got header %q, result %q", user, result.User)
+	}
+
+	// The requested user replaces the profile's.
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "profile": "team-a", "user": "bob@example.com"}, &result)
+	if user := lastUser(); user != "bob@example.com" || result.User != "bob@example.com" {
+		t.Errorf("expected bob@example.com, got header %q, result %q", user, result.User)
+	}
+	env.call(t, "explain_score", map[string]any{"email_content": testEmail, "user": "alice"}, nil)
+	if user := lastUser(); user != "alice" {
+		t.Errorf("explain_score ran as %q, want alice", user)
+	}
+
+	before := len(env.spamd.Requests())
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "user": "mallory"}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), `user "mallory" is not allowed`) || len(env.spamd.Requests()) != before {
+		t.Errorf("expected mallory to be rejected before scanning, got %s", resultText(res))
+	}
+
+	var info spamassassin.ConfigInfo
+	env.call(t, "get_config", map[string]any{}, &info)
+	if strings.Join(info.Users, ",") != "alice,bob@example.com" {
+		t.Errorf("get_config users = %v", info.Users)
+	}
+}
@@ -153,4 +153,4 @@ echo "To connect with Claude Code:"
 echo "  claude --mcp-server spamassassin tcp://$MCP_HOST"
 echo
 echo "To check server health:"
-echo "  curl -f http://$MCP_HOST/health || docker-compose exec spamassassin-mcp /usr/local/bin/health-check.sh"
\ No newline at end of file
+echo "  docker-compose exec spamassassin-mcp curl -f http://localhost:8081/readyz"
\ No newline at end of file
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+const fblMessage = "From: News <news@newsletter.example>\r\n" +
+	"To: redacted@mailbox.example\r\n" +
+	"Subject: Weekly deals\r\n" +
+	"Message-ID: <deals-42@newsletter.example>\r\n" +
+	"\r\n" +
+	"This week only: 50% off.\r\n"
+
+// fblReport wraps message in an ARF report as a mailbox provider would,
+// base64-encoding the returned message.
+func fblReport(feedbackType, messageType string) string {
+	return "From: FBL <staff@mailbox.example>\r\n" +
+		"To: fbl@newsletter.example\r\n" +
+		"Subject: complaint about message from 192.0.2.25\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=feedback-report; boundary=\"fbl\"\r\n" +
+		"\r\n" +
+		"--fbl\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"This is an email abuse report.\r\n" +
+		"--fbl\r\n" +
+		"Content-Type: message/feedback-report\r\n" +
+		"\r\n" +
+		"Feedback-Type: " + feedbackType + "\r\n" +
+		"User-Agent: MailboxFBL/1.0\r\n" +
+		"Version: 1\r\n" +
+		"Source-IP: 192.0.2.25\r\n" +
+		"Original-Rcpt-To: <redacted@mailbox.example>\r\n" +
+		"Arrival-Date: Wed, 15 Jan 2025 10:30:00 +0000\r\n" +
+		"Reported-Domain: Newsletter.example\r\n" +
+		"\r\n" +
+		"--fbl\r\n" +
+		"Content-Type: " + messageType + "\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte(fblMessage)) + "\r\n" +
+		"--fbl--\r\n"
+}
+
+func TestIngestFBLReport(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.AllowedUsers = []string{"marketing"}
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+	})
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Score: 3.2,
+		Rules: []spamdtest.Rule{{Name: "DCC_CHECK", Score: 3.2, Description: "Detected as bulk mail by DCC"}},
+	})
+	env.spamd.SetResponse("TELL", spamdtest.Response{Headers: map[string]string{"DidSet": "local"}})
+
+	var result handlers.IngestFBLReportResult
+	res := env.call(t, "ingest_fbl_report", map[string]any{"content": fblReport("abuse", "message/rfc822"), "learn": true, "user": "marketing"}, &result)
+	if res.IsError {
+		t.Fatalf("ingest_fbl_report failed: %s", resultText(res))
+	}
+	if result.Reporter != "staff@mailbox.example" || result.FeedbackType != "abuse" || result.UserAgent != "MailboxFBL/1.0" ||
+		result.SourceIP != "192.0.2.25" || len(result.OriginalRcptTo) != 1 || result.OriginalRcptTo[0] != "redacted@mailbox.example" ||
+		result.ArrivalDate == nil || result.ArrivalDate.Hour() != 10 || len(result.ReportedDomains) != 1 || result.ReportedDomains[0] != "newsletter.example" {
+		t.Errorf("unexpected feedback fields: %+v", result.Feedback)
+	}
+	if result.Sender != "news@newsletter.example" || result.Subject != "Weekly deals" || result.Score != 3.2 || result.IsSpam ||
+		len(result.Rules) != 1 || !result.Recorded || !result.Learned || result.User != "marketing" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	reqs := env.spamd.Requests()
+	tell := reqs[len(reqs)-1]
+	if tell.Command != "TELL" || tell.Version != "SPAMC/1.3" || tell.Headers.Get("Message-class") != "spam" ||
+		tell.Headers.Get("Set") != "local" || tell.Headers.Get("User") != "marketing" || string(tell.Body) != fblMessage {
+		t.Errorf("unexpected TELL request: %+v", tell)
+	}
+	if text := resultText(res); !strings.Contains(text, "abuse complaint from staff@mailbox.example about mail from news@newsletter.example") ||
+		!strings.Contains(text, "learned as spam") {
+		t.Errorf("unexpected text result: %s", text)
+	}
+
+	// The complaint is in the history, apart from scans.
+	env.call(t, "scan_email", map[string]any{"content": fblMessage}, nil)
+	var page listquery.Page[*history.Entry]
+	env.call(t, "query_history", map[string]any{"filter": map[string]string{"complaint": "true"}}, &page)
+	if page.Total != 1 || !page.Items[0].Complaint || page.Items[0].Hash != result.Hash || page.Items[0].Sender != "news@newsletter.example" {
+		t.Errorf("unexpected complaints: %+v", page)
+	}
+	var trends history.TrendReport
+	env.call(t, "get_trends", map[string]any{}, &trends)
+	if trends.Scans != 1 || trends.Complaints != 1 {
+		t.Errorf("trends counted %d scans and %d complaints", trends.Scans, trends.Complaints)
+	}
+
+	// spamd reports no DidSet for a message it learned before.
+	env.spamd.SetResponse("TELL", spamdtest.Response{})
+	var again handlers.IngestFBLReportResult
+	env.call(t, "ingest_fbl_report", map[string]any{"content": fblReport("abuse", "message/rfc822"), "learn": true}, &again)
+	if again.Learned || again.LearnSkipped != "already learned as spam" {
+		t.Errorf("unexpected relearn result: learned %v, skipped %q", again.Learned, again.LearnSkipped)
+	}
+
+	// Not-spam and headers-only reports are not learned.
+	before := len(env.spamd.Requests())
+	var notSpam, headers handlers.IngestFBLReportResult
+	env.call(t, "ingest_fbl_report", map[string]any{"content": fblReport("not-spam", "message/rfc822"), "learn": true}, &notSpam)
+	env.call(t, "ingest_fbl_report", map[string]any{"content": fblReport("abuse", "text/rfc822-headers"), "learn": true}, &headers)
+	if notSpam.Learned || !strings.Contains(notSpam.LearnSkipped, "not spam") {
+		t.Errorf("unexpected not-spam result: %+v", notSpam)
+	}
+	if headers.Learned || !headers.HeadersOnly || !strings.Contains(headers.LearnSkipped, "only the message headers") {
+		t.Errorf("unexpected headers-only result: %+v", headers)
+	}
+	for _, req := range env.spamd.Requests()[before:] {
+		if req.Command == "TELL" {
+			t.Error("TELL sent for a report that must not be learned")
+		}
+	}
+
+	if res := env.call(t, "ingest_fbl_report", map[string]any{"content": fblMessage}, nil); !res.IsError || !strings.Contains(resultText(res), "not an ARF report") {
+		t.Errorf("expected a format error, got %s", resultText(res))
+	}
+}
+
+func TestScanHistoryAddsColumns(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "history.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE scan_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hash TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			score DOUBLE PRECISION NOT NULL,
+			threshold DOUBLE PRECISION NOT NULL,
+			is_spam BOOLEAN NOT NULL,
+			rules TEXT NOT NULL,
+			profile TEXT NOT NULL,
+			scanned_at BIGINT NOT NULL
+		)`,
+		`INSERT INTO scan_history (hash, sender, score, threshold, is_spam, rules, profile, scanned_at) VALUES ('old', '', 1, 5, false, '', '', 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	store, err := history.Open(config.HistoryConfig{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatalf("existing history not opened: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	if err := store.Record(ctx, &history.Entry{Hash: "new", Complaint: true}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := store.Find(ctx, history.Criteria{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	complaints := map[string]bool{}
+	for _, e := range entries {
+		complaints[e.Hash] = e.Complaint
+	}
+	if len(entries) != 2 || complaints["old"] || !complaints["new"] {
+		t.Errorf("unexpected entries: %v", complaints)
+	}
+}
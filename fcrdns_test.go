@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/fcrdns"
+	"spamassassin-mcp/internal/handlers"
+)
+
+func TestReverseDNS(t *testing.T) {
+	env := newTestEnv(t, nil)
+	// A mail server whose PTR name resolves back to it
+	env.dns.AddPTR("198.51.100.10", "mail.example.com")
+	env.dns.AddA("mail.example.com", "198.51.100.10")
+	// A PTR name pointing elsewhere
+	env.dns.AddPTR("198.51.100.11", "mail.bank.example")
+	env.dns.AddA("mail.bank.example", "192.0.2.1")
+	// A residential range with confirmed generic names
+	env.dns.AddPTR("203.0.113.7", "dynamic-203-0-113-7.dsl.isp.example")
+	env.dns.AddA("dynamic-203-0-113-7.dsl.isp.example", "203.0.113.7")
+	// An unresolvable forward lookup
+	env.dns.AddPTR("198.51.100.12", "broken.example.org")
+	env.dns.Fail("broken.example.org")
+
+	check := func(args map[string]any) handlers.ReputationResult {
+		t.Helper()
+		var rep handlers.ReputationResult
+		if res := env.call(t, "check_reputation", args, &rep); res.IsError {
+			t.Fatalf("check_reputation failed: %s", resultText(res))
+		}
+		return rep
+	}
+
+	rep := check(map[string]any{"sender": "alice@example.com", "ip": "198.51.100.10", "helo": "mail.example.com."})
+	if r := rep.ReverseDNS; r == nil || !r.FCrDNS || !slices.Equal(r.Confirmed, []string{"mail.example.com"}) ||
+		r.Generic != "" || r.HeloMatch == nil || !*r.HeloMatch || rep.Reputation != "unknown" {
+		t.Errorf("unexpected result for a confirmed mail server: %s %+v", rep.Reputation, rep.ReverseDNS)
+	}
+
+	rep = check(map[string]any{"ip": "198.51.100.10", "helo": "other.example.net"})
+	if rep.Reputation != "unknown" || !slices.Contains(rep.Reasons, "HELO other.example.net is not a forward-confirmed name of IP 198.51.100.10") {
+		t.Errorf("HELO mismatch not noted without counting against the sender: %s %v", rep.Reputation, rep.Reasons)
+	}
+	rep = check(map[string]any{"ip": "198.51.100.10", "helo": "[198.51.100.10]"})
+	if rep.ReverseDNS.HeloMatch == nil || !*rep.ReverseDNS.HeloMatch {
+		t.Errorf("matching address literal not accepted: %+v", rep.ReverseDNS)
+	}
+
+	rep = check(map[string]any{"ip": "198.51.100.11"})
+	if rep.ReverseDNS == nil || rep.ReverseDNS.FCrDNS || rep.Reputation != "bad" ||
+		!slices.Contains(rep.Reasons, "PTR mail.bank.example of IP 198.51.100.11 does not resolve back to it") {
+		t.Errorf("unconfirmed PTR not flagged: %s %v %+v", rep.Reputation, rep.Reasons, rep.ReverseDNS)
+	}
+
+	var text string
+	if res := env.call(t, "check_reputation", map[string]any{"ip": "203.0.113.7"}, &rep); res.IsError {
+		t.Fatalf("check_reputation failed: %s", resultText(res))
+	} else {
+		text = resultText(res)
+	}
+	if rep.ReverseDNS == nil || !rep.ReverseDNS.FCrDNS || rep.ReverseDNS.Generic != "dynamic-203-0-113-7.dsl.isp.example" ||
+		rep.Reputation != "bad" || !strings.Contains(text, "looks like a dynamic or residential address") {
+		t.Errorf("generic PTR not flagged: %s %+v\n%s", rep.Reputation, rep.ReverseDNS, text)
+	}
+
+	rep = check(map[string]any{"ip": "192.0.2.99"})
+	if rep.ReverseDNS == nil || len(rep.ReverseDNS.PTR) != 0 || rep.Reputation != "unknown" ||
+		!slices.Contains(rep.Reasons, "IP 192.0.2.99 has no PTR record") {
+		t.Errorf("missing PTR not noted without counting against the sender: %s %v", rep.Reputation, rep.Reasons)
+	}
+
+	rep = check(map[string]any{"ip": "198.51.100.12"})
+	if rep.ReverseDNS != nil || !strings.Contains(rep.Details["fcrdns_error"], "lookup of broken.example.org failed") || rep.Reputation != "unknown" {
+		t.Errorf("lookup failure not reported: %s %+v %v", rep.Reputation, rep.ReverseDNS, rep.Details)
+	}
+
+	// skip_dns and private addresses make no lookups.
+	before := len(env.dns.Queries())
+	check(map[string]any{"ip": "198.51.100.11", "skip_dns": true})
+	check(map[string]any{"ip": "10.0.0.1"})
+	if queries := env.dns.Queries()[before:]; len(queries) != 0 {
+		t.Errorf("unexpected lookups: %v", queries)
+	}
+
+	for name, want := range map[string]bool{
+		"cb007107.pool.example.net":   true,
+		"203000113007.example.net":    true,
+		"7.113.0.203.example.net":     true,
+		"adsl12.example.net":          true,
+		"mail.example.net":            false,
+		"mx1203-0-113-70.example.net": false,
+		"customer-care.example.net":   true,
+		"static.example.net":          false,
+		"dsl.example":                 false,
+	} {
+		if got := fcrdns.Generic(name, net.ParseIP("203.0.113.7")); got != want {
+			t.Errorf("Generic(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
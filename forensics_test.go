@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/forensics"
+)
+
+const relayedEmail = "Received: from mx.example.net (mx.example.net [10.0.0.2])\r\n" +
+	"\tby inbox.example.net with LMTP id 7Hq2; Tue, 1 Oct 2024 10:00:30 +0000\r\n" +
+	"Received: from mail.example.com (out.example.com [203.0.113.5])\r\n" +
+	"\tby mx.example.net (Postfix) with ESMTPS id 4XyZ\r\n" +
+	"\tfor <bob@example.net>; Tue, 1 Oct 2024 10:00:20 +0000 (UTC)\r\n" +
+	"Received: from laptop ([192.168.1.10] helo=laptop.local)\r\n" +
+	"\tby mail.example.com with esmtpsa (Exim 4.97); Tue, 01 Oct 2024 10:00:05 +0000\r\n" +
+	"From: alice@example.com\r\n" +
+	"To: bob@example.net\r\n" +
+	"Subject: Quarterly report\r\n" +
+	"Date: Tue, 1 Oct 2024 10:00:00 +0000\r\n" +
+	"Message-ID: <q1@example.com>\r\n" +
+	"\r\n" +
+	"Hi Bob, the report is at https://example.com/q1.\r\n"
+
+func TestAnalyzeHeaders(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.dns.AddPTR("203.0.113.5", "out.example.com")
+
+	analyze := func(t *testing.T, args map[string]any) *forensics.Report {
+		t.Helper()
+		var report forensics.Report
+		if res := env.call(t, "analyze_headers", args, &report); res.IsError {
+			t.Fatalf("analyze_headers failed: %s", resultText(res))
+		}
+		return &report
+	}
+	anomalies := func(r *forensics.Report) map[string]int {
+		found := make(map[string]int)
+		for _, a := range r.Anomalies {
+			found[a.Type] = a.Hop
+		}
+		return found
+	}
+
+	report := analyze(t, map[string]any{"content": relayedEmail})
+	if len(report.Hops) != 3 {
+		t.Fatalf("got %d hops, want 3: %+v", len(report.Hops), report.Hops)
+	}
+	if h := report.Hops[0]; h.Index != 1 || h.Helo != "laptop.local" || h.ReverseDNS != "laptop" || h.IP != "192.168.1.10" || !h.Private || h.DelaySeconds != nil {
+		t.Errorf("unexpected first hop: %+v", h)
+	}
+	if h := report.Hops[1]; h.Helo != "mail.example.com" || h.ReverseDNS != "out.example.com" || h.IP != "203.0.113.5" ||
+		h.By != "mx.example.net" || h.With != "ESMTPS" || h.ID != "4XyZ" || h.For != "bob@example.net" ||
+		h.DelaySeconds == nil || *h.DelaySeconds != 15 || len(h.PTR) != 1 || h.PTR[0] != "out.example.com" {
+		t.Errorf("unexpected second hop: %+v", h)
+	}
+	if h := report.Hops[2]; h.IP != "10.0.0.2" || h.DelaySeconds == nil || *h.DelaySeconds != 10 || h.PTR != nil {
+		t.Errorf("unexpected third hop: %+v", h)
+	}
+	if report.OriginatingIP != "203.0.113.5" || report.OriginatingHop != 2 {
+		t.Errorf("originating IP = %s (hop %d), want 203.0.113.5 (hop 2)", report.OriginatingIP, report.OriginatingHop)
+	}
+	if report.TransitSeconds == nil || *report.TransitSeconds != 25 {
+		t.Errorf("transit = %v, want 25s", report.TransitSeconds)
+	}
+	if found := anomalies(report); len(found) != 1 || found[forensics.HeloPTRMismatch] != 2 {
+		t.Errorf("unexpected anomalies: %+v", report.Anomalies)
+	}
+
+	// A forged message: no Message-ID, a Date days after receipt, a hop
+	// received before the one that handed it over and a relay without
+	// reverse DNS.
+	forged := strings.NewReplacer(
+		"Message-ID: <q1@example.com>\r\n", "",
+		"Date: Tue, 1 Oct 2024 10:00:00", "Date: Fri, 4 Oct 2024 10:00:00",
+		"10:00:05 +0000", "10:01:05 +0000",
+		"[203.0.113.5]", "[198.51.100.7]",
+	).Replace(relayedEmail)
+
+	report = analyze(t, map[string]any{"content": forged})
+	found := anomalies(report)
+	for typ, hop := range map[string]int{
+		forensics.MissingMessageID: 0,
+		forensics.DateSkew:         0,
+		forensics.NegativeDelay:    2,
+		forensics.MissingPTR:       2,
+	} {
+		if got, ok := found[typ]; !ok || got != hop {
+			t.Errorf("missing %s anomaly for hop %d: %+v", typ, hop, report.Anomalies)
+		}
+	}
+	if report.Hops[1].DelaySeconds == nil || *report.Hops[1].DelaySeconds != -45 {
+		t.Errorf("delay = %v, want -45s", report.Hops[1].DelaySeconds)
+	}
+
+	// Without DNS the chain is still reconstructed, but relays are not
+	// looked up.
+	queries := len(env.dns.Queries())
+	report = analyze(t, map[string]any{"content": forged, "skip_dns": true})
+	if found := anomalies(report); len(report.Hops) != 3 || found[forensics.MissingPTR] != 0 || report.Hops[1].PTR != nil {
+		t.Errorf("unexpected report without DNS: %+v", report)
+	}
+	if len(env.dns.Queries()) != queries {
+		t.Error("skip_dns still queried DNS")
+	}
+
+	// Exchange records the peer address bare, and messages submitted
+	// through webmail carry it in X-Originating-IP.
+	internal := "Received: from EXCH01.corp.example (10.1.2.3) by EXCH02.corp.example (10.1.2.4) with Microsoft SMTP Server id 15.2.1118.7;\r\n" +
+		" Tue, 1 Oct 2024 10:00:00 +0000\r\n" +
+		"X-Originating-IP: [203.0.113.77]\r\n" +
+		testEmail
+	report = analyze(t, map[string]any{"content": internal, "skip_dns": true})
+	if h := report.Hops[0]; h.Helo != "EXCH01.corp.example" || h.IP != "10.1.2.3" || h.By != "EXCH02.corp.example" || h.Received == nil {
+		t.Errorf("unexpected Exchange hop: %+v", h)
+	}
+	if report.OriginatingIP != "203.0.113.77" || report.OriginatingHop != 0 {
+		t.Errorf("originating IP = %s (hop %d), want 203.0.113.77 from X-Originating-IP", report.OriginatingIP, report.OriginatingHop)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/forensics"
+	"spamassassin-mcp/internal/geoip"
+)
+
+// mmdbNetwork is a network and the record a test database holds for it.
+type mmdbNetwork struct {
+	cidr   string
+	record map[string]any
+}
+
+// writeMMDB writes an IPv6 MaxMind DB file with 24-bit records holding
+// networks, in the layout of the GeoLite2 databases.
+func writeMMDB(t *testing.T, dbType string, networks []mmdbNetwork) string {
+	t.Helper()
+
+	type node struct{ children [2]int } // 0: empty, >0: node+1, <0: -(data offset+1)
+	nodes := []node{{}}
+	var data []byte
+	for _, n := range networks {
+		_, network, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, bits := network.Mask.Size()
+		ip := network.IP.To16()
+		if bits == 32 {
+			// IPv4 networks live under ::/96
+			ip = append(make(net.IP, 12), network.IP.To4()...)
+			ones += 96
+		}
+		offset := len(data)
+		data = append(data, encodeMMDB(n.record)...)
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == ones-1 {
+				nodes[current].children[bit] = -(offset + 1)
+				break
+			}
+			if nodes[current].children[bit] <= 0 {
+				nodes = append(nodes, node{})
+				nodes[current].children[bit] = len(nodes)
+			}
+			current = nodes[current].children[bit] - 1
+		}
+	}
+
+	count := len(nodes)
+	var file []byte
+	for _, n := range nodes {
+		for _, child := range n.children {
+			var record int
+			switch {
+			case child == 0:
+				record = count
+			case child > 0:
+				record = child - 1
+			default:
+				record = count + 16 + (-child - 1)
+			}
+			file = append(file, byte(record>>16), byte(record>>8), byte(record))
+		}
+	}
+	file = append(file, make([]byte, 16)...)
+	file = append(file, data...)
+	file = append(file, "\xab\xcd\xefMaxMind.com"...)
+	file = append(file, encodeMMDB(map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               dbType,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+	})...)
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	if err := os.WriteFile(path, file, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encodeMMDB encodes maps, strings and 16- and 32-bit unsigned integers in
+// the MaxMind DB data format, for sizes below 285.
+func encodeMMDB(v any) []byte {
+	control := func(kind, size int) []byte {
+		if size >= 29 {
+			return []byte{byte(kind<<5 | 29), byte(size - 29)}
+		}
+		return []byte{byte(kind<<5 | size)}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		out := control(7, len(v))
+		for key, value := range v {
+			out = append(out, encodeMMDB(key)...)
+			out = append(out, encodeMMDB(value)...)
+		}
+		return out
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint16:
+		return append(control(5, 2), byte(v>>8), byte(v))
+	case uint32:
+		return append(control(6, 4), binary.BigEndian.AppendUint32(nil, v)...)
+	}
+	panic("unsupported type")
+}
+
+func country(iso, name, continent string) map[string]any {
+	return map[string]any{
+		"country":   map[string]any{"iso_code": iso, "names": map[string]any{"en": name}},
+		"continent": map[string]any{"code": continent},
+	}
+}
+
+func TestGeoIPHeaders(t *testing.T) {
+	countryDB := writeMMDB(t, "GeoLite2-Country", []mmdbNetwork{
+		{"203.0.113.0/24", country("JP", "Japan", "AS")},
+		{"198.51.100.0/25", country("DE", "Germany", "EU")},
+		{"198.51.100.128/25", country("FR", "France", "EU")},
+		{"192.0.2.0/24", country("US", "United States", "NA")},
+		{"2001:db8::/32", country("GB", "United Kingdom", "EU")},
+	})
+	asnDB := writeMMDB(t, "GeoLite2-ASN", []mmdbNetwork{
+		{"203.0.113.0/24", map[string]any{"autonomous_system_number": uint32(64500), "autonomous_system_organization": "Example Hosting"}},
+	})
+
+	locator, err := geoip.Open(config.GeoIPConfig{CountryDB: countryDB, ASNDB: asnDB})
+	if err != nil {
+		t.Fatalf("failed to open databases: %v", err)
+	}
+	loc, err := locator.Lookup(net.ParseIP("2001:db8::1"))
+	if err != nil || loc == nil || loc.Country != "GB" || loc.CountryName != "United Kingdom" || loc.ASN != 0 {
+		t.Errorf("unexpected IPv6 location %+v, %v", loc, err)
+	}
+	if loc, err := locator.Lookup(net.ParseIP("8.8.8.8")); loc != nil || err != nil {
+		t.Errorf("expected no location for an unlisted address, got %+v, %v", loc, err)
+	}
+
+	corrupt := filepath.Join(t.TempDir(), "corrupt.mmdb")
+	if err := os.WriteFile(corrupt, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := geoip.Open(config.GeoIPConfig{CountryDB: corrupt}); err == nil || !strings.Contains(err.Error(), "country database") {
+		t.Errorf("expected a corrupt database to fail to open, got %v", err)
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.GeoIP = config.GeoIPConfig{CountryDB: countryDB, ASNDB: asnDB}
+	})
+
+	// Received headers, newest first: the message leaves Japan, crosses
+	// Europe twice over and comes back to Asia by way of the US.
+	received := []string{
+		"from relay6.example.net (relay6.example.net [203.0.113.6]) by mx.example.org; Mon, 2 Jan 2006 15:10:00 +0000",
+		"from relay5.example.net (relay5.example.net [192.0.2.9]) by relay6.example.net; Mon, 2 Jan 2006 15:08:00 +0000",
+		"from relay4.example.net (relay4.example.net [198.51.100.8]) by relay5.example.net; Mon, 2 Jan 2006 15:06:00 +0000",
+		"from relay3.example.net (relay3.example.net [198.51.100.200]) by relay4.example.net; Mon, 2 Jan 2006 15:04:00 +0000",
+		"from relay2.example.net (relay2.example.net [198.51.100.7]) by relay3.example.net; Mon, 2 Jan 2006 15:02:00 +0000",
+		"from sender.example.net (sender.example.net [203.0.113.5]) by relay2.example.net; Mon, 2 Jan 2006 15:00:00 +0000",
+		"from workstation (workstation [10.0.0.1]) by sender.example.net; Mon, 2 Jan 2006 14:59:00 +0000",
+	}
+	content := "Received: " + strings.Join(received, "\r\nReceived: ") + "\r\n" +
+		"From: alice@example.com\r\nMessage-ID: <1@example.com>\r\nDate: Mon, 2 Jan 2006 14:59:00 +0000\r\n\r\nHello\r\n"
+
+	var report forensics.Report
+	res := env.call(t, "analyze_headers", map[string]any{"content": content, "skip_dns": true}, &report)
+	if res.IsError {
+		t.Fatalf("analyze_headers failed: %s", resultText(res))
+	}
+	if geo := report.OriginatingGeo; report.OriginatingIP != "203.0.113.5" || geo == nil || geo.Country != "JP" ||
+		geo.Continent != "AS" || geo.ASN != 64500 || geo.ASOrg != "Example Hosting" {
+		t.Errorf("unexpected originating location of %s: %+v", report.OriginatingIP, report.OriginatingGeo)
+	}
+	if report.Hops[0].Geo != nil || report.Hops[3].Geo == nil || report.Hops[3].Geo.Country != "FR" {
+		t.Errorf("unexpected hop locations: %+v %+v", report.Hops[0].Geo, report.Hops[3].Geo)
+	}
+
+	found := map[string]int{}
+	for _, a := range report.Anomalies {
+		found[a.Type] = a.Hop
+	}
+	for kind, hop := range map[string]int{
+		forensics.CountryBacktrack: 5,
+		forensics.ImpossibleTravel: 7,
+		forensics.ManyCountries:    0,
+	} {
+		if got, ok := found[kind]; !ok || got != hop {
+			t.Errorf("%s: want anomaly at hop %d, got %+v", kind, hop, report.Anomalies)
+		}
+	}
+	if !strings.Contains(resultText(res), "originating IP 203.0.113.5 (JP, AS64500)") ||
+		!strings.Contains(resultText(res), "impossible_travel: relayed from US back to JP") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	// Without databases the hops are not located.
+	var plain forensics.Report
+	newTestEnv(t, nil).call(t, "analyze_headers", map[string]any{"content": content, "skip_dns": true}, &plain)
+	if plain.OriginatingGeo != nil || len(plain.Anomalies) != 0 {
+		t.Errorf("expected no locations without databases, got %+v %+v", plain.OriginatingGeo, plain.Anomalies)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestGetConfig(t *testing.T) {
+	siteDir, defaultDir := t.TempDir(), t.TempDir()
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(siteDir, "init.pre", "loadplugin Mail::SpamAssassin::Plugin::URIDNSBL\n"+
+		"loadplugin Mail::SpamAssassin::Plugin::Hashcash # disabled below\n")
+	write(siteDir, "v320.pre", "tryplugin Mail::SpamAssassin::Plugin::DKIM\n")
+	write(defaultDir, "20_body.cf", "body __LOCAL_MONEY /\\$\\d+/\n"+
+		"body MONEY_WIRE /wire transfer/i\n"+
+		"meta MONEY_META __LOCAL_MONEY && MONEY_WIRE\n"+
+		"score MONEY_WIRE 1.5\n"+
+		"trusted_networks 10.0.0.0/8\n")
+	write(siteDir, "local.cf", "required_score 6.0\n"+
+		"use_bayes 0\n"+
+		"bayes_auto_learn 1\n"+
+		"clear_trusted_networks\n"+
+		"trusted_networks 192.168.0.0/16 172.16.0.0/12\n"+
+		"internal_networks 192.168.1.0/24\n"+
+		"body MONEY_WIRE /wire money/i\n"+
+		"header LOCAL_SUBJ Subject =~ /urgent/i\n")
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.RulesDirs = []string{siteDir, defaultDir}
+		cfg.SpamAssassin.Binary = fakeSpamAssassin(t, `echo "SpamAssassin version 4.0.1"; echo "  running on Perl version 5.36.0"`)
+	})
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 0.1, Threshold: 6})
+
+	var info spamassassin.ConfigInfo
+	res := env.call(t, "get_config", map[string]any{}, &info)
+	if res.IsError {
+		t.Fatalf("get_config failed: %s", resultText(res))
+	}
+	if info.Version != "4.0.1" || !info.SpamdReachable || info.RequiredScore == nil || *info.RequiredScore != 6 {
+		t.Errorf("version %q, spamd reachable %v, required score %v", info.Version, info.SpamdReachable, info.RequiredScore)
+	}
+	// MONEY_WIRE is redefined in local.cf and counted once.
+	if info.RuleFiles != 4 || info.RuleCount != 3 || info.SubRuleCount != 1 || info.RulesByType["body"] != 2 || info.RulesByType["meta"] != 1 || info.RulesByType["header"] != 1 {
+		t.Errorf("files %d, rules %d, sub-rules %d, by type %v", info.RuleFiles, info.RuleCount, info.SubRuleCount, info.RulesByType)
+	}
+	if !slices.Equal(info.Plugins, []string{"Mail::SpamAssassin::Plugin::URIDNSBL", "Mail::SpamAssassin::Plugin::Hashcash", "Mail::SpamAssassin::Plugin::DKIM"}) {
+		t.Errorf("plugins = %v", info.Plugins)
+	}
+	if info.BayesEnabled || info.Bayes["bayes_auto_learn"] != "1" {
+		t.Errorf("bayes enabled %v, options %v", info.BayesEnabled, info.Bayes)
+	}
+	if !slices.Equal(info.TrustedNetworks, []string{"192.168.0.0/16", "172.16.0.0/12"}) || !slices.Equal(info.InternalNetworks, []string{"192.168.1.0/24"}) {
+		t.Errorf("trusted %v, internal %v", info.TrustedNetworks, info.InternalNetworks)
+	}
+	text := resultText(res)
+	if !strings.Contains(text, "SpamAssassin 4.0.1") || !strings.Contains(text, "spamd applies required_score 6.00") {
+		t.Errorf("unexpected summary: %s", text)
+	}
+
+	// An unreachable spamd is reported, not an error.
+	env.spamd.Close()
+	info = spamassassin.ConfigInfo{}
+	res = env.call(t, "get_config", map[string]any{}, &info)
+	if res.IsError || info.SpamdReachable || info.RequiredScore != nil || !strings.Contains(resultText(res), "spamd is not reachable") {
+		t.Errorf("expected spamd to be reported unreachable, got %+v: %s", info, resultText(res))
+	}
+}
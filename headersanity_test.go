@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/headersanity"
+)
+
+func TestCheckHeaderSanity(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	const clean = "Received: from mail.example.org (mail.example.org [198.51.100.7])\r\n" +
+		"\tby mx.example.com (Postfix) with ESMTPS id 4AB12;\r\n" +
+		"\tMon, 1 Jan 2024 12:00:05 +0000\r\n" +
+		"From: Alice <alice@example.org>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: =?utf-8?q?Caf=C3=A9_menu?=\r\n" +
+		"Date: Mon, 1 Jan 2024 11:59:58 +0000\r\n" +
+		"Message-ID: <20240101115958.1234@mail.example.org>\r\n" +
+		"X-Mailer: Microsoft Outlook 16.0\r\n" +
+		"Thread-Index: AQHaPIc1\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+
+	var report headersanity.Report
+	res := env.call(t, "check_header_sanity", map[string]any{"content": clean}, &report)
+	if res.IsError {
+		t.Fatalf("check_header_sanity failed: %s", resultText(res))
+	}
+	if len(report.Findings) != 0 || report.Score != 0 {
+		t.Errorf("clean headers flagged: %s", resultText(res))
+	}
+
+	// Spamware headers: two Message-IDs, one malformed, a Date days after
+	// delivery, a raw 8-bit subject, bulk mailer software and a HELO that
+	// is a bare IP, then one claiming the name of the receiving relay.
+	const spammy = "Received: from mx.example.com (dsl-203-0-113-9.isp.example [203.0.113.9])\r\n" +
+		"\tby mx.example.com (Postfix) with SMTP id 9XY;\r\n" +
+		"\tMon, 1 Jan 2024 12:00:05 +0000\r\n" +
+		"Received: from 203.0.113.9 (dsl-203-0-113-9.isp.example [203.0.113.9])\r\n" +
+		"\tby relay.example.net (Postfix) with SMTP id 8ZZ;\r\n" +
+		"\tMon, 1 Jan 2024 12:00:01 +0000\r\n" +
+		"From: Prize Team <win@lottery.example>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Gagnez un prix \xe9norme\r\n" +
+		"Date: Thu, 4 Jan 2024 09:00:00 +0000\r\n" +
+		"Message-ID: 12345\r\n" +
+		"Message-ID: <abc@lottery.example>\r\n" +
+		"X-Mailer: Atomic Mail Sender 9.10\r\n" +
+		"\r\n" +
+		"Claim now\r\n"
+
+	res = env.call(t, "check_header_sanity", map[string]any{"content": spammy}, &report)
+	if res.IsError {
+		t.Fatalf("check_header_sanity failed: %s", resultText(res))
+	}
+	found := map[string]headersanity.Finding{}
+	for _, f := range report.Findings {
+		found[f.Type] = f
+	}
+	for kind, hop := range map[string]int{
+		headersanity.DuplicateMessageID: 0,
+		headersanity.MalformedMessageID: 0,
+		headersanity.DateInFuture:       0,
+		headersanity.UnencodedSubject:   0,
+		headersanity.SuspiciousMailer:   0,
+		headersanity.HeloBareIP:         1,
+		headersanity.HeloClaimsReceiver: 2,
+	} {
+		if f, ok := found[kind]; !ok || f.Hop != hop {
+			t.Errorf("%s: want finding at hop %d, got %+v", kind, hop, report.Findings)
+		}
+	}
+	if len(report.Findings) != 7 || report.Score != 10 ||
+		!strings.Contains(resultText(res), "date_in_future (1.5): Date is 69h0m0s after the newest Received timestamp") {
+		t.Errorf("unexpected score %.2f: %s", report.Score, resultText(res))
+	}
+
+	// Outlook mailer names without Outlook's Thread-Index header, and a
+	// HELO address literal that is not the connecting address.
+	const forged = "Received: from [192.0.2.1] (unknown [203.0.113.50])\r\n" +
+		"\tby mx.example.com (Postfix) with ESMTP id 7QQ;\r\n" +
+		"\tMon, 1 Jan 2024 12:00:05 +0000\r\n" +
+		"From: ceo@example.com\r\n" +
+		"Subject: Wire transfer\r\n" +
+		"Date: Mon, 1 Jan 2024 12:00:00 +0000\r\n" +
+		"Message-ID: <x@example.com>\r\n" +
+		"X-Mailer: Microsoft Outlook 16.0\r\n" +
+		"\r\n" +
+		"Please pay\r\n"
+	env.call(t, "check_header_sanity", map[string]any{"content": forged}, &report)
+	if len(report.Findings) != 2 || report.Findings[0].Type != headersanity.ForgedMailer ||
+		report.Findings[1].Type != headersanity.HeloLiteralMismatch || report.Score != 4 {
+		t.Errorf("unexpected findings: %+v", report.Findings)
+	}
+}
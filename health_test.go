@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/health"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	spamd := spamdtest.NewServer()
+	defer spamd.Close()
+
+	cfg := testConfig(t, spamd)
+	saClient, err := spamassassin.NewClient(cfg.SpamAssassin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := health.NewChecker(time.Minute, time.Second)
+	registerHealthChecks(checker, saClient, cfg)
+	ts := httptest.NewServer(checker.Handler())
+	defer ts.Close()
+
+	readyz := func() (int, health.Status) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var status health.Status
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, status
+	}
+
+	resp, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", resp.StatusCode)
+	}
+
+	if code, _ := readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before first probe = %d, want 503", code)
+	}
+
+	// spamd is up but no rule files are installed yet.
+	checker.Probe(context.Background())
+	code, status := readyz()
+	if code != http.StatusServiceUnavailable || !status.Checks["spamd"].OK || status.Checks["rules"].OK {
+		t.Errorf("/readyz without rules = %d %+v", code, status)
+	}
+
+	rulesFile := filepath.Join(cfg.SpamAssassin.RulesDirs[0], "local.cf")
+	if err := os.WriteFile(rulesFile, []byte("required_score 5.0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checker.Probe(context.Background())
+	if code, status := readyz(); code != http.StatusOK || !status.Ready {
+		t.Errorf("/readyz with spamd and rules = %d %+v", code, status)
+	}
+
+	spamd.Close()
+	checker.Probe(context.Background())
+	code, status = readyz()
+	if code != http.StatusServiceUnavailable || status.Checks["spamd"].OK || status.Checks["spamd"].Error == "" {
+		t.Errorf("/readyz with spamd down = %d %+v", code, status)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanHistory(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{
+			Driver: "sqlite",
+			DSN:    filepath.Join(t.TempDir(), "history.db"),
+		}
+	})
+
+	other := strings.Replace(testEmail, "alice@example.com", "Mallory@Spam.example", 1)
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 1.0})
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 9.5,
+		Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 9.5, Description: "Contains an URL listed in the URIBL blacklist"}},
+	})
+	env.call(t, "scan_email", map[string]any{"content": other, "verbose": true}, nil)
+	env.call(t, "scan_email", map[string]any{"content": other, "verbose": true}, nil)
+
+	parsed, err := model.Parse(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var byContent handlers.MessageHistoryResult
+	if res := env.call(t, "get_message_history", map[string]any{"content": other}, &byContent); res.IsError {
+		t.Fatalf("get_message_history failed: %s", resultText(res))
+	}
+	if byContent.Hash != parsed.SHA256 || byContent.Scans != 2 || byContent.Spam != 2 {
+		t.Errorf("unexpected history by content: %+v", byContent)
+	}
+	if e := byContent.Entries[0]; e.Sender != "mallory@spam.example" || len(e.Rules) != 1 || e.Rules[0] != "URIBL_BLACK" || e.Score != 9.5 {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	var bySender handlers.MessageHistoryResult
+	env.call(t, "get_message_history", map[string]any{"sender": "alice@example.com"}, &bySender)
+	if bySender.Scans != 1 || bySender.Spam != 0 || bySender.Entries[0].IsSpam {
+		t.Errorf("unexpected history by sender: %+v", bySender)
+	}
+
+	if res := env.call(t, "get_message_history", map[string]any{}, nil); !res.IsError {
+		t.Error("lookup without hash, content or sender accepted")
+	}
+
+	var page listquery.Page[*history.Entry]
+	env.call(t, "query_history", map[string]any{
+		"filter": map[string]string{"verdict": "spam", "sender": "MALLORY@spam.example"},
+		"limit":  1,
+	}, &page)
+	if page.Total != 2 || len(page.Items) != 1 || page.NextCursor == "" {
+		t.Errorf("unexpected page: total=%d items=%d cursor=%q", page.Total, len(page.Items), page.NextCursor)
+	}
+	env.call(t, "query_history", map[string]any{"filter": map[string]string{"verdict": "ham"}}, &page)
+	if page.Total != 1 || page.Items[0].Sender != "alice@example.com" {
+		t.Errorf("unexpected ham page: %+v", page)
+	}
+	if res := env.call(t, "query_history", map[string]any{"filter": map[string]string{"scanned_at_from": "yesterday"}}, nil); !res.IsError {
+		t.Error("invalid time filter accepted")
+	}
+
+	// Without a DSN the history tools report that history is disabled.
+	disabled := newTestEnv(t, nil)
+	if res := disabled.call(t, "query_history", map[string]any{}, nil); !res.IsError || !strings.Contains(resultText(res), "history.dsn") {
+		t.Errorf("expected disabled error, got %s", resultText(res))
+	}
+}
+
+func TestQueryHistoryPaging(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "history.db")
+	store, err := history.Open(config.HistoryConfig{Driver: "sqlite", DSN: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for i := range 12 {
+		e := &history.Entry{
+			Hash:      fmt.Sprintf("%064d", i),
+			Score:     float64(i % 4),
+			IsSpam:    i%4 == 3,
+			Profile:   []string{"strict", "lenient"}[i%2],
+			Complaint: i == 11,
+			ScannedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		if err := store.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: dsn}
+	})
+
+	// Paging by score visits every entry once, ties in ID order
+	var hashes []string
+	query := map[string]any{"sort": "-score", "limit": 5}
+	for pages := 0; ; pages++ {
+		var page listquery.Page[*history.Entry]
+		if res := env.call(t, "query_history", query, &page); res.IsError || page.Total != 12 || pages > 3 {
+			t.Fatalf("query_history failed: %s", resultText(res))
+		}
+		for _, e := range page.Items {
+			hashes = append(hashes, strings.TrimLeft(e.Hash, "0"))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query["cursor"] = page.NextCursor
+	}
+	if got := strings.Join(hashes, ","); got != "3,7,11,2,6,10,1,5,9,,4,8" {
+		t.Errorf("paged hashes %s", got)
+	}
+
+	for _, tc := range []struct {
+		filter map[string]string
+		total  int
+	}{
+		{map[string]string{"profile": "STRICT"}, 6},
+		{map[string]string{"verdict": "spam", "profile": "lenient"}, 3},
+		{map[string]string{"verdict": "spam,ham"}, 12},
+		{map[string]string{"complaint": "true"}, 1},
+		{map[string]string{"score": "3"}, -1},
+		{map[string]string{"verdict": "unknown"}, -1},
+	} {
+		var page listquery.Page[*history.Entry]
+		res := env.call(t, "query_history", map[string]any{"filter": tc.filter}, &page)
+		if tc.total < 0 {
+			if !res.IsError {
+				t.Errorf("%v: invalid filter accepted", tc.filter)
+			}
+		} else if res.IsError || page.Total != tc.total {
+			t.Errorf("%v: %d matches, want %d: %s", tc.filter, page.Total, tc.total, resultText(res))
+		}
+	}
+}
+
+func TestScanHistoryRetention(t *testing.T) {
+	store, err := history.Open(config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, age := range []time.Duration{48 * time.Hour, time.Hour} {
+		if err := store.Record(ctx, &history.Entry{Hash: "abc", ScannedAt: now.Add(-age)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := store.Prune(ctx, now.Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("pruned %d entries (%v), want 1", n, err)
+	}
+	entries, err := store.Find(ctx, history.Criteria{Hashes: []string{"ABC"}})
+	if err != nil || len(entries) != 1 || entries[0].Rules == nil {
+		t.Errorf("unexpected entries after prune: %+v (%v)", entries, err)
+	}
+}
+
+func TestSpamTrends(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+	})
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 1.0})
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+
+	var report history.TrendReport
+	if res := env.call(t, "get_trends", map[string]any{}, &report); res.IsError {
+		t.Fatalf("get_trends failed: %s", resultText(res))
+	}
+	if report.Window != "day" || report.Scans != 1 || len(report.Buckets) != 24 {
+		t.Errorf("unexpected default report: %+v", report)
+	}
+	if res := env.call(t, "get_trends", map[string]any{"window": "month"}, nil); !res.IsError {
+		t.Error("unknown window accepted")
+	}
+
+	store, err := history.Open(config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "trends.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+	for _, e := range []*history.Entry{
+		// The previous day: BAYES_99 on every scan, URIBL_BLACK on one.
+		{Hash: "p1", Score: 6, IsSpam: true, Rules: []string{"BAYES_99", "URIBL_BLACK"}, ScannedAt: at("2025-01-14T05:00:00Z")},
+		{Hash: "p2", Score: 6, IsSpam: true, Rules: []string{"BAYES_99"}, ScannedAt: at("2025-01-14T05:00:00Z")},
+		{Hash: "p3", Score: 6, IsSpam: true, Rules: []string{"BAYES_99"}, ScannedAt: at("2025-01-14T05:00:00Z")},
+		{Hash: "p4", Score: 6, IsSpam: true, Rules: []string{"BAYES_99"}, ScannedAt: at("2025-01-14T05:00:00Z")},
+		// The last day: a campaign hitting NEW_RULE and URIBL_BLACK.
+		{Hash: "c1", Score: 10, IsSpam: true, Rules: []string{"NEW_RULE", "URIBL_BLACK"}, ScannedAt: at("2025-01-15T09:10:00Z")},
+		{Hash: "c2", Score: 6, IsSpam: true, Rules: []string{"NEW_RULE", "URIBL_BLACK"}, ScannedAt: at("2025-01-15T09:50:00Z")},
+		{Hash: "c3", Score: 1, Rules: []string{"BAYES_99"}, ScannedAt: at("2025-01-15T10:20:00Z")},
+		// After the current bucket; ignored.
+		{Hash: "f1", Score: 1, ScannedAt: at("2025-01-15T11:00:00Z")},
+	} {
+		if err := store.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trends, err := history.Trends(ctx, store, "day", at("2025-01-15T10:30:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !trends.From.Equal(at("2025-01-14T11:00:00Z")) || !trends.To.Equal(at("2025-01-15T11:00:00Z")) {
+		t.Errorf("window = %s..%s", trends.From, trends.To)
+	}
+	if trends.Scans != 3 || trends.Spam != 2 || trends.PreviousScans != 4 || trends.PreviousSpam != 4 {
+		t.Errorf("unexpected totals: %+v", trends)
+	}
+	if b := trends.Buckets[22]; b.Scans != 2 || b.Spam != 2 || b.AverageScore != 8 {
+		t.Errorf("unexpected 09:00 bucket: %+v", b)
+	}
+	if b := trends.Buckets[23]; b.Scans != 1 || b.Spam != 0 || b.AverageScore != 1 {
+		t.Errorf("unexpected 10:00 bucket: %+v", b)
+	}
+	rules := trends.EmergingRules
+	if len(rules) != 2 || rules[0].Rule != "NEW_RULE" || !rules[0].New || rules[1].Rule != "URIBL_BLACK" || rules[1].PreviousHits != 1 || rules[1].New {
+		t.Errorf("unexpected emerging rules: %+v", rules)
+	}
+}
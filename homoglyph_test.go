@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/homoglyph"
+)
+
+func TestDetectHomoglyphs(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Homoglyph.ProtectedBrands = []config.ProtectedBrand{
+			{Name: "PayPal", Domains: []string{"paypal.com"}},
+			{Name: "Microsoft", Domains: []string{"microsoft.com"}},
+		}
+	})
+
+	if got := homoglyph.Skeleton("Ρаураl"); got != "paypal" {
+		t.Errorf("skeleton of a Greek and Cyrillic PayPal: got %q", got)
+	}
+	if got := homoglyph.Skeleton("rnicrosoft.corn"); got != "microsoft.com" {
+		t.Errorf("skeleton of rn look-alikes: got %q", got)
+	}
+
+	// The sender name and domain spell PayPal with Cyrillic letters, the
+	// Reply-To is an ASCII look-alike, the subject hides a zero-width
+	// space, and the link leads to an all-Cyrillic IDN.
+	const spoofed = "From: \"Pаypal Support\" <service@xn--pypal-4ve.com>\r\n" +
+		"Reply-To: billing@rnicrosoft.com\r\n" +
+		"To: victim@example.com\r\n" +
+		"Subject: =?utf-8?q?Your_Pay=E2=80=8BPal_account?=\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"\r\n" +
+		"<a href=\"https://www.xn--80ak6aa92e.com/login\">Sign in</a> or visit <a href=\"https://www.paypal.com/\">PayPal</a>\r\n"
+
+	var report homoglyph.Report
+	res := env.call(t, "detect_homoglyphs", map[string]any{"content": spoofed}, &report)
+	if res.IsError {
+		t.Fatalf("detect_homoglyphs failed: %s", resultText(res))
+	}
+	found := map[string]homoglyph.Finding{}
+	for _, f := range report.Findings {
+		found[f.Type+" "+f.Location] = f
+	}
+	for key, check := range map[string]func(homoglyph.Finding) bool{
+		"brand_homograph from_name": func(f homoglyph.Finding) bool { return f.Brand == "PayPal" },
+		"mixed_script from_name": func(f homoglyph.Finding) bool {
+			return f.Value == "Pаypal" && strings.Join(f.Scripts, ",") == "Cyrillic,Latin"
+		},
+		"mixed_script from_domain":         func(f homoglyph.Finding) bool { return f.ASCII == "xn--pypal-4ve.com" },
+		"idn_homograph from_domain":        func(f homoglyph.Finding) bool { return f.Imitates == "paypal.com" && f.Skeleton == "paypal.com" },
+		"lookalike_domain reply_to_domain": func(f homoglyph.Finding) bool { return f.Brand == "Microsoft" && f.Imitates == "microsoft.com" },
+		"invisible_characters subject":     func(f homoglyph.Finding) bool { return f.Skeleton == "your paypal account" },
+		"brand_homograph subject":          func(f homoglyph.Finding) bool { return f.Brand == "PayPal" },
+		"whole_script_confusable url": func(f homoglyph.Finding) bool {
+			return f.Value == "www.аррӏе.com" && f.Skeleton == "www.apple.com"
+		},
+	} {
+		if f, ok := found[key]; !ok || !check(f) {
+			t.Errorf("%s: missing or unexpected finding %+v", key, f)
+		}
+	}
+	if _, ok := found["mixed_script url"]; ok {
+		t.Errorf("the genuine paypal.com link was flagged: %+v", report.Findings)
+	}
+	if report.Brands != 2 || report.HighRisk < 5 || !strings.Contains(resultText(res), "idn_homograph [high] from_domain \"pаypal.com\" reads as \"paypal.com\"") {
+		t.Errorf("unexpected summary %d/%d: %s", report.Brands, report.HighRisk, resultText(res))
+	}
+
+	// Legitimate mail from the brand, and non-Latin text that is not
+	// mixed within a word, is not flagged.
+	const clean = "From: \"PayPal\" <service@paypal.com>\r\n" +
+		"To: victim@example.com\r\n" +
+		"Subject: =?utf-8?q?=D0=9F=D1=80=D0=B8=D0=B2=D0=B5=D1=82_Tokyo_=E6=9D=B1=E4=BA=AC=E3=82=BF=E3=83=AF=E3=83=BC?=\r\n" +
+		"\r\n" +
+		"See https://www.paypal.com/activity\r\n"
+	res = env.call(t, "detect_homoglyphs", map[string]any{"content": clean}, &report)
+	if res.IsError || len(report.Findings) != 0 {
+		t.Errorf("clean message flagged: %s", resultText(res))
+	}
+}
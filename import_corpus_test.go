@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func corpusMessage(n string) string {
+	return "From: Sender " + n + " <sender" + n + "@example.com>\r\n" +
+		"To: bob@example.org\r\n" +
+		"Subject: Offer " + n + "\r\n" +
+		"\r\n" +
+		"Limited offer number " + n + ".\r\n"
+}
+
+func TestImportCorpus(t *testing.T) {
+	root := t.TempDir()
+	corpora := filepath.Join(root, "corpora")
+	maildir := filepath.Join(corpora, "spam")
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(maildir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"cur/1:2,S":    corpusMessage("1"),
+		"cur/2:2,S":    corpusMessage("2"),
+		"new/3":        corpusMessage("3"),
+		"new/4":        corpusMessage("1"),
+		"tmp/5":        corpusMessage("5"),
+		"cur/.hidden":  corpusMessage("6"),
+		"cur/7:2,S":    "",
+		"dovecot-uids": "not a message",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(maildir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := filepath.Join(root, "outside.mbox")
+	if err := os.WriteFile(outside, []byte("From a@b Mon Jan  1 00:00:00 2025\n"+corpusMessage("9")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(corpora, "link.mbox")); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.AllowedUsers = []string{"trainer"}
+		cfg.Bayes.ImportDirs = []string{corpora}
+	})
+	env.spamd.SetResponse("TELL", spamdtest.Response{Headers: map[string]string{"DidSet": "local"}})
+
+	// A dry run validates the corpus without training.
+	var dry handlers.ImportCorpusResult
+	res := env.call(t, "import_corpus", map[string]any{"path": maildir, "label": "spam", "dry_run": true}, &dry)
+	if res.IsError {
+		t.Fatalf("import_corpus failed: %s", resultText(res))
+	}
+	if dry.Format != "maildir" || dry.Messages != 5 || dry.Duplicates != 1 || dry.Invalid != 1 || dry.WouldLearn != 3 ||
+		dry.Learned != 0 || len(dry.Skipped) != 1 || dry.Skipped[0].Name != "cur/7:2,S" {
+		t.Errorf("unexpected dry run: %+v", dry)
+	}
+	if !strings.Contains(resultText(res), "3 of 5 messages") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+	for _, req := range env.spamd.Requests() {
+		if req.Command == "TELL" {
+			t.Fatal("TELL sent for a dry run")
+		}
+	}
+
+	var result handlers.ImportCorpusResult
+	env.call(t, "import_corpus", map[string]any{"path": maildir, "label": "spam", "batch_size": 2, "user": "trainer"}, &result)
+	if result.Learned != 3 || result.AlreadyLearned != 0 || result.Failed != 0 || result.Batches != 2 {
+		t.Errorf("unexpected import: %+v", result)
+	}
+	tells := 0
+	for _, req := range env.spamd.Requests() {
+		if req.Command == "TELL" {
+			tells++
+			if req.Headers.Get("Message-class") != "spam" || req.Headers.Get("User") != "trainer" {
+				t.Errorf("unexpected TELL request: %+v", req.Headers)
+			}
+		}
+	}
+	if tells != 3 {
+		t.Errorf("sent %d TELL requests, want 3", tells)
+	}
+
+	// spamd reports no DidSet for messages it learned before.
+	env.spamd.SetResponse("TELL", spamdtest.Response{})
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, name := range []string{"ham/a.eml", "ham/b.eml"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(corpusMessage(name)))
+	}
+	zw.Close()
+	var upload handlers.ImportCorpusResult
+	env.call(t, "import_corpus", map[string]any{"archive": base64.StdEncoding.EncodeToString(zipped.Bytes()), "label": "ham"}, &upload)
+	if upload.Source != "archive" || upload.Format != "zip" || upload.Messages != 2 || upload.AlreadyLearned != 2 || upload.Learned != 0 {
+		t.Errorf("unexpected archive import: %+v", upload)
+	}
+
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"path": outside, "label": "spam"}, "outside bayes.import_dirs"},
+		{map[string]any{"path": filepath.Join(corpora, "link.mbox"), "label": "spam"}, "outside bayes.import_dirs"},
+		{map[string]any{"path": "corpora/spam", "label": "spam"}, "must be absolute"},
+		{map[string]any{"path": maildir, "label": "phish"}, "label must be ham or spam"},
+		{map[string]any{"path": maildir, "label": "spam", "user": "root"}, "not allowed"},
+		{map[string]any{"label": "spam"}, "exactly one of path and archive"},
+	} {
+		if res := env.call(t, "import_corpus", tc.args, nil); !res.IsError || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("%v: expected %q, got %s", tc.args, tc.want, resultText(res))
+		}
+	}
+}
+
+func TestImportCorpusConfigValidation(t *testing.T) {
+	yaml := "bayes:\n  import_dirs: [\"corpora\"]\n  import_max_messages: 0\n  import_max_size: -1\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`bayes.import_dirs: must be absolute paths, got "corpora"`,
+		"bayes.import_max_messages: must be positive, got 0",
+		"bayes.import_max_size: must be positive, got -1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/model"
+)
+
+func TestInputFormatDetection(t *testing.T) {
+	env := newTestEnv(t, nil)
+	unix := strings.ReplaceAll(testEmail, "\r\n", "\n")
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    model.Input
+	}{
+		{"crlf", testEmail, model.Input{Format: model.FormatRFC822, LineEndings: model.LineEndingsCRLF}},
+		{"unix newlines", unix, model.Input{Format: model.FormatRFC822, LineEndings: model.LineEndingsLF, Normalized: true}},
+		{"eml export", "\uFEFFFrom alice@example.com Mon Jan  2 15:04:05 2006\n" + unix,
+			model.Input{Format: model.FormatRFC822, LineEndings: model.LineEndingsLF, Envelope: true, BOM: true, Normalized: true}},
+		{"mixed", strings.Replace(testEmail, "\r\n", "\n", 2), model.Input{Format: model.FormatRFC822, LineEndings: model.LineEndingsMixed, Normalized: true}},
+		{"base64", wrap(base64.StdEncoding.EncodeToString([]byte(testEmail)), 76), model.Input{Format: model.FormatBase64, LineEndings: model.LineEndingsCRLF, Normalized: true}},
+		{"base64 unix", base64.StdEncoding.EncodeToString([]byte(unix)), model.Input{Format: model.FormatBase64, LineEndings: model.LineEndingsLF, Normalized: true}},
+	} {
+		env.spamd.ClearRequests()
+		var out handlers.ScanEmailResult
+		res := env.call(t, "scan_email", map[string]any{"content": tc.content}, &out)
+		if res.IsError {
+			t.Errorf("%s: scan failed: %s", tc.name, resultText(res))
+			continue
+		}
+		if out.Input == nil || *out.Input != tc.want {
+			t.Errorf("%s: detected %+v, want %+v", tc.name, out.Input, tc.want)
+		}
+		if tc.want.Normalized != strings.Contains(resultText(res), "normalized") {
+			t.Errorf("%s: unexpected text result: %s", tc.name, resultText(res))
+		}
+		requests := env.spamd.Requests()
+		if len(requests) != 1 || string(requests[0].Body) != testEmail {
+			t.Errorf("%s: spamd did not receive the canonical CRLF message", tc.name)
+		}
+	}
+
+	var parsed model.ParsedEmail
+	env.call(t, "parse_email", map[string]any{"content": base64.StdEncoding.EncodeToString([]byte(unix))}, &parsed)
+	if parsed.Subject != "Quarterly report" || parsed.Input == nil || parsed.Input.Format != model.FormatBase64 {
+		t.Errorf("parse_email did not decode the base64 submission: %+v", parsed)
+	}
+
+	// Text without a header is neither decoded nor accepted.
+	if res := env.call(t, "scan_email", map[string]any{"content": "SGVsbG8gd29ybGQ="}, nil); !res.IsError {
+		t.Error("base64 text that is not a message was accepted")
+	}
+}
+
+func wrap(s string, width int) string {
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width] + "\r\n")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
@@ -0,0 +1,230 @@
+// Package abuseipdb looks up IP addresses in the AbuseIPDB blacklist with
+// its v2 check endpoint.
+//
+// Lookups count against the daily quota of the API key, so reports are
+// cached for a configured time and a rate limit response stops further
+// requests until the time AbuseIPDB says to retry after. Addresses that
+// are not publicly routable are never looked up.
+//
+// Security considerations:
+//   - The API key is sent only to the configured endpoint; redirects are
+//     not followed
+//   - Response bodies are bounded
+package abuseipdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// maxResponseSize bounds the responses read from AbuseIPDB.
+const maxResponseSize = 64 << 10
+
+// ErrNotPublic is returned for addresses AbuseIPDB holds no reports on,
+// such as private and loopback addresses.
+var ErrNotPublic = errors.New("not a public IP address")
+
+// Report is what AbuseIPDB knows about an address. Cached is set when the
+// report was served from the cache rather than looked up.
+type Report struct {
+	IP                   string     `json:"ipAddress"`
+	AbuseConfidenceScore int        `json:"abuseConfidenceScore"`
+	TotalReports         int        `json:"totalReports"`
+	NumDistinctUsers     int        `json:"numDistinctUsers"`
+	LastReportedAt       *time.Time `json:"lastReportedAt"`
+	ISP                  string     `json:"isp"`
+	UsageType            string     `json:"usageType"`
+	Domain               string     `json:"domain"`
+	CountryCode          string     `json:"countryCode"`
+	IsWhitelisted        bool       `json:"isWhitelisted"`
+	IsTor                bool       `json:"isTor"`
+	Cached               bool       `json:"-"`
+}
+
+type entry struct {
+	report  Report
+	expires time.Time
+}
+
+// Client looks up addresses on AbuseIPDB and caches the reports.
+type Client struct {
+	endpoint  string
+	apiKey    string
+	maxAge    int
+	cacheTTL  time.Duration
+	cacheSize int
+	http      *http.Client
+
+	mu          sync.Mutex
+	cache       map[string]entry
+	backoffTill time.Time
+}
+
+// New returns a client for cfg, or nil when no API key is configured.
+func New(cfg config.AbuseIPDBConfig) *Client {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	return &Client{
+		endpoint:  strings.TrimSuffix(cfg.URL, "/") + "/check",
+		apiKey:    cfg.APIKey,
+		maxAge:    cfg.MaxAgeDays,
+		cacheTTL:  cfg.CacheTTL,
+		cacheSize: cfg.CacheSize,
+		cache:     make(map[string]entry),
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect could carry the API key elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Check returns the report on ip, from the cache when a lookup is recent
+// enough.
+func (c *Client) Check(ctx context.Context, ip string) (*Report, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return nil, ErrNotPublic
+	}
+	key := addr.String()
+
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.cache[key]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		report := e.report
+		report.Cached = true
+		return &report, nil
+	}
+	if now.Before(c.backoffTill) {
+		until := c.backoffTill
+		c.mu.Unlock()
+		return nil, fmt.Errorf("AbuseIPDB rate limit reached, retrying after %s", until.Format(time.RFC3339))
+	}
+	c.mu.Unlock()
+
+	report, err := c.lookup(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= c.cacheSize {
+		c.evict(now)
+	}
+	c.cache[key] = entry{report: *report, expires: now.Add(c.cacheTTL)}
+	return report, nil
+}
+
+// Prune drops the expired reports from the cache and returns how many were
+// dropped.
+func (c *Client) Prune(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			n++
+		}
+	}
+	return n
+}
+
+// evict makes room in the cache by dropping expired reports, or the one
+// expiring first when none has.
+func (c *Client) evict(now time.Time) {
+	var oldest string
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.cache[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.cache) >= c.cacheSize {
+		delete(c.cache, oldest)
+	}
+}
+
+func (c *Client) lookup(ctx context.Context, ip string) (*Report, error) {
+	query := url.Values{"ipAddress": {ip}, "maxAgeInDays": {strconv.Itoa(c.maxAge)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Key", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("AbuseIPDB request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AbuseIPDB response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry := time.Hour
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retry = time.Duration(seconds) * time.Second
+		}
+		c.mu.Lock()
+		c.backoffTill = time.Now().Add(retry)
+		c.mu.Unlock()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp.Status, content)
+	}
+
+	var body struct {
+		Data *Report `json:"data"`
+	}
+	if err := json.Unmarshal(content, &body); err != nil || body.Data == nil {
+		return nil, fmt.Errorf("invalid AbuseIPDB response")
+	}
+	return body.Data, nil
+}
+
+// responseError turns an AbuseIPDB error response into an error with its
+// details.
+func responseError(status string, content []byte) error {
+	var body struct {
+		Errors []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(content, &body)
+	var details []string
+	for _, e := range body.Errors {
+		if e.Detail != "" {
+			details = append(details, e.Detail)
+		}
+	}
+	if len(details) == 0 {
+		return fmt.Errorf("AbuseIPDB error: %s", status)
+	}
+	return fmt.Errorf("AbuseIPDB error %s: %s", status, strings.Join(details, "; "))
+}
@@ -0,0 +1,166 @@
+// Package arf builds Abuse Reporting Format reports (RFC 5965) about
+// received messages.
+//
+// Reports are only generated; sending them to the abuse desk of the
+// offending network is left to the operator.
+package arf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FeedbackTypes are the feedback types a report may have: those of RFC 5965
+// and not-spam from RFC 6430.
+var FeedbackTypes = []string{"abuse", "fraud", "virus", "other", "not-spam"}
+
+// Report is an abuse report about one message. FeedbackType, UserAgent and
+// Message are required; the other feedback fields are left out when empty.
+type Report struct {
+	// From, To and Subject are the header fields of the report itself.
+	From    string
+	To      string
+	Subject string
+	Date    time.Time
+
+	// Description is the human-readable part.
+	Description string
+
+	FeedbackType          string
+	UserAgent             string
+	ReportingMTA          string
+	SourceIP              string
+	OriginalMailFrom      string
+	ArrivalDate           *time.Time
+	ReportedDomain        string
+	AuthenticationResults []string
+
+	// Message is the reported message. With HeadersOnly only its header
+	// section is included, as text/rfc822-headers.
+	Message     []byte
+	HeadersOnly bool
+}
+
+// Bytes renders the report as a multipart/report message with CRLF line
+// endings. Field values containing line breaks are rejected, so caller
+// input cannot add header fields.
+func (r *Report) Bytes() ([]byte, error) {
+	if !slices.Contains(FeedbackTypes, r.FeedbackType) {
+		return nil, fmt.Errorf("feedback type must be one of %s, got %q", strings.Join(FeedbackTypes, ", "), r.FeedbackType)
+	}
+	if r.UserAgent == "" {
+		return nil, fmt.Errorf("user agent is required")
+	}
+	if r.SourceIP != "" && net.ParseIP(r.SourceIP) == nil {
+		return nil, fmt.Errorf("invalid source IP %q", r.SourceIP)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"from", r.From},
+		{"to", r.To},
+		{"subject", r.Subject},
+		{"reporting MTA", r.ReportingMTA},
+		{"original mail from", r.OriginalMailFrom},
+		{"reported domain", r.ReportedDomain},
+	} {
+		if strings.ContainsAny(field.value, "\r\n") {
+			return nil, fmt.Errorf("%s must not contain line breaks", field.name)
+		}
+	}
+
+	var boundary [12]byte
+	if _, err := rand.Read(boundary[:]); err != nil {
+		return nil, err
+	}
+	b := "arf-" + hex.EncodeToString(boundary[:])
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+	date := r.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header("From", r.From)
+	header("To", r.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", r.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", fmt.Sprintf("multipart/report; report-type=feedback-report;\r\n\tboundary=%q", b))
+	buf.WriteString("\r\nThis is a multi-part message in MIME format.\r\n")
+
+	// Human-readable part
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", b)
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", encoding([]byte(r.Description)))
+	buf.WriteString("\r\n")
+	buf.Write(crlf([]byte(strings.TrimRight(r.Description, "\r\n") + "\n")))
+
+	// Machine-readable part
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", b)
+	header("Content-Type", "message/feedback-report")
+	buf.WriteString("\r\n")
+	header("Feedback-Type", r.FeedbackType)
+	header("User-Agent", r.UserAgent)
+	header("Version", "1")
+	if r.OriginalMailFrom != "" {
+		header("Original-Mail-From", "<"+strings.Trim(r.OriginalMailFrom, "<>")+">")
+	}
+	if r.ArrivalDate != nil {
+		header("Arrival-Date", r.ArrivalDate.Format(time.RFC1123Z))
+	}
+	if r.ReportingMTA != "" {
+		header("Reporting-MTA", "dns; "+r.ReportingMTA)
+	}
+	header("Source-IP", r.SourceIP)
+	for _, ar := range r.AuthenticationResults {
+		header("Authentication-Results", strings.Join(strings.Fields(ar), " "))
+	}
+	header("Reported-Domain", r.ReportedDomain)
+
+	// The reported message
+	message := crlf(r.Message)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", b)
+	if r.HeadersOnly {
+		if i := bytes.Index(message, []byte("\r\n\r\n")); i >= 0 {
+			message = message[:i+2]
+		}
+		header("Content-Type", "text/rfc822-headers")
+	} else {
+		header("Content-Type", "message/rfc822")
+		header("Content-Disposition", "inline")
+	}
+	header("Content-Transfer-Encoding", encoding(message))
+	buf.WriteString("\r\n")
+	buf.Write(message)
+	if !bytes.HasSuffix(message, []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", b)
+	return buf.Bytes(), nil
+}
+
+// crlf converts bare LF line endings to CRLF.
+func crlf(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// encoding is the transfer encoding declaring whether data is plain ASCII.
+func encoding(data []byte) string {
+	for _, c := range data {
+		if c >= 0x80 {
+			return "8bit"
+		}
+	}
+	return "7bit"
+}
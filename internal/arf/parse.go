@@ -0,0 +1,145 @@
+package arf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxParts bounds the MIME parts read from a report.
+const maxParts = 10
+
+// ErrNotARF is returned by Parse for messages that are not feedback reports.
+var ErrNotARF = errors.New("not an ARF report: expected multipart/report with report-type=feedback-report")
+
+// Feedback is a parsed feedback-loop complaint. FeedbackType defaults to
+// "abuse" when the report has no machine-readable part, as some providers
+// send; Message is the returned message, or only its header section when
+// HeadersOnly is set.
+type Feedback struct {
+	Reporter         string     `json:"reporter,omitempty"`
+	FeedbackType     string     `json:"feedback_type"`
+	UserAgent        string     `json:"user_agent,omitempty"`
+	SourceIP         string     `json:"source_ip,omitempty"`
+	OriginalMailFrom string     `json:"original_mail_from,omitempty"`
+	OriginalRcptTo   []string   `json:"original_rcpt_to,omitempty"`
+	ArrivalDate      *time.Time `json:"arrival_date,omitempty"`
+	ReportingMTA     string     `json:"reporting_mta,omitempty"`
+	ReportedDomains  []string   `json:"reported_domains,omitempty"`
+	Incidents        int        `json:"incidents,omitempty"`
+	HeadersOnly      bool       `json:"headers_only,omitempty"`
+	Message          []byte     `json:"-"`
+}
+
+// Parse reads an ARF report (RFC 5965) and returns its feedback fields and
+// the message it complains about.
+func Parse(data []byte) (*Feedback, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["boundary"] == "" ||
+		!strings.EqualFold(params["report-type"], "feedback-report") {
+		return nil, ErrNotARF
+	}
+
+	fb := &Feedback{}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		fb.Reporter = from.Address
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+		if i == maxParts {
+			return nil, fmt.Errorf("invalid report: more than %d parts", maxParts)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		body, err := io.ReadAll(decode(part, part.Header.Get("Content-Transfer-Encoding")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid report: %w", err)
+		}
+		switch partType {
+		case "message/feedback-report":
+			if err := fb.parseFields(body); err != nil {
+				return nil, err
+			}
+		case "message/rfc822", "text/rfc822-headers":
+			if fb.Message == nil {
+				fb.Message = body
+				fb.HeadersOnly = partType == "text/rfc822-headers"
+			}
+		}
+	}
+	if fb.Message == nil {
+		return nil, fmt.Errorf("invalid report: no message/rfc822 or text/rfc822-headers part")
+	}
+	if fb.FeedbackType == "" {
+		fb.FeedbackType = "abuse"
+	}
+	return fb, nil
+}
+
+// parseFields reads the fields of the machine-readable part, which are
+// formatted like a header section.
+func (fb *Feedback) parseFields(body []byte) error {
+	fields, err := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(body), strings.NewReader("\r\n\r\n")))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("invalid feedback report: %w", err)
+	}
+	fb.FeedbackType = strings.ToLower(strings.TrimSpace(fields.Get("Feedback-Type")))
+	fb.UserAgent = fields.Get("User-Agent")
+	if ip := net.ParseIP(strings.TrimSpace(fields.Get("Source-IP"))); ip != nil {
+		fb.SourceIP = ip.String()
+	}
+	fb.OriginalMailFrom = strings.Trim(strings.TrimSpace(fields.Get("Original-Mail-From")), "<>")
+	for _, rcpt := range fields.Values("Original-Rcpt-To") {
+		fb.OriginalRcptTo = append(fb.OriginalRcptTo, strings.Trim(strings.TrimSpace(rcpt), "<>"))
+	}
+	if date, err := mail.ParseDate(fields.Get("Arrival-Date")); err == nil {
+		fb.ArrivalDate = &date
+	} else if date, err := mail.ParseDate(fields.Get("Received-Date")); err == nil {
+		fb.ArrivalDate = &date
+	}
+	if mta := fields.Get("Reporting-MTA"); mta != "" {
+		if _, name, ok := strings.Cut(mta, ";"); ok {
+			mta = name
+		}
+		fb.ReportingMTA = strings.TrimSpace(mta)
+	}
+	for _, domain := range fields.Values("Reported-Domain") {
+		fb.ReportedDomains = append(fb.ReportedDomains, strings.ToLower(strings.TrimSpace(domain)))
+	}
+	fb.Incidents, _ = strconv.Atoi(strings.TrimSpace(fields.Get("Incidents")))
+	return nil
+}
+
+// decode undoes the transfer encoding of a part; providers base64-encode
+// the returned message now and then.
+func decode(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
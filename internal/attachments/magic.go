@@ -0,0 +1,140 @@
+package attachments
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// Detected content types not known to net/http.
+const (
+	typeZip         = "application/zip"
+	typeOLE         = "application/x-ole-storage"
+	typePE          = "application/vnd.microsoft.portable-executable"
+	typeELF         = "application/x-executable"
+	typeMachO       = "application/x-mach-binary"
+	typeShortcut    = "application/x-ms-shortcut"
+	typeISO         = "application/x-iso9660-image"
+	typeRAR         = "application/vnd.rar"
+	type7z          = "application/x-7z-compressed"
+	typeCab         = "application/vnd.ms-cab-compressed"
+	typeRTF         = "application/rtf"
+	typeScript      = "text/x-shellscript"
+	typeDOCX        = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	typeXLSX        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	typePPTX        = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	typeJAR         = "application/java-archive"
+	typeOctetStream = "application/octet-stream"
+)
+
+// signatures maps leading bytes to content types, checked before falling
+// back to net/http's sniffing.
+var signatures = []struct {
+	magic       string
+	contentType string
+}{
+	{"MZ", typePE},
+	{"\x7fELF", typeELF},
+	{"\xfe\xed\xfa\xce", typeMachO},
+	{"\xfe\xed\xfa\xcf", typeMachO},
+	{"\xce\xfa\xed\xfe", typeMachO},
+	{"\xcf\xfa\xed\xfe", typeMachO},
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", typeOLE},
+	{"PK\x03\x04", typeZip},
+	{"PK\x05\x06", typeZip},
+	{"L\x00\x00\x00\x01\x14\x02\x00", typeShortcut},
+	{"Rar!\x1a\x07", typeRAR},
+	{"7z\xbc\xaf\x27\x1c", type7z},
+	{"MSCF", typeCab},
+	{"{\\rtf", typeRTF},
+	{"#!", typeScript},
+}
+
+// detect returns the content type of content from its leading bytes.
+func detect(content []byte) string {
+	for _, s := range signatures {
+		if bytes.HasPrefix(content, []byte(s.magic)) {
+			return s.contentType
+		}
+	}
+	// ISO 9660 volumes carry their identifier after 32 KiB of system area.
+	if len(content) > 0x8006 && string(content[0x8001:0x8006]) == "CD001" {
+		return typeISO
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	return contentType
+}
+
+// families groups content types that describe the same format, so a
+// declared type is only reported as a mismatch when the formats differ.
+var families = map[string]string{
+	"application/zip":               "zip",
+	"application/x-zip-compressed":  "zip",
+	"application/x-zip":             "zip",
+	typeJAR:                         "zip",
+	typeDOCX:                        "zip",
+	typeXLSX:                        "zip",
+	typePPTX:                        "zip",
+	"application/msword":            "ole",
+	"application/vnd.ms-excel":      "ole",
+	"application/vnd.ms-powerpoint": "ole",
+	"application/vnd.ms-outlook":    "ole",
+	"application/x-msi":             "ole",
+	typeOLE:                         "ole",
+	typePE:                          "pe",
+	"application/x-msdownload":      "pe",
+	"application/x-dosexec":         "pe",
+	"application/x-msdos-program":   "pe",
+	"image/jpeg":                    "jpeg",
+	"image/jpg":                     "jpeg",
+	"image/pjpeg":                   "jpeg",
+	"application/x-gzip":            "gzip",
+	"application/gzip":              "gzip",
+	"application/x-rar-compressed":  "rar",
+	typeRAR:                         "rar",
+	typeRTF:                         "rtf",
+	"text/rtf":                      "rtf",
+}
+
+// genericTypes make no claim about the format.
+var genericTypes = map[string]bool{
+	typeOctetStream:              true,
+	"application/binary":         true,
+	"application/unknown":        true,
+	"application/x-download":     true,
+	"application/force-download": true,
+}
+
+// family returns the format family of a content type.
+func family(contentType string) string {
+	if f, ok := families[contentType]; ok {
+		return f
+	}
+	if strings.HasPrefix(contentType, "application/vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(contentType, "application/vnd.ms-") && strings.Contains(contentType, "macroenabled") ||
+		strings.HasPrefix(contentType, "application/vnd.oasis.opendocument.") {
+		return "zip"
+	}
+	if strings.HasPrefix(contentType, "text/") {
+		return "text"
+	}
+	return contentType
+}
+
+// compatible reports whether a declared content type agrees with the
+// detected one.
+func compatible(declared, detected string) bool {
+	if genericTypes[declared] || detected == typeOctetStream {
+		return true
+	}
+	return family(declared) == family(detected)
+}
+
+// extensionFamilies are the format families expected for common document
+// and image extensions, used to catch executables disguised by name alone.
+var extensionFamilies = map[string]string{
+	"pdf": "application/pdf", "zip": "zip", "docx": "zip", "xlsx": "zip", "pptx": "zip",
+	"doc": "ole", "xls": "ole", "ppt": "ole", "rtf": "rtf",
+	"jpg": "jpeg", "jpeg": "jpeg", "png": "image/png", "gif": "image/gif",
+	"txt": "text", "csv": "text", "htm": "text", "html": "text",
+}
@@ -0,0 +1,650 @@
+package attachments
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// maxPDFDepth bounds the nesting of PDF arrays and dictionaries.
+	maxPDFDepth = 32
+
+	// maxInflated bounds the bytes decompressed from the object streams of
+	// one PDF, so a compression bomb cannot exhaust memory.
+	maxInflated = 8 << 20
+)
+
+// pdfIndicators are the names whose occurrences are counted: the active
+// content and structures malspam relies on, as counted by pdfid.
+var pdfIndicators = map[string]bool{
+	"/JS": true, "/JavaScript": true, "/AA": true, "/OpenAction": true,
+	"/Launch": true, "/EmbeddedFile": true, "/SubmitForm": true, "/ImportData": true,
+	"/AcroForm": true, "/XFA": true, "/URI": true, "/GoToR": true, "/GoToE": true,
+	"/RichMedia": true, "/JBIG2Decode": true, "/ObjStm": true, "/Encrypt": true,
+}
+
+// PDF describes the structure of a PDF attachment and the active content
+// it carries. Objects inside compressed object streams are included.
+type PDF struct {
+	Objects       int `json:"objects"`
+	Streams       int `json:"streams"`
+	ObjectStreams int `json:"object_streams"`
+
+	// Indicators counts the occurrences of the names of interest, such as
+	// /JavaScript and /OpenAction, by name.
+	Indicators map[string]int `json:"indicators"`
+
+	// EmbeddedFiles are the names of the files embedded in the document,
+	// LaunchTargets the programs and files launch actions open, with their
+	// parameters, SubmitTargets the URLs forms are submitted to and URIs the
+	// targets of link actions; up to 100 each.
+	EmbeddedFiles []string `json:"embedded_files,omitempty"`
+	LaunchTargets []string `json:"launch_targets,omitempty"`
+	SubmitTargets []string `json:"submit_targets,omitempty"`
+	URIs          []string `json:"uris,omitempty"`
+
+	// ObfuscatedNames is set when a name of interest is written with #xx
+	// escapes, which only serves to evade signature matching.
+	ObfuscatedNames bool `json:"obfuscated_names,omitempty"`
+
+	// Incomplete is set when an object stream could not be decompressed or
+	// exceeded the decompression limit.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// pdfName, pdfString, pdfDict, pdfArray and pdfRef are parsed PDF objects;
+// numbers are int64 or float64 and keywords pdfKeyword.
+type (
+	pdfName    string
+	pdfString  string
+	pdfKeyword string
+	pdfDict    map[pdfName]any
+	pdfArray   []any
+	pdfRef     int64
+)
+
+// pdfObject is an indirect object with its stream data, if any.
+type pdfObject struct {
+	value  any
+	stream []byte
+}
+
+// inspectPDF parses a PDF and reports its active content. Parsing is
+// lexical and tolerant: the cross-reference table is ignored and every
+// object found in the file is considered, as malformed documents are
+// common in malspam and readers repair them.
+func (a *Attachment) inspectPDF(content []byte) {
+	r := &PDF{Indicators: make(map[string]int)}
+	objects := make(map[int64]*pdfObject)
+	var order []*pdfObject
+	add := func(num int64, obj *pdfObject) {
+		r.Objects++
+		objects[num] = obj
+		order = append(order, obj)
+	}
+
+	parseObjects(content, r, func(num int64, obj *pdfObject) {
+		if obj.stream != nil {
+			r.Streams++
+		}
+		add(num, obj)
+	})
+
+	inflated := 0
+	for _, obj := range order {
+		d, ok := obj.value.(pdfDict)
+		if !ok || obj.stream == nil || d["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		r.ObjectStreams++
+		data, ok := inflate(d, obj.stream, maxInflated-inflated)
+		inflated += len(data)
+		if !ok {
+			r.Incomplete = true
+		}
+		parseObjectStream(d, data, r, add)
+	}
+
+	for _, obj := range order {
+		walkPDF(obj.value, 0, func(d pdfDict) { r.inspect(d, objects) })
+	}
+
+	a.PDF = r
+	if r.Indicators["/Encrypt"] > 0 {
+		a.flag(EncryptedDocument)
+	}
+	if r.Indicators["/JS"]+r.Indicators["/JavaScript"] > 0 {
+		a.flag(PDFJavaScript)
+	}
+	if r.Indicators["/Launch"] > 0 {
+		a.flag(PDFLaunch)
+	}
+	if r.Indicators["/EmbeddedFile"] > 0 || len(r.EmbeddedFiles) > 0 {
+		a.flag(PDFEmbeddedFile)
+	}
+	for _, name := range r.EmbeddedFiles {
+		if exts := extensions(name); len(exts) > 0 && executableExtensions[exts[len(exts)-1]] {
+			a.flag(ArchivedExecutable)
+		}
+	}
+	if r.Indicators["/SubmitForm"] > 0 {
+		a.flag(PDFFormSubmission)
+	}
+	if r.Indicators["/OpenAction"]+r.Indicators["/AA"] > 0 {
+		a.flag(PDFAutoAction)
+	}
+	if r.ObfuscatedNames {
+		a.flag(PDFObfuscatedNames)
+	}
+}
+
+// inspect records the actions and embedded files of a dictionary.
+func (r *PDF) inspect(d pdfDict, objects map[int64]*pdfObject) {
+	switch d["S"] {
+	case pdfName("Launch"):
+		target := fileName(resolve(d["F"], objects))
+		if win, ok := resolve(d["Win"], objects).(pdfDict); ok {
+			if f := fileName(win["F"]); f != "" {
+				target = f
+			}
+			if p, ok := win["P"].(pdfString); ok && p != "" {
+				target += " " + string(p)
+			}
+		}
+		if target != "" {
+			r.LaunchTargets = appendListed(r.LaunchTargets, target)
+		}
+	case pdfName("SubmitForm"):
+		if target := fileName(resolve(d["F"], objects)); target != "" {
+			r.SubmitTargets = appendListed(r.SubmitTargets, target)
+		}
+	case pdfName("URI"):
+		if uri, ok := resolve(d["URI"], objects).(pdfString); ok && uri != "" {
+			r.URIs = appendListed(r.URIs, string(uri))
+		}
+	}
+	if _, ok := d["EF"]; ok {
+		if name := fileName(d); name != "" {
+			r.EmbeddedFiles = appendListed(r.EmbeddedFiles, name)
+		}
+	}
+}
+
+// fileName returns the name of a file specification, which is a string or
+// a dictionary with the name in /UF or /F.
+func fileName(v any) string {
+	switch v := v.(type) {
+	case pdfString:
+		return string(v)
+	case pdfDict:
+		for _, key := range []pdfName{"UF", "F"} {
+			if s, ok := v[key].(pdfString); ok && s != "" {
+				return string(s)
+			}
+		}
+	}
+	return ""
+}
+
+// resolve returns the object a reference points to, or v itself.
+func resolve(v any, objects map[int64]*pdfObject) any {
+	if ref, ok := v.(pdfRef); ok {
+		if obj := objects[int64(ref)]; obj != nil {
+			return obj.value
+		}
+		return nil
+	}
+	return v
+}
+
+// walkPDF calls fn for every dictionary within v.
+func walkPDF(v any, depth int, fn func(pdfDict)) {
+	if depth > maxPDFDepth {
+		return
+	}
+	switch v := v.(type) {
+	case pdfDict:
+		fn(v)
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			walkPDF(v[key], depth+1, fn)
+		}
+	case pdfArray:
+		for _, child := range v {
+			walkPDF(child, depth+1, fn)
+		}
+	}
+}
+
+func appendListed(list []string, value string) []string {
+	if len(list) >= maxListedEntries {
+		return list
+	}
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// inflate decompresses the data of a stream filtered with FlateDecode
+// alone, returning at most limit bytes; ok is false when the stream could
+// not be decompressed entirely.
+func inflate(d pdfDict, data []byte, limit int) ([]byte, bool) {
+	filter := d["Filter"]
+	if arr, ok := filter.(pdfArray); ok && len(arr) == 1 {
+		filter = arr[0]
+	}
+	if filter != pdfName("FlateDecode") || limit <= 0 {
+		return nil, false
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if len(out) > limit {
+		return out[:limit], false
+	}
+	return out, err == nil
+}
+
+// parseObjects calls fn for each indirect object ("n g obj ... endobj") of
+// data.
+func parseObjects(data []byte, r *PDF, fn func(int64, *pdfObject)) {
+	p := &pdfParser{lex: &pdfLexer{data: data, report: r}}
+	var prev [2]any
+	for {
+		tok, ok := p.value(0)
+		if !ok {
+			return
+		}
+		if tok == pdfKeyword("stream") {
+			// The stream of an object not parsed, skipped unread
+			p.lex.stream(nil)
+			continue
+		}
+		if tok != pdfKeyword("obj") {
+			prev[0], prev[1] = prev[1], tok
+			continue
+		}
+		num, ok1 := prev[0].(int64)
+		_, ok2 := prev[1].(int64)
+		prev = [2]any{}
+		if !ok1 || !ok2 {
+			continue
+		}
+		obj := &pdfObject{}
+		obj.value, _ = p.value(0)
+		if d, ok := obj.value.(pdfDict); ok {
+			if next, _ := p.value(0); next == pdfKeyword("stream") {
+				obj.stream = p.lex.stream(d)
+			} else {
+				prev[1] = next
+			}
+		}
+		fn(num, obj)
+	}
+}
+
+// parseObjectStream calls fn for each object of a decompressed object
+// stream, whose header lists the object numbers and offsets relative to
+// /First.
+func parseObjectStream(d pdfDict, data []byte, r *PDF, fn func(int64, *pdfObject)) {
+	first, ok := d["First"].(int64)
+	if !ok || first < 0 || first > int64(len(data)) {
+		return
+	}
+	header := &pdfParser{lex: &pdfLexer{data: data[:first], report: &PDF{Indicators: make(map[string]int)}}}
+	var nums []int64
+	for {
+		num, ok := header.value(0)
+		if !ok {
+			break
+		}
+		if _, ok := header.value(0); !ok {
+			break
+		}
+		if n, isInt := num.(int64); isInt {
+			nums = append(nums, n)
+		}
+	}
+	body := &pdfParser{lex: &pdfLexer{data: data[first:], report: r}}
+	for _, num := range nums {
+		v, ok := body.value(0)
+		if !ok {
+			return
+		}
+		fn(num, &pdfObject{value: v})
+	}
+}
+
+// pdfParser reads PDF objects from a lexer.
+type pdfParser struct {
+	lex    *pdfLexer
+	peeked []any
+}
+
+func (p *pdfParser) token() (any, bool) {
+	if n := len(p.peeked); n > 0 {
+		tok := p.peeked[n-1]
+		p.peeked = p.peeked[:n-1]
+		return tok, true
+	}
+	return p.lex.next()
+}
+
+func (p *pdfParser) unread(tok any) {
+	p.peeked = append(p.peeked, tok)
+}
+
+// skip consumes the tokens up to the end of the array or dictionary just
+// opened, without building it.
+func (p *pdfParser) skip() {
+	for open := 1; open > 0; {
+		tok, ok := p.token()
+		if !ok {
+			return
+		}
+		switch tok {
+		case pdfDelimiter('<'), pdfDelimiter('['):
+			open++
+		case pdfDelimiter('>'), pdfDelimiter(']'):
+			open--
+		}
+	}
+}
+
+// Delimiter tokens of the lexer.
+type pdfDelimiter byte
+
+// value reads the next object; keywords other than true, false and null
+// are returned as pdfKeyword. ok is false at the end of the data.
+func (p *pdfParser) value(depth int) (any, bool) {
+	tok, ok := p.token()
+	if !ok {
+		return nil, false
+	}
+	switch t := tok.(type) {
+	case pdfDelimiter:
+		if (t == '<' || t == '[') && depth >= maxPDFDepth {
+			p.skip()
+			return nil, true
+		}
+		switch t {
+		case '<':
+			d := make(pdfDict)
+			for {
+				key, ok := p.token()
+				if !ok || key == pdfDelimiter('>') {
+					return d, true
+				}
+				name, isName := key.(pdfName)
+				if !isName {
+					continue
+				}
+				v, ok := p.value(depth + 1)
+				if !ok || v == pdfDelimiter('>') {
+					return d, true
+				}
+				d[name] = v
+			}
+		case '[':
+			var arr pdfArray
+			for {
+				v, ok := p.value(depth + 1)
+				if !ok || v == pdfDelimiter(']') {
+					return arr, true
+				}
+				if len(arr) < maxEntries {
+					arr = append(arr, v)
+				}
+			}
+		}
+		return t, true
+	case int64:
+		// n g R is a reference
+		gen, ok := p.token()
+		if !ok {
+			return t, true
+		}
+		if _, isInt := gen.(int64); isInt {
+			r, ok := p.token()
+			if ok && r == pdfKeyword("R") {
+				return pdfRef(t), true
+			}
+			if ok {
+				p.unread(r)
+			}
+		}
+		p.unread(gen)
+		return t, true
+	case pdfKeyword:
+		switch t {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		case "null":
+			return nil, true
+		}
+	}
+	return tok, true
+}
+
+// pdfLexer splits PDF data into tokens, counting the indicator names it
+// reads in report.
+type pdfLexer struct {
+	data   []byte
+	pos    int
+	report *PDF
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// next returns the next token: a pdfName, pdfString, int64, float64,
+// pdfKeyword or a pdfDelimiter, '<' and '>' standing for "<<" and ">>".
+func (l *pdfLexer) next() (any, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '/':
+			return l.name(), true
+		case c == '(':
+			return l.literal(), true
+		case c == '<':
+			if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+				l.pos += 2
+				return pdfDelimiter('<'), true
+			}
+			return l.hexString(), true
+		case c == '>':
+			l.pos++
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+				return pdfDelimiter('>'), true
+			}
+		case c == '[' || c == ']':
+			l.pos++
+			return pdfDelimiter(c), true
+		case isPDFDelimiter(c):
+			// Stray ')', and the braces of PostScript functions
+			l.pos++
+		default:
+			start := l.pos
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+				l.pos++
+			}
+			word := string(l.data[start:l.pos])
+			if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+				return n, true
+			}
+			if f, err := strconv.ParseFloat(word, 64); err == nil {
+				return f, true
+			}
+			return pdfKeyword(word), true
+		}
+	}
+	return nil, false
+}
+
+// name reads a name, decoding #xx escapes.
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var b strings.Builder
+	escaped := false
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				b.WriteByte(v[0])
+				l.pos += 3
+				escaped = true
+				continue
+			}
+		}
+		b.WriteByte(c)
+		l.pos++
+	}
+	name := b.String()
+	if pdfIndicators["/"+name] {
+		l.report.Indicators["/"+name]++
+		if escaped {
+			l.report.ObfuscatedNames = true
+		}
+	}
+	return pdfName(name)
+}
+
+// literal reads a (string) with balanced parentheses and escapes.
+func (l *pdfLexer) literal() pdfString {
+	l.pos++
+	var b []byte
+	for depth := 1; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				l.pos++
+				return decodeText(b)
+			}
+		case '\\':
+			l.pos++
+			if l.pos == len(l.data) {
+				break
+			}
+			switch e := l.data[l.pos]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// Line continuation
+				if e == '\r' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := 0
+				for i := 0; i < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					v = v*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				l.pos--
+				c = byte(v)
+			default:
+				c = e
+			}
+		}
+		b = append(b, c)
+	}
+	return decodeText(b)
+}
+
+// hexString reads a <hex string>.
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++
+	var digits []byte
+	for ; l.pos < len(l.data) && l.data[l.pos] != '>'; l.pos++ {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, _ := hex.DecodeString(string(digits))
+	return decodeText(b)
+}
+
+// stream returns the data of the stream starting after the stream keyword
+// and moves past its endstream keyword. The /Length of d is used when it
+// is direct and consistent; otherwise the data runs up to endstream.
+func (l *pdfLexer) stream(d pdfDict) []byte {
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	if n, ok := d["Length"].(int64); ok && n >= 0 && n <= int64(len(l.data)-start) {
+		end := start + int(n)
+		if rest := bytes.TrimLeft(l.data[end:], "\r\n \t"); bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = len(l.data) - len(rest) + len("endstream")
+			return l.data[start:end]
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return l.data[start:]
+	}
+	l.pos = start + end + len("endstream")
+	return bytes.TrimRight(l.data[start:start+end], "\r\n")
+}
+
+// decodeText decodes a PDF text string: UTF-16BE with a byte order mark,
+// or PDFDocEncoding, treated as Latin-1.
+func decodeText(b []byte) pdfString {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		units := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return pdfString(utf16.Decode(units))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return pdfString(runes)
+}
@@ -0,0 +1,248 @@
+// Package audit maintains a persistent, tamper-evident record of MCP requests.
+//
+// Records are appended to a JSON Lines file. Each record carries the SHA-256
+// hash of the previous record and its own hash over its content and that link,
+// so editing, deleting or reordering any record breaks the chain from that
+// point on and is detected by Verify.
+//
+// Security considerations:
+//   - Request arguments are never stored; only a SHA-256 digest is recorded,
+//     which lets investigators match a known message without retaining it.
+//     Requests that change the server's lists record what they changed, so
+//     the log says who changed what and when
+//   - The file is opened append-only and created with owner-only permissions
+//   - The chain detects tampering but cannot prevent truncation of the newest
+//     records; ship the file to external storage for stronger guarantees
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// maxRecordSize bounds a single line when reading the log back.
+const maxRecordSize = 1 << 20
+
+// Record is one audited MCP request.
+type Record struct {
+	Seq          int64     `json:"seq"`
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Method       string    `json:"method"`
+	Tool         string    `json:"tool,omitempty"`
+	Prompt       string    `json:"prompt,omitempty"`
+	URI          string    `json:"uri,omitempty"`
+	Actor        string    `json:"actor"`
+	APIKey       string    `json:"api_key,omitempty"`
+	Subject      string    `json:"subject,omitempty"`
+	ClientCN     string    `json:"client_cn,omitempty"`
+	RemoteAddr   string    `json:"remote_addr,omitempty"`
+	ParamsDigest string    `json:"params_digest,omitempty"`
+	Change       string    `json:"change,omitempty"`
+	Outcome      string    `json:"outcome"`
+	DurationMS   int64     `json:"duration_ms"`
+	PrevHash     string    `json:"prev_hash"`
+	Hash         string    `json:"hash"`
+}
+
+// ChainError reports the first record whose hash chain does not verify.
+type ChainError struct {
+	Seq    int64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at seq %d: %s", e.Seq, e.Reason)
+}
+
+// Log is an append-only, hash-chained audit log file.
+type Log struct {
+	path  string
+	fsync bool
+
+	mu       sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+}
+
+// Open opens or creates the audit log at cfg.Path and resumes its chain. A
+// chain that fails verification is reported but not fatal: new records keep
+// chaining from the last record so evidence of the break is preserved.
+func Open(cfg config.AuditConfig) (*Log, error) {
+	l := &Log{path: cfg.Path, fsync: cfg.Fsync}
+
+	records, size, err := l.readAll()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if info, err := os.Stat(cfg.Path); err == nil && info.Size() > size {
+		// Drop a torn final write so new records start on a clean line.
+		if err := os.Truncate(cfg.Path, size); err != nil {
+			return nil, fmt.Errorf("failed to repair audit log: %w", err)
+		}
+	}
+	if err := Verify(records); err != nil {
+		logrus.WithError(err).Error("Audit log failed verification")
+	}
+	if n := len(records); n > 0 {
+		l.seq = records[n-1].Seq
+		l.lastHash = records[n-1].Hash
+	}
+
+	l.file, err = os.OpenFile(cfg.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return l, nil
+}
+
+// Append assigns the record its sequence number and chain hashes and writes
+// it to the log.
+func (l *Log) Append(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Seq = l.seq + 1
+	rec.Time = rec.Time.UTC()
+	rec.PrevHash = l.lastHash
+	hash, err := recordHash(rec)
+	if err != nil {
+		return err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if l.fsync {
+		if err := l.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	l.seq = rec.Seq
+	l.lastHash = rec.Hash
+	return nil
+}
+
+// Records returns every record in the log, oldest first.
+func (l *Log) Records() ([]*Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records, _, err := l.readAll()
+	return records, err
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+func (l *Log) readAll() ([]*Record, int64, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return readRecords(f)
+}
+
+// readRecords parses the log and returns the records with the size of the
+// well-formed prefix. A malformed or unterminated final line is a write torn
+// by a crash and is excluded; malformed lines elsewhere are errors.
+func readRecords(r io.Reader) ([]*Record, int64, error) {
+	var records []*Record
+	var size int64
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				logrus.WithField("line", line).Warn("Ignoring incomplete final audit record")
+			}
+			return records, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) > maxRecordSize {
+			return nil, 0, fmt.Errorf("line %d: record too large", line)
+		}
+
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				logrus.WithField("line", line).Warn("Ignoring malformed final audit record")
+				return records, size, nil
+			}
+			return nil, 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, &rec)
+		size += int64(len(data))
+	}
+}
+
+// Verify checks sequence numbers, links and hashes of a complete log, as
+// returned by Records. It returns a *ChainError for the first bad record.
+func Verify(records []*Record) error {
+	prev := ""
+	var seq int64
+	for _, rec := range records {
+		if rec.Seq != seq+1 {
+			return &ChainError{Seq: rec.Seq, Reason: fmt.Sprintf("expected seq %d", seq+1)}
+		}
+		if rec.PrevHash != prev {
+			return &ChainError{Seq: rec.Seq, Reason: "previous hash mismatch"}
+		}
+		hash, err := recordHash(*rec)
+		if err != nil {
+			return err
+		}
+		if hash != rec.Hash {
+			return &ChainError{Seq: rec.Seq, Reason: "record hash mismatch"}
+		}
+		prev = rec.Hash
+		seq = rec.Seq
+	}
+	return nil
+}
+
+// recordHash hashes the record's JSON encoding with the Hash field cleared.
+// PrevHash is part of the encoding, which links the record to its predecessor.
+func recordHash(rec Record) (string, error) {
+	rec.Hash = ""
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Digest returns the hex SHA-256 digest of request parameters.
+func Digest(params []byte) string {
+	if len(params) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(params)
+	return hex.EncodeToString(sum[:])
+}
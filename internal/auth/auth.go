@@ -0,0 +1,105 @@
+// Package auth authenticates HTTP transport requests with static API keys or
+// OAuth2/OIDC JWT bearer tokens, and authorizes tool calls by token claims.
+//
+// Clients present a credential either as "Authorization: Bearer <credential>"
+// or, for API keys, in the "X-API-Key" header. When any API key or an OIDC
+// provider is configured every request must carry a valid credential; with
+// neither configured authentication is disabled.
+//
+// Security considerations:
+//   - Keys are stored only as SHA-256 digests in memory
+//   - Lookups compare fixed-length digests, so timing does not reveal key prefixes
+//   - Bearer tokens must be asymmetrically signed by a key in the provider's JWKS
+//   - Rejected requests are logged with the remote address, never the presented credential
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/peer"
+)
+
+// Authenticator validates API keys and bearer tokens.
+type Authenticator struct {
+	keys     map[[sha256.Size]byte]string
+	verifier *Verifier
+}
+
+// New creates an authenticator for the configured keys and OIDC provider.
+func New(cfg config.AuthConfig) *Authenticator {
+	a := &Authenticator{keys: make(map[[sha256.Size]byte]string, len(cfg.APIKeys))}
+	for _, k := range cfg.APIKeys {
+		a.keys[sha256.Sum256([]byte(k.Key))] = k.Name
+	}
+	if cfg.OIDC.Enabled() {
+		a.verifier = NewVerifier(cfg.OIDC)
+	}
+	return a
+}
+
+// Enabled reports whether any API keys or an OIDC provider are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || a.verifier != nil
+}
+
+// Authenticate returns the name of the key matching the presented credential.
+func (a *Authenticator) Authenticate(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	name, ok := a.keys[sha256.Sum256([]byte(key))]
+	return name, ok
+}
+
+// Middleware rejects requests without a valid API key or bearer token and
+// records the key name or token identity in the request context for rate
+// limiting, authorization and audit attribution. It passes all requests
+// through when authentication is disabled.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	if !a.Enabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		cred := credential(r)
+
+		if name, ok := a.Authenticate(cred); ok {
+			next.ServeHTTP(w, r.WithContext(peer.WithPrincipal(ctx, name)))
+			return
+		}
+
+		reason := "missing or unknown credential"
+		if a.verifier != nil && cred != "" {
+			tok, err := a.verifier.Verify(ctx, cred)
+			if err == nil {
+				next.ServeHTTP(w, r.WithContext(peer.WithToken(ctx, tok)))
+				return
+			}
+			reason = err.Error()
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"remote_addr": peer.Addr(ctx),
+			"path":        r.URL.Path,
+			"reason":      reason,
+		}).Warn("Rejected unauthenticated request")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="spamassassin-mcp"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// credential extracts the presented API key from the request headers.
+func credential(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if scheme, token, ok := strings.Cut(h, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
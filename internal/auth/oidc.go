@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/peer"
+)
+
+const (
+	// clockSkew is the tolerance applied to exp and nbf.
+	clockSkew = time.Minute
+
+	// minJWKSRefetch bounds how often an unknown key ID can trigger a JWKS
+	// fetch, so forged tokens cannot be used to hammer the identity provider.
+	minJWKSRefetch = 30 * time.Second
+
+	maxJWKSSize = 1 << 20
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+// Verifier validates JWT bearer tokens against an OIDC provider's published
+// signing keys.
+//
+// Only asymmetric RS*, PS* and ES* algorithms are accepted; "none" and HMAC
+// tokens are always rejected so a leaked JWKS cannot be used to mint tokens.
+type Verifier struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	refresh  time.Duration
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier creates a verifier for the configured provider. Signing keys
+// are fetched lazily on first use.
+func NewVerifier(cfg config.OIDCConfig) *Verifier {
+	refresh := cfg.RefreshInterval
+	if refresh <= 0 {
+		refresh = time.Hour
+	}
+	return &Verifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		jwksURL:  cfg.JWKSURL,
+		refresh:  refresh,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Verify checks the token's signature, issuer, audience and validity window
+// and returns its identity.
+func (v *Verifier) Verify(ctx context.Context, raw string) (*peer.Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	hash, ok := algorithmHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, hash, h.Sum(nil), sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &peer.Token{Subject: sub, Claims: claims}, nil
+}
+
+func (v *Verifier) validateClaims(claims map[string]any) error {
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return errors.New("unexpected issuer")
+	}
+	if !slices.Contains(claimValues(claims["aud"]), v.audience) {
+		return errors.New("unexpected audience")
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token not yet valid")
+	}
+	return nil
+}
+
+// key returns the signing key with the given ID, refreshing the key set when
+// it is stale or the ID is unknown (e.g. after provider key rotation).
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.lookupLocked(kid)
+	age := time.Since(v.fetchedAt)
+	if ok && age < v.refresh {
+		return key, nil
+	}
+	if !ok && age < minJWKSRefetch {
+		return nil, errors.New("unknown signing key")
+	}
+
+	keys, err := v.fetchKeys(ctx)
+	if err != nil {
+		if ok {
+			// Keep serving the cached key set while the provider is unreachable.
+			logrus.WithError(err).Warn("Failed to refresh OIDC signing keys")
+			return key, nil
+		}
+		return nil, err
+	}
+	v.keys = keys
+	v.fetchedAt = time.Now()
+
+	if key, ok := v.lookupLocked(kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+func (v *Verifier) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logrus.WithField("kid", k.Kid).Debugf("Skipping JWKS key: %v", err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	logrus.WithField("keys", len(keys)).Debug("Loaded OIDC signing keys")
+	return keys, nil
+}
+
+// jwk is a JSON Web Key as published in a JWKS document.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+var algorithmHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+func verifySignature(alg string, key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, sig)
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest, sig, nil)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			break
+		}
+		// JWS encodes ECDSA signatures as fixed-width r||s.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+		return errors.New("invalid signature")
+	}
+	return fmt.Errorf("algorithm %s does not match signing key", alg)
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// claimValues normalizes a claim to a list of strings. String claims are
+// split on whitespace so OAuth2 "scope" claims work like role arrays.
+func claimValues(v any) []string {
+	switch c := v.(type) {
+	case string:
+		return strings.Fields(c)
+	case []any:
+		values := make([]string, 0, len(c))
+		for _, item := range c {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// lookupClaim resolves a dotted claim path such as "realm_access.roles".
+func lookupClaim(claims map[string]any, path string) any {
+	var v any = claims
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// Policy authorizes tool calls made with bearer tokens based on their claims.
+type Policy struct {
+	rules map[string][]config.ToolPolicy
+}
+
+// NewPolicy indexes the configured tool policies by tool name.
+func NewPolicy(policies []config.ToolPolicy) *Policy {
+	p := &Policy{rules: make(map[string][]config.ToolPolicy)}
+	for _, policy := range policies {
+		for _, tool := range policy.Tools {
+			p.rules[tool] = append(p.rules[tool], policy)
+		}
+	}
+	return p
+}
+
+// Allowed reports whether the holder of tok may call tool. Tools without a
+// policy are open to every authenticated caller; a tool with several
+// policies requires all of them to match. Requests not made with a bearer
+// token (API keys, stdio) carry no claims and are not subject to policies.
+func (p *Policy) Allowed(tool string, tok *peer.Token) bool {
+	if tok == nil {
+		return true
+	}
+	for _, rule := range p.rules[tool] {
+		values := claimValues(lookupClaim(tok.Claims, rule.Claim))
+		if !slices.ContainsFunc(values, func(v string) bool { return slices.Contains(rule.Values, v) }) {
+			return false
+		}
+	}
+	return true
+}
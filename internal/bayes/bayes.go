@@ -0,0 +1,219 @@
+// Package bayes reports the state of SpamAssassin's Bayes database, read
+// with sa-learn --dump magic, and expires its old tokens with sa-learn
+// --force-expire.
+//
+// sa-learn reads the same configuration as spamd, so the file and SQL
+// storage backends are both supported. With the file backend the size of
+// the database files is reported too.
+//
+// Security considerations:
+//   - sa-learn is executed directly, never through a shell, with a minimal
+//     environment, and only ever with --dump magic, which does not modify
+//     the database, or --force-expire, which only removes tokens as
+//     SpamAssassin's own automatic expiry does
+//   - Runs are bounded by a timeout
+package bayes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// ErrUnavailable is returned when sa-learn cannot be run.
+var ErrUnavailable = errors.New("sa-learn is not available")
+
+// Status is the state of the Bayes database. Times are omitted when the
+// database has not recorded them yet.
+type Status struct {
+	Version             int        `json:"version"`
+	Spam                int64      `json:"nspam"`
+	Ham                 int64      `json:"nham"`
+	Tokens              int64      `json:"ntokens"`
+	OldestToken         *time.Time `json:"oldest_token,omitempty"`
+	NewestToken         *time.Time `json:"newest_token,omitempty"`
+	LastJournalSync     *time.Time `json:"last_journal_sync,omitempty"`
+	LastExpiry          *time.Time `json:"last_expiry,omitempty"`
+	LastExpiryReduction int64      `json:"last_expiry_reduction"`
+	DatabaseSize        int64      `json:"database_size,omitempty"`
+	MinSpam             int        `json:"min_spam"`
+	MinHam              int        `json:"min_ham"`
+
+	// Active reports whether SpamAssassin uses Bayes: it does not until at
+	// least MinSpam spam and MinHam ham have been learned. Warnings say why
+	// BAYES_* scores should not be trusted yet.
+	Active   bool     `json:"active"`
+	Warnings []string `json:"warnings"`
+}
+
+// Client runs sa-learn.
+type Client struct {
+	binary  string
+	dbPath  string
+	timeout time.Duration
+	minSpam int
+	minHam  int
+}
+
+// New creates a client for cfg.
+func New(cfg config.BayesConfig) *Client {
+	return &Client{
+		binary:  cfg.SaLearn,
+		dbPath:  cfg.DBPath,
+		timeout: cfg.Timeout,
+		minSpam: cfg.MinSpam,
+		minHam:  cfg.MinHam,
+	}
+}
+
+// Status dumps the database's magic tokens.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	output, err := c.run(ctx, "--dump", "magic")
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := parseMagic(output)
+	if err != nil {
+		return nil, err
+	}
+	status.DatabaseSize = c.databaseSize()
+	status.MinSpam, status.MinHam = c.minSpam, c.minHam
+	status.Active = status.Spam >= int64(c.minSpam) && status.Ham >= int64(c.minHam)
+	status.Warnings = make([]string, 0)
+	if !status.Active {
+		status.Warnings = append(status.Warnings, fmt.Sprintf("Bayes is inactive: %d spam and %d ham learned, %d and %d needed; BAYES_* rules do not fire", status.Spam, status.Ham, c.minSpam, c.minHam))
+	}
+	return status, nil
+}
+
+// Expire removes the tokens SpamAssassin considers too old to keep, as its
+// automatic expiry does, and returns the database status afterwards.
+func (c *Client) Expire(ctx context.Context) (*Status, error) {
+	if _, err := c.run(ctx, "--force-expire"); err != nil {
+		return nil, err
+	}
+	return c.Status(ctx)
+}
+
+// run runs sa-learn with args and returns its output.
+func (c *Client) run(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if c.dbPath != "" {
+		args = append(args, "--dbpath", c.dbPath)
+	}
+	cmd := exec.CommandContext(ctx, c.binary, args...)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME"), "LANG=C"}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err := cmd.Run()
+	output := out.String()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("sa-learn did not finish within %s", c.timeout)
+	case errors.As(err, &exitErr):
+		return "", fmt.Errorf("sa-learn failed with exit status %d: %s", exitErr.ExitCode(), firstLine(output))
+	case err != nil:
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return output, nil
+}
+
+// parseMagic reads the non-token data lines of sa-learn --dump magic, e.g.
+// "0.000          0       1234          0  non-token data: nspam".
+func parseMagic(output string) (*Status, error) {
+	status := &Status{}
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields, name, ok := strings.Cut(scanner.Text(), "non-token data:")
+		if !ok {
+			continue
+		}
+		values := strings.Fields(fields)
+		if len(values) < 3 {
+			continue
+		}
+		value, err := strconv.ParseInt(values[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		found = true
+		switch strings.TrimSpace(name) {
+		case "bayes db version":
+			status.Version = int(value)
+		case "nspam":
+			status.Spam = value
+		case "nham":
+			status.Ham = value
+		case "ntokens":
+			status.Tokens = value
+		case "oldest atime":
+			status.OldestToken = unixTime(value)
+		case "newest atime":
+			status.NewestToken = unixTime(value)
+		case "last journal sync atime":
+			status.LastJournalSync = unixTime(value)
+		case "last expiry atime":
+			status.LastExpiry = unixTime(value)
+		case "last expire reduction count":
+			status.LastExpiryReduction = value
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unexpected sa-learn output: %s", firstLine(output))
+	}
+	return status, nil
+}
+
+// databaseSize sums the files of a file-backed database, whose names start
+// with the database path: bayes_toks, bayes_seen and the journal. It is 0
+// when there are none, as with the SQL backend.
+func (c *Client) databaseSize() int64 {
+	prefix := c.dbPath
+	if prefix == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return 0
+		}
+		prefix = filepath.Join(home, ".spamassassin", "bayes")
+	}
+	matches, _ := filepath.Glob(prefix + "_*")
+	var size int64
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func unixTime(seconds int64) *time.Time {
+	if seconds <= 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
+
+func firstLine(output string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if line == "" {
+		return "no output"
+	}
+	return line
+}
@@ -0,0 +1,235 @@
+// Package bimi checks Brand Indicators for Message Identification (BIMI)
+// records and the Verified Mark Certificates (VMC) they point to.
+//
+// A domain publishes its logo in a TXT record at
+// <selector>._bimi.<domain>, falling back to the organizational domain,
+// with the logo URL in l= and the URL of a VMC proving the right to use the
+// mark in a=. Mailbox providers only show the logo for mail passing DMARC
+// under an enforcing policy, so the DMARC policy of the domain is checked
+// too. For brand impersonation investigations, the absence of a record
+// shows that a brand does not publish BIMI at all, and a valid VMC names
+// the organization the mark was verified for.
+//
+// Security considerations:
+//   - Only https URLs are fetched, and only from public addresses, since
+//     the URLs are chosen by whoever controls the domain's DNS
+//   - Certificate downloads are bounded in size and time
+//   - Certificate chains are checked for consistency, not against the
+//     roots of the VMC issuers, which system trust stores do not carry
+package bimi
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/dmarc"
+	"spamassassin-mcp/internal/resolver"
+)
+
+// DefaultSelector is the selector used when a message names none.
+const DefaultSelector = "default"
+
+// Status is the outcome of a BIMI check.
+type Status string
+
+const (
+	// Pass means the domain publishes a valid record under an enforcing
+	// DMARC policy, with a valid VMC when one is referenced.
+	Pass Status = "pass"
+	// None means no record is published.
+	None Status = "none"
+	// Declined means the record is a declination, with an empty l= tag.
+	Declined Status = "declined"
+	// Fail means the record, the DMARC policy or the VMC is not
+	// acceptable; Problems says why.
+	Fail Status = "fail"
+	// TempError means a DNS lookup failed.
+	TempError Status = "temperror"
+)
+
+// Resolver is the subset of *net.Resolver used for the record and DMARC
+// lookups.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Result is the BIMI check of a domain. RecordDomain is the domain the
+// record was found at, the domain itself or its organizational domain.
+type Result struct {
+	Status       Status `json:"status"`
+	Domain       string `json:"domain"`
+	Selector     string `json:"selector"`
+	RecordDomain string `json:"record_domain,omitempty"`
+	Record       string `json:"record,omitempty"`
+
+	// Logo is the l= URL of the SVG logo and Authority the a= URL of the
+	// VMC.
+	Logo      string `json:"logo,omitempty"`
+	Authority string `json:"authority,omitempty"`
+
+	// DMARCPolicy is the record of the DMARC policy the domain is covered
+	// by. DMARCEnforced is set when it is p=quarantine or p=reject for all
+	// messages (pct=100), without sp=none, as BIMI requires.
+	DMARCPolicy   string `json:"dmarc_policy,omitempty"`
+	DMARCEnforced bool   `json:"dmarc_enforced"`
+
+	Certificate *Certificate `json:"certificate,omitempty"`
+
+	Problems []string `json:"problems"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Checker checks BIMI records, fetching the VMCs they reference when
+// configured to.
+type Checker struct {
+	fetch   bool
+	fetcher *fetcher
+}
+
+// New returns a checker for cfg.
+func New(cfg config.BIMIConfig) *Checker {
+	c := &Checker{fetch: cfg.FetchVMC}
+	if c.fetch {
+		c.fetcher = newFetcher(cfg.Timeout)
+	}
+	return c
+}
+
+// Check looks up the BIMI record of domain for selector and the DMARC
+// policy covering it, and validates the VMC the record references.
+func (c *Checker) Check(ctx context.Context, r Resolver, domain, selector string, now time.Time) *Result {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if selector == "" {
+		selector = DefaultSelector
+	}
+	result := &Result{Status: None, Domain: domain, Selector: strings.ToLower(selector), Problems: make([]string, 0)}
+
+	recordDomain, record, err := discover(ctx, r, domain, result.Selector)
+	if err != nil {
+		result.Status, result.Error = TempError, err.Error()
+		return result
+	}
+	if record == "" {
+		return result
+	}
+	result.RecordDomain, result.Record = recordDomain, record
+
+	tags, err := parseRecord(record)
+	if err != nil {
+		result.Status = Fail
+		result.Problems = append(result.Problems, err.Error())
+		return result
+	}
+	result.Logo, result.Authority = tags["l"], tags["a"]
+	if result.Logo == "" {
+		result.Status = Declined
+		return result
+	}
+	for _, tag := range []struct{ name, url string }{{"l", result.Logo}, {"a", result.Authority}} {
+		if u, err := url.Parse(tag.url); tag.url != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s= must be an https URL, got %q", tag.name, tag.url))
+		}
+	}
+
+	_, dmarcRecord, policy, err := dmarc.Discover(ctx, r, domain)
+	switch {
+	case err != nil:
+		result.Status, result.Error = TempError, err.Error()
+		return result
+	case policy == nil:
+		result.Problems = append(result.Problems, "no DMARC policy is published; BIMI requires p=quarantine or p=reject")
+	default:
+		result.DMARCPolicy = dmarcRecord
+		result.DMARCEnforced = (policy.Policy == dmarc.DispositionQuarantine || policy.Policy == dmarc.DispositionReject) &&
+			policy.Percentage == 100 && policy.SubdomainPolicy != dmarc.DispositionNone
+		if !result.DMARCEnforced {
+			result.Problems = append(result.Problems, "DMARC policy is not enforcing; BIMI requires p=quarantine or p=reject with pct=100 and no sp=none")
+		}
+	}
+
+	if result.Authority != "" && len(result.Problems) == 0 && c.fetch {
+		content, err := c.fetcher.get(ctx, result.Authority)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("failed to fetch the VMC: %v", err))
+		} else {
+			result.Certificate = ValidateCertificate(content, []string{domain, recordDomain}, result.Selector, now)
+			result.Certificate.URL = result.Authority
+			result.Problems = append(result.Problems, result.Certificate.Problems...)
+		}
+	}
+
+	if len(result.Problems) == 0 {
+		result.Status = Pass
+	} else {
+		result.Status = Fail
+	}
+	return result
+}
+
+// discover looks up the record of domain for selector, falling back to
+// its organizational domain, and returns where it was found. An empty
+// record without error means none is published.
+func discover(ctx context.Context, r Resolver, domain, selector string) (string, string, error) {
+	candidates := []string{domain}
+	if org := dmarc.OrganizationalDomain(domain); org != domain {
+		candidates = append(candidates, org)
+	}
+	for _, d := range candidates {
+		txts, err := r.LookupTXT(ctx, resolver.FQDN(selector+"._bimi."+d))
+		if err != nil {
+			if resolver.NotFound(err) {
+				continue
+			}
+			return "", "", fmt.Errorf("BIMI lookup for %s failed: %w", d, err)
+		}
+		var records []string
+		for _, txt := range txts {
+			if v, _, _ := strings.Cut(txt, ";"); strings.EqualFold(strings.TrimSpace(v), "v=BIMI1") {
+				records = append(records, txt)
+			}
+		}
+		// More than one record is treated as none
+		if len(records) == 1 {
+			return d, records[0], nil
+		}
+	}
+	return "", "", nil
+}
+
+// parseRecord returns the tags of a BIMI record by lower-case name.
+func parseRecord(record string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for i, part := range strings.Split(record, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if i == 0 && (name != "v" || strings.TrimSpace(value) != "BIMI1") {
+			return nil, fmt.Errorf("record must start with v=BIMI1")
+		}
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("duplicate %s= tag", name)
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// Selector returns the selector of a BIMI-Selector header value
+// ("v=BIMI1; s=brand"), or "" when it names none.
+func Selector(header string) string {
+	tags, err := parseRecord(header)
+	if err != nil {
+		return ""
+	}
+	return tags["s"]
+}
@@ -0,0 +1,201 @@
+package bimi
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// maxCertificateSize bounds the PEM files fetched; a VMC embeds the
+	// SVG logo, which BIMI limits to 32 KiB.
+	maxCertificateSize = 256 << 10
+
+	// maxRedirects bounds the redirects followed by one fetch.
+	maxRedirects = 5
+)
+
+var (
+	// oidBIMIKeyUsage is id-kp-BrandIndicatorforMessageIdentification,
+	// the extended key usage of VMCs.
+	oidBIMIKeyUsage = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 31}
+
+	// oidLogotype is the logotype extension (RFC 3709) holding the mark.
+	oidLogotype = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 12}
+
+	// oidMarkType is the subject attribute naming the kind of mark
+	// verified, such as "Registered Mark".
+	oidMarkType = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 53087, 1, 13}
+)
+
+// Certificate is the validation of a VMC. Problems lists why it is not
+// acceptable; Valid is set when there are none.
+type Certificate struct {
+	URL          string    `json:"url,omitempty"`
+	Subject      string    `json:"subject"`
+	Organization string    `json:"organization,omitempty"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	MarkType     string    `json:"mark_type,omitempty"`
+	Domains      []string  `json:"domains"`
+	HasLogo      bool      `json:"has_logo"`
+
+	// ChainLength is the number of certificates in the file, leaf first.
+	ChainLength int `json:"chain_length"`
+
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems"`
+}
+
+// ValidateCertificate checks a PEM-encoded VMC and its chain: the leaf
+// must carry the BIMI extended key usage and the logotype extension, be
+// within its validity period at now, and name one of domains, or its
+// selector._bimi name, among its DNS names; each certificate must be
+// signed by the next.
+func ValidateCertificate(content []byte, domains []string, selector string, now time.Time) *Certificate {
+	c := &Certificate{Domains: make([]string, 0), Problems: make([]string, 0)}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			c.Problems = append(c.Problems, fmt.Sprintf("certificate %d cannot be parsed: %v", len(chain)+1, err))
+			return c
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		c.Problems = append(c.Problems, "the VMC file holds no PEM certificates")
+		return c
+	}
+	c.ChainLength = len(chain)
+
+	leaf := chain[0]
+	c.Subject = leaf.Subject.String()
+	if len(leaf.Subject.Organization) > 0 {
+		c.Organization = leaf.Subject.Organization[0]
+	}
+	c.Issuer = leaf.Issuer.String()
+	c.SerialNumber = leaf.SerialNumber.Text(16)
+	c.NotBefore, c.NotAfter = leaf.NotBefore.UTC(), leaf.NotAfter.UTC()
+	for _, name := range leaf.Subject.Names {
+		if name.Type.Equal(oidMarkType) {
+			c.MarkType, _ = name.Value.(string)
+		}
+	}
+	for _, name := range leaf.DNSNames {
+		c.Domains = append(c.Domains, strings.ToLower(name))
+	}
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(oidLogotype) {
+			c.HasLogo = true
+		}
+	}
+
+	if !slices.ContainsFunc(leaf.UnknownExtKeyUsage, oidBIMIKeyUsage.Equal) {
+		c.Problems = append(c.Problems, "the certificate lacks the BIMI extended key usage (1.3.6.1.5.5.7.3.31)")
+	}
+	if !c.HasLogo {
+		c.Problems = append(c.Problems, "the certificate embeds no logo (logotype extension)")
+	}
+	switch {
+	case now.Before(leaf.NotBefore):
+		c.Problems = append(c.Problems, fmt.Sprintf("the certificate is not valid before %s", c.NotBefore.Format(time.RFC3339)))
+	case now.After(leaf.NotAfter):
+		c.Problems = append(c.Problems, fmt.Sprintf("the certificate expired on %s", c.NotAfter.Format(time.RFC3339)))
+	}
+	if !slices.ContainsFunc(c.Domains, func(name string) bool {
+		for _, domain := range domains {
+			if domain != "" && (name == domain || name == selector+"._bimi."+domain) {
+				return true
+			}
+		}
+		return false
+	}) {
+		c.Problems = append(c.Problems, fmt.Sprintf("the certificate is not issued for %s", domains[0]))
+	}
+	for i := 0; i+1 < len(chain); i++ {
+		if err := chain[i].CheckSignatureFrom(chain[i+1]); err != nil {
+			c.Problems = append(c.Problems, fmt.Sprintf("certificate %d is not signed by certificate %d: %v", i+1, i+2, err))
+		}
+	}
+	c.Valid = len(c.Problems) == 0
+	return c
+}
+
+// fetcher downloads VMCs over https from public addresses.
+type fetcher struct {
+	http *http.Client
+}
+
+func newFetcher(timeout time.Duration) *fetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		// Resolved addresses are checked at connect time, so a name cannot
+		// lead to an internal service
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if addr := addrPort.Addr().Unmap(); !addr.IsGlobalUnicast() || addr.IsPrivate() {
+				return fmt.Errorf("refusing to connect to non-public address %s", addr)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &fetcher{http: &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing redirect to %s", req.URL.Redacted())
+			}
+			return nil
+		},
+	}}
+}
+
+// get fetches an https URL.
+func (f *fetcher) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxCertificateSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxCertificateSize {
+		return nil, fmt.Errorf("the VMC file exceeds %d bytes", maxCertificateSize)
+	}
+	return content, nil
+}
@@ -0,0 +1,299 @@
+// Package blocklist keeps the senders, domains and IP addresses whose mail
+// SpamAssassin should always treat as spam, managed at runtime with the
+// blocklist tools.
+//
+// Entries live in memory. When a path is configured they are also saved to a
+// JSON file on every change and restored by Open. When a local.cf is
+// configured, every change also rewrites a managed block of it: addresses
+// and domains become blocklist_from lines, and IP addresses a rule on the
+// relay that handed the message to the trusted network. spamd applies the
+// entries once it reloads its configuration; see package localcf.
+//
+// Security considerations:
+//   - Entries are validated as an address pattern, a domain name or an IP
+//     address, so they cannot inject other configuration directives
+//   - The state file is written atomically with owner-only permissions
+package blocklist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/localcf"
+)
+
+// Kinds of entries.
+const (
+	Address = "address"
+	Domain  = "domain"
+	IP      = "ip"
+)
+
+const (
+	// MaxCommentLength bounds the comment of an entry.
+	MaxCommentLength = 200
+
+	// IPRule names the rule IP address entries are written as.
+	IPRule = "SA_MCP_BLOCKLIST_IP"
+
+	// ipRuleScore matches the score of SpamAssassin's own USER_IN_BLOCKLIST.
+	ipRuleScore = "100.0"
+)
+
+var (
+	// ErrNotFound is returned when removing a value that is not listed.
+	ErrNotFound = errors.New("value is not on the blocklist")
+
+	domainRegex = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9\-]{0,61}[a-z0-9])?\.)+[a-z0-9\-]{2,63}$`)
+)
+
+// Entry is one blocklisted address pattern, domain or IP address.
+type Entry struct {
+	Value   string    `json:"value"`
+	Kind    string    `json:"kind"`
+	Comment string    `json:"comment,omitempty"`
+	AddedBy string    `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Store holds the blocklist entries.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	localCF   *localcf.Block
+	directive string
+	entries   []Entry
+}
+
+// New returns an empty store kept in memory only.
+func New() *Store {
+	return &Store{entries: make([]Entry, 0)}
+}
+
+// Open returns the store for cfg, restoring the entries saved at cfg.Path by
+// a previous run.
+func Open(cfg config.BlocklistConfig) (*Store, error) {
+	s := New()
+	s.path = cfg.Path
+	if cfg.LocalCF != "" {
+		s.localCF = &localcf.Block{Path: cfg.LocalCF, Name: "blocklist"}
+		s.directive = cfg.Directive
+	}
+	if s.path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read blocklist file: %w", err)
+	default:
+		var saved []Entry
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse blocklist file %s: %w", s.path, err)
+		}
+		for _, e := range saved {
+			if kind, value, err := Parse(e.Value); err != nil || kind != e.Kind || value != e.Value {
+				return nil, fmt.Errorf("blocklist file %s: invalid entry %q", s.path, e.Value)
+			}
+		}
+		s.entries = append(s.entries, saved...)
+	}
+	return s, nil
+}
+
+// Parse classifies value as an address pattern (anything with an @), an IP
+// address or a domain, and returns it in the form entries are stored in.
+func Parse(value string) (kind, normalized string, err error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case strings.Contains(value, "@"):
+		if !localcf.ValidPattern(value) {
+			return "", "", fmt.Errorf("invalid blocklist address %q: use an email address, optionally with * and ? wildcards, e.g. *@example.com", value)
+		}
+		return Address, value, nil
+	case net.ParseIP(value) != nil:
+		return IP, net.ParseIP(value).String(), nil
+	case domainRegex.MatchString(value) && len(value) <= 253:
+		return Domain, value, nil
+	}
+	return "", "", fmt.Errorf("invalid blocklist value %q: use an email address or pattern, a domain or an IP address", value)
+}
+
+// ValidateComment checks that a comment is a single printable line.
+func ValidateComment(comment string) error {
+	if len(comment) > MaxCommentLength {
+		return fmt.Errorf("comment exceeds %d characters", MaxCommentLength)
+	}
+	if strings.ContainsFunc(comment, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return fmt.Errorf("comment must be a single line without control characters")
+	}
+	return nil
+}
+
+// Entries returns the entries in the order they were added.
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.entries)
+}
+
+// Add lists e.Value, which must be as returned by Parse. It reports false
+// without changing anything when the value is already listed.
+func (s *Store) Add(e Entry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(e.Value) >= 0 {
+		return false, nil
+	}
+	if err := s.update(append(slices.Clone(s.entries), e)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove delists value, returning the removed entry.
+func (s *Store) Remove(value string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(value)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	removed := s.entries[i]
+	if err := s.update(slices.Delete(slices.Clone(s.entries), i, i+1)); err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
+
+// Get returns the entry for a parsed value, if listed.
+func (s *Store) Get(value string) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(value); i >= 0 {
+		e := s.entries[i]
+		return &e
+	}
+	return nil
+}
+
+// Match returns the entries matching a sender, its domain or an IP address;
+// any of them may be empty. A domain entry also matches its subdomains.
+func (s *Store) Match(sender, domain, ip string) []Entry {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if parsed := net.ParseIP(strings.TrimSpace(ip)); parsed != nil {
+		ip = parsed.String()
+	} else {
+		ip = ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matches []Entry
+	for _, e := range s.entries {
+		var ok bool
+		switch e.Kind {
+		case Address:
+			ok = sender != "" && localcf.MatchPattern(e.Value, sender)
+		case Domain:
+			ok = domain == e.Value || strings.HasSuffix(domain, "."+e.Value)
+		case IP:
+			ok = ip == e.Value
+		}
+		if ok {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+// LocalCF returns the local.cf the store writes, or "" if none.
+func (s *Store) LocalCF() string {
+	if s.localCF == nil {
+		return ""
+	}
+	return s.localCF.Path
+}
+
+func (s *Store) index(value string) int {
+	return slices.IndexFunc(s.entries, func(e Entry) bool { return e.Value == value })
+}
+
+// update saves entries and writes them to local.cf before making them
+// current. If local.cf cannot be written, the saved entries are restored.
+func (s *Store) update(entries []Entry) error {
+	if err := s.save(entries); err != nil {
+		return err
+	}
+	if s.localCF != nil {
+		if err := s.localCF.Write(s.lines(entries)); err != nil {
+			// Best effort: the error that matters is the local.cf one.
+			s.save(s.entries)
+			return err
+		}
+	}
+	s.entries = entries
+	return nil
+}
+
+func (s *Store) save(entries []Entry) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := localcf.WriteAtomic(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save blocklist: %w", err)
+	}
+	return nil
+}
+
+// lines renders entries as local.cf lines, each preceded by its comment.
+// A domain is blocked together with its subdomains. IP addresses are
+// matched against the first untrusted relay, the host that handed the
+// message to the trusted network, by a single rule after the other lines.
+func (s *Store) lines(entries []Entry) []string {
+	var lines, ipComments, ips []string
+	for _, e := range entries {
+		if e.Kind == IP {
+			if e.Comment != "" {
+				ipComments = append(ipComments, fmt.Sprintf("# %s: %s", e.Value, e.Comment))
+			}
+			ips = append(ips, regexp.QuoteMeta(e.Value))
+			continue
+		}
+		if e.Comment != "" {
+			lines = append(lines, "# "+e.Comment)
+		}
+		if e.Kind == Domain {
+			lines = append(lines, fmt.Sprintf("%s *@%s *@*.%s", s.directive, e.Value, e.Value))
+		} else {
+			lines = append(lines, s.directive+" "+e.Value)
+		}
+	}
+	if len(ips) > 0 {
+		lines = append(lines, ipComments...)
+		lines = append(lines,
+			fmt.Sprintf(`header %s X-Spam-Relays-Untrusted =~ /^\[ ip=(?:%s) /`, IPRule, strings.Join(ips, "|")),
+			fmt.Sprintf("describe %s Relay IP address on the spamassassin-mcp blocklist", IPRule),
+			fmt.Sprintf("score %s %s", IPRule, ipRuleScore),
+		)
+	}
+	return lines
+}
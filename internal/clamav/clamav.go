@@ -0,0 +1,116 @@
+// Package clamav scans content for malware with a clamd daemon.
+//
+// Content is streamed over the INSTREAM command, so clamd needs no access to
+// the server's files and nothing is written to disk. Only detection is
+// supported: infected content is reported by signature name, never
+// disinfected or quarantined.
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// chunkSize is the size of the INSTREAM chunks sent to clamd.
+const chunkSize = 64 * 1024
+
+// ErrTooLarge is returned for content larger than clamav.max_size, which is
+// not sent to clamd.
+var ErrTooLarge = errors.New("exceeds clamav.max_size")
+
+// Client scans content with clamd. Every scan uses a new connection.
+type Client struct {
+	network string
+	address string
+	maxSize int64
+	dialer  net.Dialer
+}
+
+// New returns a client for cfg, or nil when no clamd daemon is configured.
+func New(cfg config.ClamAVConfig) *Client {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Client{network: cfg.Network, address: cfg.Address, maxSize: cfg.MaxSize}
+}
+
+// Scan streams data to clamd and returns the name of the signature it
+// matched, or "" when it is clean.
+func (c *Client) Scan(ctx context.Context, data []byte) (string, error) {
+	if int64(len(data)) > c.maxSize {
+		return "", ErrTooLarge
+	}
+	reply, err := c.command(ctx, "INSTREAM", func(conn net.Conn) error {
+		var size [4]byte
+		for off := 0; off < len(data); off += chunkSize {
+			chunk := data[off:min(off+chunkSize, len(data))]
+			binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+			if _, err := conn.Write(size[:]); err != nil {
+				return err
+			}
+			if _, err := conn.Write(chunk); err != nil {
+				return err
+			}
+		}
+		binary.BigEndian.PutUint32(size[:], 0)
+		_, err := conn.Write(size[:])
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// stream: OK, stream: <signature> FOUND or <message> ERROR
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", strings.TrimSuffix(result, " ERROR"))
+	}
+}
+
+// Version returns the clamd version and signature database, e.g.
+// "ClamAV 1.3.1/27300/Mon Jun 10 08:24:53 2024".
+func (c *Client) Version(ctx context.Context) (string, error) {
+	return c.command(ctx, "VERSION", nil)
+}
+
+// command sends a NUL-terminated command, then whatever send writes, and
+// returns clamd's reply.
+func (c *Client) command(ctx context.Context, name string, send func(net.Conn) error) (string, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// A cancelled context unblocks pending reads and writes.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write([]byte("z" + name + "\x00")); err != nil {
+		return "", fmt.Errorf("clamd %s failed: %w", name, err)
+	}
+	if send != nil {
+		if err := send(conn); err != nil {
+			return "", fmt.Errorf("clamd %s failed: %w", name, err)
+		}
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamd %s failed: %w", name, err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
@@ -17,28 +17,162 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+
+	"spamassassin-mcp/internal/cron"
 )
 
 type Config struct {
-	Server       ServerConfig       `mapstructure:"server"`
-	SpamAssassin SpamAssassinConfig `mapstructure:"spamassassin"`
-	Security     SecurityConfig     `mapstructure:"security"`
-	LogLevel     string             `mapstructure:"log_level"`
+	Server         ServerConfig         `mapstructure:"server"`
+	SpamAssassin   SpamAssassinConfig   `mapstructure:"spamassassin"`
+	Security       SecurityConfig       `mapstructure:"security"`
+	AsyncScan      AsyncScanConfig      `mapstructure:"async_scan"`
+	Tags           []TagRule            `mapstructure:"tags"`
+	TagWebhooks    []TagWebhookConfig   `mapstructure:"tag_webhooks"`
+	Profiles       map[string]Profile   `mapstructure:"profiles"`
+	Auth           AuthConfig           `mapstructure:"auth"`
+	Audit          AuditConfig          `mapstructure:"audit"`
+	Stats          StatsConfig          `mapstructure:"stats"`
+	History        HistoryConfig        `mapstructure:"history"`
+	PeerSync       PeerSyncConfig       `mapstructure:"peer_sync"`
+	Quarantine     QuarantineConfig     `mapstructure:"quarantine"`
+	Corpus         CorpusConfig         `mapstructure:"corpus"`
+	IMAP           IMAPConfig           `mapstructure:"imap"`
+	POP3           POP3Config           `mapstructure:"pop3"`
+	MaildirWatch   MaildirWatchConfig   `mapstructure:"maildir_watch"`
+	ObjectStore    ObjectStoreConfig    `mapstructure:"object_store"`
+	ContentRefs    ContentRefsConfig    `mapstructure:"content_refs"`
+	MISP           MISPConfig           `mapstructure:"misp"`
+	TAXII          TAXIIConfig          `mapstructure:"taxii"`
+	AbuseIPDB      AbuseIPDBConfig      `mapstructure:"abuseipdb"`
+	RDAP           RDAPConfig           `mapstructure:"rdap"`
+	GeoIP          GeoIPConfig          `mapstructure:"geoip"`
+	BIMI           BIMIConfig           `mapstructure:"bimi"`
+	VirusTotal     VirusTotalConfig     `mapstructure:"virustotal"`
+	Unshorten      UnshortenConfig      `mapstructure:"unshorten"`
+	URLFeeds       URLFeedsConfig       `mapstructure:"url_feeds"`
+	Homoglyph      HomoglyphConfig      `mapstructure:"homoglyph"`
+	OCR            OCRConfig            `mapstructure:"ocr"`
+	ClamAV         ClamAVConfig         `mapstructure:"clamav"`
+	Rspamd         RspamdConfig         `mapstructure:"rspamd"`
+	Welcomelist    WelcomelistConfig    `mapstructure:"welcomelist"`
+	Blocklist      BlocklistConfig      `mapstructure:"blocklist"`
+	Bayes          BayesConfig          `mapstructure:"bayes"`
+	RuleUpdates    RuleUpdatesConfig    `mapstructure:"rule_updates"`
+	SpamdReload    SpamdReloadConfig    `mapstructure:"spamd_reload"`
+	RuleDeployment RuleDeploymentConfig `mapstructure:"rule_deployment"`
+	Scheduler      SchedulerConfig      `mapstructure:"scheduler"`
+	DNS            DNSConfig            `mapstructure:"dns"`
+	Redaction      RedactionConfig      `mapstructure:"redaction"`
+	SIEM           SIEMConfig           `mapstructure:"siem"`
+	Logging        LoggingConfig        `mapstructure:"logging"`
+	LogLevel       string               `mapstructure:"log_level"`
+	WatchConfig    bool                 `mapstructure:"watch_config"`
 }
 
 type ServerConfig struct {
-	BindAddr string        `mapstructure:"bind_addr"`
-	Timeout  time.Duration `mapstructure:"timeout"`
+	BindAddr        string        `mapstructure:"bind_addr"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	TLS             TLSConfig     `mapstructure:"tls"`
+	Admin           AdminConfig   `mapstructure:"admin"`
+}
+
+// AdminConfig controls the admin listener serving health and readiness
+// probes. An empty BindAddr disables it.
+type AdminConfig struct {
+	BindAddr      string        `mapstructure:"bind_addr"`
+	ProbeInterval time.Duration `mapstructure:"probe_interval"`
+	ProbeTimeout  time.Duration `mapstructure:"probe_timeout"`
+}
+
+// TLSConfig enables HTTPS on the HTTP transport. Setting ClientCAFile
+// additionally requires clients to present a certificate signed by one of
+// those CAs (mutual TLS).
+type TLSConfig struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// Enabled reports whether a server certificate is configured.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
 }
 
+// SpamAssassinConfig locates spamd. MaxConcurrentScans caps simultaneous
+// scans so bursts cannot exhaust spamd's children; further scans wait up to
+// QueueTimeout for a free slot. Zero MaxConcurrentScans means unlimited.
 type SpamAssassinConfig struct {
-	Host      string        `mapstructure:"host"`
-	Port      int           `mapstructure:"port"`
-	Timeout   time.Duration `mapstructure:"timeout"`
-	Threshold float64       `mapstructure:"threshold"`
+	Host               string        `mapstructure:"host"`
+	Port               int           `mapstructure:"port"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	Threshold          float64       `mapstructure:"threshold"`
+	RulesDirs          []string      `mapstructure:"rules_dirs"`
+	MaxConcurrentScans int           `mapstructure:"max_concurrent_scans"`
+	QueueTimeout       time.Duration `mapstructure:"queue_timeout"`
+
+	// Binary is the spamassassin command-line tool used to lint and test
+	// submitted rules in a sandbox; SandboxTimeout bounds each run.
+	Binary         string        `mapstructure:"binary"`
+	SandboxTimeout time.Duration `mapstructure:"sandbox_timeout"`
+
+	// Compress sends messages to spamd zlib-compressed, when spamd's
+	// protocol version supports it.
+	Compress bool `mapstructure:"compress"`
+
+	// AllowedUsers are the spamd users callers may scan as with the user
+	// parameter, selecting that user's preferences and Bayes database.
+	AllowedUsers []string `mapstructure:"allowed_users"`
+
+	// CollaborativeFilters are the spamd users scans switch to when a
+	// caller enables or disables the Razor2, Pyzor and DCC tests.
+	CollaborativeFilters CollaborativeFiltersConfig `mapstructure:"collaborative_filters"`
+
+	// ThresholdMin and ThresholdMax bound the threshold callers may set
+	// for one scan; requested thresholds outside are clamped to them.
+	ThresholdMin float64 `mapstructure:"threshold_min"`
+	ThresholdMax float64 `mapstructure:"threshold_max"`
+}
+
+// CollaborativeFiltersConfig names the spamd users whose preferences turn
+// the Razor2, Pyzor and DCC network tests on (EnabledUser) and off
+// (DisabledUser), with use_razor2, use_pyzor and use_dcc. spamd has no
+// per-request switch for these tests, so a scan that sets
+// collaborative_filters runs as one of these users instead. An empty user
+// makes the corresponding setting unavailable.
+type CollaborativeFiltersConfig struct {
+	EnabledUser  string `mapstructure:"enabled_user"`
+	DisabledUser string `mapstructure:"disabled_user"`
+}
+
+// User returns the spamd user for a collaborative_filters setting, "enable"
+// or "disable", or "" when none is configured for it.
+func (c CollaborativeFiltersConfig) User(setting string) string {
+	switch setting {
+	case "enable":
+		return c.EnabledUser
+	case "disable":
+		return c.DisabledUser
+	}
+	return ""
 }
 
 type SecurityConfig struct {
@@ -50,34 +184,1008 @@ type SecurityConfig struct {
 	ValidationEnabled bool            `mapstructure:"validation_enabled"`
 }
 
+// AsyncScanConfig controls deferred scanning of large submissions.
+type AsyncScanConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	SizeThreshold int64         `mapstructure:"size_threshold"`
+	Workers       int           `mapstructure:"workers"`
+	QueueSize     int           `mapstructure:"queue_size"`
+	ResultTTL     time.Duration `mapstructure:"result_ttl"`
+}
+
+// TagRule attaches an operator-defined tag to scan results. The tag is applied
+// when any listed SpamAssassin rule hit or, if MinScore is set, when the score
+// reaches it.
+type TagRule struct {
+	Tag      string   `mapstructure:"tag"`
+	Rules    []string `mapstructure:"rules"`
+	MinScore *float64 `mapstructure:"min_score"`
+}
+
+// TagWebhookConfig posts the verdict of every scan tagged with one of Tags
+// to URL as JSON, with Headers added to the request, for example to
+// authenticate it. Timeout bounds each post; zero means 10 seconds. URL and
+// Headers are secret, since endpoints such as chat webhooks embed their
+// credentials in the URL.
+type TagWebhookConfig struct {
+	URL     string            `mapstructure:"url" secret:"true"`
+	Tags    []string          `mapstructure:"tags"`
+	Headers map[string]string `mapstructure:"headers" secret:"true"`
+	Timeout time.Duration     `mapstructure:"timeout"`
+}
+
+// AuthConfig controls authentication on the HTTP transport. When neither API
+// keys nor OIDC are configured the endpoint is unauthenticated.
+// Profile is a named tenant policy that callers select per request with the
+// profile parameter, so one server can apply different policies to different
+// teams. Unset fields fall back to the server-wide settings; lists that are
+// set replace the server-wide lists rather than extending them. OkLanguages
+// and OkLocales take SpamAssassin's syntax, "all" or space-separated codes,
+// and decide which language and locale rule hits count.
+// CollaborativeFilters, "enable" or "disable", scans as the matching
+// spamassassin.collaborative_filters user, like the scan parameter of the
+// same name.
+type Profile struct {
+	Threshold            *float64 `mapstructure:"threshold"`
+	BlockedDomains       []string `mapstructure:"blocked_domains"`
+	AllowedSenders       []string `mapstructure:"allowed_senders"`
+	SpamdUser            string   `mapstructure:"spamd_user"`
+	OkLanguages          string   `mapstructure:"ok_languages"`
+	OkLocales            string   `mapstructure:"ok_locales"`
+	CollaborativeFilters string   `mapstructure:"collaborative_filters"`
+}
+
+// Presets are the built-in scoring profiles, selectable by name like
+// configured profiles: aggressive flags more mail and runs the
+// collaborative filters, for triage where a missed phish costs more than a
+// false positive; permissive flags less and skips them; balanced keeps
+// SpamAssassin's default threshold. A configured profile of the same name
+// replaces a preset. The collaborative filters setting of a preset only
+// applies when the matching spamassassin.collaborative_filters user is
+// configured.
+var Presets = map[string]Profile{
+	"aggressive": {Threshold: presetThreshold(3.0), CollaborativeFilters: "enable"},
+	"balanced":   {Threshold: presetThreshold(5.0)},
+	"permissive": {Threshold: presetThreshold(8.0), CollaborativeFilters: "disable"},
+}
+
+func presetThreshold(v float64) *float64 {
+	return &v
+}
+
+// Profile returns the profile named name, case-insensitively: a configured
+// profile or, failing that, a preset.
+func (c *Config) Profile(name string) (Profile, bool) {
+	name = strings.ToLower(name)
+	if pr, ok := c.Profiles[name]; ok {
+		return pr, true
+	}
+	pr, ok := Presets[name]
+	return pr, ok
+}
+
+// ProfileNames returns the names of the configured profiles and presets,
+// sorted.
+func (c *Config) ProfileNames() []string {
+	names := slices.Collect(maps.Keys(c.Profiles))
+	for name := range Presets {
+		if _, ok := c.Profiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+type AuthConfig struct {
+	APIKey      string     `mapstructure:"api_key" secret:"true"`
+	APIKeys     []APIKey   `mapstructure:"api_keys"`
+	APIKeysFile string     `mapstructure:"api_keys_file"`
+	OIDC        OIDCConfig `mapstructure:"oidc"`
+}
+
+// defaultAPIKeyName names the key set with auth.api_key.
+const defaultAPIKeyName = "default"
+
+// OIDCConfig enables validation of JWT bearer tokens issued by an OAuth2/OIDC
+// identity provider. Tokens must be signed by a key published at JWKSURL and
+// carry the configured issuer and audience.
+type OIDCConfig struct {
+	Issuer          string        `mapstructure:"issuer"`
+	Audience        string        `mapstructure:"audience"`
+	JWKSURL         string        `mapstructure:"jwks_url"`
+	RefreshInterval time.Duration `mapstructure:"jwks_refresh_interval"`
+	ToolPolicies    []ToolPolicy  `mapstructure:"tool_policies"`
+}
+
+// Enabled reports whether bearer token validation is configured.
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+// ToolPolicy restricts tools to token holders whose claim contains one of the
+// listed values. Claim may be a dotted path into nested claims, e.g.
+// "realm_access.roles".
+type ToolPolicy struct {
+	Tools  []string `mapstructure:"tools"`
+	Claim  string   `mapstructure:"claim"`
+	Values []string `mapstructure:"values"`
+}
+
+// APIKey is a named static API key. The name identifies the caller in audit
+// logs and rate limiting; zero limits fall back to the per-client defaults.
+// The key may be read from KeyFile instead, e.g. a mounted secret.
+type APIKey struct {
+	Name              string `mapstructure:"name"`
+	Key               string `mapstructure:"key" secret:"true"`
+	KeyFile           string `mapstructure:"key_file"`
+	RequestsPerMinute int    `mapstructure:"requests_per_minute"`
+	BurstSize         int    `mapstructure:"burst_size"`
+}
+
+// AuditConfig controls the persistent audit log. An empty Path disables it.
+type AuditConfig struct {
+	Path  string `mapstructure:"path"`
+	Fsync bool   `mapstructure:"fsync"`
+}
+
+// StatsConfig controls persistence of the runtime statistics reported by
+// get_stats. With an empty Path they are kept in memory and reset on restart.
+type StatsConfig struct {
+	Path          string        `mapstructure:"path"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// HistoryConfig controls the scan history store. An empty DSN disables it.
+// For the sqlite driver the DSN is a file path; for postgres it is a
+// connection URL, which may carry a password.
+type HistoryConfig struct {
+	Driver    string        `mapstructure:"driver"`
+	DSN       string        `mapstructure:"dsn" secret:"true"`
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// PeerSyncConfig shares the reputation accumulated in the scan history with
+// other instances. When Token is set, the domains, and with ShareSenders the
+// sender addresses, and campaign fingerprints seen over the last Window are
+// served to peers presenting Token as a bearer token, at most MaxEntries of
+// each, the most scanned first. Each of Peers is fetched right away and then
+// every Interval; fetches are bounded by Timeout and MaxSize. Data from a
+// peer that could not be fetched for longer than Window is discarded.
+type PeerSyncConfig struct {
+	Token        string        `mapstructure:"token" secret:"true"`
+	Window       time.Duration `mapstructure:"window"`
+	ShareSenders bool          `mapstructure:"share_senders"`
+	MaxEntries   int           `mapstructure:"max_entries"`
+	Peers        []PeerConfig  `mapstructure:"peers"`
+	Interval     time.Duration `mapstructure:"interval"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxSize      int64         `mapstructure:"max_size"`
+}
+
+// PeerConfig is another instance whose reputation is fetched from URL, its
+// HTTP transport's base URL, with Token, the peer's peer_sync.token. Name
+// identifies the peer in results.
+type PeerConfig struct {
+	Name  string `mapstructure:"name"`
+	URL   string `mapstructure:"url"`
+	Token string `mapstructure:"token" secret:"true"`
+}
+
+// QuarantineConfig controls the quarantine store, which keeps the full
+// content of scanned messages scoring at least MinScore in Dir so analysts
+// can review them. An empty Dir disables it; a MinScore of 0 quarantines
+// every message classified as spam. Messages and their metadata are
+// encrypted with AES-256-GCM under Key, 32 random bytes encoded in base64.
+// Messages held longer than Retention are deleted; 0 keeps them until they
+// are deleted by hand.
+type QuarantineConfig struct {
+	Dir       string        `mapstructure:"dir"`
+	Key       string        `mapstructure:"key" secret:"true"`
+	MinScore  float64       `mapstructure:"min_score"`
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// CorpusConfig locates the labeled corpus run_regression and tune_threshold
+// scan: a directory with ham and spam subdirectories of one message per
+// file. An empty Path disables it. MaxMessages bounds the size of the corpus.
+type CorpusConfig struct {
+	Path        string `mapstructure:"path"`
+	MaxMessages int    `mapstructure:"max_messages"`
+}
+
+// IMAPConfig is the mailbox scan_mailbox reads. An empty Addr disables it.
+// TLS is "implicit" (IMAPS, usually port 993), "starttls" or "none"; without
+// TLS the password would cross the network in clear, so "none" is accepted
+// only for a server on the loopback interface. CAFile replaces the system
+// roots for verifying the server. MaxMessages bounds the messages one call
+// scans.
+type IMAPConfig struct {
+	Addr        string        `mapstructure:"addr"`
+	TLS         string        `mapstructure:"tls"`
+	CAFile      string        `mapstructure:"ca_file"`
+	Username    string        `mapstructure:"username"`
+	Password    string        `mapstructure:"password" secret:"true"`
+	Folder      string        `mapstructure:"folder"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	MaxMessages int           `mapstructure:"max_messages"`
+}
+
+// POP3Config is the maildrop scan_mailbox reads over POP3, for servers
+// without IMAP. An empty Addr disables it. The settings are those of
+// IMAPConfig; POP3 has a single maildrop, so there is no folder.
+type POP3Config struct {
+	Addr        string        `mapstructure:"addr"`
+	TLS         string        `mapstructure:"tls"`
+	CAFile      string        `mapstructure:"ca_file"`
+	Username    string        `mapstructure:"username"`
+	Password    string        `mapstructure:"password" secret:"true"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	MaxMessages int           `mapstructure:"max_messages"`
+}
+
+// MaildirWatchConfig controls the Maildir watcher, which scans messages as
+// they are delivered to the new/ directory of Dir and records the verdicts
+// in the scan history. An empty Dir disables it. File events are used when
+// the platform offers them, and new/ is also listed every PollInterval in
+// case events are missed. Verdicts scoring NotifyScore or more are sent as
+// notifications; zero means the spam threshold. Messages already in new/ at
+// startup are scanned only with ScanExisting.
+type MaildirWatchConfig struct {
+	Dir          string        `mapstructure:"dir"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Profile      string        `mapstructure:"profile"`
+	NotifyScore  float64       `mapstructure:"notify_score"`
+	ScanExisting bool          `mapstructure:"scan_existing"`
+}
+
+// ObjectStoreConfig is the S3-compatible storage scan_object reads. An empty
+// Endpoint disables it. Only the listed buckets can be read, and within each
+// only keys under one of its prefixes. The credentials should allow nothing
+// but reading those buckets. Plain http is accepted only for a server on the
+// loopback interface. PathStyle addresses buckets as endpoint/bucket, as
+// MinIO expects, rather than as bucket.endpoint. MaxObjectSize bounds the
+// objects fetched and MaxMessages the messages of an mbox one call scans.
+type ObjectStoreConfig struct {
+	Endpoint        string         `mapstructure:"endpoint"`
+	Region          string         `mapstructure:"region"`
+	PathStyle       bool           `mapstructure:"path_style"`
+	CAFile          string         `mapstructure:"ca_file"`
+	AccessKeyID     string         `mapstructure:"access_key_id"`
+	SecretAccessKey string         `mapstructure:"secret_access_key" secret:"true"`
+	SessionToken    string         `mapstructure:"session_token" secret:"true"`
+	Buckets         []ObjectBucket `mapstructure:"buckets"`
+	Timeout         time.Duration  `mapstructure:"timeout"`
+	MaxObjectSize   int64          `mapstructure:"max_object_size"`
+	MaxMessages     int            `mapstructure:"max_messages"`
+}
+
+// ObjectBucket is a bucket scan_object may read. Without Prefixes the whole
+// bucket can be read.
+type ObjectBucket struct {
+	Name     string   `mapstructure:"name"`
+	Prefixes []string `mapstructure:"prefixes"`
+}
+
+// Allows reports whether key may be read from the bucket.
+func (b ObjectBucket) Allows(key string) bool {
+	if len(b.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range b.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentRefsConfig controls where scan_email may fetch a message given by
+// content_ref instead of content. Dirs are the directories local files may
+// be read from; AllowedHosts the hosts https URLs may point at, by exact
+// name or, with a leading "*.", any subdomain. With neither, content_ref is
+// refused. CAFile replaces the system roots for verifying those hosts, and
+// Timeout bounds one fetch. Messages are bound by security.max_email_size.
+type ContentRefsConfig struct {
+	Dirs         []string      `mapstructure:"dirs"`
+	AllowedHosts []string      `mapstructure:"allowed_hosts"`
+	CAFile       string        `mapstructure:"ca_file"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+}
+
+// MISPConfig is the MISP instance publish_iocs creates events in. An empty
+// URL disables it. Events are tagged with the TLP level and Tags, shared
+// with Distribution (0 your organisation only, 1 this community, 2
+// connected communities, 3 all communities) and rated ThreatLevel (1 high
+// to 4 undefined). Callers may raise the TLP level of an event but not
+// lower it. With Publish, events are published once created; ToIDS flags
+// the attributes for export to intrusion detection systems.
+type MISPConfig struct {
+	URL          string        `mapstructure:"url"`
+	APIKey       string        `mapstructure:"api_key" secret:"true"`
+	CAFile       string        `mapstructure:"ca_file"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	TLP          string        `mapstructure:"tlp"`
+	Tags         []string      `mapstructure:"tags"`
+	Distribution int           `mapstructure:"distribution"`
+	ThreatLevel  int           `mapstructure:"threat_level"`
+	Publish      bool          `mapstructure:"publish"`
+	ToIDS        bool          `mapstructure:"to_ids"`
+}
+
+// TAXIIConfig is the TAXII 2.1 collection the indicators of spam verdicts
+// are published to. An empty APIRoot disables it. The URLs, link domains
+// and attachment hashes of spam messages are accumulated and published
+// every Interval as STIX 2.1 indicators, once their confidence reaches
+// MinConfidence; indicators are sent again only when their confidence
+// rises. Domains in ExcludeDomains, and their subdomains, are never
+// published. At most MaxIndicators are tracked. Username and Password
+// authenticate with HTTP Basic, Token as a bearer token.
+type TAXIIConfig struct {
+	APIRoot        string        `mapstructure:"api_root"`
+	CollectionID   string        `mapstructure:"collection_id"`
+	Username       string        `mapstructure:"username"`
+	Password       string        `mapstructure:"password" secret:"true"`
+	Token          string        `mapstructure:"token" secret:"true"`
+	CAFile         string        `mapstructure:"ca_file"`
+	Interval       time.Duration `mapstructure:"interval"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	MinConfidence  int           `mapstructure:"min_confidence"`
+	ExcludeDomains []string      `mapstructure:"exclude_domains"`
+	MaxIndicators  int           `mapstructure:"max_indicators"`
+}
+
+// AbuseIPDBConfig enables AbuseIPDB lookups of the IP address passed to
+// check_reputation. An empty APIKey disables them. Reports older than
+// MaxAgeDays are not counted by AbuseIPDB. Results are cached for CacheTTL,
+// for at most CacheSize addresses, so repeated checks do not use up the
+// daily quota of the key.
+type AbuseIPDBConfig struct {
+	APIKey     string        `mapstructure:"api_key" secret:"true"`
+	URL        string        `mapstructure:"url"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	MaxAgeDays int           `mapstructure:"max_age_days"`
+	CacheTTL   time.Duration `mapstructure:"cache_ttl"`
+	CacheSize  int           `mapstructure:"cache_size"`
+}
+
+// RDAPConfig enables RDAP lookups of the registration date of the sender
+// domain in check_reputation. The RDAP server of each top-level domain is
+// taken from the IANA bootstrap registry at BootstrapURL. Domains
+// registered less than NewDomainDays ago make an otherwise unknown
+// reputation bad. Results are cached for CacheTTL, for at most CacheSize
+// domains, since registration dates rarely change and registries limit
+// query rates.
+type RDAPConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	BootstrapURL  string        `mapstructure:"bootstrap_url"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+	NewDomainDays int           `mapstructure:"new_domain_days"`
+	CacheTTL      time.Duration `mapstructure:"cache_ttl"`
+	CacheSize     int           `mapstructure:"cache_size"`
+}
+
+// GeoIPConfig names the MaxMind DB files, such as GeoLite2-Country.mmdb and
+// GeoLite2-ASN.mmdb, that analyze_headers locates the Received hops and the
+// originating IP with. Either may be left empty; with neither, hops are not
+// located.
+type GeoIPConfig struct {
+	CountryDB string `mapstructure:"country_db"`
+	ASNDB     string `mapstructure:"asn_db"`
+}
+
+// BIMIConfig controls check_bimi. With FetchVMC set, the Verified Mark
+// Certificate a BIMI record references is downloaded and validated; each
+// download is bounded by Timeout.
+type BIMIConfig struct {
+	FetchVMC bool          `mapstructure:"fetch_vmc"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// VirusTotalConfig enables VirusTotal lookups of attachment hashes and URLs
+// in analyze_attachments and extract_urls, which callers request per call.
+// An empty APIKey disables them. Only existing reports are read; nothing is
+// uploaded or submitted. At most MaxLookups uncached lookups are made per
+// call, and reports are cached for CacheTTL, for at most CacheSize hashes
+// and URLs, to stay within the quota of the key.
+type VirusTotalConfig struct {
+	APIKey     string        `mapstructure:"api_key" secret:"true"`
+	URL        string        `mapstructure:"url"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	MaxLookups int           `mapstructure:"max_lookups"`
+	CacheTTL   time.Duration `mapstructure:"cache_ttl"`
+	CacheSize  int           `mapstructure:"cache_size"`
+}
+
+// UnshortenConfig controls the unshorten option of extract_urls, which
+// follows the redirects of URL shortener links to report where they lead.
+// It is disabled by default, since following a link can tell its sender
+// that the message was looked at. Only HEAD requests are made, only to
+// public addresses, and each link is given Timeout to resolve; at most
+// MaxRedirects redirects are followed per link and MaxURLs links resolved
+// per call. Shorteners adds domains to the built-in list of shorteners.
+type UnshortenConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxRedirects int           `mapstructure:"max_redirects"`
+	MaxURLs      int           `mapstructure:"max_urls"`
+	Shorteners   []string      `mapstructure:"shorteners"`
+}
+
+// OCRConfig controls the ocr option of scan_email and detect_phishing,
+// which reads the text of the images of image-only messages with the
+// tesseract binary Tesseract, in the tesseract Languages, and scans it with
+// the message. It is disabled by default. Each image is given Timeout and
+// the images of a message Budget in all; at most MaxImages images of up to
+// MaxPixels pixels are read per message.
+type OCRConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Tesseract string        `mapstructure:"tesseract"`
+	Languages []string      `mapstructure:"languages"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	Budget    time.Duration `mapstructure:"budget"`
+	MaxImages int           `mapstructure:"max_images"`
+	MaxPixels int           `mapstructure:"max_pixels"`
+}
+
+// URLFeedsConfig is the URLhaus and PhishTank datasets URLs are checked
+// against in scan_email and extract_urls. Each feed is downloaded from URL,
+// read from the local file at Path, or both, in which case the file is a
+// mirror of the download that is loaded at startup and replaced by each
+// download. A feed with neither is disabled. Feeds are refreshed every
+// Refresh; downloads are bounded by Timeout and, like files, by MaxSize.
+type URLFeedsConfig struct {
+	URLhaus   URLFeedSource `mapstructure:"urlhaus"`
+	PhishTank URLFeedSource `mapstructure:"phishtank"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	MaxSize   int64         `mapstructure:"max_size"`
+}
+
+// HomoglyphConfig lists the brands detect_homoglyphs protects. A domain
+// that looks like one of a brand's domains once confusable characters are
+// normalized, or a display name, subject or link text that spells its name
+// with confusable characters, is reported as imitating the brand. Domains
+// are registrable domains in ASCII (punycode) form.
+type HomoglyphConfig struct {
+	ProtectedBrands []ProtectedBrand `mapstructure:"protected_brands"`
+}
+
+// ProtectedBrand is a brand detect_homoglyphs protects and the domains it
+// legitimately uses.
+type ProtectedBrand struct {
+	Name    string   `mapstructure:"name"`
+	Domains []string `mapstructure:"domains"`
+}
+
+// URLFeedSource is where one URL feed is read from. URL is a secret because
+// PhishTank download URLs carry the application key.
+type URLFeedSource struct {
+	URL     string        `mapstructure:"url" secret:"true"`
+	Path    string        `mapstructure:"path"`
+	Refresh time.Duration `mapstructure:"refresh"`
+}
+
+// Enabled reports whether the feed has a source.
+func (s URLFeedSource) Enabled() bool {
+	return s.URL != "" || s.Path != ""
+}
+
+// ClamAVConfig connects to a clamd daemon that scans the decoded attachments
+// of scan_attachments_av and scan_email calls. Network is tcp or unix; an
+// empty Address disables it. Each attachment is streamed with INSTREAM, so
+// clamd needs no access to the files; attachments larger than MaxSize, which
+// should not exceed clamd's StreamMaxLength, are not scanned. Timeout bounds
+// the scans of one message.
+type ClamAVConfig struct {
+	Network string        `mapstructure:"network"`
+	Address string        `mapstructure:"address"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	MaxSize int64         `mapstructure:"max_size"`
+}
+
+// Enabled reports whether a clamd daemon is configured.
+func (c ClamAVConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// RspamdConfig is the rspamd worker compare_engines scans messages with,
+// such as http://127.0.0.1:11333; an empty URL disables it. Password is
+// sent when the worker requires one. Timeout bounds each scan.
+type RspamdConfig struct {
+	URL      string        `mapstructure:"url"`
+	Password string        `mapstructure:"password" secret:"true"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// TLPLevels are the Traffic Light Protocol 2.0 levels, least restrictive
+// first.
+var TLPLevels = []string{"clear", "green", "amber", "amber+strict", "red"}
+
+// WelcomelistConfig controls the sender welcomelist managed with the
+// welcomelist tools. Entries are saved to the JSON file at Path; an empty
+// Path keeps them in memory until restart. When LocalCF is set, they are also
+// written there as Directive lines (welcomelist_from, or whitelist_from for
+// SpamAssassin before 4.0).
+type WelcomelistConfig struct {
+	Path      string `mapstructure:"path"`
+	LocalCF   string `mapstructure:"local_cf"`
+	Directive string `mapstructure:"directive"`
+}
+
+// BlocklistConfig controls the blocklist managed with the blocklist tools,
+// like WelcomelistConfig. Directive is blocklist_from, or blacklist_from for
+// SpamAssassin before 4.0.
+type BlocklistConfig struct {
+	Path      string `mapstructure:"path"`
+	LocalCF   string `mapstructure:"local_cf"`
+	Directive string `mapstructure:"directive"`
+}
+
+// BayesConfig controls how bayes_status reads the Bayes database, and the
+// bayes_expire scheduled job expires it, with sa-learn. DBPath is passed as --dbpath and is only needed when spamd's
+// database is not the one sa-learn finds for the server's user. MinSpam and
+// MinHam must match SpamAssassin's bayes_min_spam_num and bayes_min_ham_num.
+// ImportDirs are the directories import_corpus may read corpora from; none
+// allows only uploaded archives. ImportMaxMessages and ImportMaxSize bound
+// the messages and decompressed bytes of one imported corpus.
+type BayesConfig struct {
+	SaLearn           string        `mapstructure:"sa_learn"`
+	DBPath            string        `mapstructure:"db_path"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+	MinSpam           int           `mapstructure:"min_spam"`
+	MinHam            int           `mapstructure:"min_ham"`
+	ImportDirs        []string      `mapstructure:"import_dirs"`
+	ImportMaxMessages int           `mapstructure:"import_max_messages"`
+	ImportMaxSize     int64         `mapstructure:"import_max_size"`
+}
+
+// RuleUpdatesConfig controls how update_rules runs sa-update. Channels are
+// the update channels it may fetch; GPGKeys are the IDs of the keys trusted
+// to sign them, in addition to the SpamAssassin project key sa-update
+// trusts by default, and GPGHomedir the keyring holding them. VerifyGPG
+// false skips signature verification and is only meant for testing. An
+// empty UpdateDir uses sa-update's default directory.
+type RuleUpdatesConfig struct {
+	SaUpdate   string        `mapstructure:"sa_update"`
+	Channels   []string      `mapstructure:"channels"`
+	GPGKeys    []string      `mapstructure:"gpg_keys"`
+	GPGHomedir string        `mapstructure:"gpg_homedir"`
+	VerifyGPG  bool          `mapstructure:"verify_gpg"`
+	UpdateDir  string        `mapstructure:"update_dir"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// SchedulerConfig lists the maintenance jobs run on a schedule. None runs
+// without jobs.
+type SchedulerConfig struct {
+	Jobs []ScheduledJob `mapstructure:"jobs"`
+}
+
+// Tasks a scheduled job can run.
+const (
+	TaskUpdateRules  = "update_rules"
+	TaskBayesExpire  = "bayes_expire"
+	TaskPruneCaches  = "prune_caches"
+	TaskPruneHistory = "prune_history"
+)
+
+var scheduledTasks = []string{TaskUpdateRules, TaskBayesExpire, TaskPruneCaches, TaskPruneHistory}
+
+// ScheduledJob runs Task whenever the cron expression Schedule fires, in
+// UTC. MaxAge applies to prune_history, which deletes the history entries
+// older than it, or than history.retention when it is 0.
+type ScheduledJob struct {
+	Name     string        `mapstructure:"name"`
+	Task     string        `mapstructure:"task"`
+	Schedule string        `mapstructure:"schedule"`
+	MaxAge   time.Duration `mapstructure:"max_age"`
+}
+
+// SpamdReloadConfig controls what happens once changed rules are installed
+// and pass lint. Compile runs SaCompile so spamd loads them compiled. Method
+// selects how spamd is told to reload: "none" leaves it to the operator,
+// "signal" sends SIGHUP to the process in PIDFile and "command" runs Command,
+// e.g. a supervisor's reload command. Timeout bounds each step, including
+// waiting for spamd to answer again.
+type SpamdReloadConfig struct {
+	Compile   bool          `mapstructure:"compile"`
+	SaCompile string        `mapstructure:"sa_compile"`
+	Method    string        `mapstructure:"method"`
+	PIDFile   string        `mapstructure:"pid_file"`
+	Command   []string      `mapstructure:"command"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// RuleDeploymentConfig controls deploy_rules. Dir keeps every deployed
+// version of the managed rules, up to Keep of them; the active version is
+// copied to File, a rule file in the site configuration directory spamd
+// loads. HamSample is a message file that must still scan as ham after a
+// deployment; empty uses a built-in message. An empty Dir disables
+// deploy_rules.
+type RuleDeploymentConfig struct {
+	Dir       string `mapstructure:"dir"`
+	File      string `mapstructure:"file"`
+	Keep      int    `mapstructure:"keep"`
+	HamSample string `mapstructure:"ham_sample"`
+}
+
+// DNSConfig selects the resolver used by the sender authentication checks.
+// An empty Server uses the system resolver. Timeout bounds the lookups of
+// one check. URIBLZones are the URI blocklists queried for the domains of
+// extracted URLs and DNSBLZones the IP blocklists queried for sender
+// addresses. With a SpamhausDQSKey, Spamhaus zones are queried through the
+// Data Query Service rather than the public mirrors.
+type DNSConfig struct {
+	Server         string        `mapstructure:"server"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	URIBLZones     []string      `mapstructure:"uribl_zones"`
+	DNSBLZones     []string      `mapstructure:"dnsbl_zones"`
+	SpamhausDQSKey string        `mapstructure:"spamhaus_dqs_key" secret:"true"`
+}
+
+// RedactionConfig selects the personal data masked before log entries and
+// audit records are written.
+type RedactionConfig struct {
+	Emails bool `mapstructure:"emails"`
+	Bodies bool `mapstructure:"bodies"`
+	IPs    bool `mapstructure:"ips"`
+}
+
+// LoggingConfig selects where log entries are written. Stdout, a rotating
+// file and syslog may be enabled in any combination.
+type LoggingConfig struct {
+	Stdout bool          `mapstructure:"stdout"`
+	File   LogFileConfig `mapstructure:"file"`
+	Syslog SyslogConfig  `mapstructure:"syslog"`
+}
+
+// LogFileConfig writes logs to a local file, rotated once it reaches
+// MaxSizeMB. An empty Path disables it.
+type LogFileConfig struct {
+	Path       string `mapstructure:"path"`
+	MaxSizeMB  int    `mapstructure:"max_size_mb"`
+	MaxBackups int    `mapstructure:"max_backups"`
+}
+
+// SIEMConfig exports every scan verdict to a SIEM collector as a CEF or LEEF
+// event carried in an RFC 5424 syslog message. An empty Address disables it.
+// Network is udp, tcp or tls; stream connections separate messages with a
+// newline, as Splunk and QRadar syslog inputs expect. Fields maps verdict
+// fields to event keys, overriding the format's defaults; an empty key
+// leaves the field out. Events are queued and sent in the background, and
+// dropped when QueueSize events are already waiting.
+type SIEMConfig struct {
+	Format    string            `mapstructure:"format"`
+	Network   string            `mapstructure:"network"`
+	Address   string            `mapstructure:"address"`
+	CAFile    string            `mapstructure:"ca_file"`
+	Facility  string            `mapstructure:"facility"`
+	AppName   string            `mapstructure:"app_name"`
+	Fields    map[string]string `mapstructure:"fields"`
+	QueueSize int               `mapstructure:"queue_size"`
+}
+
+// SIEMFields are the verdict fields a SIEM event can carry.
+var SIEMFields = []string{
+	"time", "verdict", "severity", "score", "threshold", "rules", "tags",
+	"profile", "user", "hash", "sender", "message_id", "subject",
+}
+
+// siemKeyRegex matches the keys CEF and LEEF allow in event attributes.
+var siemKeyRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// syslogFacilities are the facility names syslog senders accept.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp",
+	"cron", "authpriv", "ftp", "local0", "local1", "local2", "local3",
+	"local4", "local5", "local6", "local7",
+}
+
+// SyslogConfig sends logs to a syslog server as RFC 5424 messages. Network
+// is udp, tcp or unix; an empty Address disables it.
+type SyslogConfig struct {
+	Network  string `mapstructure:"network"`
+	Address  string `mapstructure:"address"`
+	Facility string `mapstructure:"facility"`
+	AppName  string `mapstructure:"app_name"`
+}
+
+// Enabled reports whether a syslog server is configured.
+func (s SyslogConfig) Enabled() bool {
+	return s.Address != ""
+}
+
+// RateLimit is the global budget shared by all clients, enforced unless
+// Disabled is set. PerClient and Tools add budgets for each client.
 type RateLimit struct {
+	Disabled          bool `mapstructure:"disabled"`
 	RequestsPerMinute int `mapstructure:"requests_per_minute"`
 	BurstSize        int `mapstructure:"burst_size"`
+	PerClient        ClientRateLimit `mapstructure:"per_client"`
+	Tools            map[string]ToolRateLimit `mapstructure:"tools"`
+}
+
+// ToolRateLimit is an additional budget each client has for one tool, on
+// top of the global and per-client budgets. DailyQuota caps the client's
+// calls per UTC day; zero means unlimited.
+type ToolRateLimit struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	BurstSize         int `mapstructure:"burst_size"`
+	DailyQuota        int `mapstructure:"daily_quota"`
+}
+
+// ClientRateLimit is the budget applied to each client individually, keyed by
+// API key or client certificate when present, else by remote IP on the HTTP
+// transport and by MCP session otherwise. Like RateLimit, it is enforced
+// unless Disabled is set.
+type ClientRateLimit struct {
+	Disabled          bool          `mapstructure:"disabled"`
+	RequestsPerMinute int           `mapstructure:"requests_per_minute"`
+	BurstSize         int           `mapstructure:"burst_size"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+}
+
+// configFile is the file set with SetFile, if any.
+var configFile string
+
+// SetFile makes Load read the configuration from path instead of searching
+// for config.yaml in the working directory and /etc/spamassassin-mcp. The
+// file must then exist. Without SetFile, SA_MCP_CONFIG_FILE names the file.
+func SetFile(path string) {
+	configFile = path
 }
 
 func Load() (*Config, error) {
 	viper.SetDefault("server.bind_addr", "0.0.0.0:8080")
 	viper.SetDefault("server.timeout", "30s")
+	viper.SetDefault("server.shutdown_timeout", "30s")
 	viper.SetDefault("spamassassin.host", "localhost")
 	viper.SetDefault("spamassassin.port", 783)
 	viper.SetDefault("spamassassin.timeout", "30s")
 	viper.SetDefault("spamassassin.threshold", 5.0)
+	viper.SetDefault("spamassassin.rules_dirs", []string{"/etc/spamassassin", "/var/lib/spamassassin"})
+	viper.SetDefault("spamassassin.max_concurrent_scans", 5)
+	viper.SetDefault("spamassassin.queue_timeout", "10s")
+	viper.SetDefault("spamassassin.binary", "spamassassin")
+	viper.SetDefault("spamassassin.sandbox_timeout", "60s")
+	viper.SetDefault("spamassassin.compress", false)
+	viper.SetDefault("spamassassin.allowed_users", []string{})
+	viper.SetDefault("spamassassin.collaborative_filters.enabled_user", "")
+	viper.SetDefault("spamassassin.collaborative_filters.disabled_user", "")
+	viper.SetDefault("spamassassin.threshold_min", 1.0)
+	viper.SetDefault("spamassassin.threshold_max", 20.0)
 	viper.SetDefault("security.max_email_size", 10*1024*1024) // 10MB
+	viper.SetDefault("security.rate_limiting.disabled", false)
 	viper.SetDefault("security.rate_limiting.requests_per_minute", 60)
 	viper.SetDefault("security.rate_limiting.burst_size", 10)
+	viper.SetDefault("security.rate_limiting.per_client.disabled", false)
+	viper.SetDefault("security.rate_limiting.per_client.requests_per_minute", 30)
+	viper.SetDefault("security.rate_limiting.per_client.burst_size", 5)
+	viper.SetDefault("security.rate_limiting.per_client.idle_timeout", "10m")
 	viper.SetDefault("security.scan_timeout", "60s")
 	viper.SetDefault("security.validation_enabled", true)
+	viper.SetDefault("async_scan.enabled", true)
+	viper.SetDefault("async_scan.size_threshold", 5*1024*1024) // 5MB
+	viper.SetDefault("async_scan.workers", 2)
+	viper.SetDefault("async_scan.queue_size", 20)
+	viper.SetDefault("async_scan.result_ttl", "15m")
+	viper.SetDefault("server.admin.bind_addr", "0.0.0.0:8081")
+	viper.SetDefault("server.admin.probe_interval", "15s")
+	viper.SetDefault("server.admin.probe_timeout", "5s")
+	viper.SetDefault("server.tls.cert_file", "")
+	viper.SetDefault("server.tls.key_file", "")
+	viper.SetDefault("server.tls.client_ca_file", "")
+	viper.SetDefault("auth.api_key", "")
+	viper.SetDefault("auth.api_keys_file", "")
+	viper.SetDefault("auth.oidc.issuer", "")
+	viper.SetDefault("auth.oidc.audience", "")
+	viper.SetDefault("auth.oidc.jwks_url", "")
+	viper.SetDefault("auth.oidc.jwks_refresh_interval", "1h")
+	viper.SetDefault("audit.path", "")
+	viper.SetDefault("audit.fsync", false)
+	viper.SetDefault("stats.path", "")
+	viper.SetDefault("stats.flush_interval", "1m")
+	viper.SetDefault("history.driver", "sqlite")
+	viper.SetDefault("history.dsn", "")
+	viper.SetDefault("history.retention", "720h")
+	viper.SetDefault("peer_sync.token", "")
+	viper.SetDefault("peer_sync.window", "168h")
+	viper.SetDefault("peer_sync.share_senders", false)
+	viper.SetDefault("peer_sync.max_entries", 10000)
+	viper.SetDefault("peer_sync.interval", "15m")
+	viper.SetDefault("peer_sync.timeout", "30s")
+	viper.SetDefault("peer_sync.max_size", 16<<20)
+	viper.SetDefault("quarantine.dir", "")
+	viper.SetDefault("quarantine.key", "")
+	viper.SetDefault("quarantine.min_score", 0)
+	viper.SetDefault("quarantine.retention", "720h")
+	viper.SetDefault("corpus.path", "")
+	viper.SetDefault("corpus.max_messages", 1000)
+	viper.SetDefault("imap.addr", "")
+	viper.SetDefault("imap.tls", "implicit")
+	viper.SetDefault("imap.ca_file", "")
+	viper.SetDefault("imap.username", "")
+	viper.SetDefault("imap.password", "")
+	viper.SetDefault("imap.folder", "INBOX")
+	viper.SetDefault("imap.timeout", "30s")
+	viper.SetDefault("imap.max_messages", 100)
+	viper.SetDefault("pop3.addr", "")
+	viper.SetDefault("pop3.tls", "implicit")
+	viper.SetDefault("pop3.ca_file", "")
+	viper.SetDefault("pop3.username", "")
+	viper.SetDefault("pop3.password", "")
+	viper.SetDefault("pop3.timeout", "30s")
+	viper.SetDefault("pop3.max_messages", 100)
+	viper.SetDefault("maildir_watch.dir", "")
+	viper.SetDefault("maildir_watch.poll_interval", "30s")
+	viper.SetDefault("maildir_watch.profile", "")
+	viper.SetDefault("maildir_watch.notify_score", 0)
+	viper.SetDefault("maildir_watch.scan_existing", false)
+	viper.SetDefault("object_store.endpoint", "")
+	viper.SetDefault("object_store.region", "us-east-1")
+	viper.SetDefault("object_store.path_style", false)
+	viper.SetDefault("object_store.ca_file", "")
+	viper.SetDefault("object_store.access_key_id", "")
+	viper.SetDefault("object_store.secret_access_key", "")
+	viper.SetDefault("object_store.session_token", "")
+	viper.SetDefault("object_store.buckets", []ObjectBucket{})
+	viper.SetDefault("object_store.timeout", "30s")
+	viper.SetDefault("object_store.max_object_size", 50*1024*1024) // 50MB
+	viper.SetDefault("object_store.max_messages", 100)
+	viper.SetDefault("content_refs.dirs", []string{})
+	viper.SetDefault("content_refs.allowed_hosts", []string{})
+	viper.SetDefault("content_refs.ca_file", "")
+	viper.SetDefault("content_refs.timeout", "30s")
+	viper.SetDefault("misp.url", "")
+	viper.SetDefault("misp.api_key", "")
+	viper.SetDefault("misp.ca_file", "")
+	viper.SetDefault("misp.timeout", "30s")
+	viper.SetDefault("misp.tlp", "amber")
+	viper.SetDefault("misp.tags", []string{})
+	viper.SetDefault("misp.distribution", 0)
+	viper.SetDefault("misp.threat_level", 3)
+	viper.SetDefault("misp.publish", false)
+	viper.SetDefault("misp.to_ids", false)
+	viper.SetDefault("taxii.api_root", "")
+	viper.SetDefault("taxii.collection_id", "")
+	viper.SetDefault("taxii.username", "")
+	viper.SetDefault("taxii.password", "")
+	viper.SetDefault("taxii.token", "")
+	viper.SetDefault("taxii.ca_file", "")
+	viper.SetDefault("taxii.interval", "1h")
+	viper.SetDefault("taxii.timeout", "30s")
+	viper.SetDefault("taxii.min_confidence", 50)
+	viper.SetDefault("taxii.exclude_domains", []string{})
+	viper.SetDefault("taxii.max_indicators", 10000)
+	viper.SetDefault("abuseipdb.api_key", "")
+	viper.SetDefault("abuseipdb.url", "https://api.abuseipdb.com/api/v2")
+	viper.SetDefault("abuseipdb.timeout", "10s")
+	viper.SetDefault("abuseipdb.max_age_days", 90)
+	viper.SetDefault("abuseipdb.cache_ttl", "24h")
+	viper.SetDefault("abuseipdb.cache_size", 10000)
+	viper.SetDefault("rdap.enabled", false)
+	viper.SetDefault("rdap.bootstrap_url", "https://data.iana.org/rdap/dns.json")
+	viper.SetDefault("rdap.timeout", "10s")
+	viper.SetDefault("rdap.new_domain_days", 30)
+	viper.SetDefault("rdap.cache_ttl", "24h")
+	viper.SetDefault("rdap.cache_size", 10000)
+	viper.SetDefault("geoip.country_db", "")
+	viper.SetDefault("geoip.asn_db", "")
+	viper.SetDefault("bimi.fetch_vmc", true)
+	viper.SetDefault("bimi.timeout", "10s")
+	viper.SetDefault("virustotal.api_key", "")
+	viper.SetDefault("virustotal.url", "https://www.virustotal.com/api/v3")
+	viper.SetDefault("virustotal.timeout", "15s")
+	viper.SetDefault("virustotal.max_lookups", 4)
+	viper.SetDefault("virustotal.cache_ttl", "24h")
+	viper.SetDefault("virustotal.cache_size", 10000)
+	viper.SetDefault("unshorten.enabled", false)
+	viper.SetDefault("unshorten.timeout", "5s")
+	viper.SetDefault("unshorten.max_redirects", 5)
+	viper.SetDefault("unshorten.max_urls", 10)
+	viper.SetDefault("unshorten.shorteners", []string{})
+	viper.SetDefault("ocr.enabled", false)
+	viper.SetDefault("ocr.tesseract", "tesseract")
+	viper.SetDefault("ocr.languages", []string{"eng"})
+	viper.SetDefault("ocr.timeout", "10s")
+	viper.SetDefault("ocr.budget", "30s")
+	viper.SetDefault("ocr.max_images", 5)
+	viper.SetDefault("ocr.max_pixels", 16000000)
+	viper.SetDefault("url_feeds.urlhaus.url", "")
+	viper.SetDefault("url_feeds.urlhaus.path", "")
+	viper.SetDefault("url_feeds.urlhaus.refresh", "1h")
+	viper.SetDefault("url_feeds.phishtank.url", "")
+	viper.SetDefault("url_feeds.phishtank.path", "")
+	viper.SetDefault("url_feeds.phishtank.refresh", "1h")
+	viper.SetDefault("url_feeds.timeout", "2m")
+	viper.SetDefault("url_feeds.max_size", 256*1024*1024) // 256MB
+	viper.SetDefault("homoglyph.protected_brands", []ProtectedBrand{})
+	viper.SetDefault("clamav.network", "tcp")
+	viper.SetDefault("clamav.address", "")
+	viper.SetDefault("clamav.timeout", "30s")
+	viper.SetDefault("clamav.max_size", 25*1024*1024) // 25MB, clamd's default StreamMaxLength
+	viper.SetDefault("rspamd.url", "")
+	viper.SetDefault("rspamd.password", "")
+	viper.SetDefault("rspamd.timeout", "30s")
+	viper.SetDefault("welcomelist.path", "")
+	viper.SetDefault("welcomelist.local_cf", "")
+	viper.SetDefault("welcomelist.directive", "welcomelist_from")
+	viper.SetDefault("blocklist.path", "")
+	viper.SetDefault("blocklist.local_cf", "")
+	viper.SetDefault("blocklist.directive", "blocklist_from")
+	viper.SetDefault("bayes.sa_learn", "sa-learn")
+	viper.SetDefault("bayes.db_path", "")
+	viper.SetDefault("bayes.timeout", "30s")
+	viper.SetDefault("bayes.min_spam", 200)
+	viper.SetDefault("bayes.min_ham", 200)
+	viper.SetDefault("bayes.import_dirs", []string{})
+	viper.SetDefault("bayes.import_max_messages", 10000)
+	viper.SetDefault("bayes.import_max_size", 100*1024*1024) // 100MB
+	viper.SetDefault("rule_updates.sa_update", "sa-update")
+	viper.SetDefault("rule_updates.channels", []string{"updates.spamassassin.org"})
+	viper.SetDefault("rule_updates.gpg_keys", []string{})
+	viper.SetDefault("rule_updates.gpg_homedir", "")
+	viper.SetDefault("rule_updates.verify_gpg", true)
+	viper.SetDefault("rule_updates.update_dir", "")
+	viper.SetDefault("rule_updates.timeout", "10m")
+
+	viper.SetDefault("scheduler.jobs", []ScheduledJob{})
+
+	viper.SetDefault("spamd_reload.compile", false)
+	viper.SetDefault("spamd_reload.sa_compile", "sa-compile")
+	viper.SetDefault("spamd_reload.method", "none")
+	viper.SetDefault("spamd_reload.pid_file", "/var/run/spamd.pid")
+	viper.SetDefault("spamd_reload.command", []string{})
+	viper.SetDefault("spamd_reload.timeout", "5m")
+	viper.SetDefault("rule_deployment.dir", "")
+	viper.SetDefault("rule_deployment.file", "/etc/spamassassin/90_spamassassin_mcp.cf")
+	viper.SetDefault("rule_deployment.keep", 10)
+	viper.SetDefault("rule_deployment.ham_sample", "")
+	viper.SetDefault("dns.server", "")
+	viper.SetDefault("dns.timeout", "10s")
+	viper.SetDefault("dns.uribl_zones", []string{"multi.uribl.com", "dbl.spamhaus.org", "multi.surbl.org"})
+	viper.SetDefault("dns.dnsbl_zones", []string{"zen.spamhaus.org"})
+	viper.SetDefault("dns.spamhaus_dqs_key", "")
+	viper.SetDefault("redaction.emails", true)
+	viper.SetDefault("redaction.bodies", true)
+	viper.SetDefault("redaction.ips", false)
+	viper.SetDefault("siem.format", "cef")
+	viper.SetDefault("siem.network", "tcp")
+	viper.SetDefault("siem.address", "")
+	viper.SetDefault("siem.ca_file", "")
+	viper.SetDefault("siem.facility", "mail")
+	viper.SetDefault("siem.app_name", "spamassassin-mcp")
+	viper.SetDefault("siem.fields", map[string]string{})
+	viper.SetDefault("siem.queue_size", 1000)
+	viper.SetDefault("logging.stdout", true)
+	viper.SetDefault("logging.file.path", "")
+	viper.SetDefault("logging.file.max_size_mb", 100)
+	viper.SetDefault("logging.file.max_backups", 5)
+	viper.SetDefault("logging.syslog.network", "udp")
+	viper.SetDefault("logging.syslog.address", "")
+	viper.SetDefault("logging.syslog.facility", "daemon")
+	viper.SetDefault("logging.syslog.app_name", "spamassassin-mcp")
 	viper.SetDefault("log_level", "info")
+	viper.SetDefault("watch_config", false)
 
-	// Environment variables
+	// Environment variables (nested keys map to underscores, e.g.
+	// security.max_email_size -> SA_MCP_SECURITY_MAX_EMAIL_SIZE)
 	viper.SetEnvPrefix("SA_MCP")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	// Read config file if it exists
-	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("/etc/spamassassin-mcp")
+	if configFile == "" {
+		configFile = os.Getenv("SA_MCP_CONFIG_FILE")
+	}
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		viper.SetConfigName("config")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("/etc/spamassassin-mcp")
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -86,10 +1194,1354 @@ func Load() (*Config, error) {
 		// Config file not found, use defaults
 	}
 
+	return decode()
+}
+
+// Reload re-reads the configuration file found by Load, together with the
+// environment, and validates the result. Unlike Load, a missing file is an
+// error, so a file briefly absent while being replaced never resets the
+// server to defaults.
+func Reload() (*Config, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return decode()
+}
+
+// Watch calls onChange whenever the configuration file found by Load is
+// written. It reports false when no configuration file is in use.
+func Watch(onChange func()) bool {
+	if viper.ConfigFileUsed() == "" {
+		return false
+	}
+	viper.OnConfigChange(func(fsnotify.Event) {
+		onChange()
+	})
+	viper.WatchConfig()
+	return true
+}
+
+// decode unmarshals and validates the configuration viper has read.
+func decode() (*Config, error) {
+	if err := readFileEnv(); err != nil {
+		return nil, err
+	}
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
 	}
 
+	if config.Auth.APIKey != "" {
+		config.Auth.APIKeys = append(config.Auth.APIKeys, APIKey{Name: defaultAPIKeyName, Key: config.Auth.APIKey})
+	}
+	if config.Auth.APIKeysFile != "" {
+		keys, err := loadAPIKeys(config.Auth.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Auth.APIKeys = append(config.Auth.APIKeys, keys...)
+	}
+	for i, key := range config.Auth.APIKeys {
+		if key.KeyFile == "" {
+			continue
+		}
+		if key.Key != "" {
+			return nil, fmt.Errorf("auth.api_keys[%d] (%s): set key or key_file, not both", i, key.Name)
+		}
+		secret, err := readSecret(key.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("auth.api_keys[%d] (%s): %w", i, key.Name, err)
+		}
+		config.Auth.APIKeys[i].Key = secret
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
 	return &config, nil
-}
\ No newline at end of file
+}
+
+// readFileEnv applies the *_FILE convention: when SA_MCP_<KEY>_FILE is set,
+// the setting is read from that file, so secrets can be mounted by Docker or
+// Kubernetes rather than passed in the environment. Settings that already
+// have a _file counterpart, such as auth.api_keys_file, are left to it.
+func readFileEnv() error {
+	keys := viper.AllKeys()
+	known := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	for _, key := range keys {
+		if known[key+"_file"] {
+			continue
+		}
+		env := "SA_MCP_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		path := os.Getenv(env + "_FILE")
+		if path == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(env); ok {
+			return fmt.Errorf("%s and %s_FILE are both set; use one", env, env)
+		}
+		value, err := readSecret(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", env, err)
+		}
+		viper.Set(key, value)
+	}
+	return nil
+}
+
+// readSecret reads a secret from a file, dropping the trailing newline most
+// editors and secret stores add.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// loadAPIKeys reads additional API keys from a YAML file containing an
+// api_keys list, so keys can be mounted as a secret instead of living in the
+// main configuration file.
+func loadAPIKeys(path string) ([]APIKey, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys []APIKey
+	if err := v.UnmarshalKey("api_keys", &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+	return keys, nil
+}
+
+// minAPIKeyLength rejects trivially guessable keys.
+const minAPIKeyLength = 16
+
+var tagNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// spamdUserRegex limits spamd user names to characters safe in a SPAMC
+// header.
+var spamdUserRegex = regexp.MustCompile(`^[A-Za-z0-9_.@-]{1,64}$`)
+
+// languageCodeRegex matches the language and locale codes of ok_languages
+// and ok_locales, e.g. "en" or "zh.big5".
+var languageCodeRegex = regexp.MustCompile(`^([a-z]{2,3}([._-][a-z0-9]+)*|all)$`)
+
+// tesseractLanguageRegex matches the names of tesseract traineddata files,
+// e.g. "eng" or "chi_sim".
+var tesseractLanguageRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{1,31}$`)
+
+// bucketNameRegex matches S3 bucket names.
+var bucketNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// dqsKeyRegex matches a Spamhaus DQS key, which becomes a DNS label.
+var dqsKeyRegex = regexp.MustCompile(`^[A-Za-z0-9]{26}$`)
+
+// zoneRegex matches DNS zone names such as dbl.spamhaus.org.
+var zoneRegex = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?\.)+[A-Za-z]{2,63}$`)
+
+// reloadMethods are the accepted values of spamd_reload.method.
+var reloadMethods = []string{"none", "signal", "command"}
+
+// gpgKeyRegex matches GPG key IDs and fingerprints as sa-update takes them.
+var gpgKeyRegex = regexp.MustCompile(`^[0-9A-Fa-f]{8,40}$`)
+
+// logLevels are the accepted log_level values.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// problems collects validation errors so all of them are reported at once.
+type problems []error
+
+func (p *problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Errorf(format, args...))
+}
+
+// Validate checks ranges and cross-field constraints, rejecting settings that
+// would otherwise fail silently or misbehave at runtime. Every problem found
+// is reported, one per line, each naming the setting as written in
+// config.yaml.
+func (c *Config) Validate() error {
+	var p problems
+
+	c.Server.validate(&p)
+	c.SpamAssassin.validate(&p)
+	c.Security.validate(&p)
+	c.AsyncScan.validate(&p)
+	c.Stats.validate(&p)
+	c.History.validate(&p)
+	c.PeerSync.validate(&p, c.History)
+	c.Quarantine.validate(&p)
+	c.Corpus.validate(&p)
+	c.IMAP.validate(&p)
+	c.POP3.validate(&p)
+	c.MaildirWatch.validate(&p)
+	c.ObjectStore.validate(&p)
+	c.ContentRefs.validate(&p)
+	c.MISP.validate(&p)
+	c.TAXII.validate(&p)
+	c.AbuseIPDB.validate(&p)
+	c.RDAP.validate(&p)
+	c.GeoIP.validate(&p)
+	c.BIMI.validate(&p)
+	c.VirusTotal.validate(&p)
+	c.Unshorten.validate(&p)
+	c.URLFeeds.validate(&p)
+	c.Homoglyph.validate(&p)
+	c.OCR.validate(&p)
+	c.ClamAV.validate(&p)
+	c.Rspamd.validate(&p)
+	if w := c.MaildirWatch; w.Dir != "" && w.Profile != "" {
+		if _, ok := c.Profile(w.Profile); !ok {
+			p.add("maildir_watch.profile: unknown profile %q", w.Profile)
+		}
+	}
+	c.Welcomelist.validate(&p)
+	c.Blocklist.validate(&p)
+	c.Bayes.validate(&p)
+	c.RuleUpdates.validate(&p)
+	c.SpamdReload.validate(&p)
+	c.RuleDeployment.validate(&p)
+	c.Scheduler.validate(&p, c.History)
+	if c.RuleDeployment.Dir != "" && c.SpamdReload.Method == "none" {
+		p.add("rule_deployment.dir: deploy_rules verifies deployments against the reloaded spamd, so spamd_reload.method must be signal or command")
+	}
+	c.DNS.validate(&p)
+	c.SIEM.validate(&p)
+	c.Logging.validate(&p)
+	if !slices.Contains(logLevels, c.LogLevel) {
+		p.add("log_level: must be one of %s, got %q", strings.Join(logLevels, ", "), c.LogLevel)
+	}
+
+	for i, rule := range c.Tags {
+		if !tagNameRegex.MatchString(rule.Tag) {
+			p.add("tags[%d]: invalid tag name %q", i, rule.Tag)
+		}
+		if len(rule.Rules) == 0 && rule.MinScore == nil {
+			p.add("tags[%d] (%s): at least one of rules or min_score is required", i, rule.Tag)
+		}
+	}
+
+	tagNames := make(map[string]bool, len(c.Tags))
+	for _, rule := range c.Tags {
+		tagNames[rule.Tag] = true
+	}
+	for i, hook := range c.TagWebhooks {
+		hook.validate(&p, i, tagNames)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		c.Profiles[name].validate(&p, name, c.SpamAssassin.CollaborativeFilters)
+	}
+
+	names := make(map[string]bool, len(c.Auth.APIKeys))
+	secrets := make(map[string]bool, len(c.Auth.APIKeys))
+	for i, key := range c.Auth.APIKeys {
+		if key.Name == "" {
+			p.add("auth.api_keys[%d]: name is required", i)
+		}
+		if names[key.Name] && key.Name != "" {
+			p.add("auth.api_keys[%d]: duplicate name %q", i, key.Name)
+		}
+		if len(key.Key) < minAPIKeyLength {
+			p.add("auth.api_keys[%d] (%s): key must be at least %d characters", i, key.Name, minAPIKeyLength)
+		} else if secrets[key.Key] {
+			p.add("auth.api_keys[%d] (%s): key is already assigned to another name", i, key.Name)
+		}
+		validateBudget(&p, fmt.Sprintf("auth.api_keys[%d] (%s)", i, key.Name), key.RequestsPerMinute, key.BurstSize)
+		names[key.Name] = true
+		secrets[key.Key] = true
+	}
+
+	c.Auth.OIDC.validate(&p)
+
+	return errors.Join(p...)
+}
+
+func (pr Profile) validate(p *problems, name string, cf CollaborativeFiltersConfig) {
+	if !tagNameRegex.MatchString(name) {
+		p.add("profiles.%s: invalid profile name; use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if pr.Threshold != nil && (math.IsNaN(*pr.Threshold) || math.IsInf(*pr.Threshold, 0)) {
+		p.add("profiles.%s.threshold: must be a finite number", name)
+	}
+	for i, domain := range pr.BlockedDomains {
+		if strings.TrimSpace(domain) == "" {
+			p.add("profiles.%s.blocked_domains[%d]: must not be empty, as it would block every domain", name, i)
+		}
+	}
+	if pr.SpamdUser != "" && !spamdUserRegex.MatchString(pr.SpamdUser) {
+		p.add("profiles.%s.spamd_user: must be 1-64 letters, digits, '.', '_', '@' or '-', got %q", name, pr.SpamdUser)
+	}
+	switch pr.CollaborativeFilters {
+	case "":
+	case "enable", "disable":
+		if pr.SpamdUser != "" {
+			p.add("profiles.%s.collaborative_filters: cannot be combined with spamd_user; both select the spamd user", name)
+		} else if cf.User(pr.CollaborativeFilters) == "" {
+			p.add("profiles.%s.collaborative_filters: %s needs spamassassin.collaborative_filters.%sd_user", name, pr.CollaborativeFilters, pr.CollaborativeFilters)
+		}
+	default:
+		p.add("profiles.%s.collaborative_filters: must be \"enable\" or \"disable\", got %q", name, pr.CollaborativeFilters)
+	}
+	for _, setting := range []struct{ key, value string }{
+		{"ok_languages", pr.OkLanguages},
+		{"ok_locales", pr.OkLocales},
+	} {
+		for _, code := range strings.Fields(setting.value) {
+			if !languageCodeRegex.MatchString(strings.ToLower(code)) {
+				p.add("profiles.%s.%s: must be \"all\" or language codes such as \"en ja\", got %q", name, setting.key, code)
+			}
+		}
+	}
+}
+
+func (s ServerConfig) validate(p *problems) {
+	validateAddr(p, "server.bind_addr", s.BindAddr)
+	if s.Timeout <= 0 {
+		p.add("server.timeout: must be positive, got %s", s.Timeout)
+	}
+	if s.ShutdownTimeout < 0 {
+		p.add("server.shutdown_timeout: must not be negative, got %s", s.ShutdownTimeout)
+	}
+
+	if (s.TLS.CertFile == "") != (s.TLS.KeyFile == "") {
+		p.add("server.tls: cert_file and key_file must be set together")
+	}
+	if s.TLS.ClientCAFile != "" && !s.TLS.Enabled() {
+		p.add("server.tls: client_ca_file requires cert_file and key_file")
+	}
+
+	if a := s.Admin; a.BindAddr != "" {
+		validateAddr(p, "server.admin.bind_addr", a.BindAddr)
+		if a.BindAddr == s.BindAddr {
+			p.add("server.admin.bind_addr: must differ from server.bind_addr (%s)", s.BindAddr)
+		}
+		if a.ProbeInterval <= 0 || a.ProbeTimeout <= 0 {
+			p.add("server.admin: probe_interval and probe_timeout must be positive")
+		} else if a.ProbeTimeout > a.ProbeInterval {
+			p.add("server.admin.probe_timeout: must not exceed probe_interval (%s), got %s", a.ProbeInterval, a.ProbeTimeout)
+		}
+	}
+}
+
+func (s SpamAssassinConfig) validate(p *problems) {
+	if s.Host == "" {
+		p.add("spamassassin.host: is required")
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		p.add("spamassassin.port: must be between 1 and 65535, got %d", s.Port)
+	}
+	if s.Timeout <= 0 {
+		p.add("spamassassin.timeout: must be positive, got %s", s.Timeout)
+	}
+	if math.IsNaN(s.Threshold) || math.IsInf(s.Threshold, 0) {
+		p.add("spamassassin.threshold: must be a finite number")
+	}
+	for _, bound := range []struct {
+		key   string
+		value float64
+	}{{"threshold_min", s.ThresholdMin}, {"threshold_max", s.ThresholdMax}} {
+		if math.IsNaN(bound.value) || math.IsInf(bound.value, 0) {
+			p.add("spamassassin.%s: must be a finite number", bound.key)
+		}
+	}
+	if s.ThresholdMin > s.ThresholdMax {
+		p.add("spamassassin.threshold_max: must be at least spamassassin.threshold_min (%g), got %g", s.ThresholdMin, s.ThresholdMax)
+	}
+	if s.MaxConcurrentScans < 0 {
+		p.add("spamassassin.max_concurrent_scans: must not be negative (0 means unlimited), got %d", s.MaxConcurrentScans)
+	}
+	if s.QueueTimeout < 0 {
+		p.add("spamassassin.queue_timeout: must not be negative, got %s", s.QueueTimeout)
+	}
+	if s.Binary == "" {
+		p.add("spamassassin.binary: is required")
+	}
+	if s.SandboxTimeout <= 0 {
+		p.add("spamassassin.sandbox_timeout: must be positive, got %s", s.SandboxTimeout)
+	}
+	for i, user := range s.AllowedUsers {
+		if !spamdUserRegex.MatchString(user) {
+			p.add("spamassassin.allowed_users[%d]: must be 1-64 letters, digits, '.', '_', '@' or '-', got %q", i, user)
+		}
+	}
+	cf := s.CollaborativeFilters
+	for _, u := range []struct{ name, user string }{{"enabled_user", cf.EnabledUser}, {"disabled_user", cf.DisabledUser}} {
+		if u.user != "" && !spamdUserRegex.MatchString(u.user) {
+			p.add("spamassassin.collaborative_filters.%s: must be 1-64 letters, digits, '.', '_', '@' or '-', got %q", u.name, u.user)
+		}
+	}
+	if cf.EnabledUser != "" && cf.EnabledUser == cf.DisabledUser {
+		p.add("spamassassin.collaborative_filters: enabled_user and disabled_user must differ")
+	}
+}
+
+func (s SecurityConfig) validate(p *problems) {
+	if s.MaxEmailSize <= 0 {
+		p.add("security.max_email_size: must be positive, got %d", s.MaxEmailSize)
+	}
+	if s.ScanTimeout <= 0 {
+		p.add("security.scan_timeout: must be positive, got %s", s.ScanTimeout)
+	}
+	for i, domain := range s.BlockedDomains {
+		if strings.TrimSpace(domain) == "" {
+			p.add("security.blocked_domains[%d]: must not be empty, as it would block every domain", i)
+		}
+	}
+
+	limits := s.RateLimiting
+	validateRequiredBudget(p, "security.rate_limiting", limits.Disabled, limits.RequestsPerMinute, limits.BurstSize)
+	validateRequiredBudget(p, "security.rate_limiting.per_client", limits.PerClient.Disabled, limits.PerClient.RequestsPerMinute, limits.PerClient.BurstSize)
+	if limits.PerClient.IdleTimeout < 0 {
+		p.add("security.rate_limiting.per_client.idle_timeout: must not be negative, got %s", limits.PerClient.IdleTimeout)
+	}
+
+	tools := slices.Sorted(maps.Keys(limits.Tools))
+	for _, tool := range tools {
+		limit := limits.Tools[tool]
+		name := "security.rate_limiting.tools." + tool
+		validateBudget(p, name, limit.RequestsPerMinute, limit.BurstSize)
+		if limit.DailyQuota < 0 {
+			p.add("%s.daily_quota: must not be negative (0 means no quota), got %d", name, limit.DailyQuota)
+		}
+		if limit.RequestsPerMinute == 0 && limit.DailyQuota == 0 {
+			p.add("%s: requests_per_minute or daily_quota is required", name)
+		}
+	}
+}
+
+// validateBudget checks an optional token bucket, such as a tool's or an API
+// key's. A zero requests_per_minute, as when it is omitted, sets no budget;
+// otherwise burst_size must be between 1 and requests_per_minute.
+func validateBudget(p *problems, name string, rpm, burst int) {
+	switch {
+	case rpm < 0:
+		p.add("%s.requests_per_minute: must not be negative (omit it for no limit), got %d", name, rpm)
+	case burst < 0:
+		p.add("%s.burst_size: must not be negative, got %d", name, burst)
+	case rpm > 0 && burst < 1:
+		p.add("%s.burst_size: must be at least 1 when requests_per_minute is set", name)
+	case rpm > 0 && burst > rpm:
+		p.add("%s.burst_size: must not exceed requests_per_minute (%d), got %d", name, rpm, burst)
+	}
+}
+
+// validateRequiredBudget checks the global or per-client budget, which has
+// a default and is turned off only with disabled. A zero requests_per_minute
+// is refused: it reads as blocking every call, but would lift the limit.
+func validateRequiredBudget(p *problems, name string, disabled bool, rpm, burst int) {
+	switch {
+	case disabled:
+		return
+	case rpm == 0:
+		p.add("%s.requests_per_minute: must be at least 1; to lift the limit set %s.disabled: true", name, name)
+	default:
+		validateBudget(p, name, rpm, burst)
+	}
+}
+
+func (a AsyncScanConfig) validate(p *problems) {
+	if !a.Enabled {
+		return
+	}
+	if a.Workers < 1 {
+		p.add("async_scan.workers: must be at least 1 when async_scan is enabled, got %d", a.Workers)
+	}
+	if a.QueueSize < 0 {
+		p.add("async_scan.queue_size: must not be negative, got %d", a.QueueSize)
+	}
+	if a.SizeThreshold < 0 {
+		p.add("async_scan.size_threshold: must not be negative (0 disables automatic deferral), got %d", a.SizeThreshold)
+	}
+	if a.ResultTTL <= 0 {
+		p.add("async_scan.result_ttl: must be positive, got %s", a.ResultTTL)
+	}
+}
+
+func (s StatsConfig) validate(p *problems) {
+	if s.Path != "" && s.FlushInterval < 0 {
+		p.add("stats.flush_interval: must not be negative (0 saves only on shutdown), got %s", s.FlushInterval)
+	}
+}
+
+func (h HistoryConfig) validate(p *problems) {
+	if h.DSN == "" {
+		return
+	}
+	if h.Driver != "sqlite" && h.Driver != "postgres" {
+		p.add("history.driver: must be sqlite or postgres, got %q", h.Driver)
+	}
+	if h.Retention < 0 {
+		p.add("history.retention: must not be negative (0 keeps entries forever), got %s", h.Retention)
+	}
+}
+
+// minPeerTokenLength is the shortest token accepted for peer_sync, which
+// guards the shared history against guessing.
+const minPeerTokenLength = 32
+
+func (s PeerSyncConfig) validate(p *problems, history HistoryConfig) {
+	if s.Token == "" && len(s.Peers) == 0 {
+		return
+	}
+	if s.Token != "" {
+		if len(s.Token) < minPeerTokenLength {
+			p.add("peer_sync.token: must be at least %d characters", minPeerTokenLength)
+		}
+		if history.DSN == "" {
+			p.add("peer_sync.token: sharing reputation requires the scan history (set history.dsn)")
+		}
+	}
+	if s.Window <= 0 {
+		p.add("peer_sync.window: must be positive, got %s", s.Window)
+	}
+	if s.MaxEntries <= 0 {
+		p.add("peer_sync.max_entries: must be positive, got %d", s.MaxEntries)
+	}
+	if len(s.Peers) == 0 {
+		return
+	}
+	if s.Interval < time.Minute {
+		p.add("peer_sync.interval: must be at least 1m, got %s", s.Interval)
+	}
+	if s.Timeout <= 0 {
+		p.add("peer_sync.timeout: must be positive, got %s", s.Timeout)
+	}
+	if s.MaxSize <= 0 {
+		p.add("peer_sync.max_size: must be positive, got %d", s.MaxSize)
+	}
+	names := make(map[string]bool, len(s.Peers))
+	for i, peer := range s.Peers {
+		if !tagNameRegex.MatchString(peer.Name) {
+			p.add("peer_sync.peers[%d].name: invalid peer name %q", i, peer.Name)
+		} else if names[peer.Name] {
+			p.add("peer_sync.peers[%d].name: duplicate peer name %q", i, peer.Name)
+		}
+		names[peer.Name] = true
+		u, err := url.Parse(peer.URL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+			p.add("peer_sync.peers[%d].url: must be the base URL of the peer, such as https://mcp.example.com:8080, got %q", i, peer.URL)
+		} else if u.Scheme == "http" && !isLoopback(u.Hostname()) {
+			p.add("peer_sync.peers[%d].url: http sends the token in clear and is only allowed for a loopback server; use https", i)
+		}
+		if peer.Token == "" {
+			p.add("peer_sync.peers[%d].token: required", i)
+		}
+	}
+}
+
+func (q QuarantineConfig) validate(p *problems) {
+	if q.Dir == "" {
+		return
+	}
+	// Not the key itself: it is a secret
+	if key, err := base64.StdEncoding.DecodeString(q.Key); err != nil || len(key) != 32 {
+		p.add("quarantine.key: must be 32 bytes encoded in base64, such as the output of openssl rand -base64 32")
+	}
+	if q.MinScore < 0 {
+		p.add("quarantine.min_score: must not be negative (0 quarantines spam verdicts), got %g", q.MinScore)
+	}
+	if q.Retention < 0 {
+		p.add("quarantine.retention: must not be negative (0 keeps messages forever), got %s", q.Retention)
+	}
+}
+
+func (c CorpusConfig) validate(p *problems) {
+	if c.Path != "" && c.MaxMessages <= 0 {
+		p.add("corpus.max_messages: must be positive, got %d", c.MaxMessages)
+	}
+}
+
+func (m IMAPConfig) validate(p *problems) {
+	if m.Addr == "" {
+		return
+	}
+	validateMailServer(p, "imap", m.Addr, m.TLS, m.CAFile, m.Username, m.Timeout, m.MaxMessages)
+	if m.Folder == "" || strings.ContainsFunc(m.Folder, func(r rune) bool { return r < 0x20 || r > 0x7e }) {
+		p.add("imap.folder: must be a non-empty name of printable ASCII characters, got %q", m.Folder)
+	}
+}
+
+func (m POP3Config) validate(p *problems) {
+	if m.Addr == "" {
+		return
+	}
+	validateMailServer(p, "pop3", m.Addr, m.TLS, m.CAFile, m.Username, m.Timeout, m.MaxMessages)
+}
+
+// validateMailServer checks the settings the imap and pop3 sections share.
+func validateMailServer(p *problems, section, addr, tls, caFile, username string, timeout time.Duration, maxMessages int) {
+	validateAddr(p, section+".addr", addr)
+	switch tls {
+	case "implicit", "starttls":
+	case "none":
+		if host, _, err := net.SplitHostPort(addr); err == nil && !isLoopback(host) {
+			p.add("%s.tls: none sends the password in clear and is only allowed for a loopback server", section)
+		}
+	default:
+		p.add("%s.tls: must be implicit, starttls or none, got %q", section, tls)
+	}
+	if caFile != "" && tls == "none" {
+		p.add("%s.ca_file: requires %s.tls implicit or starttls", section, section)
+	}
+	if username == "" {
+		p.add("%s.username: required when %s.addr is set", section, section)
+	}
+	if timeout <= 0 {
+		p.add("%s.timeout: must be positive, got %s", section, timeout)
+	}
+	if maxMessages <= 0 {
+		p.add("%s.max_messages: must be positive, got %d", section, maxMessages)
+	}
+}
+
+func (w MaildirWatchConfig) validate(p *problems) {
+	if w.Dir == "" {
+		return
+	}
+	if w.PollInterval < time.Second {
+		p.add("maildir_watch.poll_interval: must be at least 1s, got %s", w.PollInterval)
+	}
+	if math.IsNaN(w.NotifyScore) || math.IsInf(w.NotifyScore, 0) || w.NotifyScore < 0 {
+		p.add("maildir_watch.notify_score: must be a finite, non-negative number (0 means the spam threshold)")
+	}
+}
+
+func (o ObjectStoreConfig) validate(p *problems) {
+	if o.Endpoint == "" {
+		return
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		p.add("object_store.endpoint: must be a URL without a path, such as https://s3.us-east-1.amazonaws.com, got %q", o.Endpoint)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("object_store.endpoint: http sends objects in clear and is only allowed for a loopback server; use https")
+	} else if o.CAFile != "" && u.Scheme != "https" {
+		p.add("object_store.ca_file: requires an https endpoint")
+	}
+	if o.Region == "" {
+		p.add("object_store.region: is required")
+	}
+	if o.AccessKeyID == "" || o.SecretAccessKey == "" {
+		p.add("object_store.access_key_id and secret_access_key: required when object_store.endpoint is set")
+	}
+	if len(o.Buckets) == 0 {
+		p.add("object_store.buckets: at least one bucket is required when object_store.endpoint is set")
+	}
+	names := make(map[string]bool, len(o.Buckets))
+	for i, bucket := range o.Buckets {
+		if !bucketNameRegex.MatchString(bucket.Name) {
+			p.add("object_store.buckets[%d]: invalid bucket name %q", i, bucket.Name)
+		} else if names[bucket.Name] {
+			p.add("object_store.buckets[%d]: duplicate bucket %q", i, bucket.Name)
+		}
+		names[bucket.Name] = true
+		for _, prefix := range bucket.Prefixes {
+			if prefix == "" || strings.HasPrefix(prefix, "/") {
+				p.add("object_store.buckets[%d] (%s): prefixes must be non-empty and not start with /, got %q", i, bucket.Name, prefix)
+			}
+		}
+	}
+	if o.Timeout <= 0 {
+		p.add("object_store.timeout: must be positive, got %s", o.Timeout)
+	}
+	if o.MaxObjectSize <= 0 {
+		p.add("object_store.max_object_size: must be positive, got %d", o.MaxObjectSize)
+	}
+	if o.MaxMessages <= 0 {
+		p.add("object_store.max_messages: must be positive, got %d", o.MaxMessages)
+	}
+}
+
+func (r ContentRefsConfig) validate(p *problems) {
+	for _, dir := range r.Dirs {
+		if !filepath.IsAbs(dir) {
+			p.add("content_refs.dirs: must be absolute paths, got %q", dir)
+		}
+	}
+	for _, host := range r.AllowedHosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || strings.ContainsAny(name, "/:*@ ") {
+			p.add("content_refs.allowed_hosts: must be host names such as files.example.com or *.example.com, got %q", host)
+		}
+	}
+	if r.CAFile != "" && len(r.AllowedHosts) == 0 {
+		p.add("content_refs.ca_file: requires content_refs.allowed_hosts")
+	}
+	if r.Timeout <= 0 {
+		p.add("content_refs.timeout: must be positive, got %s", r.Timeout)
+	}
+}
+
+func (w TagWebhookConfig) validate(p *problems, i int, tagNames map[string]bool) {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		p.add("tag_webhooks[%d].url: must be an http or https URL, got %q", i, w.URL)
+	} else if u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		p.add("tag_webhooks[%d].url: http sends verdicts in clear and is only allowed for a loopback server; use https", i)
+	}
+	if len(w.Tags) == 0 {
+		p.add("tag_webhooks[%d].tags: at least one tag is required", i)
+	}
+	for _, tag := range w.Tags {
+		if !tagNames[tag] {
+			p.add("tag_webhooks[%d].tags: %q is not defined in tags", i, tag)
+		}
+	}
+	if w.Timeout < 0 {
+		p.add("tag_webhooks[%d].timeout: must not be negative, got %s", i, w.Timeout)
+	}
+}
+
+func (m MISPConfig) validate(p *problems) {
+	if m.URL == "" {
+		return
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || u.Host == "" || u.RawQuery != "" {
+		p.add("misp.url: must be the base URL of the MISP instance, such as https://misp.example.com, got %q", m.URL)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("misp.url: http sends the API key in clear and is only allowed for a loopback server; use https")
+	} else if m.CAFile != "" && u.Scheme != "https" {
+		p.add("misp.ca_file: requires an https URL")
+	}
+	if m.APIKey == "" {
+		p.add("misp.api_key: required when misp.url is set")
+	}
+	if m.Timeout <= 0 {
+		p.add("misp.timeout: must be positive, got %s", m.Timeout)
+	}
+	if !slices.Contains(TLPLevels, m.TLP) {
+		p.add("misp.tlp: must be one of %s, got %q", strings.Join(TLPLevels, ", "), m.TLP)
+	}
+	for i, tag := range m.Tags {
+		if tag == "" || strings.HasPrefix(strings.ToLower(tag), "tlp:") {
+			p.add("misp.tags[%d]: must be non-empty and not a TLP tag (set misp.tlp), got %q", i, tag)
+		}
+	}
+	if m.Distribution < 0 || m.Distribution > 3 {
+		p.add("misp.distribution: must be between 0 and 3, got %d", m.Distribution)
+	}
+	if m.ThreatLevel < 1 || m.ThreatLevel > 4 {
+		p.add("misp.threat_level: must be between 1 (high) and 4 (undefined), got %d", m.ThreatLevel)
+	}
+}
+
+func (t TAXIIConfig) validate(p *problems) {
+	if t.APIRoot == "" {
+		return
+	}
+	u, err := url.Parse(t.APIRoot)
+	if err != nil || u.Host == "" || u.RawQuery != "" {
+		p.add("taxii.api_root: must be the URL of a TAXII 2.1 API root, such as https://taxii.example.com/api1/, got %q", t.APIRoot)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("taxii.api_root: http sends credentials in clear and is only allowed for a loopback server; use https")
+	} else if t.CAFile != "" && u.Scheme != "https" {
+		p.add("taxii.ca_file: requires an https API root")
+	}
+	if t.CollectionID == "" || strings.ContainsAny(t.CollectionID, "/?#") {
+		p.add("taxii.collection_id: must be the ID of a collection, got %q", t.CollectionID)
+	}
+	if t.Token != "" && (t.Username != "" || t.Password != "") {
+		p.add("taxii: set either token or username and password, not both")
+	}
+	if (t.Username == "") != (t.Password == "") {
+		p.add("taxii.username and password: must be set together")
+	}
+	if t.Interval < time.Minute {
+		p.add("taxii.interval: must be at least 1m, got %s", t.Interval)
+	}
+	if t.Timeout <= 0 {
+		p.add("taxii.timeout: must be positive, got %s", t.Timeout)
+	}
+	if t.MinConfidence < 0 || t.MinConfidence > 100 {
+		p.add("taxii.min_confidence: must be between 0 and 100, got %d", t.MinConfidence)
+	}
+	for i, domain := range t.ExcludeDomains {
+		if domain == "" || strings.ContainsAny(domain, "/@ *") {
+			p.add("taxii.exclude_domains[%d]: must be a domain name, got %q", i, domain)
+		}
+	}
+	if t.MaxIndicators <= 0 {
+		p.add("taxii.max_indicators: must be positive, got %d", t.MaxIndicators)
+	}
+}
+
+func (a AbuseIPDBConfig) validate(p *problems) {
+	if a.APIKey == "" {
+		return
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Host == "" || u.RawQuery != "" {
+		p.add("abuseipdb.url: must be the URL of the AbuseIPDB v2 API, such as https://api.abuseipdb.com/api/v2, got %q", a.URL)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("abuseipdb.url: http sends the API key in clear and is only allowed for a loopback server; use https")
+	}
+	if a.Timeout <= 0 {
+		p.add("abuseipdb.timeout: must be positive, got %s", a.Timeout)
+	}
+	if a.MaxAgeDays < 1 || a.MaxAgeDays > 365 {
+		p.add("abuseipdb.max_age_days: must be between 1 and 365, got %d", a.MaxAgeDays)
+	}
+	if a.CacheTTL < time.Minute {
+		p.add("abuseipdb.cache_ttl: must be at least 1m, got %s", a.CacheTTL)
+	}
+	if a.CacheSize <= 0 {
+		p.add("abuseipdb.cache_size: must be positive, got %d", a.CacheSize)
+	}
+}
+
+func (r RDAPConfig) validate(p *problems) {
+	if !r.Enabled {
+		return
+	}
+	u, err := url.Parse(r.BootstrapURL)
+	if err != nil || u.Host == "" {
+		p.add("rdap.bootstrap_url: must be the URL of an RDAP bootstrap file, such as https://data.iana.org/rdap/dns.json, got %q", r.BootstrapURL)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("rdap.bootstrap_url: must use https, or http only for a loopback server")
+	}
+	if r.Timeout <= 0 {
+		p.add("rdap.timeout: must be positive, got %s", r.Timeout)
+	}
+	if r.NewDomainDays < 1 || r.NewDomainDays > 3650 {
+		p.add("rdap.new_domain_days: must be between 1 and 3650, got %d", r.NewDomainDays)
+	}
+	if r.CacheTTL < time.Minute {
+		p.add("rdap.cache_ttl: must be at least 1m, got %s", r.CacheTTL)
+	}
+	if r.CacheSize <= 0 {
+		p.add("rdap.cache_size: must be positive, got %d", r.CacheSize)
+	}
+}
+
+func (g GeoIPConfig) validate(p *problems) {
+	if g.CountryDB != "" && !filepath.IsAbs(g.CountryDB) {
+		p.add("geoip.country_db: must be an absolute path, got %q", g.CountryDB)
+	}
+	if g.ASNDB != "" && !filepath.IsAbs(g.ASNDB) {
+		p.add("geoip.asn_db: must be an absolute path, got %q", g.ASNDB)
+	}
+}
+
+func (b BIMIConfig) validate(p *problems) {
+	if b.FetchVMC && b.Timeout <= 0 {
+		p.add("bimi.timeout: must be positive, got %s", b.Timeout)
+	}
+}
+
+func (v VirusTotalConfig) validate(p *problems) {
+	if v.APIKey == "" {
+		return
+	}
+	u, err := url.Parse(v.URL)
+	if err != nil || u.Host == "" || u.RawQuery != "" {
+		p.add("virustotal.url: must be the URL of the VirusTotal v3 API, such as https://www.virustotal.com/api/v3, got %q", v.URL)
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		p.add("virustotal.url: http sends the API key in clear and is only allowed for a loopback server; use https")
+	}
+	if v.Timeout <= 0 {
+		p.add("virustotal.timeout: must be positive, got %s", v.Timeout)
+	}
+	if v.MaxLookups <= 0 {
+		p.add("virustotal.max_lookups: must be positive, got %d", v.MaxLookups)
+	}
+	if v.CacheTTL < time.Minute {
+		p.add("virustotal.cache_ttl: must be at least 1m, got %s", v.CacheTTL)
+	}
+	if v.CacheSize <= 0 {
+		p.add("virustotal.cache_size: must be positive, got %d", v.CacheSize)
+	}
+}
+
+func (u UnshortenConfig) validate(p *problems) {
+	if !u.Enabled {
+		return
+	}
+	if u.Timeout <= 0 {
+		p.add("unshorten.timeout: must be positive, got %s", u.Timeout)
+	}
+	if u.MaxRedirects <= 0 || u.MaxRedirects > 20 {
+		p.add("unshorten.max_redirects: must be between 1 and 20, got %d", u.MaxRedirects)
+	}
+	if u.MaxURLs <= 0 {
+		p.add("unshorten.max_urls: must be positive, got %d", u.MaxURLs)
+	}
+	for i, domain := range u.Shorteners {
+		if domain == "" || strings.ContainsAny(domain, "/@:* ") {
+			p.add("unshorten.shorteners[%d]: must be a domain name, got %q", i, domain)
+		}
+	}
+}
+
+func (o OCRConfig) validate(p *problems) {
+	if !o.Enabled {
+		return
+	}
+	if o.Tesseract == "" {
+		p.add("ocr.tesseract: is required")
+	}
+	for i, lang := range o.Languages {
+		if !tesseractLanguageRegex.MatchString(lang) {
+			p.add("ocr.languages[%d]: must be a tesseract language such as eng or chi_sim, got %q", i, lang)
+		}
+	}
+	if o.Timeout <= 0 {
+		p.add("ocr.timeout: must be positive, got %s", o.Timeout)
+	}
+	if o.Budget < o.Timeout {
+		p.add("ocr.budget: must be at least ocr.timeout, got %s", o.Budget)
+	}
+	if o.MaxImages <= 0 {
+		p.add("ocr.max_images: must be positive, got %d", o.MaxImages)
+	}
+	if o.MaxPixels <= 0 {
+		p.add("ocr.max_pixels: must be positive, got %d", o.MaxPixels)
+	}
+}
+
+func (c ClamAVConfig) validate(p *problems) {
+	if !c.Enabled() {
+		return
+	}
+	switch c.Network {
+	case "tcp":
+		validateAddr(p, "clamav.address", c.Address)
+	case "unix":
+		if !filepath.IsAbs(c.Address) {
+			p.add("clamav.address: must be an absolute socket path, got %q", c.Address)
+		}
+	default:
+		p.add("clamav.network: must be tcp or unix, got %q", c.Network)
+	}
+	if c.Timeout <= 0 {
+		p.add("clamav.timeout: must be positive, got %s", c.Timeout)
+	}
+	if c.MaxSize <= 0 {
+		p.add("clamav.max_size: must be positive, got %d", c.MaxSize)
+	}
+}
+
+func (r RspamdConfig) validate(p *problems) {
+	if r.URL == "" {
+		return
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") || u.RawQuery != "" {
+		p.add("rspamd.url: must be the http or https URL of an rspamd worker, such as http://127.0.0.1:11333, got %q", r.URL)
+	} else if r.Password != "" && u.Scheme != "https" && !isLoopback(u.Hostname()) {
+		p.add("rspamd.url: http sends the password in clear and is only allowed for a loopback server; use https")
+	}
+	if r.Timeout <= 0 {
+		p.add("rspamd.timeout: must be positive, got %s", r.Timeout)
+	}
+}
+
+func (f URLFeedsConfig) validate(p *problems) {
+	if !f.URLhaus.Enabled() && !f.PhishTank.Enabled() {
+		return
+	}
+	f.URLhaus.validate(p, "url_feeds.urlhaus")
+	f.PhishTank.validate(p, "url_feeds.phishtank")
+	if f.Timeout <= 0 {
+		p.add("url_feeds.timeout: must be positive, got %s", f.Timeout)
+	}
+	if f.MaxSize <= 0 {
+		p.add("url_feeds.max_size: must be positive, got %d", f.MaxSize)
+	}
+}
+
+func (g HomoglyphConfig) validate(p *problems) {
+	names := make(map[string]bool, len(g.ProtectedBrands))
+	for i, brand := range g.ProtectedBrands {
+		if brand.Name == "" {
+			p.add("homoglyph.protected_brands[%d]: name is required", i)
+		} else if names[strings.ToLower(brand.Name)] {
+			p.add("homoglyph.protected_brands[%d]: duplicate brand %q", i, brand.Name)
+		}
+		names[strings.ToLower(brand.Name)] = true
+		if len(brand.Domains) == 0 {
+			p.add("homoglyph.protected_brands[%d] (%s): at least one domain is required", i, brand.Name)
+		}
+		for _, domain := range brand.Domains {
+			if !zoneRegex.MatchString(domain) {
+				p.add("homoglyph.protected_brands[%d] (%s): domains must be ASCII domain names such as example.com (punycode for IDNs), got %q", i, brand.Name, domain)
+			}
+		}
+	}
+}
+
+func (s URLFeedSource) validate(p *problems, key string) {
+	if !s.Enabled() {
+		return
+	}
+	if s.URL != "" {
+		// Not the URL itself: it may hold an application key
+		u, err := url.Parse(s.URL)
+		if err != nil || u.Host == "" {
+			p.add("%s.url: must be the URL of the feed download", key)
+		} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+			p.add("%s.url: must be https; http is only allowed for a loopback server", key)
+		}
+	}
+	if s.Refresh < time.Minute {
+		p.add("%s.refresh: must be at least 1m, got %s", key, s.Refresh)
+	}
+}
+
+func (w WelcomelistConfig) validate(p *problems) {
+	if w.Directive != "welcomelist_from" && w.Directive != "whitelist_from" {
+		p.add("welcomelist.directive: must be welcomelist_from or whitelist_from, got %q", w.Directive)
+	}
+}
+
+func (b BlocklistConfig) validate(p *problems) {
+	if b.Directive != "blocklist_from" && b.Directive != "blacklist_from" {
+		p.add("blocklist.directive: must be blocklist_from or blacklist_from, got %q", b.Directive)
+	}
+}
+
+func (b BayesConfig) validate(p *problems) {
+	if b.SaLearn == "" {
+		p.add("bayes.sa_learn: is required")
+	}
+	if b.Timeout <= 0 {
+		p.add("bayes.timeout: must be positive, got %s", b.Timeout)
+	}
+	if b.MinSpam < 0 {
+		p.add("bayes.min_spam: must not be negative, got %d", b.MinSpam)
+	}
+	if b.MinHam < 0 {
+		p.add("bayes.min_ham: must not be negative, got %d", b.MinHam)
+	}
+	for _, dir := range b.ImportDirs {
+		if !filepath.IsAbs(dir) {
+			p.add("bayes.import_dirs: must be absolute paths, got %q", dir)
+		}
+	}
+	if b.ImportMaxMessages <= 0 {
+		p.add("bayes.import_max_messages: must be positive, got %d", b.ImportMaxMessages)
+	}
+	if b.ImportMaxSize <= 0 {
+		p.add("bayes.import_max_size: must be positive, got %d", b.ImportMaxSize)
+	}
+}
+
+func (s SchedulerConfig) validate(p *problems, history HistoryConfig) {
+	names := make(map[string]bool, len(s.Jobs))
+	for i, job := range s.Jobs {
+		if !tagNameRegex.MatchString(job.Name) {
+			p.add("scheduler.jobs[%d]: invalid job name %q", i, job.Name)
+		} else if names[job.Name] {
+			p.add("scheduler.jobs[%d]: duplicate job name %q", i, job.Name)
+		}
+		names[job.Name] = true
+		if !slices.Contains(scheduledTasks, job.Task) {
+			p.add("scheduler.jobs[%d] (%s): task must be one of %s, got %q", i, job.Name, strings.Join(scheduledTasks, ", "), job.Task)
+		}
+		if _, err := cron.Parse(job.Schedule); err != nil {
+			p.add("scheduler.jobs[%d] (%s): invalid schedule: %v", i, job.Name, err)
+		}
+		if job.MaxAge < 0 {
+			p.add("scheduler.jobs[%d] (%s): max_age must not be negative, got %s", i, job.Name, job.MaxAge)
+		}
+		if job.Task == TaskPruneHistory {
+			if history.DSN == "" {
+				p.add("scheduler.jobs[%d] (%s): prune_history needs the scan history (set history.dsn)", i, job.Name)
+			} else if job.MaxAge == 0 && history.Retention == 0 {
+				p.add("scheduler.jobs[%d] (%s): prune_history needs max_age or history.retention", i, job.Name)
+			}
+		} else if job.MaxAge != 0 {
+			p.add("scheduler.jobs[%d] (%s): max_age only applies to prune_history", i, job.Name)
+		}
+	}
+}
+
+func (r RuleUpdatesConfig) validate(p *problems) {
+	if r.SaUpdate == "" {
+		p.add("rule_updates.sa_update: is required")
+	}
+	if len(r.Channels) == 0 {
+		p.add("rule_updates.channels: at least one channel is required")
+	}
+	for i, channel := range r.Channels {
+		if !zoneRegex.MatchString(channel) {
+			p.add("rule_updates.channels[%d]: must be a channel name such as updates.spamassassin.org, got %q", i, channel)
+		}
+	}
+	for i, key := range r.GPGKeys {
+		if !gpgKeyRegex.MatchString(key) {
+			p.add("rule_updates.gpg_keys[%d]: must be a hexadecimal key ID or fingerprint, got %q", i, key)
+		}
+	}
+	if r.Timeout <= 0 {
+		p.add("rule_updates.timeout: must be positive, got %s", r.Timeout)
+	}
+}
+
+func (r SpamdReloadConfig) validate(p *problems) {
+	if r.Compile && r.SaCompile == "" {
+		p.add("spamd_reload.sa_compile: is required when compile is enabled")
+	}
+	switch r.Method {
+	case "signal":
+		if r.PIDFile == "" {
+			p.add("spamd_reload.pid_file: is required when method is signal")
+		}
+	case "command":
+		if len(r.Command) == 0 || r.Command[0] == "" {
+			p.add("spamd_reload.command: is required when method is command")
+		}
+	default:
+		if !slices.Contains(reloadMethods, r.Method) {
+			p.add("spamd_reload.method: must be one of %s, got %q", strings.Join(reloadMethods, ", "), r.Method)
+		}
+	}
+	if r.Timeout <= 0 {
+		p.add("spamd_reload.timeout: must be positive, got %s", r.Timeout)
+	}
+}
+
+func (r RuleDeploymentConfig) validate(p *problems) {
+	if r.Dir == "" {
+		return
+	}
+	if filepath.Ext(r.File) != ".cf" {
+		p.add("rule_deployment.file: must be a .cf file spamd loads, got %q", r.File)
+	}
+	if r.Keep < 1 {
+		p.add("rule_deployment.keep: must be at least 1, got %d", r.Keep)
+	}
+}
+
+func (d DNSConfig) validate(p *problems) {
+	if d.Server != "" {
+		validateAddr(p, "dns.server", d.Server)
+	}
+	if d.Timeout <= 0 {
+		p.add("dns.timeout: must be positive, got %s", d.Timeout)
+	}
+	for _, zone := range d.URIBLZones {
+		if !zoneRegex.MatchString(zone) {
+			p.add("dns.uribl_zones: %q is not a valid DNS zone", zone)
+		}
+	}
+	for _, zone := range d.DNSBLZones {
+		if !zoneRegex.MatchString(zone) {
+			p.add("dns.dnsbl_zones: %q is not a valid DNS zone", zone)
+		}
+	}
+	if d.SpamhausDQSKey != "" && !dqsKeyRegex.MatchString(d.SpamhausDQSKey) {
+		p.add("dns.spamhaus_dqs_key: must be the 26 character key of the Spamhaus DQS account")
+	}
+}
+
+func (s SIEMConfig) validate(p *problems) {
+	if s.Address == "" {
+		return
+	}
+	if s.Format != "cef" && s.Format != "leef" {
+		p.add("siem.format: must be cef or leef, got %q", s.Format)
+	}
+	switch s.Network {
+	case "udp", "tcp", "tls":
+		if _, _, err := net.SplitHostPort(s.Address); err != nil {
+			p.add("siem.address: must be host:port, got %q", s.Address)
+		}
+	default:
+		p.add("siem.network: must be udp, tcp or tls, got %q", s.Network)
+	}
+	if s.CAFile != "" && s.Network != "tls" {
+		p.add("siem.ca_file: requires network tls")
+	}
+	if !slices.Contains(syslogFacilities, s.Facility) {
+		p.add("siem.facility: unknown facility %q", s.Facility)
+	}
+	if s.QueueSize <= 0 {
+		p.add("siem.queue_size: must be positive, got %d", s.QueueSize)
+	}
+	for _, field := range slices.Sorted(maps.Keys(s.Fields)) {
+		if !slices.Contains(SIEMFields, field) {
+			p.add("siem.fields: unknown verdict field %q (known: %s)", field, strings.Join(SIEMFields, ", "))
+		} else if key := s.Fields[field]; key != "" && !siemKeyRegex.MatchString(key) {
+			p.add("siem.fields.%s: invalid event key %q", field, key)
+		}
+	}
+}
+
+func (l LoggingConfig) validate(p *problems) {
+	if !l.Stdout && l.File.Path == "" && !l.Syslog.Enabled() {
+		p.add("logging: at least one of stdout, file or syslog must be enabled")
+	}
+	if l.File.Path != "" && (l.File.MaxSizeMB <= 0 || l.File.MaxBackups < 0) {
+		p.add("logging.file: max_size_mb must be positive and max_backups non-negative")
+	}
+	if l.Syslog.Enabled() {
+		switch l.Syslog.Network {
+		case "udp", "tcp", "unix":
+		default:
+			p.add("logging.syslog.network: must be udp, tcp or unix, got %q", l.Syslog.Network)
+		}
+	}
+}
+
+func (o OIDCConfig) validate(p *problems) {
+	if !o.Enabled() {
+		if o.Audience != "" || o.JWKSURL != "" || len(o.ToolPolicies) > 0 {
+			p.add("auth.oidc: issuer is required")
+		}
+		return
+	}
+	if o.Audience == "" {
+		p.add("auth.oidc: audience is required")
+	}
+	u, err := url.Parse(o.JWKSURL)
+	if err != nil || u.Host == "" {
+		p.add("auth.oidc: jwks_url must be an absolute URL")
+	} else if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+		// Keys fetched over plain HTTP could be substituted in transit; allow
+		// it only for a provider on the same host.
+		p.add("auth.oidc: jwks_url must use https")
+	}
+	for i, policy := range o.ToolPolicies {
+		if len(policy.Tools) == 0 || policy.Claim == "" || len(policy.Values) == 0 {
+			p.add("auth.oidc.tool_policies[%d]: tools, claim and values are required", i)
+		}
+	}
+}
+
+// validateAddr checks a host:port listen address.
+func validateAddr(p *problems, name, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		p.add("%s: must be host:port, got %q", name, addr)
+		return
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		p.add("%s: invalid port %q", name, port)
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Reloaded returns a copy of c with the settings that can change while the
+// server runs taken from next: the spam threshold and the bounds of
+// per-scan thresholds, the security section
+// (size limit, rate limits, allowed senders and blocked domains), profiles
+// and the log level. Everything else configures listeners, connections and workers
+// created at startup and keeps its value from c.
+func (c *Config) Reloaded(next *Config) *Config {
+	applied := *c
+	applied.SpamAssassin.Threshold = next.SpamAssassin.Threshold
+	applied.SpamAssassin.ThresholdMin = next.SpamAssassin.ThresholdMin
+	applied.SpamAssassin.ThresholdMax = next.SpamAssassin.ThresholdMax
+	applied.Security = next.Security
+	applied.Profiles = next.Profiles
+	applied.Homoglyph = next.Homoglyph
+	applied.BIMI = next.BIMI
+	applied.Unshorten = next.Unshorten
+	applied.LogLevel = next.LogLevel
+	return &applied
+}
+
+// RestartRequired lists the top-level sections, by their config.yaml names,
+// whose settings differ between c and next but are not applied by Reloaded.
+func (c *Config) RestartRequired(next *Config) []string {
+	applied := reflect.ValueOf(c.Reloaded(next)).Elem()
+	wanted := reflect.ValueOf(next).Elem()
+	t := applied.Type()
+
+	var sections []string
+	for i := 0; i < t.NumField(); i++ {
+		if !reflect.DeepEqual(applied.Field(i).Interface(), wanted.Field(i).Interface()) {
+			sections = append(sections, t.Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return sections
+}
+
+// redactedValue replaces the value of any setting tagged as secret.
+const redactedValue = "[REDACTED]"
+
+// Redacted returns the effective configuration as a nested map keyed by the
+// same names used in config.yaml, with secret settings masked.
+//
+// Fields are considered secret when tagged `secret:"true"`. Empty secrets are
+// left empty so operators can still see that a value is unset.
+func (c *Config) Redacted() map[string]any {
+	return redactStruct(reflect.ValueOf(c).Elem())
+}
+
+func redactStruct(v reflect.Value) map[string]any {
+	out := make(map[string]any, v.NumField())
+	t := v.Type()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		if field.Tag.Get("secret") == "true" {
+			if !value.IsZero() {
+				out[name] = redactedValue
+			} else {
+				out[name] = ""
+			}
+			continue
+		}
+		out[name] = redactValue(value)
+	}
+	return out
+}
+
+func redactValue(v reflect.Value) any {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return redactStruct(v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = redactValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		items := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			items[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value())
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,239 @@
+// Package contentref fetches messages submitted by reference rather than by
+// value, so large messages need not pass through the MCP channel.
+//
+// A reference is an absolute path, a file:// URL or an https URL. Files are
+// read only from configured directories, and URLs only from configured
+// hosts.
+//
+// Security considerations:
+//   - Symbolic links are resolved before the directory check, so they
+//     cannot lead out of the allowed directories
+//   - Only https is fetched; redirects are followed only to allowed hosts
+//     over https, and URLs with credentials are refused
+//   - Sizes are bounded, before and while reading
+package contentref
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// maxRedirects bounds the redirects followed by one fetch.
+const maxRedirects = 5
+
+// Fetcher reads referenced messages.
+type Fetcher struct {
+	dirs  []string
+	hosts []string
+	http  *http.Client
+}
+
+// New returns a fetcher for the directories and hosts in cfg.
+func New(cfg config.ContentRefsConfig) (*Fetcher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content_refs CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("content_refs CA file %s holds no certificates", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	f := &Fetcher{dirs: cfg.Dirs, hosts: cfg.AllowedHosts}
+	f.http = &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f, nil
+}
+
+// Fetch returns the content ref points at. Content larger than maxSize is
+// rejected.
+func (f *Fetcher) Fetch(ctx context.Context, ref string, maxSize int64) (string, error) {
+	if filepath.IsAbs(ref) {
+		return f.readFile(ref, maxSize)
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "" {
+		return "", toolerr.Errorf(toolerr.ValidationFailed, "content_ref must be an absolute path, a file:// URL or an https URL, got %q", ref)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" && u.Host != "localhost" {
+			return "", toolerr.Errorf(toolerr.ValidationFailed, "file URLs must not name a host, got %q", ref)
+		}
+		return f.readFile(u.Path, maxSize)
+	case "https":
+		return f.get(ctx, u, maxSize)
+	}
+	return "", toolerr.Errorf(toolerr.UnsupportedFormat, "content_ref scheme must be file or https, got %q", u.Scheme)
+}
+
+// readFile reads a file within one of the allowed directories.
+func (f *Fetcher) readFile(path string, maxSize int64) (string, error) {
+	resolved, err := ResolvePath(f.dirs, "content_refs.dirs", path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", toolerr.Errorf(toolerr.UnsupportedFormat, "%s is not a regular file", path)
+	}
+	if info.Size() > maxSize {
+		return "", toolerr.Errorf(toolerr.SizeExceeded, "%s is %d bytes, over the limit of %d bytes", path, info.Size(), maxSize)
+	}
+	return readBounded(file, maxSize)
+}
+
+// get fetches an https URL on an allowed host.
+func (f *Fetcher) get(ctx context.Context, u *url.URL, maxSize int64) (string, error) {
+	if err := f.checkURL(u); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.http.Do(req)
+	if err != nil {
+		var classified *toolerr.Error
+		if errors.As(err, &classified) {
+			return "", classified
+		}
+		return "", fmt.Errorf("failed to fetch content_ref: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", toolerr.Errorf(toolerr.NotFound, "%s was not found", u.Redacted())
+	case resp.StatusCode != http.StatusOK:
+		return "", toolerr.Errorf(toolerr.UpstreamFailed, "fetching %s failed: %s", u.Redacted(), resp.Status)
+	}
+	if resp.ContentLength > maxSize {
+		return "", toolerr.Errorf(toolerr.SizeExceeded, "%s is %d bytes, over the limit of %d bytes", u.Redacted(), resp.ContentLength, maxSize)
+	}
+	return readBounded(resp.Body, maxSize)
+}
+
+// checkURL reports an error unless u is an https URL without credentials on
+// an allowed host.
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if len(f.hosts) == 0 {
+		return toolerr.Errorf(toolerr.NotConfigured, "URL references are not enabled (set content_refs.allowed_hosts)")
+	}
+	if u.Scheme != "https" {
+		return toolerr.Errorf(toolerr.Forbidden, "only https URLs may be fetched, got %s", u.Redacted())
+	}
+	if u.User != nil {
+		return toolerr.Errorf(toolerr.Forbidden, "URLs with credentials are not accepted")
+	}
+	if !AllowsHost(f.hosts, u.Hostname()) {
+		return toolerr.Errorf(toolerr.Forbidden, "host %s is not in content_refs.allowed_hosts", u.Hostname())
+	}
+	return nil
+}
+
+// AllowsHost reports whether host is one of hosts, or a subdomain of an
+// entry starting with "*.".
+func AllowsHost(hosts []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range hosts {
+		allowed = strings.ToLower(allowed)
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePath resolves path, which must be absolute, and checks that it is
+// one of dirs or within one of them. The path is checked before it is looked
+// up, so paths outside dirs are refused alike whether they exist or not, and
+// again once symbolic links are resolved, so links cannot lead out of the
+// allowed directories. setting names the configuration of dirs in errors.
+func ResolvePath(dirs []string, setting, path string) (string, error) {
+	if len(dirs) == 0 {
+		return "", toolerr.Errorf(toolerr.NotConfigured, "paths are not enabled (set %s)", setting)
+	}
+	if !filepath.IsAbs(path) {
+		return "", toolerr.Errorf(toolerr.ValidationFailed, "path must be absolute, got %q", path)
+	}
+	var roots, resolvedRoots []string
+	for _, dir := range dirs {
+		roots = append(roots, filepath.Clean(dir))
+		if root, err := filepath.EvalSymlinks(dir); err == nil {
+			roots = append(roots, root)
+			resolvedRoots = append(resolvedRoots, root)
+		}
+	}
+	outside := toolerr.Errorf(toolerr.Forbidden, "path %s is outside %s", path, setting)
+	if !within(filepath.Clean(path), roots) {
+		return "", outside
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", toolerr.Errorf(toolerr.NotFound, "path %s does not exist", path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !within(resolved, resolvedRoots) {
+		return "", outside
+	}
+	return resolved, nil
+}
+
+// within reports whether path is one of roots or inside one of them.
+func within(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readBounded reads r, failing once it holds more than maxSize bytes.
+func readBounded(r io.Reader, maxSize int64) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > maxSize {
+		return "", toolerr.Errorf(toolerr.SizeExceeded, "content exceeds the limit of %d bytes", maxSize)
+	}
+	return string(data), nil
+}
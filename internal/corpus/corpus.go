@@ -0,0 +1,117 @@
+// Package corpus reads a labeled corpus of sample messages and summarizes
+// how the current rules classify it, so rule updates can be checked for
+// detection regressions before they are deployed and spam thresholds can be
+// chosen on evidence.
+//
+// A corpus is a directory with a ham and a spam subdirectory holding one
+// message per file, the layout sa-learn and mass-check use. Files in nested
+// directories are included; hidden files are skipped. Either subdirectory
+// may be missing, but not both.
+//
+// Security considerations:
+//   - Only regular files below the corpus directory are read; symbolic links
+//     are not followed
+//   - The number of messages and the size of each are bounded
+package corpus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Labels of corpus samples, which are also the names of the subdirectories
+// holding them.
+const (
+	Ham  = "ham"
+	Spam = "spam"
+)
+
+// Sample is one labeled message of the corpus.
+type Sample struct {
+	// Name is the path of the message relative to the corpus directory,
+	// e.g. spam/2024-06/0001.eml.
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// Corpus is a labeled corpus on disk.
+type Corpus struct {
+	dir         string
+	maxMessages int
+}
+
+// New returns the corpus configured in cfg, or nil when none is.
+func New(cfg config.CorpusConfig) *Corpus {
+	if cfg.Path == "" {
+		return nil
+	}
+	return &Corpus{dir: cfg.Path, maxMessages: cfg.MaxMessages}
+}
+
+// Samples lists the messages of the corpus, ham first, in name order. A
+// corpus larger than the configured maximum is an error rather than being
+// truncated, so results are never based on part of it.
+func (c *Corpus) Samples() ([]Sample, error) {
+	var samples []Sample
+	for _, label := range []string{Ham, Spam} {
+		root := filepath.Join(c.dir, label)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if strings.HasPrefix(d.Name(), ".") && path != root {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if len(samples) == c.maxMessages {
+				return fmt.Errorf("corpus has more than %d messages", c.maxMessages)
+			}
+			rel, err := filepath.Rel(c.dir, path)
+			if err != nil {
+				return err
+			}
+			samples = append(samples, Sample{Name: filepath.ToSlash(rel), Label: label})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read corpus: %w", err)
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("corpus at %s has no messages in %s/ or %s/", c.dir, Ham, Spam)
+	}
+	return samples, nil
+}
+
+// Read returns the content of a sample, which must not exceed maxSize bytes.
+func (c *Corpus) Read(s Sample, maxSize int64) (string, error) {
+	f, err := os.Open(filepath.Join(c.dir, filepath.FromSlash(s.Name)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > maxSize {
+		return "", fmt.Errorf("message exceeds size limit of %d bytes", maxSize)
+	}
+	return string(data), nil
+}
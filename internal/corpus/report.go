@@ -0,0 +1,129 @@
+package corpus
+
+import (
+	"math"
+	"sort"
+)
+
+// Outcome is the classification of one sample by the current rules.
+type Outcome struct {
+	Sample
+	Score  float64  `json:"score"`
+	IsSpam bool     `json:"is_spam"`
+	Rules  []string `json:"rules,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Distribution summarizes the scores of the samples with one label. The
+// percentiles use the nearest-rank method.
+type Distribution struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	P5     float64 `json:"p5"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	P95    float64 `json:"p95"`
+	Max    float64 `json:"max"`
+}
+
+// Report summarizes a corpus run. Spam is the positive class: a false
+// positive is ham classified as spam, a false negative is spam classified
+// as ham. Samples that could not be scanned are counted in Errors only.
+type Report struct {
+	Ham            int `json:"ham"`
+	Spam           int `json:"spam"`
+	TruePositives  int `json:"true_positives"`
+	FalsePositives int `json:"false_positives"`
+	TrueNegatives  int `json:"true_negatives"`
+	FalseNegatives int `json:"false_negatives"`
+	Errors         int `json:"errors"`
+
+	// FalsePositiveRate is the share of scanned ham classified as spam and
+	// FalseNegativeRate the share of scanned spam classified as ham.
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+	FalseNegativeRate float64 `json:"false_negative_rate"`
+
+	HamScores  Distribution `json:"ham_scores"`
+	SpamScores Distribution `json:"spam_scores"`
+
+	// Misclassified lists the false positives and false negatives, and
+	// Failed the samples that could not be scanned.
+	Misclassified []Outcome `json:"misclassified"`
+	Failed        []Outcome `json:"failed"`
+}
+
+// Summarize builds the report for the outcomes of a corpus run.
+func Summarize(outcomes []Outcome) *Report {
+	r := &Report{Misclassified: make([]Outcome, 0), Failed: make([]Outcome, 0)}
+	var hamScores, spamScores []float64
+	for _, o := range outcomes {
+		if o.Label == Spam {
+			r.Spam++
+		} else {
+			r.Ham++
+		}
+		if o.Error != "" {
+			r.Errors++
+			r.Failed = append(r.Failed, o)
+			continue
+		}
+
+		switch {
+		case o.Label == Spam && o.IsSpam:
+			r.TruePositives++
+		case o.Label == Spam:
+			r.FalseNegatives++
+		case o.IsSpam:
+			r.FalsePositives++
+		default:
+			r.TrueNegatives++
+		}
+		if o.IsSpam != (o.Label == Spam) {
+			r.Misclassified = append(r.Misclassified, o)
+		}
+		if o.Label == Spam {
+			spamScores = append(spamScores, o.Score)
+		} else {
+			hamScores = append(hamScores, o.Score)
+		}
+	}
+
+	r.FalsePositiveRate = rate(r.FalsePositives, r.FalsePositives+r.TrueNegatives)
+	r.FalseNegativeRate = rate(r.FalseNegatives, r.FalseNegatives+r.TruePositives)
+	r.HamScores = distribution(hamScores)
+	r.SpamScores = distribution(spamScores)
+	return r
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*10000) / 10000
+}
+
+func distribution(scores []float64) Distribution {
+	n := len(scores)
+	if n == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64(nil), scores...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, s := range sorted {
+		sum += s
+	}
+	rank := func(p int) float64 {
+		return sorted[max((n*p+99)/100-1, 0)]
+	}
+	return Distribution{
+		Count:  n,
+		Min:    sorted[0],
+		P5:     rank(5),
+		Median: rank(50),
+		Mean:   math.Round(sum/float64(n)*1000) / 1000,
+		P95:    rank(95),
+		Max:    sorted[n-1],
+	}
+}
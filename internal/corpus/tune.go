@@ -0,0 +1,125 @@
+package corpus
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MaxCandidates is the largest number of candidate thresholds evaluated.
+const MaxCandidates = 100
+
+// DefaultCandidates are the thresholds evaluated when none are given: 1.0
+// to 15.0 in steps of 0.5.
+func DefaultCandidates() []float64 {
+	var candidates []float64
+	for t := 2; t <= 30; t++ {
+		candidates = append(candidates, float64(t)/2)
+	}
+	return candidates
+}
+
+// ThresholdStats is the classification of the corpus at one threshold.
+// Precision is zero when nothing is classified as spam.
+type ThresholdStats struct {
+	Threshold         float64 `json:"threshold"`
+	TruePositives     int     `json:"true_positives"`
+	FalsePositives    int     `json:"false_positives"`
+	TrueNegatives     int     `json:"true_negatives"`
+	FalseNegatives    int     `json:"false_negatives"`
+	Precision         float64 `json:"precision"`
+	Recall            float64 `json:"recall"`
+	F1                float64 `json:"f1"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// Tuning evaluates candidate thresholds on a scanned corpus.
+type Tuning struct {
+	Ham        int          `json:"ham"`
+	Spam       int          `json:"spam"`
+	Errors     int          `json:"errors"`
+	HamScores  Distribution `json:"ham_scores"`
+	SpamScores Distribution `json:"spam_scores"`
+
+	Current    ThresholdStats   `json:"current"`
+	Candidates []ThresholdStats `json:"candidates"`
+
+	// Recommended is the candidate with the best F1 among those within the
+	// false positive rate limit, the higher threshold on ties; nil when no
+	// candidate is within the limit.
+	Recommended          *ThresholdStats `json:"recommended"`
+	MaxFalsePositiveRate float64         `json:"max_false_positive_rate"`
+}
+
+// Tune evaluates the current threshold and the candidates on the outcomes
+// of a corpus run. Only scores are used, so the outcomes may have been
+// scanned at any threshold. Samples that failed to scan are left out.
+func Tune(outcomes []Outcome, current float64, candidates []float64, maxFalsePositiveRate float64) (*Tuning, error) {
+	var ham, spam []float64
+	errors := 0
+	for _, o := range outcomes {
+		switch {
+		case o.Error != "":
+			errors++
+		case o.Label == Spam:
+			spam = append(spam, o.Score)
+		default:
+			ham = append(ham, o.Score)
+		}
+	}
+	if len(ham) == 0 || len(spam) == 0 {
+		return nil, fmt.Errorf("threshold tuning needs scanned ham and spam samples, got %d ham and %d spam", len(ham), len(spam))
+	}
+
+	candidates = append([]float64(nil), candidates...)
+	sort.Float64s(candidates)
+	t := &Tuning{
+		Ham:                  len(ham),
+		Spam:                 len(spam),
+		Errors:               errors,
+		HamScores:            distribution(ham),
+		SpamScores:           distribution(spam),
+		Current:              evaluate(ham, spam, current),
+		Candidates:           make([]ThresholdStats, 0, len(candidates)),
+		MaxFalsePositiveRate: maxFalsePositiveRate,
+	}
+	for _, threshold := range candidates {
+		stats := evaluate(ham, spam, threshold)
+		t.Candidates = append(t.Candidates, stats)
+		if stats.FalsePositiveRate > maxFalsePositiveRate {
+			continue
+		}
+		if t.Recommended == nil || stats.F1 >= t.Recommended.F1 {
+			t.Recommended = &t.Candidates[len(t.Candidates)-1]
+		}
+	}
+	return t, nil
+}
+
+// evaluate classifies scores at threshold; a score equal to the threshold
+// is spam, as in SpamAssassin.
+func evaluate(ham, spam []float64, threshold float64) ThresholdStats {
+	s := ThresholdStats{Threshold: threshold}
+	for _, score := range spam {
+		if score >= threshold {
+			s.TruePositives++
+		} else {
+			s.FalseNegatives++
+		}
+	}
+	for _, score := range ham {
+		if score >= threshold {
+			s.FalsePositives++
+		} else {
+			s.TrueNegatives++
+		}
+	}
+
+	s.Precision = rate(s.TruePositives, s.TruePositives+s.FalsePositives)
+	s.Recall = rate(s.TruePositives, s.TruePositives+s.FalseNegatives)
+	s.FalsePositiveRate = rate(s.FalsePositives, s.FalsePositives+s.TrueNegatives)
+	if s.TruePositives > 0 {
+		s.F1 = math.Round(2*float64(s.TruePositives)/float64(2*s.TruePositives+s.FalsePositives+s.FalseNegatives)*10000) / 10000
+	}
+	return s
+}
@@ -0,0 +1,237 @@
+package deception
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// declaration is one CSS property and its lower-cased value, without
+// !important.
+type declaration struct {
+	property, value string
+}
+
+// rule is a style sheet rule with a simple selector: an optional tag name
+// and any number of classes and IDs.
+type rule struct {
+	tag          string
+	classes, ids []string
+	declarations []declaration
+}
+
+var (
+	selectorRegex = regexp.MustCompile(`^([a-z][a-z0-9]*|\*)?((?:[.#][A-Za-z0-9_-]+)*)$`)
+	simpleRegex   = regexp.MustCompile(`[.#][A-Za-z0-9_-]+`)
+	commentRegex  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// parseStyleSheets returns the rules of the <style> elements of doc, in
+// document order. Rules in @media and other at-rule blocks, and rules with
+// selectors other than simple ones, are skipped.
+func parseStyleSheets(doc *html.Node) []rule {
+	var rules []rule
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "style" {
+			if n.FirstChild != nil {
+				rules = append(rules, parseStyleSheet(n.FirstChild.Data)...)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(doc)
+	return rules
+}
+
+func parseStyleSheet(css string) []rule {
+	var rules []rule
+	depth := 0
+	for _, chunk := range strings.Split(commentRegex.ReplaceAllString(css, ""), "}") {
+		open := strings.Count(chunk, "{")
+		if open == 0 {
+			// The end of an at-rule block
+			depth = max(depth-1, 0)
+			continue
+		}
+		prelude, body, _ := strings.Cut(chunk, "{")
+		nested := depth > 0 || strings.HasPrefix(strings.TrimSpace(prelude), "@")
+		if open > 1 {
+			// An at-rule block opening with its first rule
+			depth++
+			continue
+		}
+		if nested {
+			continue
+		}
+		decls := parseDeclarations(body)
+		for _, selector := range strings.Split(prelude, ",") {
+			m := selectorRegex.FindStringSubmatch(strings.TrimSpace(selector))
+			if m == nil || m[1] == "" && m[2] == "" {
+				continue
+			}
+			r := rule{tag: m[1], declarations: decls}
+			for _, part := range simpleRegex.FindAllString(m[2], -1) {
+				if part[0] == '.' {
+					r.classes = append(r.classes, part[1:])
+				} else {
+					r.ids = append(r.ids, part[1:])
+				}
+			}
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseDeclarations(css string) []declaration {
+	var decls []declaration
+	for _, d := range strings.Split(css, ";") {
+		property, value, ok := strings.Cut(d, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(value)), "!important"))
+		decls = append(decls, declaration{strings.ToLower(strings.TrimSpace(property)), value})
+	}
+	return decls
+}
+
+func (r rule) matches(n *html.Node) bool {
+	if r.tag != "" && r.tag != "*" && r.tag != n.Data {
+		return false
+	}
+	classes := strings.Fields(attrValue(n, "class"))
+	for _, c := range r.classes {
+		found := false
+		for _, have := range classes {
+			found = found || have == c
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, id := range r.ids {
+		if attrValue(n, "id") != id {
+			return false
+		}
+	}
+	return true
+}
+
+// declarations returns the declarations applying to element n: those of
+// the matching style sheet rules, then those of its style attribute.
+func (s *partScan) declarations(n *html.Node) []declaration {
+	var decls []declaration
+	for _, r := range s.sheet {
+		if r.matches(n) {
+			decls = append(decls, r.declarations...)
+		}
+	}
+	return append(decls, parseDeclarations(attrValue(n, "style"))...)
+}
+
+// rgb is a color; transparent is set for fully transparent colors.
+type rgb struct {
+	r, g, b     int
+	transparent bool
+}
+
+var white = rgb{255, 255, 255, false}
+
+func (c rgb) String() string {
+	if c.transparent {
+		return "transparent"
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b)
+}
+
+// near reports whether c is indistinguishable from other to the eye.
+func (c rgb) near(other rgb) bool {
+	d := func(a, b int) int { return max(a-b, b-a) }
+	return d(c.r, other.r)+d(c.g, other.g)+d(c.b, other.b) <= 24
+}
+
+// namedColors are the CSS color keywords common in mail.
+var namedColors = map[string]rgb{
+	"white": white, "black": {}, "red": {r: 255}, "green": {g: 128}, "blue": {b: 255},
+	"yellow": {r: 255, g: 255}, "gray": {128, 128, 128, false}, "grey": {128, 128, 128, false},
+	"silver": {192, 192, 192, false}, "whitesmoke": {245, 245, 245, false},
+	"snow": {255, 250, 250, false}, "ivory": {255, 255, 240, false},
+	"transparent": {transparent: true},
+}
+
+var rgbRegex = regexp.MustCompile(`^rgba?\(\s*(\d+)\s*[, ]\s*(\d+)\s*[, ]\s*(\d+)\s*(?:[,/]\s*([\d.]+%?)\s*)?\)$`)
+
+// parseColor reads a CSS or HTML color: a keyword, #rgb, #rrggbb, rgb() or
+// rgba().
+func parseColor(s string) (rgb, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[s]; ok {
+		return c, true
+	}
+	if m := rgbRegex.FindStringSubmatch(s); m != nil {
+		r, _ := strconv.Atoi(m[1])
+		g, _ := strconv.Atoi(m[2])
+		b, _ := strconv.Atoi(m[3])
+		c := rgb{min(r, 255), min(g, 255), min(b, 255), false}
+		if alpha := strings.TrimSuffix(m[4], "%"); m[4] != "" {
+			if a, err := strconv.ParseFloat(alpha, 64); err == nil && a == 0 {
+				c.transparent = true
+			}
+		}
+		return c, true
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return rgb{}, false
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return rgb{}, false
+	}
+	return rgb{int(v >> 16), int(v >> 8 & 0xff), int(v & 0xff), false}, true
+}
+
+var lengthRegex = regexp.MustCompile(`^(-?[\d.]+)(px|pt|em|rem|%)?$`)
+
+func number(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v, err == nil
+}
+
+// pixels reads a length in pixels or points, or a unitless HTML attribute
+// value.
+func pixels(s string) (float64, bool) {
+	m := lengthRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || m[2] != "" && m[2] != "px" && m[2] != "pt" {
+		return 0, false
+	}
+	return number(m[1])
+}
+
+// zeroSize reports whether a font size makes text too small to read.
+func zeroSize(s string) bool {
+	m := lengthRegex.FindStringSubmatch(s)
+	if m == nil {
+		return false
+	}
+	v, _ := number(m[1])
+	switch m[2] {
+	case "em", "rem":
+		return v <= 0.1
+	case "%":
+		return v <= 10
+	default:
+		return v <= 1
+	}
+}
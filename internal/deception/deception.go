@@ -0,0 +1,379 @@
+// Package deception finds the tricks of deceptive HTML in the HTML parts of
+// a message.
+//
+// Spam and phishing use HTML to show a reader something other than what
+// filters read: text hidden with a zero font size, a color matching its
+// background or display:none feeds Bayes and body rules words the reader
+// never sees; one-pixel images report that a message was opened;
+// obfuscated JavaScript hides what a page does; and forms collect
+// passwords. Analyze reports each as an indicator weighted in SpamAssassin
+// score points, so the total can be read alongside a SpamAssassin score.
+//
+// Styles are resolved from inline style attributes, presentational
+// attributes and the simple selectors (tag, .class, #id) of <style>
+// elements. Rules inside @media blocks are ignored, since responsive
+// layouts hide their desktop or mobile variant there.
+//
+// Security considerations:
+//   - HTML is parsed, never rendered, and scripts are never run
+//   - No network requests are made; remote images are reported by URL
+package deception
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/phishing"
+)
+
+// Indicator types.
+const (
+	HiddenText           = "hidden_text"
+	TrackingPixel        = "tracking_pixel"
+	ObfuscatedJavaScript = "obfuscated_javascript"
+	CredentialForm       = "credential_form"
+)
+
+// weights are the score points each indicator contributes, on the scale
+// of SpamAssassin scores.
+var weights = map[string]float64{
+	HiddenText:           1.5,
+	TrackingPixel:        0.5,
+	ObfuscatedJavaScript: 2.0,
+	CredentialForm:       2.0,
+}
+
+const (
+	// minHiddenLetters is the number of letters hidden text must have to
+	// be reported.
+	minHiddenLetters = 20
+
+	// maxPreheader is the length below which text hidden with display:none
+	// or visibility:hidden is taken for the preheader of a newsletter, the
+	// preview line mail clients show next to the subject.
+	maxPreheader = 150
+
+	// maxSnippet bounds the text quoted in a description.
+	maxSnippet = 80
+)
+
+// Indicator is one deception technique found in an HTML part.
+type Indicator struct {
+	Type        string  `json:"type"`
+	Part        string  `json:"part"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+}
+
+// Report is the HTML deception analysis of a message. Score is the sum of
+// the indicator weights.
+type Report struct {
+	Indicators []Indicator `json:"indicators"`
+	Score      float64     `json:"score"`
+}
+
+// Analyze checks the HTML parts of email, inline or attached.
+func Analyze(email *model.ParsedEmail) *Report {
+	r := &Report{Indicators: make([]Indicator, 0)}
+	for _, p := range email.Parts {
+		if p.ContentType != "text/html" || p.Text == "" {
+			continue
+		}
+		r.analyzePart(p)
+	}
+	for _, ind := range r.Indicators {
+		r.Score += ind.Weight
+	}
+	r.Score = math.Round(r.Score*100) / 100
+	return r
+}
+
+func (r *Report) add(kind, part, format string, args ...any) {
+	r.Indicators = append(r.Indicators, Indicator{
+		Type:        kind,
+		Part:        part,
+		Description: fmt.Sprintf(format, args...),
+		Weight:      weights[kind],
+	})
+}
+
+// style is the state inherited down the document tree.
+type style struct {
+	// hidden names the technique hiding the element, or is empty
+	hidden string
+	// color and background are the text and background colors in effect;
+	// background defaults to white, the canvas of mail clients
+	color, background rgb
+	colorSet          bool
+}
+
+// partScan collects what one HTML part hides.
+type partScan struct {
+	sheet   []rule
+	hidden  map[string]*strings.Builder
+	order   []string
+	pixels  []string
+	scripts []string
+}
+
+func (r *Report) analyzePart(p model.Part) {
+	doc, err := html.Parse(strings.NewReader(p.Text))
+	if err != nil {
+		return
+	}
+	s := &partScan{hidden: make(map[string]*strings.Builder)}
+	s.sheet = parseStyleSheets(doc)
+	s.walk(doc, style{background: white})
+
+	for _, technique := range s.order {
+		text := strings.Join(strings.Fields(s.hidden[technique].String()), " ")
+		n := letters(text)
+		if n < minHiddenLetters {
+			continue
+		}
+		if (technique == "display:none" || technique == "visibility:hidden" || technique == "the hidden attribute") && len(text) < maxPreheader {
+			continue
+		}
+		r.add(HiddenText, p.Path, "%d letters of text hidden by %s: %q", n, technique, snippet(text))
+	}
+	for _, src := range s.pixels {
+		r.add(TrackingPixel, p.Path, "invisible image loaded from %s", src)
+	}
+	if techniques := obfuscation(s.scripts); len(techniques) > 0 {
+		r.add(ObfuscatedJavaScript, p.Path, "scripts use %s", strings.Join(techniques, ", "))
+	}
+	for _, f := range phishing.CredentialForms(p.Text) {
+		target := "the same page"
+		if f.Action != "" {
+			target = f.Action
+		}
+		r.add(CredentialForm, p.Path, "form asking for %s submits to %s", strings.Join(f.Fields, ", "), target)
+	}
+}
+
+func (s *partScan) walk(n *html.Node, inherited style) {
+	switch n.Type {
+	case html.TextNode:
+		s.text(n.Data, inherited)
+		return
+	case html.ElementNode:
+		switch n.Data {
+		case "script":
+			if n.FirstChild != nil {
+				s.scripts = append(s.scripts, n.FirstChild.Data)
+			}
+			return
+		case "style", "head", "title", "noscript", "template":
+			return
+		}
+		for _, a := range n.Attr {
+			if strings.HasPrefix(a.Key, "on") {
+				s.scripts = append(s.scripts, a.Val)
+			}
+			if (a.Key == "href" || a.Key == "src" || a.Key == "action") && strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+				s.scripts = append(s.scripts, a.Val)
+			}
+		}
+		inherited = s.apply(n, inherited)
+		if n.Data == "img" {
+			s.image(n, inherited)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		s.walk(c, inherited)
+	}
+}
+
+// apply returns the style of element n given the style of its parent.
+func (s *partScan) apply(n *html.Node, st style) style {
+	decls := s.declarations(n)
+	if _, ok := attr(n, "hidden"); ok && st.hidden == "" {
+		st.hidden = "the hidden attribute"
+	}
+	if c, ok := parseColor(attrValue(n, "bgcolor")); ok {
+		st.background = c
+	}
+	color := ""
+	switch n.Data {
+	case "font":
+		color = attrValue(n, "color")
+	case "body":
+		color = attrValue(n, "text")
+	}
+	if c, ok := parseColor(color); ok {
+		st.color, st.colorSet = c, true
+	}
+	for _, d := range decls {
+		switch d.property {
+		case "display":
+			if d.value == "none" && st.hidden == "" {
+				st.hidden = "display:none"
+			}
+		case "visibility":
+			switch {
+			case d.value == "hidden" || d.value == "collapse":
+				if st.hidden == "" {
+					st.hidden = "visibility:hidden"
+				}
+			case d.value == "visible" && st.hidden == "visibility:hidden":
+				st.hidden = ""
+			}
+		case "opacity":
+			if v, ok := number(d.value); ok && v <= 0.05 && st.hidden == "" {
+				st.hidden = "opacity:" + d.value
+			}
+		case "font-size":
+			if zeroSize(d.value) {
+				if st.hidden == "" {
+					st.hidden = "font-size:" + d.value
+				}
+			} else if strings.HasPrefix(st.hidden, "font-size:") {
+				st.hidden = ""
+			}
+		case "left", "top", "text-indent", "margin-left", "margin-top":
+			if v, ok := pixels(d.value); ok && v <= -500 && st.hidden == "" {
+				st.hidden = "off-screen positioning (" + d.property + ":" + d.value + ")"
+			}
+		case "color":
+			if c, ok := parseColor(d.value); ok {
+				st.color, st.colorSet = c, true
+			}
+		case "background-color", "background":
+			for _, field := range strings.Fields(d.value) {
+				if c, ok := parseColor(field); ok && !c.transparent {
+					st.background = c
+					break
+				}
+			}
+		}
+	}
+	return st
+}
+
+func (s *partScan) text(text string, st style) {
+	if letters(text) == 0 {
+		return
+	}
+	technique := st.hidden
+	if technique == "" && st.colorSet {
+		switch {
+		case st.color.transparent:
+			technique = "transparent text color"
+		case st.color.near(st.background):
+			technique = fmt.Sprintf("text color %s on background %s", st.color, st.background)
+		}
+	}
+	if technique == "" {
+		return
+	}
+	b, ok := s.hidden[technique]
+	if !ok {
+		b = &strings.Builder{}
+		s.hidden[technique] = b
+		s.order = append(s.order, technique)
+	}
+	b.WriteString(text)
+	b.WriteString(" ")
+}
+
+// image records remote images of at most one pixel, or hidden ones.
+func (s *partScan) image(n *html.Node, st style) {
+	src := strings.TrimSpace(attrValue(n, "src"))
+	u, err := url.Parse(src)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return
+	}
+	width, height := attrValue(n, "width"), attrValue(n, "height")
+	for _, d := range s.declarations(n) {
+		switch d.property {
+		case "width":
+			width = d.value
+		case "height":
+			height = d.value
+		}
+	}
+	w, wok := pixels(width)
+	h, hok := pixels(height)
+	if wok && hok && w <= 1 && h <= 1 || st.hidden != "" {
+		s.pixels = append(s.pixels, u.Scheme+"://"+u.Host+u.EscapedPath())
+	}
+}
+
+var (
+	// decoders are the calls scripts use to build their code at run time.
+	decoders = []struct {
+		re   *regexp.Regexp
+		name string
+	}{
+		{regexp.MustCompile(`\beval\s*\(`), "eval"},
+		{regexp.MustCompile(`\bnew\s+Function\s*\(|\bFunction\s*\(\s*["'\x60]`), "Function constructor"},
+		{regexp.MustCompile(`\b(?:setTimeout|setInterval)\s*\(\s*["'\x60]`), "string timers"},
+		{regexp.MustCompile(`\bunescape\s*\(`), "unescape"},
+		{regexp.MustCompile(`\batob\s*\(`), "atob"},
+		{regexp.MustCompile(`\bString\.fromCharCode\s*\(`), "String.fromCharCode"},
+		{regexp.MustCompile(`\bdocument\.write(?:ln)?\s*\(`), "document.write"},
+	}
+
+	escapeRegex = regexp.MustCompile(`\\x[0-9A-Fa-f]{2}|\\u[0-9A-Fa-f]{4}|%[0-9A-Fa-f]{2}`)
+	blobRegex   = regexp.MustCompile(`[A-Za-z0-9+/=_\\-]{300,}`)
+)
+
+// minEscapes is the number of escaped characters that marks a script as
+// obfuscated.
+const minEscapes = 20
+
+// obfuscation returns the obfuscation techniques found in scripts.
+func obfuscation(scripts []string) []string {
+	var techniques []string
+	code := strings.Join(scripts, "\n")
+	for _, d := range decoders {
+		if d.re.MatchString(code) {
+			techniques = append(techniques, d.name)
+		}
+	}
+	if n := len(escapeRegex.FindAllStringIndex(code, -1)); n >= minEscapes {
+		techniques = append(techniques, fmt.Sprintf("%d escaped characters", n))
+	}
+	if blobRegex.MatchString(code) {
+		techniques = append(techniques, "encoded blobs")
+	}
+	return techniques
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func attrValue(n *html.Node, key string) string {
+	v, _ := attr(n, key)
+	return v
+}
+
+func letters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+func snippet(s string) string {
+	if r := []rune(s); len(r) > maxSnippet {
+		return string(r[:maxSnippet]) + "…"
+	}
+	return s
+}
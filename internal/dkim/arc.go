@@ -0,0 +1,384 @@
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxARCInstances is the highest ARC instance number allowed (RFC 8617,
+// section 4.2.1).
+const MaxARCInstances = 50
+
+// ARC chain validation states (RFC 8617, section 4.4).
+const (
+	ChainNone = "none"
+	ChainPass = "pass"
+	ChainFail = "fail"
+)
+
+const (
+	arcSealHeader      = "ARC-Seal"
+	arcSignatureHeader = "ARC-Message-Signature"
+	arcResultsHeader   = "ARC-Authentication-Results"
+)
+
+// ARCResult is the outcome of validating the ARC chain of a message.
+type ARCResult struct {
+	// Result is none when the message has no ARC headers, pass when every
+	// seal and the newest message signature verify, and fail otherwise.
+	Result string `json:"result"`
+
+	// OldestPass is the lowest instance from which every message signature
+	// up to the newest still verifies, i.e. the earliest hop after which
+	// the message was not modified. Zero when the chain did not pass.
+	OldestPass int `json:"oldest_pass,omitempty"`
+
+	Hops  []*ARCHop `json:"hops"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ARCHop is the verification result of one ARC set, added by one
+// intermediary.
+type ARCHop struct {
+	Instance  int    `json:"instance"`
+	Domain    string `json:"domain"`
+	Selector  string `json:"selector"`
+	Algorithm string `json:"algorithm"`
+
+	// ChainValidation is the cv= value the intermediary recorded for the
+	// chain it received.
+	ChainValidation string `json:"cv"`
+
+	// AuthenticationResults is what the intermediary saw when it received
+	// the message, e.g. "mx.example.net; spf=pass smtp.mailfrom=example.com".
+	AuthenticationResults string `json:"authentication_results"`
+
+	SealResult             Result `json:"seal_result"`
+	MessageSignatureResult Result `json:"message_signature_result"`
+	BodyHashMismatch       bool   `json:"body_hash_mismatch"`
+	Error                  string `json:"error,omitempty"`
+}
+
+// arcSet holds the three header fields of one ARC instance.
+type arcSet struct {
+	results, signature, seal *header
+}
+
+// VerifyARC validates the ARC chain of raw as described in RFC 8617,
+// section 5.2. Each hop's seal and message signature are reported, even
+// when an earlier check already failed the chain.
+func VerifyARC(ctx context.Context, r Resolver, raw string, now time.Time) *ARCResult {
+	m := parseMessage(raw)
+	result := &ARCResult{Result: ChainNone, Hops: []*ARCHop{}}
+
+	sets, err := collectARCSets(m)
+	if err != nil {
+		result.Result = ChainFail
+		result.Error = err.Error()
+		return result
+	}
+	n := len(sets)
+	if n == 0 {
+		return result
+	}
+
+	keys := make(map[string]*key)
+	cached := func(selector, domain string) (*key, error) {
+		name := selector + "._domainkey." + domain
+		if k, ok := keys[name]; ok {
+			return k, nil
+		}
+		k, err := fetchKey(ctx, r, selector, domain)
+		if err == nil {
+			keys[name] = k
+		}
+		return k, err
+	}
+
+	for i := 1; i <= n; i++ {
+		hop := &ARCHop{Instance: i, AuthenticationResults: arcResultsValue(sets[i].results)}
+		result.Hops = append(result.Hops, hop)
+
+		seal, cv, err := parseSeal(sets[i].seal.value())
+		if seal != nil {
+			hop.Domain, hop.Selector, hop.Algorithm, hop.ChainValidation = seal.domain, seal.selector, seal.algorithm, cv
+		}
+		if err != nil {
+			hop.SealResult = PermError
+			hop.Error = "seal: " + err.Error()
+		} else {
+			hop.SealResult, err = verifySeal(sets, i, seal, cached)
+			if err != nil {
+				hop.Error = "seal: " + err.Error()
+			}
+		}
+
+		hop.MessageSignatureResult, hop.BodyHashMismatch, err = verifyMessageSignature(m, sets[i].signature, now, cached)
+		if err != nil {
+			hop.Error = strings.TrimPrefix(hop.Error+"; message signature: "+err.Error(), "; ")
+		}
+	}
+
+	result.Result = ChainPass
+	newest := result.Hops[n-1]
+	switch {
+	case newest.ChainValidation == ChainFail:
+		result.Error = fmt.Sprintf("instance %d recorded a failed chain", n)
+	case newest.MessageSignatureResult != Pass:
+		result.Error = fmt.Sprintf("message signature of instance %d did not verify", n)
+	default:
+		for _, hop := range result.Hops {
+			want := ChainPass
+			if hop.Instance == 1 {
+				want = ChainNone
+			}
+			if hop.ChainValidation != want {
+				result.Error = fmt.Sprintf("instance %d has cv=%s, want cv=%s", hop.Instance, hop.ChainValidation, want)
+				break
+			}
+			if hop.SealResult != Pass {
+				result.Error = fmt.Sprintf("seal of instance %d did not verify", hop.Instance)
+				break
+			}
+		}
+	}
+	if result.Error != "" {
+		result.Result = ChainFail
+		return result
+	}
+
+	for i := n; i >= 1 && result.Hops[i-1].MessageSignatureResult == Pass; i-- {
+		result.OldestPass = i
+	}
+	return result
+}
+
+// collectARCSets groups the ARC header fields of m by instance. Sets must be
+// complete, unique and numbered 1 to N without gaps.
+func collectARCSets(m *message) (map[int]*arcSet, error) {
+	sets := make(map[int]*arcSet)
+	for i := range m.headers {
+		h := &m.headers[i]
+		var slot func(*arcSet) **header
+		switch {
+		case strings.EqualFold(h.name, arcSealHeader):
+			slot = func(s *arcSet) **header { return &s.seal }
+		case strings.EqualFold(h.name, arcSignatureHeader):
+			slot = func(s *arcSet) **header { return &s.signature }
+		case strings.EqualFold(h.name, arcResultsHeader):
+			slot = func(s *arcSet) **header { return &s.results }
+		default:
+			continue
+		}
+
+		instance, err := arcInstance(h.value())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", h.name, err)
+		}
+		if sets[instance] == nil {
+			sets[instance] = &arcSet{}
+		}
+		field := slot(sets[instance])
+		if *field != nil {
+			return nil, fmt.Errorf("duplicate %s for instance %d", h.name, instance)
+		}
+		*field = h
+	}
+
+	for i := 1; i <= len(sets); i++ {
+		s, ok := sets[i]
+		if !ok {
+			return nil, fmt.Errorf("instance %d is missing", i)
+		}
+		if s.results == nil || s.signature == nil || s.seal == nil {
+			return nil, fmt.Errorf("instance %d is incomplete", i)
+		}
+	}
+	return sets, nil
+}
+
+// arcInstance returns the i= tag that starts an ARC header value.
+func arcInstance(value string) (int, error) {
+	first, _, _ := strings.Cut(value, ";")
+	name, v, ok := strings.Cut(first, "=")
+	if !ok || strings.TrimSpace(name) != "i" {
+		return 0, errors.New("missing instance tag")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 || n > MaxARCInstances {
+		return 0, fmt.Errorf("invalid instance %q", strings.TrimSpace(v))
+	}
+	return n, nil
+}
+
+// arcResultsValue returns the value of an ARC-Authentication-Results field
+// without its instance tag.
+func arcResultsValue(h *header) string {
+	_, rest, _ := strings.Cut(h.value(), ";")
+	return strings.TrimSpace(rest)
+}
+
+// parseSeal parses an ARC-Seal tag list and returns it with its cv= value.
+func parseSeal(value string) (*signature, string, error) {
+	tags, err := parseTags(value)
+	if err != nil {
+		return nil, "", err
+	}
+	s := &signature{algorithm: tags["a"], domain: strings.ToLower(tags["d"]), selector: tags["s"]}
+	cv := strings.ToLower(tags["cv"])
+
+	for _, required := range []string{"a", "b", "cv", "d", "i", "s"} {
+		if _, ok := tags[required]; !ok {
+			return s, cv, fmt.Errorf("missing required tag %s=", required)
+		}
+	}
+	if _, ok := tags["h"]; ok {
+		return s, cv, errors.New("h= is not allowed in a seal")
+	}
+	if cv != ChainNone && cv != ChainPass && cv != ChainFail {
+		return s, cv, fmt.Errorf("invalid cv=%s", tags["cv"])
+	}
+	s.instance, _ = strconv.Atoi(tags["i"])
+
+	switch strings.ToLower(s.algorithm) {
+	case "rsa-sha256":
+		s.keyType, s.hash = "rsa", crypto.SHA256
+	case "ed25519-sha256":
+		s.keyType, s.hash = "ed25519", crypto.SHA256
+	default:
+		return s, cv, fmt.Errorf("unsupported algorithm %q", s.algorithm)
+	}
+	if s.b, err = decodeBase64(tags["b"]); err != nil {
+		return s, cv, fmt.Errorf("invalid b= tag: %w", err)
+	}
+	return s, cv, nil
+}
+
+// verifySeal verifies the seal of instance i, which covers every ARC set up
+// to and including its own, with relaxed header canonicalization.
+func verifySeal(sets map[int]*arcSet, i int, seal *signature, fetch func(selector, domain string) (*key, error)) (Result, error) {
+	k, err := fetch(seal.selector, seal.domain)
+	if err != nil {
+		return errorResult(err), err
+	}
+	if err := k.accepts(seal); err != nil {
+		return PermError, err
+	}
+	if err := k.verify(seal, []byte(sealedData(sets, i))); err != nil {
+		return Fail, err
+	}
+	return Pass, nil
+}
+
+// sealedData returns the canonicalized header fields covered by the seal of
+// instance i.
+func sealedData(sets map[int]*arcSet, i int) string {
+	var b strings.Builder
+	for j := 1; j <= i; j++ {
+		b.WriteString(canonicalHeader(sets[j].results.raw, "relaxed"))
+		b.WriteString(canonicalHeader(sets[j].signature.raw, "relaxed"))
+		if j < i {
+			b.WriteString(canonicalHeader(sets[j].seal.raw, "relaxed"))
+		}
+	}
+	b.WriteString(stripSignature(sets[i].seal.raw, "relaxed"))
+	return b.String()
+}
+
+// verifyMessageSignature verifies an ARC-Message-Signature, which works like
+// a DKIM signature over the message as the intermediary forwarded it.
+func verifyMessageSignature(m *message, h *header, now time.Time, fetch func(selector, domain string) (*key, error)) (Result, bool, error) {
+	sig, err := parseSignature(h.value(), true)
+	if err != nil {
+		return PermError, false, err
+	}
+	if sig.expires != nil && now.After(*sig.expires) {
+		return PermError, false, errors.New("signature expired")
+	}
+	k, err := fetch(sig.selector, sig.domain)
+	if err != nil {
+		return errorResult(err), false, err
+	}
+	if err := k.accepts(sig); err != nil {
+		return PermError, false, err
+	}
+	if !sig.bodyHashMatches(m.body) {
+		return Fail, true, errors.New("body hash did not verify")
+	}
+	data := signedHeaders(m.headers, sig.headers, sig.headerCanon) + stripSignature(h.raw, sig.headerCanon)
+	if err := k.verify(sig, []byte(data)); err != nil {
+		return Fail, false, err
+	}
+	return Pass, false, nil
+}
+
+// SealOptions configures Seal.
+type SealOptions struct {
+	Domain   string
+	Selector string
+
+	// Signer is an *rsa.PrivateKey or ed25519.PrivateKey.
+	Signer crypto.Signer
+
+	// AuthServID and Results form the ARC-Authentication-Results value,
+	// e.g. "mx.example.net" and "spf=pass smtp.mailfrom=example.com".
+	AuthServID string
+	Results    string
+
+	// Headers are the header fields the message signature covers;
+	// defaults to From, To, Subject, Date and Message-ID.
+	Headers []string
+
+	// ChainValidation overrides the cv= value, which otherwise is none for
+	// the first instance and pass for later ones.
+	ChainValidation string
+}
+
+// Seal adds the next ARC set to raw, as a forwarding intermediary would, and
+// returns the resulting message. Like Sign, it exists to build fixtures.
+func Seal(raw string, opts SealOptions) (string, error) {
+	algorithm, err := signingAlgorithm(opts.Signer)
+	if err != nil {
+		return "", err
+	}
+	raw = toCRLF(raw)
+	m := parseMessage(raw)
+	sets, err := collectARCSets(m)
+	if err != nil {
+		return "", err
+	}
+	i := len(sets) + 1
+	cv := opts.ChainValidation
+	if cv == "" {
+		cv = ChainPass
+		if i == 1 {
+			cv = ChainNone
+		}
+	}
+
+	results := fmt.Sprintf("%s: i=%d; %s;\r\n\t%s\r\n", arcResultsHeader, i, opts.AuthServID, opts.Results)
+	tags := fmt.Sprintf(" i=%d; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d;", i, algorithm, opts.Domain, opts.Selector, time.Now().Unix())
+	signature, err := signMessage(m, arcSignatureHeader, tags, opts.Headers, "relaxed/relaxed", opts.Signer)
+	if err != nil {
+		return "", err
+	}
+
+	sealValue := fmt.Sprintf(" i=%d; a=%s; t=%d; cv=%s;\r\n\td=%s; s=%s;\r\n\tb=", i, algorithm, time.Now().Unix(), cv, opts.Domain, opts.Selector)
+	sets[i] = &arcSet{
+		results:   &header{name: arcResultsHeader, raw: results},
+		signature: &header{name: arcSignatureHeader, raw: signature},
+		seal:      &header{name: arcSealHeader, raw: arcSealHeader + ":" + sealValue + "\r\n"},
+	}
+	b, err := sign(opts.Signer, []byte(sealedData(sets, i)))
+	if err != nil {
+		return "", err
+	}
+	seal := arcSealHeader + ":" + sealValue + base64.StdEncoding.EncodeToString(b) + "\r\n"
+	return seal + signature + results + raw, nil
+}
@@ -0,0 +1,159 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+)
+
+// header is one header field as it appears in the message, including its
+// name, any folding and the terminating CRLF.
+type header struct {
+	name string
+	raw  string
+}
+
+// message is a raw message split into header fields and body. Bare LF line
+// endings are converted to CRLF, as they would be on the wire.
+type message struct {
+	headers []header
+	body    []byte
+}
+
+func parseMessage(raw string) *message {
+	raw = toCRLF(raw)
+	m := &message{}
+
+	headerBlock, body, found := strings.Cut(raw, "\r\n\r\n")
+	if found {
+		m.body = []byte(body)
+		headerBlock += "\r\n"
+	} else if strings.HasPrefix(raw, "\r\n") {
+		m.body = []byte(raw[2:])
+		headerBlock = ""
+	}
+
+	for _, line := range strings.SplitAfter(headerBlock, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(m.headers) > 0 {
+			m.headers[len(m.headers)-1].raw += line
+			continue
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		m.headers = append(m.headers, header{name: strings.TrimRight(name, " \t"), raw: line})
+	}
+	return m
+}
+
+// toCRLF converts bare LF line endings to CRLF.
+func toCRLF(s string) string {
+	if !strings.Contains(s, "\n") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// value returns the unfolded value of a header field, with runs of
+// whitespace collapsed to a single space.
+func (h header) value() string {
+	_, v, _ := strings.Cut(h.raw, ":")
+	return strings.TrimSpace(collapseWSP(strings.ReplaceAll(v, "\r\n", "")))
+}
+
+// canonicalHeader canonicalizes a header field with the simple or relaxed
+// algorithm. The result ends in CRLF.
+func canonicalHeader(raw, algorithm string) string {
+	if algorithm == "simple" {
+		return raw
+	}
+	name, value, _ := strings.Cut(raw, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.TrimSpace(collapseWSP(value)) + "\r\n"
+}
+
+// canonicalBody canonicalizes a body with the simple or relaxed algorithm.
+func canonicalBody(body []byte, algorithm string) []byte {
+	if algorithm == "relaxed" {
+		lines := bytes.SplitAfter(body, []byte("\r\n"))
+		var b bytes.Buffer
+		for _, line := range lines {
+			content, hasCRLF := bytes.CutSuffix(line, []byte("\r\n"))
+			b.WriteString(strings.TrimRight(collapseWSP(string(content)), " "))
+			if hasCRLF {
+				b.WriteString("\r\n")
+			}
+		}
+		body = b.Bytes()
+	}
+
+	// Both algorithms ignore empty lines at the end of the body, and
+	// terminate a non-empty body with CRLF.
+	for bytes.HasSuffix(body, []byte("\r\n")) {
+		body = body[:len(body)-2]
+	}
+	if len(body) == 0 {
+		if algorithm == "simple" {
+			return []byte("\r\n")
+		}
+		return nil
+	}
+	return append(body, '\r', '\n')
+}
+
+// collapseWSP replaces each run of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// signedHeaders returns the canonicalized fields named in names, choosing
+// the last unused instance of each name so repeated names sign successive
+// instances from the bottom up. Names without a remaining instance
+// contribute nothing.
+func signedHeaders(headers []header, names []string, algorithm string) string {
+	used := make(map[int]bool)
+	var b strings.Builder
+	for _, name := range names {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				b.WriteString(canonicalHeader(headers[i].raw, algorithm))
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// stripSignature returns a signature header field with the value of its b=
+// tag removed and no terminating CRLF, as it is included in its own hash.
+func stripSignature(raw, algorithm string) string {
+	name, value, _ := strings.Cut(raw, ":")
+	tags := strings.Split(value, ";")
+	for i, tag := range tags {
+		if k, _, ok := strings.Cut(tag, "="); ok && strings.TrimSpace(strings.ReplaceAll(k, "\r\n", "")) == "b" {
+			tags[i] = k + "="
+		}
+	}
+	return strings.TrimSuffix(canonicalHeader(name+":"+strings.Join(tags, ";"), algorithm), "\r\n")
+}
@@ -0,0 +1,500 @@
+// Package dkim verifies DomainKeys Identified Mail signatures (RFC 6376).
+//
+// Verify checks every DKIM-Signature header of a raw message: it fetches the
+// selector's public key from DNS, recomputes the body hash and verifies the
+// header signature. Each signature is reported separately, since a message
+// commonly carries signatures from both the author's domain and the service
+// that sent it. rsa-sha256 and ed25519-sha256 (RFC 8463) are supported;
+// rsa-sha1 and RSA keys shorter than 1024 bits are rejected as RFC 8301
+// requires.
+//
+// VerifyARC validates Authenticated Received Chain headers (RFC 8617), which
+// reuse the same signature format to let forwarders vouch for the
+// authentication results they saw before modifying a message.
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/resolver"
+)
+
+// Result is the outcome of verifying one signature, using the values of
+// RFC 8601 Authentication-Results.
+type Result string
+
+const (
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+// MaxSignatures is the number of signatures verified per message. Further
+// signatures are ignored so a message cannot trigger unbounded key lookups.
+const MaxSignatures = 10
+
+// minRSABits is the smallest RSA key accepted (RFC 8301, section 3.2).
+const minRSABits = 1024
+
+// Resolver is the subset of *net.Resolver used to fetch keys.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Signature is the verification result of one DKIM-Signature header.
+type Signature struct {
+	Domain           string     `json:"domain"`
+	Selector         string     `json:"selector"`
+	Algorithm        string     `json:"algorithm"`
+	Canonicalization string     `json:"canonicalization"`
+	Identity         string     `json:"identity,omitempty"`
+	SignedHeaders    []string   `json:"signed_headers"`
+	BodyLength       *int64     `json:"body_length,omitempty"`
+	SignedAt         *time.Time `json:"signed_at,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	KeyBits          int        `json:"key_bits,omitempty"`
+	Testing          bool       `json:"testing,omitempty"`
+	Result           Result     `json:"result"`
+	Valid            bool       `json:"valid"`
+	BodyHashMismatch bool       `json:"body_hash_mismatch"`
+	Error            string     `json:"error,omitempty"`
+}
+
+// Verify verifies the DKIM signatures of raw, in the order they appear in
+// the message. It returns an empty slice when the message is unsigned.
+func Verify(ctx context.Context, r Resolver, raw string, now time.Time) []*Signature {
+	m := parseMessage(raw)
+	results := []*Signature{}
+	for _, h := range m.headers {
+		if !strings.EqualFold(h.name, "DKIM-Signature") {
+			continue
+		}
+		if len(results) == MaxSignatures {
+			break
+		}
+		results = append(results, verifySignature(ctx, r, m, h, now))
+	}
+	return results
+}
+
+// verifySignature verifies one signature header.
+func verifySignature(ctx context.Context, r Resolver, m *message, h header, now time.Time) *Signature {
+	s := &Signature{SignedHeaders: []string{}}
+	sig, err := parseSignature(h.value(), false)
+	if sig != nil {
+		sig.describe(s)
+	}
+	if err != nil {
+		return s.fail(PermError, err)
+	}
+	if sig.expires != nil && now.After(*sig.expires) {
+		return s.fail(PermError, errors.New("signature expired"))
+	}
+
+	k, err := fetchKey(ctx, r, sig.selector, sig.domain)
+	if err != nil {
+		return s.fail(errorResult(err), err)
+	}
+	s.KeyBits = k.bits
+	s.Testing = k.testing
+	if err := k.accepts(sig); err != nil {
+		return s.fail(PermError, err)
+	}
+
+	if !sig.bodyHashMatches(m.body) {
+		s.BodyHashMismatch = true
+		return s.fail(Fail, errors.New("body hash did not verify"))
+	}
+
+	data := signedHeaders(m.headers, sig.headers, sig.headerCanon) + stripSignature(h.raw, sig.headerCanon)
+	if err := k.verify(sig, []byte(data)); err != nil {
+		return s.fail(Fail, err)
+	}
+	s.Result = Pass
+	s.Valid = true
+	return s
+}
+
+func (s *Signature) fail(res Result, err error) *Signature {
+	s.Result = res
+	s.Error = err.Error()
+	return s
+}
+
+// signature holds the parsed tags of a DKIM-Signature or
+// ARC-Message-Signature header.
+type signature struct {
+	algorithm   string
+	hash        crypto.Hash
+	keyType     string
+	b           []byte
+	bh          []byte
+	headerCanon string
+	bodyCanon   string
+	domain      string
+	selector    string
+	identity    string
+	headers     []string
+	length      *int64
+	signed      *time.Time
+	expires     *time.Time
+	instance    int
+}
+
+// parseSignature parses a signature tag list. ARC-Message-Signature headers
+// carry an instance tag instead of a version.
+func parseSignature(value string, arc bool) (*signature, error) {
+	tags, err := parseTags(value)
+	if err != nil {
+		return nil, err
+	}
+	s := &signature{
+		algorithm: tags["a"],
+		domain:    strings.ToLower(tags["d"]),
+		selector:  tags["s"],
+	}
+
+	if arc {
+		n, err := strconv.Atoi(tags["i"])
+		if err != nil || n < 1 {
+			return s, fmt.Errorf("invalid instance %q", tags["i"])
+		}
+		s.instance = n
+	} else {
+		if tags["v"] != "1" {
+			return s, fmt.Errorf("unsupported version %q", tags["v"])
+		}
+		s.identity = tags["i"]
+	}
+
+	for _, required := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if _, ok := tags[required]; !ok {
+			return s, fmt.Errorf("missing required tag %s=", required)
+		}
+	}
+
+	for _, name := range strings.Split(tags["h"], ":") {
+		if name = strings.TrimSpace(name); name != "" {
+			s.headers = append(s.headers, name)
+		}
+	}
+
+	s.headerCanon, s.bodyCanon = "simple", "simple"
+	if c, ok := tags["c"]; ok {
+		hc, bc, hasBody := strings.Cut(strings.ToLower(c), "/")
+		s.headerCanon = hc
+		if hasBody {
+			s.bodyCanon = bc
+		}
+		for _, v := range []string{s.headerCanon, s.bodyCanon} {
+			if v != "simple" && v != "relaxed" {
+				return s, fmt.Errorf("unsupported canonicalization %q", c)
+			}
+		}
+	}
+
+	if v, ok := tags["l"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return s, fmt.Errorf("invalid body length %q", v)
+		}
+		s.length = &n
+	}
+	if s.signed, err = parseTime(tags, "t"); err != nil {
+		return s, err
+	}
+	if s.expires, err = parseTime(tags, "x"); err != nil {
+		return s, err
+	}
+	if s.signed != nil && s.expires != nil && s.expires.Before(*s.signed) {
+		return s, errors.New("expiration precedes signing time")
+	}
+
+	if !arc {
+		if !containsFold(s.headers, "From") {
+			return s, errors.New("From header is not signed")
+		}
+		if s.identity != "" {
+			_, idDomain, _ := strings.Cut(s.identity, "@")
+			idDomain = strings.ToLower(idDomain)
+			if idDomain != s.domain && !strings.HasSuffix(idDomain, "."+s.domain) {
+				return s, fmt.Errorf("identity %s is not within %s", s.identity, s.domain)
+			}
+		}
+	}
+
+	switch strings.ToLower(s.algorithm) {
+	case "rsa-sha256":
+		s.keyType, s.hash = "rsa", crypto.SHA256
+	case "ed25519-sha256":
+		s.keyType, s.hash = "ed25519", crypto.SHA256
+	case "rsa-sha1":
+		return s, errors.New("rsa-sha1 signatures are not accepted (RFC 8301)")
+	default:
+		return s, fmt.Errorf("unsupported algorithm %q", s.algorithm)
+	}
+
+	if s.b, err = decodeBase64(tags["b"]); err != nil {
+		return s, fmt.Errorf("invalid b= tag: %w", err)
+	}
+	if s.bh, err = decodeBase64(tags["bh"]); err != nil {
+		return s, fmt.Errorf("invalid bh= tag: %w", err)
+	}
+	return s, nil
+}
+
+// describe copies the descriptive fields of s into out.
+func (s *signature) describe(out *Signature) {
+	out.Domain = s.domain
+	out.Selector = s.selector
+	out.Algorithm = s.algorithm
+	if s.headerCanon != "" {
+		out.Canonicalization = s.headerCanon + "/" + s.bodyCanon
+	}
+	out.Identity = s.identity
+	if s.headers != nil {
+		out.SignedHeaders = s.headers
+	}
+	out.BodyLength = s.length
+	out.SignedAt = s.signed
+	out.ExpiresAt = s.expires
+}
+
+// bodyHashMatches reports whether the canonicalized body hashes to bh.
+func (s *signature) bodyHashMatches(body []byte) bool {
+	return string(s.bodyHash(body)) == string(s.bh)
+}
+
+func (s *signature) bodyHash(body []byte) []byte {
+	canon := canonicalBody(body, s.bodyCanon)
+	if s.length != nil && *s.length < int64(len(canon)) {
+		canon = canon[:*s.length]
+	}
+	h := s.hash.New()
+	h.Write(canon)
+	return h.Sum(nil)
+}
+
+// key is a public key published in a DKIM key record.
+type key struct {
+	keyType string
+	rsa     *rsa.PublicKey
+	ed25519 ed25519.PublicKey
+	bits    int
+	hashes  []string
+	testing bool
+	strict  bool
+}
+
+// fetchKey retrieves the key record for selector and domain.
+func fetchKey(ctx context.Context, r Resolver, selector, domain string) (*key, error) {
+	name := selector + "._domainkey." + domain
+	txts, err := r.LookupTXT(ctx, resolver.FQDN(name))
+	if err != nil {
+		if resolver.NotFound(err) {
+			return nil, permError("no key record at %s", name)
+		}
+		return nil, tempError("key lookup for %s failed: %v", name, err)
+	}
+	if len(txts) == 0 {
+		return nil, permError("no key record at %s", name)
+	}
+	k, err := parseKey(txts[0])
+	if err != nil {
+		return nil, permError("invalid key record at %s: %v", name, err)
+	}
+	return k, nil
+}
+
+func parseKey(record string) (*key, error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, fmt.Errorf("unsupported version %q", v)
+	}
+
+	k := &key{keyType: "rsa"}
+	if v, ok := tags["k"]; ok {
+		k.keyType = strings.ToLower(v)
+	}
+	if v, ok := tags["h"]; ok {
+		for _, h := range strings.Split(v, ":") {
+			k.hashes = append(k.hashes, strings.ToLower(strings.TrimSpace(h)))
+		}
+	}
+	for _, flag := range strings.Split(tags["t"], ":") {
+		switch strings.TrimSpace(flag) {
+		case "y":
+			k.testing = true
+		case "s":
+			k.strict = true
+		}
+	}
+
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("missing p= tag")
+	}
+	if p == "" {
+		return nil, errors.New("key has been revoked")
+	}
+	der, err := decodeBase64(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p= tag: %w", err)
+	}
+
+	switch k.keyType {
+	case "rsa":
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			// Some publishers use a bare PKCS #1 RSAPublicKey.
+			if pub, err = x509.ParsePKCS1PublicKey(der); err != nil {
+				return nil, errors.New("invalid RSA public key")
+			}
+		}
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("p= is not an RSA public key")
+		}
+		k.rsa = rsaKey
+		k.bits = rsaKey.N.BitLen()
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		k.ed25519 = ed25519.PublicKey(der)
+		k.bits = 256
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.keyType)
+	}
+	return k, nil
+}
+
+// accepts checks that the key may verify sig.
+func (k *key) accepts(sig *signature) error {
+	if k.keyType != sig.keyType {
+		return fmt.Errorf("key type %s does not match algorithm %s", k.keyType, sig.algorithm)
+	}
+	if k.hashes != nil && !containsFold(k.hashes, "sha256") {
+		return fmt.Errorf("key does not permit sha256")
+	}
+	if k.rsa != nil && k.bits < minRSABits {
+		return fmt.Errorf("RSA key of %d bits is too short", k.bits)
+	}
+	if k.strict && sig.identity != "" {
+		if _, idDomain, _ := strings.Cut(sig.identity, "@"); !strings.EqualFold(idDomain, sig.domain) {
+			return fmt.Errorf("key forbids subdomain identity %s", sig.identity)
+		}
+	}
+	return nil
+}
+
+// verify checks the signature of the canonicalized header data.
+func (k *key) verify(sig *signature, data []byte) error {
+	digest := sha256.Sum256(data)
+	switch {
+	case k.rsa != nil:
+		if err := rsa.VerifyPKCS1v15(k.rsa, crypto.SHA256, digest[:], sig.b); err != nil {
+			return errors.New("signature did not verify")
+		}
+	case k.ed25519 != nil:
+		if !ed25519.Verify(k.ed25519, digest[:], sig.b) {
+			return errors.New("signature did not verify")
+		}
+	}
+	return nil
+}
+
+// parseTags parses a tag=value list. Whitespace around tags and values is
+// ignored; duplicate tags are an error.
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		name = strings.TrimSpace(name)
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("duplicate tag %s=", name)
+		}
+		tags[name] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
+
+// decodeBase64 decodes a base64 tag value, ignoring embedded whitespace.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+	return base64.StdEncoding.DecodeString(s)
+}
+
+func parseTime(tags map[string]string, name string) (*time.Time, error) {
+	v, ok := tags[name]
+	if !ok {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %s= tag %q", name, v)
+	}
+	t := time.Unix(n, 0).UTC()
+	return &t, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyError is an error that determines the verification result.
+type verifyError struct {
+	result Result
+	msg    string
+}
+
+func (e *verifyError) Error() string { return e.msg }
+
+func permError(format string, args ...any) error {
+	return &verifyError{result: PermError, msg: fmt.Sprintf(format, args...)}
+}
+
+func tempError(format string, args ...any) error {
+	return &verifyError{result: TempError, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorResult returns the result a verification error maps to.
+func errorResult(err error) Result {
+	var e *verifyError
+	if errors.As(err, &e) {
+		return e.result
+	}
+	return PermError
+}
@@ -0,0 +1,322 @@
+// Package dmarc evaluates Domain-based Message Authentication, Reporting and
+// Conformance policies (RFC 7489).
+//
+// Evaluate discovers the policy of a message's From domain, falling back to
+// its organizational domain, checks whether a passing SPF or DKIM result is
+// aligned with the From domain, and derives the disposition the domain owner
+// requests for the message. SPF and DKIM themselves are evaluated by the spf
+// and dkim packages; this package only consumes their outcomes.
+package dmarc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/resolver"
+)
+
+// Result is the DMARC verdict for a message.
+type Result string
+
+const (
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	None      Result = "none"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+// Dispositions requested by a policy.
+const (
+	DispositionNone       = "none"
+	DispositionQuarantine = "quarantine"
+	DispositionReject     = "reject"
+)
+
+// Resolver is the subset of *net.Resolver used to fetch policies.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Identifier is a domain authenticated, or not, by SPF or DKIM. Only a
+// "pass" result can produce DMARC alignment.
+type Identifier struct {
+	Domain string `json:"domain"`
+	Result string `json:"result"`
+}
+
+// Input holds the authentication outcomes of a message.
+type Input struct {
+	FromDomain string
+	SPF        *Identifier
+	DKIM       []Identifier
+}
+
+// Policy is a parsed DMARC record.
+type Policy struct {
+	Policy          string   `json:"p"`
+	SubdomainPolicy string   `json:"sp,omitempty"`
+	DKIMAlignment   string   `json:"adkim"`
+	SPFAlignment    string   `json:"aspf"`
+	Percentage      int      `json:"pct"`
+	RUA             []string `json:"rua"`
+	RUF             []string `json:"ruf"`
+	FailureOptions  string   `json:"fo,omitempty"`
+}
+
+// Alignment reports whether an authenticated identifier aligns with the
+// From domain.
+type Alignment struct {
+	Identifier
+	Aligned bool `json:"aligned"`
+}
+
+// Evaluation is the outcome of a DMARC check.
+type Evaluation struct {
+	Result       Result      `json:"result"`
+	FromDomain   string      `json:"from_domain"`
+	PolicyDomain string      `json:"policy_domain,omitempty"`
+	Record       string      `json:"record,omitempty"`
+	Policy       *Policy     `json:"policy,omitempty"`
+	SPF          *Alignment  `json:"spf,omitempty"`
+	DKIM         []Alignment `json:"dkim"`
+
+	// Disposition is what the domain owner requests for the message.
+	// When the policy samples fewer than 100% of failing messages, the
+	// rest receive FallbackDisposition.
+	Disposition         string `json:"disposition"`
+	Percentage          int    `json:"percentage"`
+	FallbackDisposition string `json:"fallback_disposition,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Evaluate checks in against the DMARC policy of its From domain.
+func Evaluate(ctx context.Context, r Resolver, in Input) *Evaluation {
+	from := normalize(in.FromDomain)
+	e := &Evaluation{
+		Result:      None,
+		FromDomain:  from,
+		DKIM:        []Alignment{},
+		Disposition: DispositionNone,
+		Percentage:  100,
+	}
+
+	policyDomain, record, policy, err := Discover(ctx, r, from)
+	if err != nil {
+		e.Result = TempError
+		e.Error = err.Error()
+		return e
+	}
+	if policy == nil {
+		return e
+	}
+	e.PolicyDomain = policyDomain
+	e.Record = record
+	e.Policy = policy
+	e.Percentage = policy.Percentage
+
+	pass := false
+	if in.SPF != nil {
+		a := align(*in.SPF, from, policy.SPFAlignment)
+		e.SPF = &a
+		pass = pass || a.Aligned
+	}
+	for _, id := range in.DKIM {
+		a := align(id, from, policy.DKIMAlignment)
+		e.DKIM = append(e.DKIM, a)
+		pass = pass || a.Aligned
+	}
+	if pass {
+		e.Result = Pass
+		return e
+	}
+
+	e.Result = Fail
+	e.Disposition = policy.Policy
+	if policyDomain != from && policy.SubdomainPolicy != "" {
+		e.Disposition = policy.SubdomainPolicy
+	}
+	if policy.Percentage < 100 {
+		e.FallbackDisposition = weaker(e.Disposition)
+	}
+	return e
+}
+
+// align reports whether id passed and is aligned with from in mode "s"
+// (strict: identical domains) or "r" (relaxed: same organizational domain).
+func align(id Identifier, from, mode string) Alignment {
+	id.Domain = normalize(id.Domain)
+	id.Result = strings.ToLower(id.Result)
+	a := Alignment{Identifier: id}
+	if id.Result != "pass" || id.Domain == "" {
+		return a
+	}
+	if mode == "s" {
+		a.Aligned = id.Domain == from
+	} else {
+		a.Aligned = OrganizationalDomain(id.Domain) == OrganizationalDomain(from)
+	}
+	return a
+}
+
+// weaker returns the disposition applied to failing messages outside the
+// sampled percentage (RFC 7489, section 6.6.4).
+func weaker(disposition string) string {
+	switch disposition {
+	case DispositionReject:
+		return DispositionQuarantine
+	default:
+		return DispositionNone
+	}
+}
+
+// OrganizationalDomain returns the registered domain of domain according to
+// the Public Suffix List, or domain itself when it is a public suffix.
+func OrganizationalDomain(domain string) string {
+	org, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+	return org
+}
+
+// Discover looks up the policy of domain, falling back to its
+// organizational domain, and returns the domain that publishes it, the
+// record and the parsed policy. A nil policy without error means neither
+// publishes a usable record.
+func Discover(ctx context.Context, r Resolver, domain string) (string, string, *Policy, error) {
+	candidates := []string{domain}
+	if org := OrganizationalDomain(domain); org != domain {
+		candidates = append(candidates, org)
+	}
+	for _, d := range candidates {
+		record, err := lookup(ctx, r, d)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if record == "" {
+			continue
+		}
+		policy, err := ParseRecord(record)
+		if err != nil {
+			// An invalid record is treated as absent (RFC 7489,
+			// section 6.6.3).
+			continue
+		}
+		return d, record, policy, nil
+	}
+	return "", "", nil, nil
+}
+
+// lookup returns the DMARC record published for domain, or "" when there is
+// none or more than one.
+func lookup(ctx context.Context, r Resolver, domain string) (string, error) {
+	txts, err := r.LookupTXT(ctx, resolver.FQDN("_dmarc."+domain))
+	if err != nil {
+		if resolver.NotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("DMARC lookup for %s failed: %w", domain, err)
+	}
+	var records []string
+	for _, txt := range txts {
+		if v, _, _ := strings.Cut(txt, ";"); strings.EqualFold(strings.TrimSpace(v), "v=DMARC1") {
+			records = append(records, txt)
+		}
+	}
+	if len(records) != 1 {
+		return "", nil
+	}
+	return records[0], nil
+}
+
+// ParseRecord parses a DMARC record. A record without a p= tag is accepted
+// as p=none when it requests aggregate reports.
+func ParseRecord(record string) (*Policy, error) {
+	p := &Policy{DKIMAlignment: "r", SPFAlignment: "r", Percentage: 100, RUA: []string{}, RUF: []string{}}
+	seenPolicy := false
+	for i, part := range strings.Split(record, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed tag %q", part)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		switch name {
+		case "v":
+			if i != 0 || value != "DMARC1" {
+				return nil, fmt.Errorf("record must start with v=DMARC1")
+			}
+		case "p", "sp":
+			v := strings.ToLower(value)
+			if v != DispositionNone && v != DispositionQuarantine && v != DispositionReject {
+				return nil, fmt.Errorf("invalid %s=%s", name, value)
+			}
+			if name == "p" {
+				p.Policy, seenPolicy = v, true
+			} else {
+				p.SubdomainPolicy = v
+			}
+		case "adkim", "aspf":
+			v := strings.ToLower(value)
+			if v != "r" && v != "s" {
+				return nil, fmt.Errorf("invalid %s=%s", name, value)
+			}
+			if name == "adkim" {
+				p.DKIMAlignment = v
+			} else {
+				p.SPFAlignment = v
+			}
+		case "pct":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("invalid pct=%s", value)
+			}
+			p.Percentage = n
+		case "rua", "ruf":
+			uris := reportURIs(value)
+			if name == "rua" {
+				p.RUA = uris
+			} else {
+				p.RUF = uris
+			}
+		case "fo":
+			p.FailureOptions = value
+		}
+	}
+
+	if !seenPolicy {
+		if len(p.RUA) == 0 {
+			return nil, fmt.Errorf("missing p= tag")
+		}
+		p.Policy = DispositionNone
+	}
+	return p, nil
+}
+
+// reportURIs splits a comma-separated list of reporting URIs, dropping any
+// "!size" limits.
+func reportURIs(value string) []string {
+	uris := []string{}
+	for _, uri := range strings.Split(value, ",") {
+		uri, _, _ = strings.Cut(strings.TrimSpace(uri), "!")
+		if uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
@@ -0,0 +1,196 @@
+// Package dnsbl queries DNS blocklists for IP addresses and domains.
+//
+// Spamhaus zones can be queried through the Data Query Service (DQS): with
+// a DQS key, a public zone such as zen.spamhaus.org is queried as
+// <key>.zen.dq.spamhaus.net. The public Spamhaus mirrors refuse queries
+// from public and cloud resolvers, which DQS answers. The key is part of
+// every query name, so zones are reported under their DQS name without it
+// (zen.dq.spamhaus.net) and it never appears in results or errors.
+//
+// Spamhaus return codes are explained in results, so a listing says
+// whether an address is a known spam source, an exploited host or an
+// end-user range that should not send mail directly.
+package dnsbl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"spamassassin-mcp/internal/resolver"
+)
+
+const (
+	spamhausPublic = ".spamhaus.org"
+	spamhausDQS    = ".dq.spamhaus.net"
+)
+
+// Resolver is the subset of *net.Resolver used for blocklist lookups.
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// Zone is a blocklist. Name is how it is reported; the zone queried may
+// differ, holding a DQS key.
+type Zone struct {
+	Name  string
+	query string
+}
+
+// Zones returns the blocklists named, querying Spamhaus zones through DQS
+// when dqsKey is set.
+func Zones(names []string, dqsKey string) []Zone {
+	zones := make([]Zone, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		zone := Zone{Name: name, query: name}
+		if list, ok := strings.CutSuffix(name, spamhausPublic); ok && dqsKey != "" && !strings.Contains(list, ".") {
+			zone.Name = list + spamhausDQS
+			zone.query = dqsKey + "." + list + spamhausDQS
+		}
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// Result is the answer of one zone for one address or domain. Codes
+// explains the answers of Spamhaus zones.
+type Result struct {
+	Zone    string   `json:"zone"`
+	Listed  bool     `json:"listed"`
+	Answers []string `json:"answers,omitempty"`
+	Codes   []string `json:"codes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// LookupIP queries z for ip.
+func (z Zone) LookupIP(ctx context.Context, r Resolver, ip string) (*Result, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	return z.lookup(ctx, r, reverse(addr.Unmap()), ip)
+}
+
+// LookupDomain queries z for domain.
+func (z Zone) LookupDomain(ctx context.Context, r Resolver, domain string) (*Result, error) {
+	return z.lookup(ctx, r, strings.TrimSuffix(domain, "."), domain)
+}
+
+// lookup queries name in z. A listing is an address in 127.0.0.0/8;
+// 127.0.0.1 and 127.255.255.0/24 are the answers URIBL and Spamhaus give
+// for refused queries, e.g. from public resolvers, and are errors.
+func (z Zone) lookup(ctx context.Context, r Resolver, name, subject string) (*Result, error) {
+	result := &Result{Zone: z.Name}
+	ips, err := r.LookupIP(ctx, "ip4", resolver.FQDN(name+"."+z.query))
+	if err != nil {
+		if resolver.NotFound(err) {
+			return result, nil
+		}
+		return nil, fmt.Errorf("%s lookup for %s failed: %s", z.Name, subject, z.redact(err.Error()))
+	}
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		if ip4 == nil || ip4[0] != 127 {
+			continue
+		}
+		if ip4.Equal(net.IPv4(127, 0, 0, 1)) || (ip4[1] == 255 && ip4[2] == 255) {
+			err := fmt.Errorf("%s refused the query for %s (%s)", z.Name, subject, ip4)
+			if reason := refusals[ip4[3]]; reason != "" && z.spamhaus() {
+				err = fmt.Errorf("%s refused the query for %s (%s: %s)", z.Name, subject, ip4, reason)
+			}
+			return nil, err
+		}
+		answer := ip4.String()
+		if !slices.Contains(result.Answers, answer) {
+			result.Answers = append(result.Answers, answer)
+			if code := z.code(ip4); code != "" {
+				result.Codes = append(result.Codes, code)
+			}
+		}
+	}
+	result.Listed = len(result.Answers) > 0
+	return result, nil
+}
+
+// redact removes the DQS key from a resolver error, which may name the
+// query.
+func (z Zone) redact(msg string) string {
+	if z.query == z.Name {
+		return msg
+	}
+	return strings.ReplaceAll(msg, z.query, z.Name)
+}
+
+func (z Zone) spamhaus() bool {
+	return strings.HasSuffix(z.Name, spamhausPublic) || strings.HasSuffix(z.Name, spamhausDQS)
+}
+
+// code explains a Spamhaus answer.
+func (z Zone) code(ip net.IP) string {
+	if !z.spamhaus() {
+		return ""
+	}
+	switch {
+	case ip[1] == 0 && ip[2] == 0:
+		return ipCodes[ip[3]]
+	case ip[1] == 0 && ip[2] == 1:
+		return domainCodes[ip[3]]
+	}
+	return ""
+}
+
+// ipCodes are the answers of zen, sbl, xbl, pbl and sbl-xbl, in
+// 127.0.0.0/24.
+var ipCodes = map[byte]string{
+	2:  "SBL: known spam source",
+	3:  "SBL CSS: snowshoe spam source",
+	4:  "XBL: exploited or infected host",
+	5:  "XBL: exploited or infected host",
+	6:  "XBL: exploited or infected host",
+	7:  "XBL: exploited or infected host",
+	9:  "SBL DROP: hijacked or criminal network",
+	10: "PBL: end-user range, listed by the ISP",
+	11: "PBL: end-user range, listed by Spamhaus",
+}
+
+// domainCodes are the answers of dbl, in 127.0.1.0/24.
+var domainCodes = map[byte]string{
+	2:   "spam domain",
+	4:   "phishing domain",
+	5:   "malware domain",
+	6:   "botnet C&C domain",
+	102: "abused legitimate spam domain",
+	103: "abused legitimate spammed redirector",
+	104: "abused legitimate phishing domain",
+	105: "abused legitimate malware domain",
+	106: "abused legitimate botnet C&C domain",
+}
+
+// refusals are the Spamhaus error answers, in 127.255.255.0/24.
+var refusals = map[byte]string{
+	250: "DQS key not recognised",
+	252: "typing error in the zone name",
+	254: "query through a public or open resolver; use DQS",
+	255: "excessive number of queries; use DQS",
+}
+
+// reverse returns the name an address is listed under: the octets of an
+// IPv4 address, or the nibbles of an IPv6 address, in reverse order.
+func reverse(addr netip.Addr) string {
+	b := addr.AsSlice()
+	var parts []string
+	if addr.Is4() {
+		for i := len(b) - 1; i >= 0; i-- {
+			parts = append(parts, fmt.Sprint(b[i]))
+		}
+	} else {
+		for i := len(b) - 1; i >= 0; i-- {
+			parts = append(parts, fmt.Sprintf("%x", b[i]&0x0f), fmt.Sprintf("%x", b[i]>>4))
+		}
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,213 @@
+// Package dnstest provides a scriptable in-process DNS server for tests.
+//
+// The server answers queries over UDP on a loopback port from a fixed set of
+// records, so the sender authentication checks can be exercised end to end
+// through a real resolver. Names without records answer NXDOMAIN; names
+// marked with Fail answer SERVFAIL.
+//
+// Typical use:
+//
+//	srv := dnstest.NewServer()
+//	defer srv.Close()
+//	srv.AddTXT("example.com", "v=spf1 ip4:192.0.2.0/24 -all")
+//	resolver := resolver.New(config.DNSConfig{Server: srv.Addr()})
+package dnstest
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Server is a fake authoritative DNS server.
+type Server struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	records map[string][]dnsmessage.Resource
+	fail    map[string]bool
+	queries []string
+}
+
+// NewServer starts a server on a loopback UDP port.
+func NewServer() *Server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic("dnstest: failed to listen: " + err.Error())
+	}
+	s := &Server{
+		conn:    conn,
+		records: make(map[string][]dnsmessage.Resource),
+		fail:    make(map[string]bool),
+	}
+	go s.serve()
+	return s
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.conn.Close()
+}
+
+// AddTXT adds a TXT record. Values longer than 255 bytes are split into
+// several character strings, as real zones do.
+func (s *Server) AddTXT(name, value string) {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, value[:255])
+		value = value[255:]
+	}
+	parts = append(parts, value)
+	s.add(name, dnsmessage.TypeTXT, &dnsmessage.TXTResource{TXT: parts})
+}
+
+// AddA adds A or AAAA records, depending on the address family of each IP.
+func (s *Server) AddA(name string, ips ...string) {
+	for _, v := range ips {
+		ip := net.ParseIP(v)
+		if ip4 := ip.To4(); ip4 != nil {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			s.add(name, dnsmessage.TypeA, &a)
+		} else {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip.To16())
+			s.add(name, dnsmessage.TypeAAAA, &aaaa)
+		}
+	}
+}
+
+// AddMX adds an MX record.
+func (s *Server) AddMX(name string, pref uint16, host string) {
+	s.add(name, dnsmessage.TypeMX, &dnsmessage.MXResource{Pref: pref, MX: mustName(host)})
+}
+
+// AddPTR adds a PTR record for ip.
+func (s *Server) AddPTR(ip, host string) {
+	s.add(reverseName(net.ParseIP(ip)), dnsmessage.TypePTR, &dnsmessage.PTRResource{PTR: mustName(host)})
+}
+
+// Fail makes every query for name answer SERVFAIL.
+func (s *Server) Fail(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail[canonical(name)] = true
+}
+
+// Queries returns the names queried so far, in order, as "TYPE name".
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *Server) add(name string, typ dnsmessage.Type, body dnsmessage.ResourceBody) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name = canonical(name)
+	s.records[name] = append(s.records[name], dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: mustName(name), Type: typ, Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   body,
+	})
+}
+
+func (s *Server) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *Server) answer(query []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) == 0 {
+		return nil
+	}
+	q := msg.Questions[0]
+	name := canonical(q.Name.String())
+
+	s.mu.Lock()
+	s.queries = append(s.queries, q.Type.String()[len("Type"):]+" "+strings.TrimSuffix(name, "."))
+	records, known := s.records[name]
+	failed := s.fail[name]
+	s.mu.Unlock()
+
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 msg.Header.ID,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   msg.Header.RecursionDesired,
+			RecursionAvailable: true,
+		},
+		Questions: msg.Questions[:1],
+	}
+	switch {
+	case failed:
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+	case !known:
+		resp.Header.RCode = dnsmessage.RCodeNameError
+	default:
+		for _, r := range records {
+			if r.Header.Type == q.Type {
+				r.Header.Name = q.Name
+				resp.Answers = append(resp.Answers, r)
+			}
+		}
+	}
+
+	packed, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return packed
+}
+
+// canonical lower-cases name and makes it absolute.
+func canonical(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+func mustName(name string) dnsmessage.Name {
+	n, err := dnsmessage.NewName(canonical(name))
+	if err != nil {
+		panic("dnstest: invalid name " + name)
+	}
+	return n
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip.
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	const hex = "0123456789abcdef"
+	var b strings.Builder
+	ip = ip.To16()
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hex[ip[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
@@ -0,0 +1,156 @@
+// Package fcrdns verifies the reverse DNS of sending addresses.
+//
+// An address passes forward-confirmed reverse DNS (FCrDNS) when one of its
+// PTR names resolves back to it; anyone can publish a PTR name in a
+// domain they do not control, but only the domain owner can make it
+// resolve. Mail servers are expected to pass and to present a confirmed
+// name in HELO. PTR names that embed the address or describe dynamic,
+// dial-up and residential ranges mark hosts that should not send mail
+// directly, and are a strong sign of botnet spam.
+//
+// Security considerations:
+//   - At most maxNames PTR names are resolved per address
+//   - Results describe the DNS at the time of the check, which the owner of
+//     the reverse zone can change at will
+package fcrdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/resolver"
+)
+
+// maxNames bounds the PTR names resolved per address.
+const maxNames = 5
+
+// Resolver is the subset of *net.Resolver used for the checks.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// genericLabels are host name tokens of dynamic, dial-up and residential
+// ranges.
+var genericLabels = map[string]bool{
+	"dynamic": true, "dyn": true, "dhcp": true, "pool": true, "dialup": true, "dial": true,
+	"dsl": true, "adsl": true, "vdsl": true, "xdsl": true, "cable": true, "ppp": true,
+	"pppoe": true, "broadband": true, "client": true, "customer": true, "cust": true,
+	"residential": true, "res": true, "cpe": true, "user": true, "unassigned": true,
+}
+
+var labelSeparators = regexp.MustCompile(`[.\-_]+`)
+
+// Result is the reverse DNS verification of an address. Confirmed lists
+// the PTR names that resolve back to it. HeloMatch is set when a HELO name
+// was given, and reports whether it is one of the confirmed names or an
+// address literal of the address.
+type Result struct {
+	IP        string   `json:"ip"`
+	PTR       []string `json:"ptr"`
+	Confirmed []string `json:"confirmed,omitempty"`
+	FCrDNS    bool     `json:"fcrdns"`
+
+	// Generic names the PTR name that embeds the address or describes a
+	// dynamic or residential range, if any.
+	Generic string `json:"generic,omitempty"`
+
+	Helo      string `json:"helo,omitempty"`
+	HeloMatch *bool  `json:"helo_match,omitempty"`
+}
+
+// Verify looks up the PTR names of ip, resolves each back and compares
+// helo, which may be empty, with the names confirmed. An error is returned
+// when a lookup fails in a way that leaves the outcome undecided.
+func Verify(ctx context.Context, r Resolver, ip net.IP, helo string) (*Result, error) {
+	result := &Result{IP: ip.String(), PTR: make([]string, 0)}
+	names, err := r.LookupAddr(ctx, ip.String())
+	if err != nil && !resolver.NotFound(err) {
+		return nil, fmt.Errorf("PTR lookup for %s failed: %w", ip, err)
+	}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name != "" && !slices.Contains(result.PTR, name) {
+			result.PTR = append(result.PTR, name)
+		}
+	}
+
+	var forwardErr error
+	for _, name := range result.PTR[:min(len(result.PTR), maxNames)] {
+		addrs, err := r.LookupIPAddr(ctx, resolver.FQDN(name))
+		if err != nil {
+			if !resolver.NotFound(err) && forwardErr == nil {
+				forwardErr = fmt.Errorf("lookup of %s failed: %w", name, err)
+			}
+			continue
+		}
+		for _, addr := range addrs {
+			if addr.IP.Equal(ip) {
+				result.Confirmed = append(result.Confirmed, name)
+				break
+			}
+		}
+	}
+	result.FCrDNS = len(result.Confirmed) > 0
+	if !result.FCrDNS && forwardErr != nil {
+		return nil, forwardErr
+	}
+
+	for _, name := range result.PTR {
+		if Generic(name, ip) {
+			result.Generic = name
+			break
+		}
+	}
+
+	if helo = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(helo), ".")); helo != "" {
+		result.Helo = helo
+		match := slices.Contains(result.Confirmed, helo)
+		if strings.HasPrefix(helo, "[") {
+			match = ip.Equal(net.ParseIP(strings.TrimPrefix(strings.Trim(helo, "[]"), "ipv6:")))
+		}
+		result.HeloMatch = &match
+	}
+	return result, nil
+}
+
+// Generic reports whether name, a PTR name of ip, embeds the address, as
+// in 203-0-113-5.example.net or cb007105.example.net, or has a label of a
+// dynamic, dial-up or residential range below its registrable domain.
+func Generic(name string, ip net.IP) bool {
+	host := name
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+		host = strings.TrimSuffix(name, domain)
+	}
+	if host == "" {
+		return false
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		a, b, c, d := v4[0], v4[1], v4[2], v4[3]
+		dashed := "-" + labelSeparators.ReplaceAllString(host, "-")
+		for _, form := range []string{
+			fmt.Sprintf("-%d-%d-%d-%d-", a, b, c, d),
+			fmt.Sprintf("-%d-%d-%d-%d-", d, c, b, a),
+			fmt.Sprintf("%03d%03d%03d%03d", a, b, c, d),
+			fmt.Sprintf("%02x%02x%02x%02x", a, b, c, d),
+		} {
+			if strings.Contains(dashed, form) {
+				return true
+			}
+		}
+	}
+
+	for _, label := range labelSeparators.Split(host, -1) {
+		if genericLabels[strings.TrimRight(label, "0123456789")] {
+			return true
+		}
+	}
+	return false
+}
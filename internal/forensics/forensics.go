@@ -0,0 +1,236 @@
+// Package forensics reconstructs how a message travelled from its headers.
+//
+// Analyze rebuilds the Received hop chain in transit order with timestamps
+// and per-hop delays, identifies the originating IP address and flags
+// anomalies that suggest forged or tampered headers. The analysis is
+// independent of SpamAssassin scoring; the only network access is an
+// optional PTR lookup per relay, used to compare the name a client presented
+// in HELO with the name its address resolves to. Geolocate adds the country
+// and autonomous system of each relay from local GeoIP databases.
+//
+// Security considerations:
+//   - The number of hops parsed and PTR lookups made per message is bounded
+//   - Received headers are attacker-controlled below the first trusted
+//     relay, so results describe what the headers claim, not proof of origin
+package forensics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/geoip"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/resolver"
+)
+
+const (
+	// MaxHops is the number of Received headers analyzed, newest first.
+	MaxHops = 50
+
+	// maxPTRLookups bounds the PTR queries made per message.
+	maxPTRLookups = 10
+
+	// maxFutureSkew is how far the Date header may lie after the first
+	// Received timestamp (or the analysis time) before it is flagged, and
+	// maxPastSkew how far before.
+	maxFutureSkew = 15 * time.Minute
+	maxPastSkew   = 24 * time.Hour
+)
+
+// Anomaly types.
+const (
+	MissingMessageID  = "missing_message_id"
+	MissingDate       = "missing_date"
+	MissingReceived   = "missing_received"
+	DateSkew          = "date_skew"
+	MissingTimestamp  = "missing_timestamp"
+	NegativeDelay     = "negative_delay"
+	HeloPTRMismatch   = "helo_ptr_mismatch"
+	MissingPTR        = "missing_ptr"
+	TruncatedHopChain = "truncated_hop_chain"
+)
+
+// Resolver is the subset of *net.Resolver used for PTR lookups.
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Anomaly is a suspicious property of the header block. Hop is the index of
+// the hop concerned, or zero for message-level anomalies.
+type Anomaly struct {
+	Type        string `json:"type"`
+	Hop         int    `json:"hop,omitempty"`
+	Description string `json:"description"`
+}
+
+// Report is the result of a header analysis.
+type Report struct {
+	// Hops lists the relays in transit order, oldest first.
+	Hops []*Hop `json:"hops"`
+
+	// OriginatingIP is the public address of the earliest hop, falling back
+	// to X-Originating-IP when every hop is private. OriginatingHop is the
+	// index of that hop, or zero when the address came from the header.
+	OriginatingIP  string `json:"originating_ip,omitempty"`
+	OriginatingHop int    `json:"originating_hop,omitempty"`
+
+	// OriginatingGeo is the location of OriginatingIP, set by Geolocate.
+	OriginatingGeo *geoip.Location `json:"originating_geo,omitempty"`
+
+	MessageID string     `json:"message_id,omitempty"`
+	Date      *time.Time `json:"date,omitempty"`
+
+	// TransitSeconds is the time between the first and last Received
+	// timestamps.
+	TransitSeconds *int64 `json:"transit_seconds,omitempty"`
+
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// Analyze reconstructs the Received chain of email. When r is nil no PTR
+// lookups are made and the HELO/PTR comparison is skipped.
+func Analyze(ctx context.Context, r Resolver, email *model.ParsedEmail, now time.Time) *Report {
+	report := &Report{
+		Hops:      make([]*Hop, 0),
+		MessageID: email.MessageID,
+		Date:      email.Date,
+		Anomalies: make([]Anomaly, 0),
+	}
+	add := func(typ string, hop int, format string, args ...any) {
+		report.Anomalies = append(report.Anomalies, Anomaly{Type: typ, Hop: hop, Description: fmt.Sprintf(format, args...)})
+	}
+
+	if email.MessageID == "" {
+		add(MissingMessageID, 0, "message has no Message-ID header")
+	}
+	if email.Header("Date") == "" {
+		add(MissingDate, 0, "message has no Date header")
+	}
+
+	// Relays prepend their Received header, so the header order is newest
+	// first.
+	received := email.HeaderValues("Received")
+	if len(received) == 0 {
+		add(MissingReceived, 0, "message has no Received headers")
+	}
+	if len(received) > MaxHops {
+		add(TruncatedHopChain, 0, "only the newest %d of %d Received headers were analyzed", MaxHops, len(received))
+		received = received[:MaxHops]
+	}
+	for i := len(received) - 1; i >= 0; i-- {
+		hop := parseReceived(received[i])
+		hop.Index = len(report.Hops) + 1
+		report.Hops = append(report.Hops, hop)
+	}
+
+	var first, last, prev *time.Time
+	for _, hop := range report.Hops {
+		if hop.Received == nil {
+			add(MissingTimestamp, hop.Index, "Received header has no parseable timestamp")
+			continue
+		}
+		if prev != nil {
+			delay := int64(hop.Received.Sub(*prev) / time.Second)
+			hop.DelaySeconds = &delay
+			if delay < 0 {
+				add(NegativeDelay, hop.Index, "received %s before the previous hop", formatDuration(-delay))
+			}
+		}
+		if first == nil {
+			first = hop.Received
+		}
+		last, prev = hop.Received, hop.Received
+	}
+	if first != nil && last != first {
+		transit := int64(last.Sub(*first) / time.Second)
+		report.TransitSeconds = &transit
+	}
+
+	if email.Date != nil {
+		reference, what := now, "the time of analysis"
+		if first != nil {
+			reference, what = *first, "the first Received timestamp"
+		}
+		switch skew := email.Date.Sub(reference); {
+		case skew > maxFutureSkew:
+			add(DateSkew, 0, "Date header is %s after %s", formatDuration(int64(skew/time.Second)), what)
+		case first != nil && -skew > maxPastSkew:
+			add(DateSkew, 0, "Date header is %s before %s", formatDuration(int64(-skew/time.Second)), what)
+		}
+	}
+
+	for _, hop := range report.Hops {
+		if hop.IP != "" && !hop.Private {
+			report.OriginatingIP = hop.IP
+			report.OriginatingHop = hop.Index
+			break
+		}
+	}
+	if report.OriginatingIP == "" {
+		value := strings.Trim(strings.TrimSpace(email.Header("X-Originating-IP")), "[]")
+		if ip := net.ParseIP(value); ip != nil {
+			report.OriginatingIP = ip.String()
+		}
+	}
+
+	if r != nil {
+		checkPTR(ctx, r, report.Hops, add)
+	}
+	return report
+}
+
+// checkPTR looks up the reverse name of each public hop address and
+// compares it with the HELO name the client presented.
+func checkPTR(ctx context.Context, r Resolver, hops []*Hop, add func(string, int, string, ...any)) {
+	cache := make(map[string]*Hop)
+	lookups := 0
+	for _, hop := range hops {
+		if hop.IP == "" || hop.Private {
+			continue
+		}
+		if seen, ok := cache[hop.IP]; ok {
+			hop.PTR, hop.PTRError = seen.PTR, seen.PTRError
+		} else {
+			if lookups == maxPTRLookups {
+				continue
+			}
+			lookups++
+			names, err := r.LookupAddr(ctx, hop.IP)
+			switch {
+			case err == nil:
+				for _, name := range names {
+					hop.PTR = append(hop.PTR, strings.ToLower(strings.TrimSuffix(name, ".")))
+				}
+			case !resolver.NotFound(err):
+				hop.PTRError = err.Error()
+			}
+			cache[hop.IP] = hop
+		}
+
+		switch {
+		case hop.PTRError != "":
+		case len(hop.PTR) == 0:
+			add(MissingPTR, hop.Index, "%s has no PTR record", hop.IP)
+		case hop.Helo != "" && !isAddressLiteral(hop.Helo) && !matchesPTR(hop.Helo, hop.PTR):
+			add(HeloPTRMismatch, hop.Index, "HELO name %s does not match PTR %s of %s", hop.Helo, strings.Join(hop.PTR, ", "), hop.IP)
+		}
+	}
+}
+
+func matchesPTR(helo string, ptr []string) bool {
+	helo = strings.ToLower(strings.TrimSuffix(helo, "."))
+	for _, name := range ptr {
+		if name == helo {
+			return true
+		}
+	}
+	return false
+}
+
+// formatDuration renders a number of seconds for anomaly descriptions.
+func formatDuration(seconds int64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
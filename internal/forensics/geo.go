@@ -0,0 +1,86 @@
+package forensics
+
+import (
+	"fmt"
+	"net"
+
+	"spamassassin-mcp/internal/geoip"
+)
+
+// Geographic anomaly types.
+const (
+	ImpossibleTravel = "impossible_travel"
+	CountryBacktrack = "country_backtrack"
+	ManyCountries    = "many_countries"
+)
+
+// maxPathCountries is the number of countries a delivery path may cross
+// before it is flagged. Mail normally passes through the sender's provider
+// and the recipient's, each rarely spanning more than two countries.
+const maxPathCountries = 3
+
+// Locator is the subset of *geoip.Locator used to locate relay addresses.
+type Locator interface {
+	Lookup(ip net.IP) (*geoip.Location, error)
+}
+
+// Geolocate annotates the public hops and the originating IP of report with
+// their country and autonomous system, and flags delivery paths that are
+// geographically implausible: relays returning to a continent or country
+// the message had already left, and paths through more countries than mail
+// normally crosses. Hops the databases have no country for are skipped.
+func Geolocate(report *Report, l Locator) {
+	add := func(typ string, hop int, format string, args ...any) {
+		report.Anomalies = append(report.Anomalies, Anomaly{Type: typ, Hop: hop, Description: fmt.Sprintf(format, args...)})
+	}
+
+	cache := make(map[string]*Hop)
+	for _, hop := range report.Hops {
+		if hop.IP == "" || hop.Private {
+			continue
+		}
+		if seen, ok := cache[hop.IP]; ok {
+			hop.Geo, hop.GeoError = seen.Geo, seen.GeoError
+			continue
+		}
+		geo, err := l.Lookup(net.ParseIP(hop.IP))
+		if err != nil {
+			hop.GeoError = err.Error()
+		}
+		hop.Geo = geo
+		cache[hop.IP] = hop
+	}
+
+	switch {
+	case report.OriginatingHop > 0:
+		report.OriginatingGeo = report.Hops[report.OriginatingHop-1].Geo
+	case report.OriginatingIP != "":
+		report.OriginatingGeo, _ = l.Lookup(net.ParseIP(report.OriginatingIP))
+	}
+
+	var prev *Hop
+	countries := make(map[string]bool)
+	continents := make(map[string]bool)
+	for _, hop := range report.Hops {
+		if hop.Geo == nil || hop.Geo.Country == "" {
+			continue
+		}
+		geo := hop.Geo
+		if prev != nil && geo.Country != prev.Geo.Country {
+			switch {
+			case geo.Continent != "" && geo.Continent != prev.Geo.Continent && continents[geo.Continent]:
+				add(ImpossibleTravel, hop.Index, "relayed from %s back to %s, a continent the message had already left", prev.Geo.Country, geo.Country)
+			case countries[geo.Country]:
+				add(CountryBacktrack, hop.Index, "relayed from %s back to %s, a country the message had already left", prev.Geo.Country, geo.Country)
+			}
+		}
+		countries[geo.Country] = true
+		if geo.Continent != "" {
+			continents[geo.Continent] = true
+		}
+		prev = hop
+	}
+	if len(countries) > maxPathCountries {
+		add(ManyCountries, 0, "relayed through %d countries", len(countries))
+	}
+}
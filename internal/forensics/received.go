@@ -0,0 +1,205 @@
+package forensics
+
+import (
+	"net"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/geoip"
+)
+
+var ipLiteralRegex = regexp.MustCompile(`\[(?i:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// Hop is one relay in the Received chain.
+type Hop struct {
+	// Index numbers hops in transit order, starting at 1 for the hop that
+	// first accepted the message.
+	Index int `json:"index"`
+
+	// Helo is the name the sending host presented in HELO/EHLO, and
+	// ReverseDNS the name its address resolved to according to the
+	// receiving server.
+	Helo       string `json:"helo,omitempty"`
+	ReverseDNS string `json:"reverse_dns,omitempty"`
+	IP         string `json:"ip,omitempty"`
+
+	By       string     `json:"by,omitempty"`
+	With     string     `json:"with,omitempty"`
+	ID       string     `json:"id,omitempty"`
+	For      string     `json:"for,omitempty"`
+	Received *time.Time `json:"received,omitempty"`
+
+	// DelaySeconds is the time since the previous hop. It is omitted for
+	// the first hop and when either timestamp is missing.
+	DelaySeconds *int64 `json:"delay_seconds,omitempty"`
+
+	// PTR holds the names published for IP, looked up at analysis time.
+	PTR      []string `json:"ptr,omitempty"`
+	PTRError string   `json:"ptr_error,omitempty"`
+
+	// Geo is the location of IP according to the GeoIP databases, set by
+	// Geolocate.
+	Geo      *geoip.Location `json:"geo,omitempty"`
+	GeoError string          `json:"geo_error,omitempty"`
+
+	Private bool   `json:"private,omitempty"`
+	Raw     string `json:"raw"`
+}
+
+// parseReceived parses a Received header value (RFC 5321, section 4.4).
+// The field is free-form in practice; the common layouts of Postfix,
+// Sendmail, Exim and Exchange are recognized and anything else is kept in
+// Raw.
+func parseReceived(value string) *Hop {
+	hop := &Hop{Raw: value}
+
+	clauses, date := value, ""
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		clauses, date = value[:i], strings.TrimSpace(value[i+1:])
+	}
+	if date != "" {
+		if t, err := mail.ParseDate(date); err == nil {
+			hop.Received = &t
+		} else if i := strings.Index(date, "("); i > 0 {
+			if t, err := mail.ParseDate(strings.TrimSpace(date[:i])); err == nil {
+				hop.Received = &t
+			}
+		}
+	}
+
+	var fromComment string
+	key := ""
+	for _, tok := range tokenize(clauses) {
+		if strings.HasPrefix(tok, "(") {
+			if key == "from" {
+				fromComment += " " + strings.Trim(tok, "()")
+			}
+			continue
+		}
+		switch lower := strings.ToLower(tok); lower {
+		case "from", "by", "with", "id", "for", "via":
+			key = lower
+			continue
+		}
+		switch key {
+		case "from":
+			if hop.Helo == "" {
+				hop.Helo = tok
+			}
+		case "by":
+			if hop.By == "" {
+				hop.By = tok
+			}
+		case "with":
+			if hop.With == "" {
+				hop.With = tok
+			}
+		case "id":
+			if hop.ID == "" {
+				hop.ID = tok
+			}
+		case "for":
+			if hop.For == "" {
+				hop.For = strings.Trim(tok, "<>")
+			}
+		}
+	}
+
+	// Postfix and Sendmail record the HELO name in the clause and the
+	// reverse name in the comment; Exim and qmail do the opposite, marking
+	// the HELO name with helo= or HELO.
+	literal := ""
+	if isAddressLiteral(hop.Helo) {
+		literal = ipLiteralRegex.FindStringSubmatch(hop.Helo)[1]
+	}
+	words := strings.Fields(fromComment)
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch {
+		case (strings.EqualFold(word, "HELO") || strings.EqualFold(word, "EHLO")) && i+1 < len(words):
+			i++
+			hop.setHelo(words[i])
+		case net.ParseIP(word) != nil:
+			if hop.IP == "" {
+				hop.IP = word
+			}
+		case ipLiteralRegex.MatchString(word):
+			if hop.IP == "" {
+				hop.IP = ipLiteralRegex.FindStringSubmatch(word)[1]
+			}
+		case strings.HasPrefix(strings.ToLower(word), "helo="):
+			hop.setHelo(word[len("helo="):])
+		case hop.ReverseDNS == "" && strings.Contains(word, ".") && !strings.ContainsAny(word, "=:"):
+			hop.ReverseDNS = strings.TrimSuffix(word, ".")
+		}
+	}
+	// The TCP peer address from the comment is authoritative; an address
+	// literal in the clause is only what the client claimed.
+	if hop.IP == "" {
+		hop.IP = literal
+	}
+	if ip := net.ParseIP(hop.IP); ip != nil {
+		hop.IP = ip.String()
+		hop.Private = !isPublic(ip)
+	} else {
+		hop.IP = ""
+	}
+	return hop
+}
+
+// setHelo records a HELO name found in the comment, in which case the
+// clause held the reverse name.
+func (hop *Hop) setHelo(name string) {
+	if !isAddressLiteral(hop.Helo) && !strings.EqualFold(hop.Helo, "unknown") {
+		hop.ReverseDNS = hop.Helo
+	}
+	hop.Helo = name
+}
+
+// tokenize splits a Received field into words and parenthesized comments,
+// keeping nested parentheses inside their comment.
+func tokenize(s string) []string {
+	var tokens []string
+	depth, start := 0, -1
+	for i, r := range s {
+		switch {
+		case r == '(':
+			if depth == 0 {
+				if start >= 0 {
+					tokens = append(tokens, s[start:i])
+				}
+				start = i
+			}
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				tokens = append(tokens, s[start:i+1])
+				start = -1
+			}
+		case depth == 0 && (r == ' ' || r == '\t'):
+			if start >= 0 {
+				tokens = append(tokens, s[start:i])
+				start = -1
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+func isAddressLiteral(name string) bool {
+	return strings.HasPrefix(name, "[") && ipLiteralRegex.MatchString(name)
+}
+
+// isPublic reports whether ip is a globally routable unicast address.
+func isPublic(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast())
+}
@@ -0,0 +1,96 @@
+// Package geoip locates IP addresses with MaxMind DB files, such as the
+// free GeoLite2 Country and ASN databases or their commercial GeoIP2
+// counterparts.
+//
+// The country and ASN databases are configured separately and either may be
+// left out. Files are read whole into memory when the server starts and the
+// format (https://maxmind.github.io/MaxMind-DB/) is decoded in-house, so no
+// lookups leave the host.
+//
+// Security considerations:
+//   - Database files are checked when opened, and every offset read from
+//     them is bounds-checked, so a corrupt file fails lookups rather than
+//     the server
+//   - Location is a property of the network an address belongs to, not
+//     proof of where a sender is
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Location is what the databases record for an address. Fields the
+// databases do not cover are empty.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country and Continent
+	// the two-letter continent code (AF, AN, AS, EU, NA, OC, SA).
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	Continent   string `json:"continent,omitempty"`
+
+	ASN   uint   `json:"asn,omitempty"`
+	ASOrg string `json:"as_org,omitempty"`
+}
+
+// Locator looks addresses up in the configured databases.
+type Locator struct {
+	country *database
+	asn     *database
+}
+
+// Open reads the databases of cfg, returning nil when neither is
+// configured.
+func Open(cfg config.GeoIPConfig) (*Locator, error) {
+	if cfg.CountryDB == "" && cfg.ASNDB == "" {
+		return nil, nil
+	}
+	l := &Locator{}
+	var err error
+	if cfg.CountryDB != "" {
+		if l.country, err = openDatabase(cfg.CountryDB); err != nil {
+			return nil, fmt.Errorf("failed to open the GeoIP country database: %w", err)
+		}
+	}
+	if cfg.ASNDB != "" {
+		if l.asn, err = openDatabase(cfg.ASNDB); err != nil {
+			return nil, fmt.Errorf("failed to open the GeoIP ASN database: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Lookup returns the location of ip, or nil when the databases have no
+// record of it.
+func (l *Locator) Lookup(ip net.IP) (*Location, error) {
+	loc := &Location{}
+	if l.country != nil {
+		record, err := l.country.lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		country := mapValue(record, "country")
+		loc.Country, _ = country["iso_code"].(string)
+		loc.CountryName, _ = mapValue(country, "names")["en"].(string)
+		loc.Continent, _ = mapValue(record, "continent")["code"].(string)
+	}
+	if l.asn != nil {
+		record, err := l.asn.lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		loc.ASN = uintValue(record["autonomous_system_number"])
+		loc.ASOrg, _ = record["autonomous_system_organization"].(string)
+	}
+	if *loc == (Location{}) {
+		return nil, nil
+	}
+	return loc, nil
+}
+
+func mapValue(m map[string]any, key string) map[string]any {
+	v, _ := m[key].(map[string]any)
+	return v
+}
@@ -0,0 +1,322 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// metadataMarker starts the metadata section at the end of a MaxMind DB
+// file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+const (
+	// maxMetadataSize is how far from the end of the file the metadata
+	// marker is searched for.
+	maxMetadataSize = 128 << 10
+
+	// dataSeparatorSize is the run of zero bytes between the search tree
+	// and the data section.
+	dataSeparatorSize = 16
+
+	// maxDepth bounds the nesting of maps, arrays and pointers decoded, so
+	// a corrupt file cannot recurse without end.
+	maxDepth = 32
+)
+
+// errCorrupt is returned for files that do not follow the MaxMind DB
+// format.
+var errCorrupt = errors.New("invalid MaxMind DB file")
+
+// database is a MaxMind DB file (https://maxmind.github.io/MaxMind-DB/)
+// held in memory: a binary search tree over the bits of an address whose
+// leaves point into a data section of typed, JSON-like values.
+type database struct {
+	Type string
+
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+
+	// ipv4Start is the node IPv4 addresses start their search at in an
+	// IPv6 tree, past the 96 zero bits of ::/96.
+	ipv4Start uint
+}
+
+// openDatabase reads and checks a MaxMind DB file.
+func openDatabase(path string) (*database, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := max(0, len(content)-maxMetadataSize)
+	i := bytes.LastIndex(content[start:], metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: %w: no metadata", path, errCorrupt)
+	}
+	metadataStart := start + i + len(metadataMarker)
+
+	meta, err := (&decoder{data: content[metadataStart:]}).decodeMap(0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", path, errCorrupt, err)
+	}
+	db := &database{
+		nodeCount:  uintValue(meta["node_count"]),
+		recordSize: uintValue(meta["record_size"]),
+		ipVersion:  uintValue(meta["ip_version"]),
+	}
+	db.Type, _ = meta["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("%s: %w: unsupported record size %d", path, errCorrupt, db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("%s: %w: unsupported IP version %d", path, errCorrupt, db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparatorSize > uint(start+i) {
+		return nil, fmt.Errorf("%s: %w: search tree exceeds the file", path, errCorrupt)
+	}
+	db.tree = content[:treeSize]
+	db.data = content[treeSize+dataSeparatorSize : start+i]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for bit := 0; bit < 96 && node < db.nodeCount; bit++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// lookup returns the data recorded for the network containing ip, or nil
+// when there is none.
+func (db *database) lookup(ip net.IP) (map[string]any, error) {
+	node, bits := uint(0), ip.To16()
+	if v4 := ip.To4(); v4 != nil {
+		node, bits = db.ipv4Start, v4
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(bits[i/8]>>(7-i%8))&1)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, fmt.Errorf("%w: search tree deeper than the address", errCorrupt)
+	}
+	offset := node - db.nodeCount - dataSeparatorSize
+	if offset >= uint(len(db.data)) {
+		return nil, fmt.Errorf("%w: data pointer out of range", errCorrupt)
+	}
+	d := &decoder{data: db.data, offset: offset}
+	return d.decodeMap(0)
+}
+
+// record returns the left (0) or right (1) record of a search tree node.
+func (db *database) record(node, right uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+right*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if right == 1 {
+			return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+		}
+		return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+right*4:]))
+	}
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// decoder reads values from a data section.
+type decoder struct {
+	data   []byte
+	offset uint
+}
+
+func (d *decoder) next(n uint) ([]byte, error) {
+	if d.offset+n > uint(len(d.data)) {
+		return nil, fmt.Errorf("%w: value exceeds the data section", errCorrupt)
+	}
+	b := d.data[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
+
+func (d *decoder) decodeMap(depth int) (map[string]any, error) {
+	v, err := d.decode(depth)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected a map", errCorrupt)
+	}
+	return m, nil
+}
+
+// decode reads the value at the offset: maps as map[string]any, arrays as
+// []any, integers as uint64 or int64, floats as float64, and 128-bit
+// integers and bytes as []byte.
+func (d *decoder) decode(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: values nested too deeply", errCorrupt)
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := b[0]
+	kind := uint(ctrl >> 5)
+
+	if kind == typePointer {
+		size := uint(ctrl>>3) & 0x3
+		b, err := d.next(size + 1)
+		if err != nil {
+			return nil, err
+		}
+		var pointer uint
+		switch size {
+		case 0:
+			pointer = uint(ctrl&0x7)<<8 | uint(b[0])
+		case 1:
+			pointer = (uint(ctrl&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			pointer = (uint(ctrl&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			pointer = uint(binary.BigEndian.Uint32(b))
+		}
+		target := &decoder{data: d.data, offset: pointer}
+		return target.decode(depth + 1)
+	}
+
+	if kind == typeExtended {
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		kind = uint(b[0]) + 7
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		b, err := d.next(size - 28)
+		if err != nil {
+			return nil, err
+		}
+		switch size {
+		case 29:
+			size = 29 + uint(b[0])
+		case 30:
+			size = 285 + uint(b[0])<<8 | uint(b[1])
+		default:
+			size = 65821 + uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+	}
+
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: map key is not a string", errCorrupt)
+			}
+			if m[name], err = d.decode(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case typeBool:
+		return size != 0, nil
+	}
+
+	b, err = d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case typeString:
+		return string(b), nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), nil
+	case typeDouble:
+		if size != 8 {
+			return nil, fmt.Errorf("%w: double of %d bytes", errCorrupt, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case typeFloat:
+		if size != 4 {
+			return nil, fmt.Errorf("%w: float of %d bytes", errCorrupt, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, fmt.Errorf("%w: integer of %d bytes", errCorrupt, size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, fmt.Errorf("%w: integer of %d bytes", errCorrupt, size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), nil
+	}
+	return nil, fmt.Errorf("%w: unknown data type %d", errCorrupt, kind)
+}
+
+// uintValue returns v as an unsigned integer, or zero when it is not one.
+func uintValue(v any) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/abuseipdb"
+)
+
+// addAbuseIPDBDetails adds what AbuseIPDB reports on ip to details. Lookup
+// failures are recorded in details rather than failing the reputation
+// check.
+func (h *Handler) addAbuseIPDBDetails(ctx context.Context, ip string, details map[string]string) {
+	if h.abuseIPDB == nil || ip == "" {
+		return
+	}
+	report, err := h.abuseIPDB.Check(ctx, ip)
+	if errors.Is(err, abuseipdb.ErrNotPublic) {
+		details["abuseipdb_skipped"] = err.Error()
+		return
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("AbuseIPDB lookup failed")
+		details["abuseipdb_error"] = err.Error()
+		return
+	}
+
+	details["abuseipdb_confidence_score"] = strconv.Itoa(report.AbuseConfidenceScore)
+	details["abuseipdb_total_reports"] = strconv.Itoa(report.TotalReports)
+	details["abuseipdb_distinct_users"] = strconv.Itoa(report.NumDistinctUsers)
+	details["abuseipdb_isp"] = report.ISP
+	details["abuseipdb_usage_type"] = report.UsageType
+	details["abuseipdb_domain"] = report.Domain
+	details["abuseipdb_country"] = report.CountryCode
+	details["abuseipdb_whitelisted"] = strconv.FormatBool(report.IsWhitelisted)
+	details["abuseipdb_tor"] = strconv.FormatBool(report.IsTor)
+	details["abuseipdb_cached"] = strconv.FormatBool(report.Cached)
+	if report.LastReportedAt != nil {
+		details["abuseipdb_last_reported"] = report.LastReportedAt.UTC().Format(time.RFC3339)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/arf"
+	"spamassassin-mcp/internal/forensics"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// arfUserAgent identifies the server in the reports it generates.
+const arfUserAgent = "spamassassin-mcp/1.0.0"
+
+type GenerateARFReportParams struct {
+	Content      string `json:"content" description:"Raw email content including headers"`
+	FeedbackType string `json:"feedback_type,omitempty" description:"Feedback type: abuse, fraud, virus, other or not-spam (default abuse)"`
+	ReportingMTA string `json:"reporting_mta,omitempty" description:"Host name of the MTA that received the message (default: this server's host name)"`
+	SourceIP     string `json:"source_ip,omitempty" description:"IP address the message came from (default: the originating IP of the Received chain)"`
+	From         string `json:"from,omitempty" description:"Address the report is sent from"`
+	To           string `json:"to,omitempty" description:"Abuse desk address the report is meant for"`
+	Comment      string `json:"comment,omitempty" description:"Note added to the human-readable part"`
+	HeadersOnly  bool   `json:"headers_only,omitempty" description:"Include only the header section of the message, leaving out its body"`
+	Profile      string `json:"profile,omitempty" description:"Named policy profile the message is scanned under"`
+}
+
+// GenerateARFReportResult is an abuse report and the scan verdict it
+// describes.
+type GenerateARFReportResult struct {
+	Report         string  `json:"report"`
+	FeedbackType   string  `json:"feedback_type"`
+	SourceIP       string  `json:"source_ip,omitempty"`
+	ReportedDomain string  `json:"reported_domain,omitempty"`
+	Score          float64 `json:"score"`
+	Threshold      float64 `json:"threshold"`
+	IsSpam         bool    `json:"is_spam"`
+	Profile        string  `json:"profile,omitempty"`
+}
+
+// GenerateARFReport scans a message and wraps it in an RFC 5965 abuse
+// report for the operator to submit. Nothing is sent.
+func (h *Handler) GenerateARFReport(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GenerateARFReportParams]) (*mcp.CallToolResultFor[*GenerateARFReportResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	feedbackType := req.FeedbackType
+	if feedbackType == "" {
+		feedbackType = "abuse"
+	}
+	if !slices.Contains(arf.FeedbackTypes, feedbackType) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "feedback_type must be one of %s, got %q", strings.Join(arf.FeedbackTypes, ", "), feedbackType)
+	}
+	if req.SourceIP != "" && net.ParseIP(req.SourceIP) == nil {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid source_ip %q", req.SourceIP)
+	}
+	if len(req.Comment) > 4096 {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "comment must be at most 4096 bytes")
+	}
+	from, err := reportAddress("from", req.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := reportAddress("to", req.To)
+	if err != nil {
+		return nil, err
+	}
+	reportingMTA := req.ReportingMTA
+	if reportingMTA == "" {
+		reportingMTA, _ = os.Hostname()
+	} else if !domainRegex.MatchString(reportingMTA) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid reporting_mta %q", reportingMTA)
+	}
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":     "generate_arf_report",
+		"size":          email.Size,
+		"feedback_type": feedbackType,
+		"headers_only":  req.HeadersOnly,
+	}).Info("Processing ARF report generation")
+
+	scan, err := h.saClient.ScanEmail(email.Raw, p.scanOptions(spamassassin.ScanOptions{Verbose: true}))
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("SpamAssassin scan failed")
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+
+	// The Received chain supplies the source IP and arrival time; no DNS
+	// lookups are made.
+	chain := forensics.Analyze(ctx, nil, email, time.Now())
+	sourceIP := req.SourceIP
+	if sourceIP == "" {
+		sourceIP = chain.OriginatingIP
+	}
+	var arrival *time.Time
+	for i := len(chain.Hops) - 1; i >= 0 && arrival == nil; i-- {
+		arrival = chain.Hops[i].Received
+	}
+
+	description := fmt.Sprintf("This is an abuse report (RFC 5965, feedback type %s) for a message", feedbackType)
+	if reportingMTA != "" {
+		description += " received by " + reportingMTA
+	}
+	if sourceIP != "" {
+		description += " from " + sourceIP
+	}
+	description += ".\n\n"
+	description += fmt.Sprintf("SpamAssassin score: %.1f (threshold %.1f, %s)\n", scan.Score, scan.Threshold, verdictWord(scan.IsSpam))
+	if len(scan.RulesHit) > 0 {
+		rules := make([]string, len(scan.RulesHit))
+		for i, r := range scan.RulesHit {
+			rules[i] = fmt.Sprintf("%s (%.1f)", r.Name, r.Score)
+		}
+		description += "Rules hit: " + strings.Join(rules, ", ") + "\n"
+	}
+	if req.Comment != "" {
+		description += "\n" + req.Comment + "\n"
+	}
+
+	subject := feedbackType + " report"
+	if email.Subject != "" {
+		subject += ": " + strings.Join(strings.Fields(email.Subject), " ")
+	}
+	report := &arf.Report{
+		From:                  from,
+		To:                    to,
+		Subject:               subject,
+		Description:           description,
+		FeedbackType:          feedbackType,
+		UserAgent:             arfUserAgent,
+		ReportingMTA:          reportingMTA,
+		SourceIP:              sourceIP,
+		OriginalMailFrom:      email.ReturnPath,
+		ArrivalDate:           arrival,
+		ReportedDomain:        email.FromDomain(),
+		AuthenticationResults: email.HeaderValues("Authentication-Results"),
+		Message:               []byte(email.Raw),
+		HeadersOnly:           req.HeadersOnly,
+	}
+	data, err := report.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	result := &GenerateARFReportResult{
+		Report:         string(data),
+		FeedbackType:   feedbackType,
+		SourceIP:       sourceIP,
+		ReportedDomain: report.ReportedDomain,
+		Score:          scan.Score,
+		Threshold:      scan.Threshold,
+		IsSpam:         scan.IsSpam,
+		Profile:        p.name,
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"feedback_type": feedbackType,
+		"score":         scan.Score,
+		"report_size":   len(data),
+	}).Info("ARF report generation completed")
+
+	text := fmt.Sprintf("ARF %s report (%d bytes, score %.1f, %s); not sent", feedbackType, len(data), scan.Score, verdictWord(scan.IsSpam))
+	if feedbackType != "not-spam" && !scan.IsSpam {
+		text += "\nNote: SpamAssassin does not classify this message as spam"
+	}
+	text += "\n\n" + result.Report
+
+	return &mcp.CallToolResultFor[*GenerateARFReportResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// reportAddress parses an address header of a report, which may be empty.
+func reportAddress(param, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", toolerr.Errorf(toolerr.ValidationFailed, "invalid %s address %q: %w", param, value, err)
+	}
+	return addr.String(), nil
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/jobs"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/requestid"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// ScanResourcePrefix is the URI prefix under which deferred scans are published.
+const ScanResourcePrefix = "sa-mcp://scans/"
+
+type GetScanResultParams struct {
+	ScanID string `json:"scan_id" description:"Identifier returned by an asynchronous scan_email call"`
+}
+
+// scanListSchema defines the filter and sort fields of list_scans.
+var scanListSchema = listquery.Schema[*ScanStatus]{
+	Fields: map[string]listquery.Field[*ScanStatus]{
+		"status":       listquery.String(func(s *ScanStatus) string { return s.Status }),
+		"submitted_at": listquery.Time(func(s *ScanStatus) time.Time { return s.SubmittedAt }),
+	},
+	Key:         func(s *ScanStatus) string { return s.ScanID },
+	DefaultSort: "-submitted_at",
+}
+
+type ScanStatus struct {
+	ScanID      string           `json:"scan_id"`
+	Status      string           `json:"status"`
+	SubmittedAt time.Time        `json:"submitted_at"`
+	StartedAt   *time.Time       `json:"started_at,omitempty"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Result      *ScanEmailResult `json:"result,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// shouldScanAsync decides whether a scan is deferred. Clients may ask for it
+// explicitly; otherwise submissions above the size threshold that request full
+// enrichment (verbose rule reports) are deferred automatically.
+func (h *Handler) shouldScanAsync(req ScanEmailParams) bool {
+	cfg := h.settings().AsyncScan
+	if !cfg.Enabled {
+		return false
+	}
+	if req.Async {
+		return true
+	}
+	return req.Verbose && cfg.SizeThreshold > 0 && int64(len(req.Content)) >= cfg.SizeThreshold
+}
+
+func (h *Handler) submitAsyncScan(ctx context.Context, ss *mcp.ServerSession, req ScanEmailParams, email *model.ParsedEmail) (*mcp.CallToolResultFor[ScanEmailResult], error) {
+	// The deferred scan logs under the ID of the request that submitted it,
+	// and only the submitting client can see it.
+	id := requestid.From(ctx)
+	job, err := h.jobs.Submit("scan_email", clientKey(ctx, ss), func(ctx context.Context) (any, error) {
+		return h.scanEmail(requestid.With(ctx, id), req, email)
+	})
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("Failed to queue asynchronous scan")
+		return nil, fmt.Errorf("failed to queue scan: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "scan_email",
+		"scan_id":   job.ID,
+	}).Info("Email scan deferred")
+
+	response := ScanEmailResult{
+		RulesHit:  []spamassassin.RuleMatch{},
+		Timestamp: job.SubmittedAt,
+		ScanID:    job.ID,
+		Status:    string(job.Status),
+	}
+
+	return &mcp.CallToolResultFor[ScanEmailResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Scan accepted for asynchronous processing. Poll get_scan_result with scan_id %s or read %s%s", job.ID, ScanResourcePrefix, job.ID)},
+		},
+		StructuredContent: response,
+	}, nil
+}
+
+// GetScanResult returns the status, and once finished the result, of a
+// deferred scan the calling client submitted.
+func (h *Handler) GetScanResult(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetScanResultParams]) (*mcp.CallToolResultFor[*ScanStatus], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	status, err := h.scanStatus(clientKey(ctx, ss), params.Arguments.ScanID)
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("Scan %s is %s", status.ScanID, status.Status)
+	if status.Result != nil {
+		text = fmt.Sprintf("Scan %s completed. Score: %.2f, Spam: %v", status.ScanID, status.Result.Score, status.Result.IsSpam)
+	} else if status.Error != "" {
+		text = fmt.Sprintf("Scan %s failed: %s", status.ScanID, status.Error)
+	}
+
+	return &mcp.CallToolResultFor[*ScanStatus]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		StructuredContent: status,
+	}, nil
+}
+
+// ListScans lists the retained deferred scans the calling client submitted.
+// Results are omitted from list items; fetch them with get_scan_result.
+func (h *Handler) ListScans(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*ScanStatus]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	jobList := h.jobs.List("scan_email", clientKey(ctx, ss))
+	items := make([]*ScanStatus, 0, len(jobList))
+	for _, job := range jobList {
+		status := newScanStatus(job)
+		status.Result = nil
+		items = append(items, status)
+	}
+
+	page, err := listquery.Apply(items, params.Arguments, scanListSchema)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	return &mcp.CallToolResultFor[*listquery.Page[*ScanStatus]]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Showing %d of %d deferred scans", len(page.Items), page.Total)},
+		},
+		StructuredContent: page,
+	}, nil
+}
+
+// ReadScanResource serves a deferred scan's status as a sa-mcp://scans/ resource.
+func (h *Handler) ReadScanResource(ctx context.Context, ss *mcp.ServerSession, params *mcp.ReadResourceParams) (*mcp.ReadResourceResult, error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	status, err := h.scanStatus(clientKey(ctx, ss), strings.TrimPrefix(params.URI, ScanResourcePrefix))
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, mcp.ResourceNotFoundError(params.URI)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return jsonResource(params.URI, status)
+}
+
+// scanStatus returns the status of the deferred scan owner submitted. Scans
+// of other clients are reported as not found, so their IDs reveal nothing.
+func (h *Handler) scanStatus(owner, scanID string) (*ScanStatus, error) {
+	if scanID == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "scan_id cannot be empty")
+	}
+
+	job, err := h.jobs.Get(scanID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Owner != owner {
+		return nil, jobs.ErrNotFound
+	}
+	return newScanStatus(job), nil
+}
+
+func newScanStatus(job *jobs.Job) *ScanStatus {
+	status := &ScanStatus{
+		ScanID:      job.ID,
+		Status:      string(job.Status),
+		SubmittedAt: job.SubmittedAt,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+		Error:       job.Error,
+	}
+	if result, ok := job.Result.(*ScanEmailResult); ok {
+		status.Result = result
+	}
+	return status
+}
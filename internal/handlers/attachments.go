@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/attachments"
+	"spamassassin-mcp/internal/virustotal"
+)
+
+type AnalyzeAttachmentsParams struct {
+	Content    string `json:"content" description:"Raw email content including headers"`
+	VirusTotal bool   `json:"virustotal,omitempty" description:"Look up the SHA-256 of each attachment on VirusTotal (requires virustotal.api_key); only hashes are sent, never the files"`
+}
+
+type AnalyzeAttachmentsResult struct {
+	Attachments []*attachments.Attachment `json:"attachments"`
+	HighRisk    int                       `json:"high_risk"`
+	Errors      []string                  `json:"errors,omitempty"`
+}
+
+// AnalyzeAttachments lists the attachments of a message with their declared
+// and detected types, hashes and risk flags, and the active content of PDF
+// documents. Attachments are never executed or extracted.
+func (h *Handler) AnalyzeAttachments(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[AnalyzeAttachmentsParams]) (*mcp.CallToolResultFor[*AnalyzeAttachmentsResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+	var vt *virustotal.Client
+	if req.VirusTotal {
+		if vt, err = h.virusTotalClient(); err != nil {
+			return nil, err
+		}
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":  "analyze_attachments",
+		"size":       email.Size,
+		"parts":      len(email.Parts),
+		"virustotal": req.VirusTotal,
+	}).Info("Processing attachment analysis")
+
+	result := &AnalyzeAttachmentsResult{Attachments: attachments.Analyze(email)}
+	for _, a := range result.Attachments {
+		if a.Risk == attachments.High {
+			result.HighRisk++
+		}
+	}
+	if vt != nil {
+		hashes := make([]string, len(result.Attachments))
+		for i, a := range result.Attachments {
+			hashes[i] = a.SHA256
+		}
+		result.Errors = h.lookupVirusTotal(ctx, hashes, vt.File, func(i int, report *virustotal.Report) {
+			result.Attachments[i].VirusTotal = report
+		})
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"attachments": len(result.Attachments),
+		"high_risk":   result.HighRisk,
+	}).Info("Attachment analysis completed")
+
+	text := fmt.Sprintf("%d attachment(s), %d high risk", len(result.Attachments), result.HighRisk)
+	for _, a := range result.Attachments {
+		text += fmt.Sprintf("\n- %s (%s, %d bytes): %s risk", a.Filename, a.DetectedType, a.Size, a.Risk)
+		if len(a.Flags) > 0 {
+			text += fmt.Sprintf(" %v", a.Flags)
+		}
+		text += virusTotalText(a.VirusTotal)
+		if pdf := a.PDF; pdf != nil {
+			for _, target := range pdf.LaunchTargets {
+				text += "\n  launches " + target
+			}
+			for _, target := range pdf.SubmitTargets {
+				text += "\n  submits forms to " + target
+			}
+			for _, name := range pdf.EmbeddedFiles {
+				text += "\n  embeds " + name
+			}
+		}
+	}
+
+	return &mcp.CallToolResultFor[*AnalyzeAttachmentsResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
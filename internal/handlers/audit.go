@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/peer"
+	"spamassassin-mcp/internal/requestid"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// auditListSchema defines the filter and sort fields of query_audit_log.
+var auditListSchema = listquery.Schema[*audit.Record]{
+	Fields: map[string]listquery.Field[*audit.Record]{
+		"time":       listquery.Time(func(r *audit.Record) time.Time { return r.Time }),
+		"seq":        listquery.Number(func(r *audit.Record) int64 { return r.Seq }),
+		"tool":       listquery.String(func(r *audit.Record) string { return r.Tool }),
+		"method":     listquery.String(func(r *audit.Record) string { return r.Method }),
+		"actor":      listquery.String(func(r *audit.Record) string { return r.Actor }),
+		"outcome":    listquery.String(func(r *audit.Record) string { return r.Outcome }),
+		"request_id": listquery.String(func(r *audit.Record) string { return r.RequestID }),
+	},
+	Key:         func(r *audit.Record) string { return fmt.Sprintf("%020d", r.Seq) },
+	DefaultSort: "-seq",
+}
+
+// changeKey is the context key of the change a request records with
+// recordChange.
+type changeKey struct{}
+
+// recordChange describes a change the request made to the server's state in
+// its audit record.
+func recordChange(ctx context.Context, format string, args ...any) {
+	if change, ok := ctx.Value(changeKey{}).(*string); ok {
+		*change = fmt.Sprintf(format, args...)
+	}
+}
+
+// AuditMiddleware records every MCP request with the client, and API key or
+// token subject if any, it is attributed to. Request arguments are never
+// logged; the persistent audit log, when enabled, stores only their digest
+// and any change the request recorded. Identities are redacted before the
+// record is logged or stored.
+//
+// Each request is given an ID, carried in its context for the log entries
+// made while serving it and returned in the _meta of tool results.
+func (h *Handler) AuditMiddleware(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+	return func(ctx context.Context, ss *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+		start := time.Now()
+		id := requestid.New()
+		ctx = requestid.With(ctx, id)
+		var change string
+		result, err := next(context.WithValue(ctx, changeKey{}, &change), ss, method, params)
+		if res, ok := result.(*mcp.CallToolResult); ok && res != nil {
+			if res.Meta == nil {
+				res.Meta = mcp.Meta{}
+			}
+			res.Meta[requestid.Field] = id
+		}
+
+		rec := audit.Record{
+			Time:       start,
+			RequestID:  id,
+			Method:     method,
+			Actor:      clientKey(ctx, ss),
+			APIKey:     peer.Principal(ctx),
+			ClientCN:   peer.CertCN(ctx),
+			RemoteAddr: peer.Addr(ctx),
+			DurationMS: time.Since(start).Milliseconds(),
+			Change:     change,
+			Outcome:    "success",
+		}
+		if tok := peer.TokenFrom(ctx); tok != nil {
+			rec.Subject = tok.Subject
+		}
+		switch p := params.(type) {
+		case *mcp.CallToolParamsFor[json.RawMessage]:
+			rec.Tool = p.Name
+			rec.ParamsDigest = audit.Digest(p.Arguments)
+		case *mcp.GetPromptParams:
+			rec.Prompt = p.Name
+			if data, err := json.Marshal(p.Arguments); err == nil && len(p.Arguments) > 0 {
+				rec.ParamsDigest = audit.Digest(data)
+			}
+		case *mcp.ReadResourceParams:
+			rec.URI = p.URI
+		}
+		if res, ok := result.(*mcp.CallToolResult); err != nil || (ok && res.IsError) {
+			rec.Outcome = "error"
+		}
+		for _, field := range []*string{&rec.Actor, &rec.Subject, &rec.ClientCN, &rec.RemoteAddr, &rec.Change} {
+			*field = h.redactor.String(*field)
+		}
+
+		fields := logrus.Fields{
+			"audit":       true,
+			"method":      rec.Method,
+			"client":      rec.Actor,
+			"duration_ms": rec.DurationMS,
+			"outcome":     rec.Outcome,
+		}
+		for name, value := range map[string]string{
+			"api_key":     rec.APIKey,
+			"subject":     rec.Subject,
+			"client_cn":   rec.ClientCN,
+			"remote_addr": rec.RemoteAddr,
+			"tool":        rec.Tool,
+			"prompt":      rec.Prompt,
+			"uri":         rec.URI,
+			"change":      rec.Change,
+		} {
+			if value != "" {
+				fields[name] = value
+			}
+		}
+		logrus.WithContext(ctx).WithFields(fields).Info("MCP request")
+
+		if h.auditLog != nil {
+			if err := h.auditLog.Append(rec); err != nil {
+				logrus.WithContext(ctx).WithError(err).Error("Failed to write audit record")
+			}
+		}
+		return result, err
+	}
+}
+
+// QueryAuditLog lists persistent audit records and verifies the hash chain.
+func (h *Handler) QueryAuditLog(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*audit.Record]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "query_audit_log").Info("Processing audit log query")
+
+	if h.auditLog == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "persistent audit log is not enabled (set audit.path)")
+	}
+
+	records, err := h.auditLog.Records()
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read audit log")
+		return nil, fmt.Errorf("failed to read audit log")
+	}
+
+	page, err := listquery.Apply(records, params.Arguments, auditListSchema)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	summary := fmt.Sprintf("%d of %d matching audit records; hash chain verified over %d records", len(page.Items), page.Total, len(records))
+	var chainErr *audit.ChainError
+	if err := audit.Verify(records); errors.As(err, &chainErr) {
+		logrus.WithContext(ctx).WithError(err).Error("Audit log failed verification")
+		summary = fmt.Sprintf("%d of %d matching audit records; WARNING: %v", len(page.Items), page.Total, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResultFor[*listquery.Page[*audit.Record]]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: summary}},
+		StructuredContent: page,
+	}, nil
+}
+
+// AuthorizationMiddleware rejects tool calls that the caller's bearer token
+// claims do not permit under the configured tool policies.
+func (h *Handler) AuthorizationMiddleware(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+	return func(ctx context.Context, ss *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+		p, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+		if !ok {
+			return next(ctx, ss, method, params)
+		}
+
+		tok := peer.TokenFrom(ctx)
+		if !h.policy.Allowed(p.Name, tok) {
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
+				"tool":    p.Name,
+				"subject": tok.Subject,
+			}).Warn("Tool call denied by policy")
+			return errorResult(toolerr.Errorf(toolerr.Forbidden, "Not authorized to call %s", p.Name)), nil
+		}
+		return next(ctx, ss, method, params)
+	}
+}
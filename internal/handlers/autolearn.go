@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"spamassassin-mcp/internal/spamassassin"
+)
+
+// autolearnThresholds returns the Bayes auto-learning score bands the rule
+// files set, or SpamAssassin's defaults for those they leave unset or
+// cannot be read.
+func (h *Handler) autolearnThresholds() (ham, spam float64) {
+	ham, spam = spamassassin.DefaultAutolearnHamThreshold, spamassassin.DefaultAutolearnSpamThreshold
+	summary, err := h.rules.Summarize()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to read auto-learning thresholds; using defaults")
+		return ham, spam
+	}
+	if v, err := strconv.ParseFloat(summary.Bayes["bayes_auto_learn_threshold_nonspam"], 64); err == nil {
+		ham = v
+	}
+	if v, err := strconv.ParseFloat(summary.Bayes["bayes_auto_learn_threshold_spam"], 64); err == nil {
+		spam = v
+	}
+	return ham, spam
+}
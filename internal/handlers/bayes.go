@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/bayes"
+)
+
+type BayesStatusParams struct{}
+
+// BayesStatus reports the Bayes database statistics from sa-learn --dump
+// magic, so operators can tell whether Bayes is trained before trusting
+// BAYES_* scores.
+func (h *Handler) BayesStatus(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[BayesStatusParams]) (*mcp.CallToolResultFor[*bayes.Status], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "bayes_status").Info("Processing Bayes status request")
+
+	status, err := h.bayes.Status(ctx)
+	if errors.Is(err, bayes.ErrUnavailable) {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to run sa-learn")
+		return nil, fmt.Errorf("Bayes status is unavailable: %w", err)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read Bayes database")
+		return nil, fmt.Errorf("failed to read Bayes database: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"nspam":  status.Spam,
+		"nham":   status.Ham,
+		"active": status.Active,
+	}).Info("Bayes status completed")
+
+	text := fmt.Sprintf("Bayes is active: %d spam and %d ham learned, %d tokens", status.Spam, status.Ham, status.Tokens)
+	if !status.Active {
+		text = status.Warnings[0]
+	}
+	return &mcp.CallToolResultFor[*bayes.Status]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: status,
+	}, nil
+}
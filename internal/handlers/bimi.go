@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/bimi"
+	"spamassassin-mcp/internal/resolver"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// selectorRegex matches BIMI selectors: one or more DNS labels.
+var selectorRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+type CheckBIMIParams struct {
+	Content  string `json:"content,omitempty" description:"Raw email content; the From domain and BIMI-Selector header are taken from it"`
+	Domain   string `json:"domain,omitempty" description:"Domain to check, when no content is given"`
+	Selector string `json:"selector,omitempty" description:"BIMI selector; default: the BIMI-Selector header of content, or default"`
+}
+
+// CheckBIMI looks up the BIMI record of a domain, checks that its DMARC
+// policy is enforcing and validates the VMC the record references.
+func (h *Handler) CheckBIMI(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckBIMIParams]) (*mcp.CallToolResultFor[*bimi.Result], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+
+	// Validate input
+	if (req.Content == "") == (req.Domain == "") {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "exactly one of content or domain is required")
+	}
+	if req.Domain != "" && !domainRegex.MatchString(req.Domain) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid domain format")
+	}
+
+	domain, selector := req.Domain, req.Selector
+	if req.Content != "" {
+		email, err := h.validateEmailContent(req.Content)
+		if err != nil {
+			return nil, fmt.Errorf("security validation failed: %w", err)
+		}
+		if len(email.From) == 0 || email.From[0].Domain() == "" {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "message has no From address")
+		}
+		domain = email.From[0].Domain()
+		if selector == "" {
+			selector = bimi.Selector(email.Header("BIMI-Selector"))
+		}
+	}
+	if selector != "" && !selectorRegex.MatchString(selector) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid selector format")
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_bimi",
+		"domain":    domain,
+		"selector":  selector,
+	}).Info("Processing BIMI check")
+
+	settings := h.settings()
+	dnsCtx, cancel := context.WithTimeout(ctx, settings.DNS.Timeout+settings.BIMI.Timeout)
+	defer cancel()
+	result := bimi.New(settings.BIMI).Check(dnsCtx, resolver.New(settings.DNS), domain, selector, time.Now())
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"status":   result.Status,
+		"problems": len(result.Problems),
+	}).Info("BIMI check completed")
+
+	text := fmt.Sprintf("BIMI %s for %s (selector %s)", result.Status, result.Domain, result.Selector)
+	switch {
+	case result.Error != "":
+		text += ": " + result.Error
+	case result.Status == bimi.None:
+		text += ": no BIMI record is published"
+	case result.Logo != "":
+		text += "; logo " + result.Logo
+	}
+	if c := result.Certificate; c != nil && c.Organization != "" {
+		text += fmt.Sprintf("; VMC issued to %s", c.Organization)
+		if c.MarkType != "" {
+			text += " (" + c.MarkType + ")"
+		}
+	}
+	if result.Status == bimi.Pass && result.Authority == "" {
+		text += "; no VMC is referenced, which most mailbox providers require"
+	}
+	if len(result.Problems) > 0 {
+		text += "\n- " + strings.Join(result.Problems, "\n- ")
+	}
+
+	return &mcp.CallToolResultFor[*bimi.Result]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/blocklist"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Sources of list_blocklist items.
+const (
+	blocklistSourceStore  = "blocklist"
+	blocklistSourceConfig = "config"
+)
+
+// blocklistSchema defines the filter and sort fields of list_blocklist.
+var blocklistSchema = listquery.Schema[*BlocklistItem]{
+	Fields: map[string]listquery.Field[*BlocklistItem]{
+		"value":    listquery.String(func(i *BlocklistItem) string { return i.Value }),
+		"kind":     listquery.String(func(i *BlocklistItem) string { return i.Kind }),
+		"source":   listquery.String(func(i *BlocklistItem) string { return i.Source }),
+		"added_by": listquery.String(func(i *BlocklistItem) string { return i.AddedBy }),
+		"added_at": listquery.Time(func(i *BlocklistItem) time.Time { return i.AddedAt }),
+	},
+	Key:         func(i *BlocklistItem) string { return i.Source + "\x00" + i.Value },
+	DefaultSort: "value",
+}
+
+// BlocklistItem is a blocklisted address pattern, domain or IP address.
+// Source is blocklist for entries managed with the blocklist tools and config
+// for the static security.blocked_domains list, which can only be changed in
+// the configuration file.
+type BlocklistItem struct {
+	blocklist.Entry
+	Source string `json:"source"`
+}
+
+type AddBlocklistEntryParams struct {
+	Value   string `json:"value" description:"Sender address or pattern (spam@example.com, *@example.com), domain (example.com, also blocks subdomains) or IP address"`
+	Comment string `json:"comment,omitempty" description:"Why the sender is blocked; written above the entry in local.cf"`
+}
+
+type RemoveBlocklistEntryParams struct {
+	Value string `json:"value" description:"Address, domain or IP address exactly as listed"`
+}
+
+// BlocklistChange reports the outcome of adding or removing an entry.
+type BlocklistChange struct {
+	Entry   blocklist.Entry `json:"entry"`
+	Changed bool            `json:"changed"`
+	Entries int             `json:"entries"`
+
+	// LocalCF is the local.cf the entries were written to, if one is
+	// configured. spamd applies the change once it reloads its
+	// configuration.
+	LocalCF string `json:"local_cf,omitempty"`
+}
+
+// AddBlocklistEntry adds a sender, domain or IP address to the persistent
+// blocklist and, when configured, writes it to local.cf. Adding a listed
+// value changes nothing.
+func (h *Handler) AddBlocklistEntry(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[AddBlocklistEntryParams]) (*mcp.CallToolResultFor[*BlocklistChange], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	kind, value, err := blocklist.Parse(req.Value)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if err := blocklist.ValidateComment(comment); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "add_blocklist_entry",
+		"kind":      kind,
+		"value":     value,
+	}).Info("Processing blocklist addition")
+
+	entry := blocklist.Entry{
+		Value:   value,
+		Kind:    kind,
+		Comment: comment,
+		AddedBy: clientKey(ctx, ss),
+		AddedAt: time.Now().UTC(),
+	}
+	added, err := h.blocked.Add(entry)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to update blocklist")
+		return nil, fmt.Errorf("failed to update blocklist: %w", err)
+	}
+	if added {
+		recordChange(ctx, "blocklist: added %s %s", kind, value)
+	} else {
+		entry = *h.blocked.Get(value)
+	}
+	change := h.blocklistChange(entry, added)
+
+	logrus.WithContext(ctx).WithField("changed", added).Info("Blocklist addition completed")
+
+	text := fmt.Sprintf("Added %s %s to the blocklist", kind, value)
+	if !added {
+		text = fmt.Sprintf("%s is already on the blocklist", value)
+	}
+	return &mcp.CallToolResultFor[*BlocklistChange]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: change,
+	}, nil
+}
+
+// RemoveBlocklistEntry removes a sender, domain or IP address from the
+// persistent blocklist and, when configured, from local.cf.
+func (h *Handler) RemoveBlocklistEntry(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[RemoveBlocklistEntryParams]) (*mcp.CallToolResultFor[*BlocklistChange], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	kind, value, err := blocklist.Parse(params.Arguments.Value)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "remove_blocklist_entry",
+		"kind":      kind,
+		"value":     value,
+	}).Info("Processing blocklist removal")
+
+	removed, err := h.blocked.Remove(value)
+	if errors.Is(err, blocklist.ErrNotFound) {
+		if contains(h.settings().Security.BlockedDomains, value) {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "%s is set in security.blocked_domains; remove it from the configuration file", value)
+		}
+		return nil, toolerr.Errorf(toolerr.NotFound, "%s is not on the blocklist", value)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to update blocklist")
+		return nil, fmt.Errorf("failed to update blocklist: %w", err)
+	}
+
+	recordChange(ctx, "blocklist: removed %s %s", kind, value)
+
+	logrus.WithContext(ctx).Info("Blocklist removal completed")
+
+	return &mcp.CallToolResultFor[*BlocklistChange]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Removed %s %s from the blocklist", kind, value)}},
+		StructuredContent: h.blocklistChange(*removed, true),
+	}, nil
+}
+
+// ListBlocklist lists the blocklist entries together with the static
+// security.blocked_domains list.
+func (h *Handler) ListBlocklist(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*BlocklistItem]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "list_blocklist").Info("Processing blocklist query")
+
+	var items []*BlocklistItem
+	for _, e := range h.blocked.Entries() {
+		items = append(items, &BlocklistItem{Entry: e, Source: blocklistSourceStore})
+	}
+	for _, domain := range h.settings().Security.BlockedDomains {
+		items = append(items, &BlocklistItem{Entry: blocklist.Entry{Value: domain, Kind: blocklist.Domain}, Source: blocklistSourceConfig})
+	}
+
+	page, err := listquery.Apply(items, params.Arguments, blocklistSchema)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	return &mcp.CallToolResultFor[*listquery.Page[*BlocklistItem]]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Showing %d of %d blocklist entries", len(page.Items), page.Total)},
+		},
+		StructuredContent: page,
+	}, nil
+}
+
+func (h *Handler) blocklistChange(entry blocklist.Entry, changed bool) *BlocklistChange {
+	return &BlocklistChange{
+		Entry:   entry,
+		Changed: changed,
+		Entries: len(h.blocked.Entries()),
+		LocalCF: h.blocked.LocalCF(),
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type ScanAttachmentsAVParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+// AVFinding is the ClamAV verdict on one attachment.
+type AVFinding struct {
+	Path      string `json:"path"`
+	Filename  string `json:"filename,omitempty"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256"`
+	Infected  bool   `json:"infected"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type ScanAttachmentsAVResult struct {
+	Attachments []AVFinding `json:"attachments"`
+	Infected    int         `json:"infected"`
+	Engine      string      `json:"engine,omitempty"`
+	Errors      []string    `json:"errors,omitempty"`
+}
+
+// ScanAttachmentsAV streams the decoded attachments of a message to clamd
+// and reports the signatures they match. Nothing is disinfected or
+// quarantined.
+func (h *Handler) ScanAttachmentsAV(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ScanAttachmentsAVParams]) (*mcp.CallToolResultFor[*ScanAttachmentsAVResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+	if h.clamAV == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "ClamAV scanning is not configured (set clamav.address)")
+	}
+
+	req := params.Arguments
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "scan_attachments_av",
+		"size":      email.Size,
+		"parts":     len(email.Parts),
+	}).Info("Processing attachment malware scan")
+
+	ctx, cancel := context.WithTimeout(ctx, h.settings().ClamAV.Timeout)
+	defer cancel()
+	result := &ScanAttachmentsAVResult{}
+	result.Attachments, result.Errors = h.scanAttachmentsAV(ctx, email)
+	for _, f := range result.Attachments {
+		if f.Infected {
+			result.Infected++
+		}
+	}
+	if version, err := h.clamAV.Version(ctx); err == nil {
+		result.Engine = version
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"attachments": len(result.Attachments),
+		"infected":    result.Infected,
+		"errors":      len(result.Errors),
+	}).Info("Attachment malware scan completed")
+
+	text := fmt.Sprintf("%d attachment(s) scanned, %d infected", len(result.Attachments), result.Infected)
+	for _, f := range result.Attachments {
+		if f.Infected {
+			text += fmt.Sprintf("\n- %s: %s", f.Filename, f.Signature)
+		}
+	}
+	for _, e := range result.Errors {
+		text += "\n- error: " + e
+	}
+
+	return &mcp.CallToolResultFor[*ScanAttachmentsAVResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// scanAttachmentsAV scans each attachment of email with clamd, returning a
+// finding for every attachment scanned. Attachments that could not be
+// scanned are returned as messages rather than failing the call.
+func (h *Handler) scanAttachmentsAV(ctx context.Context, email *model.ParsedEmail) ([]AVFinding, []string) {
+	findings := make([]AVFinding, 0)
+	var problems []string
+	for _, p := range email.Attachments() {
+		signature, err := h.clamAV.Scan(ctx, p.Content)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).WithField("path", p.Path).Warn("ClamAV scan failed")
+			problems = append(problems, fmt.Sprintf("%s (%s): %v", p.Path, p.Filename, err))
+			continue
+		}
+		sum := sha256.Sum256(p.Content)
+		findings = append(findings, AVFinding{
+			Path:      p.Path,
+			Filename:  p.Filename,
+			Size:      p.Size,
+			SHA256:    hex.EncodeToString(sum[:]),
+			Infected:  signature != "",
+			Signature: signature,
+		})
+	}
+	return findings, problems
+}
+
+// detectMalware scans the attachments of a scanned message when clamd is
+// configured and returns the infected ones, within clamav.timeout of ctx.
+// Scan failures are logged and leave the verdict to SpamAssassin.
+func (h *Handler) detectMalware(ctx context.Context, email *model.ParsedEmail) []AVFinding {
+	if h.clamAV == nil || len(email.Attachments()) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.settings().ClamAV.Timeout)
+	defer cancel()
+	findings, _ := h.scanAttachmentsAV(ctx, email)
+	var infected []AVFinding
+	for _, f := range findings {
+		if f.Infected {
+			infected = append(infected, f)
+		}
+	}
+	return infected
+}
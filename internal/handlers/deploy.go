@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/ruledeploy"
+	"spamassassin-mcp/internal/ruleupdate"
+	"spamassassin-mcp/internal/sandbox"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdreload"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Deployment statuses.
+const (
+	deployStatusDeployed   = "deployed"
+	deployStatusRejected   = "rejected"
+	deployStatusRolledBack = "rolled_back"
+)
+
+// gtubeEmail carries the GTUBE test string, which spamd always scores as
+// spam unless its configuration is broken.
+const gtubeEmail = "From: self-test@spamassassin-mcp.invalid\r\n" +
+	"To: self-test@spamassassin-mcp.invalid\r\n" +
+	"Subject: spamassassin-mcp deployment self-test (GTUBE)\r\n" +
+	"Message-ID: <gtube@spamassassin-mcp.invalid>\r\n" +
+	"\r\n" +
+	"XJS*C4JDBQADN1.NSBN3*2IDNEN*GTUBE-STANDARD-ANTI-UBE-TEST-EMAIL*C.34X\r\n"
+
+// hamEmail is the built-in message that must not become spam after a
+// deployment, used unless rule_deployment.ham_sample is configured.
+const hamEmail = "From: self-test@spamassassin-mcp.invalid\r\n" +
+	"To: self-test@spamassassin-mcp.invalid\r\n" +
+	"Subject: spamassassin-mcp deployment self-test (ham)\r\n" +
+	"Date: Mon, 2 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <ham@spamassassin-mcp.invalid>\r\n" +
+	"\r\n" +
+	"Hello,\r\n" +
+	"\r\n" +
+	"the minutes of Tuesday's meeting are attached. Let me know if I missed anything.\r\n" +
+	"\r\n" +
+	"Thanks\r\n"
+
+type DeployRulesParams struct {
+	Rules   string `json:"rules" description:"Custom rule definitions in SpamAssassin format; they replace the previously deployed rules"`
+	Comment string `json:"comment,omitempty" description:"What the rules are for; recorded with the deployed version"`
+}
+
+// SelfTestCheck is the scan of one self-test message after the reload.
+type SelfTestCheck struct {
+	Name     string  `json:"name"`
+	WantSpam bool    `json:"want_spam"`
+	IsSpam   bool    `json:"is_spam"`
+	Score    float64 `json:"score"`
+	Passed   bool    `json:"passed"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// DeployRulesResult reports a deployment. Rejected rules failed lint in the
+// sandbox and were never written. A rolled back deployment was written and
+// then undone; Error says why, and RollbackReload reports reloading spamd
+// with the previous rules when it had already loaded the new ones.
+type DeployRulesResult struct {
+	Status         string                 `json:"status"`
+	Version        *ruledeploy.Version    `json:"version,omitempty"`
+	Previous       *ruledeploy.Version    `json:"previous,omitempty"`
+	File           string                 `json:"file"`
+	Rules          []string               `json:"rules"`
+	Lint           *sandbox.LintResult    `json:"lint"`
+	LiveLint       *ruleupdate.LintResult `json:"live_lint,omitempty"`
+	Reload         *spamdreload.Result    `json:"reload,omitempty"`
+	SelfTest       []SelfTestCheck        `json:"self_test"`
+	Error          string                 `json:"error,omitempty"`
+	RollbackReload *spamdreload.Result    `json:"rollback_reload,omitempty"`
+}
+
+// DeployRules lints submitted rules, deploys them as a new version of the
+// managed rule file, reloads spamd and checks that it still tells GTUBE from
+// ham. If the live configuration fails lint, the reload fails or the
+// self-test fails, the previous version is restored.
+func (h *Handler) DeployRules(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DeployRulesParams]) (*mcp.CallToolResultFor[*DeployRulesResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	if h.deployer == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "rule deployment is not configured; set rule_deployment.dir")
+	}
+	if err := sandbox.Validate(req.Rules); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if err := ruledeploy.ValidateComment(comment); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "deploy_rules",
+		"size":      len(req.Rules),
+	}).Info("Processing rule deployment request")
+
+	progress := newProgressReporter(ss, params, 4)
+	progress.Report(ctx, 0, "Linting rules")
+
+	lint, err := h.sandbox.Lint(ctx, req.Rules)
+	if errors.Is(err, sandbox.ErrUnavailable) {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to run spamassassin")
+		return nil, fmt.Errorf("rule deployment is unavailable: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lint failed: %w", err)
+	}
+	result := &DeployRulesResult{
+		File:     h.deployer.File(),
+		Rules:    lint.Rules,
+		Lint:     lint,
+		SelfTest: make([]SelfTestCheck, 0),
+	}
+	if !lint.Valid {
+		result.Status = deployStatusRejected
+		logrus.WithContext(ctx).WithField("issues", len(lint.Issues)).Info("Rule deployment rejected")
+		return deployResult(result), nil
+	}
+
+	progress.Report(ctx, 1, "Deploying rules")
+	deployment, err := h.deployer.Stage(req.Rules, ruledeploy.Version{
+		DeployedAt: time.Now().UTC(),
+		DeployedBy: clientKey(ctx, ss),
+		Comment:    comment,
+	})
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to stage rule deployment")
+		return nil, fmt.Errorf("failed to deploy rules: %w", err)
+	}
+	result.Version, result.Previous = &deployment.Version, deployment.Previous
+
+	applied, failure := h.verifyDeployment(ctx, progress, result)
+	if failure != "" {
+		result.Status = deployStatusRolledBack
+		result.Error = failure
+		if err := deployment.Rollback(); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Failed to roll back rule deployment")
+			recordChange(ctx, "rules: deployed version %d, rollback failed", result.Version.Number)
+			return nil, fmt.Errorf("%s, and rolling back failed: %w", failure, err)
+		}
+		if applied {
+			result.RollbackReload = h.applyReload(ctx)
+		}
+		recordChange(ctx, "rules: deployed version %d and rolled back: %s", result.Version.Number, failure)
+		logrus.WithContext(ctx).WithFields(logrus.Fields{
+			"version": result.Version.Number,
+			"reason":  failure,
+		}).Warn("Rule deployment rolled back")
+		return deployResult(result), nil
+	}
+
+	if err := deployment.Commit(); err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("Failed to prune old rule versions")
+	}
+	result.Status = deployStatusDeployed
+	recordChange(ctx, "rules: deployed version %d (%s)", result.Version.Number, strings.Join(result.Rules, ", "))
+	progress.Report(ctx, 4, "Rule deployment complete")
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"version": result.Version.Number,
+		"rules":   len(result.Rules),
+	}).Info("Rule deployment completed")
+
+	return deployResult(result), nil
+}
+
+// verifyDeployment checks staged rules in the live configuration, reloads
+// spamd and runs the self-test. It returns whether the rules were compiled
+// or loaded by spamd, so a rollback must reload too, and, if a check
+// failed, why.
+func (h *Handler) verifyDeployment(ctx context.Context, progress *progressReporter, result *DeployRulesResult) (applied bool, failure string) {
+	liveLint, err := h.updater.Lint(ctx)
+	if err != nil {
+		return false, err.Error()
+	}
+	result.LiveLint = liveLint
+	if !liveLint.Valid {
+		return false, fmt.Sprintf("the live configuration fails lint with %d issue(s)", len(liveLint.Issues))
+	}
+
+	progress.Report(ctx, 2, "Reloading spamd")
+	result.Reload = h.applyReload(ctx)
+	if !result.Reload.OK() {
+		return result.Reload.Compiled || result.Reload.Reloaded, result.Reload.Error
+	}
+
+	progress.Report(ctx, 3, "Running self-test")
+	ham := hamEmail
+	if path := h.settings().RuleDeployment.HamSample; path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return true, fmt.Sprintf("failed to read ham sample: %v", err)
+		}
+		ham = string(data)
+	}
+	result.SelfTest = []SelfTestCheck{
+		h.selfTest("gtube", gtubeEmail, true),
+		h.selfTest("ham", ham, false),
+	}
+	for _, check := range result.SelfTest {
+		if !check.Passed {
+			return true, fmt.Sprintf("self-test %s failed", check.Name)
+		}
+	}
+	return true, ""
+}
+
+func (h *Handler) selfTest(name, email string, wantSpam bool) SelfTestCheck {
+	check := SelfTestCheck{Name: name, WantSpam: wantSpam}
+	scan, err := h.saClient.ScanEmail(email, spamassassin.ScanOptions{})
+	if err != nil {
+		check.Error = fmt.Sprintf("scan failed: %v", err)
+		return check
+	}
+	check.IsSpam, check.Score = scan.IsSpam, scan.Score
+	check.Passed = scan.IsSpam == wantSpam
+	return check
+}
+
+func deployResult(result *DeployRulesResult) *mcp.CallToolResultFor[*DeployRulesResult] {
+	var text string
+	switch result.Status {
+	case deployStatusRejected:
+		text = fmt.Sprintf("Rules rejected: %d lint issue(s), nothing was deployed", len(result.Lint.Issues))
+		for _, issue := range result.Lint.Issues {
+			if issue.Line > 0 {
+				text += fmt.Sprintf("\n- line %d: %s", issue.Line, issue.Message)
+			} else {
+				text += fmt.Sprintf("\n- %s", issue.Message)
+			}
+		}
+	case deployStatusRolledBack:
+		text = fmt.Sprintf("Deployment of version %d rolled back: %s", result.Version.Number, result.Error)
+		if result.RollbackReload != nil && !result.RollbackReload.OK() {
+			text += "; WARNING: reloading spamd with the previous rules failed: " + result.RollbackReload.Error
+		}
+	default:
+		text = fmt.Sprintf("Deployed version %d with %d rule(s) to %s; spamd reloaded and self-test passed", result.Version.Number, len(result.Rules), result.File)
+	}
+	return &mcp.CallToolResultFor[*DeployRulesResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}
+}
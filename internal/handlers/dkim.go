@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/dkim"
+	"spamassassin-mcp/internal/dmarc"
+	"spamassassin-mcp/internal/resolver"
+)
+
+type CheckDKIMParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+type CheckARCParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+type DKIMResult struct {
+	Signatures []*dkim.Signature `json:"signatures"`
+}
+
+// Alignment of a DKIM signing domain with the From domain, as DMARC
+// defines it.
+const (
+	AlignmentStrict  = "strict"
+	AlignmentRelaxed = "relaxed"
+	AlignmentNone    = "none"
+)
+
+// SigningDomain is the d= domain of one DKIM signature and its alignment
+// with the From domain. ThirdParty is set for a valid signature by an
+// unaligned domain, such as an email service provider signing for its
+// customers.
+type SigningDomain struct {
+	Domain     string `json:"domain"`
+	Selector   string `json:"selector"`
+	Valid      bool   `json:"valid"`
+	Alignment  string `json:"alignment"`
+	ThirdParty bool   `json:"third_party"`
+}
+
+// DKIMAlignment reports which DKIM signing domains align with the From
+// domain. Aligned is set when a valid signature is aligned. ThirdPartyOnly
+// is set when valid signatures exist but none is aligned: the message
+// authenticates only its sender's infrastructure, not its author, which
+// is typical of phishing sent through an abused provider account.
+type DKIMAlignment struct {
+	FromDomain     string          `json:"from_domain"`
+	Signatures     []SigningDomain `json:"signatures"`
+	Aligned        bool            `json:"aligned"`
+	ThirdPartyOnly bool            `json:"third_party_only"`
+}
+
+// CheckDKIM verifies every DKIM signature of a message against the keys
+// published by the signing domains.
+func (h *Handler) CheckDKIM(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckDKIMParams]) (*mcp.CallToolResultFor[*DKIMResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_dkim",
+		"size":      email.Size,
+	}).Info("Processing DKIM check")
+
+	result := &DKIMResult{Signatures: h.verifyDKIM(ctx, email.Raw)}
+
+	logrus.WithContext(ctx).WithField("signatures", len(result.Signatures)).Info("DKIM check completed")
+
+	return &mcp.CallToolResultFor[*DKIMResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: dkimSummary(result.Signatures)}},
+		StructuredContent: result,
+	}, nil
+}
+
+// verifyDKIM verifies the signatures of raw within the configured DNS
+// timeout.
+func (h *Handler) verifyDKIM(ctx context.Context, raw string) []*dkim.Signature {
+	cfg := h.settings().DNS
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	return dkim.Verify(ctx, resolver.New(cfg), raw, time.Now())
+}
+
+// dkimAlignment compares the signing domains of signatures with the From
+// domain. It returns nil when the message has no From domain or no
+// signatures.
+func dkimAlignment(fromDomain string, signatures []*dkim.Signature) *DKIMAlignment {
+	if fromDomain == "" || len(signatures) == 0 {
+		return nil
+	}
+	a := &DKIMAlignment{FromDomain: fromDomain, Signatures: make([]SigningDomain, 0, len(signatures))}
+	thirdParty := false
+	for _, s := range signatures {
+		domain := strings.ToLower(strings.TrimSuffix(s.Domain, "."))
+		d := SigningDomain{Domain: domain, Selector: s.Selector, Valid: s.Valid, Alignment: AlignmentNone}
+		switch {
+		case domain == "":
+		case domain == fromDomain:
+			d.Alignment = AlignmentStrict
+		case dmarc.OrganizationalDomain(domain) == dmarc.OrganizationalDomain(fromDomain):
+			d.Alignment = AlignmentRelaxed
+		}
+		if d.Valid {
+			if d.Alignment == AlignmentNone {
+				d.ThirdParty = true
+				thirdParty = true
+			} else {
+				a.Aligned = true
+			}
+		}
+		a.Signatures = append(a.Signatures, d)
+	}
+	a.ThirdPartyOnly = thirdParty && !a.Aligned
+	return a
+}
+
+func dkimSummary(signatures []*dkim.Signature) string {
+	if len(signatures) == 0 {
+		return "No DKIM signatures found"
+	}
+	results := make([]string, len(signatures))
+	for i, s := range signatures {
+		results[i] = fmt.Sprintf("%s (s=%s): %s", s.Domain, s.Selector, s.Result)
+		if s.Error != "" {
+			results[i] += ", " + s.Error
+		}
+	}
+	return fmt.Sprintf("%d DKIM signature(s): %s", len(signatures), strings.Join(results, "; "))
+}
+
+// CheckARC validates the ARC chain of a message, reporting each
+// intermediary's seal, message signature and recorded authentication
+// results.
+func (h *Handler) CheckARC(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckARCParams]) (*mcp.CallToolResultFor[*dkim.ARCResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_arc",
+		"size":      email.Size,
+	}).Info("Processing ARC check")
+
+	cfg := h.settings().DNS
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	result := dkim.VerifyARC(ctx, resolver.New(cfg), email.Raw, time.Now())
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"result": result.Result,
+		"hops":   len(result.Hops),
+	}).Info("ARC check completed")
+
+	text := fmt.Sprintf("ARC chain %s with %d hop(s)", result.Result, len(result.Hops))
+	switch {
+	case len(result.Hops) == 0 && result.Error == "":
+		text = "No ARC headers found"
+	case result.Error != "":
+		text += ": " + result.Error
+	case result.OldestPass > 0:
+		text += fmt.Sprintf("; message unmodified since instance %d", result.OldestPass)
+	}
+
+	return &mcp.CallToolResultFor[*dkim.ARCResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
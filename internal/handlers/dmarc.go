@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/dmarc"
+	"spamassassin-mcp/internal/resolver"
+	"spamassassin-mcp/internal/spf"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type CheckDMARCParams struct {
+	Content    string             `json:"content,omitempty" description:"Raw email content; the From domain and DKIM results are taken from it"`
+	IP         string             `json:"ip,omitempty" description:"Connecting IP; with content, SPF is evaluated for the Return-Path domain"`
+	FromDomain string             `json:"from_domain,omitempty" description:"From header domain, when no content is given"`
+	SPFDomain  string             `json:"spf_domain,omitempty" description:"Domain SPF was evaluated for (MAIL FROM or HELO)"`
+	SPFResult  string             `json:"spf_result,omitempty" description:"SPF result for spf_domain, e.g. pass or fail"`
+	DKIM       []dmarc.Identifier `json:"dkim,omitempty" description:"DKIM signing domains and their results; replaces verification of content"`
+}
+
+// CheckDMARC evaluates the DMARC policy of a message's From domain, either
+// from a raw message or from previously obtained SPF and DKIM outcomes.
+func (h *Handler) CheckDMARC(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckDMARCParams]) (*mcp.CallToolResultFor[*dmarc.Evaluation], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+
+	// Validate input
+	if (req.Content == "") == (req.FromDomain == "") {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "exactly one of content or from_domain is required")
+	}
+	if req.FromDomain != "" && !domainRegex.MatchString(req.FromDomain) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid domain format")
+	}
+	if (req.SPFDomain == "") != (req.SPFResult == "") {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "spf_domain and spf_result must be given together")
+	}
+	if req.SPFDomain != "" && !domainRegex.MatchString(req.SPFDomain) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid SPF domain format")
+	}
+	for _, id := range req.DKIM {
+		if !domainRegex.MatchString(id.Domain) {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid DKIM domain format: %q", id.Domain)
+		}
+	}
+	var ip net.IP
+	if req.IP != "" {
+		if ip = net.ParseIP(req.IP); ip == nil {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid IP address format")
+		}
+	}
+
+	cfg := h.settings().DNS
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	r := resolver.New(cfg)
+
+	in := dmarc.Input{FromDomain: req.FromDomain, DKIM: req.DKIM}
+	if req.SPFDomain != "" {
+		in.SPF = &dmarc.Identifier{Domain: req.SPFDomain, Result: req.SPFResult}
+	}
+
+	if req.Content != "" {
+		email, err := h.validateEmailContent(req.Content)
+		if err != nil {
+			return nil, fmt.Errorf("security validation failed: %w", err)
+		}
+		if len(email.From) == 0 || email.From[0].Domain() == "" {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "message has no From address")
+		}
+		in.FromDomain = email.From[0].Domain()
+
+		if in.DKIM == nil {
+			for _, s := range h.verifyDKIM(ctx, email.Raw) {
+				in.DKIM = append(in.DKIM, dmarc.Identifier{Domain: s.Domain, Result: string(s.Result)})
+			}
+		}
+		if in.SPF == nil && ip != nil && email.ReturnPath != "" {
+			evaluation := spf.Check(ctx, r, spf.Query{IP: ip, Sender: email.ReturnPath})
+			in.SPF = &dmarc.Identifier{Domain: evaluation.Domain, Result: string(evaluation.Result)}
+		}
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_dmarc",
+		"domain":    in.FromDomain,
+	}).Info("Processing DMARC check")
+
+	result := dmarc.Evaluate(ctx, r, in)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"result":      result.Result,
+		"disposition": result.Disposition,
+	}).Info("DMARC check completed")
+
+	text := fmt.Sprintf("DMARC %s for %s", result.Result, result.FromDomain)
+	switch {
+	case result.Result == dmarc.Fail:
+		text += fmt.Sprintf(": policy requests %s for %d%% of failing messages", result.Disposition, result.Percentage)
+	case result.Error != "":
+		text += " (" + result.Error + ")"
+	case result.Policy == nil:
+		text += ": no DMARC policy published"
+	}
+	if result.Policy != nil && len(result.Policy.RUA) > 0 {
+		text += "; aggregate reports to " + strings.Join(result.Policy.RUA, ", ")
+	}
+
+	return &mcp.CallToolResultFor[*dmarc.Evaluation]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/dnsbl"
+	"spamassassin-mcp/internal/resolver"
+)
+
+// checkDNSBL queries the sender IP against dns.dnsbl_zones and the sender
+// domain against dns.uribl_zones, within dns.timeout. Private and other
+// non-global addresses are not queried. Failing zones are reported in
+// their result rather than failing the reputation check.
+func (h *Handler) checkDNSBL(ctx context.Context, ip, domain string) []dnsbl.Result {
+	cfg := h.settings().DNS
+	var ipZones, domainZones []dnsbl.Zone
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.IsGlobalUnicast() && !addr.IsPrivate() {
+		ipZones = dnsbl.Zones(cfg.DNSBLZones, cfg.SpamhausDQSKey)
+	}
+	if domain != "" {
+		domainZones = dnsbl.Zones(cfg.URIBLZones, cfg.SpamhausDQSKey)
+	}
+	if len(ipZones) == 0 && len(domainZones) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	r := resolver.New(cfg)
+
+	var results []dnsbl.Result
+	add := func(zone dnsbl.Zone, result *dnsbl.Result, err error) {
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Warn("DNSBL lookup failed")
+			result = &dnsbl.Result{Zone: zone.Name, Error: err.Error()}
+		}
+		results = append(results, *result)
+	}
+	for _, zone := range ipZones {
+		result, err := zone.LookupIP(ctx, r, ip)
+		add(zone, result, err)
+	}
+	for _, zone := range domainZones {
+		result, err := zone.LookupDomain(ctx, r, domain)
+		add(zone, result, err)
+	}
+	return results
+}
+
+// dnsblReasons describes the listings of results for the reputation
+// reasons.
+func dnsblReasons(results []dnsbl.Result) []string {
+	var reasons []string
+	for _, result := range results {
+		if !result.Listed {
+			continue
+		}
+		detail := strings.Join(result.Answers, ", ")
+		if len(result.Codes) > 0 {
+			detail = strings.Join(result.Codes, "; ")
+		}
+		reasons = append(reasons, fmt.Sprintf("Listed on %s (%s)", result.Zone, detail))
+	}
+	return reasons
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// DrainMiddleware tracks in-flight tool calls so Drain can wait for them, and
+// rejects new tool calls once draining has begun.
+func (h *Handler) DrainMiddleware(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+	return func(ctx context.Context, ss *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+		if _, ok := params.(*mcp.CallToolParamsFor[json.RawMessage]); !ok {
+			return next(ctx, ss, method, params)
+		}
+
+		h.drainMu.Lock()
+		if h.draining {
+			h.drainMu.Unlock()
+			return errorResult(toolerr.Errorf(toolerr.ShuttingDown, "Server is shutting down; retry the request against another instance")), nil
+		}
+		h.inflight.Add(1)
+		h.drainMu.Unlock()
+		defer h.inflight.Done()
+
+		return next(ctx, ss, method, params)
+	}
+}
+
+// Draining reports whether Drain has been called.
+func (h *Handler) Draining() bool {
+	h.drainMu.Lock()
+	defer h.drainMu.Unlock()
+	return h.draining
+}
+
+// Drain stops accepting tool calls and waits for in-flight calls and
+// deferred scans to finish. If ctx is done first, running deferred scans are
+// cancelled and ctx's error is returned; in-flight synchronous calls are
+// bounded by their own scan timeout.
+func (h *Handler) Drain(ctx context.Context) error {
+	h.drainMu.Lock()
+	h.draining = true
+	h.drainMu.Unlock()
+
+	logrus.WithContext(ctx).Info("Draining in-flight requests")
+
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.jobs.Close()
+		return ctx.Err()
+	}
+
+	return h.jobs.Shutdown(ctx)
+}
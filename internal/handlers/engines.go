@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/rspamd"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// equivalentSymbols maps SpamAssassin rules to the rspamd symbols that test
+// the same thing under another name. Rules and symbols of the same name are
+// matched without an entry.
+var equivalentSymbols = map[string]string{
+	"SPF_PASS":     "R_SPF_ALLOW",
+	"SPF_FAIL":     "R_SPF_FAIL",
+	"SPF_SOFTFAIL": "R_SPF_SOFTFAIL",
+	"SPF_NEUTRAL":  "R_SPF_NEUTRAL",
+	"SPF_NONE":     "R_SPF_NA",
+	"DKIM_VALID":   "R_DKIM_ALLOW",
+	"DKIM_INVALID": "R_DKIM_REJECT",
+	"DMARC_PASS":   "DMARC_POLICY_ALLOW",
+	"BAYES_00":     "BAYES_HAM",
+	"BAYES_99":     "BAYES_SPAM",
+}
+
+type CompareEnginesParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+	Profile string `json:"profile,omitempty" description:"Named policy profile the SpamAssassin scan is evaluated under"`
+}
+
+// SpamAssassinVerdict is the SpamAssassin side of a comparison.
+type SpamAssassinVerdict struct {
+	Score     float64                  `json:"score"`
+	Threshold float64                  `json:"threshold"`
+	IsSpam    bool                     `json:"is_spam"`
+	Rules     []spamassassin.RuleMatch `json:"rules"`
+}
+
+// SymbolPair is a SpamAssassin rule and an rspamd symbol that both hit,
+// with the score each engine gave.
+type SymbolPair struct {
+	SpamAssassin      string  `json:"spamassassin"`
+	Rspamd            string  `json:"rspamd"`
+	SpamAssassinScore float64 `json:"spamassassin_score"`
+	RspamdScore       float64 `json:"rspamd_score"`
+}
+
+// CompareEnginesResult sets the verdicts of SpamAssassin and rspamd side by
+// side. Overlap is the share of all rules and symbols hit that the engines
+// have in common, from 0 to 1.
+type CompareEnginesResult struct {
+	SpamAssassin     SpamAssassinVerdict `json:"spamassassin"`
+	Rspamd           *rspamd.Result      `json:"rspamd"`
+	Agree            bool                `json:"agree"`
+	Shared           []SymbolPair        `json:"shared"`
+	SpamAssassinOnly []string            `json:"spamassassin_only"`
+	RspamdOnly       []string            `json:"rspamd_only"`
+	Overlap          float64             `json:"overlap"`
+	Profile          string              `json:"profile,omitempty"`
+}
+
+// CompareEngines scans a message with both SpamAssassin and the configured
+// rspamd worker and compares their verdicts and the rules they hit, to help
+// evaluate a migration.
+func (h *Handler) CompareEngines(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CompareEnginesParams]) (*mcp.CallToolResultFor[*CompareEnginesResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	client := rspamd.New(h.settings().Rspamd)
+	if client == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "rspamd is not configured (set rspamd.url)")
+	}
+	req := params.Arguments
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "compare_engines",
+		"size":      email.Size,
+		"profile":   p.name,
+	}).Info("Processing engine comparison")
+
+	sa, err := h.saClient.ScanEmail(email.Raw, p.scanOptions(spamassassin.ScanOptions{Verbose: true}))
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("SpamAssassin scan failed")
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+	rs, err := client.Check(ctx, []byte(email.Raw))
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("rspamd scan failed")
+		return nil, err
+	}
+
+	result := compareEngines(sa, rs)
+	result.Profile = p.name
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"spamassassin_score": sa.Score,
+		"rspamd_score":       rs.Score,
+		"agree":              result.Agree,
+		"shared":             len(result.Shared),
+	}).Info("Engine comparison completed")
+
+	agreement := "engines agree"
+	if !result.Agree {
+		agreement = "engines disagree"
+	}
+	text := fmt.Sprintf("SpamAssassin: %.1f/%.1f (%s) | rspamd: %.1f/%.1f (%s, %s) - %s, %.0f%% symbol overlap",
+		sa.Score, sa.Threshold, verdictWord(sa.IsSpam), rs.Score, rs.RequiredScore, rs.Action, verdictWord(rs.IsSpam),
+		agreement, result.Overlap*100)
+	if len(result.Shared) > 0 {
+		pairs := make([]string, len(result.Shared))
+		for i, pair := range result.Shared {
+			pairs[i] = pair.SpamAssassin
+			if pair.Rspamd != pair.SpamAssassin {
+				pairs[i] += "=" + pair.Rspamd
+			}
+		}
+		text += "\nShared: " + strings.Join(pairs, ", ")
+	}
+	if len(result.SpamAssassinOnly) > 0 {
+		text += "\nSpamAssassin only: " + strings.Join(result.SpamAssassinOnly, ", ")
+	}
+	if len(result.RspamdOnly) > 0 {
+		text += "\nrspamd only: " + strings.Join(result.RspamdOnly, ", ")
+	}
+
+	return &mcp.CallToolResultFor[*CompareEnginesResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// compareEngines pairs the rules SpamAssassin hit with the symbols rspamd
+// inserted, by name or through equivalentSymbols.
+func compareEngines(sa *spamassassin.ScanResult, rs *rspamd.Result) *CompareEnginesResult {
+	result := &CompareEnginesResult{
+		SpamAssassin: SpamAssassinVerdict{
+			Score:     sa.Score,
+			Threshold: sa.Threshold,
+			IsSpam:    sa.IsSpam,
+			Rules:     sa.RulesHit,
+		},
+		Rspamd:           rs,
+		Agree:            sa.IsSpam == rs.IsSpam,
+		Shared:           make([]SymbolPair, 0),
+		SpamAssassinOnly: make([]string, 0),
+		RspamdOnly:       make([]string, 0),
+	}
+
+	symbols := make(map[string]rspamd.Symbol, len(rs.Symbols))
+	for _, s := range rs.Symbols {
+		symbols[strings.ToUpper(s.Name)] = s
+	}
+	matched := make(map[string]bool)
+	for _, rule := range sa.RulesHit {
+		name := strings.ToUpper(rule.Name)
+		s, ok := symbols[name]
+		if !ok {
+			s, ok = symbols[equivalentSymbols[name]]
+		}
+		if !ok || matched[s.Name] {
+			result.SpamAssassinOnly = append(result.SpamAssassinOnly, rule.Name)
+			continue
+		}
+		matched[s.Name] = true
+		result.Shared = append(result.Shared, SymbolPair{
+			SpamAssassin:      rule.Name,
+			Rspamd:            s.Name,
+			SpamAssassinScore: rule.Score,
+			RspamdScore:       s.Score,
+		})
+	}
+	for _, s := range rs.Symbols {
+		if !matched[s.Name] {
+			result.RspamdOnly = append(result.RspamdOnly, s.Name)
+		}
+	}
+	if union := len(result.Shared) + len(result.SpamAssassinOnly) + len(result.RspamdOnly); union > 0 {
+		result.Overlap = math.Round(float64(len(result.Shared))/float64(union)*1000) / 1000
+	}
+	return result
+}
+
+func verdictWord(spam bool) string {
+	if spam {
+		return "spam"
+	}
+	return "ham"
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"spamassassin-mcp/internal/bayes"
+	"spamassassin-mcp/internal/jobs"
+	"spamassassin-mcp/internal/ocr"
+	"spamassassin-mcp/internal/ruledeploy"
+	"spamassassin-mcp/internal/ruleupdate"
+	"spamassassin-mcp/internal/sandbox"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// toolErrorKey is the context key of the error a tool handler wrapped with
+// ReportErrors failed with.
+type toolErrorKey struct{}
+
+// sentinelCodes classifies the sentinel errors of the packages the handlers
+// use, which do not depend on toolerr.
+var sentinelCodes = []struct {
+	err  error
+	code string
+}{
+	{spamassassin.ErrBusy, toolerr.SpamdUnavailable},
+	{spamassassin.ErrTellUnsupported, toolerr.NotConfigured},
+	{bayes.ErrUnavailable, toolerr.NotConfigured},
+	{sandbox.ErrUnavailable, toolerr.NotConfigured},
+	{ocr.ErrUnavailable, toolerr.NotConfigured},
+	{ruleupdate.ErrUnavailable, toolerr.NotConfigured},
+	{ruleupdate.ErrBusy, toolerr.Busy},
+	{ruledeploy.ErrBusy, toolerr.Busy},
+	{jobs.ErrNotFound, toolerr.NotFound},
+}
+
+// ReportErrors wraps a tool handler so that ErrorMiddleware can return the
+// error it fails with as a structured result.
+func ReportErrors[In, Out any](handler mcp.ToolHandlerFor[In, Out]) mcp.ToolHandlerFor[In, Out] {
+	return func(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[In]) (*mcp.CallToolResultFor[Out], error) {
+		res, err := handler(ctx, ss, params)
+		if reported, ok := ctx.Value(toolErrorKey{}).(*error); ok && err != nil {
+			*reported = err
+		}
+		return res, err
+	}
+}
+
+// ErrorMiddleware returns the error a tool call failed with as an error
+// result whose structured content is a toolerr.Result, so clients can branch
+// on the code of the failure. Only handlers wrapped with ReportErrors report
+// their errors.
+func (h *Handler) ErrorMiddleware(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+	return func(ctx context.Context, ss *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+		if _, ok := params.(*mcp.CallToolParamsFor[json.RawMessage]); !ok {
+			return next(ctx, ss, method, params)
+		}
+
+		var reported error
+		result, err := next(context.WithValue(ctx, toolErrorKey{}, &reported), ss, method, params)
+		if reported == nil {
+			return result, err
+		}
+		return errorResult(classify(reported)), nil
+	}
+}
+
+// classify gives err the code of the sentinel error it wraps, unless it is
+// classified already.
+func classify(err error) error {
+	var classified *toolerr.Error
+	if errors.As(err, &classified) {
+		return err
+	}
+	for _, s := range sentinelCodes {
+		if errors.Is(err, s.err) {
+			return toolerr.Wrap(s.code, err)
+		}
+	}
+	return err
+}
+
+// errorResult is the error result of a tool call that failed with err.
+func errorResult(err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: err.Error()}},
+		StructuredContent: toolerr.ResultOf(err),
+		IsError:           true,
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/arf"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/similarity"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type IngestFBLReportParams struct {
+	Content string `json:"content" description:"Raw ARF feedback-loop report (multipart/report with report-type=feedback-report)"`
+	Learn   bool   `json:"learn,omitempty" description:"Train Bayes with the reported message as spam through spamd TELL (needs spamd --allow-tell)"`
+	Profile string `json:"profile,omitempty" description:"Named policy profile the message is scanned under"`
+	User    string `json:"user,omitempty" description:"spamd user to scan and learn as; must be listed in spamassassin.allowed_users"`
+}
+
+// IngestFBLReportResult describes a complaint and what was done with it.
+// Learned is set when Bayes learned the message; LearnSkipped gives the
+// reason it was not trained, and LearnError why training failed.
+type IngestFBLReportResult struct {
+	*arf.Feedback
+	Hash         string   `json:"hash"`
+	Sender       string   `json:"sender,omitempty"`
+	Subject      string   `json:"subject,omitempty"`
+	MessageID    string   `json:"message_id,omitempty"`
+	Score        float64  `json:"score"`
+	Threshold    float64  `json:"threshold"`
+	IsSpam       bool     `json:"is_spam"`
+	Rules        []string `json:"rules"`
+	Recorded     bool     `json:"recorded"`
+	Learned      bool     `json:"learned"`
+	LearnSkipped string   `json:"learn_skipped,omitempty"`
+	LearnError   string   `json:"learn_error,omitempty"`
+	Profile      string   `json:"profile,omitempty"`
+	User         string   `json:"user,omitempty"`
+}
+
+// IngestFBLReport handles a feedback-loop complaint: it extracts the
+// reported message from the ARF report, scans it, records the complaint in
+// the scan history and, when asked, trains Bayes with it as spam.
+func (h *Handler) IngestFBLReport(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[IngestFBLReportParams]) (*mcp.CallToolResultFor[*IngestFBLReportResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	p, err := h.userProfile(req.Profile, req.User)
+	if err != nil {
+		return nil, err
+	}
+	report, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+	fb, err := arf.Parse([]byte(report.Raw))
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	email, err := h.validateEmailContent(string(fb.Message))
+	if err != nil {
+		return nil, fmt.Errorf("security validation of the reported message failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":     "ingest_fbl_report",
+		"size":          report.Size,
+		"feedback_type": fb.FeedbackType,
+		"headers_only":  fb.HeadersOnly,
+		"learn":         req.Learn,
+	}).Info("Processing feedback-loop report")
+
+	scan, err := h.saClient.ScanEmail(email.Raw, p.scanOptions(spamassassin.ScanOptions{Verbose: true}))
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("SpamAssassin scan failed")
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+
+	result := &IngestFBLReportResult{
+		Feedback:  fb,
+		Hash:      email.SHA256,
+		Subject:   email.Subject,
+		MessageID: email.MessageID,
+		Score:     scan.Score,
+		Threshold: scan.Threshold,
+		IsSpam:    scan.IsSpam,
+		Rules:     make([]string, len(scan.RulesHit)),
+		Profile:   p.name,
+		User:      req.User,
+	}
+	for i, r := range scan.RulesHit {
+		result.Rules[i] = r.Name
+	}
+	if len(email.From) > 0 {
+		result.Sender = email.From[0].Address
+	}
+
+	if h.history != nil {
+		entry := &history.Entry{
+			Hash:      email.SHA256,
+			Sender:    result.Sender,
+			Score:     scan.Score,
+			Threshold: scan.Threshold,
+			IsSpam:    scan.IsSpam,
+			Rules:     result.Rules,
+			Profile:   p.name,
+			ScannedAt: time.Now().UTC(),
+			Complaint: true,
+			FuzzyHash: similarity.FuzzyHash(email),
+		}
+		if err := h.history.Record(context.Background(), entry); err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("Failed to record complaint in scan history")
+		} else {
+			result.Recorded = true
+		}
+	}
+
+	if req.Learn {
+		switch {
+		case fb.FeedbackType == "not-spam":
+			result.LearnSkipped = "the report says the message is not spam"
+		case fb.HeadersOnly:
+			result.LearnSkipped = "the report includes only the message headers"
+		default:
+			result.Learned, err = h.saClient.Learn(email.Raw, spamassassin.ClassSpam, p.spamdUser)
+			if err != nil {
+				logrus.WithContext(ctx).WithError(err).Error("Bayes training failed")
+				result.LearnError = fmt.Sprintf("learning failed: %v", err)
+			} else if !result.Learned {
+				result.LearnSkipped = "already learned as spam"
+			}
+		}
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"feedback_type": fb.FeedbackType,
+		"score":         scan.Score,
+		"recorded":      result.Recorded,
+		"learned":       result.Learned,
+	}).Info("Feedback-loop report completed")
+
+	text := fmt.Sprintf("%s complaint", fb.FeedbackType)
+	if fb.Reporter != "" {
+		text += " from " + fb.Reporter
+	}
+	if result.Sender != "" {
+		text += " about mail from " + result.Sender
+	}
+	text += fmt.Sprintf(": score %.1f/%.1f (%s)", scan.Score, scan.Threshold, verdictWord(scan.IsSpam))
+	var actions []string
+	if result.Recorded {
+		actions = append(actions, "recorded in history")
+	}
+	switch {
+	case result.Learned:
+		actions = append(actions, "learned as spam")
+	case result.LearnSkipped != "":
+		actions = append(actions, "not learned: "+result.LearnSkipped)
+	case result.LearnError != "":
+		actions = append(actions, result.LearnError)
+	}
+	if len(actions) > 0 {
+		text += "; " + strings.Join(actions, "; ")
+	}
+
+	return &mcp.CallToolResultFor[*IngestFBLReportResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
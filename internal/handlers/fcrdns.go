@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/fcrdns"
+	"spamassassin-mcp/internal/resolver"
+)
+
+// checkFCrDNS verifies the reverse DNS of ip, comparing it with helo when
+// given. It returns the result, the reasons it gives for a bad reputation
+// (a PTR name that does not resolve back, or a generic one) and notes that
+// are reported without counting against the sender (no PTR name, or a HELO
+// name that is not confirmed). Private addresses are skipped, and lookup
+// failures are recorded in details rather than failing the reputation
+// check.
+func (h *Handler) checkFCrDNS(ctx context.Context, ip, helo string, details map[string]string) (result *fcrdns.Result, listed, notes []string) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return nil, nil, nil
+	}
+	cfg := h.settings().DNS
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	result, err = fcrdns.Verify(ctx, resolver.New(cfg), addr.Unmap().AsSlice(), helo)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("Reverse DNS verification failed")
+		details["fcrdns_error"] = err.Error()
+		return nil, nil, nil
+	}
+
+	switch {
+	case len(result.PTR) == 0:
+		notes = append(notes, fmt.Sprintf("IP %s has no PTR record", ip))
+	case !result.FCrDNS:
+		listed = append(listed, fmt.Sprintf("PTR %s of IP %s does not resolve back to it", strings.Join(result.PTR, ", "), ip))
+	}
+	if result.Generic != "" {
+		listed = append(listed, fmt.Sprintf("PTR %s of IP %s looks like a dynamic or residential address", result.Generic, ip))
+	}
+	if result.HeloMatch != nil && !*result.HeloMatch {
+		notes = append(notes, fmt.Sprintf("HELO %s is not a forward-confirmed name of IP %s", result.Helo, ip))
+	}
+	return result, listed, notes
+}
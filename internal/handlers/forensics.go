@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/forensics"
+	"spamassassin-mcp/internal/resolver"
+)
+
+type AnalyzeHeadersParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+	SkipDNS bool   `json:"skip_dns,omitempty" description:"Skip PTR lookups of relay addresses and the HELO/PTR comparison"`
+}
+
+// AnalyzeHeaders reconstructs the Received chain of a message and flags
+// header anomalies. When GeoIP databases are configured the relays are
+// located and implausible delivery paths flagged. No SpamAssassin scan is
+// performed.
+func (h *Handler) AnalyzeHeaders(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[AnalyzeHeadersParams]) (*mcp.CallToolResultFor[*forensics.Report], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "analyze_headers",
+		"size":      email.Size,
+		"skip_dns":  params.Arguments.SkipDNS,
+	}).Info("Processing header analysis")
+
+	var r forensics.Resolver
+	if !params.Arguments.SkipDNS {
+		cfg := h.settings().DNS
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		r = resolver.New(cfg)
+	}
+	report := forensics.Analyze(ctx, r, email, time.Now())
+	if h.geoip != nil {
+		forensics.Geolocate(report, h.geoip)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"hops":      len(report.Hops),
+		"anomalies": len(report.Anomalies),
+	}).Info("Header analysis completed")
+
+	text := fmt.Sprintf("%d hop(s), %d anomalies", len(report.Hops), len(report.Anomalies))
+	if report.OriginatingIP != "" {
+		text += "; originating IP " + report.OriginatingIP
+		if geo := report.OriginatingGeo; geo != nil && geo.Country != "" {
+			text += " (" + geo.Country
+			if geo.ASN != 0 {
+				text += fmt.Sprintf(", AS%d", geo.ASN)
+			}
+			text += ")"
+		}
+	}
+	for _, a := range report.Anomalies {
+		text += "\n- " + a.Type + ": " + a.Description
+	}
+
+	return &mcp.CallToolResultFor[*forensics.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
@@ -2,48 +2,156 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/mail"
+	"math"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
 
+	"spamassassin-mcp/internal/abuseipdb"
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/auth"
+	"spamassassin-mcp/internal/bayes"
+	"spamassassin-mcp/internal/blocklist"
+	"spamassassin-mcp/internal/clamav"
 	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/contentref"
+	"spamassassin-mcp/internal/corpus"
+	"spamassassin-mcp/internal/deception"
+	"spamassassin-mcp/internal/dkim"
+	"spamassassin-mcp/internal/dnsbl"
+	"spamassassin-mcp/internal/fcrdns"
+	"spamassassin-mcp/internal/geoip"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/jobs"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/ocr"
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/ratelimit"
+	"spamassassin-mcp/internal/rdap"
+	"spamassassin-mcp/internal/redact"
+	"spamassassin-mcp/internal/ruledeploy"
+	"spamassassin-mcp/internal/rules"
+	"spamassassin-mcp/internal/ruleupdate"
+	"spamassassin-mcp/internal/sandbox"
+	"spamassassin-mcp/internal/scheduler"
+	"spamassassin-mcp/internal/siem"
+	"spamassassin-mcp/internal/similarity"
 	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdreload"
+	"spamassassin-mcp/internal/stats"
+	"spamassassin-mcp/internal/tags"
+	"spamassassin-mcp/internal/taxii"
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/urlfeeds"
+	"spamassassin-mcp/internal/urls"
+	"spamassassin-mcp/internal/virustotal"
+	"spamassassin-mcp/internal/webhook"
+	"spamassassin-mcp/internal/welcomelist"
 )
 
 type Handler struct {
-	saClient   *spamassassin.Client
-	security   config.SecurityConfig
-	rateLimiter *rate.Limiter
+	saClient    *spamassassin.Client
+	rules       *rules.Catalog
+	sandbox     *sandbox.Sandbox
+	jobs        *jobs.Manager
+	tagger      *tags.Tagger
+	webhooks    *webhook.Router
+	rateLimiter *ratelimit.Limiter
+	policy      *auth.Policy
+	auditLog    *audit.Log
+	redactor    *redact.Redactor
+	stats       *stats.Collector
+	history     history.Store
+	quarantine  *quarantine.Store
+	corpus      *corpus.Corpus
+	welcome     *welcomelist.Store
+	blocked     *blocklist.Store
+	bayes       *bayes.Client
+	updater     *ruleupdate.Updater
+	reloader    *spamdreload.Reloader
+	deployer    *ruledeploy.Store
+	siem        *siem.Exporter
+	feed        *taxii.Publisher
+	abuseIPDB   *abuseipdb.Client
+	rdap        *rdap.Client
+	virusTotal  *virustotal.Client
+	clamAV      *clamav.Client
+	urlFeeds    *urlfeeds.Store
+	peers       *peersync.Syncer
+	geoip       *geoip.Locator
+	scheduler   *scheduler.Scheduler
+
+	// configuration in effect; replaced by Reload
+	configMu sync.RWMutex
+	config   *config.Config
+
+	// drain state; see drain.go
+	drainMu  sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+
+	// set once the HTTP transport serves PeerSyncHandler
+	peerServing atomic.Bool
 }
 
 // Request/Response types for MCP tools
 type ScanEmailParams struct {
-	Content     string            `json:"content" description:"Raw email content including headers"`
-	Headers     map[string]string `json:"headers,omitempty" description:"Additional headers to analyze"`
-	CheckBayes  bool             `json:"check_bayes,omitempty" description:"Include Bayesian analysis"`
-	Verbose     bool             `json:"verbose,omitempty" description:"Return detailed rule explanations"`
+	Content              string            `json:"content,omitempty" description:"Email content including headers: raw RFC 822 or .eml with any line endings, or base64 encoded; required unless content_ref is given"`
+	ContentRef           string            `json:"content_ref,omitempty" description:"Instead of content, an absolute path under content_refs.dirs or an https URL on a host in content_refs.allowed_hosts to fetch the message from"`
+	Headers              map[string]string `json:"headers,omitempty" description:"Additional headers to analyze"`
+	Verbose              bool              `json:"verbose,omitempty" description:"Return detailed rule explanations"`
+	Async                bool              `json:"async,omitempty" description:"Return a scan_id immediately and process the scan in the background"`
+	Profile              string            `json:"profile,omitempty" description:"Named policy profile or scoring preset (aggressive, balanced, permissive) to apply; see get_config for the available profiles"`
+	User                 string            `json:"user,omitempty" description:"spamd user whose preferences and Bayes database to scan with; see get_config for the allowed users"`
+	SpamHeaders          bool              `json:"spam_headers,omitempty" description:"Return the X-Spam-* headers spamd adds, parsed into fields; rule details then come from X-Spam-Report"`
+	CollaborativeFilters string            `json:"collaborative_filters,omitempty" description:"enable or disable the Razor2, Pyzor and DCC tests for this scan, by scanning as the spamd user configured for it; cannot be combined with user"`
+	OCR                  bool              `json:"ocr,omitempty" description:"Read the text of the images of an image-only message with OCR and scan it with the message (requires ocr.enabled)"`
+	Threshold            *float64          `json:"threshold,omitempty" description:"Spam threshold for this scan only, replacing the profile's; clamped to spamassassin.threshold_min and threshold_max"`
 }
 
 type ScanEmailResult struct {
-	Score       float64                    `json:"score" description:"Spam score"`
-	Threshold   float64                    `json:"threshold" description:"Spam threshold"`
-	IsSpam      bool                      `json:"is_spam" description:"Whether email is classified as spam"`
-	RulesHit    []spamassassin.RuleMatch  `json:"rules_hit" description:"Matched spam rules"`
-	Summary     string                    `json:"summary" description:"Human-readable analysis"`
-	Timestamp   time.Time                 `json:"timestamp" description:"Analysis timestamp"`
+	Score                float64                           `json:"score" description:"Spam score"`
+	Threshold            float64                           `json:"threshold" description:"Spam threshold"`
+	IsSpam               bool                              `json:"is_spam" description:"Whether email is classified as spam"`
+	RulesHit             []spamassassin.RuleMatch          `json:"rules_hit" description:"Matched spam rules"`
+	Summary              string                            `json:"summary" description:"Human-readable analysis"`
+	Timestamp            time.Time                         `json:"timestamp" description:"Analysis timestamp"`
+	Tags                 []string                          `json:"tags,omitempty" description:"Operator-defined tags matched by this result"`
+	Profile              string                            `json:"profile,omitempty" description:"Profile the scan was evaluated under"`
+	RequestedThreshold   *float64                          `json:"requested_threshold,omitempty" description:"Threshold the request asked for, when it was clamped to the configured bounds"`
+	User                 string                            `json:"user,omitempty" description:"spamd user the scan ran as"`
+	ScanID               string                            `json:"scan_id,omitempty" description:"Identifier of a deferred scan"`
+	Status               string                            `json:"status,omitempty" description:"Deferred scan status"`
+	DKIM                 []*dkim.Signature                 `json:"dkim,omitempty" description:"DKIM signature verification results (verbose scans only)"`
+	DKIMAlignment        *DKIMAlignment                    `json:"dkim_alignment,omitempty" description:"Alignment of the DKIM signing domains with the From domain (verbose scans only)"`
+	Language             *spamassassin.LanguageResult      `json:"language,omitempty" description:"Language and locale rule hits (verbose scans, and scans under a profile with ok_languages or ok_locales)"`
+	SpamHeaders          *spamassassin.SpamHeaders         `json:"spam_headers,omitempty" description:"X-Spam-* headers spamd added, parsed"`
+	Autolearn            *spamassassin.Autolearn           `json:"autolearn,omitempty" description:"Bayes auto-learning decision spamd made (spam_headers scans only)"`
+	URLFeedMatches       []urlfeeds.Match                  `json:"url_feed_matches,omitempty" description:"URLs of the message listed on the configured URLhaus and PhishTank feeds"`
+	Malware              []AVFinding                       `json:"malware,omitempty" description:"Attachments ClamAV found infected; any makes the message spam"`
+	CollaborativeFilters *spamassassin.CollaborativeResult `json:"collaborative_filters,omitempty" description:"Razor2, Pyzor and DCC results (verbose scans only)"`
+	FuzzyHash            string                            `json:"fuzzy_hash,omitempty" description:"ssdeep-style hash of the body text, for find_similar"`
+	QuarantineID         string                            `json:"quarantine_id,omitempty" description:"ID of the quarantined copy of the message, when its score put it in quarantine"`
+	Input                *model.Input                      `json:"input,omitempty" description:"Detected format of the submitted content and how it was normalized"`
+	OCR                  *ocr.Result                       `json:"ocr,omitempty" description:"Text read from the images of the message with OCR"`
+	HTMLDeception        *deception.Report                 `json:"html_deception,omitempty" description:"Hidden text, tracking pixels, obfuscated JavaScript and credential forms found in the HTML parts, weighted in score points"`
 }
 
 type CheckReputationParams struct {
-	Sender string `json:"sender" description:"Email sender address"`
-	Domain string `json:"domain,omitempty" description:"Sender domain"`
-	IP     string `json:"ip,omitempty" description:"Sender IP address"`
+	Sender  string `json:"sender" description:"Email sender address"`
+	Domain  string `json:"domain,omitempty" description:"Sender domain"`
+	IP      string `json:"ip,omitempty" description:"Sender IP address"`
+	Profile string `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
+	Helo    string `json:"helo,omitempty" description:"Name the sender presented in HELO/EHLO, compared with the forward-confirmed PTR names of the IP"`
+	SkipDNS bool   `json:"skip_dns,omitempty" description:"Skip the DNS blocklist and reverse DNS lookups of the IP and domain"`
 }
 
 type ReputationResult struct {
@@ -54,149 +162,509 @@ type ReputationResult struct {
 	Blocked    bool              `json:"blocked"`
 	Reasons    []string          `json:"reasons"`
 	Details    map[string]string `json:"details"`
+	DNSBL      []dnsbl.Result    `json:"dnsbl,omitempty"`
+
+	// DomainAgeDays is the days since the registrable domain was
+	// registered, when RDAP lookups are enabled and the registry gave a
+	// registration date.
+	DomainAgeDays *int `json:"domain_age_days,omitempty"`
+
+	// ReverseDNS is the forward-confirmed reverse DNS check of the IP, made
+	// for public addresses unless DNS lookups are skipped.
+	ReverseDNS *fcrdns.Result `json:"reverse_dns,omitempty"`
+
+	// Peers is what the instances configured in peer_sync.peers saw of the
+	// sender and domain. It is reported for context and does not change
+	// Reputation.
+	Peers []peersync.Report `json:"peers,omitempty"`
 }
 
 type UpdateRulesParams struct {
-	Source string `json:"source,omitempty" description:"Rule source (official/custom)"`
-	Force  bool   `json:"force,omitempty" description:"Force update even if recent"`
+	Channels  []string `json:"channels,omitempty" description:"Configured sa-update channels to update; all of them by default"`
+	CheckOnly bool     `json:"check_only,omitempty" description:"Only check whether updates are available"`
 }
 
 type TestRulesParams struct {
 	Rules      string   `json:"rules" description:"Custom rule definitions"`
 	TestEmails []string `json:"test_emails" description:"Sample emails to test against"`
+	Profile    string   `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
 }
 
 type TestRulesResult struct {
 	Results []TestResult `json:"results"`
+	Rules   []string     `json:"rules"`
 	Summary string       `json:"summary"`
 }
 
+// TestResult compares the scan of one sample email without (baseline) and
+// with the submitted rules.
 type TestResult struct {
-	Email   string  `json:"email"`
-	Score   float64 `json:"score"`
-	IsSpam  bool    `json:"is_spam"`
-	Rules   []string `json:"rules_matched"`
+	Email         string   `json:"email"`
+	BaselineScore float64  `json:"baseline_score"`
+	Score         float64  `json:"score"`
+	ScoreDelta    float64  `json:"score_delta"`
+	WasSpam       bool     `json:"was_spam"`
+	IsSpam        bool     `json:"is_spam"`
+	Rules         []string `json:"rules_matched"`
+
+	// SubmittedRulesHit are the hits of rules the submission defines or
+	// scores; RulesAdded and RulesRemoved are every rule that hit only with
+	// or only without the submission, such as meta rules built on it.
+	SubmittedRulesHit []spamassassin.RuleMatch `json:"submitted_rules_hit"`
+	RulesAdded        []string                 `json:"rules_added"`
+	RulesRemoved      []string                 `json:"rules_removed"`
+
+	Error string `json:"error,omitempty"`
 }
 
+type GetConfigParams struct{}
+
 type ExplainScoreParams struct {
 	EmailContent string `json:"email_content" description:"Email to analyze"`
+	Profile      string `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
+	User         string `json:"user,omitempty" description:"spamd user whose preferences and Bayes database to scan with; see get_config for the allowed users"`
 }
 
 type ScoreExplanation struct {
-	FinalScore   float64                   `json:"final_score"`
-	RuleDetails  []spamassassin.RuleMatch  `json:"rule_details"`
-	BayesScore   float64                   `json:"bayes_score,omitempty"`
-	NetworkTests []string                  `json:"network_tests"`
-	Explanation  string                    `json:"explanation"`
+	FinalScore   float64                    `json:"final_score"`
+	RuleDetails  []spamassassin.RuleMatch   `json:"rule_details"`
+	BayesScore   float64                    `json:"bayes_score,omitempty"`
+	Bayes        *spamassassin.BayesResult  `json:"bayes,omitempty"`
+	NetworkTests []spamassassin.NetworkTest `json:"network_tests"`
+	ScoreSplit   spamassassin.ScoreSplit    `json:"score_split"`
+	Explanation  string                     `json:"explanation"`
 }
 
 var (
-	emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	ipRegex    = regexp.MustCompile(`^(\d{1,3}\.){3}\d{1,3}$`)
+	emailRegex  = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+	ipRegex     = regexp.MustCompile(`^(\d{1,3}\.){3}\d{1,3}$`)
+	sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
 )
 
 // Defensive operations whitelist
 var allowedOperations = map[string]bool{
-	"scan_email":        true,
-	"check_reputation":  true,
-	"update_rules":      true,
-	"get_config":        true,
-	"test_rules":        true,
-	"explain_score":     true,
+	"scan_email":               true,
+	"check_reputation":         true,
+	"update_rules":             true,
+	"get_config":               true,
+	"test_rules":               true,
+	"explain_score":            true,
+	"parse_email":              true,
+	"get_scan_result":          true,
+	"list_scans":               true,
+	"query_audit_log":          true,
+	"get_rate_limits":          true,
+	"get_stats":                true,
+	"query_history":            true,
+	"get_message_history":      true,
+	"find_similar":             true,
+	"get_trends":               true,
+	"scan_mailbox":             true,
+	"scan_object":              true,
+	"check_spf":                true,
+	"check_dkim":               true,
+	"check_dmarc":              true,
+	"check_bimi":               true,
+	"check_arc":                true,
+	"analyze_headers":          true,
+	"check_header_sanity":      true,
+	"extract_urls":             true,
+	"analyze_attachments":      true,
+	"analyze_mime":             true,
+	"scan_attachments_av":      true,
+	"detect_phishing":          true,
+	"detect_homoglyphs":        true,
+	"extract_iocs":             true,
+	"compare_emails":           true,
+	"compare_engines":          true,
+	"get_rule_info":            true,
+	"lint_rules":               true,
+	"run_regression":           true,
+	"tune_threshold":           true,
+	"add_welcomelist_entry":    true,
+	"remove_welcomelist_entry": true,
+	"list_welcomelist":         true,
+	"add_blocklist_entry":      true,
+	"remove_blocklist_entry":   true,
+	"list_blocklist":           true,
+	"bayes_status":             true,
+	"get_scheduler_status":     true,
+	"import_corpus":            true,
+	"deploy_rules":             true,
+	"publish_iocs":             true,
+	"generate_arf_report":      true,
+	"ingest_fbl_report":        true,
+	"list_quarantine":          true,
+	"inspect_quarantined":      true,
+	"release_quarantined":      true,
+	"set_legal_hold":           true,
+	"get_peer_status":          true,
 }
 
-func New(saClient *spamassassin.Client, security config.SecurityConfig) *Handler {
-	// Create rate limiter
-	limiter := rate.NewLimiter(
-		rate.Every(time.Minute/time.Duration(security.RateLimiting.RequestsPerMinute)),
-		security.RateLimiting.BurstSize,
-	)
+// New creates the tool handlers. auditLog may be nil when persistent audit
+// logging is disabled, collector nil to keep statistics in memory only,
+// scanHistory nil when scan history is disabled, held nil when messages are
+// not quarantined, and welcome and blocked nil to keep the welcomelist and blocklist in memory only. exporter may be nil
+// when verdicts are not exported to a SIEM, feed nil when indicators are
+// not published to a TAXII collection, urlFeeds nil when URLs are not
+// checked against URLhaus and PhishTank, peers nil when no peer reputation
+// is fetched, and locator nil when no GeoIP databases are configured.
+func New(saClient *spamassassin.Client, cfg *config.Config, auditLog *audit.Log, collector *stats.Collector, scanHistory history.Store, held *quarantine.Store, welcome *welcomelist.Store, blocked *blocklist.Store, exporter *siem.Exporter, feed *taxii.Publisher, urlFeeds *urlfeeds.Store, peers *peersync.Syncer, locator *geoip.Locator) *Handler {
+	// Create global and per-client rate limiters
+	limits := cfg.Security.RateLimiting
+	global, perClient := sharedBudgets(limits)
+	limiter := ratelimit.New(global, perClient, limits.PerClient.IdleTimeout)
+	configureLimiter(limiter, cfg)
+
+	if collector == nil {
+		collector = stats.New()
+	}
+	if welcome == nil {
+		welcome = welcomelist.New()
+	}
+	if blocked == nil {
+		blocked = blocklist.New()
+	}
 
-	return &Handler{
-		saClient:   saClient,
-		security:   security,
+	h := &Handler{
+		saClient:    saClient,
+		config:      cfg,
+		rules:       rules.NewCatalog(cfg.SpamAssassin.RulesDirs),
+		sandbox:     sandbox.New(cfg.SpamAssassin),
+		jobs:        jobs.NewManager(cfg.AsyncScan.Workers, cfg.AsyncScan.QueueSize, cfg.AsyncScan.ResultTTL),
+		tagger:      tags.NewTagger(cfg.Tags),
+		webhooks:    webhook.New(cfg.TagWebhooks),
 		rateLimiter: limiter,
+		policy:      auth.NewPolicy(cfg.Auth.OIDC.ToolPolicies),
+		auditLog:    auditLog,
+		redactor:    redact.New(cfg.Redaction),
+		stats:       collector,
+		history:     scanHistory,
+		quarantine:  held,
+		corpus:      corpus.New(cfg.Corpus),
+		welcome:     welcome,
+		blocked:     blocked,
+		bayes:       bayes.New(cfg.Bayes),
+		updater:     ruleupdate.New(cfg.RuleUpdates, cfg.SpamAssassin),
+		reloader:    spamdreload.New(cfg.SpamdReload, saClient.Ping),
+		deployer:    ruledeploy.New(cfg.RuleDeployment),
+		siem:        exporter,
+		feed:        feed,
+		abuseIPDB:   abuseipdb.New(cfg.AbuseIPDB),
+		rdap:        rdap.New(cfg.RDAP),
+		virusTotal:  virustotal.New(cfg.VirusTotal),
+		clamAV:      clamav.New(cfg.ClamAV),
+		urlFeeds:    urlFeeds,
+		peers:       peers,
+		geoip:       locator,
+	}
+	h.scheduler = h.newScheduler(cfg.Scheduler)
+	return h
+}
+
+// configureLimiter applies the global, per-client, per-API-key and per-tool
+// budgets in cfg to limiter.
+func configureLimiter(limiter *ratelimit.Limiter, cfg *config.Config) {
+	limits := cfg.Security.RateLimiting
+	overrides := make(map[string]ratelimit.Limit)
+	for _, key := range cfg.Auth.APIKeys {
+		if key.RequestsPerMinute > 0 {
+			overrides[apiKeyClient(key.Name)] = ratelimit.Limit{RequestsPerMinute: key.RequestsPerMinute, BurstSize: key.BurstSize}
+		}
 	}
+	tools := make(map[string]ratelimit.ToolLimit)
+	for tool, limit := range limits.Tools {
+		tools[tool] = ratelimit.ToolLimit{
+			Limit:      ratelimit.Limit{RequestsPerMinute: limit.RequestsPerMinute, BurstSize: limit.BurstSize},
+			DailyQuota: limit.DailyQuota,
+		}
+	}
+	global, perClient := sharedBudgets(limits)
+	limiter.Reconfigure(global, perClient, limits.PerClient.IdleTimeout, overrides, tools)
+}
+
+// sharedBudgets returns the global and per-client budgets of limits. A
+// disabled budget is the zero Limit, which the limiter does not enforce.
+func sharedBudgets(limits config.RateLimit) (global, perClient ratelimit.Limit) {
+	if !limits.Disabled {
+		global = ratelimit.Limit{RequestsPerMinute: limits.RequestsPerMinute, BurstSize: limits.BurstSize}
+	}
+	if !limits.PerClient.Disabled {
+		perClient = ratelimit.Limit{RequestsPerMinute: limits.PerClient.RequestsPerMinute, BurstSize: limits.PerClient.BurstSize}
+	}
+	return global, perClient
+}
+
+// Reload switches to a reloaded configuration, as built by
+// config.Config.Reloaded: the spam threshold, rate limits, sender and domain
+// lists and size limit apply to the next request.
+func (h *Handler) Reload(cfg *config.Config) {
+	h.saClient.SetThreshold(cfg.SpamAssassin.Threshold)
+	configureLimiter(h.rateLimiter, cfg)
+
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+	h.config = cfg
+}
+
+// settings returns the configuration in effect.
+func (h *Handler) settings() *config.Config {
+	h.configMu.RLock()
+	defer h.configMu.RUnlock()
+	return h.config
+}
+
+// Close stops background workers owned by the handler.
+func (h *Handler) Close() {
+	h.scheduler.Close()
+	h.jobs.Close()
+	h.webhooks.Close(h.settings().Server.ShutdownTimeout)
 }
 
 func (h *Handler) ScanEmail(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ScanEmailParams]) (*mcp.CallToolResultFor[ScanEmailResult], error) {
-	if !h.rateLimiter.Allow() {
+	if !h.allow(ctx, ss) {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
 	req := params.Arguments
+	if req.ContentRef != "" {
+		content, err := h.fetchContentRef(ctx, req.Content, req.ContentRef)
+		if err != nil {
+			return nil, err
+		}
+		req.Content = content
+	}
 
 	// Security validation
-	if err := h.validateEmailContent(req.Content); err != nil {
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
 		return nil, fmt.Errorf("security validation failed: %w", err)
 	}
 
-	logrus.WithFields(logrus.Fields{
-		"operation": "scan_email",
-		"size":      len(req.Content),
-		"verbose":   req.Verbose,
-		"bayes":     req.CheckBayes,
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":             "scan_email",
+		"size":                  len(req.Content),
+		"content_ref":           req.ContentRef,
+		"verbose":               req.Verbose,
+		"async":                 req.Async,
+		"user":                  req.User,
+		"collaborative_filters": req.CollaborativeFilters,
+		"threshold":             req.Threshold,
 	}).Info("Processing email scan request")
 
+	if _, err := h.scanProfile(req); err != nil {
+		return nil, err
+	}
+	if err := h.checkOCR(req.OCR); err != nil {
+		return nil, err
+	}
+
+	// Large submissions with full enrichment are deferred so slow scans
+	// don't exceed MCP client timeouts
+	if h.shouldScanAsync(req) {
+		return h.submitAsyncScan(ctx, ss, req, email)
+	}
+
+	response, err := h.scanEmail(ctx, req, email)
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("Email analysis completed. Score: %.2f, Spam: %v", response.Score, response.IsSpam)
+	if req.Threshold != nil {
+		text += fmt.Sprintf(", threshold: %.2f", response.Threshold)
+		if response.RequestedThreshold != nil {
+			text += fmt.Sprintf(" (requested %.2f, clamped)", *response.RequestedThreshold)
+		}
+	}
+	if in := response.Input; in != nil && in.Normalized {
+		text += fmt.Sprintf(", input: %s with %s line endings, normalized", in.Format, in.LineEndings)
+	}
+	if response.Autolearn != nil {
+		text += fmt.Sprintf(", autolearn: %s", response.Autolearn.Decision)
+	}
+	if d := response.HTMLDeception; d != nil {
+		text += fmt.Sprintf(", HTML deception: %d indicator(s) worth %.2f points", len(d.Indicators), d.Score)
+	}
+	if o := response.OCR; o != nil && o.Text != "" {
+		text += fmt.Sprintf(", OCR read %d characters from %d image(s)", len(o.Text), len(o.Images))
+	}
+	for _, m := range response.URLFeedMatches {
+		text += fmt.Sprintf("\n- %s listed on %s: %s", m.URL, m.Feed, m.Threat)
+	}
+	for _, f := range response.Malware {
+		text += fmt.Sprintf("\n- %s infected: %s", f.Filename, f.Signature)
+	}
+	return &mcp.CallToolResultFor[ScanEmailResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		StructuredContent: *response,
+	}, nil
+}
+
+// fetchContentRef returns the message ref points at, for a scan given by
+// reference. content must be empty, as a scan takes one or the other.
+func (h *Handler) fetchContentRef(ctx context.Context, content, ref string) (string, error) {
+	if content != "" {
+		return "", toolerr.Errorf(toolerr.ValidationFailed, "content and content_ref are mutually exclusive")
+	}
+	settings := h.settings()
+	fetcher, err := contentref.New(settings.ContentRefs)
+	if err != nil {
+		return "", err
+	}
+	return fetcher.Fetch(ctx, ref, settings.Security.MaxEmailSize)
+}
+
+// Scan validates and scans a message synchronously, never deferring it. It
+// backs the command line scan subcommand, which has no MCP session.
+func (h *Handler) Scan(req ScanEmailParams) (*ScanEmailResult, error) {
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+	return h.scanEmail(context.Background(), req, email)
+}
+
+// scanEmail performs the SpamAssassin scan for a validated request and
+// records its outcome in the statistics and scan history, quarantining it
+// when it scores high enough, exporting it to the SIEM and feeding the
+// indicators of spam to TAXII when configured.
+func (h *Handler) scanEmail(ctx context.Context, req ScanEmailParams, email *model.ParsedEmail) (*ScanEmailResult, error) {
+	p, err := h.scanProfile(req)
+	if err != nil {
+		return nil, err
+	}
+
 	// Scan email with SpamAssassin
-	options := spamassassin.ScanOptions{
-		CheckBayes: req.CheckBayes,
-		Verbose:    req.Verbose,
+	options := p.scanOptions(spamassassin.ScanOptions{
+		Verbose:     req.Verbose,
+		SpamHeaders: req.SpamHeaders,
+	})
+	// Tags keyed on rules need the rule hits even without verbose
+	if h.tagger.MatchesRules() {
+		options.Rules = max(options.Rules, spamassassin.RuleNames)
 	}
 
-	result, err := h.saClient.ScanEmail(req.Content, options)
+	// The text OCR reads from images is scanned as part of the message,
+	// so body rules see it
+	raw := email.Raw
+	var ocrResult *ocr.Result
+	if req.OCR {
+		var scanned *model.ParsedEmail
+		if ocrResult, scanned, err = h.readImages(ctx, email); err != nil {
+			return nil, err
+		}
+		raw = scanned.Raw
+	}
+
+	start := time.Now()
+	result, err := h.saClient.ScanEmail(raw, options)
 	if err != nil {
-		logrus.WithError(err).Error("SpamAssassin scan failed")
+		logrus.WithContext(ctx).WithError(err).Error("SpamAssassin scan failed")
 		return nil, fmt.Errorf("scan failed: %w", err)
 	}
+	latency := time.Since(start)
 
 	// Build response
 	response := &ScanEmailResult{
-		Score:     result.Score,
-		Threshold: result.Threshold,
-		IsSpam:    result.IsSpam,
-		RulesHit:  result.RulesHit,
-		Summary:   result.Summary,
-		Timestamp: time.Now(),
-	}
-
-	logrus.WithFields(logrus.Fields{
-		"score":    result.Score,
-		"is_spam":  result.IsSpam,
-		"rules":    len(result.RulesHit),
+		Score:              result.Score,
+		Threshold:          result.Threshold,
+		IsSpam:             result.IsSpam,
+		RulesHit:           result.RulesHit,
+		Summary:            result.Summary,
+		Timestamp:          time.Now(),
+		Profile:            p.name,
+		RequestedThreshold: p.requestedThreshold,
+		User:               p.spamdUser,
+		SpamHeaders:        result.SpamHeaders,
+		Autolearn:          result.Autolearn,
+		Input:              email.Input,
+		OCR:                ocrResult,
+	}
+	if response.Autolearn != nil {
+		ham, spam := h.autolearnThresholds()
+		response.Autolearn.Explain(result.Score, ham, spam)
+	}
+	// The profile's ok_languages and ok_locales decide which language and
+	// locale rule hits count.
+	response.Language = spamassassin.Languages(result.RulesHit, email.Charsets(), declaredLanguages(email), p.languages)
+	if response.Language != nil && response.Language.Adjustment != 0 {
+		response.Score = math.Round((result.Score+response.Language.Adjustment)*1000) / 1000
+		response.IsSpam = response.Score >= response.Threshold
+	}
+
+	ruleNames := make([]string, 0, len(result.RulesHit))
+	for _, rule := range result.RulesHit {
+		ruleNames = append(ruleNames, rule.Name)
+	}
+	response.Tags = h.tagger.Tags(response.Score, ruleNames)
+	response.FuzzyHash = similarity.FuzzyHash(email)
+	if report := deception.Analyze(email); len(report.Indicators) > 0 {
+		response.HTMLDeception = report
+	}
+	if req.Verbose {
+		response.DKIM = h.verifyDKIM(ctx, email.Raw)
+		response.DKIMAlignment = dkimAlignment(email.FromDomain(), response.DKIM)
+		response.CollaborativeFilters = spamassassin.CollaborativeFilters(result.RulesHit)
+		response.CollaborativeFilters.Setting = p.collaborativeFilters
+	}
+	response.URLFeedMatches = h.urlFeeds.Match(urls.Extract(email))
+	// A ClamAV signature hit makes the message spam whatever its score.
+	if response.Malware = h.detectMalware(ctx, email); len(response.Malware) > 0 {
+		response.IsSpam = true
+	}
+	h.stats.RecordScan(response.Score, response.IsSpam, ruleNames, latency)
+	h.recordHistory(ctx, email, response, ruleNames)
+	h.quarantineMessage(ctx, email, response, ruleNames)
+	h.exportVerdict(email, response, ruleNames)
+	h.routeTags(email, response, ruleNames)
+	h.observeIndicators(email, response)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"score":      response.Score,
+		"is_spam":    response.IsSpam,
+		"rules":      len(result.RulesHit),
+		"tags":       response.Tags,
+		"message_id": email.MessageID,
 	}).Info("Email scan completed")
 
-	return &mcp.CallToolResultFor[ScanEmailResult]{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: fmt.Sprintf("Email analysis completed. Score: %.2f, Spam: %v", response.Score, response.IsSpam)},
-		},
-	}, nil
+	return response, nil
 }
 
-func (h *Handler) CheckReputation(ctx context.Context, params json.RawMessage) (any, error) {
-	if !h.rateLimiter.Allow() {
+func (h *Handler) CheckReputation(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckReputationParams]) (*mcp.CallToolResultFor[*ReputationResult], error) {
+	if !h.allow(ctx, ss) {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
-	var req CheckReputationParams
-	if err := json.Unmarshal(params, &req); err != nil {
-		return nil, fmt.Errorf("invalid parameters: %w", err)
-	}
+	req := params.Arguments
 
 	// Validate input
 	if req.Sender != "" && !emailRegex.MatchString(req.Sender) {
-		return nil, fmt.Errorf("invalid email address format")
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid email address format")
 	}
 
 	if req.IP != "" && !ipRegex.MatchString(req.IP) {
-		return nil, fmt.Errorf("invalid IP address format")
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid IP address format")
+	}
+
+	if len(req.Helo) > 255 {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "HELO name exceeds 255 characters")
 	}
 
-	logrus.WithFields(logrus.Fields{
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"operation": "check_reputation",
 		"sender":    req.Sender,
 		"domain":    req.Domain,
 		"ip":        req.IP,
+		"profile":   p.name,
+		"skip_dns":  req.SkipDNS,
 	}).Info("Processing reputation check")
 
 	// Extract domain from sender if not provided
@@ -212,20 +680,58 @@ func (h *Handler) CheckReputation(ctx context.Context, params json.RawMessage) (
 	blocked := false
 	var reasons []string
 
-	for _, blockedDomain := range h.security.BlockedDomains {
+	for _, blockedDomain := range p.blockedDomains {
 		if strings.Contains(domain, blockedDomain) {
 			blocked = true
 			reasons = append(reasons, fmt.Sprintf("Domain %s is blocked", blockedDomain))
 		}
 	}
+	for _, entry := range h.blocked.Match(req.Sender, domain, req.IP) {
+		blocked = true
+		reasons = append(reasons, fmt.Sprintf("%s matches blocklist entry %s", entry.Kind, entry.Value))
+	}
+
+	details := map[string]string{
+		"check_time": time.Now().Format(time.RFC3339),
+		"source":     "spamassassin-mcp",
+	}
+
+	var listings []dnsbl.Result
+	var rdns *fcrdns.Result
+	var rdnsListed, rdnsNotes []string
+	if !req.SkipDNS {
+		listings = h.checkDNSBL(ctx, req.IP, domain)
+		rdns, rdnsListed, rdnsNotes = h.checkFCrDNS(ctx, req.IP, req.Helo, details)
+	}
+	listed := append(dnsblReasons(listings), rdnsListed...)
+	domainAge := h.addRDAPDetails(ctx, domain, details)
+	newDomain := domainAge != nil && *domainAge < h.settings().RDAP.NewDomainDays
+	if newDomain {
+		listed = append(listed, fmt.Sprintf("Domain %s was registered %d days ago", details["rdap_domain"], *domainAge))
+	}
 
 	// Determine reputation (simplified logic)
 	reputation := "unknown"
 	if blocked {
 		reputation = "bad"
-	} else if contains(h.security.AllowedSenders, req.Sender) {
+	} else if contains(p.allowedSenders, req.Sender) {
+		reputation = "good"
+	} else if entry := h.welcome.Match(req.Sender); entry != nil {
 		reputation = "good"
+		reasons = append(reasons, fmt.Sprintf("Sender matches welcomelist entry %s", entry.Address))
+	} else if len(listed) > 0 {
+		reputation = "bad"
+	}
+	reasons = append(reasons, listed...)
+	reasons = append(reasons, rdnsNotes...)
+	peers := h.peers.Reputation(req.Sender, domain)
+	var peerReasons []string
+	for _, r := range peers {
+		if r.Spam > 0 || r.Complaints > 0 {
+			peerReasons = append(peerReasons, fmt.Sprintf("Peer %s: %d of %d scans of %s %s were spam, %d complaints", r.Peer, r.Spam, r.Scans, r.Kind, r.Value, r.Complaints))
+		}
 	}
+	reasons = append(reasons, peerReasons...)
 
 	result := &ReputationResult{
 		Sender:     req.Sender,
@@ -234,164 +740,371 @@ func (h *Handler) CheckReputation(ctx context.Context, params json.RawMessage) (
 		Reputation: reputation,
 		Blocked:    blocked,
 		Reasons:    reasons,
-		Details: map[string]string{
-			"check_time": time.Now().Format(time.RFC3339),
-			"source":     "spamassassin-mcp",
-		},
+		Details:    details,
+		DNSBL:      listings,
+
+		DomainAgeDays: domainAge,
+		ReverseDNS:    rdns,
+		Peers:         peers,
 	}
+	h.addAbuseIPDBDetails(ctx, req.IP, result.Details)
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"reputation": reputation,
 		"blocked":    blocked,
+		"listings":   len(listed),
+		"new_domain": newDomain,
+		"fcrdns":     rdns != nil && rdns.FCrDNS,
+		"peers":      len(peers),
 	}).Info("Reputation check completed")
 
-	return result, nil
+	text := fmt.Sprintf("Reputation for %s: %s (blocked: %v)", req.Sender, reputation, blocked)
+	for _, reason := range append(listed, peerReasons...) {
+		text += "\n" + reason
+	}
+
+	return &mcp.CallToolResultFor[*ReputationResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		StructuredContent: result,
+	}, nil
 }
 
-func (h *Handler) GetConfig(ctx context.Context, params json.RawMessage) (any, error) {
-	logrus.Info("Retrieving SpamAssassin configuration")
-	return h.saClient.GetConfig()
+func (h *Handler) GetConfig(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetConfigParams]) (*mcp.CallToolResultFor[*spamassassin.ConfigInfo], error) {
+	logrus.WithContext(ctx).Info("Retrieving SpamAssassin configuration")
+
+	info, err := h.saClient.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve configuration: %w", err)
+	}
+	info.Profiles = h.profileNames()
+	info.Users = h.settings().SpamAssassin.AllowedUsers
+
+	info.Version = "unknown"
+	if version, err := h.sandbox.Version(ctx); err == nil {
+		info.Version = version
+	} else if info.Spamd != nil && info.Spamd.Version != "" {
+		info.Version = info.Spamd.Version
+	} else {
+		logrus.WithContext(ctx).WithError(err).Warn("Failed to read SpamAssassin version")
+	}
+
+	summary, err := h.rules.Summarize()
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read rule files")
+		return nil, fmt.Errorf("failed to read rule files: %w", err)
+	}
+	info.BayesEnabled = summary.BayesEnabled()
+	info.Bayes = summary.Bayes
+	info.RuleCount = summary.Rules
+	info.SubRuleCount = summary.SubRules
+	info.RulesByType = summary.RulesByType
+	info.RuleFiles = summary.Files
+	info.Plugins = summary.Plugins
+	info.TrustedNetworks = summary.TrustedNetworks
+	info.InternalNetworks = summary.InternalNetworks
+
+	text := fmt.Sprintf("SpamAssassin %s, threshold %.2f, %d rules in %d files, %d plugins", info.Version, info.Threshold, info.RuleCount, info.RuleFiles, len(info.Plugins))
+	if info.Spamd != nil {
+		text += fmt.Sprintf(", spamd protocol %s", info.Spamd.Protocol)
+		if info.Spamd.Version != "" && info.Spamd.Version != info.Version {
+			text += fmt.Sprintf(" (spamd runs SpamAssassin %s)", info.Spamd.Version)
+		}
+	}
+	switch {
+	case !info.SpamdReachable:
+		text += "; WARNING: spamd is not reachable"
+	case *info.RequiredScore != info.Threshold:
+		text += fmt.Sprintf("; spamd applies required_score %.2f", *info.RequiredScore)
+	}
+	return &mcp.CallToolResultFor[*spamassassin.ConfigInfo]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+		StructuredContent: info,
+	}, nil
 }
 
-func (h *Handler) UpdateRules(ctx context.Context, params json.RawMessage) (any, error) {
-	if !h.rateLimiter.Allow() {
+// UpdateRules installs rule updates from the configured sa-update channels
+// and reports what changed. The updated configuration is linted, but spamd
+// keeps the previous rules until it reloads.
+func (h *Handler) UpdateRules(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[UpdateRulesParams]) (*mcp.CallToolResultFor[*ruleupdate.Report], error) {
+	if !h.allow(ctx, ss) {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
-	var req UpdateRulesParams
-	if err := json.Unmarshal(params, &req); err != nil {
-		return nil, fmt.Errorf("invalid parameters: %w", err)
-	}
+	req := params.Arguments
 
-	logrus.WithFields(logrus.Fields{
-		"operation": "update_rules",
-		"source":    req.Source,
-		"force":     req.Force,
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":  "update_rules",
+		"channels":   req.Channels,
+		"check_only": req.CheckOnly,
 	}).Info("Processing rule update request")
 
-	if err := h.saClient.UpdateRules(); err != nil {
+	progress := newProgressReporter(ss, params, 1)
+	progress.Report(ctx, 0, "Running sa-update")
+
+	report, err := h.updater.Update(ctx, ruleupdate.Options{Channels: req.Channels, CheckOnly: req.CheckOnly})
+	if errors.Is(err, ruleupdate.ErrUnavailable) {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to run sa-update")
+		return nil, fmt.Errorf("rule updates are unavailable: %w", err)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Rule update failed")
 		return nil, fmt.Errorf("rule update failed: %w", err)
 	}
 
-	return map[string]any{
-		"status":    "success",
-		"message":   "Rules updated successfully",
-		"timestamp": time.Now(),
+	var updated []string
+	for _, ch := range report.Channels {
+		if ch.Updated {
+			updated = append(updated, fmt.Sprintf("%s %s -> %s", ch.Channel, ch.PreviousVersion, ch.Version))
+		}
+	}
+	if report.ReloadRequired && report.Lint.Valid && h.reloader.Enabled() {
+		progress.Report(ctx, 1, "Reloading spamd")
+		report.Reload = h.applyReload(ctx)
+		report.ReloadRequired = !report.Reload.Reloaded
+	}
+	if len(updated) > 0 {
+		recordChange(ctx, "rules: updated %s%s", strings.Join(updated, ", "), reloadChange(report.Reload))
+	}
+
+	progress.Report(ctx, 1, "Rule update complete")
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"status":   report.Status,
+		"added":    len(report.Added),
+		"removed":  len(report.Removed),
+		"modified": len(report.Modified),
+	}).Info("Rule update completed")
+
+	var text string
+	switch report.Status {
+	case ruleupdate.StatusAvailable:
+		text = "Rule updates are available"
+	case ruleupdate.StatusUpToDate:
+		text = "Rules are up to date"
+	default:
+		text = fmt.Sprintf("Rules %s: %d files added, %d removed, %d modified", report.Status, len(report.Added), len(report.Removed), len(report.Modified))
+		if len(updated) > 0 {
+			text += "; " + strings.Join(updated, ", ")
+		}
+		if report.Lint != nil && !report.Lint.Valid {
+			text += fmt.Sprintf("; WARNING: the updated configuration fails lint with %d issue(s), do not reload spamd", len(report.Lint.Issues))
+		}
+		text += reloadSummary(report.Reload)
+	}
+	return &mcp.CallToolResultFor[*ruleupdate.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
 	}, nil
 }
 
-func (h *Handler) TestRules(ctx context.Context, params json.RawMessage) (any, error) {
-	if !h.rateLimiter.Allow() {
+// TestRules scans each sample email twice in sandbox configurations, without
+// and with the submitted rules, and reports the score change the rules
+// cause. The live SpamAssassin configuration is never modified.
+func (h *Handler) TestRules(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[TestRulesParams]) (*mcp.CallToolResultFor[*TestRulesResult], error) {
+	if !h.allow(ctx, ss) {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
-	var req TestRulesParams
-	if err := json.Unmarshal(params, &req); err != nil {
-		return nil, fmt.Errorf("invalid parameters: %w", err)
-	}
+	req := params.Arguments
 
 	// Validate input
-	if req.Rules == "" {
-		return nil, fmt.Errorf("rules cannot be empty")
+	if err := sandbox.Validate(req.Rules); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	if len(req.TestEmails) == 0 || len(req.TestEmails) > sandbox.MaxTestEmails {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "between 1 and %d test emails are required, got %d", sandbox.MaxTestEmails, len(req.TestEmails))
+	}
+
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	threshold := h.saClient.Threshold()
+	if p.threshold != nil {
+		threshold = *p.threshold
 	}
 
-	logrus.WithFields(logrus.Fields{
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
 		"operation":   "test_rules",
 		"test_emails": len(req.TestEmails),
 	}).Info("Processing rule test request")
 
-	// This is a simplified implementation
-	// In a real scenario, you'd create a temporary SpamAssassin configuration
-	// and test the rules against the provided emails
+	session, err := h.sandbox.NewSession(req.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare rule sandbox: %w", err)
+	}
+	defer session.Close()
+
+	submitted := sandbox.RuleNames(req.Rules)
+	progress := newProgressReporter(ss, params, len(req.TestEmails))
 
 	results := make([]TestResult, 0, len(req.TestEmails))
-	for _, email := range req.TestEmails {
-		if err := h.validateEmailContent(email); err != nil {
-			continue // Skip invalid emails
+	matched, changed := 0, 0
+	for i, email := range req.TestEmails {
+		progress.Report(ctx, i, fmt.Sprintf("Testing email %d of %d", i+1, len(req.TestEmails)))
+
+		result := TestResult{
+			Email:             truncateString(email, 100),
+			Rules:             make([]string, 0),
+			SubmittedRulesHit: make([]spamassassin.RuleMatch, 0),
+			RulesAdded:        make([]string, 0),
+			RulesRemoved:      make([]string, 0),
+		}
+		if _, err := h.validateEmailContent(email); err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
 		}
 
-		// Scan with current rules (simplified)
-		scanResult, err := h.saClient.ScanEmail(email, spamassassin.ScanOptions{Verbose: true})
+		baseline, scan, err := session.Compare(ctx, email)
+		if errors.Is(err, sandbox.ErrUnavailable) {
+			return nil, fmt.Errorf("rule testing is unavailable: %w", err)
+		}
 		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
 			continue
 		}
 
-		result := TestResult{
-			Email:  truncateString(email, 100),
-			Score:  scanResult.Score,
-			IsSpam: scanResult.IsSpam,
-			Rules:  make([]string, 0, len(scanResult.RulesHit)),
-		}
+		result.BaselineScore = baseline.Score
+		result.Score = scan.Score
+		result.ScoreDelta = math.Round((scan.Score-baseline.Score)*1000) / 1000
+		result.WasSpam = baseline.Score >= threshold
+		result.IsSpam = scan.Score >= threshold
 
-		for _, rule := range scanResult.RulesHit {
+		before := make(map[string]bool)
+		for _, rule := range baseline.RulesHit {
+			before[rule.Name] = true
+		}
+		after := make(map[string]bool)
+		for _, rule := range scan.RulesHit {
+			after[rule.Name] = true
 			result.Rules = append(result.Rules, rule.Name)
+			if contains(submitted, rule.Name) {
+				result.SubmittedRulesHit = append(result.SubmittedRulesHit, rule)
+			}
+			if !before[rule.Name] {
+				result.RulesAdded = append(result.RulesAdded, rule.Name)
+			}
+		}
+		for _, rule := range baseline.RulesHit {
+			if !after[rule.Name] {
+				result.RulesRemoved = append(result.RulesRemoved, rule.Name)
+			}
 		}
 
+		if len(result.SubmittedRulesHit) > 0 {
+			matched++
+		}
+		if result.WasSpam != result.IsSpam {
+			changed++
+		}
 		results = append(results, result)
 	}
 
-	return &TestRulesResult{
+	progress.Report(ctx, len(req.TestEmails), "Rule testing complete")
+
+	response := &TestRulesResult{
 		Results: results,
-		Summary: fmt.Sprintf("Tested %d emails against custom rules", len(results)),
+		Rules:   submitted,
+		Summary: fmt.Sprintf("Tested %d emails against custom rules: %d matched the submitted rules, %d changed verdict", len(results), matched, changed),
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"matched": matched,
+		"changed": changed,
+	}).Info("Rule test completed")
+
+	return &mcp.CallToolResultFor[*TestRulesResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: response.Summary},
+		},
+		StructuredContent: response,
 	}, nil
 }
 
-func (h *Handler) ExplainScore(ctx context.Context, params json.RawMessage) (any, error) {
-	if !h.rateLimiter.Allow() {
+func (h *Handler) ExplainScore(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ExplainScoreParams]) (*mcp.CallToolResultFor[*ScoreExplanation], error) {
+	if !h.allow(ctx, ss) {
 		return nil, fmt.Errorf("rate limit exceeded")
 	}
 
-	var req ExplainScoreParams
-	if err := json.Unmarshal(params, &req); err != nil {
-		return nil, fmt.Errorf("invalid parameters: %w", err)
-	}
+	req := params.Arguments
 
-	if err := h.validateEmailContent(req.EmailContent); err != nil {
+	email, err := h.validateEmailContent(req.EmailContent)
+	if err != nil {
 		return nil, fmt.Errorf("security validation failed: %w", err)
 	}
 
-	logrus.WithField("operation", "explain_score").Info("Processing score explanation request")
+	p, err := h.userProfile(req.Profile, req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "explain_score").Info("Processing score explanation request")
 
 	// Scan with verbose output
-	result, err := h.saClient.ScanEmail(req.EmailContent, spamassassin.ScanOptions{
-		Verbose:    true,
-		CheckBayes: true,
-	})
+	result, err := h.saClient.ScanEmail(email.Raw, p.scanOptions(spamassassin.ScanOptions{
+		Verbose: true,
+	}))
 	if err != nil {
 		return nil, fmt.Errorf("scan failed: %w", err)
 	}
 
 	// Build explanation
-	explanation := h.buildScoreExplanation(result)
+	breakdown := spamassassin.Break(result.RulesHit)
+	explanation := h.buildScoreExplanation(result, breakdown)
 
 	response := &ScoreExplanation{
 		FinalScore:   result.Score,
 		RuleDetails:  result.RulesHit,
+		BayesScore:   breakdown.Split.Bayes,
+		Bayes:        breakdown.Bayes,
+		NetworkTests: breakdown.NetworkTests,
+		ScoreSplit:   breakdown.Split,
 		Explanation:  explanation,
-		NetworkTests: []string{}, // Would be populated with actual network test results
 	}
 
-	return response, nil
+	return &mcp.CallToolResultFor[*ScoreExplanation]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: explanation},
+		},
+		StructuredContent: response,
+	}, nil
 }
 
-func (h *Handler) validateEmailContent(content string) error {
-	if len(content) > int(h.security.MaxEmailSize) {
-		return fmt.Errorf("email size exceeds limit of %d bytes", h.security.MaxEmailSize)
+// validateEmailContent enforces size limits, decodes the submission into a
+// CRLF message and parses it into the shared intermediate representation, so
+// callers never need to re-parse it. Callers pass email.Raw, not the
+// submitted content, to spamd and other engines.
+func (h *Handler) validateEmailContent(content string) (*model.ParsedEmail, error) {
+	maxSize := h.settings().Security.MaxEmailSize
+	if len(content) > int(maxSize) {
+		return nil, toolerr.Errorf(toolerr.SizeExceeded, "email size exceeds limit of %d bytes", maxSize)
 	}
 
-	if content == "" {
-		return fmt.Errorf("email content cannot be empty")
+	raw, input := model.Normalize(content)
+	if strings.TrimSpace(raw) == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "email content cannot be empty")
+	}
+	// Converting LF line endings can grow a message past the limit.
+	if len(raw) > int(maxSize) {
+		return nil, toolerr.Errorf(toolerr.SizeExceeded, "email size exceeds limit of %d bytes after converting line endings to CRLF", maxSize)
 	}
 
 	// Parse as email to validate format
-	if _, err := mail.ReadMessage(strings.NewReader(content)); err != nil {
-		return fmt.Errorf("invalid email format: %w", err)
+	email, err := model.Parse(raw)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
 	}
-
-	return nil
+	email.Input = input
+	return email, nil
 }
 
-func (h *Handler) buildScoreExplanation(result *spamassassin.ScanResult) string {
+func (h *Handler) buildScoreExplanation(result *spamassassin.ScanResult, breakdown *spamassassin.Breakdown) string {
 	var explanation strings.Builder
 
 	explanation.WriteString(fmt.Sprintf("Final Score: %.2f (Threshold: %.2f)\n", result.Score, result.Threshold))
@@ -406,6 +1119,24 @@ func (h *Handler) buildScoreExplanation(result *spamassassin.ScanResult) string
 		explanation.WriteString("No spam rules triggered.\n")
 	}
 
+	if breakdown.Bayes != nil {
+		explanation.WriteString(fmt.Sprintf("\nBayesian Analysis: %s spam probability (%.2f points)\n", breakdown.Bayes.Probability, breakdown.Bayes.Score))
+	} else {
+		explanation.WriteString("\nBayesian Analysis: not available (Bayes disabled or not trained enough)\n")
+	}
+
+	if len(breakdown.NetworkTests) > 0 {
+		explanation.WriteString("\nNetwork Tests:\n")
+		for _, test := range breakdown.NetworkTests {
+			explanation.WriteString(fmt.Sprintf("  %s (%s): %.2f - %s\n", test.Name, test.Kind, test.Score, test.Description))
+		}
+	} else {
+		explanation.WriteString("\nNo network tests triggered.\n")
+	}
+
+	split := breakdown.Split
+	explanation.WriteString(fmt.Sprintf("\nScore Split: local %.2f, Bayes %.2f, network %.2f\n", split.Local, split.Bayes, split.Network))
+
 	return explanation.String()
 }
 
@@ -423,4 +1154,4 @@ func truncateString(s string, maxLen int) string {
 		return s
 	}
 	return s[:maxLen] + "..."
-}
\ No newline at end of file
+}
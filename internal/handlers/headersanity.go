@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/headersanity"
+)
+
+type CheckHeaderSanityParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+// CheckHeaderSanity flags Message-ID, Date, Subject encoding, mailer and
+// HELO anomalies in the header block of a message as weighted findings. No
+// SpamAssassin scan or DNS lookup is performed.
+func (h *Handler) CheckHeaderSanity(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckHeaderSanityParams]) (*mcp.CallToolResultFor[*headersanity.Report], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	report := headersanity.Analyze(email, time.Now())
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_header_sanity",
+		"size":      email.Size,
+		"findings":  len(report.Findings),
+		"score":     report.Score,
+	}).Info("Header sanity check completed")
+
+	text := fmt.Sprintf("Header sanity score %.2f from %d findings", report.Score, len(report.Findings))
+	for _, f := range report.Findings {
+		text += fmt.Sprintf("\n- %s (%.1f): %s", f.Type, f.Weight, f.Description)
+	}
+
+	return &mcp.CallToolResultFor[*headersanity.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/siem"
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/webhook"
+)
+
+// historyScanLimit bounds the entries a similarity search reads from the
+// store. Searches consider only the most recent entries beyond it.
+const historyScanLimit = 10000
+
+// historyListSchema defines the filter and sort fields of query_history. The
+// store applies them, so each field must have a history.Criteria filter or
+// be one of history.SortFields.
+var historyListSchema = listquery.Schema[*history.Entry]{
+	Fields: map[string]listquery.Field[*history.Entry]{
+		"scanned_at": listquery.Time(func(e *history.Entry) time.Time { return e.ScannedAt }),
+		"score":      listquery.Number(func(e *history.Entry) float64 { return e.Score }),
+		"hash":       listquery.String(func(e *history.Entry) string { return e.Hash }),
+		"sender":     listquery.String(func(e *history.Entry) string { return e.Sender }),
+		"verdict":    listquery.String(func(e *history.Entry) string { return e.Verdict() }),
+		"profile":    listquery.String(func(e *history.Entry) string { return e.Profile }),
+		"complaint":  listquery.String(func(e *history.Entry) string { return strconv.FormatBool(e.Complaint) }),
+		"legal_hold": listquery.String(func(e *history.Entry) string { return strconv.FormatBool(e.LegalHold) }),
+		// Filtering matches entries carrying any of the tags
+		"tags": {Value: func(e *history.Entry) string { return strings.Join(e.Tags, ",") }},
+	},
+	Key:         func(e *history.Entry) string { return fmt.Sprintf("%020d", e.ID) },
+	DefaultSort: "-scanned_at",
+}
+
+type GetMessageHistoryParams struct {
+	Hash    string `json:"hash,omitempty" description:"SHA-256 hash of the raw message, as reported by parse_email and query_history"`
+	Content string `json:"content,omitempty" description:"Raw email content; its hash is looked up"`
+	Sender  string `json:"sender,omitempty" description:"Sender address to look up"`
+	Limit   int    `json:"limit,omitempty" description:"Maximum scans to return, newest first (default 50, max 500)"`
+}
+
+type GetTrendsParams struct {
+	Window string `json:"window,omitempty" description:"Reporting period: hour (5 minute buckets), day (hourly buckets) or week (daily buckets); default day"`
+}
+
+type MessageHistoryResult struct {
+	Hash      string           `json:"hash,omitempty"`
+	Sender    string           `json:"sender,omitempty"`
+	Scans     int              `json:"scans"`
+	Spam      int              `json:"spam"`
+	FirstSeen *time.Time       `json:"first_seen,omitempty"`
+	LastSeen  *time.Time       `json:"last_seen,omitempty"`
+	Entries   []*history.Entry `json:"entries"`
+}
+
+// recordHistory stores the outcome of a scan. Failures are logged and never
+// fail the scan.
+func (h *Handler) recordHistory(ctx context.Context, email *model.ParsedEmail, result *ScanEmailResult, rules []string) {
+	if h.history == nil {
+		return
+	}
+
+	entry := &history.Entry{
+		Hash:      email.SHA256,
+		Score:     result.Score,
+		Threshold: result.Threshold,
+		IsSpam:    result.IsSpam,
+		Rules:     rules,
+		Tags:      result.Tags,
+		Profile:   result.Profile,
+		ScannedAt: result.Timestamp,
+		FuzzyHash: result.FuzzyHash,
+	}
+	if len(email.From) > 0 {
+		entry.Sender = email.From[0].Address
+	}
+	if err := h.history.Record(context.WithoutCancel(ctx), entry); err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to record scan history")
+	}
+}
+
+// exportVerdict sends the outcome of a scan to the SIEM collector, if one is
+// configured.
+func (h *Handler) exportVerdict(email *model.ParsedEmail, result *ScanEmailResult, rules []string) {
+	verdict := siem.Verdict{
+		Time:      result.Timestamp,
+		Score:     result.Score,
+		Threshold: result.Threshold,
+		IsSpam:    result.IsSpam,
+		Rules:     rules,
+		Tags:      result.Tags,
+		Profile:   result.Profile,
+		User:      result.User,
+		Hash:      email.SHA256,
+		MessageID: email.MessageID,
+		Subject:   email.Subject,
+	}
+	if len(email.From) > 0 {
+		verdict.Sender = email.From[0].Address
+	}
+	h.siem.Export(verdict)
+}
+
+// routeTags posts the outcome of a tagged scan to the webhooks routed its
+// tags, if any are configured.
+func (h *Handler) routeTags(email *model.ParsedEmail, result *ScanEmailResult, rules []string) {
+	verdict := webhook.Verdict{
+		Time:      result.Timestamp,
+		Tags:      result.Tags,
+		Verdict:   "ham",
+		Score:     result.Score,
+		Threshold: result.Threshold,
+		Rules:     rules,
+		Profile:   result.Profile,
+		Hash:      email.SHA256,
+		MessageID: email.MessageID,
+	}
+	if result.IsSpam {
+		verdict.Verdict = "spam"
+	}
+	if len(email.From) > 0 {
+		verdict.Sender = email.From[0].Address
+	}
+	h.webhooks.Route(verdict)
+}
+
+// QueryHistory lists recorded scans with filtering, sorting and pagination.
+func (h *Handler) QueryHistory(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*history.Entry]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "query_history").Info("Processing scan history query")
+
+	if h.history == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "scan history is not enabled (set history.dsn)")
+	}
+
+	// The store filters, sorts and pages the entries, so a query reads only
+	// the page it returns however much history matches.
+	q := params.Arguments
+	window, err := historyListSchema.Window(q)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	criteria, err := historyCriteria(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+	criteria.Sort = window.Sort
+
+	total, err := h.history.Count(ctx, criteria)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read scan history")
+		return nil, fmt.Errorf("failed to read scan history")
+	}
+	if window.Offset > total {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, listquery.ErrInvalidCursor)
+	}
+
+	criteria.Offset, criteria.Limit = window.Offset, window.Limit
+	entries, err := h.history.Find(ctx, criteria)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read scan history")
+		return nil, fmt.Errorf("failed to read scan history")
+	}
+
+	page := listquery.NewPage(entries, total, window)
+	summary := fmt.Sprintf("%d of %d matching scans", len(page.Items), page.Total)
+
+	return &mcp.CallToolResultFor[*listquery.Page[*history.Entry]]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: summary}},
+		StructuredContent: page,
+	}, nil
+}
+
+// GetMessageHistory returns the prior verdicts for a message, identified by
+// its hash or content, or for a sender.
+func (h *Handler) GetMessageHistory(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetMessageHistoryParams]) (*mcp.CallToolResultFor[*MessageHistoryResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+
+	logrus.WithContext(ctx).WithField("operation", "get_message_history").Info("Processing message history lookup")
+
+	if h.history == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "scan history is not enabled (set history.dsn)")
+	}
+
+	hash := strings.ToLower(req.Hash)
+	if req.Content != "" {
+		email, err := h.validateEmailContent(req.Content)
+		if err != nil {
+			return nil, fmt.Errorf("security validation failed: %w", err)
+		}
+		if hash != "" && hash != email.SHA256 {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "hash does not match the hash of content")
+		}
+		hash = email.SHA256
+	}
+	if hash == "" && req.Sender == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "one of hash, content or sender is required")
+	}
+	if req.Sender != "" && !emailRegex.MatchString(req.Sender) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid email address format")
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = listquery.DefaultLimit
+	}
+	if limit > listquery.MaxLimit {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "limit must not exceed %d", listquery.MaxLimit)
+	}
+
+	criteria := history.Criteria{Limit: limit}
+	if hash != "" {
+		criteria.Hashes = []string{hash}
+	}
+	if req.Sender != "" {
+		criteria.Senders = []string{req.Sender}
+	}
+	entries, err := h.history.Find(ctx, criteria)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read scan history")
+		return nil, fmt.Errorf("failed to read scan history")
+	}
+
+	result := &MessageHistoryResult{
+		Hash:    hash,
+		Sender:  strings.ToLower(req.Sender),
+		Scans:   len(entries),
+		Entries: entries,
+	}
+	if result.Entries == nil {
+		result.Entries = []*history.Entry{}
+	}
+	for _, e := range entries {
+		if e.IsSpam {
+			result.Spam++
+		}
+	}
+
+	text := "No prior scans found"
+	if n := len(entries); n > 0 {
+		result.LastSeen = &entries[0].ScannedAt
+		result.FirstSeen = &entries[n-1].ScannedAt
+		text = fmt.Sprintf("%d prior scans (%d spam); last verdict %s with score %.2f at %s",
+			n, result.Spam, entries[0].Verdict(), entries[0].Score, entries[0].ScannedAt.Format(time.RFC3339))
+	}
+
+	return &mcp.CallToolResultFor[*MessageHistoryResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// GetTrends reports spam volume, average score and emerging rule hits over
+// the last hour, day or week of scan history.
+func (h *Handler) GetTrends(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetTrendsParams]) (*mcp.CallToolResultFor[*history.TrendReport], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	window := params.Arguments.Window
+	if window == "" {
+		window = "day"
+	}
+	if _, ok := history.Windows[window]; !ok {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "window must be one of %s", strings.Join(history.WindowNames(), ", "))
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "get_trends",
+		"window":    window,
+	}).Info("Processing trend report request")
+
+	if h.history == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "scan history is not enabled (set history.dsn)")
+	}
+
+	report, err := history.Trends(ctx, h.history, window, time.Now())
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read scan history")
+		return nil, fmt.Errorf("failed to read scan history")
+	}
+
+	text := fmt.Sprintf("%d scans (%d spam) in the last %s, against %d (%d spam) in the %s before",
+		report.Scans, report.Spam, window, report.PreviousScans, report.PreviousSpam, window)
+	if len(report.EmergingRules) > 0 {
+		top := report.EmergingRules[0]
+		text += fmt.Sprintf("; top emerging rule %s hit %d of %d scans", top.Rule, top.Hits, report.Scans)
+	}
+
+	return &mcp.CallToolResultFor[*history.TrendReport]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
+
+// historyCriteria translates the query_history filters, already checked
+// against historyListSchema, to store criteria.
+func historyCriteria(filter map[string]string) (history.Criteria, error) {
+	criteria := history.Criteria{
+		Hashes:   splitFilter(filter["hash"]),
+		Senders:  splitFilter(filter["sender"]),
+		Profiles: splitFilter(filter["profile"]),
+		Tags:     splitFilter(filter["tags"]),
+	}
+	for _, v := range splitFilter(filter["verdict"]) {
+		switch strings.ToLower(v) {
+		case "spam":
+			criteria.Spam = append(criteria.Spam, true)
+		case "ham":
+			criteria.Spam = append(criteria.Spam, false)
+		default:
+			return criteria, toolerr.Errorf(toolerr.ValidationFailed, "invalid filter verdict: expected spam or ham, got %q", v)
+		}
+	}
+	for _, v := range splitFilter(filter["complaint"]) {
+		complaint, err := strconv.ParseBool(v)
+		if err != nil {
+			return criteria, toolerr.Errorf(toolerr.ValidationFailed, "invalid filter complaint: expected true or false, got %q", v)
+		}
+		criteria.Complaint = append(criteria.Complaint, complaint)
+	}
+	for _, v := range splitFilter(filter["legal_hold"]) {
+		hold, err := strconv.ParseBool(v)
+		if err != nil {
+			return criteria, toolerr.Errorf(toolerr.ValidationFailed, "invalid filter legal_hold: expected true or false, got %q", v)
+		}
+		criteria.LegalHold = append(criteria.LegalHold, hold)
+	}
+
+	var err error
+	if criteria.From, err = filterTime(filter, "scanned_at_from"); err != nil {
+		return criteria, err
+	}
+	if criteria.To, err = filterTime(filter, "scanned_at_to"); err != nil {
+		return criteria, err
+	}
+	return criteria, nil
+}
+
+// splitFilter splits a comma-separated list filter value.
+func splitFilter(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// filterTime parses an RFC 3339 range filter, returning the zero time when
+// it is not set.
+func filterTime(filter map[string]string, name string) (time.Time, error) {
+	value, ok := filter[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}, toolerr.Errorf(toolerr.ValidationFailed, "invalid filter %s: expected an RFC 3339 timestamp", name)
+	}
+	return t, nil
+}
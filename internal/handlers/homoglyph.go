@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/homoglyph"
+)
+
+type DetectHomoglyphsParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+// DetectHomoglyphs flags mixed-script and confusable text and domains in
+// the sender identity, subject and links of a message, and homographs of
+// the configured protected brands, with the skeleton each is mistaken for.
+func (h *Handler) DetectHomoglyphs(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DetectHomoglyphsParams]) (*mcp.CallToolResultFor[*homoglyph.Report], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	report := homoglyph.New(h.settings().Homoglyph).Analyze(email)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "detect_homoglyphs",
+		"size":      email.Size,
+		"findings":  len(report.Findings),
+		"high_risk": report.HighRisk,
+	}).Info("Homoglyph detection completed")
+
+	text := fmt.Sprintf("%d homoglyph findings (%d high severity), %d protected brands", len(report.Findings), report.HighRisk, report.Brands)
+	for _, f := range report.Findings {
+		text += fmt.Sprintf("\n- %s [%s] %s %q", f.Type, f.Severity, f.Location, f.Value)
+		if f.Skeleton != "" {
+			text += fmt.Sprintf(" reads as %q", f.Skeleton)
+		}
+		text += ": " + f.Detail
+	}
+
+	return &mcp.CallToolResultFor[*homoglyph.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/contentref"
+	"spamassassin-mcp/internal/mailsource"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Batch sizes of import_corpus.
+const (
+	defaultImportBatch = 100
+	maxImportBatch     = 1000
+)
+
+// importWorkers bounds the TELL requests of a batch in flight, as
+// regressionWorkers does for corpus scans.
+const importWorkers = 4
+
+// maxImportSkipped bounds the skipped messages import_corpus lists.
+const maxImportSkipped = 50
+
+type ImportCorpusParams struct {
+	Path      string `json:"path,omitempty" description:"Absolute path of an mbox file, a Maildir or a directory of message files, within one of bayes.import_dirs"`
+	Archive   string `json:"archive,omitempty" description:"Base64-encoded upload instead of path: an mbox, or a zip or tar (optionally gzip-compressed) archive of message and mbox files"`
+	Label     string `json:"label" description:"ham or spam: the class every message of the corpus is learned as"`
+	BatchSize int    `json:"batch_size,omitempty" description:"Messages learned between progress reports (default 100, maximum 1000)"`
+	DryRun    bool   `json:"dry_run,omitempty" description:"Read and validate the corpus and report how many messages would be learned, without training Bayes"`
+	User      string `json:"user,omitempty" description:"spamd user whose Bayes database is trained; must be listed in spamassassin.allowed_users"`
+}
+
+// ImportSkipped is a message of the corpus that was not learned, named by
+// its path in the corpus, with #n for the nth message of an mbox.
+type ImportSkipped struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ImportCorpusResult summarizes an import. Of the Messages found, Duplicates
+// repeat an earlier message of the corpus and Invalid are too large or
+// cannot be parsed; neither is sent to spamd. Of the rest, Learned were
+// learned and AlreadyLearned had been learned as the same class before. A
+// dry run only reports WouldLearn, the messages that would be sent.
+// Skipped lists the first invalid and failed messages.
+type ImportCorpusResult struct {
+	Source         string          `json:"source"`
+	Format         string          `json:"format"`
+	Label          string          `json:"label"`
+	DryRun         bool            `json:"dry_run"`
+	User           string          `json:"user,omitempty"`
+	Messages       int             `json:"messages"`
+	Duplicates     int             `json:"duplicates"`
+	Invalid        int             `json:"invalid"`
+	WouldLearn     int             `json:"would_learn"`
+	Learned        int             `json:"learned"`
+	AlreadyLearned int             `json:"already_learned"`
+	Failed         int             `json:"failed"`
+	Batches        int             `json:"batches"`
+	Skipped        []ImportSkipped `json:"skipped"`
+}
+
+func (r *ImportCorpusResult) skip(name, reason string) {
+	if len(r.Skipped) < maxImportSkipped {
+		r.Skipped = append(r.Skipped, ImportSkipped{Name: name, Reason: reason})
+	}
+}
+
+// ImportCorpus trains Bayes with a labeled corpus through spamd TELL, in
+// batches with progress reporting. The corpus is read from a directory
+// safelisted in bayes.import_dirs or uploaded as an archive; every message
+// is learned as the given label.
+func (h *Handler) ImportCorpus(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ImportCorpusParams]) (*mcp.CallToolResultFor[*ImportCorpusResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	settings := h.settings()
+	cfg := settings.Bayes
+	req := params.Arguments
+	if req.Label != spamassassin.ClassHam && req.Label != spamassassin.ClassSpam {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "label must be ham or spam, got %q", req.Label)
+	}
+	if (req.Path == "") == (req.Archive == "") {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "exactly one of path and archive is required")
+	}
+	batchSize := req.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultImportBatch
+	}
+	if batchSize < 0 || batchSize > maxImportBatch {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "batch_size must be between 1 and %d", maxImportBatch)
+	}
+	p, err := h.userProfile("", req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := mailsource.Limits{MaxMessages: cfg.ImportMaxMessages, MaxSize: cfg.ImportMaxSize}
+	var messages []mailsource.Message
+	result := &ImportCorpusResult{Label: req.Label, DryRun: req.DryRun, User: req.User, Skipped: make([]ImportSkipped, 0)}
+	if req.Path != "" {
+		path, err := importPath(cfg.ImportDirs, req.Path)
+		if err != nil {
+			return nil, err
+		}
+		result.Source = path
+		messages, result.Format, err = mailsource.ReadPath(path, limits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read corpus: %w", err)
+		}
+	} else {
+		if int64(len(req.Archive)) > int64(base64.StdEncoding.EncodedLen(int(cfg.ImportMaxSize))) {
+			return nil, toolerr.Errorf(toolerr.SizeExceeded, "archive exceeds size limit of %d bytes", cfg.ImportMaxSize)
+		}
+		data, err := base64.StdEncoding.DecodeString(req.Archive)
+		if err != nil {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "archive is not valid base64: %w", err)
+		}
+		result.Source = "archive"
+		messages, result.Format, err = mailsource.ReadArchive(data, limits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+	}
+	result.Messages = len(messages)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "import_corpus",
+		"source":    result.Source,
+		"format":    result.Format,
+		"messages":  result.Messages,
+		"label":     req.Label,
+		"dry_run":   req.DryRun,
+	}).Info("Processing corpus import")
+
+	// Validate everything first, so a dry run reports exactly what a real
+	// import would send.
+	seen := make(map[string]bool, len(messages))
+	learnable := make([]mailsource.Message, 0, len(messages))
+	for _, m := range messages {
+		email, err := h.validateEmailContent(m.Content)
+		if err != nil {
+			result.Invalid++
+			result.skip(m.Name, err.Error())
+			continue
+		}
+		if seen[email.SHA256] {
+			result.Duplicates++
+			continue
+		}
+		seen[email.SHA256] = true
+		m.Content = email.Raw
+		learnable = append(learnable, m)
+	}
+	result.WouldLearn = len(learnable)
+
+	if !req.DryRun {
+		if err := h.learnCorpus(ctx, ss, params, learnable, batchSize, req.Label, p.spamdUser, result); err != nil {
+			return nil, err
+		}
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"messages":        result.Messages,
+		"would_learn":     result.WouldLearn,
+		"learned":         result.Learned,
+		"already_learned": result.AlreadyLearned,
+		"failed":          result.Failed,
+	}).Info("Corpus import completed")
+
+	var text string
+	if req.DryRun {
+		text = fmt.Sprintf("Dry run: %d of %d messages in %s would be learned as %s (%d duplicates, %d invalid)",
+			result.WouldLearn, result.Messages, result.Source, req.Label, result.Duplicates, result.Invalid)
+	} else {
+		text = fmt.Sprintf("Learned %d of %d messages in %s as %s in %d batches: %d already learned, %d duplicates, %d invalid, %d failed",
+			result.Learned, result.Messages, result.Source, req.Label, result.Batches, result.AlreadyLearned, result.Duplicates, result.Invalid, result.Failed)
+	}
+	return &mcp.CallToolResultFor[*ImportCorpusResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// learnCorpus sends messages to spamd in batches, reporting progress and
+// checking for cancellation after each. It fails when spamd does not
+// support TELL, since no message could be learned.
+func (h *Handler) learnCorpus(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ImportCorpusParams], messages []mailsource.Message, batchSize int, label, user string, result *ImportCorpusResult) error {
+	progress := newProgressReporter(ss, params, len(messages))
+	var mu sync.Mutex
+	for start := 0; start < len(messages); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("corpus import cancelled after %d of %d messages were learned: %w", result.Learned, len(messages), err)
+		}
+		batch := messages[start:min(start+batchSize, len(messages))]
+
+		var unsupported bool
+		work := make(chan mailsource.Message)
+		var wg sync.WaitGroup
+		for range min(importWorkers, len(batch)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for m := range work {
+					learned, err := h.saClient.Learn(m.Content, label, user)
+					mu.Lock()
+					switch {
+					case errors.Is(err, spamassassin.ErrTellUnsupported):
+						unsupported = true
+					case err != nil:
+						result.Failed++
+						result.skip(m.Name, fmt.Sprintf("learning failed: %v", err))
+					case learned:
+						result.Learned++
+					default:
+						result.AlreadyLearned++
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, m := range batch {
+			work <- m
+		}
+		close(work)
+		wg.Wait()
+		if unsupported {
+			return spamassassin.ErrTellUnsupported
+		}
+
+		result.Batches++
+		done := start + len(batch)
+		progress.Report(ctx, done, fmt.Sprintf("Learned batch %d: %d of %d messages", result.Batches, done, len(messages)))
+	}
+	return nil
+}
+
+// importPath resolves path, which must be absolute, and checks that it is
+// one of dirs or within one of them.
+func importPath(dirs []string, path string) (string, error) {
+	return contentref.ResolvePath(dirs, "bayes.import_dirs", path)
+}
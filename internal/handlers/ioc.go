@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/ioc"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type ExtractIOCsParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+	Format  string `json:"format,omitempty" description:"Output format: json (default) or stix for a STIX 2.1 bundle"`
+}
+
+type ExtractIOCsResult struct {
+	IOCs   *ioc.Set    `json:"iocs"`
+	Bundle *ioc.Bundle `json:"bundle,omitempty"`
+}
+
+// ExtractIOCs collects the IP addresses, domains, URLs, sender addresses and
+// attachment hashes of a message, optionally as a STIX 2.1 bundle. No
+// network queries are made.
+func (h *Handler) ExtractIOCs(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ExtractIOCsParams]) (*mcp.CallToolResultFor[*ExtractIOCsResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	format := params.Arguments.Format
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "stix" {
+		return nil, toolerr.Errorf(toolerr.UnsupportedFormat, "format must be one of json, stix")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "extract_iocs",
+		"size":      email.Size,
+		"format":    format,
+	}).Info("Processing IOC extraction")
+
+	result := &ExtractIOCsResult{IOCs: ioc.Extract(email)}
+	set := result.IOCs
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"indicators": set.Count(),
+	}).Info("IOC extraction completed")
+
+	text := fmt.Sprintf("%d indicator(s): %d IP(s), %d domain(s), %d URL(s), %d email address(es), %d file(s)",
+		set.Count(), len(set.IPs), len(set.Domains), len(set.URLs), len(set.EmailAddresses), len(set.Files))
+
+	if format == "stix" {
+		subject := "message " + email.MessageID
+		if email.MessageID == "" {
+			subject = "submitted message"
+		}
+		result.Bundle = set.Bundle(subject, time.Now())
+		data, err := json.MarshalIndent(result.Bundle, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode STIX bundle: %w", err)
+		}
+		text = string(data)
+	}
+
+	return &mcp.CallToolResultFor[*ExtractIOCsResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+// observeIndicators feeds the indicators of a spam verdict to the TAXII
+// publisher, if one is configured.
+func (h *Handler) observeIndicators(email *model.ParsedEmail, result *ScanEmailResult) {
+	if h.feed == nil || !result.IsSpam {
+		return
+	}
+	h.feed.Observe(email.SHA256, result.Score, result.Threshold, ioc.Extract(email), result.Timestamp)
+}
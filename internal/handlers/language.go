@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"slices"
+	"strings"
+
+	"spamassassin-mcp/internal/model"
+)
+
+// declaredLanguages returns the primary language subtags of the message's
+// Content-Language headers, e.g. "de" for "de-AT", in the order given.
+func declaredLanguages(email *model.ParsedEmail) []string {
+	languages := make([]string, 0)
+	for _, value := range email.HeaderValues("Content-Language") {
+		for _, tag := range strings.Split(value, ",") {
+			primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+			if primary != "" && !slices.Contains(languages, primary) {
+				languages = append(languages, primary)
+			}
+		}
+	}
+	return languages
+}
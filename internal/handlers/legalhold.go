@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// maxLegalHoldReason bounds the reason recorded in the audit log.
+const maxLegalHoldReason = 500
+
+type SetLegalHoldParams struct {
+	Hash         string `json:"hash,omitempty" description:"SHA-256 hash of the raw message; its scan history entries and quarantined copies are selected"`
+	Sender       string `json:"sender,omitempty" description:"Sender address; its scan history entries and quarantined messages are selected"`
+	QuarantineID string `json:"quarantine_id,omitempty" description:"ID of one quarantined message, as reported by list_quarantine; only that message is selected"`
+	Hold         *bool  `json:"hold" description:"true to place the selected items under legal hold, false to lift it"`
+	Reason       string `json:"reason" description:"Why the hold is placed or lifted, e.g. a case reference; recorded in the audit log"`
+}
+
+// LegalHoldResult reports the items whose legal hold changed.
+type LegalHoldResult struct {
+	Hold bool `json:"hold"`
+
+	// HistoryEntries is the number of scan history entries that changed;
+	// entries already in the requested state are not counted.
+	HistoryEntries int64 `json:"history_entries"`
+
+	// Quarantined lists the IDs of the selected quarantined messages.
+	Quarantined []string `json:"quarantined"`
+}
+
+// SetLegalHold places scan history entries and quarantined messages under
+// legal hold, exempting them from retention and scheduled pruning, or lifts
+// the hold so they expire normally again. Items are selected by message
+// hash, sender or quarantine ID, and every change is recorded in the audit
+// log with its reason.
+func (h *Handler) SetLegalHold(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[SetLegalHoldParams]) (*mcp.CallToolResultFor[*LegalHoldResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	hash := strings.ToLower(strings.TrimSpace(req.Hash))
+	sender := strings.ToLower(strings.TrimSpace(req.Sender))
+	id := strings.TrimSpace(req.QuarantineID)
+	reason := strings.TrimSpace(req.Reason)
+	switch {
+	case req.Hold == nil:
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "hold is required")
+	case hash == "" && sender == "" && id == "":
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "one of hash, sender or quarantine_id is required")
+	case id != "" && (hash != "" || sender != ""):
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "quarantine_id cannot be combined with hash or sender")
+	case hash != "" && !sha256Regex.MatchString(hash):
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "hash must be a hex-encoded SHA-256 digest")
+	case sender != "" && !emailRegex.MatchString(sender):
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid sender address %q", req.Sender)
+	case reason == "":
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "reason is required")
+	case len(reason) > maxLegalHoldReason:
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "reason is longer than %d bytes", maxLegalHoldReason)
+	}
+	if h.history == nil && h.quarantine == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "neither scan history nor quarantine is enabled (set history.dsn or quarantine.dir)")
+	}
+	hold := *req.Hold
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "set_legal_hold",
+		"hold":      hold,
+	}).Info("Processing legal hold change")
+
+	result := &LegalHoldResult{Hold: hold, Quarantined: []string{}}
+	if id != "" {
+		if h.quarantine == nil {
+			return nil, toolerr.Errorf(toolerr.NotConfigured, "quarantine is not enabled (set quarantine.dir)")
+		}
+		item, err := h.quarantine.SetLegalHold(id, hold)
+		if err != nil {
+			return nil, quarantineError(err, id)
+		}
+		result.Quarantined = append(result.Quarantined, item.ID)
+	} else {
+		if h.history != nil {
+			criteria := history.Criteria{}
+			if hash != "" {
+				criteria.Hashes = []string{hash}
+			}
+			if sender != "" {
+				criteria.Senders = []string{sender}
+			}
+			n, err := h.history.SetLegalHold(ctx, criteria, hold)
+			if err != nil {
+				logrus.WithContext(ctx).WithError(err).Error("Failed to set legal hold on scan history")
+				return nil, fmt.Errorf("failed to set legal hold on scan history")
+			}
+			result.HistoryEntries = n
+		}
+		if h.quarantine != nil {
+			for _, item := range h.quarantine.Items() {
+				if (hash != "" && item.Hash != hash) || (sender != "" && !strings.EqualFold(item.Sender, sender)) {
+					continue
+				}
+				if _, err := h.quarantine.SetLegalHold(item.ID, hold); err != nil {
+					return nil, quarantineError(err, item.ID)
+				}
+				result.Quarantined = append(result.Quarantined, item.ID)
+			}
+		}
+	}
+
+	action := "placed"
+	if !hold {
+		action = "lifted"
+	}
+	recordChange(ctx, "legal hold: %s on %s (%d history entries, %d quarantined messages): %s",
+		action, legalHoldTarget(hash, sender, id), result.HistoryEntries, len(result.Quarantined), reason)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"history_entries": result.HistoryEntries,
+		"quarantined":     len(result.Quarantined),
+	}).Info("Legal hold change completed")
+
+	return &mcp.CallToolResultFor[*LegalHoldResult]{
+		Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Legal hold %s on %d scan history entries and %d quarantined messages",
+			action, result.HistoryEntries, len(result.Quarantined))}},
+		StructuredContent: result,
+	}, nil
+}
+
+// legalHoldTarget describes the items selected for a legal hold change.
+func legalHoldTarget(hash, sender, id string) string {
+	var target []string
+	if id != "" {
+		target = append(target, "quarantined message "+id)
+	}
+	if hash != "" {
+		target = append(target, "hash "+hash)
+	}
+	if sender != "" {
+		target = append(target, "sender "+sender)
+	}
+	return strings.Join(target, " and ")
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/sandbox"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type LintRulesParams struct {
+	Rules string `json:"rules" description:"Custom rule definitions in SpamAssassin format"`
+}
+
+// LintRules checks submitted rules with spamassassin --lint in an isolated
+// configuration, so broken rules are caught before they are deployed.
+func (h *Handler) LintRules(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[LintRulesParams]) (*mcp.CallToolResultFor[*sandbox.LintResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	ruleText := params.Arguments.Rules
+	if err := sandbox.Validate(ruleText); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "lint_rules",
+		"size":      len(ruleText),
+	}).Info("Processing rule lint request")
+
+	result, err := h.sandbox.Lint(ctx, ruleText)
+	if errors.Is(err, sandbox.ErrUnavailable) {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to run spamassassin")
+		return nil, fmt.Errorf("rule linting is unavailable: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lint failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"valid":  result.Valid,
+		"issues": len(result.Issues),
+	}).Info("Rule lint completed")
+
+	text := fmt.Sprintf("%d rule(s) linted: no issues", len(result.Rules))
+	if !result.Valid {
+		text = fmt.Sprintf("%d rule(s) linted: %d issue(s)", len(result.Rules), len(result.Issues))
+		for _, issue := range result.Issues {
+			if issue.Line > 0 {
+				text += fmt.Sprintf("\n- line %d: %s", issue.Line, issue.Message)
+			} else {
+				text += fmt.Sprintf("\n- %s", issue.Message)
+			}
+		}
+	}
+
+	return &mcp.CallToolResultFor[*sandbox.LintResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
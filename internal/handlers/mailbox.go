@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/imap"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/pop3"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// defaultMailboxLimit is the number of messages scan_mailbox scans when the
+// request does not set a limit.
+const defaultMailboxLimit = 10
+
+type ScanMailboxParams struct {
+	Source  string `json:"source,omitempty" description:"Mailbox to read: imap or pop3 (default imap when configured, otherwise pop3)"`
+	Limit   int    `json:"limit,omitempty" description:"Scan the latest N messages (default 10, at most the source's max_messages)"`
+	Since   string `json:"since,omitempty" description:"Only scan messages received on or after this date (YYYY-MM-DD)"`
+	Profile string `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
+}
+
+// MailboxMessage is the verdict for one message of the mailbox. IMAP
+// messages are identified by UID, POP3 messages by Number and, when the
+// server supports it, UIDL. scan_object numbers the messages of an object
+// the same way. Error is set, and the verdict left empty, when
+// the message could not be fetched, parsed or scanned.
+type MailboxMessage struct {
+	UID       uint32     `json:"uid,omitempty"`
+	Number    int        `json:"number,omitempty"`
+	UIDL      string     `json:"uidl,omitempty"`
+	Size      int64      `json:"size"`
+	MessageID string     `json:"message_id,omitempty"`
+	From      string     `json:"from,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	Date      *time.Time `json:"date,omitempty"`
+	Score     float64    `json:"score"`
+	IsSpam    bool       `json:"is_spam"`
+	Rules     []string   `json:"rules"`
+	Tags      []string   `json:"tags,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ScanMailboxResult lists the scanned messages newest first. Matched is
+// the number of messages in the mailbox matching the request, of which the
+// latest Limit were scanned.
+type ScanMailboxResult struct {
+	Source    string           `json:"source"`
+	Folder    string           `json:"folder,omitempty"`
+	Matched   int              `json:"matched"`
+	Scanned   int              `json:"scanned"`
+	Spam      int              `json:"spam"`
+	Errors    int              `json:"errors"`
+	Threshold float64          `json:"threshold"`
+	Profile   string           `json:"profile,omitempty"`
+	Messages  []MailboxMessage `json:"messages"`
+}
+
+// mailboxScan holds the settings shared by the IMAP and POP3 scans of one
+// request.
+type mailboxScan struct {
+	limit    int
+	since    time.Time
+	maxSize  int64
+	options  spamassassin.ScanOptions
+	progress *progressReporter
+}
+
+// ScanMailbox fetches the latest messages of the configured IMAP folder or
+// POP3 maildrop and scans each. The mailbox is left as it was: the IMAP
+// folder is opened read-only and messages are fetched without marking them
+// seen, and POP3 messages are never deleted. Mailbox scans are not recorded
+// in statistics or scan history.
+func (h *Handler) ScanMailbox(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ScanMailboxParams]) (*mcp.CallToolResultFor[*ScanMailboxResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	cfg := h.settings()
+	req := params.Arguments
+	source := req.Source
+	if source == "" {
+		source = "imap"
+		if cfg.IMAP.Addr == "" && cfg.POP3.Addr != "" {
+			source = "pop3"
+		}
+	}
+	var maxMessages int
+	switch source {
+	case "imap":
+		if cfg.IMAP.Addr == "" {
+			if cfg.POP3.Addr == "" {
+				return nil, toolerr.Errorf(toolerr.NotConfigured, "no mailbox is configured (set imap.addr or pop3.addr)")
+			}
+			return nil, toolerr.Errorf(toolerr.NotConfigured, "IMAP mailbox is not configured (set imap.addr)")
+		}
+		maxMessages = cfg.IMAP.MaxMessages
+	case "pop3":
+		if cfg.POP3.Addr == "" {
+			return nil, toolerr.Errorf(toolerr.NotConfigured, "POP3 mailbox is not configured (set pop3.addr)")
+		}
+		maxMessages = cfg.POP3.MaxMessages
+	default:
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "source must be imap or pop3, got %q", source)
+	}
+
+	scan := mailboxScan{limit: req.Limit, maxSize: cfg.Security.MaxEmailSize}
+	if scan.limit == 0 {
+		scan.limit = min(defaultMailboxLimit, maxMessages)
+	}
+	if scan.limit < 0 || scan.limit > maxMessages {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "limit must be between 1 and %d", maxMessages)
+	}
+	if req.Since != "" {
+		t, err := time.Parse("2006-01-02", req.Since)
+		if err != nil {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid since date %q: use YYYY-MM-DD", req.Since)
+		}
+		scan.since = t
+	}
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	// Verbose, so the rules hit are listed
+	scan.options = p.scanOptions(spamassassin.ScanOptions{Verbose: true})
+	scan.progress = newProgressReporter(ss, params, scan.limit)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "scan_mailbox",
+		"source":    source,
+		"limit":     scan.limit,
+		"since":     req.Since,
+		"profile":   p.name,
+	}).Info("Processing mailbox scan")
+
+	var response *ScanMailboxResult
+	if source == "imap" {
+		response, err = h.scanIMAP(ctx, cfg.IMAP, scan)
+	} else {
+		response, err = h.scanPOP3(ctx, cfg.POP3, scan)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Mailbox scan failed")
+		return nil, err
+	}
+	response.Source = source
+	response.Profile = p.name
+	response.Threshold = h.saClient.Threshold()
+	if p.threshold != nil {
+		response.Threshold = *p.threshold
+	}
+	for _, message := range response.Messages {
+		if message.Error != "" {
+			response.Errors++
+		} else if message.IsSpam {
+			response.Spam++
+		}
+	}
+	response.Scanned = len(response.Messages)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"matched": response.Matched,
+		"scanned": response.Scanned,
+		"spam":    response.Spam,
+		"errors":  response.Errors,
+	}).Info("Mailbox scan completed")
+
+	name := response.Folder
+	if name == "" {
+		name = "the POP3 maildrop"
+	}
+	return &mcp.CallToolResultFor[*ScanMailboxResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Scanned %d of %d messages in %s: %d spam, %d errors",
+				response.Scanned, response.Matched, name, response.Spam, response.Errors)},
+		},
+		StructuredContent: response,
+	}, nil
+}
+
+func (h *Handler) scanIMAP(ctx context.Context, cfg config.IMAPConfig, scan mailboxScan) (*ScanMailboxResult, error) {
+	client, err := imap.Dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if _, err := client.Examine(cfg.Folder); err != nil {
+		return nil, err
+	}
+	uids, err := client.Search(scan.since)
+	if err != nil {
+		return nil, err
+	}
+	response := &ScanMailboxResult{Folder: cfg.Folder, Matched: len(uids), Messages: make([]MailboxMessage, 0)}
+
+	// Newest first; UIDs grow as messages arrive
+	latest := slices.Clone(uids[max(len(uids)-scan.limit, 0):])
+	slices.Reverse(latest)
+	sizes, err := client.Sizes(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, uid := range latest {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("mailbox scan cancelled: %w", err)
+		}
+		message := MailboxMessage{UID: uid, Rules: make([]string, 0)}
+		size, ok := sizes[uid]
+		if !ok {
+			message.Error = "message no longer exists"
+		} else if message.Size = size; h.checkMailboxSize(&message, scan.maxSize) {
+			content, err := client.Fetch(uid, scan.maxSize)
+			if err != nil {
+				message.Error = err.Error()
+			} else {
+				h.scanMailboxContent(&message, content, scan.options)
+			}
+		}
+		response.Messages = append(response.Messages, message)
+		scan.progress.Report(ctx, i+1, fmt.Sprintf("Scanned %d of %d mailbox messages", i+1, len(latest)))
+	}
+	return response, nil
+}
+
+// scanPOP3 scans the latest messages of a POP3 maildrop. POP3 has no
+// search, so since is applied to the Date header, read newest first with
+// TOP until limit messages match; Matched then counts only those.
+func (h *Handler) scanPOP3(ctx context.Context, cfg config.POP3Config, scan mailboxScan) (*ScanMailboxResult, error) {
+	client, err := pop3.Dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	sizes, err := client.List()
+	if err != nil {
+		return nil, err
+	}
+	uidls := client.UIDL()
+	numbers := slices.Sorted(maps.Keys(sizes))
+	slices.Reverse(numbers)
+
+	response := &ScanMailboxResult{Matched: len(numbers), Messages: make([]MailboxMessage, 0)}
+	latest := numbers[:min(scan.limit, len(numbers))]
+	if !scan.since.IsZero() {
+		latest = make([]int, 0, scan.limit)
+		for _, n := range numbers {
+			if len(latest) == scan.limit {
+				break
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("mailbox scan cancelled: %w", err)
+			}
+			headers, err := client.Headers(n, scan.maxSize)
+			if err != nil {
+				return nil, err
+			}
+			// Messages without a readable Date are kept
+			if email, err := model.Parse(headers); err != nil || email.Date == nil || !email.Date.Before(scan.since) {
+				latest = append(latest, n)
+			}
+		}
+		response.Matched = len(latest)
+	}
+
+	for i, n := range latest {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("mailbox scan cancelled: %w", err)
+		}
+		message := MailboxMessage{Number: n, UIDL: uidls[n], Size: sizes[n], Rules: make([]string, 0)}
+		if h.checkMailboxSize(&message, scan.maxSize) {
+			content, err := client.Retrieve(n, scan.maxSize)
+			if err != nil {
+				message.Error = err.Error()
+			} else {
+				h.scanMailboxContent(&message, content, scan.options)
+			}
+		}
+		response.Messages = append(response.Messages, message)
+		scan.progress.Report(ctx, i+1, fmt.Sprintf("Scanned %d of %d mailbox messages", i+1, len(latest)))
+	}
+	return response, nil
+}
+
+// checkMailboxSize reports whether message is small enough to fetch,
+// setting its error when it is not. It is checked before fetching, so an
+// oversized message is never read.
+func (h *Handler) checkMailboxSize(message *MailboxMessage, maxSize int64) bool {
+	if message.Size > maxSize {
+		message.Error = fmt.Sprintf("email size exceeds limit of %d bytes", maxSize)
+		return false
+	}
+	return true
+}
+
+// scanMailboxContent parses and scans a fetched message, filling in its
+// headers and verdict.
+func (h *Handler) scanMailboxContent(message *MailboxMessage, content string, options spamassassin.ScanOptions) {
+	if h.tagger.MatchesRules() {
+		options.Rules = max(options.Rules, spamassassin.RuleNames)
+	}
+	email, err := h.validateEmailContent(content)
+	if err != nil {
+		message.Error = err.Error()
+		return
+	}
+	message.MessageID = email.MessageID
+	message.Subject = email.Subject
+	message.Date = email.Date
+	if len(email.From) > 0 {
+		message.From = email.From[0].Address
+	}
+
+	result, err := h.saClient.ScanEmail(email.Raw, options)
+	if err != nil {
+		message.Error = fmt.Sprintf("scan failed: %v", err)
+		return
+	}
+	message.Score = result.Score
+	message.IsSpam = result.IsSpam
+	for _, rule := range result.RulesHit {
+		message.Rules = append(message.Rules, rule.Name)
+	}
+	message.Tags = h.tagger.Tags(result.Score, message.Rules)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/mimetree"
+)
+
+type AnalyzeMIMEParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+// AnalyzeMIME returns the MIME tree of a message with the content type,
+// charset, transfer encoding and sizes of every part, and flags boundary and
+// nesting anomalies used to hide content from filters. No SpamAssassin scan
+// is performed.
+func (h *Handler) AnalyzeMIME(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[AnalyzeMIMEParams]) (*mcp.CallToolResultFor[*mimetree.Report], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	email, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	report := mimetree.Analyze(email)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "analyze_mime",
+		"size":      email.Size,
+		"parts":     len(report.Parts),
+		"max_depth": report.MaxDepth,
+		"anomalies": len(report.Anomalies),
+	}).Info("MIME analysis completed")
+
+	text := fmt.Sprintf("%d MIME parts (%d leaves), nested %d levels deep, %d anomalies (%d high severity)",
+		len(report.Parts), report.Leaves, report.MaxDepth, len(report.Anomalies), report.HighRisk)
+	for _, p := range report.Parts {
+		text += fmt.Sprintf("\n%s%s %s", strings.Repeat("  ", p.Depth), p.Path, p.ContentType)
+		if p.Filename != "" {
+			text += fmt.Sprintf(" %q", p.Filename)
+		}
+		text += fmt.Sprintf(" (%d bytes)", p.Size)
+	}
+	for _, a := range report.Anomalies {
+		path := a.Path
+		if path == "" {
+			path = "message"
+		}
+		text += fmt.Sprintf("\n- %s [%s] %s: %s", a.Type, a.Severity, path, a.Detail)
+	}
+
+	return &mcp.CallToolResultFor[*mimetree.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
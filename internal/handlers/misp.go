@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ioc"
+	"spamassassin-mcp/internal/misp"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// maxEventTags bounds the tags a caller may add to an event.
+const maxEventTags = 20
+
+type PublishIOCsParams struct {
+	Content     string   `json:"content" description:"Raw email content including headers"`
+	Info        string   `json:"info,omitempty" description:"Event title (default: the subject and Message-ID of the message)"`
+	TLP         string   `json:"tlp,omitempty" description:"TLP level of the event: clear, green, amber, amber+strict or red; may be stricter than misp.tlp but not less strict (default misp.tlp)"`
+	Tags        []string `json:"tags,omitempty" description:"Tags to add to the event, besides the TLP tag and misp.tags"`
+	RequireSpam bool     `json:"require_spam,omitempty" description:"Scan the message first and publish only if it is classified as spam"`
+	Profile     string   `json:"profile,omitempty" description:"Named policy profile the require_spam scan is evaluated under"`
+}
+
+// PublishIOCsResult describes the MISP event created. Published is false,
+// with Skipped giving the reason, when nothing was sent.
+type PublishIOCsResult struct {
+	EventID    string   `json:"event_id,omitempty"`
+	EventUUID  string   `json:"event_uuid,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	TLP        string   `json:"tlp"`
+	Tags       []string `json:"tags"`
+	Attributes int      `json:"attributes"`
+	Published  bool     `json:"published"`
+	Skipped    string   `json:"skipped,omitempty"`
+	Score      *float64 `json:"score,omitempty"`
+	IsSpam     *bool    `json:"is_spam,omitempty"`
+}
+
+// PublishIOCs extracts the indicators of a message, as extract_iocs does,
+// and creates a MISP event holding them as attributes.
+func (h *Handler) PublishIOCs(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[PublishIOCsParams]) (*mcp.CallToolResultFor[*PublishIOCsResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	cfg := h.settings().MISP
+	req := params.Arguments
+	if cfg.URL == "" {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "MISP is not configured (set misp.url)")
+	}
+	tlp, err := eventTLP(cfg, req.TLP)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Info) > 1024 {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "info must be at most 1024 bytes")
+	}
+	if len(req.Tags) > maxEventTags {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "at most %d tags can be added", maxEventTags)
+	}
+	tags := []string{"tlp:" + tlp}
+	for _, tag := range append(slices.Clone(cfg.Tags), req.Tags...) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || len(tag) > 255 || strings.ContainsFunc(tag, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid tag %q", tag)
+		}
+		if strings.HasPrefix(strings.ToLower(tag), "tlp:") {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "set the TLP level with tlp, not as tag %q", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":    "publish_iocs",
+		"size":         email.Size,
+		"tlp":          tlp,
+		"require_spam": req.RequireSpam,
+	}).Info("Processing IOC publishing")
+
+	response := &PublishIOCsResult{TLP: tlp, Tags: tags}
+	if req.RequireSpam {
+		result, err := h.saClient.ScanEmail(email.Raw, p.scanOptions(spamassassin.ScanOptions{}))
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Error("SpamAssassin scan failed")
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		response.Score, response.IsSpam = &result.Score, &result.IsSpam
+		if !result.IsSpam {
+			response.Skipped = fmt.Sprintf("not spam (score %.1f, threshold %.1f)", result.Score, result.Threshold)
+		}
+	}
+
+	attrs := misp.Attributes(ioc.Extract(email), cfg.ToIDS)
+	response.Attributes = len(attrs)
+	if response.Skipped == "" && len(attrs) == 0 {
+		response.Skipped = "no indicators found"
+	}
+	if response.Skipped != "" {
+		logrus.WithContext(ctx).WithField("reason", response.Skipped).Info("IOC publishing skipped")
+		return &mcp.CallToolResultFor[*PublishIOCsResult]{
+			Content:           []mcp.Content{&mcp.TextContent{Text: "Nothing published: " + response.Skipped}},
+			StructuredContent: response,
+		}, nil
+	}
+
+	response.Info = req.Info
+	if response.Info == "" {
+		response.Info = eventInfo(email.Subject, email.MessageID)
+	}
+	event := &misp.Event{
+		Info:          response.Info,
+		Date:          time.Now().UTC().Format("2006-01-02"),
+		Distribution:  fmt.Sprint(cfg.Distribution),
+		ThreatLevelID: fmt.Sprint(cfg.ThreatLevel),
+		Analysis:      "0", // initial
+		Attributes:    attrs,
+	}
+	for _, tag := range tags {
+		event.Tags = append(event.Tags, misp.Tag{Name: tag})
+	}
+
+	client, err := misp.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	created, err := client.AddEvent(ctx, event)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("MISP event creation failed")
+		return nil, err
+	}
+	response.EventID, response.EventUUID = created.ID, created.UUID
+	if cfg.Publish {
+		if err := client.PublishEvent(ctx, created.ID); err != nil {
+			recordChange(ctx, "misp: created event %s with %d attributes, publishing failed", created.ID, len(attrs))
+			logrus.WithContext(ctx).WithError(err).Error("MISP event publishing failed")
+			return nil, fmt.Errorf("event %s was created but not published: %w", created.ID, err)
+		}
+		response.Published = true
+	}
+	recordChange(ctx, "misp: created event %s with %d attributes (tlp:%s)", created.ID, len(attrs), tlp)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"event_id":   response.EventID,
+		"attributes": response.Attributes,
+		"published":  response.Published,
+	}).Info("IOC publishing completed")
+
+	text := fmt.Sprintf("Created MISP event %s with %d attribute(s), tlp:%s", response.EventID, response.Attributes, tlp)
+	if response.Published {
+		text += ", published"
+	}
+	return &mcp.CallToolResultFor[*PublishIOCsResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: response,
+	}, nil
+}
+
+// eventTLP returns the TLP level of an event: requested, which may not be
+// less restrictive than the configured level, or the configured level.
+func eventTLP(cfg config.MISPConfig, requested string) (string, error) {
+	if requested == "" {
+		return cfg.TLP, nil
+	}
+	requested = strings.TrimPrefix(strings.ToLower(requested), "tlp:")
+	level := slices.Index(config.TLPLevels, requested)
+	if level < 0 {
+		return "", toolerr.Errorf(toolerr.ValidationFailed, "tlp must be one of %s, got %q", strings.Join(config.TLPLevels, ", "), requested)
+	}
+	if level < slices.Index(config.TLPLevels, cfg.TLP) {
+		return "", toolerr.Errorf(toolerr.Forbidden, "tlp %s is less restrictive than the configured tlp:%s", requested, cfg.TLP)
+	}
+	return requested, nil
+}
+
+// eventInfo names an event after the message.
+func eventInfo(subject, messageID string) string {
+	info := "Email indicators"
+	if subject != "" {
+		info += ": " + subject
+	}
+	if messageID != "" {
+		info += " " + messageID
+	}
+	return info
+}
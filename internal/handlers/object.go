@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/mbox"
+	"spamassassin-mcp/internal/objectstore"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type ScanObjectParams struct {
+	Bucket  string `json:"bucket" description:"Bucket to read; one of the buckets configured in object_store.buckets"`
+	Key     string `json:"key" description:"Key of the object; must start with one of the bucket's allowed prefixes"`
+	Format  string `json:"format,omitempty" description:"eml or mbox (default: mbox when the key ends in .mbox or .mbx or the object starts with a From line, otherwise eml)"`
+	Limit   int    `json:"limit,omitempty" description:"Scan at most the first N messages of an mbox (default and maximum object_store.max_messages)"`
+	Profile string `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
+}
+
+// ScanObjectResult lists the verdicts for the messages of an object, in the
+// order they appear in it. Total is the number of messages in the object, of
+// which the first Limit were scanned. Messages are numbered from 1.
+type ScanObjectResult struct {
+	Bucket       string           `json:"bucket"`
+	Key          string           `json:"key"`
+	Size         int64            `json:"size"`
+	ETag         string           `json:"etag,omitempty"`
+	LastModified *time.Time       `json:"last_modified,omitempty"`
+	Format       string           `json:"format"`
+	Total        int              `json:"total"`
+	Scanned      int              `json:"scanned"`
+	Spam         int              `json:"spam"`
+	Errors       int              `json:"errors"`
+	Threshold    float64          `json:"threshold"`
+	Profile      string           `json:"profile,omitempty"`
+	Messages     []MailboxMessage `json:"messages"`
+}
+
+// ScanObject fetches an .eml or mbox object from S3-compatible storage and
+// scans its messages. Only the configured buckets and prefixes can be read,
+// and nothing is written. Like mailbox scans, object scans are not recorded
+// in statistics or scan history.
+func (h *Handler) ScanObject(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ScanObjectParams]) (*mcp.CallToolResultFor[*ScanObjectResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	settings := h.settings()
+	cfg := settings.ObjectStore
+	req := params.Arguments
+	if cfg.Endpoint == "" {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "object storage is not configured (set object_store.endpoint)")
+	}
+	bucket, err := objectBucket(cfg, req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if req.Format != "" && req.Format != "eml" && req.Format != "mbox" {
+		return nil, toolerr.Errorf(toolerr.UnsupportedFormat, "format must be eml or mbox, got %q", req.Format)
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = cfg.MaxMessages
+	}
+	if limit < 0 || limit > cfg.MaxMessages {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "limit must be between 1 and %d", cfg.MaxMessages)
+	}
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "scan_object",
+		"bucket":    bucket.Name,
+		"key":       req.Key,
+		"profile":   p.name,
+	}).Info("Processing object scan")
+
+	client, err := objectstore.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	object, err := client.Get(ctx, bucket.Name, req.Key, cfg.MaxObjectSize)
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, toolerr.Errorf(toolerr.NotFound, "object %s/%s not found", bucket.Name, req.Key)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Object fetch failed")
+		return nil, err
+	}
+
+	response := &ScanObjectResult{
+		Bucket:       bucket.Name,
+		Key:          req.Key,
+		Size:         object.Size,
+		ETag:         object.ETag,
+		LastModified: object.LastModified,
+		Format:       req.Format,
+		Profile:      p.name,
+		Threshold:    h.saClient.Threshold(),
+		Messages:     make([]MailboxMessage, 0),
+	}
+	if p.threshold != nil {
+		response.Threshold = *p.threshold
+	}
+	if response.Format == "" {
+		response.Format = "eml"
+		key := strings.ToLower(req.Key)
+		if strings.HasSuffix(key, ".mbox") || strings.HasSuffix(key, ".mbx") || mbox.IsMbox(object.Content) {
+			response.Format = "mbox"
+		}
+	}
+	contents := []string{string(object.Content)}
+	if response.Format == "mbox" {
+		contents = mbox.Split(object.Content)
+	}
+	response.Total = len(contents)
+	contents = contents[:min(limit, len(contents))]
+
+	// Verbose, so the rules hit are listed
+	options := p.scanOptions(spamassassin.ScanOptions{Verbose: true})
+	progress := newProgressReporter(ss, params, len(contents))
+	for i, content := range contents {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("object scan cancelled: %w", err)
+		}
+		message := MailboxMessage{Number: i + 1, Size: int64(len(content)), Rules: make([]string, 0)}
+		if h.checkMailboxSize(&message, settings.Security.MaxEmailSize) {
+			h.scanMailboxContent(&message, content, options)
+		}
+		if message.Error != "" {
+			response.Errors++
+		} else if message.IsSpam {
+			response.Spam++
+		}
+		response.Messages = append(response.Messages, message)
+		progress.Report(ctx, i+1, fmt.Sprintf("Scanned %d of %d object messages", i+1, len(contents)))
+	}
+	response.Scanned = len(response.Messages)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"format":  response.Format,
+		"total":   response.Total,
+		"scanned": response.Scanned,
+		"spam":    response.Spam,
+		"errors":  response.Errors,
+	}).Info("Object scan completed")
+
+	return &mcp.CallToolResultFor[*ScanObjectResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Scanned %d of %d messages in %s/%s: %d spam, %d errors",
+				response.Scanned, response.Total, bucket.Name, req.Key, response.Spam, response.Errors)},
+		},
+		StructuredContent: response,
+	}, nil
+}
+
+// objectBucket returns the configured bucket named name if it allows key.
+func objectBucket(cfg config.ObjectStoreConfig, name, key string) (*config.ObjectBucket, error) {
+	for _, bucket := range cfg.Buckets {
+		if bucket.Name != name {
+			continue
+		}
+		if !objectstore.ValidKey(key) {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid object key %q", key)
+		}
+		if !bucket.Allows(key) {
+			return nil, toolerr.Errorf(toolerr.Forbidden, "key %q is outside the allowed prefixes of bucket %q", key, name)
+		}
+		return &bucket, nil
+	}
+	return nil, toolerr.Errorf(toolerr.Forbidden, "bucket %q is not configured for scan_object", name)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/ocr"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// checkOCR fails when the ocr option is requested without OCR enabled.
+func (h *Handler) checkOCR(requested bool) error {
+	if requested && !h.settings().OCR.Enabled {
+		return toolerr.Errorf(toolerr.NotConfigured, "OCR is disabled (set ocr.enabled)")
+	}
+	return nil
+}
+
+// readImages reads the text of the images of an image-only message, for
+// the ocr option of scan_email and detect_phishing. It returns the message
+// to analyze: email itself, or a copy with the text read added as a
+// text/plain part.
+func (h *Handler) readImages(ctx context.Context, email *model.ParsedEmail) (*ocr.Result, *model.ParsedEmail, error) {
+	if err := h.checkOCR(true); err != nil {
+		return nil, nil, err
+	}
+	result, err := ocr.New(h.settings().OCR).Extract(ctx, email)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to run tesseract")
+		return nil, nil, fmt.Errorf("OCR is unavailable: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"image_only":  result.ImageOnly,
+		"images":      len(result.Images),
+		"characters":  len(result.Text),
+		"duration_ms": result.DurationMS,
+	}).Info("OCR completed")
+
+	if result.Text == "" {
+		return result, email, nil
+	}
+	augmented, err := model.Parse(ocr.Augment(email, result.Text))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to add the OCR text to the message: %w", err)
+	}
+	augmented.Input = email.Input
+	return result, augmented, nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/model"
+)
+
+type ParseEmailParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+}
+
+// ParseEmail returns the canonical parsed representation of a message:
+// ordered headers, address fields, the flattened MIME tree, extracted URLs
+// and Authentication-Results. No SpamAssassin scan is performed.
+func (h *Handler) ParseEmail(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ParseEmailParams]) (*mcp.CallToolResultFor[*model.ParsedEmail], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	parsed, err := h.validateEmailContent(params.Arguments.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "parse_email",
+		"size":      parsed.Size,
+		"parts":     len(parsed.Parts),
+		"urls":      len(parsed.URLs),
+	}).Info("Parsed email")
+
+	return &mcp.CallToolResultFor[*model.ParsedEmail]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Parsed email: %d headers, %d MIME parts, %d URLs, %d defects",
+				len(parsed.Headers), len(parsed.Parts), len(parsed.URLs), len(parsed.Defects))},
+		},
+		StructuredContent: parsed,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type GetPeerStatusParams struct{}
+
+// PeerStatusResult reports whether this instance shares its reputation and
+// the synchronization state of each configured peer.
+type PeerStatusResult struct {
+	Serving      bool              `json:"serving"`
+	ShareSenders bool              `json:"share_senders"`
+	Window       string            `json:"window"`
+	Peers        []peersync.Status `json:"peers"`
+}
+
+// PeerSyncHandler returns the handler serving this instance's reputation to
+// its peers at peersync.Path, or nil when peer_sync.token or the scan
+// history is not configured. Only the HTTP transport mounts it, and
+// get_peer_status reports the instance as serving once it has.
+func (h *Handler) PeerSyncHandler() http.Handler {
+	cfg := h.settings().PeerSync
+	if cfg.Token == "" || h.history == nil {
+		return nil
+	}
+	h.peerServing.Store(true)
+	return peersync.NewServer(cfg, h.history)
+}
+
+// GetPeerStatus reports the reputation sharing with peer instances: whether
+// this instance serves its own and when each peer was last fetched.
+func (h *Handler) GetPeerStatus(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetPeerStatusParams]) (*mcp.CallToolResultFor[*PeerStatusResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "get_peer_status").Info("Processing peer status request")
+
+	cfg := h.settings().PeerSync
+	serving := h.peerServing.Load()
+	if cfg.Token == "" && h.peers == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "peer reputation sharing is not enabled (set peer_sync.token or peer_sync.peers)")
+	}
+
+	result := &PeerStatusResult{
+		Serving:      serving,
+		ShareSenders: serving && cfg.ShareSenders,
+		Window:       cfg.Window.String(),
+		Peers:        h.peers.Status(),
+	}
+	if result.Peers == nil {
+		result.Peers = []peersync.Status{}
+	}
+
+	failed := 0
+	for _, peer := range result.Peers {
+		if peer.LastError != "" {
+			failed++
+		}
+	}
+	text := fmt.Sprintf("%d peers, %d failing their last fetch", len(result.Peers), failed)
+	if serving {
+		text = "Sharing reputation with peers; " + text
+	}
+	for _, peer := range result.Peers {
+		text += fmt.Sprintf("\n- %s: %d domains, %d senders, %d fingerprints", peer.Name, peer.Domains, peer.Senders, peer.Fingerprints)
+		if peer.LastError != "" {
+			text += "; last fetch failed: " + peer.LastError
+		}
+	}
+
+	return &mcp.CallToolResultFor[*PeerStatusResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
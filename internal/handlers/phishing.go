@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/ocr"
+	"spamassassin-mcp/internal/phishing"
+)
+
+type DetectPhishingParams struct {
+	Content string `json:"content" description:"Raw email content including headers"`
+	OCR     bool   `json:"ocr,omitempty" description:"Read the text of the images of an image-only message with OCR and analyze it with the message (requires ocr.enabled)"`
+}
+
+// DetectPhishing rates a message for phishing from link, sender, form,
+// language and Reply-To heuristics, returning the evidence behind the
+// rating.
+func (h *Handler) DetectPhishing(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[DetectPhishingParams]) (*mcp.CallToolResultFor[*phishing.Report], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "detect_phishing",
+		"size":      email.Size,
+		"ocr":       req.OCR,
+	}).Info("Processing phishing detection")
+
+	var ocrResult *ocr.Result
+	if req.OCR {
+		if ocrResult, email, err = h.readImages(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+	report := phishing.Analyze(email)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"likelihood": report.Likelihood,
+		"evidence":   len(report.Evidence),
+	}).Info("Phishing detection completed")
+
+	text := fmt.Sprintf("Phishing likelihood %.2f (%s)", report.Likelihood, report.Level)
+	if ocrResult != nil && ocrResult.Text != "" {
+		text += fmt.Sprintf(", OCR read %d characters from %d image(s)", len(ocrResult.Text), len(ocrResult.Images))
+	}
+	for _, e := range report.Evidence {
+		text += fmt.Sprintf("\n- %s: %s", e.Indicator, e.Description)
+	}
+
+	return &mcp.CallToolResultFor[*phishing.Report]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: report,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"math"
+	"slices"
+	"strings"
+
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// profile is the policy a request runs under: the server-wide settings with
+// the overrides of the profile the caller selected, if any.
+type profile struct {
+	name           string
+	threshold      *float64
+	blockedDomains []string
+	allowedSenders []string
+	spamdUser      string
+	languages      spamassassin.LanguageOverrides
+	// collaborativeFilters is the collaborative_filters setting that
+	// selected spamdUser, if any
+	collaborativeFilters string
+	// requestedThreshold is the threshold a scan request asked for, when
+	// threshold holds it clamped to the configured bounds
+	requestedThreshold *float64
+}
+
+// profile resolves the profile named by a request, a configured profile or a
+// preset. An empty name selects the server-wide settings.
+func (h *Handler) profile(name string) (*profile, error) {
+	cfg := h.settings()
+	p := &profile{
+		blockedDomains: cfg.Security.BlockedDomains,
+		allowedSenders: cfg.Security.AllowedSenders,
+	}
+	if name == "" {
+		return p, nil
+	}
+
+	override, ok := cfg.Profile(name)
+	if !ok {
+		return nil, toolerr.Errorf(toolerr.NotFound, "unknown profile %q", name)
+	}
+	p.name = strings.ToLower(name)
+	p.threshold = override.Threshold
+	p.spamdUser = override.SpamdUser
+	if user := cfg.SpamAssassin.CollaborativeFilters.User(override.CollaborativeFilters); user != "" && p.spamdUser == "" {
+		p.spamdUser, p.collaborativeFilters = user, override.CollaborativeFilters
+	}
+	p.languages = spamassassin.LanguageOverrides{OkLanguages: override.OkLanguages, OkLocales: override.OkLocales}
+	if override.BlockedDomains != nil {
+		p.blockedDomains = override.BlockedDomains
+	}
+	if override.AllowedSenders != nil {
+		p.allowedSenders = override.AllowedSenders
+	}
+	return p, nil
+}
+
+// userProfile resolves the profile named by a request like profile, and
+// makes scans run as the requested spamd user instead of the profile's. The
+// user must be one of spamassassin.allowed_users.
+func (h *Handler) userProfile(name, user string) (*profile, error) {
+	p, err := h.profile(name)
+	if err != nil || user == "" {
+		return p, err
+	}
+	if !slices.Contains(h.settings().SpamAssassin.AllowedUsers, user) {
+		return nil, toolerr.Errorf(toolerr.Forbidden, "user %q is not allowed; see get_config for the allowed users", user)
+	}
+	p.spamdUser, p.collaborativeFilters = user, ""
+	return p, nil
+}
+
+// Values of the collaborative_filters scan parameter.
+const (
+	collaborativeFiltersEnable  = "enable"
+	collaborativeFiltersDisable = "disable"
+)
+
+// scanProfile resolves the profile of a scan request like userProfile,
+// replaces its threshold with the requested one, and switches to the spamd
+// user configured to enable or disable the collaborative filters when the
+// request asks for it. A user and collaborative filters both select the
+// spamd user, so they cannot be combined.
+func (h *Handler) scanProfile(req ScanEmailParams) (*profile, error) {
+	p, err := h.userProfile(req.Profile, req.User)
+	if err != nil {
+		return nil, err
+	}
+	if req.Threshold != nil {
+		if err := h.requestThreshold(p, *req.Threshold); err != nil {
+			return nil, err
+		}
+	}
+	if req.CollaborativeFilters == "" {
+		return p, nil
+	}
+	if req.User != "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "user and collaborative_filters cannot be combined; both select the spamd user")
+	}
+	cfg := h.settings().SpamAssassin.CollaborativeFilters
+	var user, key string
+	switch req.CollaborativeFilters {
+	case collaborativeFiltersEnable:
+		user, key = cfg.EnabledUser, "enabled_user"
+	case collaborativeFiltersDisable:
+		user, key = cfg.DisabledUser, "disabled_user"
+	default:
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "collaborative_filters must be %q or %q, got %q", collaborativeFiltersEnable, collaborativeFiltersDisable, req.CollaborativeFilters)
+	}
+	if user == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "collaborative filters cannot be switched to %s (set spamassassin.collaborative_filters.%s)", req.CollaborativeFilters, key)
+	}
+	p.spamdUser, p.collaborativeFilters = user, req.CollaborativeFilters
+	return p, nil
+}
+
+// requestThreshold makes p use the threshold a scan request asked for,
+// clamped to spamassassin.threshold_min and threshold_max.
+func (h *Handler) requestThreshold(p *profile, requested float64) error {
+	if math.IsNaN(requested) || math.IsInf(requested, 0) {
+		return toolerr.Errorf(toolerr.ValidationFailed, "threshold must be a finite number")
+	}
+	cfg := h.settings().SpamAssassin
+	threshold := min(max(requested, cfg.ThresholdMin), cfg.ThresholdMax)
+	p.threshold = &threshold
+	if threshold != requested {
+		p.requestedThreshold = &requested
+	}
+	return nil
+}
+
+// scanOptions applies the profile's threshold and spamd user to opts. A
+// profile with ok_languages or ok_locales also asks for the rule scores,
+// since its verdict depends on the language and locale hits.
+func (p *profile) scanOptions(opts spamassassin.ScanOptions) spamassassin.ScanOptions {
+	opts.Threshold = p.threshold
+	opts.User = p.spamdUser
+	if p.languages.OkLanguages != "" || p.languages.OkLocales != "" {
+		opts.Rules = spamassassin.RuleScores
+	}
+	return opts
+}
+
+// profileNames returns the names of the configured profiles and presets,
+// sorted.
+func (h *Handler) profileNames() []string {
+	return h.settings().ProfileNames()
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+// progressReporter emits notifications/progress for a single request when the
+// client supplied a progress token, so long-running tools don't appear silent.
+// Without a token every call is a no-op.
+type progressReporter struct {
+	ss    *mcp.ServerSession
+	token any
+	total float64
+}
+
+func newProgressReporter(ss *mcp.ServerSession, params interface{ GetProgressToken() any }, total int) *progressReporter {
+	return &progressReporter{
+		ss:    ss,
+		token: params.GetProgressToken(),
+		total: float64(total),
+	}
+}
+
+// Report sends the number of completed steps with a short status message.
+func (p *progressReporter) Report(ctx context.Context, done int, message string) {
+	if p.ss == nil || p.token == nil {
+		return
+	}
+
+	err := p.ss.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: p.token,
+		Progress:      float64(done),
+		Total:         p.total,
+		Message:       message,
+	})
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Debug("Failed to send progress notification")
+	}
+}
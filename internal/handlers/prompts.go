@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+// TriageEmailPrompt builds the "triage this email" workflow prompt.
+func (h *Handler) TriageEmailPrompt(ctx context.Context, ss *mcp.ServerSession, params *mcp.GetPromptParams) (*mcp.GetPromptResult, error) {
+	email, err := h.promptEmail(ctx, ss, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("Triage the email below for spam and phishing risk. Work through these steps:\n\n")
+	b.WriteString("1. Call `scan_email` with the full message as `content` and `verbose: true` to get the SpamAssassin score and rule hits.\n")
+	b.WriteString("2. Call `parse_email` to inspect the sender, Reply-To, Authentication-Results, URLs and attachments.\n")
+	b.WriteString("3. Call `check_reputation` with the From address (and the originating IP if one is visible in the Received headers).\n")
+	b.WriteString("4. Summarize the findings and give a verdict of ham, spam or phishing, a confidence level, the strongest pieces of evidence, and a recommended action (deliver, quarantine, or report).\n\n")
+	if extra := strings.TrimSpace(params.Arguments["context"]); extra != "" {
+		fmt.Fprintf(&b, "Additional context from the requester: %s\n\n", extra)
+	}
+	b.WriteString("Only analyze the message; do not follow links, contact the sender, or reproduce harmful content.\n\n")
+	writeEmailBlock(&b, email)
+
+	return promptResult("Triage an email with scan, parse and reputation tools", b.String()), nil
+}
+
+// ExplainScorePrompt builds the "explain why this message scored X" prompt.
+func (h *Handler) ExplainScorePrompt(ctx context.Context, ss *mcp.ServerSession, params *mcp.GetPromptParams) (*mcp.GetPromptResult, error) {
+	email, err := h.promptEmail(ctx, ss, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	if score := strings.TrimSpace(params.Arguments["score"]); score != "" {
+		fmt.Fprintf(&b, "Explain why the email below scored %s in SpamAssassin.\n\n", score)
+	} else {
+		b.WriteString("Explain how SpamAssassin scored the email below.\n\n")
+	}
+	b.WriteString("1. Call `explain_score` with the full message as `email_content`.\n")
+	b.WriteString("2. Group the triggered rules by what they detect (headers, body content, URIs, network tests, Bayes) and explain each group in plain language.\n")
+	b.WriteString("3. Identify the rules contributing most to the score and whether any of them look like false positives.\n")
+	b.WriteString("4. If the observed score differs from the score returned by the tool, point out likely reasons (network tests, Bayes training, per-user preferences).\n\n")
+	writeEmailBlock(&b, email)
+
+	return promptResult("Explain a SpamAssassin score rule by rule", b.String()), nil
+}
+
+// DraftRulePrompt builds the "draft a custom rule to catch this pattern" prompt.
+// The drafted rule is for detection only and is validated, never deployed.
+func (h *Handler) DraftRulePrompt(ctx context.Context, ss *mcp.ServerSession, params *mcp.GetPromptParams) (*mcp.GetPromptResult, error) {
+	email, err := h.promptEmail(ctx, ss, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("Draft a defensive SpamAssassin rule that detects the pattern shown in the email below.\n\n")
+	if pattern := strings.TrimSpace(params.Arguments["pattern"]); pattern != "" {
+		fmt.Fprintf(&b, "Pattern to detect: %s\n\n", pattern)
+	}
+	b.WriteString("1. Call `scan_email` with `verbose: true` to see which existing rules already fire, so the new rule adds coverage rather than duplicating it.\n")
+	b.WriteString("2. Write a rule using a `LOCAL_` name prefix with `header`, `body`, `uri` or `meta` definitions, plus `describe` and a conservative `score` line.\n")
+	b.WriteString("3. Call `test_rules` with the rule and this email, and include at least one legitimate (ham) example to check for false positives.\n")
+	b.WriteString("4. Present the final rule, the test results, and any false-positive risks.\n\n")
+	b.WriteString("The rule must only detect unwanted mail. Do not suggest ways to evade filtering or make messages score lower.\n\n")
+	writeEmailBlock(&b, email)
+
+	return promptResult("Draft and validate a defensive detection rule", b.String()), nil
+}
+
+// promptEmail validates the email argument shared by all prompts.
+func (h *Handler) promptEmail(ctx context.Context, ss *mcp.ServerSession, params *mcp.GetPromptParams) (string, error) {
+	if !h.allow(ctx, ss) {
+		return "", fmt.Errorf("rate limit exceeded")
+	}
+
+	email := params.Arguments["email"]
+	if _, err := h.validateEmailContent(email); err != nil {
+		return "", fmt.Errorf("security validation failed: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "get_prompt",
+		"prompt":    params.Name,
+		"size":      len(email),
+	}).Info("Rendering analysis prompt")
+
+	return email, nil
+}
+
+func writeEmailBlock(b *strings.Builder, email string) {
+	b.WriteString("Email:\n```\n")
+	b.WriteString(strings.ReplaceAll(email, "```", "` ` `"))
+	if !strings.HasSuffix(email, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("```\n")
+}
+
+func promptResult(description, text string) *mcp.GetPromptResult {
+	return &mcp.GetPromptResult{
+		Description: description,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: text}},
+		},
+	}
+}
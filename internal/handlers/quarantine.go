@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// quarantineListSchema defines the filter and sort fields of list_quarantine.
+var quarantineListSchema = listquery.Schema[*quarantine.Item]{
+	Fields: map[string]listquery.Field[*quarantine.Item]{
+		"quarantined_at": listquery.Time(func(i *quarantine.Item) time.Time { return i.QuarantinedAt }),
+		"score":          listquery.Number(func(i *quarantine.Item) float64 { return i.Score }),
+		"hash":           listquery.String(func(i *quarantine.Item) string { return i.Hash }),
+		"sender":         listquery.String(func(i *quarantine.Item) string { return i.Sender }),
+		"profile":        listquery.String(func(i *quarantine.Item) string { return i.Profile }),
+		"released":       listquery.String(func(i *quarantine.Item) string { return strconv.FormatBool(i.Released()) }),
+		"legal_hold":     listquery.String(func(i *quarantine.Item) string { return strconv.FormatBool(i.LegalHold) }),
+	},
+	Key:         func(i *quarantine.Item) string { return i.ID },
+	DefaultSort: "-quarantined_at",
+}
+
+type QuarantinedParams struct {
+	ID string `json:"id" description:"ID of the quarantined message, as reported by list_quarantine and scan_email"`
+}
+
+// InspectQuarantinedResult is the metadata and parsed content of a
+// quarantined message.
+type InspectQuarantinedResult struct {
+	*quarantine.Item
+	Email *model.ParsedEmail `json:"email"`
+}
+
+// ReleaseQuarantinedResult is a released message, exported as its raw
+// content for the operator to deliver.
+type ReleaseQuarantinedResult struct {
+	*quarantine.Item
+	Content string `json:"content"`
+}
+
+// quarantineMessage holds the full content of a scanned message when its
+// score reaches quarantine.min_score, or when it is spam if that is 0.
+// Failures are logged and never fail the scan.
+func (h *Handler) quarantineMessage(ctx context.Context, email *model.ParsedEmail, result *ScanEmailResult, rules []string) {
+	if h.quarantine == nil {
+		return
+	}
+	minScore := h.settings().Quarantine.MinScore
+	if (minScore > 0 && result.Score < minScore) || (minScore == 0 && !result.IsSpam) {
+		return
+	}
+
+	item := &quarantine.Item{
+		Hash:      email.SHA256,
+		Subject:   email.Subject,
+		MessageID: email.MessageID,
+		Score:     result.Score,
+		Threshold: result.Threshold,
+		IsSpam:    result.IsSpam,
+		Rules:     rules,
+		Profile:   result.Profile,
+	}
+	if len(email.From) > 0 {
+		item.Sender = email.From[0].Address
+	}
+	if err := h.quarantine.Add(item, []byte(email.Raw)); err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to quarantine message")
+		return
+	}
+	result.QuarantineID = item.ID
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"id":    item.ID,
+		"score": result.Score,
+	}).Info("Message quarantined")
+}
+
+// ListQuarantine lists the quarantined messages with filtering, sorting and
+// pagination.
+func (h *Handler) ListQuarantine(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*quarantine.Item]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "list_quarantine").Info("Processing quarantine listing")
+
+	if h.quarantine == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "quarantine is not enabled (set quarantine.dir)")
+	}
+
+	page, err := listquery.Apply(h.quarantine.Items(), params.Arguments, quarantineListSchema)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	return &mcp.CallToolResultFor[*listquery.Page[*quarantine.Item]]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("%d of %d matching quarantined messages", len(page.Items), page.Total)}},
+		StructuredContent: page,
+	}, nil
+}
+
+// InspectQuarantined returns a quarantined message parsed like parse_email
+// does, so analysts can review it without releasing it.
+func (h *Handler) InspectQuarantined(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[QuarantinedParams]) (*mcp.CallToolResultFor[*InspectQuarantinedResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	id := params.Arguments.ID
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "inspect_quarantined",
+		"id":        id,
+	}).Info("Processing quarantined message inspection")
+
+	if h.quarantine == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "quarantine is not enabled (set quarantine.dir)")
+	}
+	item, content, err := h.quarantine.Get(id)
+	if err != nil {
+		return nil, quarantineError(err, id)
+	}
+	parsed, err := model.Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quarantined message: %w", err)
+	}
+
+	text := "Quarantined message " + item.ID
+	if item.Sender != "" {
+		text += " from " + item.Sender
+	}
+	text += fmt.Sprintf(", %q: score %.1f/%.1f, held since %s", item.Subject, item.Score, item.Threshold, item.QuarantinedAt.Format(time.RFC3339))
+	if item.Released() {
+		text += ", released " + item.ReleasedAt.Format(time.RFC3339)
+	}
+
+	return &mcp.CallToolResultFor[*InspectQuarantinedResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: &InspectQuarantinedResult{Item: item, Email: parsed},
+	}, nil
+}
+
+// ReleaseQuarantined marks a quarantined message as released and returns
+// its raw content. The message is not delivered; the operator re-injects it
+// into the mail flow.
+func (h *Handler) ReleaseQuarantined(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[QuarantinedParams]) (*mcp.CallToolResultFor[*ReleaseQuarantinedResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	id := params.Arguments.ID
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "release_quarantined",
+		"id":        id,
+	}).Info("Processing quarantined message release")
+
+	if h.quarantine == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "quarantine is not enabled (set quarantine.dir)")
+	}
+	item, content, err := h.quarantine.Release(id)
+	if err != nil {
+		return nil, quarantineError(err, id)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"id":   item.ID,
+		"size": item.Size,
+	}).Info("Quarantined message released")
+
+	return &mcp.CallToolResultFor[*ReleaseQuarantinedResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Released quarantined message %s (%d bytes) for export; it was not delivered", item.ID, item.Size)}},
+		StructuredContent: &ReleaseQuarantinedResult{Item: item, Content: string(content)},
+	}, nil
+}
+
+// quarantineError reports a missing message by its ID and logs other
+// failures, which may come from altered files or a changed key.
+func quarantineError(err error, id string) error {
+	if errors.Is(err, quarantine.ErrNotFound) {
+		return toolerr.Errorf(toolerr.NotFound, "no quarantined message with ID %q", id)
+	}
+	logrus.WithError(err).Error("Failed to read quarantine")
+	return fmt.Errorf("failed to read quarantined message %s", id)
+}
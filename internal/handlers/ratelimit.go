@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/peer"
+	"spamassassin-mcp/internal/ratelimit"
+)
+
+type GetRateLimitsParams struct{}
+
+// toolCallKey is the context key of the *toolCall being served.
+type toolCallKey struct{}
+
+// toolCall links a tool call's per-tool reservation to the global and
+// per-client check made by its handler.
+type toolCall struct {
+	rejection *ratelimit.Rejection
+}
+
+// allow applies the global and per-client rate limits to a request. A tool
+// call refused here is answered by ToolLimitMiddleware with the rejection.
+func (h *Handler) allow(ctx context.Context, ss *mcp.ServerSession) bool {
+	key := clientKey(ctx, ss)
+	rejection := h.rateLimiter.Admit(key)
+	if rejection == nil {
+		return true
+	}
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"client": key,
+		"scope":  rejection.Scope,
+	}).Warn("Rate limit exceeded")
+	h.stats.RecordRejection()
+	if call, ok := ctx.Value(toolCallKey{}).(*toolCall); ok {
+		call.rejection = rejection
+	}
+	return false
+}
+
+// ToolLimitMiddleware applies per-tool budgets and daily quotas to tool
+// calls. Refused calls get an error result whose structured content is the
+// ratelimit.Rejection, including when the client may retry; so do calls the
+// handler then refuses under the global or per-client budget, which are not
+// charged to the tool.
+func (h *Handler) ToolLimitMiddleware(next mcp.MethodHandler[*mcp.ServerSession]) mcp.MethodHandler[*mcp.ServerSession] {
+	return func(ctx context.Context, ss *mcp.ServerSession, method string, params mcp.Params) (mcp.Result, error) {
+		p, ok := params.(*mcp.CallToolParamsFor[json.RawMessage])
+		if !ok {
+			return next(ctx, ss, method, params)
+		}
+
+		key := clientKey(ctx, ss)
+		reservation, rejection := h.rateLimiter.ReserveTool(key, p.Name)
+		if rejection != nil {
+			logrus.WithContext(ctx).WithFields(logrus.Fields{
+				"client": key,
+				"tool":   p.Name,
+				"reason": rejection.Code,
+			}).Warn("Tool limit exceeded")
+			h.stats.RecordRejection()
+			return rejectionResult(rejection), nil
+		}
+
+		call := &toolCall{}
+		result, err := next(context.WithValue(ctx, toolCallKey{}, call), ss, method, params)
+		if call.rejection != nil {
+			reservation.Cancel()
+			call.rejection.Tool = p.Name
+			return rejectionResult(call.rejection), nil
+		}
+		return result, err
+	}
+}
+
+// rejectionResult is the error result of a refused tool call.
+func rejectionResult(rejection *ratelimit.Rejection) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: rejection.Error()}},
+		StructuredContent: rejection,
+		IsError:           true,
+	}
+}
+
+// clientKey identifies the client a request is attributed to: the API key or
+// token subject it authenticated with, else its TLS client certificate, else
+// the remote IP on the HTTP transport, otherwise the MCP session.
+func clientKey(ctx context.Context, ss *mcp.ServerSession) string {
+	if name := peer.Principal(ctx); name != "" {
+		return apiKeyClient(name)
+	}
+	if tok := peer.TokenFrom(ctx); tok != nil {
+		return "sub:" + tok.Subject
+	}
+	if cn := peer.CertCN(ctx); cn != "" {
+		return "cert:" + cn
+	}
+	if addr := peer.Addr(ctx); addr != "" {
+		return "ip:" + addr
+	}
+	if ss != nil && ss.ID() != "" {
+		return "session:" + ss.ID()
+	}
+	return fmt.Sprintf("session:%p", ss)
+}
+
+func apiKeyClient(name string) string {
+	return "key:" + name
+}
+
+// GetRateLimits reports the current global and per-client limiter state.
+func (h *Handler) GetRateLimits(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetRateLimitsParams]) (*mcp.CallToolResultFor[ratelimit.State], error) {
+	logrus.WithContext(ctx).WithField("operation", "get_rate_limits").Info("Processing rate limit inspection request")
+
+	state := h.rateLimiter.State()
+
+	return &mcp.CallToolResultFor[ratelimit.State]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("%d active clients, %.1f global tokens available", len(state.Clients), state.Global.Tokens)},
+		},
+		StructuredContent: state,
+	}, nil
+}
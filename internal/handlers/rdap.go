@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/rdap"
+)
+
+// addRDAPDetails adds the registration date of domain, as reported over
+// RDAP, to details and returns the age of the domain in days, or nil when
+// it is unknown. Lookup failures are recorded in details rather than
+// failing the reputation check.
+func (h *Handler) addRDAPDetails(ctx context.Context, domain string, details map[string]string) *int {
+	if h.rdap == nil || domain == "" {
+		return nil
+	}
+	registration, err := h.rdap.Lookup(ctx, domain)
+	if errors.Is(err, rdap.ErrNoServer) || errors.Is(err, rdap.ErrNotRegistered) {
+		details["rdap_skipped"] = err.Error()
+		return nil
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Warn("RDAP lookup failed")
+		details["rdap_error"] = err.Error()
+		return nil
+	}
+
+	details["rdap_domain"] = registration.Domain
+	details["rdap_server"] = registration.Server
+	details["rdap_cached"] = strconv.FormatBool(registration.Cached)
+	if registration.Registrar != "" {
+		details["rdap_registrar"] = registration.Registrar
+	}
+	if registration.Created == nil {
+		return nil
+	}
+	details["domain_created"] = registration.Created.Format(time.RFC3339)
+	age := registration.AgeDays(time.Now())
+	return &age
+}
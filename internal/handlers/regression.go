@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/corpus"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// regressionWorkers bounds the corpus scans in flight; spamd's own limit,
+// spamassassin.max_concurrent_scans, applies on top.
+const regressionWorkers = 4
+
+type RunRegressionParams struct {
+	Profile           string `json:"profile,omitempty" description:"Named policy profile to apply; see get_config for the available profiles"`
+	MaxFalsePositives *int   `json:"max_false_positives,omitempty" description:"Fail the run when more ham than this is classified as spam"`
+	MaxFalseNegatives *int   `json:"max_false_negatives,omitempty" description:"Fail the run when more spam than this is classified as ham"`
+}
+
+// RegressionResult is the corpus report with the outcome of the gate set by
+// the request's limits. Passed is false when any sample could not be
+// scanned or a limit was exceeded; Failures says why.
+type RegressionResult struct {
+	corpus.Report
+	Threshold float64  `json:"threshold"`
+	Profile   string   `json:"profile,omitempty"`
+	Passed    bool     `json:"passed"`
+	Failures  []string `json:"failures"`
+}
+
+// RunRegression scans the configured labeled corpus with the current rules
+// and reports false positives, false negatives and the score distribution
+// of ham and spam, so rule updates can be gated on not regressing detection
+// quality. Corpus scans are not recorded in statistics or scan history.
+func (h *Handler) RunRegression(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[RunRegressionParams]) (*mcp.CallToolResultFor[*RegressionResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	if h.corpus == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "regression corpus is not configured (set corpus.path)")
+	}
+
+	req := params.Arguments
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	threshold := h.saClient.Threshold()
+	if p.threshold != nil {
+		threshold = *p.threshold
+	}
+
+	samples, err := h.corpus.Samples()
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to list regression corpus")
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "run_regression",
+		"samples":   len(samples),
+		"profile":   p.name,
+	}).Info("Processing regression run")
+
+	outcomes, err := h.scanCorpus(ctx, ss, params, samples, p.scanOptions(spamassassin.ScanOptions{Verbose: true}))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RegressionResult{
+		Report:    *corpus.Summarize(outcomes),
+		Threshold: threshold,
+		Profile:   p.name,
+		Failures:  make([]string, 0),
+	}
+	if response.Errors > 0 {
+		response.Failures = append(response.Failures, fmt.Sprintf("%d samples could not be scanned", response.Errors))
+	}
+	if req.MaxFalsePositives != nil && response.FalsePositives > *req.MaxFalsePositives {
+		response.Failures = append(response.Failures, fmt.Sprintf("%d false positives exceed the limit of %d", response.FalsePositives, *req.MaxFalsePositives))
+	}
+	if req.MaxFalseNegatives != nil && response.FalseNegatives > *req.MaxFalseNegatives {
+		response.Failures = append(response.Failures, fmt.Sprintf("%d false negatives exceed the limit of %d", response.FalseNegatives, *req.MaxFalseNegatives))
+	}
+	response.Passed = len(response.Failures) == 0
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"false_positives": response.FalsePositives,
+		"false_negatives": response.FalseNegatives,
+		"errors":          response.Errors,
+		"passed":          response.Passed,
+	}).Info("Regression run completed")
+
+	verdict := "PASSED"
+	if !response.Passed {
+		verdict = "FAILED"
+	}
+	return &mcp.CallToolResultFor[*RegressionResult]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("%s: %d ham and %d spam scanned at threshold %.1f; %d false positives (%.2f%%), %d false negatives (%.2f%%), %d errors",
+				verdict, response.Ham, response.Spam, threshold,
+				response.FalsePositives, response.FalsePositiveRate*100,
+				response.FalseNegatives, response.FalseNegativeRate*100, response.Errors)},
+		},
+		StructuredContent: response,
+	}, nil
+}
+
+// scanCorpus scans samples on a small worker pool, reporting progress as
+// they complete. Outcomes are returned in sample order.
+func (h *Handler) scanCorpus(ctx context.Context, ss *mcp.ServerSession, params interface{ GetProgressToken() any }, samples []corpus.Sample, options spamassassin.ScanOptions) ([]corpus.Outcome, error) {
+	maxSize := h.settings().Security.MaxEmailSize
+	progress := newProgressReporter(ss, params, len(samples))
+	outcomes := make([]corpus.Outcome, len(samples))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for range min(regressionWorkers, len(samples)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				outcomes[i] = h.scanSample(samples[i], maxSize, options)
+
+				mu.Lock()
+				done++
+				progress.Report(ctx, done, fmt.Sprintf("Scanned %d of %d corpus messages", done, len(samples)))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	for i := range samples {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("corpus scan cancelled: %w", err)
+	}
+	return outcomes, nil
+}
+
+func (h *Handler) scanSample(s corpus.Sample, maxSize int64, options spamassassin.ScanOptions) corpus.Outcome {
+	outcome := corpus.Outcome{Sample: s}
+	content, err := h.corpus.Read(s, maxSize)
+	if err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+	result, err := h.saClient.ScanEmail(content, options)
+	if err != nil {
+		outcome.Error = fmt.Sprintf("scan failed: %v", err)
+		return outcome
+	}
+	outcome.Score = result.Score
+	outcome.IsSpam = result.IsSpam
+	for _, rule := range result.RulesHit {
+		outcome.Rules = append(outcome.Rules, rule.Name)
+	}
+	return outcome
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/spamdreload"
+)
+
+// applyReload runs the configured sa-compile and spamd reload once changed
+// rules have been installed and pass lint.
+func (h *Handler) applyReload(ctx context.Context) *spamdreload.Result {
+	result := h.reloader.Apply(ctx)
+
+	entry := logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"compiled":   result.Compiled,
+		"method":     result.Method,
+		"reloaded":   result.Reloaded,
+		"responding": result.Responding,
+	})
+	if !result.OK() {
+		entry.WithField("error", result.Error).Error("spamd reload failed")
+	} else {
+		entry.Info("spamd reload completed")
+	}
+	return result
+}
+
+// reloadSummary describes the reload outcome for a tool's text result.
+func reloadSummary(result *spamdreload.Result) string {
+	switch {
+	case result == nil:
+		return ""
+	case !result.OK():
+		return "; WARNING: " + result.Error
+	case result.Reloaded:
+		return "; spamd reloaded"
+	case result.Compiled:
+		return "; rules compiled, spamd must be reloaded"
+	}
+	return ""
+}
+
+// reloadChange describes the reload outcome in a request's audit change.
+func reloadChange(result *spamdreload.Result) string {
+	if result == nil || !result.Reloaded {
+		return ""
+	}
+	return fmt.Sprintf(", spamd reloaded with %s", result.Method)
+}
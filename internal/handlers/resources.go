@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/rules"
+)
+
+const (
+	// RuleResourcePrefix is the URI prefix under which rule files are published.
+	RuleResourcePrefix = "sa://rules/"
+
+	// ConfigResourceURI is the URI of the sanitized effective server configuration.
+	ConfigResourceURI = "sa-mcp://config"
+)
+
+// ConfigResource describes the effective configuration resource.
+func (h *Handler) ConfigResource() *mcp.Resource {
+	return &mcp.Resource{
+		URI:         ConfigResourceURI,
+		Name:        "config",
+		Description: "Effective server configuration (defaults, file and environment merged) with secrets redacted",
+		MIMEType:    "application/json",
+	}
+}
+
+// ReadConfig serves the sanitized effective configuration as JSON.
+func (h *Handler) ReadConfig(ctx context.Context, ss *mcp.ServerSession, params *mcp.ReadResourceParams) (*mcp.ReadResourceResult, error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "read_config").Info("Reading configuration resource")
+
+	return jsonResource(params.URI, h.settings().Redacted())
+}
+
+// jsonResource encodes v as an application/json resource body.
+func jsonResource(uri string, v any) (*mcp.ReadResourceResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resource %s: %w", uri, err)
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: "application/json", Text: string(data)},
+		},
+	}, nil
+}
+
+// RuleResources returns an MCP resource descriptor for every rule file
+// currently installed, e.g. sa://rules/72_active.cf.
+func (h *Handler) RuleResources() ([]*mcp.Resource, error) {
+	files, err := h.rules.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*mcp.Resource, 0, len(files))
+	for _, file := range files {
+		resources = append(resources, &mcp.Resource{
+			URI:         RuleResourcePrefix + file.Name,
+			Name:        file.Name,
+			Description: fmt.Sprintf("SpamAssassin rule file %s", file.Path),
+			MIMEType:    "text/plain",
+			Size:        file.Size,
+		})
+	}
+	return resources, nil
+}
+
+// ReadRuleFile serves the contents of a sa://rules/ resource.
+func (h *Handler) ReadRuleFile(ctx context.Context, ss *mcp.ServerSession, params *mcp.ReadResourceParams) (*mcp.ReadResourceResult, error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	name := strings.TrimPrefix(params.URI, RuleResourcePrefix)
+	if !rules.ValidName(name) {
+		return nil, mcp.ResourceNotFoundError(params.URI)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "read_rule_file",
+		"file":      name,
+	}).Info("Reading rule file resource")
+
+	data, err := h.rules.Read(name)
+	if errors.Is(err, rules.ErrNotFound) {
+		return nil, mcp.ResourceNotFoundError(params.URI)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read rule file")
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: params.URI, MIMEType: "text/plain", Text: string(data)},
+		},
+	}, nil
+}
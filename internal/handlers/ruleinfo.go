@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/rules"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type GetRuleInfoParams struct {
+	Name string `json:"name" description:"Rule name, e.g. URIBL_BLACK"`
+}
+
+// GetRuleInfo describes a rule from the installed rule files: its
+// definitions, description, flags and scores per scoreset.
+func (h *Handler) GetRuleInfo(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetRuleInfoParams]) (*mcp.CallToolResultFor[*rules.RuleInfo], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	name := strings.TrimSpace(params.Arguments.Name)
+	if !rules.ValidRuleName(name) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid rule name: %q", name)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "get_rule_info",
+		"rule":      name,
+	}).Info("Processing rule lookup")
+
+	info, err := h.rules.Lookup(name)
+	if errors.Is(err, rules.ErrRuleNotFound) {
+		return nil, toolerr.Errorf(toolerr.NotFound, "rule %s is not defined in the installed rule files", name)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to look up rule")
+		return nil, fmt.Errorf("failed to look up rule: %w", err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"definitions": len(info.Definitions),
+		"files":       len(info.Files),
+	}).Info("Rule lookup completed")
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s", info.Name)
+	if info.Description != "" {
+		fmt.Fprintf(&text, ": %s", info.Description)
+	}
+	for _, d := range info.Definitions {
+		fmt.Fprintf(&text, "\n%s %s (%s:%d)", d.Type, d.Value, d.File, d.Line)
+	}
+	if info.Score != nil {
+		s := info.Score
+		fmt.Fprintf(&text, "\nscore %g %g %g %g", s[0], s[1], s[2], s[3])
+		if info.ScoreImplicit {
+			text.WriteString(" (implicit default)")
+		}
+	}
+	if len(info.TFlags) > 0 {
+		fmt.Fprintf(&text, "\ntflags %s", strings.Join(info.TFlags, " "))
+	}
+
+	return &mcp.CallToolResultFor[*rules.RuleInfo]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text.String()}},
+		StructuredContent: info,
+	}, nil
+}
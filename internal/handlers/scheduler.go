@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ruleupdate"
+	"spamassassin-mcp/internal/scheduler"
+)
+
+type GetSchedulerStatusParams struct{}
+
+// GetSchedulerStatusResult lists the scheduled maintenance jobs with the
+// outcome of their last run.
+type GetSchedulerStatusResult struct {
+	Timezone string                `json:"timezone"`
+	Jobs     []scheduler.JobStatus `json:"jobs"`
+}
+
+// newScheduler creates the scheduler for the jobs of cfg. Validation makes
+// sure every job can be created; should one not be, none is scheduled.
+func (h *Handler) newScheduler(cfg config.SchedulerConfig) *scheduler.Scheduler {
+	s, err := scheduler.New(cfg, map[string]scheduler.Task{
+		config.TaskUpdateRules:  h.scheduledRuleUpdate,
+		config.TaskBayesExpire:  h.scheduledBayesExpire,
+		config.TaskPruneCaches:  h.scheduledCachePrune,
+		config.TaskPruneHistory: h.scheduledHistoryPrune,
+	}, h.auditScheduledRun)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create scheduler")
+		s, _ = scheduler.New(config.SchedulerConfig{}, nil, nil)
+	}
+	return s
+}
+
+// StartScheduler starts running the scheduled maintenance jobs; Close stops
+// them.
+func (h *Handler) StartScheduler() {
+	h.scheduler.Start()
+}
+
+// scheduledRuleUpdate installs rule updates from all configured channels,
+// reloading spamd when update_rules would.
+func (h *Handler) scheduledRuleUpdate(ctx context.Context, _ config.ScheduledJob) (string, error) {
+	report, err := h.updater.Update(ctx, ruleupdate.Options{})
+	if err != nil {
+		return "", err
+	}
+	switch report.Status {
+	case ruleupdate.StatusUpToDate:
+		return "rules are up to date", nil
+	case ruleupdate.StatusAvailable:
+		return "rule updates are available", nil
+	}
+	if report.ReloadRequired && report.Lint.Valid && h.reloader.Enabled() {
+		report.Reload = h.applyReload(ctx)
+		report.ReloadRequired = !report.Reload.Reloaded
+	}
+	summary := fmt.Sprintf("rules %s: %d files added, %d removed, %d modified", report.Status, len(report.Added), len(report.Removed), len(report.Modified))
+	if report.Lint != nil && !report.Lint.Valid {
+		return summary, fmt.Errorf("%s, but the updated configuration fails lint with %d issue(s); do not reload spamd", summary, len(report.Lint.Issues))
+	}
+	summary += reloadSummary(report.Reload)
+	if report.Reload != nil && !report.Reload.OK() {
+		return summary, errors.New(report.Reload.Error)
+	}
+	return summary, nil
+}
+
+// scheduledBayesExpire expires old Bayes tokens with sa-learn.
+func (h *Handler) scheduledBayesExpire(ctx context.Context, _ config.ScheduledJob) (string, error) {
+	status, err := h.bayes.Expire(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Bayes tokens expired: %d tokens left, %d removed by the last expiry", status.Tokens, status.LastExpiryReduction), nil
+}
+
+// scheduledCachePrune drops the expired reputation lookups cached for
+// AbuseIPDB, VirusTotal and RDAP.
+func (h *Handler) scheduledCachePrune(context.Context, config.ScheduledJob) (string, error) {
+	now := time.Now()
+	n := 0
+	if h.abuseIPDB != nil {
+		n += h.abuseIPDB.Prune(now)
+	}
+	if h.virusTotal != nil {
+		n += h.virusTotal.Prune(now)
+	}
+	if h.rdap != nil {
+		n += h.rdap.Prune(now)
+	}
+	return fmt.Sprintf("%d expired cache entries dropped", n), nil
+}
+
+// scheduledHistoryPrune deletes the scan history entries older than the
+// job's max_age, or than history.retention, except those under legal hold.
+func (h *Handler) scheduledHistoryPrune(ctx context.Context, job config.ScheduledJob) (string, error) {
+	if h.history == nil {
+		return "", fmt.Errorf("scan history is not enabled (set history.dsn)")
+	}
+	maxAge := job.MaxAge
+	if maxAge == 0 {
+		maxAge = h.settings().History.Retention
+	}
+	n, err := h.history.Prune(ctx, time.Now().Add(-maxAge))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d history entries older than %s deleted", n, maxAge), nil
+}
+
+// auditScheduledRun records a scheduled run in the persistent audit log,
+// attributed to the job rather than a client.
+func (h *Handler) auditScheduledRun(run scheduler.Run) {
+	if h.auditLog == nil {
+		return
+	}
+	rec := audit.Record{
+		Time:       run.Started,
+		RequestID:  run.RequestID,
+		Method:     "scheduler/run",
+		Tool:       run.Job.Task,
+		Actor:      "scheduler:" + run.Job.Name,
+		Change:     run.Result,
+		Outcome:    "success",
+		DurationMS: run.Duration.Milliseconds(),
+	}
+	if run.Err != nil {
+		rec.Outcome = "error"
+	}
+	if err := h.auditLog.Append(rec); err != nil {
+		logrus.WithError(err).Error("Failed to write audit record")
+	}
+}
+
+// GetSchedulerStatus reports the scheduled maintenance jobs, when they run
+// next and how their last run went.
+func (h *Handler) GetSchedulerStatus(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetSchedulerStatusParams]) (*mcp.CallToolResultFor[*GetSchedulerStatusResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "get_scheduler_status").Info("Processing scheduler status request")
+
+	result := &GetSchedulerStatusResult{Timezone: "UTC", Jobs: h.scheduler.Status()}
+	var failed, never int
+	for _, job := range result.Jobs {
+		switch {
+		case job.LastRun == nil:
+			never++
+		case job.LastOutcome == scheduler.OutcomeFailure:
+			failed++
+		}
+	}
+
+	text := "No scheduled jobs are configured (see scheduler.jobs)"
+	if len(result.Jobs) > 0 {
+		text = fmt.Sprintf("%d scheduled jobs: %d failed their last run, %d have not run yet", len(result.Jobs), failed, never)
+	}
+	return &mcp.CallToolResultFor[*GetSchedulerStatusResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/similarity"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+type CompareEmailsParams struct {
+	Emails []string `json:"emails" description:"Two to ten raw email messages including headers"`
+}
+
+// CompareEmails compares every pair of the given messages by content,
+// structure and shared URLs and template markers, and groups the messages
+// that look like one campaign.
+func (h *Handler) CompareEmails(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CompareEmailsParams]) (*mcp.CallToolResultFor[*similarity.Result], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	contents := params.Arguments.Emails
+	if len(contents) < 2 || len(contents) > similarity.MaxMessages {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "between 2 and %d emails are required, got %d", similarity.MaxMessages, len(contents))
+	}
+
+	emails := make([]*model.ParsedEmail, 0, len(contents))
+	for i, content := range contents {
+		email, err := h.validateEmailContent(content)
+		if err != nil {
+			return nil, fmt.Errorf("security validation failed for email %d: %w", i, err)
+		}
+		emails = append(emails, email)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "compare_emails",
+		"emails":    len(emails),
+	}).Info("Processing email comparison")
+
+	result := similarity.Compare(emails)
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"pairs":    len(result.Pairs),
+		"clusters": len(result.Clusters),
+	}).Info("Email comparison completed")
+
+	text := fmt.Sprintf("Compared %d emails: %d campaign cluster(s)", len(emails), len(result.Clusters))
+	for _, c := range result.Clusters {
+		text += fmt.Sprintf("\n- cluster %v", c)
+	}
+	for _, p := range result.Pairs {
+		text += fmt.Sprintf("\n- %d vs %d: similarity %.2f (%s), content %.2f, structure %.2f, %d shared URL(s), %d shared marker(s)",
+			p.A, p.B, p.Similarity, p.Verdict, p.Content, p.Structure, len(p.SharedURLs), len(p.SharedMarkers))
+	}
+
+	return &mcp.CallToolResultFor[*similarity.Result]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
+
+type FindSimilarParams struct {
+	Content       string `json:"content" description:"Raw email content including headers; its body is matched against the scan history"`
+	MinSimilarity int    `json:"min_similarity,omitempty" description:"Lowest fuzzy-hash similarity reported, 1-100 (default 50)"`
+	Limit         int    `json:"limit,omitempty" description:"Maximum messages to return, most similar first (default 50, max 500)"`
+}
+
+// SimilarMessage is a message in the scan history whose body matches the
+// sample, with the verdict of its latest scan.
+type SimilarMessage struct {
+	Hash       string    `json:"hash"`
+	FuzzyHash  string    `json:"fuzzy_hash"`
+	Similarity int       `json:"similarity"`
+	Identical  bool      `json:"identical,omitempty"`
+	Sender     string    `json:"sender,omitempty"`
+	Score      float64   `json:"score"`
+	IsSpam     bool      `json:"is_spam"`
+	Scans      int       `json:"scans"`
+	Spam       int       `json:"spam"`
+	Complaints int       `json:"complaints,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// FindSimilarResult lists the matches of a sample. Variants counts the
+// matched messages other than the sample itself; the totals cover every
+// match, including those beyond the limit. PeerMatches lists the campaign
+// fingerprints of the instances configured in peer_sync.peers that match,
+// at most limit of them; they are not counted in the totals.
+type FindSimilarResult struct {
+	Hash       string            `json:"hash"`
+	FuzzyHash  string            `json:"fuzzy_hash"`
+	Searched   int               `json:"searched"`
+	Variants   int               `json:"variants"`
+	Scans      int               `json:"scans"`
+	Spam       int               `json:"spam"`
+	Complaints int               `json:"complaints"`
+	FirstSeen  *time.Time        `json:"first_seen,omitempty"`
+	LastSeen   *time.Time        `json:"last_seen,omitempty"`
+	Matches    []*SimilarMessage `json:"matches"`
+
+	PeerMatches []peersync.Match `json:"peer_matches,omitempty"`
+}
+
+// FindSimilar matches the fuzzy hash of a sample's body against those
+// recorded in the scan history, revealing variants of a campaign that
+// differ in names, amounts or links and so have different SHA-256 hashes.
+func (h *Handler) FindSimilar(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[FindSimilarParams]) (*mcp.CallToolResultFor[*FindSimilarResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+	minSimilarity := req.MinSimilarity
+	if minSimilarity == 0 {
+		minSimilarity = 50
+	}
+	if minSimilarity < 1 || minSimilarity > 100 {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "min_similarity must be between 1 and 100, got %d", minSimilarity)
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = listquery.DefaultLimit
+	}
+	if limit > listquery.MaxLimit {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "limit must not exceed %d", listquery.MaxLimit)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":      "find_similar",
+		"size":           email.Size,
+		"min_similarity": minSimilarity,
+	}).Info("Processing similar message search")
+
+	if h.history == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "scan history is not enabled (set history.dsn)")
+	}
+	fuzzy := similarity.FuzzyHash(email)
+	if fuzzy == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "the message has no body text to match")
+	}
+
+	result := &FindSimilarResult{Hash: email.SHA256, FuzzyHash: fuzzy, Matches: []*SimilarMessage{}}
+	scores := make(map[string]int)
+	matches := make(map[string]*SimilarMessage)
+	err = h.history.Walk(ctx, history.Criteria{Fuzzy: true, Limit: historyScanLimit}, func(e *history.Entry) error {
+		result.Searched++
+		score, ok := scores[e.FuzzyHash]
+		if !ok {
+			score = similarity.FuzzyScore(fuzzy, e.FuzzyHash)
+			scores[e.FuzzyHash] = score
+		}
+		if score < minSimilarity {
+			return nil
+		}
+
+		// Entries come newest first, so the first one of a message holds
+		// its latest verdict.
+		m := matches[e.Hash]
+		if m == nil {
+			m = &SimilarMessage{
+				Hash:       e.Hash,
+				FuzzyHash:  e.FuzzyHash,
+				Similarity: score,
+				Identical:  e.Hash == email.SHA256,
+				Sender:     e.Sender,
+				Score:      e.Score,
+				IsSpam:     e.IsSpam,
+				LastSeen:   e.ScannedAt,
+			}
+			matches[e.Hash] = m
+			result.Matches = append(result.Matches, m)
+			if !m.Identical {
+				result.Variants++
+			}
+		}
+		m.FirstSeen = e.ScannedAt
+		switch {
+		case e.Complaint:
+			m.Complaints++
+			result.Complaints++
+		case e.IsSpam:
+			m.Spam++
+			result.Spam++
+			fallthrough
+		default:
+			m.Scans++
+			result.Scans++
+		}
+		if result.LastSeen == nil {
+			result.LastSeen = &e.ScannedAt
+		}
+		result.FirstSeen = &e.ScannedAt
+		return nil
+	})
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to read scan history")
+		return nil, fmt.Errorf("failed to read scan history")
+	}
+
+	sort.SliceStable(result.Matches, func(i, j int) bool {
+		return result.Matches[i].Similarity > result.Matches[j].Similarity
+	})
+	if len(result.Matches) > limit {
+		result.Matches = result.Matches[:limit]
+	}
+	result.PeerMatches = h.peers.Similar(fuzzy, minSimilarity)
+	if len(result.PeerMatches) > limit {
+		result.PeerMatches = result.PeerMatches[:limit]
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"searched": result.Searched,
+		"matches":  len(matches),
+		"variants": result.Variants,
+		"peers":    len(result.PeerMatches),
+	}).Info("Similar message search completed")
+
+	text := fmt.Sprintf("%d variant(s) with body similarity of %d or more among %d recorded scans: %d scans, %d spam, %d complaints",
+		result.Variants, minSimilarity, result.Searched, result.Scans, result.Spam, result.Complaints)
+	if result.Searched == historyScanLimit {
+		text += fmt.Sprintf("; only the %d most recent scans were searched", historyScanLimit)
+	}
+	for _, m := range result.Matches {
+		text += fmt.Sprintf("\n- %s: similarity %d, %d scans (%d spam), last %s with score %.2f", m.Hash[:12], m.Similarity, m.Scans, m.Spam, verdictWord(m.IsSpam), m.Score)
+		if m.Identical {
+			text += " (this message)"
+		}
+	}
+	for _, m := range result.PeerMatches {
+		text += fmt.Sprintf("\n- peer %s: similarity %d, %d scans (%d spam), %d complaints, last seen %s", m.Peer, m.Similarity, m.Scans, m.Spam, m.Complaints, m.LastSeen.Format(time.RFC3339))
+	}
+
+	return &mcp.CallToolResultFor[*FindSimilarResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/resolver"
+	"spamassassin-mcp/internal/spf"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9])?\.)+[a-zA-Z]{2,63}\.?$`)
+
+type CheckSPFParams struct {
+	IP     string `json:"ip" description:"IPv4 or IPv6 address of the connecting SMTP client"`
+	Domain string `json:"domain,omitempty" description:"Domain whose SPF policy is checked; defaults to the domain of sender"`
+	Sender string `json:"sender,omitempty" description:"MAIL FROM address; defaults to postmaster@domain"`
+	Helo   string `json:"helo,omitempty" description:"HELO/EHLO name presented by the client, used for %{h} macros"`
+}
+
+// CheckSPF evaluates the SPF policy of a sender domain for a connecting IP,
+// following includes and redirects and expanding macros.
+func (h *Handler) CheckSPF(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[CheckSPFParams]) (*mcp.CallToolResultFor[*spf.Evaluation], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+
+	// Validate input
+	ip := net.ParseIP(req.IP)
+	if ip == nil {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid IP address format")
+	}
+	if req.Sender != "" && !emailRegex.MatchString(req.Sender) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid email address format")
+	}
+	domain := req.Domain
+	if domain == "" && req.Sender != "" {
+		domain = req.Sender[strings.LastIndex(req.Sender, "@")+1:]
+	}
+	if domain == "" {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "one of domain or sender is required")
+	}
+	if !domainRegex.MatchString(domain) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid domain format")
+	}
+	if req.Helo != "" && !domainRegex.MatchString(req.Helo) {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "invalid HELO name format")
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "check_spf",
+		"domain":    domain,
+		"ip":        req.IP,
+	}).Info("Processing SPF check")
+
+	cfg := h.settings().DNS
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	result := spf.Check(ctx, resolver.New(cfg), spf.Query{
+		IP:     ip,
+		Domain: domain,
+		Sender: req.Sender,
+		Helo:   req.Helo,
+	})
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"domain":    result.Domain,
+		"result":    result.Result,
+		"mechanism": result.Mechanism,
+		"lookups":   result.DNSLookups,
+	}).Info("SPF check completed")
+
+	text := fmt.Sprintf("SPF %s for %s from %s", result.Result, result.Domain, req.IP)
+	switch {
+	case result.Mechanism != "":
+		text += fmt.Sprintf(" (matched %s in %s)", result.Mechanism, result.MatchedDomain)
+	case result.Error != "":
+		text += fmt.Sprintf(" (%s)", result.Error)
+	}
+
+	return &mcp.CallToolResultFor[*spf.Evaluation]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
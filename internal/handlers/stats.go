@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/stats"
+)
+
+type GetStatsParams struct{}
+
+// GetStats reports scan volumes, verdicts, latency, the most frequently hit
+// rules and rate limit rejections since statistics collection started.
+func (h *Handler) GetStats(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[GetStatsParams]) (*mcp.CallToolResultFor[stats.Snapshot], error) {
+	logrus.WithContext(ctx).WithField("operation", "get_stats").Info("Processing statistics request")
+
+	snapshot := h.stats.Snapshot()
+
+	return &mcp.CallToolResultFor[stats.Snapshot]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("%d messages scanned, %d spam, average score %.2f, p95 latency %.0fms since %s",
+				snapshot.MessagesScanned, snapshot.SpamDetected, snapshot.AverageScore, snapshot.P95LatencyMS, snapshot.Since.Format("2006-01-02 15:04:05 MST"))},
+		},
+		StructuredContent: snapshot,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/corpus"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// defaultMaxFalsePositiveRate is the false positive rate a recommended
+// threshold may reach when the request does not set one: 0.1% of ham.
+const defaultMaxFalsePositiveRate = 0.001
+
+type TuneThresholdParams struct {
+	Profile              string    `json:"profile,omitempty" description:"Named policy profile to apply; its threshold is evaluated as the current one"`
+	Thresholds           []float64 `json:"thresholds,omitempty" description:"Candidate thresholds to evaluate; default 1.0 to 15.0 in steps of 0.5"`
+	MaxFalsePositiveRate *float64  `json:"max_false_positive_rate,omitempty" description:"Highest share of ham classified as spam a recommended threshold may have, 0-1; default 0.001"`
+}
+
+// TuningResult is the threshold evaluation of the configured corpus.
+type TuningResult struct {
+	corpus.Tuning
+	Profile string `json:"profile,omitempty"`
+}
+
+// TuneThreshold scans the configured labeled corpus once and reports
+// precision, recall and F1 at candidate thresholds, with the threshold that
+// classifies the corpus best within a false positive rate limit, so
+// operators can move off the default 5.0 with evidence. Nothing is changed.
+func (h *Handler) TuneThreshold(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[TuneThresholdParams]) (*mcp.CallToolResultFor[*TuningResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	if h.corpus == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "regression corpus is not configured (set corpus.path)")
+	}
+
+	req := params.Arguments
+	candidates := req.Thresholds
+	if len(candidates) == 0 {
+		candidates = corpus.DefaultCandidates()
+	}
+	if len(candidates) > corpus.MaxCandidates {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "at most %d candidate thresholds are allowed, got %d", corpus.MaxCandidates, len(candidates))
+	}
+	maxRate := defaultMaxFalsePositiveRate
+	if req.MaxFalsePositiveRate != nil {
+		maxRate = *req.MaxFalsePositiveRate
+	}
+	if maxRate < 0 || maxRate > 1 {
+		return nil, toolerr.Errorf(toolerr.ValidationFailed, "max_false_positive_rate must be between 0 and 1, got %g", maxRate)
+	}
+
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	current := h.saClient.Threshold()
+	if p.threshold != nil {
+		current = *p.threshold
+	}
+
+	samples, err := h.corpus.Samples()
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to list regression corpus")
+		return nil, err
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":  "tune_threshold",
+		"samples":    len(samples),
+		"candidates": len(candidates),
+		"profile":    p.name,
+	}).Info("Processing threshold tuning request")
+
+	outcomes, err := h.scanCorpus(ctx, ss, params, samples, p.scanOptions(spamassassin.ScanOptions{}))
+	if err != nil {
+		return nil, err
+	}
+	tuning, err := corpus.Tune(outcomes, current, candidates, maxRate)
+	if err != nil {
+		return nil, err
+	}
+	response := &TuningResult{Tuning: *tuning, Profile: p.name}
+
+	c := response.Current
+	text := fmt.Sprintf("Current threshold %.1f: precision %.4f, recall %.4f, F1 %.4f, %d false positives.",
+		c.Threshold, c.Precision, c.Recall, c.F1, c.FalsePositives)
+	if r := response.Recommended; r != nil {
+		text += fmt.Sprintf(" Recommended threshold %.1f: precision %.4f, recall %.4f, F1 %.4f, %d false positives.",
+			r.Threshold, r.Precision, r.Recall, r.F1, r.FalsePositives)
+	} else {
+		text += fmt.Sprintf(" No candidate keeps the false positive rate within %g.", maxRate)
+	}
+
+	fields := logrus.Fields{"ham": response.Ham, "spam": response.Spam, "errors": response.Errors}
+	if response.Recommended != nil {
+		fields["recommended"] = response.Recommended.Threshold
+	}
+	logrus.WithContext(ctx).WithFields(fields).Info("Threshold tuning completed")
+
+	return &mcp.CallToolResultFor[*TuningResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: response,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/dnsbl"
+	"spamassassin-mcp/internal/resolver"
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/urls"
+	"spamassassin-mcp/internal/virustotal"
+)
+
+type ExtractURLsParams struct {
+	Content    string `json:"content" description:"Raw email content including headers"`
+	Profile    string `json:"profile,omitempty" description:"Named policy profile whose blocked domains are applied"`
+	SkipDNS    bool   `json:"skip_dns,omitempty" description:"Check only the configured blocked domains, not the URI DNS blocklists"`
+	VirusTotal bool   `json:"virustotal,omitempty" description:"Look up each URL on VirusTotal (requires virustotal.api_key); URLs are never submitted for scanning"`
+	Unshorten  bool   `json:"unshorten,omitempty" description:"Follow the redirects of URL shortener links with HEAD requests to report their destination (requires unshorten.enabled)"`
+}
+
+type ExtractURLsResult struct {
+	URLs       []*urls.URL `json:"urls"`
+	Malicious  int         `json:"malicious"`
+	Suspicious int         `json:"suspicious"`
+	Errors     []string    `json:"errors,omitempty"`
+}
+
+// ExtractURLs extracts the URLs of a message, including obfuscated ones, and
+// assesses each against the URI blocklists and blocked domains.
+func (h *Handler) ExtractURLs(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[ExtractURLsParams]) (*mcp.CallToolResultFor[*ExtractURLsResult], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	email, err := h.validateEmailContent(req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("security validation failed: %w", err)
+	}
+	p, err := h.profile(req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	var vt *virustotal.Client
+	if req.VirusTotal {
+		if vt, err = h.virusTotalClient(); err != nil {
+			return nil, err
+		}
+	}
+	settings := h.settings()
+	if req.Unshorten && !settings.Unshorten.Enabled {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "URL unshortening is disabled (set unshorten.enabled)")
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation":  "extract_urls",
+		"size":       email.Size,
+		"profile":    p.name,
+		"skip_dns":   req.SkipDNS,
+		"virustotal": req.VirusTotal,
+		"unshorten":  req.Unshorten,
+	}).Info("Processing URL extraction")
+
+	result := &ExtractURLsResult{URLs: urls.Extract(email)}
+
+	cfg := settings.DNS
+	var r urls.Resolver
+	dnsCtx := ctx
+	if !req.SkipDNS {
+		var cancel context.CancelFunc
+		dnsCtx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		r = resolver.New(cfg)
+	}
+	h.urlFeeds.Match(result.URLs)
+	result.Errors = urls.Assess(dnsCtx, r, dnsbl.Zones(cfg.URIBLZones, cfg.SpamhausDQSKey), p.blockedDomains, result.URLs)
+	if vt != nil {
+		values := make([]string, len(result.URLs))
+		for i, u := range result.URLs {
+			values[i] = u.URL
+		}
+		result.Errors = append(result.Errors, h.lookupVirusTotal(ctx, values, vt.URL, func(i int, report *virustotal.Report) {
+			result.URLs[i].VirusTotal = report
+		})...)
+	}
+
+	if req.Unshorten {
+		result.Errors = append(result.Errors, urls.NewUnshortener(settings.Unshorten).Unshorten(ctx, result.URLs)...)
+	}
+
+	for _, u := range result.URLs {
+		switch u.Verdict {
+		case urls.Malicious:
+			result.Malicious++
+		case urls.Suspicious:
+			result.Suspicious++
+		}
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"urls":       len(result.URLs),
+		"malicious":  result.Malicious,
+		"suspicious": result.Suspicious,
+	}).Info("URL extraction completed")
+
+	text := fmt.Sprintf("%d URL(s): %d malicious, %d suspicious", len(result.URLs), result.Malicious, result.Suspicious)
+	for _, u := range result.URLs {
+		if u.Verdict != urls.Clean || u.VirusTotal != nil || u.FinalURL != "" {
+			text += fmt.Sprintf("\n- %s: %s", u.URL, u.Verdict) + virusTotalText(u.VirusTotal)
+			if u.FinalURL != "" {
+				text += fmt.Sprintf(", redirects to %s", u.FinalURL)
+			}
+		}
+	}
+
+	return &mcp.CallToolResultFor[*ExtractURLsResult]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: result,
+	}, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/virustotal"
+)
+
+// virusTotalClient returns the VirusTotal client for a call that requested
+// lookups, or an error when lookups are not configured.
+func (h *Handler) virusTotalClient() (*virustotal.Client, error) {
+	if h.virusTotal == nil {
+		return nil, toolerr.Errorf(toolerr.NotConfigured, "VirusTotal lookups are not configured (set virustotal.api_key)")
+	}
+	return h.virusTotal, nil
+}
+
+// lookupVirusTotal looks up each of values with lookup and passes the
+// reports to set, in order. Cached reports are free; after
+// virustotal.max_lookups uncached lookups the remaining values are skipped.
+// Failures and skipped values are returned as messages rather than failing
+// the call.
+func (h *Handler) lookupVirusTotal(ctx context.Context, values []string, lookup func(context.Context, string) (*virustotal.Report, error), set func(int, *virustotal.Report)) []string {
+	budget := h.settings().VirusTotal.MaxLookups
+	var problems []string
+	skipped := 0
+	for i, value := range values {
+		if budget == 0 {
+			skipped++
+			continue
+		}
+		report, err := lookup(ctx, value)
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Warn("VirusTotal lookup failed")
+			problems = append(problems, fmt.Sprintf("virustotal %s: %v", value, err))
+			continue
+		}
+		if !report.Cached {
+			budget--
+		}
+		set(i, report)
+	}
+	if skipped > 0 {
+		problems = append(problems, fmt.Sprintf("virustotal: %d lookup(s) skipped, over the limit of %d per call", skipped, h.settings().VirusTotal.MaxLookups))
+	}
+	return problems
+}
+
+// virusTotalText summarizes a report for the text result.
+func virusTotalText(report *virustotal.Report) string {
+	switch {
+	case report == nil:
+		return ""
+	case !report.Found:
+		return ", not known to VirusTotal"
+	case report.FirstSeen != nil:
+		return fmt.Sprintf(", VirusTotal %s (first seen %s)", report.Ratio, report.FirstSeen.Format("2006-01-02"))
+	default:
+		return ", VirusTotal " + report.Ratio
+	}
+}
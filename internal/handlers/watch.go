@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+)
+
+// maildirLogger is the logger name of the notifications sent for
+// high-scoring delivered messages.
+const maildirLogger = "maildir_watch"
+
+// DeliveredVerdict is the data of the notification sent for a message
+// delivered to the watched Maildir that scores maildir_watch.notify_score or
+// more. Hash looks the scan up with get_message_history.
+type DeliveredVerdict struct {
+	File      string    `json:"file"`
+	Hash      string    `json:"hash"`
+	MessageID string    `json:"message_id,omitempty"`
+	From      string    `json:"from,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Score     float64   `json:"score"`
+	Threshold float64   `json:"threshold"`
+	IsSpam    bool      `json:"is_spam"`
+	Rules     []string  `json:"rules"`
+	Tags      []string  `json:"tags,omitempty"`
+	Profile   string    `json:"profile,omitempty"`
+	ScannedAt time.Time `json:"scanned_at"`
+}
+
+// ScanDelivered scans a message the Maildir watcher found in new/. The
+// verdict is recorded in the statistics and scan history like a scan_email
+// call. When it scores maildir_watch.notify_score or more, a warning
+// notifications/message carrying a DeliveredVerdict is sent to every session
+// of server that enabled logging with logging/setLevel.
+func (h *Handler) ScanDelivered(ctx context.Context, server *mcp.Server, name, content string) {
+	cfg := h.settings().MaildirWatch
+	entry := logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "maildir_watch",
+		"file":      name,
+	})
+
+	email, err := h.validateEmailContent(content)
+	if err != nil {
+		entry.WithError(err).Warn("Skipping delivered message")
+		return
+	}
+	// Verbose, so the rules hit are recorded in the scan history
+	result, err := h.scanEmail(ctx, ScanEmailParams{Content: content, Profile: cfg.Profile, Verbose: true}, email)
+	if err != nil {
+		entry.WithError(err).Error("Failed to scan delivered message")
+		return
+	}
+
+	notifyScore := cfg.NotifyScore
+	if notifyScore == 0 {
+		notifyScore = result.Threshold
+	}
+	if result.Score < notifyScore {
+		return
+	}
+
+	verdict := &DeliveredVerdict{
+		File:      name,
+		Hash:      email.SHA256,
+		MessageID: email.MessageID,
+		Subject:   email.Subject,
+		Score:     result.Score,
+		Threshold: result.Threshold,
+		IsSpam:    result.IsSpam,
+		Rules:     make([]string, 0, len(result.RulesHit)),
+		Tags:      result.Tags,
+		Profile:   result.Profile,
+		ScannedAt: result.Timestamp,
+	}
+	if len(email.From) > 0 {
+		verdict.From = email.From[0].Address
+	}
+	for _, rule := range result.RulesHit {
+		verdict.Rules = append(verdict.Rules, rule.Name)
+	}
+
+	entry.WithFields(logrus.Fields{
+		"hash":  verdict.Hash,
+		"score": verdict.Score,
+		"rules": verdict.Rules,
+	}).Warn("High-scoring message delivered")
+
+	for ss := range server.Sessions() {
+		err := ss.Log(ctx, &mcp.LoggingMessageParams{
+			Level:  "warning",
+			Logger: maildirLogger,
+			Data:   verdict,
+		})
+		if err != nil {
+			logrus.WithContext(ctx).WithError(err).Debug("Failed to send delivery notification")
+		}
+	}
+}
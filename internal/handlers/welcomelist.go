@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/toolerr"
+	"spamassassin-mcp/internal/welcomelist"
+)
+
+// Sources of list_welcomelist items.
+const (
+	welcomelistSourceStore  = "welcomelist"
+	welcomelistSourceConfig = "config"
+)
+
+// welcomelistSchema defines the filter and sort fields of list_welcomelist.
+var welcomelistSchema = listquery.Schema[*WelcomelistItem]{
+	Fields: map[string]listquery.Field[*WelcomelistItem]{
+		"address":  listquery.String(func(i *WelcomelistItem) string { return i.Address }),
+		"source":   listquery.String(func(i *WelcomelistItem) string { return i.Source }),
+		"added_by": listquery.String(func(i *WelcomelistItem) string { return i.AddedBy }),
+		"added_at": listquery.Time(func(i *WelcomelistItem) time.Time { return i.AddedAt }),
+	},
+	Key:         func(i *WelcomelistItem) string { return i.Source + "\x00" + i.Address },
+	DefaultSort: "address",
+}
+
+// WelcomelistItem is a welcomelisted sender. Source is welcomelist for
+// entries managed with the welcomelist tools and config for the static
+// security.allowed_senders list, which can only be changed in the
+// configuration file.
+type WelcomelistItem struct {
+	welcomelist.Entry
+	Source string `json:"source"`
+}
+
+type AddWelcomelistEntryParams struct {
+	Address string `json:"address" description:"Sender address or pattern, e.g. alice@example.com or *@example.com"`
+	Comment string `json:"comment,omitempty" description:"Why the sender is trusted; written above the entry in local.cf"`
+}
+
+type RemoveWelcomelistEntryParams struct {
+	Address string `json:"address" description:"Sender address or pattern exactly as listed"`
+}
+
+// WelcomelistChange reports the outcome of adding or removing an entry.
+type WelcomelistChange struct {
+	Entry   welcomelist.Entry `json:"entry"`
+	Changed bool              `json:"changed"`
+	Entries int               `json:"entries"`
+
+	// LocalCF is the local.cf the entries were written to, if one is
+	// configured. spamd applies the change once it reloads its
+	// configuration.
+	LocalCF string `json:"local_cf,omitempty"`
+}
+
+// AddWelcomelistEntry adds a sender to the persistent welcomelist and, when
+// configured, writes it to local.cf. Adding a listed address changes
+// nothing.
+func (h *Handler) AddWelcomelistEntry(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[AddWelcomelistEntryParams]) (*mcp.CallToolResultFor[*WelcomelistChange], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	req := params.Arguments
+	address := welcomelist.Normalize(req.Address)
+	if err := welcomelist.ValidateAddress(address); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if err := welcomelist.ValidateComment(comment); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "add_welcomelist_entry",
+		"address":   address,
+	}).Info("Processing welcomelist addition")
+
+	entry := welcomelist.Entry{
+		Address: address,
+		Comment: comment,
+		AddedBy: clientKey(ctx, ss),
+		AddedAt: time.Now().UTC(),
+	}
+	added, err := h.welcome.Add(entry)
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to update welcomelist")
+		return nil, fmt.Errorf("failed to update welcomelist: %w", err)
+	}
+	if added {
+		recordChange(ctx, "welcomelist: added %s", address)
+	} else {
+		entry = *h.welcome.Get(address)
+	}
+	change := h.welcomelistChange(entry, added)
+
+	logrus.WithContext(ctx).WithField("changed", added).Info("Welcomelist addition completed")
+
+	text := fmt.Sprintf("Added %s to the welcomelist", address)
+	if !added {
+		text = fmt.Sprintf("%s is already on the welcomelist", address)
+	}
+	return &mcp.CallToolResultFor[*WelcomelistChange]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: change,
+	}, nil
+}
+
+// RemoveWelcomelistEntry removes a sender from the persistent welcomelist
+// and, when configured, from local.cf.
+func (h *Handler) RemoveWelcomelistEntry(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[RemoveWelcomelistEntryParams]) (*mcp.CallToolResultFor[*WelcomelistChange], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	address := welcomelist.Normalize(params.Arguments.Address)
+	if err := welcomelist.ValidateAddress(address); err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"operation": "remove_welcomelist_entry",
+		"address":   address,
+	}).Info("Processing welcomelist removal")
+
+	removed, err := h.welcome.Remove(address)
+	if errors.Is(err, welcomelist.ErrNotFound) {
+		if contains(h.settings().Security.AllowedSenders, address) {
+			return nil, toolerr.Errorf(toolerr.ValidationFailed, "%s is set in security.allowed_senders; remove it from the configuration file", address)
+		}
+		return nil, toolerr.Errorf(toolerr.NotFound, "%s is not on the welcomelist", address)
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithError(err).Error("Failed to update welcomelist")
+		return nil, fmt.Errorf("failed to update welcomelist: %w", err)
+	}
+
+	recordChange(ctx, "welcomelist: removed %s", address)
+
+	logrus.WithContext(ctx).Info("Welcomelist removal completed")
+
+	return &mcp.CallToolResultFor[*WelcomelistChange]{
+		Content:           []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("Removed %s from the welcomelist", address)}},
+		StructuredContent: h.welcomelistChange(*removed, true),
+	}, nil
+}
+
+// ListWelcomelist lists the welcomelist entries together with the static
+// security.allowed_senders list.
+func (h *Handler) ListWelcomelist(ctx context.Context, ss *mcp.ServerSession, params *mcp.CallToolParamsFor[listquery.Query]) (*mcp.CallToolResultFor[*listquery.Page[*WelcomelistItem]], error) {
+	if !h.allow(ctx, ss) {
+		return nil, fmt.Errorf("rate limit exceeded")
+	}
+
+	logrus.WithContext(ctx).WithField("operation", "list_welcomelist").Info("Processing welcomelist query")
+
+	var items []*WelcomelistItem
+	for _, e := range h.welcome.Entries() {
+		items = append(items, &WelcomelistItem{Entry: e, Source: welcomelistSourceStore})
+	}
+	for _, address := range h.settings().Security.AllowedSenders {
+		items = append(items, &WelcomelistItem{Entry: welcomelist.Entry{Address: address}, Source: welcomelistSourceConfig})
+	}
+
+	page, err := listquery.Apply(items, params.Arguments, welcomelistSchema)
+	if err != nil {
+		return nil, toolerr.Wrap(toolerr.ValidationFailed, err)
+	}
+
+	return &mcp.CallToolResultFor[*listquery.Page[*WelcomelistItem]]{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("Showing %d of %d welcomelisted senders", len(page.Items), page.Total)},
+		},
+		StructuredContent: page,
+	}, nil
+}
+
+func (h *Handler) welcomelistChange(entry welcomelist.Entry, changed bool) *WelcomelistChange {
+	return &WelcomelistChange{
+		Entry:   entry,
+		Changed: changed,
+		Entries: len(h.welcome.Entries()),
+		LocalCF: h.welcome.LocalCF(),
+	}
+}
@@ -0,0 +1,279 @@
+// Package headersanity checks the header block of a message for the
+// mistakes of bulk mailing software and forged headers.
+//
+// Legitimate mail user agents and relays produce consistent headers: one
+// well-formed Message-ID, a Date close to the time the first relay received
+// the message, RFC 2047 encoded non-ASCII subjects and HELO names that
+// match the connecting host. Analyze flags departures from that as findings
+// weighted in SpamAssassin score points, so the total can be read alongside
+// a SpamAssassin score as a second opinion.
+//
+// Security considerations:
+//   - No network lookups are made; the HELO checks compare what the
+//     receiving relays recorded in the Received headers
+//   - Received headers are attacker-controlled below the first trusted
+//     relay, so HELO findings describe what the headers claim
+package headersanity
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/forensics"
+	"spamassassin-mcp/internal/model"
+)
+
+// Finding types.
+const (
+	MissingMessageID    = "missing_message_id"
+	DuplicateMessageID  = "duplicate_message_id"
+	MalformedMessageID  = "malformed_message_id"
+	MissingDate         = "missing_date"
+	MalformedDate       = "malformed_date"
+	DateInFuture        = "date_in_future"
+	DateInPast          = "date_in_past"
+	DuplicateHeader     = "duplicate_header"
+	UnencodedSubject    = "unencoded_subject"
+	MalformedEncoding   = "malformed_encoded_word"
+	SuspiciousMailer    = "suspicious_mailer"
+	ForgedMailer        = "forged_mailer"
+	HeloNotFQDN         = "helo_not_fqdn"
+	HeloBareIP          = "helo_bare_ip"
+	HeloLiteralMismatch = "helo_literal_mismatch"
+	HeloRDNSMismatch    = "helo_rdns_mismatch"
+	HeloClaimsReceiver  = "helo_claims_receiver"
+)
+
+// weights are the score points each finding contributes, on the scale of
+// SpamAssassin scores.
+var weights = map[string]float64{
+	MissingMessageID:    1.0,
+	DuplicateMessageID:  2.0,
+	MalformedMessageID:  1.0,
+	MissingDate:         1.0,
+	MalformedDate:       1.0,
+	DateInFuture:        1.5,
+	DateInPast:          1.0,
+	DuplicateHeader:     1.5,
+	UnencodedSubject:    1.0,
+	MalformedEncoding:   1.0,
+	SuspiciousMailer:    1.5,
+	ForgedMailer:        2.0,
+	HeloNotFQDN:         1.0,
+	HeloBareIP:          1.0,
+	HeloLiteralMismatch: 2.0,
+	HeloRDNSMismatch:    0.5,
+	HeloClaimsReceiver:  2.0,
+}
+
+const (
+	// maxFutureSkew is how far the Date header may lie after the newest
+	// Received timestamp, and maxPastSkew how far before the oldest.
+	maxFutureSkew = 15 * time.Minute
+	maxPastSkew   = 72 * time.Hour
+)
+
+// singleton are the headers RFC 5322 allows at most once, other than
+// Message-ID, which has its own finding.
+var singleton = []string{"Date", "From", "Sender", "Reply-To", "To", "Cc", "Bcc", "In-Reply-To", "References", "Subject"}
+
+var (
+	messageIDRegex = regexp.MustCompile(`^<[^<>@\s]+@[^<>@\s]+>$`)
+
+	// suspiciousMailers are X-Mailer and User-Agent values of bulk mailing
+	// software, and of client versions so old that they appear almost only
+	// when spamware imitates them.
+	suspiciousMailers = regexp.MustCompile(`(?i)atomic mail sender|sendblaster|mass ?mailer|group ?mail|advanced mass sender|` +
+		`maxbulk|super ?mailer|bulk ?mailer|e-?mail ?blaster|worldmerge|aureate|` +
+		`outlook express 6\.00\.2600\.0000|microsoft outlook,? build 10\.0\.2627|the bat! \(v[12]\.`)
+
+	outlookMailer = regexp.MustCompile(`(?i)^microsoft (?:office )?outlook\b`)
+)
+
+// Finding is one header anomaly with the score points it contributes. Hop
+// is the Received hop concerned, numbered in transit order as by
+// analyze_headers, or zero for the rest of the header block.
+type Finding struct {
+	Type        string  `json:"type"`
+	Header      string  `json:"header,omitempty"`
+	Hop         int     `json:"hop,omitempty"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+}
+
+// Report is the header sanity analysis of a message. Score is the sum of
+// the finding weights.
+type Report struct {
+	Findings []Finding `json:"findings"`
+	Score    float64   `json:"score"`
+}
+
+// Analyze checks the header block of email.
+func Analyze(email *model.ParsedEmail, now time.Time) *Report {
+	r := &Report{Findings: make([]Finding, 0)}
+	// The hop chain is all that is needed; without a resolver no lookups
+	// are made.
+	hops := forensics.Analyze(context.Background(), nil, email, now).Hops
+
+	r.checkMessageID(email)
+	r.checkDate(email, hops, now)
+	for _, name := range singleton {
+		if n := len(email.HeaderValues(name)); n > 1 {
+			r.add(DuplicateHeader, name, 0, "%d %s headers; RFC 5322 allows one", n, name)
+		}
+	}
+	r.checkSubject(email)
+	r.checkMailer(email)
+	for _, hop := range hops {
+		r.checkHelo(hop)
+	}
+
+	for _, f := range r.Findings {
+		r.Score += f.Weight
+	}
+	r.Score = math.Round(r.Score*100) / 100
+	return r
+}
+
+func (r *Report) add(kind, header string, hop int, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{
+		Type:        kind,
+		Header:      header,
+		Hop:         hop,
+		Description: fmt.Sprintf(format, args...),
+		Weight:      weights[kind],
+	})
+}
+
+func (r *Report) checkMessageID(email *model.ParsedEmail) {
+	ids := email.HeaderValues("Message-ID")
+	switch {
+	case len(ids) == 0:
+		r.add(MissingMessageID, "Message-ID", 0, "message has no Message-ID header")
+		return
+	case len(ids) > 1:
+		r.add(DuplicateMessageID, "Message-ID", 0, "%d Message-ID headers", len(ids))
+	}
+	if id := strings.TrimSpace(ids[0]); !messageIDRegex.MatchString(id) {
+		r.add(MalformedMessageID, "Message-ID", 0, "Message-ID %q is not of the form <left@right>", id)
+	}
+}
+
+// checkDate compares the Date header with the Received timestamps, or with
+// now when there are none.
+func (r *Report) checkDate(email *model.ParsedEmail, hops []*forensics.Hop, now time.Time) {
+	if email.Header("Date") == "" {
+		r.add(MissingDate, "Date", 0, "message has no Date header")
+		return
+	}
+	if email.Date == nil {
+		r.add(MalformedDate, "Date", 0, "Date %q is not an RFC 5322 date", email.Header("Date"))
+		return
+	}
+	var oldest, newest *time.Time
+	for _, hop := range hops {
+		if hop.Received == nil {
+			continue
+		}
+		if oldest == nil || hop.Received.Before(*oldest) {
+			oldest = hop.Received
+		}
+		if newest == nil || hop.Received.After(*newest) {
+			newest = hop.Received
+		}
+	}
+	latest, what := now, "the time of analysis"
+	if newest != nil {
+		latest, what = *newest, "the newest Received timestamp"
+	}
+	if skew := email.Date.Sub(latest); skew > maxFutureSkew {
+		r.add(DateInFuture, "Date", 0, "Date is %s after %s", skew.Round(time.Minute), what)
+	}
+	if oldest != nil {
+		if skew := oldest.Sub(*email.Date); skew > maxPastSkew {
+			r.add(DateInPast, "Date", 0, "Date is %s before the oldest Received timestamp", skew.Round(time.Minute))
+		}
+	}
+}
+
+// checkSubject flags subjects with raw 8-bit characters, which RFC 5322
+// headers may not contain without RFC 2047 encoding, and encoded words
+// that could not be decoded.
+func (r *Report) checkSubject(email *model.ParsedEmail) {
+	for _, h := range email.Headers {
+		if !strings.EqualFold(h.Name, "Subject") {
+			continue
+		}
+		if h.RawValue == "" && strings.ContainsFunc(h.Value, func(c rune) bool { return c >= 0x80 }) {
+			r.add(UnencodedSubject, "Subject", 0, "Subject contains non-ASCII characters without RFC 2047 encoding")
+		}
+		if strings.Contains(h.Value, "=?") && strings.Contains(h.Value, "?=") {
+			r.add(MalformedEncoding, "Subject", 0, "Subject contains an RFC 2047 encoded word that could not be decoded")
+		}
+		return
+	}
+}
+
+// checkMailer flags the X-Mailer and User-Agent values of bulk mailing
+// software, and Outlook mailer names on messages without the Thread-Index
+// header every Outlook version since 2003 adds.
+func (r *Report) checkMailer(email *model.ParsedEmail) {
+	for _, name := range []string{"X-Mailer", "User-Agent"} {
+		mailer := strings.TrimSpace(email.Header(name))
+		switch {
+		case mailer == "":
+		case suspiciousMailers.MatchString(mailer):
+			r.add(SuspiciousMailer, name, 0, "%s %q is bulk mailing software or a client version spamware imitates", name, mailer)
+		case outlookMailer.MatchString(mailer) && !strings.Contains(strings.ToLower(mailer), "express") && email.Header("Thread-Index") == "":
+			r.add(ForgedMailer, name, 0, "%s claims %q but the message has no Thread-Index header", name, mailer)
+		}
+	}
+}
+
+// checkHelo compares the HELO name of a hop with the address and reverse
+// name the receiving relay recorded. Hops from private addresses are
+// skipped, since internal hosts often use short names.
+func (r *Report) checkHelo(hop *forensics.Hop) {
+	helo := strings.TrimSuffix(hop.Helo, ".")
+	if helo == "" || hop.IP == "" || hop.Private {
+		return
+	}
+	if strings.HasPrefix(helo, "[") {
+		literal := strings.TrimPrefix(strings.Trim(helo, "[]"), "IPv6:")
+		if ip := net.ParseIP(literal); ip != nil && !ip.Equal(net.ParseIP(hop.IP)) {
+			r.add(HeloLiteralMismatch, "Received", hop.Index, "HELO address literal %s does not match the connecting address %s", helo, hop.IP)
+		}
+		return
+	}
+	if net.ParseIP(helo) != nil {
+		r.add(HeloBareIP, "Received", hop.Index, "HELO %s is an IP address without the brackets of an address literal", helo)
+		return
+	}
+	if !strings.Contains(helo, ".") {
+		r.add(HeloNotFQDN, "Received", hop.Index, "HELO %s is not a fully qualified domain name", helo)
+		return
+	}
+	if by := strings.TrimSuffix(hop.By, "."); by != "" && strings.EqualFold(helo, by) {
+		r.add(HeloClaimsReceiver, "Received", hop.Index, "HELO %s is the name of the receiving relay", helo)
+		return
+	}
+	if rdns := strings.TrimSuffix(hop.ReverseDNS, "."); rdns != "" && !strings.EqualFold(rdns, "unknown") &&
+		registrable(rdns) != registrable(helo) {
+		r.add(HeloRDNSMismatch, "Received", hop.Index, "HELO %s is in a different domain than the reverse name %s of %s", helo, rdns, hop.IP)
+	}
+}
+
+func registrable(name string) string {
+	name = strings.ToLower(name)
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+		return domain
+	}
+	return name
+}
@@ -0,0 +1,200 @@
+// Package health serves liveness and readiness probes for orchestrators.
+//
+// Liveness (/healthz) only reports that the process is serving HTTP.
+// Readiness (/readyz) reports the outcome of dependency checks, such as spamd
+// answering PING and rule files being installed. Checks run in the
+// background on a fixed interval and probes return the cached results, so
+// frequent probing never translates into load on spamd.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Check reports whether a dependency is usable. It should return promptly
+// once ctx is done.
+type Check func(ctx context.Context) error
+
+// CheckResult is the most recent outcome of a check.
+type CheckResult struct {
+	OK         bool      `json:"ok"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Status is the readiness report served by /readyz.
+type Status struct {
+	Ready    bool                   `json:"ready"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs registered checks periodically and serves their results.
+type Checker struct {
+	interval time.Duration
+	timeout  time.Duration
+	checks   []namedCheck
+
+	mu       sync.RWMutex
+	results  map[string]CheckResult
+	draining bool
+}
+
+// NewChecker creates a checker that probes every interval, giving each check
+// at most timeout to complete.
+func NewChecker(interval, timeout time.Duration) *Checker {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+	return &Checker{
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]CheckResult),
+	}
+}
+
+// Register adds a readiness check. It must be called before Run.
+func (c *Checker) Register(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run probes immediately and then on every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe runs every check once, concurrently, and records the results.
+func (c *Checker) Probe(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, nc.check)
+
+			c.mu.Lock()
+			previous, seen := c.results[nc.name]
+			c.results[nc.name] = result
+			c.mu.Unlock()
+
+			if !seen || previous.OK != result.OK {
+				entry := logrus.WithFields(logrus.Fields{"check": nc.name, "ok": result.OK})
+				if result.OK {
+					entry.Info("Readiness check passing")
+				} else {
+					entry.WithField("error", result.Error).Warn("Readiness check failing")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// run executes a check with the configured timeout. Checks that ignore ctx
+// are abandoned, not waited for, once the timeout expires.
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		OK:         err == nil,
+		CheckedAt:  start,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// SetDraining permanently marks the server as not ready, so load balancers
+// stop routing new clients to it during shutdown.
+func (c *Checker) SetDraining() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draining = true
+}
+
+// Status returns the latest results. The checker is ready only once every
+// registered check has run and its last run passed, and never while draining.
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := Status{
+		Ready:    !c.draining,
+		Draining: c.draining,
+		Checks:   make(map[string]CheckResult, len(c.checks)),
+	}
+	for _, nc := range c.checks {
+		result, ok := c.results[nc.name]
+		if !ok {
+			result = CheckResult{Error: "not yet checked"}
+		}
+		status.Checks[nc.name] = result
+		if !result.OK {
+			status.Ready = false
+		}
+	}
+	return status
+}
+
+// Handler serves /healthz and /readyz.
+func (c *Checker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,195 @@
+// Package history records the verdict of every scan so analysts can look up
+// how a message, or mail from a sender, was classified before.
+//
+// Entries are stored in a SQL database through database/sql. SQLite is the
+// default and needs no external service; PostgreSQL can be used instead when
+// several servers should share one history. Backends implement Store, so
+// other databases can be added without touching the tool handlers.
+//
+// Security considerations:
+//   - Message content is never stored; messages are identified by the SHA-256
+//     hash of their raw content, and related by a fuzzy hash of their body
+//     text, from which the text cannot be recovered
+//   - Sender addresses are stored so they can be searched; restrict access to
+//     the database and the history tools accordingly
+//   - Entries older than the configured retention are deleted automatically,
+//     except those placed under legal hold
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Entry is the recorded outcome of one scan.
+type Entry struct {
+	ID        int64     `json:"id"`
+	Hash      string    `json:"hash"`
+	Sender    string    `json:"sender,omitempty"`
+	Score     float64   `json:"score"`
+	Threshold float64   `json:"threshold"`
+	IsSpam    bool      `json:"is_spam"`
+	Rules     []string  `json:"rules"`
+	Tags      []string  `json:"tags,omitempty"`
+	Profile   string    `json:"profile,omitempty"`
+	ScannedAt time.Time `json:"scanned_at"`
+
+	// Complaint marks entries recorded from a feedback-loop complaint about
+	// the message rather than from a scan of delivered mail.
+	Complaint bool `json:"complaint,omitempty"`
+
+	// FuzzyHash is the ssdeep-style hash of the body text; see
+	// similarity.FuzzyHash. It is empty for entries recorded before it was
+	// introduced and for messages without body text.
+	FuzzyHash string `json:"fuzzy_hash,omitempty"`
+
+	// LegalHold exempts the entry from pruning until the hold is lifted.
+	LegalHold bool `json:"legal_hold,omitempty"`
+}
+
+// Verdict returns "spam" or "ham".
+func (e *Entry) Verdict() string {
+	if e.IsSpam {
+		return "spam"
+	}
+	return "ham"
+}
+
+// Criteria narrows the entries returned by Find. Empty fields match every
+// entry; the slices match any of their values, and Hashes, Senders,
+// Profiles and Tags match case-insensitively. Tags matches entries carrying
+// any of the tags.
+type Criteria struct {
+	Hashes    []string
+	Senders   []string
+	Profiles  []string
+	Tags      []string
+	Spam      []bool
+	Complaint []bool
+	LegalHold []bool
+	From      time.Time
+	To        time.Time
+
+	// Fuzzy restricts the entries to those with a fuzzy hash.
+	Fuzzy bool
+
+	// Sort orders the entries by one of SortFields, prefixed with "-" for
+	// descending order, breaking ties by ascending ID. Empty means newest
+	// first.
+	Sort string
+
+	// Offset skips that many entries of the ordering; Limit caps the number
+	// returned after them. Zero means no limit.
+	Offset int
+	Limit  int
+}
+
+// SortFields are the entry fields Criteria.Sort accepts, named as in the
+// JSON form of Entry, with verdict ordering ham before spam.
+var SortFields = []string{"scanned_at", "score", "hash", "sender", "verdict", "profile", "complaint", "legal_hold"}
+
+// Store persists scan history.
+type Store interface {
+	// Record appends an entry; the store assigns its ID.
+	Record(ctx context.Context, e *Entry) error
+
+	// Find returns the entries matching c, in the order c.Sort selects.
+	Find(ctx context.Context, c Criteria) ([]*Entry, error)
+
+	// Walk calls fn for each entry matching c, in order, without holding
+	// them all in memory. It stops at the first error fn returns.
+	Walk(ctx context.Context, c Criteria, fn func(*Entry) error) error
+
+	// Count returns the number of entries matching c, ignoring its Offset
+	// and Limit.
+	Count(ctx context.Context, c Criteria) (int, error)
+
+	// SetLegalHold places the entries matching c under legal hold, or lifts
+	// their hold, ignoring its Sort, Offset and Limit. It returns how many
+	// entries changed.
+	SetLegalHold(ctx context.Context, c Criteria, hold bool) (int64, error)
+
+	// Prune deletes entries scanned before cutoff, except those under legal
+	// hold, and returns how many were removed.
+	Prune(ctx context.Context, cutoff time.Time) (int64, error)
+
+	Close() error
+}
+
+// Open opens the store configured by cfg, creating its schema if needed.
+// It returns nil when no DSN is configured. Entries older than
+// cfg.Retention are pruned now and then hourly until the store is closed.
+func Open(cfg config.HistoryConfig) (Store, error) {
+	if cfg.DSN == "" {
+		return nil, nil
+	}
+
+	var (
+		store Store
+		err   error
+	)
+	switch cfg.Driver {
+	case "sqlite":
+		store, err = openSQL("sqlite", cfg.DSN, sqliteDialect)
+	case "postgres":
+		store, err = openSQL("pgx", cfg.DSN, postgresDialect)
+	default:
+		return nil, fmt.Errorf("unsupported history driver %q", cfg.Driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scan history: %w", err)
+	}
+
+	if cfg.Retention > 0 {
+		store = withRetention(store, cfg.Retention)
+	}
+	return store, nil
+}
+
+// retainedStore prunes expired entries in the background.
+type retainedStore struct {
+	Store
+	stop chan struct{}
+	done chan struct{}
+}
+
+// pruneInterval is how often expired entries are deleted.
+const pruneInterval = time.Hour
+
+func withRetention(store Store, retention time.Duration) Store {
+	r := &retainedStore{Store: store, stop: make(chan struct{}), done: make(chan struct{})}
+	go r.prune(retention)
+	return r
+}
+
+func (r *retainedStore) prune(retention time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := r.Prune(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to prune scan history")
+		} else if n > 0 {
+			logrus.WithField("entries", n).Info("Pruned expired scan history")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *retainedStore) Close() error {
+	close(r.stop)
+	<-r.done
+	return r.Store.Close()
+}
@@ -0,0 +1,340 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dialect holds the SQL that differs between databases.
+type dialect struct {
+	schema []string
+
+	// placeholder returns the bind parameter for the n-th argument (1-based).
+	placeholder func(n int) string
+
+	// noLimit is the LIMIT that lifts the limit, for an OFFSET without one.
+	noLimit string
+}
+
+var sqliteDialect = dialect{
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS scan_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hash TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			score DOUBLE PRECISION NOT NULL,
+			threshold DOUBLE PRECISION NOT NULL,
+			is_spam BOOLEAN NOT NULL,
+			rules TEXT NOT NULL,
+			profile TEXT NOT NULL,
+			scanned_at BIGINT NOT NULL,
+			complaint BOOLEAN NOT NULL DEFAULT FALSE,
+			fuzzy_hash TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			legal_hold BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`PRAGMA journal_mode = WAL`,
+		`PRAGMA busy_timeout = 5000`,
+	},
+	placeholder: func(int) string { return "?" },
+	noLimit:     "-1",
+}
+
+var postgresDialect = dialect{
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS scan_history (
+			id BIGSERIAL PRIMARY KEY,
+			hash TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			score DOUBLE PRECISION NOT NULL,
+			threshold DOUBLE PRECISION NOT NULL,
+			is_spam BOOLEAN NOT NULL,
+			rules TEXT NOT NULL,
+			profile TEXT NOT NULL,
+			scanned_at BIGINT NOT NULL,
+			complaint BOOLEAN NOT NULL DEFAULT FALSE,
+			fuzzy_hash TEXT NOT NULL DEFAULT '',
+			tags TEXT NOT NULL DEFAULT '',
+			legal_hold BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+	},
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	noLimit:     "ALL",
+}
+
+// indexes are created by every dialect.
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS scan_history_hash ON scan_history (hash)`,
+	`CREATE INDEX IF NOT EXISTS scan_history_sender ON scan_history (sender)`,
+	`CREATE INDEX IF NOT EXISTS scan_history_scanned_at ON scan_history (scanned_at)`,
+}
+
+// sortColumns maps SortFields to the columns they order by.
+var sortColumns = map[string]string{
+	"scanned_at": "scanned_at",
+	"score":      "score",
+	"hash":       "hash",
+	"sender":     "sender",
+	"verdict":    "is_spam",
+	"profile":    "profile",
+	"complaint":  "complaint",
+	"legal_hold": "legal_hold",
+}
+
+// columns are the columns added since the table was first created, with
+// their definitions. openSQL adds those an existing table lacks.
+var columns = []struct{ name, definition string }{
+	{"complaint", "complaint BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"fuzzy_hash", "fuzzy_hash TEXT NOT NULL DEFAULT ''"},
+	{"tags", "tags TEXT NOT NULL DEFAULT ''"},
+	{"legal_hold", "legal_hold BOOLEAN NOT NULL DEFAULT FALSE"},
+}
+
+// sqlStore is a Store backed by database/sql. Timestamps are stored as Unix
+// nanoseconds and rules and tags as comma-separated lists, which every supported
+// database handles identically.
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func openSQL(driver, dsn string, d dialect) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// SQLite allows a single writer; serialize access rather than
+		// failing with SQLITE_BUSY under concurrent scans.
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, stmt := range append(d.schema, indexes...) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	for _, c := range columns {
+		if _, err := db.ExecContext(ctx, "SELECT "+c.name+" FROM scan_history LIMIT 0"); err == nil {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "ALTER TABLE scan_history ADD COLUMN "+c.definition); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &sqlStore{db: db, dialect: d}, nil
+}
+
+func (s *sqlStore) Record(ctx context.Context, e *Entry) error {
+	query := fmt.Sprintf(
+		`INSERT INTO scan_history (hash, sender, score, threshold, is_spam, rules, profile, scanned_at, complaint, fuzzy_hash, tags) VALUES (%s)`,
+		s.placeholders(1, 11),
+	)
+	_, err := s.db.ExecContext(ctx, query,
+		e.Hash, strings.ToLower(e.Sender), e.Score, e.Threshold, e.IsSpam,
+		strings.Join(e.Rules, ","), e.Profile, e.ScannedAt.UnixNano(), e.Complaint, e.FuzzyHash,
+		strings.Join(e.Tags, ","),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record scan history: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Find(ctx context.Context, c Criteria) ([]*Entry, error) {
+	var entries []*Entry
+	err := s.Walk(ctx, c, func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+func (s *sqlStore) Walk(ctx context.Context, c Criteria, fn func(*Entry) error) error {
+	where, args := s.where(c)
+	query := `SELECT id, hash, sender, score, threshold, is_spam, rules, profile, scanned_at, complaint, fuzzy_hash, tags, legal_hold FROM scan_history` + where
+
+	if c.Sort == "" {
+		query += " ORDER BY scanned_at DESC, id DESC"
+	} else {
+		column, ok := sortColumns[strings.TrimPrefix(c.Sort, "-")]
+		if !ok {
+			return fmt.Errorf("unsupported scan history sort %q", c.Sort)
+		}
+		if strings.HasPrefix(c.Sort, "-") {
+			column += " DESC"
+		}
+		query += " ORDER BY " + column + ", id"
+	}
+	if c.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(c.Limit)
+	}
+	if c.Offset > 0 {
+		if c.Limit <= 0 {
+			// SQLite needs a LIMIT before an OFFSET.
+			query += " LIMIT " + s.dialect.noLimit
+		}
+		query += " OFFSET " + strconv.Itoa(c.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query scan history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e         Entry
+			rules     string
+			tags      string
+			scannedAt int64
+		)
+		if err := rows.Scan(&e.ID, &e.Hash, &e.Sender, &e.Score, &e.Threshold, &e.IsSpam, &rules, &e.Profile, &scannedAt, &e.Complaint, &e.FuzzyHash, &tags, &e.LegalHold); err != nil {
+			return fmt.Errorf("failed to read scan history: %w", err)
+		}
+		e.Rules = []string{}
+		if rules != "" {
+			e.Rules = strings.Split(rules, ",")
+		}
+		if tags != "" {
+			e.Tags = strings.Split(tags, ",")
+		}
+		e.ScannedAt = time.Unix(0, scannedAt).UTC()
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read scan history: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Count(ctx context.Context, c Criteria) (int, error) {
+	where, args := s.where(c)
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM scan_history"+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count scan history: %w", err)
+	}
+	return n, nil
+}
+
+// where returns the WHERE clause selecting the entries matching c, if any,
+// and its arguments.
+func (s *sqlStore) where(c Criteria) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	in := func(column string, values []string) {
+		where = append(where, fmt.Sprintf("%s IN (%s)", column, s.placeholders(len(args)+1, len(values))))
+		for _, v := range values {
+			args = append(args, strings.ToLower(v))
+		}
+	}
+	inBool := func(column string, values []bool) {
+		where = append(where, fmt.Sprintf("%s IN (%s)", column, s.placeholders(len(args)+1, len(values))))
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if len(c.Hashes) > 0 {
+		in("hash", c.Hashes)
+	}
+	if len(c.Senders) > 0 {
+		in("sender", c.Senders)
+	}
+	if len(c.Profiles) > 0 {
+		in("LOWER(profile)", c.Profiles)
+	}
+	if len(c.Tags) > 0 {
+		// Tags are stored comma-separated; match whole list items
+		var matches []string
+		for _, tag := range c.Tags {
+			args = append(args, "%,"+likeEscaper.Replace(strings.ToLower(tag))+",%")
+			matches = append(matches, "',' || LOWER(tags) || ',' LIKE "+s.dialect.placeholder(len(args))+` ESCAPE '\'`)
+		}
+		where = append(where, "("+strings.Join(matches, " OR ")+")")
+	}
+	if len(c.Spam) > 0 {
+		inBool("is_spam", c.Spam)
+	}
+	if len(c.Complaint) > 0 {
+		inBool("complaint", c.Complaint)
+	}
+	if len(c.LegalHold) > 0 {
+		inBool("legal_hold", c.LegalHold)
+	}
+	if !c.From.IsZero() {
+		args = append(args, c.From.UnixNano())
+		where = append(where, "scanned_at >= "+s.dialect.placeholder(len(args)))
+	}
+	if !c.To.IsZero() {
+		args = append(args, c.To.UnixNano())
+		where = append(where, "scanned_at <= "+s.dialect.placeholder(len(args)))
+	}
+	if c.Fuzzy {
+		where = append(where, "fuzzy_hash <> ''")
+	}
+
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+func (s *sqlStore) SetLegalHold(ctx context.Context, c Criteria, hold bool) (int64, error) {
+	// Only entries whose flag changes count as updated
+	where, args := s.where(c)
+	value, current := "TRUE", "FALSE"
+	if !hold {
+		value, current = current, value
+	}
+	if where == "" {
+		where = " WHERE legal_hold = " + current
+	} else {
+		where += " AND legal_hold = " + current
+	}
+	res, err := s.db.ExecContext(ctx, "UPDATE scan_history SET legal_hold = "+value+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set legal hold on scan history: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) Prune(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM scan_history WHERE scanned_at < "+s.dialect.placeholder(1)+" AND legal_hold = FALSE", cutoff.UnixNano())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune scan history: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// likeEscaper escapes the LIKE wildcards and escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// placeholders returns n comma-separated bind parameters starting at the
+// first-th argument.
+func (s *sqlStore) placeholders(first, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = s.dialect.placeholder(first + i)
+	}
+	return strings.Join(ps, ", ")
+}
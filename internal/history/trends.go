@@ -0,0 +1,178 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// maxEmergingRules is the number of emerging rules reported.
+	maxEmergingRules = 10
+
+	// minEmergingHits is the number of hits in the window below which a rule
+	// is not reported as emerging, so single hits do not drown out campaigns.
+	minEmergingHits = 2
+)
+
+// Window is a trend reporting period divided into equal buckets.
+type Window struct {
+	Length time.Duration
+	Bucket time.Duration
+}
+
+// Windows are the supported trend periods by name.
+var Windows = map[string]Window{
+	"hour": {Length: time.Hour, Bucket: 5 * time.Minute},
+	"day":  {Length: 24 * time.Hour, Bucket: time.Hour},
+	"week": {Length: 7 * 24 * time.Hour, Bucket: 24 * time.Hour},
+}
+
+// WindowNames returns the names of the supported windows, sorted.
+func WindowNames() []string {
+	return slices.Sorted(maps.Keys(Windows))
+}
+
+// TrendReport describes scan activity over a window. Complaints counts the
+// feedback-loop complaints recorded in the window, which are not counted as
+// scans.
+type TrendReport struct {
+	Window        string         `json:"window"`
+	From          time.Time      `json:"from"`
+	To            time.Time      `json:"to"`
+	BucketSize    string         `json:"bucket_size"`
+	Scans         int            `json:"scans"`
+	Spam          int            `json:"spam"`
+	PreviousScans int            `json:"previous_scans"`
+	PreviousSpam  int            `json:"previous_spam"`
+	Complaints    int            `json:"complaints"`
+	Buckets       []Bucket       `json:"buckets"`
+	EmergingRules []EmergingRule `json:"emerging_rules"`
+}
+
+// Bucket is the scan activity in one interval of the window.
+type Bucket struct {
+	Start        time.Time `json:"start"`
+	Scans        int       `json:"scans"`
+	Spam         int       `json:"spam"`
+	AverageScore float64   `json:"average_score"`
+}
+
+// EmergingRule is a rule that matched a larger share of scans in the window
+// than in the window before it. Shares are the fraction of scans that hit
+// the rule.
+type EmergingRule struct {
+	Rule          string  `json:"rule"`
+	Hits          int     `json:"hits"`
+	PreviousHits  int     `json:"previous_hits"`
+	Share         float64 `json:"share"`
+	PreviousShare float64 `json:"previous_share"`
+	New           bool    `json:"new"`
+}
+
+// Trends reports the scans recorded in store over the named window ending
+// with the bucket that contains now. Emerging rules are found by comparing
+// the window with the one immediately before it.
+func Trends(ctx context.Context, store Store, name string, now time.Time) (*TrendReport, error) {
+	w, ok := Windows[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown window %q; use one of %v", name, WindowNames())
+	}
+
+	to := now.UTC().Truncate(w.Bucket).Add(w.Bucket)
+	from := to.Add(-w.Length)
+	previousFrom := from.Add(-w.Length)
+
+	report := &TrendReport{
+		Window:        name,
+		From:          from,
+		To:            to,
+		BucketSize:    w.Bucket.String(),
+		Buckets:       make([]Bucket, w.Length/w.Bucket),
+		EmergingRules: []EmergingRule{},
+	}
+	for i := range report.Buckets {
+		report.Buckets[i].Start = from.Add(time.Duration(i) * w.Bucket)
+	}
+
+	scores := make([]float64, len(report.Buckets))
+	hits := make(map[string]int)
+	previousHits := make(map[string]int)
+	err := store.Walk(ctx, Criteria{From: previousFrom, To: to}, func(e *Entry) error {
+		if !e.ScannedAt.Before(to) {
+			return nil
+		}
+		if e.Complaint {
+			if !e.ScannedAt.Before(from) {
+				report.Complaints++
+			}
+			return nil
+		}
+		if e.ScannedAt.Before(from) {
+			report.PreviousScans++
+			if e.IsSpam {
+				report.PreviousSpam++
+			}
+			for _, rule := range e.Rules {
+				previousHits[rule]++
+			}
+			return nil
+		}
+
+		i := int(e.ScannedAt.Sub(from) / w.Bucket)
+		b := &report.Buckets[i]
+		b.Scans++
+		if e.IsSpam {
+			b.Spam++
+			report.Spam++
+		}
+		report.Scans++
+		scores[i] += e.Score
+		for _, rule := range e.Rules {
+			hits[rule]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Buckets {
+		if n := report.Buckets[i].Scans; n > 0 {
+			report.Buckets[i].AverageScore = scores[i] / float64(n)
+		}
+	}
+
+	for rule, n := range hits {
+		if n < minEmergingHits {
+			continue
+		}
+		r := EmergingRule{
+			Rule:         rule,
+			Hits:         n,
+			PreviousHits: previousHits[rule],
+			Share:        float64(n) / float64(report.Scans),
+			New:          previousHits[rule] == 0,
+		}
+		if report.PreviousScans > 0 {
+			r.PreviousShare = float64(r.PreviousHits) / float64(report.PreviousScans)
+		}
+		if r.Share > r.PreviousShare {
+			report.EmergingRules = append(report.EmergingRules, r)
+		}
+	}
+	sort.Slice(report.EmergingRules, func(i, j int) bool {
+		a, b := report.EmergingRules[i], report.EmergingRules[j]
+		if da, db := a.Share-a.PreviousShare, b.Share-b.PreviousShare; da != db {
+			return da > db
+		}
+		return a.Rule < b.Rule
+	})
+	if len(report.EmergingRules) > maxEmergingRules {
+		report.EmergingRules = report.EmergingRules[:maxEmergingRules]
+	}
+	return report, nil
+}
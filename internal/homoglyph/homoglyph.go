@@ -0,0 +1,428 @@
+// Package homoglyph detects Unicode spoofing: text and domains written with
+// characters that look like others, so a reader sees a name or domain that
+// is not there.
+//
+// Every string is reduced to a skeleton, the form it takes once visually
+// confusable characters are replaced by the Latin letters they imitate,
+// combining marks and invisible characters are dropped and case is folded,
+// following the approach of Unicode Technical Standard #39. Two strings
+// with the same skeleton look alike. Analyze flags words and domain labels
+// that mix scripts beyond the combinations UTS #39 deems highly
+// restrictive, labels written entirely in a script that imitates Latin,
+// invisible and direction-control characters, and display names, subjects,
+// link texts and domains whose skeleton spells a protected brand or one of
+// its domains without being it.
+//
+// Security considerations:
+//   - Only the parsed message is inspected; nothing is resolved or fetched
+//   - The confusables table is a curated subset of the UTS #39 data
+//     covering the Cyrillic, Greek, Armenian and digit look-alikes of Latin
+//     letters used in practice
+package homoglyph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/unicode/norm"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/urls"
+)
+
+// Finding types.
+const (
+	MixedScript           = "mixed_script"
+	WholeScriptConfusable = "whole_script_confusable"
+	IDNHomograph          = "idn_homograph"
+	LookalikeDomain       = "lookalike_domain"
+	BrandHomograph        = "brand_homograph"
+	InvisibleCharacters   = "invisible_characters"
+)
+
+// Locations of the inspected strings.
+const (
+	FromName      = "from_name"
+	Subject       = "subject"
+	LinkText      = "link_text"
+	FromDomain    = "from_domain"
+	ReplyToDomain = "reply_to_domain"
+	URLHost       = "url"
+)
+
+// Severity is how strongly a finding suggests deliberate spoofing.
+type Severity string
+
+const (
+	High   Severity = "high"
+	Medium Severity = "medium"
+)
+
+// minTokenLength is the shortest brand name matched inside a domain label,
+// such as paypal in paypal-secure.com; shorter names only match whole
+// registrable domains, since they occur by chance in unrelated labels.
+const minTokenLength = 4
+
+// confusables maps characters to the Latin letters they are mistaken for.
+// Upper-case letters map to lower case, since skeletons are compared
+// case-insensitively, except that I maps to l, which it is indistinguishable
+// from in most fonts.
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'с': "c", 'ԁ': "d", 'е': "e", 'ё': "e", 'һ': "h", 'і': "i", 'ї': "i", 'ј': "j", 'ӏ': "l",
+	'о': "o", 'р': "p", 'ԛ': "q", 'ѕ': "s", 'у': "y", 'ԝ': "w", 'х': "x",
+	'А': "a", 'В': "b", 'С': "c", 'Е': "e", 'Н': "h", 'І': "l", 'Ј': "j", 'К': "k", 'М': "m", 'О': "o",
+	'Р': "p", 'Ѕ': "s", 'Т': "t", 'Х': "x", 'У': "y", 'Ԝ': "w", 'Ӏ': "l",
+	// Greek
+	'α': "a", 'η': "n", 'ι': "i", 'ν': "v", 'ο': "o", 'ρ': "p", 'υ': "u", 'γ': "y", 'ϲ': "c", 'ϳ': "j",
+	'Α': "a", 'Β': "b", 'Ε': "e", 'Ζ': "z", 'Η': "h", 'Ι': "l", 'Κ': "k", 'Μ': "m", 'Ν': "n", 'Ο': "o",
+	'Ρ': "p", 'Τ': "t", 'Υ': "y", 'Χ': "x", 'Ϲ': "c",
+	// Armenian
+	'օ': "o", 'ս': "u", 'ց': "g", 'հ': "h", 'ո': "n", 'զ': "q", 'ա': "w", 'Օ': "o", 'Տ': "s", 'Ս': "u",
+	// Latin look-alikes and digits
+	'ı': "i", 'ȷ': "j", 'ɩ': "i", 'ɑ': "a", 'ɡ': "g", 'I': "l", '0': "o", '1': "l", '|': "l",
+}
+
+// multiGlyphs are letter pairs that render like a single letter.
+var multiGlyphs = strings.NewReplacer("rn", "m", "vv", "w")
+
+// invisible are characters that render as nothing or change the direction
+// of the text around them.
+var invisible = map[rune]bool{
+	'\u00AD': true, '\u034F': true, '\u061C': true, '\u115F': true, '\u1160': true, '\u180E': true,
+	'\u200B': true, '\u200C': true, '\u200D': true, '\u200E': true, '\u200F': true,
+	'\u202A': true, '\u202B': true, '\u202C': true, '\u202D': true, '\u202E': true,
+	'\u2060': true, '\u2061': true, '\u2062': true, '\u2063': true, '\u2064': true,
+	'\u2066': true, '\u2067': true, '\u2068': true, '\u2069': true, '\u3164': true, '\uFEFF': true,
+}
+
+// restrictive are the script combinations UTS #39 allows in a highly
+// restrictive identifier besides a single script.
+var restrictive = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+// scripts lists the script tables in lookup order, the common scripts of
+// mail first.
+var scripts = func() []string {
+	names := []string{"Latin", "Cyrillic", "Greek", "Armenian", "Han", "Hiragana", "Katakana", "Hangul", "Arabic", "Hebrew"}
+	var rest []string
+	for name := range unicode.Scripts {
+		if !slices.Contains(names, name) && name != "Common" && name != "Inherited" {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}()
+
+// Skeleton returns the form of s used to compare strings for visual
+// confusion: compatibility decomposed, without combining marks and
+// invisible characters, with confusable characters replaced by the Latin
+// letters they imitate, lower-cased, and with letter pairs such as rn
+// replaced by the letter they resemble.
+func Skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(s) {
+		switch {
+		case invisible[r], unicode.Is(unicode.Mn, r):
+		case confusables[r] != "":
+			b.WriteString(confusables[r])
+		default:
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return multiGlyphs.Replace(b.String())
+}
+
+// Finding is one spoofing technique found in a message. Value is the text
+// or domain as written, ASCII the punycode form of a domain and Skeleton
+// the form it is mistaken for. Brand and Imitates name the protected brand
+// and domain a homograph imitates.
+type Finding struct {
+	Type     string   `json:"type"`
+	Severity Severity `json:"severity"`
+	Location string   `json:"location"`
+	Value    string   `json:"value"`
+	ASCII    string   `json:"ascii,omitempty"`
+	Skeleton string   `json:"skeleton,omitempty"`
+	Scripts  []string `json:"scripts,omitempty"`
+	Brand    string   `json:"brand,omitempty"`
+	Imitates string   `json:"imitates,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// Report is the homoglyph analysis of a message.
+type Report struct {
+	Findings []Finding `json:"findings"`
+	HighRisk int       `json:"high_risk"`
+	Brands   int       `json:"protected_brands"`
+}
+
+// brand is a protected brand with the skeletons it is compared by.
+type brand struct {
+	name     string
+	words    string
+	token    string
+	domains  []string
+	skeleton map[string]string
+}
+
+// Detector analyzes messages against a set of protected brands.
+type Detector struct {
+	brands []brand
+}
+
+// New returns a detector for the protected brands in cfg.
+func New(cfg config.HomoglyphConfig) *Detector {
+	d := &Detector{}
+	for _, pb := range cfg.ProtectedBrands {
+		b := brand{
+			name:     pb.Name,
+			words:    words(Skeleton(pb.Name)),
+			token:    Skeleton(strings.ReplaceAll(pb.Name, " ", "")),
+			skeleton: make(map[string]string, len(pb.Domains)),
+		}
+		for _, domain := range pb.Domains {
+			domain = strings.ToLower(domain)
+			b.domains = append(b.domains, domain)
+			unicodeForm, err := idna.Display.ToUnicode(domain)
+			if err != nil {
+				unicodeForm = domain
+			}
+			b.skeleton[Skeleton(unicodeForm)] = domain
+		}
+		d.brands = append(d.brands, b)
+	}
+	return d
+}
+
+// Analyze checks the sender display names, subject, link texts, sender and
+// Reply-To domains and URL hosts of e.
+func (d *Detector) Analyze(e *model.ParsedEmail) *Report {
+	a := &analysis{Detector: d, report: &Report{Findings: make([]Finding, 0), Brands: len(d.brands)}, seen: make(map[string]bool)}
+	for _, from := range e.From {
+		a.checkText(FromName, from.Name)
+		a.checkDomain(FromDomain, from.Domain())
+	}
+	a.checkText(Subject, e.Subject)
+	for _, replyTo := range e.ReplyTo {
+		a.checkDomain(ReplyToDomain, replyTo.Domain())
+	}
+	for _, u := range urls.Extract(e) {
+		a.checkText(LinkText, u.Text)
+		a.checkDomain(URLHost, u.Host)
+	}
+
+	for _, f := range a.report.Findings {
+		if f.Severity == High {
+			a.report.HighRisk++
+		}
+	}
+	return a.report
+}
+
+type analysis struct {
+	*Detector
+	report *Report
+	seen   map[string]bool
+}
+
+func (a *analysis) add(f Finding) {
+	key := f.Type + "\x00" + f.Location + "\x00" + f.Value + "\x00" + f.Brand
+	if a.seen[key] {
+		return
+	}
+	a.seen[key] = true
+	a.report.Findings = append(a.report.Findings, f)
+}
+
+// checkText flags invisible characters, mixed-script words and brand names
+// spelled with confusable characters in display text.
+func (a *analysis) checkText(location, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	if n := countInvisible(text); n > 0 {
+		a.add(Finding{Type: InvisibleCharacters, Severity: Medium, Location: location, Value: text, Skeleton: Skeleton(text),
+			Detail: fmt.Sprintf("%d invisible or direction-control characters", n)})
+	}
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) }) {
+		if s := scriptsOf(word); !allowedScripts(s) {
+			a.add(Finding{Type: MixedScript, Severity: Medium, Location: location, Value: word, Skeleton: Skeleton(word), Scripts: s,
+				Detail: fmt.Sprintf("word mixes scripts: %s", strings.Join(s, ", "))})
+		}
+	}
+	skeleton := " " + words(Skeleton(text)) + " "
+	plain := " " + words(strings.ToLower(norm.NFKC.String(text))) + " "
+	for _, b := range a.brands {
+		if b.words != "" && strings.Contains(skeleton, " "+b.words+" ") && !strings.Contains(plain, " "+strings.ToLower(b.name)+" ") {
+			a.add(Finding{Type: BrandHomograph, Severity: High, Location: location, Value: text, Skeleton: strings.TrimSpace(skeleton), Brand: b.name,
+				Detail: fmt.Sprintf("spells %s with look-alike characters", b.name)})
+		}
+	}
+}
+
+// checkDomain flags mixed-script and whole-script confusable labels of a
+// domain, and domains that look like a protected domain without being one.
+func (a *analysis) checkDomain(location, domain string) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if domain == "" {
+		return
+	}
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		ascii = domain
+	}
+	display, err := idna.Display.ToUnicode(ascii)
+	if err != nil {
+		display = domain
+	}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(ascii)
+	if err != nil {
+		registrable = ascii
+	}
+	for _, b := range a.brands {
+		for _, owned := range b.domains {
+			if ascii == owned || strings.HasSuffix(ascii, "."+owned) {
+				return
+			}
+		}
+	}
+	idn := isIDN(ascii)
+	asciiForm := ""
+	if idn {
+		asciiForm = ascii
+	}
+
+	for _, label := range strings.Split(display, ".") {
+		s := scriptsOf(label)
+		switch {
+		case !allowedScripts(s):
+			a.add(Finding{Type: MixedScript, Severity: High, Location: location, Value: display, ASCII: asciiForm, Skeleton: Skeleton(display), Scripts: s,
+				Detail: fmt.Sprintf("label %q mixes scripts: %s", label, strings.Join(s, ", "))})
+		case len(s) == 1 && s[0] != "Latin" && isASCIIName(Skeleton(label)):
+			a.add(Finding{Type: WholeScriptConfusable, Severity: High, Location: location, Value: display, ASCII: asciiForm, Skeleton: Skeleton(display), Scripts: s,
+				Detail: fmt.Sprintf("label %q is written in %s letters that read as Latin %q", label, s[0], Skeleton(label))})
+		}
+	}
+
+	registrableDisplay, err := idna.Display.ToUnicode(registrable)
+	if err != nil {
+		registrableDisplay = registrable
+	}
+	skeleton := Skeleton(registrableDisplay)
+	kind := LookalikeDomain
+	if idn {
+		kind = IDNHomograph
+	}
+	for _, b := range a.brands {
+		if imitated, ok := b.skeleton[skeleton]; ok {
+			a.add(Finding{Type: kind, Severity: High, Location: location, Value: display, ASCII: asciiForm, Skeleton: skeleton, Brand: b.name, Imitates: imitated,
+				Detail: fmt.Sprintf("%s looks like %s", registrableDisplay, imitated)})
+			continue
+		}
+		label, _, _ := strings.Cut(skeleton, ".")
+		plain, _, _ := strings.Cut(registrable, ".")
+		if len(b.token) >= minTokenLength && strings.Contains(label, b.token) && !strings.Contains(plain, b.token) {
+			a.add(Finding{Type: kind, Severity: High, Location: location, Value: display, ASCII: asciiForm, Skeleton: skeleton, Brand: b.name,
+				Detail: fmt.Sprintf("%s spells %s with look-alike characters", registrableDisplay, b.name)})
+		}
+	}
+}
+
+// scriptsOf returns the scripts of the letters in s, ignoring characters
+// common to all scripts such as digits and punctuation.
+func scriptsOf(s string) []string {
+	var found []string
+	for _, r := range s {
+		if name := scriptOf(r); name != "" && !slices.Contains(found, name) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+func scriptOf(r rune) string {
+	if r < 0x80 {
+		if unicode.IsLetter(r) {
+			return "Latin"
+		}
+		return ""
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for _, name := range scripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// allowedScripts reports whether a single word may use all of the scripts
+// s: one script, or a combination UTS #39 allows in highly restrictive
+// identifiers.
+func allowedScripts(s []string) bool {
+	if len(s) <= 1 {
+		return true
+	}
+	for _, set := range restrictive {
+		allowed := true
+		for _, name := range s {
+			if !slices.Contains(set, name) {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func countInvisible(s string) int {
+	n := 0
+	for _, r := range s {
+		if invisible[r] {
+			n++
+		}
+	}
+	return n
+}
+
+func isWordRune(r rune) bool {
+	return invisible[r] || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.M, r)
+}
+
+// words returns s with runs of characters other than letters and digits
+// collapsed to single spaces.
+func words(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }), " ")
+}
+
+// isASCIIName reports whether s consists of ASCII letters, digits and
+// hyphens only.
+func isASCIIName(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isIDN(ascii string) bool {
+	return strings.HasPrefix(ascii, "xn--") || strings.Contains(ascii, ".xn--")
+}
@@ -0,0 +1,341 @@
+// Package imap is a minimal read-only IMAP4rev1 client (RFC 3501) for
+// scanning the messages of a mailbox folder.
+//
+// The folder is opened with EXAMINE, which the server keeps read-only, and
+// messages are fetched with BODY.PEEK[], which leaves their \Seen flag
+// unset. The client has no commands that store flags or copy, move, append
+// or expunge messages.
+//
+// Security considerations:
+//   - The password is sent with LOGIN after the TLS handshake; configuration
+//     validation allows plain connections only to a loopback server
+//   - Response lines and literals are bounded in size, so a hostile server
+//     cannot exhaust memory
+package imap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// TLS modes of config.IMAPConfig.
+const (
+	TLSImplicit = "implicit"
+	TLSStartTLS = "starttls"
+	TLSNone     = "none"
+)
+
+// maxLineLength bounds a response line, and the literals of responses
+// other than message bodies.
+const maxLineLength = 1 << 20
+
+var (
+	literalRegex = regexp.MustCompile(`\{(\d+)\}$`)
+	uidRegex     = regexp.MustCompile(`(?i)\bUID (\d+)`)
+	sizeRegex    = regexp.MustCompile(`(?i)\bRFC822\.SIZE (\d+)`)
+	existsRegex  = regexp.MustCompile(`(?i)^\* (\d+) EXISTS$`)
+)
+
+// Client is a connection to an IMAP server, logged in. It is not safe for
+// concurrent use.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	tag     int
+	timeout time.Duration
+}
+
+// response is one server response. Literals are read into literals; text
+// keeps their {n} markers.
+type response struct {
+	text     string
+	literals []string
+}
+
+// Dial connects to the server in cfg and logs in.
+func Dial(ctx context.Context, cfg config.IMAPConfig) (*Client, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IMAP address: %w", err)
+	}
+	tlsConfig, err := clientTLSConfig(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	var conn net.Conn
+	if cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", cfg.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", cfg.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("IMAP connection failed: %w", err)
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: cfg.Timeout}
+
+	if err := c.greeting(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.TLS == TLSStartTLS {
+		if _, err := c.command("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("IMAP TLS handshake failed: %w", err)
+		}
+		c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	username, err := quote(cfg.Username)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid IMAP username: %w", err)
+	}
+	password, err := quote(cfg.Password)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid IMAP password: %w", err)
+	}
+	if _, err := c.command("LOGIN " + username + " " + password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func clientTLSConfig(cfg config.IMAPConfig, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IMAP CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("IMAP CA file %s holds no certificates", cfg.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (c *Client) greeting() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	resp, err := c.readResponse(maxLineLength)
+	if err != nil {
+		return fmt.Errorf("IMAP greeting failed: %w", err)
+	}
+	if fields := strings.Fields(resp.text); len(fields) < 2 || fields[0] != "*" || !strings.EqualFold(fields[1], "OK") {
+		return fmt.Errorf("IMAP server refused the connection: %s", resp.text)
+	}
+	return nil
+}
+
+// Close logs out and closes the connection.
+func (c *Client) Close() error {
+	c.command("LOGOUT")
+	return c.conn.Close()
+}
+
+// Examine opens folder read-only and returns the number of messages in it.
+func (c *Client) Examine(folder string) (int, error) {
+	name, err := quote(folder)
+	if err != nil {
+		return 0, fmt.Errorf("invalid folder name: %w", err)
+	}
+	resps, err := c.command("EXAMINE " + name)
+	if err != nil {
+		return 0, err
+	}
+	for _, resp := range resps {
+		if m := existsRegex.FindStringSubmatch(resp.text); m != nil {
+			return strconv.Atoi(m[1])
+		}
+	}
+	return 0, nil
+}
+
+// Search returns the UIDs of the messages in the open folder, in ascending
+// order. A non-zero since restricts them to messages whose internal date,
+// when the server received them, is on or after that day.
+func (c *Client) Search(since time.Time) ([]uint32, error) {
+	criteria := "ALL"
+	if !since.IsZero() {
+		criteria = "SINCE " + since.Format("2-Jan-2006")
+	}
+	resps, err := c.command("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]uint32, 0)
+	for _, resp := range resps {
+		fields := strings.Fields(resp.text)
+		if len(fields) < 2 || !strings.EqualFold(fields[1], "SEARCH") {
+			continue
+		}
+		for _, field := range fields[2:] {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	slices.Sort(uids)
+	return uids, nil
+}
+
+// Sizes returns the size in bytes of the messages with the given UIDs.
+// Messages deleted meanwhile are missing from the result.
+func (c *Client) Sizes(uids []uint32) (map[uint32]int64, error) {
+	sizes := make(map[uint32]int64, len(uids))
+	if len(uids) == 0 {
+		return sizes, nil
+	}
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+	resps, err := c.command("UID FETCH " + strings.Join(set, ",") + " (UID RFC822.SIZE)")
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range resps {
+		uid, size := uidRegex.FindStringSubmatch(resp.text), sizeRegex.FindStringSubmatch(resp.text)
+		if uid == nil || size == nil {
+			continue
+		}
+		u, err1 := strconv.ParseUint(uid[1], 10, 32)
+		n, err2 := strconv.ParseInt(size[1], 10, 64)
+		if err1 == nil && err2 == nil {
+			sizes[uint32(u)] = n
+		}
+	}
+	return sizes, nil
+}
+
+// Fetch returns the full content of the message with the given UID without
+// marking it seen. Messages larger than maxSize are rejected.
+func (c *Client) Fetch(uid uint32, maxSize int64) (string, error) {
+	resps, err := c.do(maxSize, fmt.Sprintf("UID FETCH %d (UID BODY.PEEK[])", uid))
+	if err != nil {
+		return "", err
+	}
+	for _, resp := range resps {
+		m := uidRegex.FindStringSubmatch(resp.text)
+		if m == nil || m[1] != strconv.FormatUint(uint64(uid), 10) || len(resp.literals) == 0 {
+			continue
+		}
+		return resp.literals[0], nil
+	}
+	return "", fmt.Errorf("message %d no longer exists", uid)
+}
+
+func (c *Client) command(cmd string) ([]*response, error) {
+	return c.do(maxLineLength, cmd)
+}
+
+// do sends cmd and returns the untagged responses to it, or an error when
+// the server does not complete it with OK. Literals larger than limit are
+// rejected.
+func (c *Client) do(limit int64, cmd string) ([]*response, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%03d", c.tag)
+	// Errors name the command without its arguments, which for LOGIN
+	// include the password.
+	fields := strings.Fields(cmd)
+	verb := fields[0]
+	if verb == "UID" && len(fields) > 1 {
+		verb += " " + fields[1]
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(c.conn, tag+" "+cmd+"\r\n"); err != nil {
+		return nil, fmt.Errorf("IMAP %s failed: %w", verb, err)
+	}
+	var untagged []*response
+	for {
+		resp, err := c.readResponse(limit)
+		if err != nil {
+			return nil, fmt.Errorf("IMAP %s failed: %w", verb, err)
+		}
+		if rest, ok := strings.CutPrefix(resp.text, tag+" "); ok {
+			status, text, _ := strings.Cut(rest, " ")
+			if !strings.EqualFold(status, "OK") {
+				return nil, fmt.Errorf("IMAP %s failed: %s %s", verb, strings.ToUpper(status), text)
+			}
+			return untagged, nil
+		}
+		if strings.HasPrefix(resp.text, "* ") {
+			untagged = append(untagged, resp)
+		}
+	}
+}
+
+// readResponse reads one response line and the literals it announces.
+func (c *Client) readResponse(limit int64) (*response, error) {
+	resp := &response{}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		resp.text += line
+		m := literalRegex.FindStringSubmatch(line)
+		if m == nil {
+			return resp, nil
+		}
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil || n > limit {
+			return nil, fmt.Errorf("literal of %s bytes exceeds the limit of %d bytes", m[1], limit)
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return nil, err
+		}
+		resp.literals = append(resp.literals, string(literal))
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return "", fmt.Errorf("response line exceeds %d bytes", maxLineLength)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", errors.New("must not contain line breaks or NUL")
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`, nil
+}
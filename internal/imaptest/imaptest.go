@@ -0,0 +1,307 @@
+// Package imaptest provides a scriptable in-process IMAP server for tests.
+//
+// The server speaks enough IMAP4rev1 over TCP on a loopback port for the
+// imap client to be exercised end to end: LOGIN, EXAMINE, SELECT, UID
+// SEARCH (ALL or SINCE), UID FETCH and LOGOUT on a single INBOX folder.
+// Fetching BODY[] rather than BODY.PEEK[] sets a message's \Seen flag, and
+// every command is recorded, so tests can check that a client leaves the
+// mailbox untouched.
+//
+// Typical use:
+//
+//	srv := imaptest.NewServer("scanner", "secret")
+//	defer srv.Close()
+//	srv.AddMessage(raw, time.Now())
+//	client, err := imap.Dial(ctx, srv.Config())
+package imaptest
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Folder is the only folder the server has.
+const Folder = "INBOX"
+
+type message struct {
+	content  string
+	received time.Time
+	seen     bool
+}
+
+// Server is a fake IMAP server.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+	username string
+	password string
+
+	mu       sync.Mutex
+	messages []*message
+	commands []string
+}
+
+// NewServer starts a fake IMAP server on a loopback port accepting the given
+// credentials. It panics if no port can be allocated, like
+// net/http/httptest.
+func NewServer(username, password string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("imaptest: failed to listen: %v", err))
+	}
+	s := &Server{listener: ln, username: username, password: password}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Config returns a plain-text IMAP configuration pointing at the server.
+func (s *Server) Config() config.IMAPConfig {
+	return config.IMAPConfig{
+		Addr:        s.listener.Addr().String(),
+		TLS:         "none",
+		Username:    s.username,
+		Password:    s.password,
+		Folder:      Folder,
+		Timeout:     5 * time.Second,
+		MaxMessages: 100,
+	}
+}
+
+// AddMessage appends a message received at the given time and returns its
+// UID. UIDs are assigned from 1 in the order messages are added.
+func (s *Server) AddMessage(content string, received time.Time) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, &message{content: content, received: received})
+	return uint32(len(s.messages))
+}
+
+// Seen reports whether the message with the given UID has the \Seen flag.
+func (s *Server) Seen(uid uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return uid > 0 && int(uid) <= len(s.messages) && s.messages[uid-1].seen
+}
+
+// Commands returns the commands received so far, without their tags. The
+// arguments of LOGIN are masked.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops the server and waits for in-flight connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "* OK [CAPABILITY IMAP4rev1] imaptest ready\r\n")
+	w.Flush()
+
+	loggedIn, selected := false, false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		args := tokenize(cmd)
+		if len(args) == 0 {
+			fmt.Fprintf(w, "%s BAD empty command\r\n", tag)
+			w.Flush()
+			continue
+		}
+		verb := strings.ToUpper(args[0])
+		if verb == "UID" && len(args) > 1 {
+			verb += " " + strings.ToUpper(args[1])
+			args = args[1:]
+		}
+		args = args[1:]
+
+		s.mu.Lock()
+		if verb == "LOGIN" {
+			s.commands = append(s.commands, "LOGIN ***")
+		} else {
+			s.commands = append(s.commands, cmd)
+		}
+		s.mu.Unlock()
+
+		switch {
+		case verb == "LOGOUT":
+			fmt.Fprintf(w, "* BYE imaptest logging out\r\n%s OK LOGOUT completed\r\n", tag)
+			w.Flush()
+			return
+		case verb == "CAPABILITY":
+			fmt.Fprintf(w, "* CAPABILITY IMAP4rev1\r\n%s OK CAPABILITY completed\r\n", tag)
+		case verb == "NOOP":
+			fmt.Fprintf(w, "%s OK NOOP completed\r\n", tag)
+		case verb == "LOGIN":
+			if len(args) == 2 && args[0] == s.username && args[1] == s.password {
+				loggedIn = true
+				fmt.Fprintf(w, "%s OK LOGIN completed\r\n", tag)
+			} else {
+				fmt.Fprintf(w, "%s NO [AUTHENTICATIONFAILED] Invalid credentials\r\n", tag)
+			}
+		case !loggedIn:
+			fmt.Fprintf(w, "%s NO not logged in\r\n", tag)
+		case verb == "EXAMINE" || verb == "SELECT":
+			if len(args) != 1 || !strings.EqualFold(args[0], Folder) {
+				selected = false
+				fmt.Fprintf(w, "%s NO [NONEXISTENT] no such folder\r\n", tag)
+				break
+			}
+			selected = true
+			mode := "READ-ONLY"
+			if verb == "SELECT" {
+				mode = "READ-WRITE"
+			}
+			s.mu.Lock()
+			fmt.Fprintf(w, "* %d EXISTS\r\n* 0 RECENT\r\n* OK [UIDVALIDITY 1] UIDs valid\r\n%s OK [%s] %s completed\r\n", len(s.messages), tag, mode, verb)
+			s.mu.Unlock()
+		case !selected:
+			fmt.Fprintf(w, "%s NO no folder selected\r\n", tag)
+		case verb == "UID SEARCH":
+			uids, err := s.search(args)
+			if err != nil {
+				fmt.Fprintf(w, "%s BAD %v\r\n", tag, err)
+				break
+			}
+			fmt.Fprintf(w, "* SEARCH%s\r\n%s OK SEARCH completed\r\n", uids, tag)
+		case verb == "UID FETCH":
+			if len(args) < 2 {
+				fmt.Fprintf(w, "%s BAD missing arguments\r\n", tag)
+				break
+			}
+			s.fetch(w, args[0], strings.ToUpper(strings.Join(args[1:], " ")))
+			fmt.Fprintf(w, "%s OK FETCH completed\r\n", tag)
+		default:
+			fmt.Fprintf(w, "%s BAD unsupported command\r\n", tag)
+		}
+		w.Flush()
+	}
+}
+
+// search returns the matching UIDs, each preceded by a space.
+func (s *Server) search(args []string) (string, error) {
+	var since time.Time
+	switch {
+	case len(args) == 1 && strings.EqualFold(args[0], "ALL"):
+	case len(args) == 2 && strings.EqualFold(args[0], "SINCE"):
+		t, err := time.Parse("2-Jan-2006", args[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q", args[1])
+		}
+		since = t
+	default:
+		return "", fmt.Errorf("unsupported search criteria")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for i, m := range s.messages {
+		day := time.Date(m.received.Year(), m.received.Month(), m.received.Day(), 0, 0, 0, 0, time.UTC)
+		if !day.Before(since) {
+			fmt.Fprintf(&b, " %d", i+1)
+		}
+	}
+	return b.String(), nil
+}
+
+// fetch writes a FETCH response for every existing message in set, a
+// comma-separated list of UIDs and UID ranges.
+func (s *Server) fetch(w *bufio.Writer, set, items string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, part := range strings.Split(set, ",") {
+		lo, hi, isRange := strings.Cut(part, ":")
+		first, _ := strconv.Atoi(lo)
+		last := first
+		if isRange {
+			if hi == "*" {
+				last = len(s.messages)
+			} else {
+				last, _ = strconv.Atoi(hi)
+			}
+		}
+		for uid := max(first, 1); uid <= min(last, len(s.messages)); uid++ {
+			m := s.messages[uid-1]
+			fmt.Fprintf(w, "* %d FETCH (UID %d", uid, uid)
+			if strings.Contains(items, "RFC822.SIZE") {
+				fmt.Fprintf(w, " RFC822.SIZE %d", len(m.content))
+			}
+			if strings.Contains(items, "BODY[]") || strings.Contains(items, "BODY.PEEK[]") {
+				fmt.Fprintf(w, " BODY[] {%d}\r\n%s", len(m.content), m.content)
+				if !strings.Contains(items, "BODY.PEEK[]") {
+					m.seen = true
+				}
+			}
+			w.WriteString(")\r\n")
+		}
+	}
+}
+
+// tokenize splits a command into atoms and quoted strings, unquoting the
+// latter.
+func tokenize(cmd string) []string {
+	var tokens []string
+	for i := 0; i < len(cmd); {
+		switch {
+		case cmd[i] == ' ':
+			i++
+		case cmd[i] == '"':
+			var b strings.Builder
+			for i++; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) {
+					i++
+				}
+				b.WriteByte(cmd[i])
+			}
+			tokens = append(tokens, b.String())
+			i++
+		default:
+			end := i
+			depth := 0
+			for ; end < len(cmd) && (cmd[end] != ' ' || depth > 0); end++ {
+				switch cmd[end] {
+				case '(', '[':
+					depth++
+				case ')', ']':
+					depth--
+				}
+			}
+			tokens = append(tokens, cmd[i:end])
+			i = end
+		}
+	}
+	return tokens
+}
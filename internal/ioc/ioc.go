@@ -0,0 +1,183 @@
+// Package ioc collects the indicators of compromise of a message.
+//
+// Extract gathers the network and file observables an analyst would hand to
+// a SOC platform: the originating and linked IP addresses, the domains of
+// links and sender identities, the URLs, the sender and in-body email
+// addresses, and the hashes of attachments. Each indicator records where in
+// the message it was found. Recipient addresses are left out, as they
+// identify the victim rather than the attacker. Bundle renders the set as a
+// STIX 2.1 bundle.
+//
+// Extraction reuses the header forensics, URL and attachment analyses and
+// makes no network queries.
+package ioc
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/attachments"
+	"spamassassin-mcp/internal/forensics"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/urls"
+)
+
+// Sources of an indicator.
+const (
+	SourceOrigin     = "originating_ip"
+	SourceURL        = "url"
+	SourceBody       = "body"
+	SourceFrom       = "from"
+	SourceReplyTo    = "reply_to"
+	SourceReturnPath = "return_path"
+)
+
+// MaxIndicators is the maximum number of indicators reported per kind.
+const MaxIndicators = 200
+
+var (
+	ipv4Regex  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	emailRegex = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+
+	// refanger undoes the defanging of addresses pasted into reports.
+	refanger = strings.NewReplacer("[.]", ".", "(.)", ".", "[@]", "@", "[at]", "@")
+)
+
+// Indicator is one observable and the places it was found.
+type Indicator struct {
+	Value   string   `json:"value"`
+	Sources []string `json:"sources"`
+}
+
+// File is an attachment identified by its hashes.
+type File struct {
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5"`
+}
+
+// Set is the indicators of a message, each kind in order of first
+// appearance.
+type Set struct {
+	IPs            []*Indicator `json:"ips"`
+	Domains        []*Indicator `json:"domains"`
+	URLs           []*Indicator `json:"urls"`
+	EmailAddresses []*Indicator `json:"email_addresses"`
+	Files          []File       `json:"files"`
+}
+
+// Count returns the total number of indicators.
+func (s *Set) Count() int {
+	return len(s.IPs) + len(s.Domains) + len(s.URLs) + len(s.EmailAddresses) + len(s.Files)
+}
+
+// Extract returns the indicators of email.
+func Extract(email *model.ParsedEmail) *Set {
+	ips, domains, links, addrs := newList(), newList(), newList(), newList()
+
+	victims := make(map[string]bool)
+	for _, a := range append(append([]model.Address{}, email.To...), email.Cc...) {
+		victims[strings.ToLower(a.Address)] = true
+	}
+	addAddress := func(addr, source string) {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		at := strings.LastIndex(addr, "@")
+		if at <= 0 || victims[addr] {
+			return
+		}
+		addrs.add(addr, source)
+		domains.add(addr[at+1:], source)
+	}
+
+	report := forensics.Analyze(context.Background(), nil, email, time.Now())
+	if report.OriginatingIP != "" {
+		ips.add(report.OriginatingIP, SourceOrigin)
+	}
+
+	for _, a := range email.From {
+		addAddress(a.Address, SourceFrom)
+	}
+	for _, a := range email.ReplyTo {
+		addAddress(a.Address, SourceReplyTo)
+	}
+	addAddress(email.ReturnPath, SourceReturnPath)
+
+	for _, u := range urls.Extract(email) {
+		links.add(u.URL, SourceURL)
+		if ip := net.ParseIP(strings.Trim(u.Host, "[]")); ip != nil {
+			if isPublic(ip) {
+				ips.add(ip.String(), SourceURL)
+			}
+		} else if u.Host != "" {
+			domains.add(u.Host, SourceURL)
+		}
+	}
+
+	body := refanger.Replace(email.TextBody() + "\n" + email.HTMLBody())
+	for _, m := range ipv4Regex.FindAllString(body, -1) {
+		if ip := net.ParseIP(m); ip != nil && isPublic(ip) {
+			ips.add(ip.String(), SourceBody)
+		}
+	}
+	for _, m := range emailRegex.FindAllString(body, -1) {
+		addAddress(m, SourceBody)
+	}
+
+	files := make([]File, 0)
+	for _, a := range attachments.Analyze(email) {
+		files = append(files, File{
+			Name:   a.Filename,
+			Type:   a.DetectedType,
+			Size:   a.Size,
+			SHA256: a.SHA256,
+			MD5:    a.MD5,
+		})
+	}
+
+	return &Set{
+		IPs:            ips.items,
+		Domains:        domains.items,
+		URLs:           links.items,
+		EmailAddresses: addrs.items,
+		Files:          files,
+	}
+}
+
+// list is an ordered set of indicators of one kind.
+type list struct {
+	items []*Indicator
+	index map[string]*Indicator
+}
+
+func newList() *list {
+	return &list{items: make([]*Indicator, 0), index: make(map[string]*Indicator)}
+}
+
+func (l *list) add(value, source string) {
+	value = strings.TrimSuffix(value, ".")
+	key := strings.ToLower(value)
+	if ind, ok := l.index[key]; ok {
+		if !slices.Contains(ind.Sources, source) {
+			ind.Sources = append(ind.Sources, source)
+		}
+		return
+	}
+	if len(l.items) >= MaxIndicators {
+		return
+	}
+	ind := &Indicator{Value: value, Sources: []string{source}}
+	l.index[key] = ind
+	l.items = append(l.items, ind)
+}
+
+// isPublic reports whether ip is a globally routable unicast address.
+func isPublic(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast())
+}
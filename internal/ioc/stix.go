@@ -0,0 +1,118 @@
+package ioc
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// STIXTime is the timestamp format of STIX 2.1: UTC with millisecond
+// precision.
+const STIXTime = "2006-01-02T15:04:05.000Z"
+
+// Bundle is a STIX 2.1 bundle of indicator objects.
+type Bundle struct {
+	Type    string           `json:"type"`
+	ID      string           `json:"id"`
+	Objects []*STIXIndicator `json:"objects"`
+}
+
+// STIXIndicator is a STIX 2.1 indicator object.
+type STIXIndicator struct {
+	Type           string   `json:"type"`
+	SpecVersion    string   `json:"spec_version"`
+	ID             string   `json:"id"`
+	Created        string   `json:"created"`
+	Modified       string   `json:"modified"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	IndicatorTypes []string `json:"indicator_types,omitempty"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+	Confidence     int      `json:"confidence,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+}
+
+// Bundle renders the set as a STIX 2.1 bundle with one indicator per
+// observable, valid from now. subject identifies the message in the
+// indicator descriptions.
+func (s *Set) Bundle(subject string, now time.Time) *Bundle {
+	ts := now.UTC().Format(STIXTime)
+	b := &Bundle{
+		Type:    "bundle",
+		ID:      "bundle--" + uuid.NewString(),
+		Objects: make([]*STIXIndicator, 0, s.Count()),
+	}
+	add := func(name, pattern string, sources []string) {
+		description := "Observed in " + subject
+		if len(sources) > 0 {
+			description += " (" + strings.Join(sources, ", ") + ")"
+		}
+		b.Objects = append(b.Objects, &STIXIndicator{
+			Type:        "indicator",
+			SpecVersion: "2.1",
+			ID:          "indicator--" + uuid.NewString(),
+			Created:     ts,
+			Modified:    ts,
+			Name:        name,
+			Description: description,
+			Pattern:     pattern,
+			PatternType: "stix",
+			ValidFrom:   ts,
+		})
+	}
+
+	for _, ind := range s.IPs {
+		kind := "ipv4-addr"
+		if ip := net.ParseIP(ind.Value); ip != nil && ip.To4() == nil {
+			kind = "ipv6-addr"
+		}
+		add("IP address "+ind.Value, comparison(kind+":value", ind.Value), ind.Sources)
+	}
+	for _, ind := range s.Domains {
+		add("Domain "+ind.Value, DomainPattern(ind.Value), ind.Sources)
+	}
+	for _, ind := range s.URLs {
+		add("URL "+ind.Value, URLPattern(ind.Value), ind.Sources)
+	}
+	for _, ind := range s.EmailAddresses {
+		add("Email address "+ind.Value, comparison("email-addr:value", ind.Value), ind.Sources)
+	}
+	for _, f := range s.Files {
+		name := "Attachment " + f.SHA256
+		if f.Name != "" {
+			name = "Attachment " + f.Name
+		}
+		add(name, FilePattern(f.SHA256, f.MD5), nil)
+	}
+	return b
+}
+
+// DomainPattern returns the STIX pattern matching a domain name.
+func DomainPattern(domain string) string {
+	return comparison("domain-name:value", domain)
+}
+
+// URLPattern returns the STIX pattern matching a URL.
+func URLPattern(u string) string {
+	return comparison("url:value", u)
+}
+
+// FilePattern returns the STIX pattern matching a file by its hashes.
+func FilePattern(sha256, md5 string) string {
+	return fmt.Sprintf("[file:hashes.'SHA-256' = %s OR file:hashes.MD5 = %s]", quote(sha256), quote(md5))
+}
+
+// comparison returns a single-comparison STIX pattern.
+func comparison(path, value string) string {
+	return "[" + path + " = " + quote(value) + "]"
+}
+
+// quote returns value as a STIX pattern string literal.
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,288 @@
+// Package jobs runs long-running work asynchronously on a bounded worker pool.
+//
+// Jobs are identified by a random ID returned at submission time; callers
+// poll for the outcome with Get. Finished jobs are retained for a configurable
+// TTL and then discarded, so results never accumulate without bound.
+//
+// Security considerations:
+//   - The pending queue is bounded; submissions beyond it are rejected
+//   - Job IDs are unguessable random values, and jobs record the client
+//     that submitted them so callers can keep clients apart
+//   - Results are kept in memory only and expire automatically
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Status is the lifecycle state of a job.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+var (
+	// ErrQueueFull is returned when the pending queue has no capacity left.
+	ErrQueueFull = errors.New("job queue is full")
+
+	// ErrNotFound is returned for unknown or expired job IDs.
+	ErrNotFound = errors.New("job not found or expired")
+
+	// ErrClosed is returned when submitting to a closed manager.
+	ErrClosed = errors.New("job manager is closed")
+)
+
+// Func is the work performed by a job.
+type Func func(ctx context.Context) (any, error)
+
+// Job is a snapshot of an asynchronous job.
+type Job struct {
+	ID          string     `json:"id"`
+	Kind        string     `json:"kind"`
+	Owner       string     `json:"owner,omitempty"`
+	Status      Status     `json:"status"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Result      any        `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+type task struct {
+	job *Job
+	fn  Func
+}
+
+// Manager owns the job table and worker pool.
+type Manager struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	queue  chan task
+	ttl    time.Duration
+	closed bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewManager starts a manager with the given number of workers, queue
+// capacity, and retention time for finished jobs.
+func NewManager(workers, queueSize int, ttl time.Duration) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		jobs:   make(map[string]*Job),
+		queue:  make(chan task, queueSize),
+		ttl:    ttl,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	return m
+}
+
+// Submit queues fn for asynchronous execution on behalf of owner and returns
+// the pending job.
+func (m *Manager) Submit(kind, owner string, fn Func) (*Job, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:          id,
+		Kind:        kind,
+		Owner:       owner,
+		Status:      StatusPending,
+		SubmittedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	m.pruneLocked()
+
+	select {
+	case m.queue <- task{job: job, fn: fn}:
+	default:
+		return nil, ErrQueueFull
+	}
+	m.jobs[id] = job
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneLocked()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	snapshot := *job
+	return &snapshot, nil
+}
+
+// List returns snapshots of the retained jobs of the given kind submitted by
+// owner, in no particular order.
+func (m *Manager) List(kind, owner string) []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pruneLocked()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if job.Kind != kind || job.Owner != owner {
+			continue
+		}
+		snapshot := *job
+		jobs = append(jobs, &snapshot)
+	}
+	return jobs
+}
+
+// Close stops accepting jobs, cancels running work, and waits for workers to exit.
+func (m *Manager) Close() {
+	m.stop()
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Shutdown stops accepting jobs and waits for queued and running jobs to
+// finish. If ctx is done first, remaining work is cancelled as by Close and
+// ctx's error is returned.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stop()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		m.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// stop rejects further submissions and lets workers exit once the queue is empty.
+func (m *Manager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+
+	for t := range m.queue {
+		m.update(t.job, func(j *Job) {
+			now := time.Now()
+			j.Status = StatusRunning
+			j.StartedAt = &now
+		})
+
+		result, err := m.run(t)
+
+		m.update(t.job, func(j *Job) {
+			now := time.Now()
+			j.CompletedAt = &now
+			if err != nil {
+				j.Status = StatusFailed
+				j.Error = err.Error()
+				return
+			}
+			j.Status = StatusCompleted
+			j.Result = result
+		})
+	}
+}
+
+// run executes a task, converting panics into job failures so a bad job
+// cannot take down the worker pool.
+func (m *Manager) run(t task) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithFields(logrus.Fields{
+				"job_id": t.job.ID,
+				"kind":   t.job.Kind,
+				"panic":  r,
+			}).Error("Job panicked")
+			err = errors.New("internal error while processing job")
+		}
+	}()
+
+	if m.ctx.Err() != nil {
+		return nil, m.ctx.Err()
+	}
+	return t.fn(m.ctx)
+}
+
+func (m *Manager) update(job *Job, fn func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(job)
+}
+
+// pruneLocked drops finished jobs older than the TTL. m.mu must be held.
+func (m *Manager) pruneLocked() {
+	if m.ttl <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-m.ttl)
+	for id, job := range m.jobs {
+		if job.CompletedAt != nil && job.CompletedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,353 @@
+// Package listquery implements the shared pagination, filtering and sorting
+// layer used by every list-returning tool.
+//
+// Tools take Query as their parameters, describe their item type once with a
+// Schema, and call Apply. Tools whose items live in a database instead ask
+// the Schema for the Window a query selects, read that window themselves and
+// build the result with NewPage. Tool-specific criteria are expressed as filter
+// fields rather than extra parameters. Clients therefore see identical semantics everywhere:
+//   - filter: map of field name to value; matching is exact and
+//     case-insensitive, and comma-separated values match any of them.
+//     Timestamp fields also accept <field>_from and <field>_to filters, which
+//     bound the field inclusively (RFC 3339 values)
+//   - sort: a field name, prefixed with "-" for descending order
+//   - cursor/limit: opaque cursor pagination over a stable ordering; ties are
+//     broken by the item key so pages never overlap or skip items
+//
+// Cursors are bound to the filter and sort they were issued for; reusing a
+// cursor with a different query is rejected rather than silently returning
+// an inconsistent page.
+package listquery
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the page size used when a query does not set one.
+	DefaultLimit = 50
+
+	// MaxLimit is the largest page size a client may request.
+	MaxLimit = 500
+)
+
+// ErrInvalidCursor is returned for malformed cursors or cursors issued for a
+// different query.
+var ErrInvalidCursor = errors.New("invalid or expired cursor")
+
+// Query is the common list request shape and the parameter type of every
+// list tool.
+type Query struct {
+	Cursor string            `json:"cursor,omitempty" description:"Opaque cursor returned as next_cursor by a previous page"`
+	Limit  int               `json:"limit,omitempty" description:"Maximum items per page (default 50, max 500)"`
+	Filter map[string]string `json:"filter,omitempty" description:"Field filters; case-insensitive exact match, comma-separated values match any; timestamp fields also accept <field>_from and <field>_to (RFC 3339, inclusive)"`
+	Sort   string            `json:"sort,omitempty" description:"Sort field; prefix with - for descending order"`
+}
+
+// Page is one page of list results.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Total      int    `json:"total"`
+}
+
+// Field describes how a list item field can be filtered and sorted. Any
+// function may be nil if the field does not support that operation.
+type Field[T any] struct {
+	Value   func(T) string
+	Compare func(a, b T) int
+
+	// Bound parses a value of the <field>_from/<field>_to filters and returns
+	// a function comparing an item's field against it.
+	Bound func(value string) (func(T) int, error)
+}
+
+// Range filter suffixes for fields with a Bound.
+const (
+	fromSuffix = "_from"
+	toSuffix   = "_to"
+)
+
+// String returns a field that is both filterable and sortable by a string value.
+func String[T any](get func(T) string) Field[T] {
+	return Field[T]{
+		Value:   get,
+		Compare: func(a, b T) int { return strings.Compare(get(a), get(b)) },
+	}
+}
+
+// Number returns a sortable numeric field.
+func Number[T any, N cmp.Ordered](get func(T) N) Field[T] {
+	return Field[T]{
+		Compare: func(a, b T) int { return cmp.Compare(get(a), get(b)) },
+	}
+}
+
+// Time returns a sortable timestamp field that supports range filters.
+func Time[T any](get func(T) time.Time) Field[T] {
+	return Field[T]{
+		Compare: func(a, b T) int { return get(a).Compare(get(b)) },
+		Bound: func(value string) (func(T) int, error) {
+			bound, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("expected an RFC 3339 timestamp")
+			}
+			return func(item T) int { return get(item).Compare(bound) }, nil
+		},
+	}
+}
+
+// Schema describes the list item type of one tool.
+type Schema[T any] struct {
+	// Fields maps client-visible field names to their accessors.
+	Fields map[string]Field[T]
+
+	// Key returns a unique identifier used as the final tie-breaker.
+	Key func(T) string
+
+	// DefaultSort is applied when the query does not specify a sort.
+	DefaultSort string
+}
+
+// Apply filters, sorts and paginates items according to q. The input slice
+// is not modified.
+func Apply[T any](items []T, q Query, s Schema[T]) (*Page[T], error) {
+	w, err := s.Window(q)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered, err := filter(items, q.Filter, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := sortItems(filtered, w.Sort, s); err != nil {
+		return nil, err
+	}
+	if w.Offset > len(filtered) {
+		return nil, ErrInvalidCursor
+	}
+
+	end := min(w.Offset+w.Limit, len(filtered))
+	return NewPage(filtered[w.Offset:end], len(filtered), w), nil
+}
+
+// Window is the part of a list a query selects: the items at Offset, up to
+// Limit of them, once the query's filters are applied and the items are
+// ordered by Sort, ties broken by ascending item key.
+type Window struct {
+	// Sort is the query's sort key, or the schema's default.
+	Sort   string
+	Offset int
+	Limit  int
+
+	fingerprint string
+}
+
+// Window validates q's filters, sort, limit and cursor against s and
+// returns the window q selects, for tools that read their items from a
+// source able to filter, sort and paginate them. An Offset beyond the
+// matching items means the cursor is stale; report ErrInvalidCursor.
+func (s Schema[T]) Window(q Query) (Window, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		return Window{}, fmt.Errorf("limit must not exceed %d", MaxLimit)
+	}
+
+	for name, want := range q.Filter {
+		if _, err := matcher(name, want, s); err != nil {
+			return Window{}, err
+		}
+	}
+
+	sortKey := q.Sort
+	if sortKey == "" {
+		sortKey = s.DefaultSort
+	}
+	if _, err := sortCompare(sortKey, s); err != nil {
+		return Window{}, err
+	}
+
+	fingerprint := queryFingerprint(q.Filter, sortKey)
+	offset, err := decodeCursor(q.Cursor, fingerprint)
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{Sort: sortKey, Offset: offset, Limit: limit, fingerprint: fingerprint}, nil
+}
+
+// NewPage returns the page holding items, the contents of w, out of total
+// matching items.
+func NewPage[T any](items []T, total int, w Window) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := &Page[T]{Items: items, Total: total}
+	if end := w.Offset + len(items); end < total {
+		page.NextCursor = encodeCursor(end, w.fingerprint)
+	}
+	return page
+}
+
+// FieldNames returns the sorted names of the filterable and sortable fields, for
+// use in error messages and tool descriptions.
+func (s Schema[T]) FieldNames() (filterable, sortable []string) {
+	for name, f := range s.Fields {
+		if f.Value != nil {
+			filterable = append(filterable, name)
+		}
+		if f.Bound != nil {
+			filterable = append(filterable, name+fromSuffix, name+toSuffix)
+		}
+		if f.Compare != nil {
+			sortable = append(sortable, name)
+		}
+	}
+	sort.Strings(filterable)
+	sort.Strings(sortable)
+	return filterable, sortable
+}
+
+func filter[T any](items []T, filters map[string]string, s Schema[T]) ([]T, error) {
+	matchers := make([]func(T) bool, 0, len(filters))
+	for name, want := range filters {
+		m, err := matcher(name, want, s)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		ok := true
+		for _, m := range matchers {
+			if !m(item) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// matcher builds the predicate for one filter entry: an exact match on a
+// field value, or an inclusive bound for a _from/_to range filter.
+func matcher[T any](name, want string, s Schema[T]) (func(T) bool, error) {
+	if f, ok := s.Fields[name]; ok && f.Value != nil {
+		accept := make(map[string]bool)
+		for _, v := range strings.Split(want, ",") {
+			accept[strings.ToLower(strings.TrimSpace(v))] = true
+		}
+		return func(item T) bool { return accept[strings.ToLower(f.Value(item))] }, nil
+	}
+
+	for _, suffix := range []string{fromSuffix, toSuffix} {
+		base, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		f, ok := s.Fields[base]
+		if !ok || f.Bound == nil {
+			break
+		}
+		compare, err := f.Bound(strings.TrimSpace(want))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for filter %q: %w", name, err)
+		}
+		if suffix == fromSuffix {
+			return func(item T) bool { return compare(item) >= 0 }, nil
+		}
+		return func(item T) bool { return compare(item) <= 0 }, nil
+	}
+
+	filterable, _ := s.FieldNames()
+	return nil, fmt.Errorf("unknown filter field %q (supported: %s)", name, strings.Join(filterable, ", "))
+}
+
+func sortItems[T any](items []T, sortKey string, s Schema[T]) error {
+	desc := strings.HasPrefix(sortKey, "-")
+	compare, err := sortCompare(sortKey, s)
+	if err != nil {
+		return err
+	}
+
+	slices.SortStableFunc(items, func(a, b T) int {
+		if compare != nil {
+			c := compare(a, b)
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(s.Key(a), s.Key(b))
+	})
+	return nil
+}
+
+// sortCompare returns the comparison of the field sortKey names, ignoring
+// its direction, or nil when it names none.
+func sortCompare[T any](sortKey string, s Schema[T]) (func(a, b T) int, error) {
+	name := strings.TrimPrefix(sortKey, "-")
+	if name == "" {
+		return nil, nil
+	}
+	f, ok := s.Fields[name]
+	if !ok || f.Compare == nil {
+		_, sortable := s.FieldNames()
+		return nil, fmt.Errorf("unknown sort field %q (supported: %s)", name, strings.Join(sortable, ", "))
+	}
+	return f.Compare, nil
+}
+
+type cursor struct {
+	Offset      int    `json:"o"`
+	Fingerprint string `json:"q"`
+}
+
+func queryFingerprint(filters map[string]string, sortKey string) string {
+	data, _ := json.Marshal(struct {
+		Filter map[string]string `json:"f"`
+		Sort   string            `json:"s"`
+	}{filters, sortKey})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodeCursor(offset int, fingerprint string) string {
+	data, _ := json.Marshal(cursor{Offset: offset, Fingerprint: fingerprint})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value, fingerprint string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Offset < 0 || c.Fingerprint != fingerprint {
+		return 0, ErrInvalidCursor
+	}
+	return c.Offset, nil
+}
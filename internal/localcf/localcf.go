@@ -0,0 +1,166 @@
+// Package localcf maintains blocks of SpamAssassin site configuration
+// (local.cf) written by spamassassin-mcp, and the sender patterns the
+// *_from directives in them take.
+//
+// Each block is delimited by BEGIN and END marker lines naming it, so several
+// blocks can share a file and the rest of the file is left as it is.
+//
+// Security considerations:
+//   - Sender patterns are validated against a strict pattern, so they cannot
+//     inject other configuration directives
+//   - The file is backed up before each change and replaced atomically; a
+//     block that was damaged by hand is refused rather than guessed at
+//   - Writes to the same file are serialized, including from different blocks
+package localcf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// patternRegex accepts addresses and the * and ? wildcards SpamAssassin
+// supports, e.g. alice@example.com or *@example.com.
+var patternRegex = regexp.MustCompile(`^[a-z0-9._%+\-*?]{1,64}@[a-z0-9.\-*?]{1,253}$`)
+
+// fileLocks serializes read-modify-write cycles per file path.
+var fileLocks sync.Map
+
+// Block is a named block of directives in a local.cf file.
+type Block struct {
+	Path string
+	Name string
+}
+
+// Write replaces the block's lines in the file, appending the block if there
+// is none yet. The previous file is kept with a .bak suffix.
+func (b Block) Write(lines []string) error {
+	mu, _ := fileLocks.LoadOrStore(b.Path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	current, err := os.ReadFile(b.Path)
+	perm := fs.FileMode(0o644)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read %s: %w", b.Path, err)
+	default:
+		if info, err := os.Stat(b.Path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	}
+
+	updated, err := b.render(current, lines)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(updated, current) {
+		return nil
+	}
+	if current != nil {
+		if err := os.WriteFile(b.Path+".bak", current, perm); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", b.Path, err)
+		}
+	}
+	if err := WriteAtomic(b.Path, updated, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", b.Path, err)
+	}
+	return nil
+}
+
+func (b Block) beginMarker() string {
+	return fmt.Sprintf("# BEGIN spamassassin-mcp %s - managed by spamassassin-mcp, edits here are overwritten", b.Name)
+}
+
+func (b Block) endMarker() string {
+	return "# END spamassassin-mcp " + b.Name
+}
+
+// render returns current with the block replaced by lines.
+func (b Block) render(current []byte, lines []string) ([]byte, error) {
+	beginMarker, endMarker := b.beginMarker(), b.endMarker()
+
+	var block strings.Builder
+	block.WriteString(beginMarker + "\n")
+	for _, line := range lines {
+		block.WriteString(line + "\n")
+	}
+	block.WriteString(endMarker + "\n")
+
+	text := string(current)
+	begin := strings.Index(text, beginMarker)
+	end := strings.Index(text, endMarker)
+	switch {
+	case begin < 0 && end < 0:
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if text != "" {
+			text += "\n"
+		}
+		return []byte(text + block.String()), nil
+	case begin < 0 || end < begin || strings.Count(text, beginMarker) > 1 || strings.Count(text, endMarker) > 1:
+		return nil, fmt.Errorf("%s has a damaged spamassassin-mcp %s block; restore the BEGIN and END marker lines or remove the block", b.Path, b.Name)
+	}
+
+	end += len(endMarker)
+	if end < len(text) && text[end] == '\n' {
+		end++
+	}
+	return []byte(text[:begin] + block.String() + text[end:]), nil
+}
+
+// ValidPattern reports whether a lowercased sender is an email address or a
+// SpamAssassin wildcard pattern, as the *_from directives take.
+func ValidPattern(sender string) bool {
+	return patternRegex.MatchString(sender)
+}
+
+// MatchPattern reports whether a lowercased sender matches pattern, where *
+// matches any run of characters and ? any single character.
+func MatchPattern(pattern, sender string) bool {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	ok, _ := regexp.MatchString(expr.String(), sender)
+	return ok
+}
+
+// WriteAtomic replaces path with data through a temporary file in the same
+// directory.
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,82 @@
+// Package logging routes log entries to the configured sinks: stdout, a
+// size-rotated local file and a syslog server.
+//
+// Stdout and the file receive the formatter's output unchanged. Syslog
+// receives each entry as an RFC 5424 message whose severity follows the
+// entry's level, so existing log infrastructure can filter and route it.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Sinks are the open log destinations.
+type Sinks struct {
+	writers []io.Writer
+	file    *RotatingFile
+	syslog  *SyslogHook
+}
+
+// Open opens every sink enabled in cfg.
+func Open(cfg config.LoggingConfig) (*Sinks, error) {
+	s := &Sinks{}
+	if cfg.Stdout {
+		s.writers = append(s.writers, os.Stdout)
+	}
+
+	if cfg.File.Path != "" {
+		file, err := OpenRotatingFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file
+		s.writers = append(s.writers, file)
+	}
+
+	if cfg.Syslog.Enabled() {
+		hook, err := NewSyslogHook(cfg.Syslog)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		s.syslog = hook
+	}
+	return s, nil
+}
+
+// Install directs logger's output to the sinks. It must be called after the
+// logger's formatter and any hooks that modify entries, such as redaction,
+// are in place, since syslog messages are formatted by a hook of their own.
+func (s *Sinks) Install(logger *logrus.Logger) {
+	switch len(s.writers) {
+	case 0:
+		logger.SetOutput(io.Discard)
+	case 1:
+		logger.SetOutput(s.writers[0])
+	default:
+		logger.SetOutput(io.MultiWriter(s.writers...))
+	}
+	if s.syslog != nil {
+		s.syslog.formatter = logger.Formatter
+		logger.AddHook(s.syslog)
+	}
+}
+
+// Close flushes and closes the file and syslog connection.
+func (s *Sinks) Close() error {
+	var errs []error
+	if s.file != nil {
+		errs = append(errs, s.file.Close())
+	}
+	if s.syslog != nil {
+		errs = append(errs, s.syslog.Close())
+	}
+	return errors.Join(errs...)
+}
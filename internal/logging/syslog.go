@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// facilities maps syslog facility names to their codes (RFC 5424 §6.2.1).
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// severities maps logrus levels to syslog severities.
+var severities = map[logrus.Level]int{
+	logrus.PanicLevel: 2, // crit
+	logrus.FatalLevel: 2, // crit
+	logrus.ErrorLevel: 3, // err
+	logrus.WarnLevel:  4, // warning
+	logrus.InfoLevel:  6, // info
+	logrus.DebugLevel: 7, // debug
+	logrus.TraceLevel: 7, // debug
+}
+
+// syslogTimestamp is RFC 3339 limited to the microsecond precision RFC 5424
+// allows.
+const syslogTimestamp = "2006-01-02T15:04:05.000000Z07:00"
+
+// SyslogHook is a logrus hook that sends entries to a syslog server.
+type SyslogHook struct {
+	network  string
+	address  string
+	facility int
+	hostname string
+	appName  string
+	pid      int
+
+	formatter logrus.Formatter
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogHook connects to the syslog server in cfg. UDP and unix datagram
+// sockets send one message per datagram; TCP uses octet-counting framing
+// (RFC 6587).
+func NewSyslogHook(cfg config.SyslogConfig) (*SyslogHook, error) {
+	facility, ok := facilities[cfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility %q", cfg.Facility)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	appName := cfg.AppName
+	if appName == "" {
+		appName = "-"
+	}
+
+	h := &SyslogHook{
+		network:   cfg.Network,
+		address:   cfg.Address,
+		facility:  facility,
+		hostname:  hostname,
+		appName:   appName,
+		pid:       os.Getpid(),
+		formatter: &logrus.JSONFormatter{},
+	}
+	if err := h.dial(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Levels implements logrus.Hook.
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. A failed send is retried once on a fresh
+// connection, so a restarted syslog server is picked up again.
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	body, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	msg := h.message(entry, bytes.TrimRight(body, "\n"))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		if _, err = h.conn.Write(msg); err == nil {
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+	if err := h.dial(); err != nil {
+		return err
+	}
+	_, err = h.conn.Write(msg)
+	return err
+}
+
+// Close closes the connection to the syslog server.
+func (h *SyslogHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+func (h *SyslogHook) dial() error {
+	network := h.network
+	if network == "unix" {
+		network = "unixgram"
+	}
+	conn, err := net.DialTimeout(network, h.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+// message formats an RFC 5424 message:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (h *SyslogHook) message(entry *logrus.Entry, body []byte) []byte {
+	pri := h.facility*8 + severities[entry.Level]
+	header := fmt.Sprintf("<%d>1 %s %s %s %d - - ", pri, entry.Time.Format(syslogTimestamp), h.hostname, h.appName, h.pid)
+	msg := append([]byte(header), body...)
+	if h.network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	return msg
+}
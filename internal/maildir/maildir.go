@@ -0,0 +1,176 @@
+// Package maildir watches the new/ directory of a Maildir and hands every
+// message delivered there to a callback, once.
+//
+// Delivery agents write a message to tmp/ and rename it into new/, so a
+// file that appears in new/ is complete. The watcher reacts to file events
+// when the platform offers them, and also lists new/ every poll interval,
+// which catches events lost to a queue overflow and covers filesystems
+// without events, such as NFS. A message a mail client moves on to cur/
+// before it is handled is skipped.
+//
+// Security considerations:
+//   - Only regular files directly in new/ are read; symbolic links,
+//     directories and hidden files are skipped
+//   - Messages larger than the size limit are not read
+//   - The Maildir is never modified
+package maildir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Handler is called with the file name and content of each delivered
+// message, one at a time.
+type Handler func(ctx context.Context, name, content string)
+
+// Watcher watches one Maildir. It is not safe for concurrent use; call Run
+// once.
+type Watcher struct {
+	dir      string
+	interval time.Duration
+	maxSize  int64
+	handle   Handler
+
+	// seen holds the messages in new/ already handed to handle, so each is
+	// handled once. Messages that leave new/ are forgotten.
+	seen map[string]bool
+}
+
+// New returns a watcher for the Maildir in cfg. Messages larger than maxSize
+// bytes are skipped. Unless cfg.ScanExisting is set, the messages in new/
+// when New is called are never handled. It fails when the Maildir has no
+// new/ directory.
+func New(cfg config.MaildirWatchConfig, maxSize int64, handle Handler) (*Watcher, error) {
+	dir := filepath.Join(cfg.Dir, "new")
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("maildir %s: %w", cfg.Dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("maildir %s: new is not a directory", cfg.Dir)
+	}
+	w := &Watcher{
+		dir:      dir,
+		interval: cfg.PollInterval,
+		maxSize:  maxSize,
+		handle:   handle,
+		seen:     make(map[string]bool),
+	}
+	if !cfg.ScanExisting {
+		w.poll(context.Background(), false)
+	}
+	return w, nil
+}
+
+// Run handles the messages delivered to new/ until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	w.poll(ctx, true)
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if notify, err := fsnotify.NewWatcher(); err != nil {
+		logrus.WithError(err).Warn("File events unavailable; polling the Maildir only")
+	} else {
+		defer notify.Close()
+		if err := notify.Add(w.dir); err != nil {
+			logrus.WithError(err).Warn("File events unavailable; polling the Maildir only")
+		} else {
+			events, errs = notify.Events, notify.Errors
+		}
+	}
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.poll(ctx, true)
+		case event := <-events:
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Rename) {
+				w.poll(ctx, true)
+			}
+		case err := <-errs:
+			// Usually a queue overflow; the next poll finds what was missed
+			logrus.WithError(err).Debug("Maildir file event error")
+		}
+	}
+}
+
+// poll lists new/ and, when handle is set, handles the messages not seen
+// before, oldest first by name as Maildir names start with the delivery
+// time. Otherwise they are only marked seen.
+func (w *Watcher) poll(ctx context.Context, handle bool) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to list Maildir")
+		return
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !entry.Type().IsRegular() {
+			continue
+		}
+		present[name] = true
+		if w.seen[name] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		w.seen[name] = true
+		if !handle {
+			continue
+		}
+
+		content, err := w.read(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Moved to cur/ by a mail client meanwhile
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("file", name).Warn("Skipping Maildir message")
+			continue
+		}
+		w.handle(ctx, name, content)
+	}
+
+	for name := range w.seen {
+		if !present[name] {
+			delete(w.seen, name)
+		}
+	}
+}
+
+func (w *Watcher) read(name string) (string, error) {
+	f, err := os.Open(filepath.Join(w.dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, w.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > w.maxSize {
+		return "", fmt.Errorf("message exceeds size limit of %d bytes", w.maxSize)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,297 @@
+// Package mailsource reads the messages of mail collections: mbox files,
+// Maildirs, directories of one message per file, and uploaded zip and tar
+// archives of those.
+//
+// Security considerations:
+//   - Symbolic links are never followed, and hidden files and directories
+//     are skipped, as are the tmp directories of Maildirs
+//   - Reads stop with an error once a collection holds more than the
+//     configured number of messages or bytes, decompressed bytes included,
+//     so an archive cannot expand without bound
+package mailsource
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"spamassassin-mcp/internal/mbox"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Formats of collections.
+const (
+	FormatEML       = "eml"
+	FormatMbox      = "mbox"
+	FormatMaildir   = "maildir"
+	FormatDirectory = "directory"
+	FormatZip       = "zip"
+	FormatTar       = "tar"
+)
+
+// Message is a message of a collection. Name is the path of its file
+// relative to the collection, followed by #n for the nth message of an mbox.
+type Message struct {
+	Name    string
+	Content string
+}
+
+// Limits bound what a collection may hold.
+type Limits struct {
+	// MaxMessages is the most messages a collection may hold.
+	MaxMessages int
+	// MaxSize is the most bytes a collection may hold, after decompression.
+	MaxSize int64
+}
+
+// reader collects messages within limits.
+type reader struct {
+	limits   Limits
+	size     int64
+	messages []Message
+}
+
+// add adds the messages of a file, splitting it when it is an mbox.
+func (r *reader) add(name string, data []byte) error {
+	if !mbox.IsMbox(data) {
+		return r.append(Message{Name: name, Content: string(data)})
+	}
+	for i, content := range mbox.Split(data) {
+		if err := r.append(Message{Name: fmt.Sprintf("%s#%d", name, i+1), Content: content}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reader) append(m Message) error {
+	if len(r.messages) == r.limits.MaxMessages {
+		return toolerr.Errorf(toolerr.SizeExceeded, "collection has more than %d messages", r.limits.MaxMessages)
+	}
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+// read reads src, counting its bytes against the size limit.
+func (r *reader) read(src io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(src, r.limits.MaxSize-r.size+1))
+	if err != nil {
+		return nil, err
+	}
+	r.size += int64(len(data))
+	if r.size > r.limits.MaxSize {
+		return nil, toolerr.Errorf(toolerr.SizeExceeded, "collection exceeds size limit of %d bytes", r.limits.MaxSize)
+	}
+	return data, nil
+}
+
+// ReadPath reads the messages at path: an mbox or message file, a Maildir
+// (a directory with cur and new subdirectories), or a directory tree of
+// message and mbox files. It returns the messages in name order and the
+// format of the collection.
+func ReadPath(p string, limits Limits) ([]Message, string, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, "", err
+	}
+	r := &reader{limits: limits}
+	switch {
+	case info.Mode().IsRegular():
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		data, err := r.read(f)
+		if err != nil {
+			return nil, "", err
+		}
+		format := FormatEML
+		if mbox.IsMbox(data) {
+			format = FormatMbox
+		}
+		if err := r.add(filepath.Base(p), data); err != nil {
+			return nil, "", err
+		}
+		return r.messages, format, nil
+	case info.IsDir():
+		format := FormatDirectory
+		if isMaildir(p) {
+			format = FormatMaildir
+		}
+		if err := r.walk(p, format == FormatMaildir); err != nil {
+			return nil, "", err
+		}
+		return r.messages, format, nil
+	}
+	return nil, "", toolerr.Errorf(toolerr.UnsupportedFormat, "%s is not a regular file or directory", p)
+}
+
+// isMaildir reports whether dir has the cur and new subdirectories of a
+// Maildir.
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		info, err := os.Lstat(filepath.Join(dir, sub))
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// walk reads the regular files under root. In a Maildir only cur and new
+// are read, since tmp holds messages still being delivered.
+func (r *reader) walk(root string, maildir bool) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if maildir && !strings.Contains(rel, string(filepath.Separator)) && d.Name() != "cur" && d.Name() != "new" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || (maildir && !strings.Contains(rel, string(filepath.Separator))) {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err := r.read(f)
+		if err != nil {
+			return err
+		}
+		return r.add(filepath.ToSlash(rel), data)
+	})
+}
+
+// ReadArchive reads the messages of uploaded data: a zip archive, a tar
+// archive, optionally gzip-compressed, or an mbox or message file,
+// optionally gzip-compressed. It returns the messages in archive order and
+// the format of the collection.
+func ReadArchive(data []byte, limits Limits) ([]Message, string, error) {
+	r := &reader{limits: limits}
+	if bytes.HasPrefix(data, []byte("\x1f\x8b")) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", toolerr.Errorf(toolerr.ValidationFailed, "invalid gzip data: %w", err)
+		}
+		if data, err = r.read(zr); err != nil {
+			return nil, "", err
+		}
+		r.size = 0
+	}
+	if int64(len(data)) > limits.MaxSize {
+		return nil, "", toolerr.Errorf(toolerr.SizeExceeded, "collection exceeds size limit of %d bytes", limits.MaxSize)
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		if err := r.readZip(data); err != nil {
+			return nil, "", err
+		}
+		return r.messages, FormatZip, nil
+	case isTar(data):
+		if err := r.readTar(data); err != nil {
+			return nil, "", err
+		}
+		return r.messages, FormatTar, nil
+	}
+	format := FormatEML
+	if mbox.IsMbox(data) {
+		format = FormatMbox
+	}
+	if err := r.add("upload", data); err != nil {
+		return nil, "", err
+	}
+	return r.messages, format, nil
+}
+
+// isTar reports whether data starts with a POSIX or GNU tar header.
+func isTar(data []byte) bool {
+	return len(data) >= 512 && bytes.HasPrefix(data[257:], []byte("ustar"))
+}
+
+func (r *reader) readZip(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return toolerr.Errorf(toolerr.ValidationFailed, "invalid zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() || skip(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("zip entry %s: %w", f.Name, err)
+		}
+		content, err := r.read(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := r.add(f.Name, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reader) readTar(data []byte) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return toolerr.Errorf(toolerr.ValidationFailed, "invalid tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || skip(hdr.Name) {
+			continue
+		}
+		content, err := r.read(tr)
+		if err != nil {
+			return err
+		}
+		if err := r.add(hdr.Name, content); err != nil {
+			return err
+		}
+	}
+}
+
+// skip reports whether an archive entry is, or is in, a hidden file or
+// directory, or in the tmp directory of a Maildir.
+func skip(name string) bool {
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return path.Base(path.Dir(name)) == "tmp"
+}
@@ -0,0 +1,65 @@
+// Package mbox splits mbox files, as written by mail archives and journaling
+// pipelines, into their messages.
+//
+// A message starts with a "From " separator line at the start of the file or
+// after an empty line. Body lines that would look like a separator are
+// quoted with ">" when the file is written; Split removes one level of
+// quoting, which restores the original lines of both the mboxo and mboxrd
+// variants in all common cases.
+package mbox
+
+import (
+	"bytes"
+	"strings"
+)
+
+// IsMbox reports whether data starts with an mbox separator line.
+func IsMbox(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("From "))
+}
+
+// Split returns the messages of an mbox, in order, without their separator
+// lines. Line endings are kept as they are.
+func Split(data []byte) []string {
+	var messages []string
+	var current strings.Builder
+	inMessage, blank := false, true
+
+	flush := func() {
+		if inMessage {
+			// The empty line before the next separator belongs to the file
+			// format, not to the message.
+			message := current.String()
+			if trimmed, ok := strings.CutSuffix(message, "\r\n\r\n"); ok {
+				message = trimmed + "\r\n"
+			} else if trimmed, ok := strings.CutSuffix(message, "\n\n"); ok {
+				message = trimmed + "\n"
+			}
+			messages = append(messages, message)
+		}
+		current.Reset()
+	}
+
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+		content := bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case blank && bytes.HasPrefix(content, []byte("From ")):
+			flush()
+			inMessage = true
+		case inMessage:
+			if quoted := bytes.TrimLeft(content, ">"); len(quoted) < len(content) && bytes.HasPrefix(quoted, []byte("From ")) {
+				line = line[1:]
+			}
+			current.Write(line)
+		}
+		blank = len(content) == 0
+	}
+	flush()
+	return messages
+}
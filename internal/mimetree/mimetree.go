@@ -0,0 +1,234 @@
+// Package mimetree reports the MIME structure of a message and the
+// anomalies in it that evasive messages use to hide content from filters.
+//
+// Mail clients and filters disagree about malformed structure: one may
+// render a part that another never scans. Analyze lists the parts of the
+// parsed message in depth-first order with the paths of their children and
+// flags
+// boundary problems (missing, undelimited, unterminated or colliding
+// boundaries, text hidden in preambles and epilogues), nesting beyond what
+// mail clients produce, and encodings MIME does not allow, independently of
+// SpamAssassin's rules.
+//
+// Security considerations:
+//   - Only the structure recorded at parse time is inspected; no part is
+//     decoded again, rendered or returned
+package mimetree
+
+import (
+	"fmt"
+	"strings"
+
+	"spamassassin-mcp/internal/model"
+)
+
+// Anomaly types.
+const (
+	MissingBoundary         = "missing_boundary"
+	InvalidBoundary         = "invalid_boundary"
+	BoundaryNotFound        = "boundary_not_found"
+	Unterminated            = "unterminated_multipart"
+	BoundaryCollision       = "boundary_collision"
+	PreambleContent         = "preamble_content"
+	EpilogueContent         = "epilogue_content"
+	DeepNesting             = "deep_nesting"
+	NestingLimit            = "nesting_limit"
+	PartLimit               = "part_limit"
+	EncodedContainer        = "encoded_container"
+	UnknownTransferEncoding = "unknown_transfer_encoding"
+	DuplicateHeader         = "duplicate_header"
+	MissingMIMEVersion      = "missing_mime_version"
+)
+
+// Severity is how strongly an anomaly suggests deliberate evasion.
+type Severity string
+
+const (
+	High   Severity = "high"
+	Medium Severity = "medium"
+	Low    Severity = "low"
+)
+
+var severities = map[string]Severity{
+	MissingBoundary:         High,
+	BoundaryNotFound:        High,
+	Unterminated:            Medium,
+	BoundaryCollision:       High,
+	NestingLimit:            High,
+	PartLimit:               High,
+	EncodedContainer:        High,
+	DuplicateHeader:         High,
+	InvalidBoundary:         Medium,
+	EpilogueContent:         Medium,
+	DeepNesting:             Medium,
+	UnknownTransferEncoding: Medium,
+	PreambleContent:         Low,
+	MissingMIMEVersion:      Low,
+}
+
+const (
+	// MaxNormalDepth is the deepest nesting mail clients produce: a
+	// forwarded message with attachments and alternative HTML with inline
+	// images stays within it.
+	MaxNormalDepth = 5
+
+	// maxBenignPreamble is the length of preamble text, such as "This is a
+	// multi-part message in MIME format.", that is not flagged.
+	maxBenignPreamble = 128
+
+	// maxBoundaryLength is the longest boundary RFC 2046 allows.
+	maxBoundaryLength = 70
+)
+
+// Node is a part of the MIME tree with the paths of the parts it contains.
+// The tree stays flat, as in the parsed message, so it serializes without
+// nesting.
+type Node struct {
+	model.Part
+	Children []string `json:"children,omitempty"`
+}
+
+// Anomaly is a structural problem of one part, or of the message when Path
+// is empty.
+type Anomaly struct {
+	Type     string   `json:"type"`
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// Report is the MIME structure of a message, its parts in depth-first order
+// starting with the root. Defects are the problems the parser recorded while
+// walking the tree.
+type Report struct {
+	Parts     []*Node   `json:"parts"`
+	Leaves    int       `json:"leaves"`
+	MaxDepth  int       `json:"max_depth"`
+	Anomalies []Anomaly `json:"anomalies"`
+	HighRisk  int       `json:"high_risk"`
+	Defects   []string  `json:"defects,omitempty"`
+}
+
+// Analyze reports the MIME tree of e and its anomalies.
+func Analyze(e *model.ParsedEmail) *Report {
+	r := &Report{Parts: make([]*Node, 0, len(e.Parts)), Anomalies: make([]Anomaly, 0), Defects: e.Defects}
+	nodes := make(map[string]*Node, len(e.Parts))
+	for _, part := range e.Parts {
+		node := &Node{Part: part}
+		nodes[part.Path] = node
+		r.Parts = append(r.Parts, node)
+		if parent := nodes[part.Parent]; parent != nil {
+			parent.Children = append(parent.Children, part.Path)
+		}
+		if !part.IsContainer() {
+			r.Leaves++
+		}
+		r.MaxDepth = max(r.MaxDepth, part.Depth)
+	}
+
+	for _, part := range e.Parts {
+		r.checkPart(part, nodes)
+	}
+	if r.MaxDepth > MaxNormalDepth {
+		deepest := e.Parts[0]
+		for _, part := range e.Parts {
+			if part.Depth > deepest.Depth {
+				deepest = part
+			}
+		}
+		r.add(DeepNesting, deepest.Path, "parts nested %d levels deep; mail clients rarely exceed %d", r.MaxDepth, MaxNormalDepth)
+	}
+	if len(e.Parts) >= model.MaxParts {
+		r.add(PartLimit, "", "the message has more than %d parts; the rest were not parsed", model.MaxParts)
+	}
+	for _, name := range []string{"Content-Type", "Content-Transfer-Encoding", "MIME-Version"} {
+		if n := len(e.HeaderValues(name)); n > 1 {
+			r.add(DuplicateHeader, "", "%d %s headers; clients and filters may each use a different one", n, name)
+		}
+	}
+	if root := r.Parts[0]; root.IsContainer() && e.Header("MIME-Version") == "" {
+		r.add(MissingMIMEVersion, "", "%s message without a MIME-Version header", root.ContentType)
+	}
+
+	for _, a := range r.Anomalies {
+		if a.Severity == High {
+			r.HighRisk++
+		}
+	}
+	return r
+}
+
+// checkPart records the anomalies of one part.
+func (r *Report) checkPart(part model.Part, nodes map[string]*Node) {
+	encoding := part.TransferEncoding
+	if part.IsContainer() {
+		if encoding != "" && encoding != "7bit" && encoding != "8bit" && encoding != "binary" {
+			r.add(EncodedContainer, part.Path, "%s with Content-Transfer-Encoding %s; RFC 2045 allows only 7bit, 8bit or binary", part.ContentType, encoding)
+		}
+	} else if encoding != "" && encoding != "7bit" && encoding != "8bit" && encoding != "binary" &&
+		encoding != "base64" && encoding != "quoted-printable" {
+		r.add(UnknownTransferEncoding, part.Path, "unknown Content-Transfer-Encoding %q; the content was left undecoded", encoding)
+	}
+	if !strings.HasPrefix(part.ContentType, "multipart/") {
+		return
+	}
+
+	switch {
+	case part.Boundary == "":
+		r.add(MissingBoundary, part.Path, "%s without a boundary parameter; its parts cannot be found", part.ContentType)
+		return
+	case !validBoundary(part.Boundary):
+		r.add(InvalidBoundary, part.Path, "boundary %q is longer than %d characters or uses characters RFC 2046 does not allow", part.Boundary, maxBoundaryLength)
+	}
+	if len(nodes[part.Path].Children) == 0 {
+		if part.Depth >= model.MaxMIMEDepth {
+			r.add(NestingLimit, part.Path, "nesting limit of %d levels reached; the parts inside were not parsed", model.MaxMIMEDepth)
+		} else {
+			r.add(BoundaryNotFound, part.Path, "boundary %q never appears as a delimiter line in the body", part.Boundary)
+		}
+		return
+	}
+	if part.Unterminated {
+		r.add(Unterminated, part.Path, "the closing delimiter --%s-- is missing", part.Boundary)
+	}
+	if part.Preamble > maxBenignPreamble {
+		r.add(PreambleContent, part.Path, "%d bytes of text before the first boundary, which mail clients do not show but some filters skip", part.Preamble)
+	}
+	if part.Epilogue > 0 {
+		r.add(EpilogueContent, part.Path, "%d bytes of text after the closing boundary, which mail clients do not show but some filters skip", part.Epilogue)
+	}
+	for parent := nodes[part.Parent]; parent != nil; parent = nodes[parent.Parent] {
+		if parent.Boundary == "" || !strings.HasPrefix(parent.ContentType, "multipart/") {
+			continue
+		}
+		if strings.HasPrefix(part.Boundary, parent.Boundary) || strings.HasPrefix(parent.Boundary, part.Boundary) {
+			r.add(BoundaryCollision, part.Path, "boundary %q collides with boundary %q of enclosing part %s; parsers may split the parts differently", part.Boundary, parent.Boundary, parent.Path)
+		}
+	}
+}
+
+func (r *Report) add(kind, path, format string, args ...any) {
+	r.Anomalies = append(r.Anomalies, Anomaly{
+		Type:     kind,
+		Severity: severities[kind],
+		Path:     path,
+		Detail:   fmt.Sprintf(format, args...),
+	})
+}
+
+// validBoundary reports whether b is a boundary RFC 2046 allows: 1 to 70
+// characters from its bchars set, not ending in a space.
+func validBoundary(b string) bool {
+	if len(b) > maxBoundaryLength || strings.HasSuffix(b, " ") {
+		return false
+	}
+	for _, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("'()+_,-./:=? ", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
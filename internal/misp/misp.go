@@ -0,0 +1,223 @@
+// Package misp is a minimal client for publishing indicators to a MISP
+// threat intelligence platform.
+//
+// The client creates events with the indicators of a message as attributes
+// and can publish them. It has no way to read, change or delete existing
+// events.
+//
+// Security considerations:
+//   - The API key is sent only to the configured instance; redirects are
+//     not followed
+//   - Response bodies are bounded
+package misp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ioc"
+)
+
+// maxResponseSize bounds the responses read from MISP.
+const maxResponseSize = 1 << 20
+
+// Attribute categories.
+const (
+	categoryNetwork = "Network activity"
+	categoryPayload = "Payload delivery"
+)
+
+// Event is a MISP event. Numeric settings are strings, as MISP returns them.
+type Event struct {
+	ID            string      `json:"id,omitempty"`
+	UUID          string      `json:"uuid,omitempty"`
+	Info          string      `json:"info"`
+	Date          string      `json:"date"`
+	Distribution  string      `json:"distribution"`
+	ThreatLevelID string      `json:"threat_level_id"`
+	Analysis      string      `json:"analysis"`
+	Published     bool        `json:"published"`
+	Tags          []Tag       `json:"Tag,omitempty"`
+	Attributes    []Attribute `json:"Attribute,omitempty"`
+}
+
+// Tag is a tag attached to an event.
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// Attribute is one indicator of an event.
+type Attribute struct {
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Value    string `json:"value"`
+	ToIDS    bool   `json:"to_ids"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Attributes converts the indicators of set to MISP attributes. Sources are
+// recorded in the comment; attribute types follow where each indicator was
+// found, such as ip-src for the originating IP and ip-dst for linked ones.
+func Attributes(set *ioc.Set, toIDS bool) []Attribute {
+	var attrs []Attribute
+	add := func(typ, category, value, comment string) {
+		attrs = append(attrs, Attribute{Type: typ, Category: category, Value: value, ToIDS: toIDS, Comment: comment})
+	}
+	for _, ip := range set.IPs {
+		typ := "ip-dst"
+		if slices.Contains(ip.Sources, ioc.SourceOrigin) {
+			typ = "ip-src"
+		}
+		add(typ, categoryNetwork, ip.Value, comment(ip.Sources))
+	}
+	for _, domain := range set.Domains {
+		add("domain", categoryNetwork, domain.Value, comment(domain.Sources))
+	}
+	for _, u := range set.URLs {
+		add("url", categoryNetwork, u.Value, comment(u.Sources))
+	}
+	for _, addr := range set.EmailAddresses {
+		typ := "email"
+		switch {
+		case slices.Contains(addr.Sources, ioc.SourceFrom), slices.Contains(addr.Sources, ioc.SourceReturnPath):
+			typ = "email-src"
+		case slices.Contains(addr.Sources, ioc.SourceReplyTo):
+			typ = "email-reply-to"
+		}
+		add(typ, categoryPayload, addr.Value, comment(addr.Sources))
+	}
+	for _, file := range set.Files {
+		note := "attachment " + file.Type
+		if file.Name != "" {
+			note = "attachment " + file.Name
+		}
+		add("sha256", categoryPayload, file.SHA256, note)
+		add("md5", categoryPayload, file.MD5, note)
+	}
+	return attrs
+}
+
+func comment(sources []string) string {
+	return "found in: " + strings.Join(sources, ", ")
+}
+
+// Client creates events on one MISP instance.
+type Client struct {
+	base   *url.URL
+	apiKey string
+	http   *http.Client
+}
+
+// New returns a client for the instance in cfg.
+func New(cfg config.MISPConfig) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(cfg.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MISP URL: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MISP CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("MISP CA file %s holds no certificates", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{
+		base:   base,
+		apiKey: cfg.APIKey,
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// A redirect could carry the API key elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// AddEvent creates event and returns it as stored, with its ID and UUID.
+func (c *Client) AddEvent(ctx context.Context, event *Event) (*Event, error) {
+	var resp struct {
+		Event Event `json:"Event"`
+	}
+	if err := c.post(ctx, "/events/add", map[string]*Event{"Event": event}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Event.ID == "" {
+		return nil, fmt.Errorf("MISP returned no event ID")
+	}
+	return &resp.Event, nil
+}
+
+// PublishEvent publishes the event with the given ID, which alerts the
+// instance's users and makes it available to synchronisation.
+func (c *Client) PublishEvent(ctx context.Context, id string) error {
+	return c.post(ctx, "/events/publish/"+url.PathEscape(id), struct{}{}, nil)
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("MISP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read MISP response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp.Status, content)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("invalid MISP response: %w", err)
+	}
+	return nil
+}
+
+// responseError turns a MISP error response into an error with its message.
+func responseError(status string, content []byte) error {
+	var body struct {
+		Message string          `json:"message"`
+		Errors  json.RawMessage `json:"errors"`
+	}
+	json.Unmarshal(content, &body)
+	switch {
+	case body.Message != "" && len(body.Errors) > 0 && string(body.Errors) != "null":
+		return fmt.Errorf("MISP error %s: %s: %s", status, body.Message, body.Errors)
+	case body.Message != "":
+		return fmt.Errorf("MISP error %s: %s", status, body.Message)
+	default:
+		return fmt.Errorf("MISP error: %s", status)
+	}
+}
@@ -0,0 +1,213 @@
+// Package model defines the canonical parsed-email intermediate representation.
+//
+// A ParsedEmail is produced once per submission and shared by every analyzer
+// (scanning, header forensics, URL and attachment analysis, ...), so a message
+// is never re-parsed by each tool. The representation is deliberately flat:
+// MIME parts are listed in depth-first order with dotted paths ("1", "1.2",
+// "1.2.1") instead of nesting, which keeps it easy to serialize and filter.
+//
+// Security considerations:
+//   - MIME nesting depth and part count are bounded to prevent resource abuse
+//   - Decoded part content is kept in memory only and never serialized
+//   - Parsing never executes or renders content
+package model
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxMIMEDepth is the deepest multipart nesting that will be walked.
+	MaxMIMEDepth = 20
+
+	// MaxParts is the maximum number of MIME parts recorded per message.
+	MaxParts = 500
+)
+
+// ParsedEmail is the canonical parsed form of a submitted message.
+type ParsedEmail struct {
+	Raw         string       `json:"-"`
+	Size        int          `json:"size"`
+	SHA256      string       `json:"sha256"`
+	Headers     []Header     `json:"headers"`
+	From        []Address    `json:"from,omitempty"`
+	To          []Address    `json:"to,omitempty"`
+	Cc          []Address    `json:"cc,omitempty"`
+	ReplyTo     []Address    `json:"reply_to,omitempty"`
+	ReturnPath  string       `json:"return_path,omitempty"`
+	Subject     string       `json:"subject,omitempty"`
+	MessageID   string       `json:"message_id,omitempty"`
+	Date        *time.Time   `json:"date,omitempty"`
+	Parts       []Part       `json:"parts"`
+	URLs        []string     `json:"urls"`
+	AuthResults []AuthResult `json:"auth_results,omitempty"`
+	Defects     []string     `json:"defects,omitempty"`
+	Input       *Input       `json:"input,omitempty"`
+}
+
+// Header is a single header field in its original order. Value is unfolded
+// and RFC 2047 decoded; RawValue keeps the unfolded but undecoded form.
+type Header struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	RawValue string `json:"raw_value,omitempty"`
+}
+
+// Address is a parsed mailbox from an address header.
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// Domain returns the lower-cased domain part of the address.
+func (a Address) Domain() string {
+	if i := strings.LastIndex(a.Address, "@"); i >= 0 {
+		return strings.ToLower(a.Address[i+1:])
+	}
+	return ""
+}
+
+// Part is one node of the MIME tree. Containers (multipart/*, message/rfc822)
+// are listed alongside their children; Parent holds the path of the
+// enclosing container, empty for the root. For multipart parts, Preamble and
+// Epilogue are the bytes of text, not counting whitespace, before the first
+// and after the closing boundary delimiter, and Unterminated is set when the
+// closing delimiter is missing.
+type Part struct {
+	Path             string `json:"path"`
+	Parent           string `json:"parent,omitempty"`
+	Depth            int    `json:"depth"`
+	ContentType      string `json:"content_type"`
+	Charset          string `json:"charset,omitempty"`
+	Boundary         string `json:"boundary,omitempty"`
+	TransferEncoding string `json:"transfer_encoding,omitempty"`
+	Disposition      string `json:"disposition,omitempty"`
+	Filename         string `json:"filename,omitempty"`
+	ContentID        string `json:"content_id,omitempty"`
+	Size             int    `json:"size"`
+	EncodedSize      int    `json:"encoded_size"`
+	Preamble         int    `json:"preamble,omitempty"`
+	Epilogue         int    `json:"epilogue,omitempty"`
+	Unterminated     bool   `json:"unterminated,omitempty"`
+
+	// Content is the transfer-decoded body of a leaf part. Text parts are
+	// additionally converted to UTF-8 and exposed through Text.
+	Content []byte `json:"-"`
+	Text    string `json:"-"`
+}
+
+// IsContainer reports whether the part holds other parts.
+func (p Part) IsContainer() bool {
+	return strings.HasPrefix(p.ContentType, "multipart/") || p.ContentType == "message/rfc822"
+}
+
+// IsAttachment reports whether the part is an attachment rather than
+// inline message text.
+func (p Part) IsAttachment() bool {
+	if p.IsContainer() {
+		return false
+	}
+	if p.Disposition == "attachment" || p.Filename != "" {
+		return true
+	}
+	return !strings.HasPrefix(p.ContentType, "text/")
+}
+
+// AuthResult is one method result from an Authentication-Results header.
+type AuthResult struct {
+	AuthServID string            `json:"authserv_id,omitempty"`
+	Method     string            `json:"method"`
+	Result     string            `json:"result"`
+	Reason     string            `json:"reason,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Header returns the decoded value of the first header with the given name.
+func (e *ParsedEmail) Header(name string) string {
+	for _, h := range e.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// HeaderValues returns the decoded values of every header with the given name.
+func (e *ParsedEmail) HeaderValues(name string) []string {
+	var values []string
+	for _, h := range e.Headers {
+		if strings.EqualFold(h.Name, name) {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// encodedWordRegex matches the charset of an RFC 2047 encoded word, ignoring
+// an RFC 2231 language suffix.
+var encodedWordRegex = regexp.MustCompile(`=\?([^?*]+)(?:\*[^?]*)?\?[BbQq]\?`)
+
+// Charsets returns the lower-cased charsets the message declares, in the
+// order they first appear: those of encoded words in its headers, then
+// those of its MIME parts.
+func (e *ParsedEmail) Charsets() []string {
+	charsets := make([]string, 0)
+	add := func(charset string) {
+		charset = strings.ToLower(charset)
+		if charset != "" && !slices.Contains(charsets, charset) {
+			charsets = append(charsets, charset)
+		}
+	}
+	for _, h := range e.Headers {
+		for _, m := range encodedWordRegex.FindAllStringSubmatch(h.RawValue, -1) {
+			add(m[1])
+		}
+	}
+	for _, p := range e.Parts {
+		add(p.Charset)
+	}
+	return charsets
+}
+
+// FromDomain returns the domain of the first From address.
+func (e *ParsedEmail) FromDomain() string {
+	if len(e.From) == 0 {
+		return ""
+	}
+	return e.From[0].Domain()
+}
+
+// TextBody returns the concatenated text/plain content of the message.
+func (e *ParsedEmail) TextBody() string {
+	return e.joinText("text/plain")
+}
+
+// HTMLBody returns the concatenated text/html content of the message.
+func (e *ParsedEmail) HTMLBody() string {
+	return e.joinText("text/html")
+}
+
+// Attachments returns all attachment parts.
+func (e *ParsedEmail) Attachments() []Part {
+	var parts []Part
+	for _, p := range e.Parts {
+		if p.IsAttachment() {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+func (e *ParsedEmail) joinText(contentType string) string {
+	var b strings.Builder
+	for _, p := range e.Parts {
+		if p.ContentType == contentType && p.Disposition != "attachment" {
+			b.WriteString(p.Text)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
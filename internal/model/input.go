@@ -0,0 +1,142 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+)
+
+// Input formats.
+const (
+	// FormatRFC822 is a raw message, as pasted or read from an .eml file.
+	FormatRFC822 = "rfc822"
+	// FormatBase64 is a base64 encoded message.
+	FormatBase64 = "base64"
+)
+
+// Line ending conventions.
+const (
+	LineEndingsCRLF  = "crlf"
+	LineEndingsLF    = "lf"
+	LineEndingsCR    = "cr"
+	LineEndingsMixed = "mixed"
+)
+
+// Input describes the format a message was submitted in and what was done
+// to turn it into the canonical form that is parsed and sent to spamd.
+type Input struct {
+	Format      string `json:"format"`
+	LineEndings string `json:"line_endings"`
+	// Envelope reports that a leading mbox "From " line, as written by
+	// mail clients exporting .eml files, was removed.
+	Envelope bool `json:"envelope,omitempty"`
+	// BOM reports that a leading UTF-8 byte order mark was removed.
+	BOM bool `json:"bom,omitempty"`
+	// Normalized reports that the canonical form differs from the
+	// submitted content.
+	Normalized bool `json:"normalized"`
+}
+
+// Normalize detects the format of submitted content and returns the message
+// in canonical form: decoded, without a leading byte order mark, mbox
+// envelope line or blank lines, and with CRLF line endings as spamd expects.
+// Content in no recognized encoding is treated as a raw message; whether it
+// is a valid one is left to Parse.
+func Normalize(content string) (string, *Input) {
+	in := &Input{Format: FormatRFC822}
+	raw := content
+	if decoded, ok := decodeBase64(raw); ok {
+		in.Format = FormatBase64
+		raw = decoded
+	}
+	if rest, ok := strings.CutPrefix(raw, "\uFEFF"); ok {
+		in.BOM = true
+		raw = rest
+	}
+	raw = strings.TrimLeft(raw, "\r\n")
+	if strings.HasPrefix(raw, "From ") {
+		in.Envelope = true
+		if i := strings.IndexAny(raw, "\r\n"); i >= 0 {
+			raw = strings.TrimLeft(raw[i:], "\r\n")
+		} else {
+			raw = ""
+		}
+	}
+	in.LineEndings = lineEndings(raw)
+	if in.LineEndings != LineEndingsCRLF {
+		raw = toCRLF(raw)
+	}
+	in.Normalized = raw != content
+	return raw, in
+}
+
+// decodeBase64 decodes content that is entirely base64, standard or URL
+// safe and possibly wrapped, and decodes to something that starts like a
+// message header.
+func decodeBase64(content string) (string, bool) {
+	compact := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, content)
+	if compact == "" || strings.ContainsRune(compact, ':') {
+		return "", false
+	}
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		data, err := enc.DecodeString(compact)
+		if err == nil && looksLikeMessage(data) {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// looksLikeMessage reports whether data starts with an mbox envelope line or
+// a header field.
+func looksLikeMessage(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	data = bytes.TrimLeft(data, "\r\n")
+	if bytes.HasPrefix(data, []byte("From ")) {
+		return true
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	name, _, ok := bytes.Cut(line, []byte(":"))
+	if !ok || len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// lineEndings returns the line ending convention used in s. A message
+// without line breaks counts as CRLF, since there is nothing to convert.
+func lineEndings(s string) string {
+	crlf := strings.Count(s, "\r\n")
+	lf := strings.Count(s, "\n") - crlf
+	cr := strings.Count(s, "\r") - crlf
+	switch {
+	case lf == 0 && cr == 0:
+		return LineEndingsCRLF
+	case crlf == 0 && cr == 0:
+		return LineEndingsLF
+	case crlf == 0 && lf == 0:
+		return LineEndingsCR
+	}
+	return LineEndingsMixed
+}
+
+// toCRLF converts every line ending in s to CRLF.
+func toCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
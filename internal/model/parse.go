@@ -0,0 +1,425 @@
+package model
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+var (
+	urlRegex  = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s<>"'\x60{}|\\^\[\]]+`)
+	hrefRegex = regexp.MustCompile(`(?i)\b(?:href|src|action)\s*=\s*["']?([^"'\s>]+)`)
+
+	headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+)
+
+// Parse builds the intermediate representation of a raw RFC 822 message.
+// It fails only when the message headers cannot be read at all; structural
+// problems in the body are recorded in Defects instead.
+func Parse(raw string) (*ParsedEmail, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid email format: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(raw))
+	e := &ParsedEmail{
+		Raw:     raw,
+		Size:    len(raw),
+		SHA256:  hex.EncodeToString(sum[:]),
+		Headers: parseHeaderBlock(raw),
+		Parts:   make([]Part, 0),
+		URLs:    make([]string, 0),
+	}
+
+	e.From = e.addressList(msg.Header, "From")
+	e.To = e.addressList(msg.Header, "To")
+	e.Cc = e.addressList(msg.Header, "Cc")
+	e.ReplyTo = e.addressList(msg.Header, "Reply-To")
+	e.ReturnPath = strings.Trim(strings.TrimSpace(msg.Header.Get("Return-Path")), "<>")
+	e.Subject = e.Header("Subject")
+	e.MessageID = strings.TrimSpace(msg.Header.Get("Message-ID"))
+
+	if date := msg.Header.Get("Date"); date != "" {
+		if t, err := mail.ParseDate(date); err == nil {
+			e.Date = &t
+		} else {
+			e.Defects = append(e.Defects, fmt.Sprintf("unparseable Date header: %q", date))
+		}
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+	e.walk(textproto.MIMEHeader(msg.Header), body, "1", "", 0)
+
+	e.URLs = e.extractURLs()
+	for _, value := range e.HeaderValues("Authentication-Results") {
+		e.AuthResults = append(e.AuthResults, ParseAuthResults(value)...)
+	}
+
+	return e, nil
+}
+
+// walk records a MIME entity and, for containers, its children.
+func (e *ParsedEmail) walk(header textproto.MIMEHeader, body []byte, path, parent string, depth int) {
+	if len(e.Parts) >= MaxParts {
+		if len(e.Parts) == MaxParts {
+			e.Defects = append(e.Defects, fmt.Sprintf("part limit of %d reached; remaining parts ignored", MaxParts))
+		}
+		return
+	}
+
+	part := Part{
+		Path:             path,
+		Parent:           parent,
+		Depth:            depth,
+		ContentType:      "text/plain",
+		TransferEncoding: strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))),
+		ContentID:        strings.Trim(strings.TrimSpace(header.Get("Content-ID")), "<>"),
+		EncodedSize:      len(body),
+	}
+
+	params := map[string]string{}
+	if ct := header.Get("Content-Type"); ct != "" {
+		mediaType, p, err := mime.ParseMediaType(ct)
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: malformed Content-Type %q", path, ct))
+		} else {
+			part.ContentType = mediaType
+			params = p
+		}
+	}
+	part.Charset = strings.ToLower(params["charset"])
+	part.Boundary = params["boundary"]
+	part.Filename = params["name"]
+
+	if cd := header.Get("Content-Disposition"); cd != "" {
+		disposition, p, err := mime.ParseMediaType(cd)
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: malformed Content-Disposition %q", path, cd))
+		} else {
+			part.Disposition = disposition
+			if p["filename"] != "" {
+				part.Filename = p["filename"]
+			}
+		}
+	}
+	if decoded, err := headerDecoder.DecodeHeader(part.Filename); err == nil {
+		part.Filename = decoded
+	}
+
+	index := len(e.Parts)
+	e.Parts = append(e.Parts, part)
+
+	switch {
+	case strings.HasPrefix(part.ContentType, "multipart/"):
+		e.Parts[index].Size = len(body)
+		if depth >= MaxMIMEDepth {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: nesting deeper than %d levels ignored", path, MaxMIMEDepth))
+			return
+		}
+		if part.Boundary == "" {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: multipart without boundary", path))
+			return
+		}
+		e.Parts[index].Preamble, e.Parts[index].Epilogue, e.Parts[index].Unterminated = delimiters(body, part.Boundary)
+		e.walkMultipart(body, part.Boundary, path, depth)
+
+	case part.ContentType == "message/rfc822":
+		e.Parts[index].Size = len(body)
+		if depth >= MaxMIMEDepth {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: nesting deeper than %d levels ignored", path, MaxMIMEDepth))
+			return
+		}
+		content := e.decodeTransfer(body, part.TransferEncoding, path)
+		inner, err := mail.ReadMessage(bytes.NewReader(content))
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: unreadable embedded message", path))
+			return
+		}
+		innerBody, _ := io.ReadAll(inner.Body)
+		e.walk(textproto.MIMEHeader(inner.Header), innerBody, path+".1", path, depth+1)
+
+	default:
+		content := e.decodeTransfer(body, part.TransferEncoding, path)
+		e.Parts[index].Content = content
+		e.Parts[index].Size = len(content)
+		if strings.HasPrefix(part.ContentType, "text/") {
+			e.Parts[index].Text = decodeCharset(content, part.Charset)
+		}
+	}
+}
+
+func (e *ParsedEmail) walkMultipart(body []byte, boundary, path string, depth int) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for i := 1; ; i++ {
+		p, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			if i == 1 {
+				e.Defects = append(e.Defects, fmt.Sprintf("part %s: no parts found for boundary %q", path, boundary))
+			}
+			return
+		}
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: %v", path, err))
+			return
+		}
+		content, err := io.ReadAll(p)
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s.%d: truncated: %v", path, i, err))
+		}
+		e.walk(p.Header, content, path+"."+strconv.Itoa(i), path, depth+1)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// delimiters locates the boundary delimiter lines of a multipart body. It
+// returns the bytes of text around them, without whitespace, before the
+// first and after the closing delimiter, and whether the closing delimiter
+// is missing. A body without any delimiter has neither.
+func delimiters(body []byte, boundary string) (preamble, epilogue int, unterminated bool) {
+	dash := []byte("--" + boundary)
+	first, end := -1, -1
+	for offset := 0; offset < len(body) && end < 0; {
+		line, next := body[offset:], len(body)
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, next = line[:i], offset+i+1
+		}
+		if rest, ok := bytes.CutPrefix(bytes.TrimRight(line, " \t\r"), dash); ok {
+			if first < 0 && (len(rest) == 0 || string(rest) == "--") {
+				first = offset
+			}
+			if string(rest) == "--" {
+				end = next
+			}
+		}
+		offset = next
+	}
+	if first < 0 {
+		return 0, 0, false
+	}
+	preamble = len(bytes.Join(bytes.Fields(body[:first]), nil))
+	if end < 0 {
+		return preamble, 0, true
+	}
+	return preamble, len(bytes.Join(bytes.Fields(body[end:]), nil)), false
+}
+
+func (e *ParsedEmail) decodeTransfer(body []byte, encoding, path string) []byte {
+	switch encoding {
+	case "base64":
+		cleaned := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, body)
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(cleaned)))
+		n, err := base64.StdEncoding.Decode(decoded, cleaned)
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: invalid base64 content", path))
+		}
+		return decoded[:n]
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+		if err != nil {
+			e.Defects = append(e.Defects, fmt.Sprintf("part %s: invalid quoted-printable content", path))
+		}
+		return decoded
+	default:
+		return body
+	}
+}
+
+func (e *ParsedEmail) addressList(header mail.Header, name string) []Address {
+	value := header.Get(name)
+	if value == "" {
+		return nil
+	}
+	list, err := (&mail.AddressParser{WordDecoder: headerDecoder}).ParseList(value)
+	if err != nil {
+		e.Defects = append(e.Defects, fmt.Sprintf("unparseable %s header: %q", name, value))
+		return nil
+	}
+	addresses := make([]Address, 0, len(list))
+	for _, a := range list {
+		addresses = append(addresses, Address{Name: a.Name, Address: a.Address})
+	}
+	return addresses
+}
+
+// extractURLs collects unique URLs from text and HTML parts, in order of
+// first appearance.
+func (e *ParsedEmail) extractURLs() []string {
+	seen := make(map[string]bool)
+	urls := make([]string, 0)
+	add := func(u string) {
+		u = strings.TrimRight(u, ".,;:!?)")
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	for _, p := range e.Parts {
+		if p.Text == "" {
+			continue
+		}
+		text := p.Text
+		if p.ContentType == "text/html" {
+			for _, m := range hrefRegex.FindAllStringSubmatch(text, -1) {
+				u := html.UnescapeString(m[1])
+				if urlRegex.MatchString(u) {
+					add(u)
+				}
+			}
+			text = html.UnescapeString(text)
+		}
+		for _, u := range urlRegex.FindAllString(text, -1) {
+			add(u)
+		}
+	}
+	return urls
+}
+
+// parseHeaderBlock returns the unfolded header fields in their original order.
+func parseHeaderBlock(raw string) []Header {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+	if i := strings.Index(raw, "\n\n"); i >= 0 {
+		raw = raw[:i]
+	}
+
+	headers := make([]Header, 0)
+	for _, line := range strings.Split(raw, "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			last := &headers[len(headers)-1]
+			last.RawValue += " " + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		headers = append(headers, Header{Name: strings.TrimSpace(name), RawValue: strings.TrimSpace(value)})
+	}
+
+	for i := range headers {
+		decoded, err := headerDecoder.DecodeHeader(headers[i].RawValue)
+		if err != nil {
+			decoded = headers[i].RawValue
+		}
+		headers[i].Value = decoded
+		if decoded == headers[i].RawValue {
+			headers[i].RawValue = ""
+		}
+	}
+	return headers
+}
+
+// ParseAuthResults parses an Authentication-Results header value (RFC 8601).
+func ParseAuthResults(value string) []AuthResult {
+	value = stripComments(value)
+	fields := strings.Split(value, ";")
+	authServID := strings.Fields(strings.TrimSpace(fields[0]))
+
+	var results []AuthResult
+	for _, field := range fields[1:] {
+		tokens := strings.Fields(field)
+		if len(tokens) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(tokens[0], "=")
+		if !ok || method == "" {
+			continue
+		}
+		ar := AuthResult{
+			Method: strings.ToLower(method),
+			Result: strings.ToLower(result),
+		}
+		if len(authServID) > 0 {
+			ar.AuthServID = authServID[0]
+		}
+		for _, token := range tokens[1:] {
+			key, val, ok := strings.Cut(token, "=")
+			if !ok {
+				continue
+			}
+			if strings.EqualFold(key, "reason") {
+				ar.Reason = strings.Trim(val, `"`)
+				continue
+			}
+			if ar.Properties == nil {
+				ar.Properties = make(map[string]string)
+			}
+			ar.Properties[strings.ToLower(key)] = strings.Trim(val, `"`)
+		}
+		results = append(results, ar)
+	}
+	return results
+}
+
+// stripComments removes RFC 5322 parenthesized comments.
+func stripComments(s string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// decodeCharset converts text content to UTF-8, falling back to the raw
+// bytes when the charset is unknown.
+func decodeCharset(content []byte, charset string) string {
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(content)
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(content)
+	}
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return string(content)
+	}
+	return string(decoded)
+}
@@ -0,0 +1,277 @@
+// Package objectstore is a minimal read-only client for S3-compatible object
+// storage such as Amazon S3 and MinIO.
+//
+// The client only fetches objects, with GET requests signed with AWS
+// Signature Version 4. It has no way to write, delete or list objects.
+//
+// Security considerations:
+//   - The secret key never leaves the process; requests carry a signature
+//   - Object sizes are bounded, before and while reading
+//   - Keys with "." or ".." path segments are rejected, as some servers
+//     normalize them and would read outside the requested prefix
+package objectstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// ErrNotFound is returned for a missing bucket or object.
+var ErrNotFound = errors.New("object not found")
+
+// Object is a fetched object.
+type Object struct {
+	Size         int64
+	ETag         string
+	LastModified *time.Time
+	Content      []byte
+}
+
+// Client reads objects from one S3-compatible endpoint.
+type Client struct {
+	endpoint    *url.URL
+	region      string
+	pathStyle   bool
+	credentials Credentials
+	http        *http.Client
+}
+
+// Credentials sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// New returns a client for the endpoint in cfg.
+func New(cfg config.ObjectStoreConfig) (*Client, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object store endpoint: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object store CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("object store CA file %s holds no certificates", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &Client{
+		endpoint:  endpoint,
+		region:    cfg.Region,
+		pathStyle: cfg.PathStyle,
+		credentials: Credentials{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			SessionToken:    cfg.SessionToken,
+		},
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// A redirect would be followed without a valid signature
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// ValidKey reports whether key can be fetched: non-empty, without a leading
+// slash, control characters, or "." and ".." segments.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 1024 || strings.HasPrefix(key, "/") {
+		return false
+	}
+	if strings.ContainsFunc(key, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return false
+	}
+	return !slices.ContainsFunc(strings.Split(key, "/"), func(segment string) bool {
+		return segment == "." || segment == ".."
+	})
+}
+
+// Get fetches an object. Objects larger than maxSize are rejected.
+func (c *Client) Get(ctx context.Context, bucket, key string, maxSize int64) (*Object, error) {
+	if !ValidKey(key) {
+		return nil, fmt.Errorf("invalid object key %q", key)
+	}
+
+	u := *c.endpoint
+	escaped := escapePath(key)
+	if c.pathStyle {
+		u.Path = "/" + bucket + "/" + key
+		u.RawPath = "/" + bucket + "/" + escaped
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escaped
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	SignV4(req, c.credentials, c.region, time.Now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("object store request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("object size %d exceeds limit of %d bytes", resp.ContentLength, maxSize)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("object exceeds size limit of %d bytes", maxSize)
+	}
+
+	object := &Object{
+		Size:    int64(len(content)),
+		ETag:    strings.Trim(resp.Header.Get("ETag"), `"`),
+		Content: content,
+	}
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.LastModified = &t
+	}
+	return object, nil
+}
+
+// responseError turns an S3 error response into an error naming its code.
+func responseError(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case body.Code != "":
+		return fmt.Errorf("object store error %s: %s", body.Code, body.Message)
+	default:
+		return fmt.Errorf("object store error: %s", resp.Status)
+	}
+}
+
+// SignV4 signs req for S3 with AWS Signature Version 4 at time now. The
+// host, Range and X-Amz-* headers are signed; the payload must be empty.
+func SignV4(req *http.Request, creds Credentials, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalQuery(values url.Values) string {
+	pairs := make([]string, 0, len(values))
+	for name, vals := range values {
+		for _, v := range vals {
+			pairs = append(pairs, escape(name)+"="+escape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapePath encodes a key for the request path as SigV4 expects: every
+// byte but the unreserved characters and "/" is percent-encoded.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,322 @@
+// Package ocr reads the text of the images of image-only messages with the
+// tesseract OCR engine.
+//
+// Image spam carries its pitch as a picture with little or no text around
+// it, which leaves body rules and phishing heuristics nothing to match.
+// Extract runs tesseract on the images of such a message, and Augment adds
+// the text read to the message as an extra text/plain part, which
+// SpamAssassin and the phishing heuristics then see like any other body
+// text. No OCR engine written in Go comes close to tesseract, so there is
+// no fallback: without tesseract, Extract fails with ErrUnavailable.
+//
+// Security considerations:
+//   - tesseract is executed directly, never through a shell, with a minimal
+//     environment, and reads the image from stdin
+//   - Each image is bounded by a timeout and the whole message by a time
+//     budget. Images are read one at a time with OMP_THREAD_LIMIT=1, so a
+//     message never occupies more than one CPU core
+//   - Only PNG, JPEG and GIF images within the pixel limit are read, and the
+//     text captured per image is size-limited
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/model"
+)
+
+const (
+	// imageOnlyWords is the number of words of text a message must have to
+	// not count as image-only.
+	imageOnlyWords = 10
+
+	// maxText bounds the text captured from one image.
+	maxText = 64 * 1024
+)
+
+// ErrUnavailable is returned when tesseract cannot be run.
+var ErrUnavailable = errors.New("tesseract is not available")
+
+// Image is the text read from one image part. Error says why an image was
+// skipped or could not be read.
+type Image struct {
+	Part  string `json:"part"`
+	Text  string `json:"text"`
+	Error string `json:"error,omitempty"`
+}
+
+// Result is the text read from the images of a message.
+type Result struct {
+	// ImageOnly is set when the message has an image and fewer than ten
+	// words of text of its own; the images of other messages are not read.
+	ImageOnly bool    `json:"image_only"`
+	Images    []Image `json:"images"`
+	// Text joins the text of every image, one image per paragraph.
+	Text       string   `json:"text,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// Engine runs tesseract.
+type Engine struct {
+	binary    string
+	languages string
+	timeout   time.Duration
+	budget    time.Duration
+	maxImages int
+	maxPixels int
+}
+
+// New creates an engine for cfg.
+func New(cfg config.OCRConfig) *Engine {
+	return &Engine{
+		binary:    cfg.Tesseract,
+		languages: strings.Join(cfg.Languages, "+"),
+		timeout:   cfg.Timeout,
+		budget:    cfg.Budget,
+		maxImages: cfg.MaxImages,
+		maxPixels: cfg.MaxPixels,
+	}
+}
+
+// ImageOnly reports whether email has at least one image but fewer than
+// ten words in its text and HTML parts.
+func ImageOnly(email *model.ParsedEmail) bool {
+	hasImage := false
+	for _, p := range email.Parts {
+		if strings.HasPrefix(p.ContentType, "image/") && len(p.Content) > 0 {
+			hasImage = true
+			break
+		}
+	}
+	if !hasImage {
+		return false
+	}
+	text := email.TextBody() + " " + visibleText(email.HTMLBody())
+	return len(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})) < imageOnlyWords
+}
+
+// Extract reads the text of the images of email when it is image-only.
+// Images that cannot be read are reported in the result; an error is only
+// returned when tesseract cannot be run at all.
+func (e *Engine) Extract(ctx context.Context, email *model.ParsedEmail) (*Result, error) {
+	start := time.Now()
+	result := &Result{ImageOnly: ImageOnly(email), Images: make([]Image, 0)}
+	if !result.ImageOnly {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.budget)
+	defer cancel()
+
+	var texts []string
+	for _, p := range email.Parts {
+		if !strings.HasPrefix(p.ContentType, "image/") || len(p.Content) == 0 {
+			continue
+		}
+		if len(result.Images) == e.maxImages {
+			result.Errors = append(result.Errors, fmt.Sprintf("ocr: images after the first %d skipped", e.maxImages))
+			break
+		}
+		if ctx.Err() != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("ocr: time budget of %s exhausted, part %s and later images skipped", e.budget, p.Path))
+			break
+		}
+		img := Image{Part: p.Path}
+		text, err := e.read(ctx, p.Content)
+		if errors.Is(err, ErrUnavailable) {
+			return nil, err
+		}
+		if err != nil {
+			img.Error = err.Error()
+			result.Errors = append(result.Errors, fmt.Sprintf("ocr part %s: %v", p.Path, err))
+		}
+		img.Text = text
+		if text != "" {
+			texts = append(texts, text)
+		}
+		result.Images = append(result.Images, img)
+	}
+	result.Text = strings.Join(texts, "\n\n")
+	result.DurationMS = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// read runs tesseract on one image and returns the text it recognized,
+// with blank lines and surrounding space removed.
+func (e *Engine) read(ctx context.Context, content []byte) (string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("not a PNG, JPEG or GIF image")
+	}
+	if cfg.Width*cfg.Height > e.maxPixels {
+		return "", fmt.Errorf("%dx%d %s image exceeds the limit of %d pixels", cfg.Width, cfg.Height, format, e.maxPixels)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	args := []string{"stdin", "stdout"}
+	if e.languages != "" {
+		args = append(args, "-l", e.languages)
+	}
+	cmd := exec.CommandContext(ctx, e.binary, args...)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME"), "LANG=C", "OMP_THREAD_LIMIT=1"}
+	cmd.Stdin = bytes.NewReader(content)
+	out := &cappedBuffer{max: maxText}
+	var stderr cappedBuffer
+	stderr.max = 4096
+	cmd.Stdout, cmd.Stderr = out, &stderr
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("tesseract did not finish within %s", e.timeout)
+	case errors.As(err, &exitErr):
+		return "", fmt.Errorf("tesseract failed with exit status %d: %s", exitErr.ExitCode(), firstLine(stderr.String()))
+	case err != nil:
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Augment returns the raw message of email with text added as a final
+// text/plain part, wrapping the original body in a multipart/mixed
+// container. The original headers other than the MIME ones are kept.
+func Augment(email *model.ParsedEmail, text string) string {
+	raw := email.Raw
+	headerEnd, sep := strings.Index(raw, "\r\n\r\n"), "\r\n"
+	if lf := strings.Index(raw, "\n\n"); headerEnd < 0 || lf >= 0 && lf < headerEnd {
+		headerEnd, sep = lf, "\n"
+	}
+	header, body := raw, ""
+	if headerEnd >= 0 {
+		header, body = raw[:headerEnd+len(sep)], raw[headerEnd+2*len(sep):]
+	}
+
+	// Split the header into fields, each with its continuation lines
+	var kept, mime []string
+	lines := strings.SplitAfter(header, "\n")
+	for i := 0; i < len(lines); {
+		field := lines[i]
+		for i++; i < len(lines) && (strings.HasPrefix(lines[i], " ") || strings.HasPrefix(lines[i], "\t")); i++ {
+			field += lines[i]
+		}
+		if field == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(field, ":")
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "content-") {
+			mime = append(mime, field)
+		} else {
+			kept = append(kept, field)
+		}
+	}
+	if len(mime) == 0 {
+		mime = []string{"Content-Type: text/plain; charset=us-ascii" + sep}
+	}
+
+	boundary := "ocr-" + randomHex()
+	var b strings.Builder
+	for _, field := range kept {
+		if !strings.HasPrefix(strings.ToLower(field), "mime-version:") {
+			b.WriteString(field)
+		}
+	}
+	b.WriteString("MIME-Version: 1.0" + sep)
+	b.WriteString(`Content-Type: multipart/mixed; boundary="` + boundary + `"` + sep + sep)
+	b.WriteString("--" + boundary + sep)
+	for _, field := range mime {
+		b.WriteString(field)
+	}
+	b.WriteString(sep + body)
+	if !strings.HasSuffix(body, "\n") {
+		b.WriteString(sep)
+	}
+	b.WriteString("--" + boundary + sep)
+	b.WriteString("Content-Type: text/plain; charset=utf-8" + sep)
+	b.WriteString("Content-Transfer-Encoding: 8bit" + sep)
+	b.WriteString("Content-Disposition: inline" + sep + sep)
+	b.WriteString(strings.ReplaceAll(text, "\n", sep) + sep)
+	b.WriteString("--" + boundary + "--" + sep)
+	return b.String()
+}
+
+func randomHex() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// visibleText returns the text content of an HTML document, without
+// scripts and style sheets.
+func visibleText(doc string) string {
+	var b strings.Builder
+	skip := ""
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip = string(name)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skip {
+				skip = ""
+			}
+		case html.TextToken:
+			if skip == "" {
+				b.Write(z.Text())
+				b.WriteString(" ")
+			}
+		}
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
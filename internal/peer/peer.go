@@ -0,0 +1,94 @@
+// Package peer carries the identity of the remote client through request
+// contexts, so handlers can attribute and limit requests per client.
+//
+// The HTTP transport records the remote address of the connection that
+// established an MCP session and, when configured, the API key or bearer
+// token it authenticated with and the common name of its TLS client
+// certificate. The stdio transport has no remote peer and handlers fall back
+// to the MCP session itself.
+package peer
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type addrKey struct{}
+
+// WithAddr returns a context carrying the remote address (host only).
+func WithAddr(ctx context.Context, addr string) context.Context {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return context.WithValue(ctx, addrKey{}, addr)
+}
+
+// Addr returns the remote address stored in ctx, or "" if there is none.
+func Addr(ctx context.Context) string {
+	addr, _ := ctx.Value(addrKey{}).(string)
+	return addr
+}
+
+// Middleware records the remote address of each HTTP request, and the
+// verified client certificate's common name when mutual TLS is used, in its
+// context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithAddr(r.Context(), r.RemoteAddr)
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			ctx = WithCertCN(ctx, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type certCNKey struct{}
+
+// WithCertCN returns a context carrying the common name of the client's
+// verified TLS certificate.
+func WithCertCN(ctx context.Context, cn string) context.Context {
+	return context.WithValue(ctx, certCNKey{}, cn)
+}
+
+// CertCN returns the verified client certificate common name stored in ctx,
+// or "" if the client did not present one.
+func CertCN(ctx context.Context) string {
+	cn, _ := ctx.Value(certCNKey{}).(string)
+	return cn
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the name of the authenticated
+// credential (e.g. an API key name) used by the client.
+func WithPrincipal(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, principalKey{}, name)
+}
+
+// Principal returns the authenticated credential name stored in ctx, or "" if
+// the request was not authenticated.
+func Principal(ctx context.Context) string {
+	name, _ := ctx.Value(principalKey{}).(string)
+	return name
+}
+
+// Token is the verified identity carried by an OIDC bearer token.
+type Token struct {
+	Subject string
+	Claims  map[string]any
+}
+
+type tokenKey struct{}
+
+// WithToken returns a context carrying a verified bearer token.
+func WithToken(ctx context.Context, tok *Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, tok)
+}
+
+// TokenFrom returns the verified bearer token stored in ctx, or nil if the
+// request did not authenticate with one.
+func TokenFrom(ctx context.Context) *Token {
+	tok, _ := ctx.Value(tokenKey{}).(*Token)
+	return tok
+}
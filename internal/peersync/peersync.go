@@ -0,0 +1,521 @@
+// Package peersync shares the reputation accumulated in the scan history
+// between spamassassin-mcp instances, so that sites running their own
+// instance benefit from what the others have seen.
+//
+// An instance with peer_sync.token set serves a snapshot of its recent scan
+// history at Path: how often each sender domain, and optionally each sender
+// address, was scanned and found to be spam or complained about, and the
+// same counts per campaign fingerprint, the fuzzy hash of a message body.
+// Instances listing it in peer_sync.peers fetch the snapshot periodically
+// and report the peer's view alongside their own in check_reputation and
+// find_similar.
+//
+// Security considerations:
+//   - Snapshots are served only to clients presenting the bearer token, which
+//     is compared in constant time; fetches never follow redirects, so the
+//     token is only ever sent to the configured peer
+//   - Message content and hashes are never shared; fingerprints are fuzzy
+//     hashes, from which the body text cannot be recovered
+//   - Sender addresses are shared only with share_senders; otherwise only
+//     their domains are
+//   - Snapshots are bounded by max_entries when served and by max_size when
+//     fetched, and peer data is only reported, never acted on
+package peersync
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/similarity"
+)
+
+// Path is where snapshots are served on the HTTP transport.
+const Path = "/peer/v1/reputation"
+
+// cacheTTL is how long a served snapshot is reused, so frequent fetches do
+// not each read the history.
+const cacheTTL = time.Minute
+
+// Snapshot is the reputation an instance shares with its peers.
+type Snapshot struct {
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Window       string         `json:"window"`
+	Senders      []*Source      `json:"senders,omitempty"`
+	Domains      []*Source      `json:"domains"`
+	Fingerprints []*Fingerprint `json:"fingerprints"`
+}
+
+// Source counts the scans of mail from a sender address or domain. Spam
+// counts the scans with a spam verdict and Complaints the feedback-loop
+// complaints, which are not counted as scans.
+type Source struct {
+	Value      string    `json:"value"`
+	Scans      int       `json:"scans"`
+	Spam       int       `json:"spam"`
+	Complaints int       `json:"complaints,omitempty"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Fingerprint counts the scans of messages with a body fuzzy hash, as
+// Source does for senders.
+type Fingerprint struct {
+	FuzzyHash  string    `json:"fuzzy_hash"`
+	Scans      int       `json:"scans"`
+	Spam       int       `json:"spam"`
+	Complaints int       `json:"complaints,omitempty"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Build summarizes the entries of store scanned in the window before now,
+// keeping at most maxEntries sources and fingerprints of each kind, the most
+// scanned first. Sender addresses are included only when shareSenders is
+// set.
+func Build(ctx context.Context, store history.Store, window time.Duration, shareSenders bool, maxEntries int, now time.Time) (*Snapshot, error) {
+	senders := make(map[string]*Source)
+	domains := make(map[string]*Source)
+	fingerprints := make(map[string]*Fingerprint)
+
+	// Entries come newest first
+	err := store.Walk(ctx, history.Criteria{From: now.Add(-window)}, func(e *history.Entry) error {
+		if e.Sender != "" {
+			if shareSenders {
+				count(senders, e.Sender, e)
+			}
+			if _, domain, ok := strings.Cut(e.Sender, "@"); ok && domain != "" {
+				count(domains, domain, e)
+			}
+		}
+		if e.FuzzyHash != "" {
+			f := fingerprints[e.FuzzyHash]
+			if f == nil {
+				f = &Fingerprint{FuzzyHash: e.FuzzyHash, LastSeen: e.ScannedAt}
+				fingerprints[e.FuzzyHash] = f
+			}
+			f.FirstSeen = e.ScannedAt
+			tally(&f.Scans, &f.Spam, &f.Complaints, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		GeneratedAt:  now.UTC(),
+		Window:       window.String(),
+		Senders:      top(senders, maxEntries, func(s *Source) (int, string) { return s.Scans + s.Complaints, s.Value }),
+		Domains:      top(domains, maxEntries, func(s *Source) (int, string) { return s.Scans + s.Complaints, s.Value }),
+		Fingerprints: top(fingerprints, maxEntries, func(f *Fingerprint) (int, string) { return f.Scans + f.Complaints, f.FuzzyHash }),
+	}, nil
+}
+
+func count(sources map[string]*Source, value string, e *history.Entry) {
+	s := sources[value]
+	if s == nil {
+		s = &Source{Value: value, LastSeen: e.ScannedAt}
+		sources[value] = s
+	}
+	tally(&s.Scans, &s.Spam, &s.Complaints, e)
+}
+
+func tally(scans, spam, complaints *int, e *history.Entry) {
+	switch {
+	case e.Complaint:
+		*complaints++
+	case e.IsSpam:
+		*spam++
+		fallthrough
+	default:
+		*scans++
+	}
+}
+
+// top returns at most n values of m, ordered by decreasing weight and then
+// by key.
+func top[T any](m map[string]*T, n int, weight func(*T) (int, string)) []*T {
+	values := make([]*T, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	slices.SortFunc(values, func(a, b *T) int {
+		wa, ka := weight(a)
+		wb, kb := weight(b)
+		return cmp.Or(cmp.Compare(wb, wa), strings.Compare(ka, kb))
+	})
+	if len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
+
+// NewServer returns the handler serving the snapshot of store to peers
+// presenting cfg.Token.
+func NewServer(cfg config.PeerSyncConfig, store history.Store) http.Handler {
+	return &server{cfg: cfg, store: store}
+}
+
+type server struct {
+	cfg   config.PeerSyncConfig
+	store history.Store
+
+	mu       sync.Mutex
+	snapshot []byte
+	built    time.Time
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+		logrus.WithField("remote_addr", r.RemoteAddr).Warn("Rejected peer reputation request with a missing or invalid token")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="spamassassin-mcp peer sync"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := s.current(r.Context())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to build peer reputation snapshot")
+		http.Error(w, "failed to build snapshot", http.StatusInternalServerError)
+		return
+	}
+	logrus.WithField("remote_addr", r.RemoteAddr).Info("Served peer reputation snapshot")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// current returns the encoded snapshot, rebuilding it when older than
+// cacheTTL.
+func (s *server) current(ctx context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.snapshot != nil && now.Sub(s.built) < cacheTTL {
+		return s.snapshot, nil
+	}
+	snapshot, err := Build(ctx, s.store, s.cfg.Window, s.cfg.ShareSenders, s.cfg.MaxEntries, now)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	s.snapshot, s.built = data, now
+	return data, nil
+}
+
+// Report is what a peer saw of a sender address or domain.
+type Report struct {
+	Peer string `json:"peer"`
+	Kind string `json:"kind"`
+	Source
+}
+
+// Kinds of reports.
+const (
+	KindSender = "sender"
+	KindDomain = "domain"
+)
+
+// Match is a campaign fingerprint of a peer similar to a sample.
+type Match struct {
+	Peer       string `json:"peer"`
+	Similarity int    `json:"similarity"`
+	Fingerprint
+}
+
+// Status is the synchronization state of a peer.
+type Status struct {
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	LastSync     *time.Time `json:"last_sync,omitempty"`
+	LastAttempt  *time.Time `json:"last_attempt,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	GeneratedAt  *time.Time `json:"generated_at,omitempty"`
+	Senders      int        `json:"senders"`
+	Domains      int        `json:"domains"`
+	Fingerprints int        `json:"fingerprints"`
+}
+
+// Syncer fetches the snapshots of the configured peers.
+type Syncer struct {
+	peers      []*remote
+	window     time.Duration
+	interval   time.Duration
+	maxSize    int64
+	maxEntries int
+	http       *http.Client
+}
+
+type remote struct {
+	cfg config.PeerConfig
+
+	mu          sync.RWMutex
+	snapshot    *Snapshot
+	senders     map[string]*Source
+	domains     map[string]*Source
+	lastSync    time.Time
+	lastAttempt time.Time
+	lastError   string
+}
+
+// New returns a syncer for the peers in cfg, or nil when none is
+// configured. Fetching starts with Run.
+func New(cfg config.PeerSyncConfig) *Syncer {
+	if len(cfg.Peers) == 0 {
+		return nil
+	}
+	s := &Syncer{
+		window:     cfg.Window,
+		interval:   cfg.Interval,
+		maxSize:    cfg.MaxSize,
+		maxEntries: cfg.MaxEntries,
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	for _, peer := range cfg.Peers {
+		s.peers = append(s.peers, &remote{cfg: peer})
+	}
+	return s
+}
+
+// Run fetches every peer right away and then every interval until ctx is
+// done. Failures are logged and keep the previous snapshot.
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			logrus.WithError(err).Warn("Failed to fetch peer reputation")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches every peer once and returns the failures.
+func (s *Syncer) Sync(ctx context.Context) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, peer := range s.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.sync(ctx, peer); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("peer %s: %w", peer.cfg.Name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *Syncer) sync(ctx context.Context, peer *remote) error {
+	snapshot, err := s.fetch(ctx, peer.cfg)
+	now := time.Now()
+
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	peer.lastAttempt = now
+	if err != nil {
+		peer.lastError = err.Error()
+		return err
+	}
+	peer.snapshot, peer.lastSync, peer.lastError = snapshot, now, ""
+	peer.senders = index(snapshot.Senders)
+	peer.domains = index(snapshot.Domains)
+	logrus.WithFields(logrus.Fields{
+		"peer":         peer.cfg.Name,
+		"senders":      len(snapshot.Senders),
+		"domains":      len(snapshot.Domains),
+		"fingerprints": len(snapshot.Fingerprints),
+	}).Debug("Fetched peer reputation")
+	return nil
+}
+
+// fetch downloads and checks the snapshot of peer.
+func (s *Syncer) fetch(ctx context.Context, peer config.PeerConfig) (*Snapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(peer.URL, "/")+Path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+peer.Token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch failed: %w", err)
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, fmt.Errorf("snapshot exceeds peer_sync.max_size")
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	snapshot.Senders = clean(snapshot.Senders, s.maxEntries, func(src *Source) bool {
+		src.Value = strings.ToLower(src.Value)
+		return strings.Contains(src.Value, "@") && valid(src.Scans, src.Spam, src.Complaints)
+	})
+	snapshot.Domains = clean(snapshot.Domains, s.maxEntries, func(src *Source) bool {
+		src.Value = strings.ToLower(strings.TrimSuffix(src.Value, "."))
+		return src.Value != "" && !strings.Contains(src.Value, "@") && valid(src.Scans, src.Spam, src.Complaints)
+	})
+	snapshot.Fingerprints = clean(snapshot.Fingerprints, s.maxEntries, func(f *Fingerprint) bool {
+		return f.FuzzyHash != "" && valid(f.Scans, f.Spam, f.Complaints)
+	})
+	return &snapshot, nil
+}
+
+// clean drops the nil values and those keep rejects, and caps the rest at
+// n, so a misbehaving peer cannot exceed the limits of this instance.
+func clean[T any](values []*T, n int, keep func(*T) bool) []*T {
+	values = slices.DeleteFunc(values, func(v *T) bool { return v == nil || !keep(v) })
+	if len(values) > n {
+		values = values[:n]
+	}
+	return values
+}
+
+func valid(scans, spam, complaints int) bool {
+	return scans >= 0 && complaints >= 0 && spam >= 0 && spam <= scans
+}
+
+func index(sources []*Source) map[string]*Source {
+	m := make(map[string]*Source, len(sources))
+	for _, src := range sources {
+		m[src.Value] = src
+	}
+	return m
+}
+
+// current reports whether the peer holds a snapshot fetched within the
+// window. It must be called with peer.mu held.
+func (s *Syncer) current(peer *remote) bool {
+	return peer.snapshot != nil && time.Since(peer.lastSync) <= s.window
+}
+
+// Reputation returns what the peers saw of sender and its domain, either of
+// which may be empty. Reputation on a nil Syncer returns nothing.
+func (s *Syncer) Reputation(sender, domain string) []Report {
+	if s == nil {
+		return nil
+	}
+	sender = strings.ToLower(sender)
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	var reports []Report
+	for _, peer := range s.peers {
+		peer.mu.RLock()
+		if s.current(peer) {
+			if src, ok := peer.senders[sender]; ok && sender != "" {
+				reports = append(reports, Report{Peer: peer.cfg.Name, Kind: KindSender, Source: *src})
+			}
+			if src, ok := peer.domains[domain]; ok && domain != "" {
+				reports = append(reports, Report{Peer: peer.cfg.Name, Kind: KindDomain, Source: *src})
+			}
+		}
+		peer.mu.RUnlock()
+	}
+	return reports
+}
+
+// Similar returns the fingerprints of the peers whose similarity to the
+// fuzzy hash is at least minSimilarity, most similar first. Similar on a nil
+// Syncer returns nothing.
+func (s *Syncer) Similar(fuzzyHash string, minSimilarity int) []Match {
+	if s == nil {
+		return nil
+	}
+	var matches []Match
+	for _, peer := range s.peers {
+		peer.mu.RLock()
+		if s.current(peer) {
+			for _, f := range peer.snapshot.Fingerprints {
+				if score := similarity.FuzzyScore(fuzzyHash, f.FuzzyHash); score >= minSimilarity {
+					matches = append(matches, Match{Peer: peer.cfg.Name, Similarity: score, Fingerprint: *f})
+				}
+			}
+		}
+		peer.mu.RUnlock()
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int { return cmp.Compare(b.Similarity, a.Similarity) })
+	return matches
+}
+
+// Status returns the synchronization state of each peer. Status on a nil
+// Syncer returns nothing.
+func (s *Syncer) Status() []Status {
+	if s == nil {
+		return nil
+	}
+	statuses := make([]Status, 0, len(s.peers))
+	for _, peer := range s.peers {
+		peer.mu.RLock()
+		status := Status{Name: peer.cfg.Name, URL: peer.cfg.URL, LastError: peer.lastError}
+		if !peer.lastAttempt.IsZero() {
+			attempt := peer.lastAttempt
+			status.LastAttempt = &attempt
+		}
+		if !peer.lastSync.IsZero() {
+			sync := peer.lastSync
+			status.LastSync = &sync
+		}
+		// Counts cover only data still reported
+		if s.current(peer) {
+			generated := peer.snapshot.GeneratedAt
+			status.GeneratedAt = &generated
+			status.Senders = len(peer.snapshot.Senders)
+			status.Domains = len(peer.snapshot.Domains)
+			status.Fingerprints = len(peer.snapshot.Fingerprints)
+		}
+		peer.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -0,0 +1,59 @@
+package phishing
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// brand is a frequently impersonated organization and the registrable
+// domains it sends mail from.
+type brand struct {
+	name    string
+	pattern *regexp.Regexp
+	domains []string
+}
+
+func newBrand(name, pattern string, domains ...string) brand {
+	return brand{name: name, pattern: regexp.MustCompile(`(?i)\b(?:` + pattern + `)\b`), domains: domains}
+}
+
+// brands are matched in order; the first brand named by the sender wins.
+var brands = []brand{
+	newBrand("PayPal", `pay\s?pal`, "paypal.com", "paypal.me"),
+	newBrand("Microsoft", `microsoft|office\s?365|outlook|onedrive|sharepoint`, "microsoft.com", "office.com", "office365.com", "outlook.com", "live.com", "microsoftonline.com", "sharepoint.com"),
+	newBrand("Apple", `apple|icloud|itunes`, "apple.com", "icloud.com"),
+	newBrand("Amazon", `amazon`, "amazon.com", "amazon.co.uk", "amazon.de", "amazon.fr", "amazon.ca", "amazonses.com"),
+	newBrand("Google", `google|gmail`, "google.com", "youtube.com"),
+	newBrand("Netflix", `netflix`, "netflix.com"),
+	newBrand("DocuSign", `docu\s?sign`, "docusign.com", "docusign.net"),
+	newBrand("Dropbox", `dropbox`, "dropbox.com", "dropboxmail.com"),
+	newBrand("DHL", `dhl`, "dhl.com", "dhl.de"),
+	newBrand("FedEx", `fed\s?ex`, "fedex.com"),
+	newBrand("UPS", `ups`, "ups.com"),
+	newBrand("LinkedIn", `linked\s?in`, "linkedin.com"),
+	newBrand("Facebook", `facebook|meta`, "facebook.com", "facebookmail.com", "meta.com"),
+	newBrand("Instagram", `instagram`, "instagram.com"),
+	newBrand("Chase", `chase`, "chase.com", "jpmorgan.com"),
+	newBrand("Wells Fargo", `wells\s?fargo`, "wellsfargo.com"),
+	newBrand("Bank of America", `bank\s?of\s?america`, "bankofamerica.com", "bofa.com"),
+	newBrand("Coinbase", `coinbase`, "coinbase.com"),
+	newBrand("Adobe", `adobe`, "adobe.com"),
+	newBrand("IRS", `irs|internal\s?revenue\s?service`, "irs.gov"),
+}
+
+// owns reports whether the brand sends mail from the registrable domain.
+func (b brand) owns(domain string) bool {
+	return slices.Contains(b.domains, domain)
+}
+
+// mentionedIn reports whether s names the brand.
+func (b brand) mentionedIn(s string) bool {
+	return b.pattern.MatchString(s)
+}
+
+// token is the brand name as it would appear inside a look-alike domain,
+// e.g. paypal in paypal-secure.com.
+func (b brand) token() string {
+	return strings.ToLower(strings.ReplaceAll(b.name, " ", ""))
+}
@@ -0,0 +1,201 @@
+package phishing
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/urls"
+)
+
+// sensitiveFields are prefixes of input name words that ask for secrets,
+// for fields not declared as password inputs.
+var sensitiveFields = []string{"pass", "pwd", "pin", "otp", "ssn", "cvv", "cvc", "card"}
+
+// Form is an HTML form that asks for credentials. Action is empty when the
+// form submits to the page it is on, and Fields describes the inputs asking
+// for secrets.
+type Form struct {
+	Action string
+	Fields []string
+}
+
+// CredentialForms returns the forms of an HTML document that contain a
+// password input or a field named after a secret.
+func CredentialForms(doc string) []Form {
+	var forms []Form
+	var current *Form
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if current != nil && len(current.Fields) > 0 {
+				forms = append(forms, *current)
+			}
+			return forms
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "form":
+				current = &Form{Action: attr(tok, "action")}
+			case "input":
+				// Inputs outside a form are still submitted by script, so
+				// they are attributed to an implicit form.
+				if current == nil {
+					current = &Form{}
+				}
+				if field := sensitiveField(tok); field != "" {
+					current.Fields = append(current.Fields, field)
+				}
+			}
+
+		case html.EndTagToken:
+			if z.Token().Data == "form" && current != nil {
+				if len(current.Fields) > 0 {
+					forms = append(forms, *current)
+				}
+				current = nil
+			}
+		}
+	}
+}
+
+// sensitiveField returns a description of an input that asks for a secret,
+// or "".
+func sensitiveField(tok html.Token) string {
+	if strings.EqualFold(attr(tok, "type"), "password") {
+		return "password"
+	}
+	words := strings.FieldsFunc(strings.ToLower(attr(tok, "name")+" "+attr(tok, "id")), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	for _, w := range words {
+		for _, s := range sensitiveFields {
+			if strings.HasPrefix(w, s) {
+				return w
+			}
+		}
+	}
+	return ""
+}
+
+// maxAnchorText bounds the link text kept per anchor.
+const maxAnchorText = 200
+
+// linkMismatches returns the links of an HTML document whose text names a
+// different registrable domain than their href, once per text and href.
+// Only names under a real top-level domain count, so file names such as
+// invoice.pdf in link text are not mistaken for hosts.
+func linkMismatches(doc string) []LinkMismatch {
+	var mismatches []LinkMismatch
+	seen := make(map[[2]string]bool)
+	check := func(href, text string) {
+		text = strings.Join(strings.Fields(text), " ")
+		shown := domainRegex.FindString(text)
+		if _, icann := publicsuffix.PublicSuffix(strings.ToLower(shown)); shown == "" || !icann {
+			return
+		}
+		target := href
+		if strings.HasPrefix(strings.ToLower(target), "www.") {
+			target = "http://" + target
+		}
+		normalized, ok := urls.Normalize(target)
+		if !ok {
+			return
+		}
+		u, err := url.Parse(normalized)
+		if err != nil {
+			return
+		}
+		hrefDomain := orgDomain(u.Hostname())
+		if net.ParseIP(u.Hostname()) != nil {
+			hrefDomain = u.Hostname()
+		}
+		textDomain := orgDomain(shown)
+		if textDomain == "" || textDomain == hrefDomain || seen[[2]string{href, text}] {
+			return
+		}
+		seen[[2]string{href, text}] = true
+		mismatches = append(mismatches, LinkMismatch{Text: text, TextDomain: textDomain, Href: href, HrefDomain: hrefDomain})
+	}
+
+	var href string
+	inAnchor := false
+	var text strings.Builder
+	skip := ""
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if inAnchor {
+				check(href, text.String())
+			}
+			return mismatches
+		case html.StartTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "a":
+				if inAnchor {
+					check(href, text.String())
+				}
+				href, inAnchor = strings.TrimSpace(attr(tok, "href")), true
+				text.Reset()
+			case "script", "style":
+				skip = tok.Data
+			}
+		case html.EndTagToken:
+			tok := z.Token()
+			switch {
+			case tok.Data == skip:
+				skip = ""
+			case tok.Data == "a" && inAnchor:
+				check(href, text.String())
+				inAnchor = false
+			}
+		case html.TextToken:
+			if inAnchor && skip == "" && text.Len() < maxAnchorText {
+				text.Write(z.Text())
+			}
+		}
+	}
+}
+
+// visibleText returns the text of an HTML document outside scripts and
+// styles.
+func visibleText(doc string) string {
+	var b strings.Builder
+	skip := ""
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.StartTagToken:
+			if name, _ := z.TagName(); string(name) == "script" || string(name) == "style" {
+				skip = string(name)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skip {
+				skip = ""
+			}
+		case html.TextToken:
+			if skip == "" {
+				b.Write(z.Text())
+				b.WriteString(" ")
+			}
+		}
+	}
+}
+
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
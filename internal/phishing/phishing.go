@@ -0,0 +1,224 @@
+// Package phishing scores a message for phishing with transparent
+// heuristics.
+//
+// Analyze looks for the hallmarks of credential phishing: links whose
+// visible text names a different site than they lead to, a well-known brand
+// in the sender identity of a message sent from an unrelated domain, forms
+// asking for passwords, pressure language, a Reply-To that diverts answers
+// away from the apparent sender, and links hidden in QR codes. Every
+// indicator found is returned as evidence with its weight, and the weights
+// are combined into a likelihood, so analysts can see exactly why a message
+// was rated.
+//
+// The heuristics complement SpamAssassin scoring; they do not query the
+// network.
+package phishing
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/urls"
+)
+
+// Indicators.
+const (
+	LinkTextMismatch   = "link_text_mismatch"
+	BrandImpersonation = "brand_impersonation"
+	CredentialForm     = "credential_form"
+	UrgencyLanguage    = "urgency_language"
+	ReplyToDivergence  = "reply_to_divergence"
+	QRCodeLink         = "qr_code_link"
+)
+
+// weights is the likelihood each indicator contributes on its own.
+var weights = map[string]float64{
+	LinkTextMismatch:   0.35,
+	BrandImpersonation: 0.35,
+	CredentialForm:     0.4,
+	UrgencyLanguage:    0.1,
+	ReplyToDivergence:  0.15,
+	QRCodeLink:         0.3,
+}
+
+// Level is the phishing likelihood band.
+type Level string
+
+const (
+	High   Level = "high"
+	Medium Level = "medium"
+	Low    Level = "low"
+)
+
+// Evidence is one indicator found in a message.
+type Evidence struct {
+	Indicator   string  `json:"indicator"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+}
+
+// Report is the phishing assessment of a message.
+type Report struct {
+	// Likelihood combines the weights of the indicators found as
+	// independent signals: 1 - Π(1 - weight), counting each indicator once.
+	Likelihood float64    `json:"likelihood"`
+	Level      Level      `json:"level"`
+	Evidence   []Evidence `json:"evidence"`
+
+	// LinkMismatches lists every HTML link whose text names a different
+	// site than it leads to.
+	LinkMismatches []LinkMismatch `json:"link_mismatches,omitempty"`
+}
+
+// LinkMismatch is an HTML link whose text names a different registrable
+// domain than its href. HrefDomain is the host itself for IP addresses.
+type LinkMismatch struct {
+	Part       string `json:"part"`
+	Text       string `json:"text"`
+	TextDomain string `json:"text_domain"`
+	Href       string `json:"href"`
+	HrefDomain string `json:"href_domain"`
+}
+
+var (
+	urgencyPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(urgent|immediate(ly)?|right away|as soon as possible|asap)\b`),
+		regexp.MustCompile(`(?i)\bwithin (24|48|72) hours\b|\bwithin \d+ (hours|days)\b`),
+		regexp.MustCompile(`(?i)\b(account|mailbox|access|service)\b[^.\n]{0,40}\b(suspended|locked|disabled|terminated|deactivated|closed|restricted)\b`),
+		regexp.MustCompile(`(?i)\b(verify|confirm|validate|update)\b[^.\n]{0,20}\b(your )?(account|identity|password|payment|billing|information|details)\b`),
+		regexp.MustCompile(`(?i)\b(unusual|suspicious|unauthori[sz]ed) (sign-?in|login|activity|access|transaction)\b`),
+		regexp.MustCompile(`(?i)\b(final (notice|warning|reminder)|action required|last chance|expires? today)\b`),
+		regexp.MustCompile(`(?i)\bpassword\b[^.\n]{0,20}\b(expire[sd]?|expiring)\b`),
+	}
+
+	// domainRegex finds host names in link text.
+	domainRegex = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+)
+
+// Analyze assesses email for phishing.
+func Analyze(email *model.ParsedEmail) *Report {
+	r := &Report{Evidence: make([]Evidence, 0)}
+	add := func(indicator, format string, args ...any) {
+		r.Evidence = append(r.Evidence, Evidence{
+			Indicator:   indicator,
+			Description: fmt.Sprintf(format, args...),
+			Weight:      weights[indicator],
+		})
+	}
+
+	fromDomain := orgDomain(email.FromDomain())
+
+	for _, u := range urls.Extract(email) {
+		// A link only reachable by scanning an image with a phone leaves
+		// the protection of the mail client behind
+		if slices.Contains(u.Sources, urls.SourceQRCode) {
+			add(QRCodeLink, "QR code in an image leads to %s", u.Host)
+		}
+	}
+
+	for _, p := range email.Parts {
+		if p.ContentType != "text/html" || p.Text == "" || p.Disposition == "attachment" {
+			continue
+		}
+		for _, m := range linkMismatches(p.Text) {
+			m.Part = p.Path
+			r.LinkMismatches = append(r.LinkMismatches, m)
+			add(LinkTextMismatch, "link text %q names %s but the link goes to %s", m.Text, m.TextDomain, m.Href)
+		}
+	}
+
+	if len(email.From) > 0 {
+		from := email.From[0]
+		local, _, _ := strings.Cut(strings.ToLower(from.Address), "@")
+		for _, b := range brands {
+			if b.owns(fromDomain) {
+				continue
+			}
+			if b.mentionedIn(from.Name) {
+				add(BrandImpersonation, "sender name %q names %s but the message is from %s", from.Name, b.name, fromDomain)
+				break
+			}
+			if b.mentionedIn(local) || strings.Contains(fromDomain, b.token()) {
+				add(BrandImpersonation, "sender address %s imitates %s", from.Address, b.name)
+				break
+			}
+		}
+	}
+
+	for _, p := range email.Parts {
+		if p.ContentType != "text/html" || p.Text == "" {
+			continue
+		}
+		for _, f := range CredentialForms(p.Text) {
+			where := "message body"
+			if p.IsAttachment() {
+				where = "HTML attachment " + p.Filename
+			}
+			target := "the same page"
+			if f.Action != "" {
+				target = f.Action
+			}
+			add(CredentialForm, "%s contains a form asking for %s that submits to %s", where, strings.Join(f.Fields, ", "), target)
+		}
+	}
+
+	text := email.Subject + "\n" + email.TextBody() + "\n" + visibleText(email.HTMLBody())
+	var phrases []string
+	for _, re := range urgencyPatterns {
+		if m := re.FindString(text); m != "" {
+			phrases = append(phrases, strings.Join(strings.Fields(m), " "))
+		}
+	}
+	if len(phrases) > 0 {
+		add(UrgencyLanguage, "pressure language: %q", phrases)
+		if len(phrases) > 1 {
+			r.Evidence[len(r.Evidence)-1].Weight = 2 * weights[UrgencyLanguage]
+		}
+	}
+
+	for _, rt := range email.ReplyTo {
+		if d := orgDomain(rt.Domain()); d != "" && fromDomain != "" && d != fromDomain {
+			add(ReplyToDivergence, "replies go to %s instead of the sender domain %s", rt.Address, fromDomain)
+			break
+		}
+	}
+
+	r.Likelihood, r.Level = score(r.Evidence)
+	return r
+}
+
+// score combines the strongest evidence of each indicator.
+func score(evidence []Evidence) (float64, Level) {
+	strongest := make(map[string]float64)
+	for _, e := range evidence {
+		strongest[e.Indicator] = math.Max(strongest[e.Indicator], e.Weight)
+	}
+	clean := 1.0
+	for _, w := range strongest {
+		clean *= 1 - w
+	}
+	likelihood := math.Round((1-clean)*100) / 100
+	switch {
+	case likelihood >= 0.7:
+		return likelihood, High
+	case likelihood >= 0.4:
+		return likelihood, Medium
+	}
+	return likelihood, Low
+}
+
+// orgDomain returns the registrable domain of a host name.
+func orgDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	d, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return d
+}
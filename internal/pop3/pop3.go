@@ -0,0 +1,262 @@
+// Package pop3 is a minimal POP3 client (RFC 1939) for scanning the
+// messages of a maildrop without deleting them.
+//
+// The client has no DELE command, and it sends RSET before QUIT so that a
+// session ends without deleting anything even on servers that mark
+// messages for deletion on retrieval. Messages are read with RETR, and
+// headers alone with TOP.
+//
+// Security considerations:
+//   - The password is sent with PASS after the TLS handshake; configuration
+//     validation allows plain connections only to a loopback server
+//   - Response lines and message sizes are bounded, so a hostile server
+//     cannot exhaust memory
+package pop3
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// TLS modes of config.POP3Config.
+const (
+	TLSImplicit = "implicit"
+	TLSStartTLS = "starttls"
+	TLSNone     = "none"
+)
+
+// maxLineLength bounds a response line, including the lines of a message,
+// and maxListing the multi-line responses of LIST and UIDL.
+const (
+	maxLineLength = 1 << 20
+	maxListing    = 16 << 20
+)
+
+// Client is a connection to a POP3 server, logged in. It is not safe for
+// concurrent use.
+type Client struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// Dial connects to the server in cfg and logs in with USER and PASS.
+func Dial(ctx context.Context, cfg config.POP3Config) (*Client, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POP3 address: %w", err)
+	}
+	tlsConfig, err := clientTLSConfig(cfg, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	var conn net.Conn
+	if cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", cfg.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", cfg.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("POP3 connection failed: %w", err)
+	}
+	c := &Client{conn: conn, r: bufio.NewReader(conn), timeout: cfg.Timeout}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.status("greeting"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if cfg.TLS == TLSStartTLS {
+		if _, err := c.command("STLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("POP3 TLS handshake failed: %w", err)
+		}
+		c.conn, c.r = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	if strings.ContainsAny(cfg.Username+cfg.Password, "\r\n") {
+		conn.Close()
+		return nil, errors.New("POP3 credentials must not contain line breaks")
+	}
+	if _, err := c.command("USER " + cfg.Username); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := c.command("PASS " + cfg.Password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func clientTLSConfig(cfg config.POP3Config, host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read POP3 CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("POP3 CA file %s holds no certificates", cfg.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// Close resets the session, so nothing is deleted, and quits.
+func (c *Client) Close() error {
+	c.command("RSET")
+	c.command("QUIT")
+	return c.conn.Close()
+}
+
+// List returns the size in bytes of every message, by message number.
+// Message numbers count from 1 in the order the server lists messages,
+// usually oldest first.
+func (c *Client) List() (map[int]int64, error) {
+	lines, err := c.listing("LIST")
+	if err != nil {
+		return nil, err
+	}
+	sizes := make(map[int]int64, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err1 := strconv.Atoi(fields[0])
+		size, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 == nil && err2 == nil {
+			sizes[n] = size
+		}
+	}
+	return sizes, nil
+}
+
+// UIDL returns the unique identifier of every message, by message number.
+// UIDL is optional in POP3; servers without it yield an empty map.
+func (c *Client) UIDL() map[int]string {
+	lines, err := c.listing("UIDL")
+	ids := make(map[int]string, len(lines))
+	if err != nil {
+		return ids
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.Atoi(fields[0]); err == nil {
+			ids[n] = fields[1]
+		}
+	}
+	return ids
+}
+
+// Headers returns the header block of message n.
+func (c *Client) Headers(n int, maxSize int64) (string, error) {
+	return c.multiline(fmt.Sprintf("TOP %d 0", n), maxSize)
+}
+
+// Retrieve returns the full content of message n. Messages larger than
+// maxSize are rejected.
+func (c *Client) Retrieve(n int, maxSize int64) (string, error) {
+	return c.multiline(fmt.Sprintf("RETR %d", n), maxSize)
+}
+
+func (c *Client) listing(cmd string) ([]string, error) {
+	body, err := c.multiline(cmd, maxListing)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n"), nil
+}
+
+// command sends cmd and returns the text of the +OK reply. Errors name the
+// command without its arguments, which for PASS are the password.
+func (c *Client) command(cmd string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(c.conn, cmd+"\r\n"); err != nil {
+		return "", fmt.Errorf("POP3 %s failed: %w", verb(cmd), err)
+	}
+	return c.status(verb(cmd))
+}
+
+func verb(cmd string) string {
+	name, _, _ := strings.Cut(cmd, " ")
+	return name
+}
+
+func (c *Client) status(name string) (string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", fmt.Errorf("POP3 %s failed: %w", name, err)
+	}
+	if text, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(text), nil
+	}
+	return "", fmt.Errorf("POP3 %s failed: %s", name, line)
+}
+
+// multiline sends cmd and returns its dot-terminated response with dot
+// stuffing removed and CRLF line endings. Responses larger than limit are
+// rejected; the connection is unusable afterwards.
+func (c *Client) multiline(cmd string, limit int64) (string, error) {
+	if _, err := c.command(cmd); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return "", fmt.Errorf("POP3 %s failed: %w", verb(cmd), err)
+		}
+		if line == "." {
+			return b.String(), nil
+		}
+		line = strings.TrimPrefix(line, ".")
+		if int64(b.Len()+len(line)+2) > limit {
+			return "", fmt.Errorf("POP3 %s failed: response exceeds the limit of %d bytes", verb(cmd), limit)
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, err := c.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return "", fmt.Errorf("response line exceeds %d bytes", maxLineLength)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
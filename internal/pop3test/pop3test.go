@@ -0,0 +1,249 @@
+// Package pop3test provides a scriptable in-process POP3 server for tests.
+//
+// The server speaks enough POP3 over TCP on a loopback port for the pop3
+// client to be exercised end to end: USER, PASS, STAT, LIST, UIDL, TOP,
+// RETR, DELE, RSET, NOOP and QUIT. Messages marked with DELE are removed
+// when the session quits, as on a real server, and every command is
+// recorded, so tests can check that a client leaves the maildrop untouched.
+//
+// Typical use:
+//
+//	srv := pop3test.NewServer("scanner", "secret")
+//	defer srv.Close()
+//	srv.AddMessage(raw)
+//	client, err := pop3.Dial(ctx, srv.Config())
+package pop3test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Server is a fake POP3 server.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+	username string
+	password string
+
+	mu       sync.Mutex
+	messages []string
+	noUIDL   bool
+	commands []string
+}
+
+// NewServer starts a fake POP3 server on a loopback port accepting the
+// given credentials. It panics if no port can be allocated, like
+// net/http/httptest.
+func NewServer(username, password string) *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("pop3test: failed to listen: %v", err))
+	}
+	s := &Server{listener: ln, username: username, password: password}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Config returns a plain-text POP3 configuration pointing at the server.
+func (s *Server) Config() config.POP3Config {
+	return config.POP3Config{
+		Addr:        s.listener.Addr().String(),
+		TLS:         "none",
+		Username:    s.username,
+		Password:    s.password,
+		Timeout:     5 * time.Second,
+		MaxMessages: 100,
+	}
+}
+
+// AddMessage appends a message to the maildrop and returns its number.
+func (s *Server) AddMessage(content string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, content)
+	return len(s.messages)
+}
+
+// Messages returns the number of messages in the maildrop.
+func (s *Server) Messages() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// DisableUIDL makes UIDL fail, as on servers without the optional command.
+func (s *Server) DisableUIDL() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noUIDL = true
+}
+
+// Commands returns the commands received so far. The argument of PASS is
+// masked.
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops the server and waits for in-flight connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	w.WriteString("+OK pop3test ready\r\n")
+	w.Flush()
+
+	user, loggedIn := "", false
+	deleted := make(map[int]bool)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(strings.TrimRight(line, "\r\n"))
+		if len(args) == 0 {
+			w.WriteString("-ERR empty command\r\n")
+			w.Flush()
+			continue
+		}
+		cmd := strings.ToUpper(args[0])
+		args = args[1:]
+
+		s.mu.Lock()
+		if cmd == "PASS" {
+			s.commands = append(s.commands, "PASS ***")
+		} else {
+			s.commands = append(s.commands, strings.TrimRight(line, "\r\n"))
+		}
+		messages, noUIDL := s.messages, s.noUIDL
+		s.mu.Unlock()
+
+		// message returns the message numbered by the first argument.
+		message := func() (int, string, bool) {
+			if len(args) == 0 {
+				return 0, "", false
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > len(messages) || deleted[n] {
+				return 0, "", false
+			}
+			return n, messages[n-1], true
+		}
+
+		switch {
+		case cmd == "QUIT":
+			s.mu.Lock()
+			kept := make([]string, 0, len(s.messages))
+			for i, m := range s.messages {
+				if !deleted[i+1] {
+					kept = append(kept, m)
+				}
+			}
+			s.messages = kept
+			s.mu.Unlock()
+			w.WriteString("+OK bye\r\n")
+			w.Flush()
+			return
+		case cmd == "NOOP":
+			w.WriteString("+OK\r\n")
+		case cmd == "USER" && !loggedIn:
+			user = strings.Join(args, " ")
+			w.WriteString("+OK send PASS\r\n")
+		case cmd == "PASS" && !loggedIn:
+			if user == s.username && strings.Join(args, " ") == s.password {
+				loggedIn = true
+				w.WriteString("+OK logged in\r\n")
+			} else {
+				w.WriteString("-ERR [AUTH] invalid credentials\r\n")
+			}
+		case !loggedIn:
+			w.WriteString("-ERR not logged in\r\n")
+		case cmd == "STAT":
+			count, size := 0, 0
+			for i, m := range messages {
+				if !deleted[i+1] {
+					count++
+					size += len(m)
+				}
+			}
+			fmt.Fprintf(w, "+OK %d %d\r\n", count, size)
+		case cmd == "LIST" || (cmd == "UIDL" && !noUIDL):
+			w.WriteString("+OK listing follows\r\n")
+			for i, m := range messages {
+				if deleted[i+1] {
+					continue
+				}
+				if cmd == "LIST" {
+					fmt.Fprintf(w, "%d %d\r\n", i+1, len(m))
+				} else {
+					fmt.Fprintf(w, "%d uid-%04d\r\n", i+1, i+1)
+				}
+			}
+			w.WriteString(".\r\n")
+		case cmd == "TOP" || cmd == "RETR":
+			_, m, ok := message()
+			if !ok {
+				w.WriteString("-ERR no such message\r\n")
+				break
+			}
+			if cmd == "TOP" {
+				if header, _, found := strings.Cut(m, "\r\n\r\n"); found {
+					m = header + "\r\n\r\n"
+				}
+			}
+			fmt.Fprintf(w, "+OK %d octets\r\n", len(m))
+			for _, l := range strings.SplitAfter(strings.TrimSuffix(m, "\r\n"), "\r\n") {
+				if strings.HasPrefix(l, ".") {
+					w.WriteString(".")
+				}
+				w.WriteString(strings.TrimSuffix(l, "\r\n") + "\r\n")
+			}
+			w.WriteString(".\r\n")
+		case cmd == "DELE":
+			n, _, ok := message()
+			if !ok {
+				w.WriteString("-ERR no such message\r\n")
+				break
+			}
+			deleted[n] = true
+			w.WriteString("+OK marked for deletion\r\n")
+		case cmd == "RSET":
+			clear(deleted)
+			w.WriteString("+OK\r\n")
+		default:
+			w.WriteString("-ERR unsupported command\r\n")
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,383 @@
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+var errFormat = errors.New("no valid format information")
+
+// Error correction levels in the order of the tables below, indexed by
+// the two level bits of the format information.
+const (
+	levelM = iota
+	levelL
+	levelH
+	levelQ
+)
+
+// eccPerBlock and numBlocks are the error correction codewords per block
+// and the number of blocks of each version (index 1 to 40), by level
+// (L, M, Q, H).
+var (
+	eccPerBlock = [4][41]int{
+		{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	numBlocks = [4][41]int{
+		{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// tableIndex maps the level bits of the format information to the rows of
+// the tables.
+var tableIndex = [4]int{levelM: 1, levelL: 0, levelH: 3, levelQ: 2}
+
+// decodeGrid reads the modules of a dim × dim code, row by row.
+func decodeGrid(grid [][]bool, dim int) (string, error) {
+	version := (dim - 17) / 4
+	level, mask, err := readFormat(grid, dim)
+	if err != nil {
+		return "", err
+	}
+	function := functionModules(version)
+
+	// Codewords are placed in two-module columns from the bottom right,
+	// alternately upwards and downwards, skipping the vertical timing
+	// pattern
+	raw := make([]byte, rawModules(version)/8)
+	bit := 0
+	for right := dim - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < dim; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = dim - 1 - vert
+				}
+				if function[y][x] || bit >= len(raw)*8 {
+					continue
+				}
+				if grid[y][x] != masked(mask, x, y) {
+					raw[bit>>3] |= 0x80 >> (bit & 7)
+				}
+				bit++
+			}
+		}
+	}
+
+	data, err := correct(raw, version, tableIndex[level])
+	if err != nil {
+		return "", err
+	}
+	return decodeSegments(data, version)
+}
+
+// masked reports whether mask pattern mask inverts the module at (x, y).
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// readFormat decodes the level and mask pattern from either copy of the
+// format information, tolerating up to three bit errors.
+func readFormat(grid [][]bool, dim int) (level, mask int, err error) {
+	get := func(x, y int) int {
+		if grid[y][x] {
+			return 1
+		}
+		return 0
+	}
+	var first, second int
+	for i := 0; i <= 5; i++ {
+		first |= get(8, i) << i
+	}
+	first |= get(8, 7)<<6 | get(8, 8)<<7 | get(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= get(14-i, 8) << i
+	}
+	for i := 0; i < 8; i++ {
+		second |= get(dim-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= get(8, dim-15+i) << i
+	}
+
+	best, bestDistance := 0, 4
+	for data := 0; data < 32; data++ {
+		code := formatBits(data)
+		for _, read := range []int{first, second} {
+			if d := popcount(code ^ read); d < bestDistance {
+				best, bestDistance = data, d
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, errFormat
+	}
+	return best >> 3, best & 7, nil
+}
+
+// formatBits returns the 15-bit format information for five data bits:
+// a BCH(15,5) code, masked with 0x5412.
+func formatBits(data int) int {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func popcount(n int) int {
+	c := 0
+	for ; n != 0; n &= n - 1 {
+		c++
+	}
+	return c
+}
+
+// rawModules returns the number of data and error correction modules of a
+// version, including the remainder bits.
+func rawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// alignmentPositions returns the row and column coordinates of the
+// alignment patterns of a version.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	align := version/7 + 2
+	step := (version*8 + align*3 + 5) / (align*4 - 4) * 2
+	positions := make([]int, align)
+	positions[0] = 6
+	for i, pos := align-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// functionModules marks the modules of a version that do not hold data:
+// the finder patterns with their separators and format information, the
+// timing patterns, the alignment patterns and the version information.
+func functionModules(version int) [][]bool {
+	dim := version*4 + 17
+	f := make([][]bool, dim)
+	for i := range f {
+		f[i] = make([]bool, dim)
+	}
+	fill := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				if x >= 0 && y >= 0 && x < dim && y < dim {
+					f[y][x] = true
+				}
+			}
+		}
+	}
+	fill(0, 0, 9, 9)
+	fill(dim-8, 0, 8, 9)
+	fill(0, dim-8, 9, 8)
+	fill(6, 0, 1, dim)
+	fill(0, 6, dim, 1)
+	positions := alignmentPositions(version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			fill(x-2, y-2, 5, 5)
+		}
+	}
+	if version >= 7 {
+		fill(dim-11, 0, 3, 6)
+		fill(0, dim-11, 6, 3)
+	}
+	return f
+}
+
+// correct splits the raw codewords into their interleaved blocks, corrects
+// each with its error correction codewords and returns the data codewords.
+func correct(raw []byte, version, level int) ([]byte, error) {
+	blocks := numBlocks[level][version]
+	ecc := eccPerBlock[level][version]
+	total := len(raw)
+	short := blocks - total%blocks
+	shortLen := total / blocks
+
+	data := make([][]byte, blocks)
+	for i := range data {
+		n := shortLen - ecc
+		if i >= short {
+			n++
+		}
+		data[i] = make([]byte, 0, n+ecc)
+	}
+	k := 0
+	for i := 0; i <= shortLen-ecc; i++ {
+		for b := 0; b < blocks; b++ {
+			if i == shortLen-ecc && b < short {
+				continue
+			}
+			data[b] = append(data[b], raw[k])
+			k++
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for b := 0; b < blocks; b++ {
+			data[b] = append(data[b], raw[k])
+			k++
+		}
+	}
+
+	var out []byte
+	for _, block := range data {
+		if err := rsCorrect(block, ecc); err != nil {
+			return nil, err
+		}
+		out = append(out, block[:len(block)-ecc]...)
+	}
+	return out, nil
+}
+
+// bitReader reads big-endian bit fields.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) available() int {
+	return len(r.data)*8 - r.pos
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.pos < len(r.data)*8 && r.data[r.pos>>3]&(0x80>>(r.pos&7)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v
+}
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// decodeSegments decodes the numeric, alphanumeric and byte segments of
+// the data codewords. ECI designators are skipped and byte segments taken
+// as UTF-8, falling back to ISO 8859-1.
+func decodeSegments(data []byte, version int) (string, error) {
+	r := &bitReader{data: data}
+	size := 0
+	if version >= 10 {
+		size = 1
+	}
+	if version >= 27 {
+		size = 2
+	}
+	var out strings.Builder
+	for r.available() >= 4 {
+		switch mode := r.read(4); mode {
+		case 0:
+			return out.String(), nil
+		case 1: // Numeric
+			n := r.read([]int{10, 12, 14}[size])
+			for ; n >= 3; n -= 3 {
+				fmt.Fprintf(&out, "%03d", r.read(10))
+			}
+			switch n {
+			case 2:
+				fmt.Fprintf(&out, "%02d", r.read(7))
+			case 1:
+				fmt.Fprintf(&out, "%d", r.read(4))
+			}
+		case 2: // Alphanumeric
+			n := r.read([]int{9, 11, 13}[size])
+			for ; n >= 2; n -= 2 {
+				v := r.read(11)
+				if v/45 >= 45 {
+					return "", fmt.Errorf("invalid alphanumeric pair %d", v)
+				}
+				out.WriteByte(alphanumeric[v/45])
+				out.WriteByte(alphanumeric[v%45])
+			}
+			if n == 1 {
+				v := r.read(6)
+				if v >= 45 {
+					return "", fmt.Errorf("invalid alphanumeric character %d", v)
+				}
+				out.WriteByte(alphanumeric[v])
+			}
+		case 4: // Byte
+			n := r.read([]int{8, 16, 16}[size])
+			if n*8 > r.available() {
+				return "", errors.New("byte segment exceeds the data")
+			}
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = byte(r.read(8))
+			}
+			if utf8.Valid(b) {
+				out.Write(b)
+			} else {
+				for _, c := range b {
+					out.WriteRune(rune(c))
+				}
+			}
+		case 7: // ECI designator, one to three bytes
+			switch first := r.read(8); {
+			case first&0x80 == 0:
+			case first&0xc0 == 0x80:
+				r.read(8)
+			default:
+				r.read(16)
+			}
+		case 3: // Structured append header
+			r.read(16)
+		case 5, 9: // FNC1 markers
+			if mode == 9 {
+				r.read(8)
+			}
+		default:
+			return "", fmt.Errorf("unsupported segment mode %d", mode)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,410 @@
+// Package qrcode finds and decodes QR codes in images.
+//
+// QR codes in email images carry links past text-based URL filters
+// ("quishing"), so the links they encode need to be recovered and assessed
+// like any other URL. Scan decodes a PNG, JPEG or GIF image, locates QR
+// codes by their three finder patterns and reads them, correcting errors
+// with their Reed-Solomon codes.
+//
+// Codes are expected to be rendered rather than photographed: modules are
+// sampled on the grid spanned by the finder patterns, without correcting
+// for perspective distortion. Mirrored and inverted codes are not read.
+//
+// Security considerations:
+//   - Image dimensions are checked before decoding, and images larger than
+//     MaxPixels are skipped, so a small file cannot expand into a large
+//     allocation
+//   - The number of finder pattern candidates and codes read per image is
+//     bounded
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"math"
+	"sort"
+
+	// Image formats Scan decodes
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// MaxPixels bounds the size of the images decoded.
+	MaxPixels = 4 << 20
+
+	// MaxCodes is the number of codes read per image.
+	MaxCodes = 4
+
+	// maxCandidates bounds the finder pattern candidates combined into
+	// codes.
+	maxCandidates = 12
+)
+
+// ErrTooLarge is returned for images over MaxPixels.
+var ErrTooLarge = errors.New("image exceeds the size limit")
+
+// Scan decodes an image and returns the content of the QR codes in it, in
+// no particular order. An image without codes returns none and no error.
+func Scan(content []byte) ([]string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	return Decode(img), nil
+}
+
+// Decode returns the content of the QR codes in img.
+func Decode(img image.Image) []string {
+	m := binarize(img)
+	centers := m.findFinderPatterns()
+	if len(centers) < 3 {
+		return nil
+	}
+	sort.Slice(centers, func(i, j int) bool { return centers[i].count > centers[j].count })
+	if len(centers) > maxCandidates {
+		centers = centers[:maxCandidates]
+	}
+
+	var triples []triple
+	for i := range centers {
+		for j := i + 1; j < len(centers); j++ {
+			for k := j + 1; k < len(centers); k++ {
+				if t, ok := orient(centers[i], centers[j], centers[k]); ok {
+					triples = append(triples, t)
+				}
+			}
+		}
+	}
+	sort.Slice(triples, func(i, j int) bool { return triples[i].score < triples[j].score })
+
+	var found []string
+	used := make(map[*finderPattern]bool)
+	for _, t := range triples {
+		if len(found) == MaxCodes {
+			break
+		}
+		if used[t.tl] || used[t.tr] || used[t.bl] {
+			continue
+		}
+		if text, ok := m.read(t); ok {
+			found = append(found, text)
+			used[t.tl], used[t.tr], used[t.bl] = true, true, true
+		}
+	}
+	return found
+}
+
+// bitMatrix is a binarized image; true is dark.
+type bitMatrix struct {
+	width, height int
+	bits          []bool
+}
+
+func (m *bitMatrix) get(x, y int) bool {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return false
+	}
+	return m.bits[y*m.width+x]
+}
+
+// binarize converts img to dark and light pixels with Otsu's threshold on
+// luminance, compositing transparent pixels over white.
+func binarize(img image.Image) *bitMatrix {
+	b := img.Bounds()
+	m := &bitMatrix{width: b.Dx(), height: b.Dy(), bits: make([]bool, b.Dx()*b.Dy())}
+	lum := make([]uint8, len(m.bits))
+	var hist [256]int
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			white := 0xffff - a
+			l := (299*(r+white) + 587*(g+white) + 114*(bl+white)) / 1000 >> 8
+			if l > 255 {
+				l = 255
+			}
+			lum[y*m.width+x] = uint8(l)
+			hist[l]++
+		}
+	}
+
+	// Otsu: the threshold maximizing the variance between the classes
+	total := len(lum)
+	sum := 0
+	for i, n := range hist {
+		sum += i * n
+	}
+	threshold, best := 127, -1.0
+	sumB, weightB := 0, 0
+	for t := 0; t < 256; t++ {
+		weightB += hist[t]
+		if weightB == 0 {
+			continue
+		}
+		weightF := total - weightB
+		if weightF == 0 {
+			break
+		}
+		sumB += t * hist[t]
+		meanB := float64(sumB) / float64(weightB)
+		meanF := float64(sum-sumB) / float64(weightF)
+		between := float64(weightB) * float64(weightF) * (meanB - meanF) * (meanB - meanF)
+		if between > best {
+			best, threshold = between, t
+		}
+	}
+	for i, l := range lum {
+		m.bits[i] = int(l) <= threshold
+	}
+	return m
+}
+
+// finderPattern is the center of a finder pattern candidate; count is the
+// number of scan lines it was confirmed on.
+type finderPattern struct {
+	x, y       float64
+	moduleSize float64
+	count      int
+}
+
+// findFinderPatterns scans the rows of m for the 1:1:3:1:1 dark and light
+// runs of finder patterns, confirms each on the column and row through its
+// center and merges the confirmations of the same pattern.
+func (m *bitMatrix) findFinderPatterns() []*finderPattern {
+	var centers []*finderPattern
+	for y := 0; y < m.height; y++ {
+		var counts [5]int
+		state := 0
+		for x := 0; x <= m.width; x++ {
+			dark := x < m.width && m.get(x, y)
+			if dark == (state%2 == 0) && x < m.width {
+				counts[state]++
+				continue
+			}
+			// A run ended
+			if state < 4 {
+				if state == 0 && counts[0] == 0 {
+					// Leading light pixels
+					continue
+				}
+				state++
+				if x < m.width {
+					counts[state] = 1
+				}
+				continue
+			}
+			if ratioOK(counts) {
+				if p, ok := m.confirm(counts, x, y); ok {
+					centers = merge(centers, p)
+				}
+			}
+			// Shift by two runs, keeping the last dark run as the first
+			counts = [5]int{counts[2], counts[3], counts[4], 0, 0}
+			state = 3
+			if x < m.width {
+				counts[3] = 1
+			}
+		}
+	}
+	return centers
+}
+
+// ratioOK reports whether five run lengths are in the 1:1:3:1:1 ratio of a
+// finder pattern, within half a module.
+func ratioOK(c [5]int) bool {
+	total := 0
+	for _, n := range c {
+		if n == 0 {
+			return false
+		}
+		total += n
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	v := module / 2
+	return math.Abs(module-float64(c[0])) < v && math.Abs(module-float64(c[1])) < v &&
+		math.Abs(3*module-float64(c[2])) < 3*v &&
+		math.Abs(module-float64(c[3])) < v && math.Abs(module-float64(c[4])) < v
+}
+
+// confirm checks a pattern found on row y, ending before column end, on the
+// column through its center and then the row through the refined center.
+func (m *bitMatrix) confirm(c [5]int, end, y int) (*finderPattern, bool) {
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	cx := float64(end-c[4]-c[3]) - float64(c[2])/2
+	cy, vtotal, ok := m.crossCheck(int(cx), y, 0, 1, total)
+	if !ok {
+		return nil, false
+	}
+	cx, htotal, ok := m.crossCheck(int(cx), int(cy), 1, 0, total)
+	if !ok {
+		return nil, false
+	}
+	return &finderPattern{x: cx, y: cy, moduleSize: float64(total+vtotal+htotal) / 21, count: 1}, true
+}
+
+// crossCheck measures the runs through (x, y) along direction (dx, dy)
+// and returns the center coordinate along that direction when they form
+// a finder pattern about as large as the original one.
+func (m *bitMatrix) crossCheck(x, y, dx, dy, original int) (float64, int, bool) {
+	if !m.get(x, y) {
+		return 0, 0, false
+	}
+	var c [5]int
+	// Backwards from the center: the center run, light, then dark
+	i := 0
+	for ; m.get(x-i*dx, y-i*dy) && m.inside(x-i*dx, y-i*dy); i++ {
+		c[2]++
+	}
+	for ; !m.get(x-i*dx, y-i*dy) && m.inside(x-i*dx, y-i*dy); i++ {
+		c[1]++
+	}
+	for ; m.get(x-i*dx, y-i*dy) && m.inside(x-i*dx, y-i*dy); i++ {
+		c[0]++
+	}
+	// Forwards
+	j := 1
+	for ; m.get(x+j*dx, y+j*dy) && m.inside(x+j*dx, y+j*dy); j++ {
+		c[2]++
+	}
+	for ; !m.get(x+j*dx, y+j*dy) && m.inside(x+j*dx, y+j*dy); j++ {
+		c[3]++
+	}
+	for ; m.get(x+j*dx, y+j*dy) && m.inside(x+j*dx, y+j*dy); j++ {
+		c[4]++
+	}
+	total := c[0] + c[1] + c[2] + c[3] + c[4]
+	if !ratioOK(c) || 5*abs(total-original) >= 2*original {
+		return 0, 0, false
+	}
+	endPos := x + j*dx
+	if dy != 0 {
+		endPos = y + j*dy
+	}
+	return float64(endPos-c[4]-c[3]) - float64(c[2])/2, total, true
+}
+
+func (m *bitMatrix) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < m.width && y < m.height
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// merge adds p to centers, averaging it into a candidate within a module
+// of it.
+func merge(centers []*finderPattern, p *finderPattern) []*finderPattern {
+	for _, c := range centers {
+		if math.Abs(c.x-p.x) <= c.moduleSize && math.Abs(c.y-p.y) <= c.moduleSize &&
+			math.Abs(c.moduleSize-p.moduleSize) <= c.moduleSize/2 {
+			n := float64(c.count)
+			c.x = (c.x*n + p.x) / (n + 1)
+			c.y = (c.y*n + p.y) / (n + 1)
+			c.moduleSize = (c.moduleSize*n + p.moduleSize) / (n + 1)
+			c.count++
+			return centers
+		}
+	}
+	return append(centers, p)
+}
+
+// triple is three finder patterns arranged as the top-left, top-right and
+// bottom-left corners of a code; a lower score is a better fit.
+type triple struct {
+	tl, tr, bl *finderPattern
+	score      float64
+}
+
+// orient arranges three finder patterns as the corners of a code: the
+// top-left one is at the right angle, and the top-right one follows it
+// clockwise. Patterns of different sizes or that do not form an isosceles
+// right triangle are rejected.
+func orient(a, b, c *finderPattern) (triple, bool) {
+	sizes := []float64{a.moduleSize, b.moduleSize, c.moduleSize}
+	sort.Float64s(sizes)
+	if sizes[2] > 1.5*sizes[0] {
+		return triple{}, false
+	}
+	dist := func(p, q *finderPattern) float64 { return math.Hypot(p.x-q.x, p.y-q.y) }
+	ab, bc, ac := dist(a, b), dist(b, c), dist(a, c)
+	var t triple
+	switch {
+	case bc >= ab && bc >= ac:
+		t = triple{tl: a, tr: b, bl: c}
+	case ac >= ab && ac >= bc:
+		t = triple{tl: b, tr: a, bl: c}
+	default:
+		t = triple{tl: c, tr: a, bl: b}
+	}
+	if (t.tr.x-t.tl.x)*(t.bl.y-t.tl.y)-(t.tr.y-t.tl.y)*(t.bl.x-t.tl.x) < 0 {
+		t.tr, t.bl = t.bl, t.tr
+	}
+	legA, legB := dist(t.tl, t.tr), dist(t.tl, t.bl)
+	hyp := dist(t.tr, t.bl)
+	module := (a.moduleSize + b.moduleSize + c.moduleSize) / 3
+	if legA < 7*module || legB < 7*module {
+		return triple{}, false
+	}
+	legRatio := math.Abs(legA-legB) / math.Max(legA, legB)
+	angle := math.Abs(legA*legA+legB*legB-hyp*hyp) / (hyp * hyp)
+	if legRatio > 0.2 || angle > 0.2 {
+		return triple{}, false
+	}
+	t.score = legRatio + angle
+	return t, true
+}
+
+// read samples and decodes the code framed by t, trying the dimensions
+// next to the one estimated from the finder pattern distances.
+func (m *bitMatrix) read(t triple) (string, bool) {
+	module := (t.tl.moduleSize + t.tr.moduleSize + t.bl.moduleSize) / 3
+	across := (math.Hypot(t.tr.x-t.tl.x, t.tr.y-t.tl.y) + math.Hypot(t.bl.x-t.tl.x, t.bl.y-t.tl.y)) / 2
+	estimate := int(math.Round(across/module)) + 7
+	// Dimensions are 17 + 4 × version
+	estimate = (estimate-17+2)/4*4 + 17
+	for _, dim := range []int{estimate, estimate - 4, estimate + 4} {
+		if dim < 21 || dim > 177 {
+			continue
+		}
+		grid := m.sample(t, dim)
+		if text, err := decodeGrid(grid, dim); err == nil {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// sample reads the modules of a dim × dim code by mapping module centers
+// onto the grid spanned by the finder pattern centers, which sit 3.5
+// modules from the edges.
+func (m *bitMatrix) sample(t triple, dim int) [][]bool {
+	span := float64(dim - 7)
+	ux, uy := (t.tr.x-t.tl.x)/span, (t.tr.y-t.tl.y)/span
+	vx, vy := (t.bl.x-t.tl.x)/span, (t.bl.y-t.tl.y)/span
+	grid := make([][]bool, dim)
+	for row := 0; row < dim; row++ {
+		grid[row] = make([]bool, dim)
+		for col := 0; col < dim; col++ {
+			c, r := float64(col)-3, float64(row)-3
+			x := t.tl.x + c*ux + r*vx
+			y := t.tl.y + c*uy + r*vy
+			grid[row][col] = m.get(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return grid
+}
@@ -0,0 +1,179 @@
+package qrcode
+
+import "errors"
+
+var errUncorrectable = errors.New("too many errors to correct")
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(256) with the
+// QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+var gfExp, gfLog = func() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return
+}()
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfInverse(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+// poly is a polynomial over GF(256), highest degree first, without leading
+// zeros except for the zero polynomial.
+type poly []byte
+
+func newPoly(c []byte) poly {
+	for len(c) > 1 && c[0] == 0 {
+		c = c[1:]
+	}
+	return poly(c)
+}
+
+func monomial(degree int, coeff byte) poly {
+	if coeff == 0 {
+		return poly{0}
+	}
+	p := make(poly, degree+1)
+	p[0] = coeff
+	return p
+}
+
+func (p poly) degree() int { return len(p) - 1 }
+
+func (p poly) zero() bool { return p[0] == 0 }
+
+// coeff returns the coefficient of x^d.
+func (p poly) coeff(d int) byte { return p[len(p)-1-d] }
+
+func (p poly) eval(x byte) byte {
+	if x == 0 {
+		return p.coeff(0)
+	}
+	var v byte
+	for _, c := range p {
+		v = gfMul(v, x) ^ c
+	}
+	return v
+}
+
+func (p poly) add(q poly) poly {
+	if len(p) < len(q) {
+		p, q = q, p
+	}
+	sum := make([]byte, len(p))
+	copy(sum, p)
+	for i, c := range q {
+		sum[len(p)-len(q)+i] ^= c
+	}
+	return newPoly(sum)
+}
+
+func (p poly) mul(q poly) poly {
+	if p.zero() || q.zero() {
+		return poly{0}
+	}
+	prod := make([]byte, len(p)+len(q)-1)
+	for i, a := range p {
+		for j, b := range q {
+			prod[i+j] ^= gfMul(a, b)
+		}
+	}
+	return newPoly(prod)
+}
+
+func (p poly) scale(c byte) poly {
+	return p.mul(poly{c})
+}
+
+// rsCorrect corrects block, whose last ecc bytes are the error correction
+// codewords of a code with generator roots α^0 … α^(ecc-1), in place.
+func rsCorrect(block []byte, ecc int) error {
+	r := newPoly(append([]byte(nil), block...))
+	syndromes := make([]byte, ecc)
+	clean := true
+	for i := range syndromes {
+		s := r.eval(gfExp[i])
+		syndromes[ecc-1-i] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return nil
+	}
+
+	// Euclid's algorithm yields the error locator σ and evaluator ω
+	rLast, rCur := monomial(ecc, 1), newPoly(syndromes)
+	tLast, tCur := poly{0}, poly{1}
+	for 2*rCur.degree() >= ecc {
+		rLastLast, tLastLast := rLast, tLast
+		rLast, tLast = rCur, tCur
+		if rLast.zero() {
+			return errUncorrectable
+		}
+		rCur = rLastLast
+		q := poly{0}
+		inverse := gfInverse(rLast[0])
+		for rCur.degree() >= rLast.degree() && !rCur.zero() {
+			diff := rCur.degree() - rLast.degree()
+			scale := gfMul(rCur[0], inverse)
+			q = q.add(monomial(diff, scale))
+			rCur = rCur.add(rLast.mul(monomial(diff, scale)))
+		}
+		tCur = q.mul(tLast).add(tLastLast)
+		if rCur.degree() >= rLast.degree() {
+			return errUncorrectable
+		}
+	}
+	if tCur.coeff(0) == 0 {
+		return errUncorrectable
+	}
+	inverse := gfInverse(tCur.coeff(0))
+	sigma, omega := tCur.scale(inverse), rCur.scale(inverse)
+
+	// The roots of σ are the inverses of the error locations
+	var locations []byte
+	if sigma.degree() == 1 {
+		locations = []byte{sigma.coeff(1)}
+	} else {
+		for i := 1; i < 256 && len(locations) < sigma.degree(); i++ {
+			if sigma.eval(byte(i)) == 0 {
+				locations = append(locations, gfInverse(byte(i)))
+			}
+		}
+	}
+	if len(locations) != sigma.degree() {
+		return errUncorrectable
+	}
+
+	// Forney's formula gives the error magnitudes
+	for i, loc := range locations {
+		xInverse := gfInverse(loc)
+		denominator := byte(1)
+		for j, other := range locations {
+			if i != j {
+				denominator = gfMul(denominator, 1^gfMul(other, xInverse))
+			}
+		}
+		position := len(block) - 1 - gfLog[loc]
+		if position < 0 {
+			return errUncorrectable
+		}
+		block[position] ^= gfMul(omega.eval(xInverse), gfInverse(denominator))
+	}
+	return nil
+}
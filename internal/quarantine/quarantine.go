@@ -0,0 +1,359 @@
+// Package quarantine holds the full content of high-scoring messages so
+// analysts can review them after the scan, and export them when they turn
+// out to be legitimate.
+//
+// Each message is stored in the configured directory as two files: <id>.eml
+// holds the raw message and <id>.json its metadata. The metadata of every
+// held message is loaded by Open and kept in memory; message content is read
+// back only when it is inspected or released.
+//
+// Security considerations:
+//   - Both files are encrypted with AES-256-GCM under the configured key and
+//     authenticated with the message ID, so files cannot be read without the
+//     key, altered, or swapped between messages undetected
+//   - Files are written atomically with owner-only permissions
+//   - Released messages are only exported to the caller; nothing is ever
+//     delivered or sent
+//   - Messages older than the configured retention are deleted automatically,
+//     except those placed under legal hold
+package quarantine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/localcf"
+)
+
+// ErrNotFound is returned for IDs of messages that are not held.
+var ErrNotFound = errors.New("no quarantined message with this ID")
+
+// idRegex matches the IDs Add assigns: the UTC time the message was held
+// and 8 random bytes.
+var idRegex = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-[0-9a-f]{16}$`)
+
+// File name suffixes of the message content and metadata.
+const (
+	messageSuffix = ".eml"
+	metaSuffix    = ".json"
+)
+
+// Item describes a quarantined message.
+type Item struct {
+	ID            string     `json:"id"`
+	Hash          string     `json:"hash"`
+	Sender        string     `json:"sender,omitempty"`
+	Subject       string     `json:"subject,omitempty"`
+	MessageID     string     `json:"message_id,omitempty"`
+	Size          int        `json:"size"`
+	Score         float64    `json:"score"`
+	Threshold     float64    `json:"threshold"`
+	IsSpam        bool       `json:"is_spam"`
+	Rules         []string   `json:"rules"`
+	Profile       string     `json:"profile,omitempty"`
+	QuarantinedAt time.Time  `json:"quarantined_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+
+	// LegalHold exempts the message from pruning until the hold is lifted,
+	// even past ExpiresAt.
+	LegalHold bool `json:"legal_hold,omitempty"`
+}
+
+// Released reports whether the message was released.
+func (i *Item) Released() bool {
+	return i.ReleasedAt != nil
+}
+
+// Store holds quarantined messages in a directory.
+type Store struct {
+	mu        sync.Mutex
+	dir       string
+	aead      cipher.AEAD
+	retention time.Duration
+	items     map[string]*Item
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// pruneInterval is how often expired messages are deleted.
+const pruneInterval = time.Hour
+
+// Open returns the store configured by cfg, creating its directory and
+// loading the metadata of the messages it holds. It returns nil when no
+// directory is configured. Messages older than cfg.Retention are deleted now
+// and then hourly until the store is closed.
+func Open(cfg config.QuarantineConfig) (*Store, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cfg.Key)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("quarantine key must be 32 bytes encoded in base64")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	s := &Store{
+		dir:       cfg.Dir,
+		aead:      aead,
+		retention: cfg.Retention,
+		items:     make(map[string]*Item),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	go s.prune()
+	return s, nil
+}
+
+// load reads the metadata of the held messages.
+func (s *Store) load() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+metaSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id := strings.TrimSuffix(filepath.Base(name), metaSuffix)
+		if !idRegex.MatchString(id) {
+			continue
+		}
+		data, err := s.read(id, metaSuffix)
+		if err != nil {
+			return fmt.Errorf("quarantine %s: %w", name, err)
+		}
+		item := &Item{}
+		if err := json.Unmarshal(data, item); err != nil || item.ID != id {
+			return fmt.Errorf("quarantine %s: invalid metadata", name)
+		}
+		s.items[id] = item
+	}
+	return nil
+}
+
+// Add holds content with the metadata of item, assigning its ID,
+// QuarantinedAt and ExpiresAt.
+func (s *Store) Add(item *Item, content []byte) error {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	item.ID = now.Format("20060102T150405Z") + "-" + hex.EncodeToString(random)
+	item.QuarantinedAt = now
+	item.Size = len(content)
+	if s.retention > 0 {
+		expires := now.Add(s.retention)
+		item.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(item.ID, messageSuffix, content); err != nil {
+		return err
+	}
+	if err := s.writeMeta(item); err != nil {
+		os.Remove(s.path(item.ID, messageSuffix))
+		return err
+	}
+	copied := *item
+	s.items[item.ID] = &copied
+	return nil
+}
+
+// Items returns the metadata of the held messages, newest first.
+func (s *Store) Items() []*Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := make([]*Item, 0, len(s.items))
+	for _, item := range s.items {
+		copied := *item
+		items = append(items, &copied)
+	}
+	slices.SortFunc(items, func(a, b *Item) int { return strings.Compare(b.ID, a.ID) })
+	return items
+}
+
+// Get returns the metadata and content of the message with id.
+func (s *Store) Get(id string) (*Item, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(id)
+}
+
+// Release marks the message with id as released and returns it. Releasing
+// a message again returns it with the time of its first release.
+func (s *Store) Release(id string) (*Item, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, content, err := s.get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if item.ReleasedAt == nil {
+		now := time.Now().UTC()
+		item.ReleasedAt = &now
+		if err := s.writeMeta(item); err != nil {
+			return nil, nil, err
+		}
+		s.items[id].ReleasedAt = &now
+	}
+	return item, content, nil
+}
+
+// SetLegalHold places the message with id under legal hold, or lifts its
+// hold, and returns its metadata.
+func (s *Store) SetLegalHold(id string, hold bool) (*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *item
+	if item.LegalHold != hold {
+		copied.LegalHold = hold
+		if err := s.writeMeta(&copied); err != nil {
+			return nil, err
+		}
+		item.LegalHold = hold
+	}
+	return &copied, nil
+}
+
+func (s *Store) get(id string) (*Item, []byte, error) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	content, err := s.read(id, messageSuffix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read quarantined message: %w", err)
+	}
+	copied := *item
+	return &copied, content, nil
+}
+
+// Prune deletes the messages quarantined before cutoff, except those under
+// legal hold, and returns how many were removed.
+func (s *Store) Prune(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, item := range s.items {
+		if item.LegalHold || !item.QuarantinedAt.Before(cutoff) {
+			continue
+		}
+		for _, suffix := range []string{metaSuffix, messageSuffix} {
+			if err := os.Remove(s.path(id, suffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return n, err
+			}
+		}
+		delete(s.items, id)
+		n++
+	}
+	return n, nil
+}
+
+func (s *Store) prune() {
+	defer close(s.done)
+	if s.retention <= 0 {
+		<-s.stop
+		return
+	}
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.Prune(time.Now().Add(-s.retention))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to prune quarantine")
+		} else if n > 0 {
+			logrus.WithField("messages", n).Info("Pruned expired quarantined messages")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops pruning expired messages.
+func (s *Store) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
+
+func (s *Store) path(id, suffix string) string {
+	return filepath.Join(s.dir, id+suffix)
+}
+
+func (s *Store) writeMeta(item *Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return s.write(item.ID, metaSuffix, data)
+}
+
+// write encrypts data as the nonce followed by the sealed data, with the
+// file name as additional data.
+func (s *Store) write(id, suffix string, data []byte) error {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(data)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, data, []byte(id+suffix))
+	if err := localcf.WriteAtomic(s.path(id, suffix), sealed, 0o600); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) read(id, suffix string) ([]byte, error) {
+	sealed, err := os.ReadFile(s.path(id, suffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, fmt.Errorf("file is truncated")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	data, err := s.aead.Open(nil, nonce, ciphertext, []byte(id+suffix))
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed; the file was altered or the key changed")
+	}
+	return data, nil
+}
@@ -0,0 +1,274 @@
+// Package ratelimit enforces a global request budget together with an
+// independent budget per client, so one noisy client cannot starve others.
+//
+// A request is admitted only if both the client's limiter and the global
+// limiter have capacity; tokens are never consumed from one when the other
+// rejects the request. Idle client limiters are evicted to bound memory.
+//
+// Expensive tools can additionally be given their own per-client budget and
+// daily quota; see ReserveTool.
+package ratelimit
+
+import (
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Limit is a token bucket budget.
+type Limit struct {
+	RequestsPerMinute int
+	BurstSize         int
+}
+
+func (l Limit) limiter() *rate.Limiter {
+	if l.RequestsPerMinute <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Every(time.Minute/time.Duration(l.RequestsPerMinute)), l.BurstSize)
+}
+
+// Limiter tracks the global and per-client budgets.
+type Limiter struct {
+	mu             sync.Mutex
+	global         *rate.Limiter
+	globalCfg      Limit
+	clientCfg      Limit
+	idle           time.Duration
+	overrides      map[string]Limit
+	toolLimits     map[string]ToolLimit
+	clients        map[string]*client
+	quotas         map[quotaKey]int
+	quotaDay       time.Time
+	globalRejected uint64
+	lastSweep      time.Time
+}
+
+type client struct {
+	limit    Limit
+	limiter  *rate.Limiter
+	tools    map[string]*rate.Limiter
+	lastSeen time.Time
+	allowed  uint64
+	rejected uint64
+}
+
+// New creates a limiter. A zero RequestsPerMinute disables that budget.
+// Client limiters unused for longer than idle are discarded.
+func New(global, perClient Limit, idle time.Duration) *Limiter {
+	return &Limiter{
+		global:     global.limiter(),
+		globalCfg:  global,
+		clientCfg:  perClient,
+		idle:       idle,
+		overrides:  make(map[string]Limit),
+		toolLimits: make(map[string]ToolLimit),
+		clients:    make(map[string]*client),
+		quotas:     make(map[quotaKey]int),
+		lastSweep:  time.Now(),
+	}
+}
+
+// SetLimit overrides the per-client budget for one client key, e.g. an API
+// key with its own quota. It applies to the client's next request.
+func (l *Limiter) SetLimit(key string, limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.overrides[key] = limit
+	delete(l.clients, key)
+}
+
+// Reconfigure replaces every budget, e.g. after the configuration is
+// reloaded: the global and default per-client budgets, the idle timeout, the
+// per-key overrides set with SetLimit and the tool budgets set with
+// SetToolLimit. Usage and daily quota counts are kept, and a client's bucket
+// is only refilled when its budget changed.
+func (l *Limiter) Reconfigure(global, perClient Limit, idle time.Duration, overrides map[string]Limit, tools map[string]ToolLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if global != l.globalCfg {
+		l.global = global.limiter()
+		l.globalCfg = global
+	}
+	l.clientCfg = perClient
+	l.idle = idle
+	l.overrides = maps.Clone(overrides)
+	if l.overrides == nil {
+		l.overrides = make(map[string]Limit)
+	}
+
+	for key, c := range l.clients {
+		limit, ok := l.overrides[key]
+		if !ok {
+			limit = perClient
+		}
+		if limit != c.limit {
+			c.limit = limit
+			c.limiter = limit.limiter()
+		}
+		for tool := range c.tools {
+			if next, ok := tools[tool]; !ok || next != l.toolLimits[tool] {
+				delete(c.tools, tool)
+			}
+		}
+	}
+	for qk := range l.quotas {
+		if _, ok := tools[qk.tool]; !ok {
+			delete(l.quotas, qk)
+		}
+	}
+	l.toolLimits = maps.Clone(tools)
+	if l.toolLimits == nil {
+		l.toolLimits = make(map[string]ToolLimit)
+	}
+}
+
+// Admit admits a request from the client identified by key, or returns why
+// it was refused and when it may be retried.
+func (l *Limiter) Admit(key string) *Rejection {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+	c := l.clientLocked(key, now)
+
+	clientRes := c.limiter.ReserveN(now, 1)
+	if !clientRes.OK() || clientRes.DelayFrom(now) > 0 {
+		r := rejection(ScopeClient, c.limit, clientRes, now)
+		clientRes.CancelAt(now)
+		c.rejected++
+		return r
+	}
+
+	globalRes := l.global.ReserveN(now, 1)
+	if !globalRes.OK() || globalRes.DelayFrom(now) > 0 {
+		r := rejection(ScopeGlobal, l.globalCfg, globalRes, now)
+		globalRes.CancelAt(now)
+		clientRes.CancelAt(now)
+		c.rejected++
+		l.globalRejected++
+		return r
+	}
+
+	c.allowed++
+	return nil
+}
+
+// rejection describes a request refused by the budget limit, whose
+// reservation res would have had to wait.
+func rejection(scope string, limit Limit, res *rate.Reservation, now time.Time) *Rejection {
+	delay := time.Minute
+	if res.OK() {
+		delay = res.DelayFrom(now)
+	}
+	return &Rejection{
+		Code:              RateLimited,
+		ErrorCode:         toolerr.RateLimited,
+		Scope:             scope,
+		Limit:             limit.RequestsPerMinute,
+		Period:            "minute",
+		ResetAt:           now.Add(delay).UTC(),
+		RetryAfterSeconds: retryAfter(delay),
+	}
+}
+
+// clientLocked returns the state of the client identified by key, creating
+// it if needed. l.mu must be held.
+func (l *Limiter) clientLocked(key string, now time.Time) *client {
+	c, ok := l.clients[key]
+	if !ok {
+		limit, ok := l.overrides[key]
+		if !ok {
+			limit = l.clientCfg
+		}
+		c = &client{limit: limit, limiter: limit.limiter(), tools: make(map[string]*rate.Limiter)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+	return c
+}
+
+// sweepLocked evicts idle clients at most once per idle period. l.mu must be held.
+func (l *Limiter) sweepLocked(now time.Time) {
+	if l.idle <= 0 || now.Sub(l.lastSweep) < l.idle {
+		return
+	}
+	l.lastSweep = now
+	for key, c := range l.clients {
+		if now.Sub(c.lastSeen) > l.idle {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// State is a point-in-time view of limiter usage.
+type State struct {
+	Global  GlobalState   `json:"global"`
+	Clients []ClientState `json:"clients"`
+}
+
+// GlobalState describes the shared budget.
+type GlobalState struct {
+	RequestsPerMinute int     `json:"requests_per_minute"`
+	BurstSize         int     `json:"burst_size"`
+	Tokens            float64 `json:"tokens_available"`
+	Rejected          uint64  `json:"rejected"`
+}
+
+// ClientState describes one client's budget and usage.
+type ClientState struct {
+	Client            string      `json:"client"`
+	RequestsPerMinute int         `json:"requests_per_minute"`
+	BurstSize         int         `json:"burst_size"`
+	Tokens            float64     `json:"tokens_available"`
+	Allowed           uint64      `json:"allowed"`
+	Rejected          uint64      `json:"rejected"`
+	LastSeen          time.Time   `json:"last_seen"`
+	Tools             []ToolState `json:"tools,omitempty"`
+}
+
+// State returns current usage, with clients sorted by key.
+func (l *Limiter) State() State {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+	l.resetQuotasLocked(now)
+
+	state := State{
+		Global: GlobalState{
+			RequestsPerMinute: l.globalCfg.RequestsPerMinute,
+			BurstSize:         l.globalCfg.BurstSize,
+			Tokens:            l.global.TokensAt(now),
+			Rejected:          l.globalRejected,
+		},
+		Clients: make([]ClientState, 0, len(l.clients)),
+	}
+	for key, c := range l.clients {
+		state.Clients = append(state.Clients, ClientState{
+			Client:            key,
+			RequestsPerMinute: c.limit.RequestsPerMinute,
+			BurstSize:         c.limit.BurstSize,
+			Tokens:            c.limiter.TokensAt(now),
+			Allowed:           c.allowed,
+			Rejected:          c.rejected,
+			LastSeen:          c.lastSeen,
+			Tools:             l.toolStatesLocked(key, c, now),
+		})
+	}
+	sort.Slice(state.Clients, func(i, j int) bool {
+		return state.Clients[i].Client < state.Clients[j].Client
+	})
+	return state
+}
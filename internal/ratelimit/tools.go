@@ -0,0 +1,215 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// ToolLimit is the budget each client has for one tool: a token bucket and,
+// when DailyQuota is positive, a cap on calls per UTC day.
+type ToolLimit struct {
+	Limit
+	DailyQuota int
+}
+
+// Rejection codes.
+const (
+	RateLimited   = "rate_limited"
+	QuotaExceeded = "quota_exceeded"
+)
+
+// Rejection scopes: the budget that refused a call.
+const (
+	ScopeGlobal = "global"
+	ScopeClient = "client"
+	ScopeTool   = "tool"
+)
+
+// Rejection explains why a call was refused and when the client may retry
+// it. ErrorCode is its toolerr code, shared with the other tool errors.
+// Remaining is how many calls the client has left of the tool's daily quota
+// when a per-minute budget refused it; it is 0 otherwise.
+type Rejection struct {
+	Code              string    `json:"error"`
+	ErrorCode         string    `json:"code"`
+	Scope             string    `json:"scope"`
+	Tool              string    `json:"tool,omitempty"`
+	Limit             int       `json:"limit"`
+	Period            string    `json:"period"`
+	Remaining         int       `json:"remaining"`
+	ResetAt           time.Time `json:"reset_at"`
+	RetryAfterSeconds int       `json:"retry_after_seconds"`
+}
+
+func (r *Rejection) Error() string {
+	switch {
+	case r.Code == QuotaExceeded:
+		return fmt.Sprintf("daily quota of %d %s calls exceeded; resets at %s", r.Limit, r.Tool, r.ResetAt.Format(time.RFC3339))
+	case r.Scope == ScopeGlobal:
+		return fmt.Sprintf("global rate limit exceeded; retry after %ds", r.RetryAfterSeconds)
+	case r.Scope == ScopeClient:
+		return fmt.Sprintf("per-client rate limit exceeded; retry after %ds", r.RetryAfterSeconds)
+	}
+	return fmt.Sprintf("rate limit for %s exceeded; retry after %s", r.Tool, r.ResetAt.Format(time.RFC3339))
+}
+
+// ToolState describes one client's budget and usage of a tool.
+type ToolState struct {
+	Tool              string  `json:"tool"`
+	RequestsPerMinute int     `json:"requests_per_minute"`
+	BurstSize         int     `json:"burst_size"`
+	Tokens            float64 `json:"tokens_available"`
+	DailyQuota        int     `json:"daily_quota,omitempty"`
+	UsedToday         int     `json:"used_today"`
+}
+
+type quotaKey struct {
+	client string
+	tool   string
+}
+
+// Reservation is a tool call admitted by ReserveTool.
+type Reservation struct {
+	l     *Limiter
+	key   quotaKey
+	day   time.Time
+	quota bool
+	res   *rate.Reservation
+}
+
+// SetToolLimit sets the per-client budget and daily quota for tool.
+func (l *Limiter) SetToolLimit(tool string, limit ToolLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.toolLimits[tool] = limit
+	for _, c := range l.clients {
+		delete(c.tools, tool)
+	}
+}
+
+// ReserveTool charges one call of tool to the client identified by key
+// against the tool's budget and daily quota. Tools without a configured
+// limit are always admitted with a nil reservation. The global and
+// per-client budgets are not consulted; callers apply them with Allow and
+// Cancel the reservation if Allow refuses the call.
+func (l *Limiter) ReserveTool(key, tool string) (*Reservation, *Rejection) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.toolLimits[tool]
+	if !ok {
+		return nil, nil
+	}
+	l.sweepLocked(now)
+	l.resetQuotasLocked(now)
+	c := l.clientLocked(key, now)
+	qk := quotaKey{client: key, tool: tool}
+
+	if limit.DailyQuota > 0 && l.quotas[qk] >= limit.DailyQuota {
+		c.rejected++
+		reset := l.quotaDay.Add(24 * time.Hour)
+		return nil, &Rejection{
+			Code:              QuotaExceeded,
+			ErrorCode:         toolerr.QuotaExceeded,
+			Scope:             ScopeTool,
+			Tool:              tool,
+			Limit:             limit.DailyQuota,
+			Period:            "day",
+			ResetAt:           reset,
+			RetryAfterSeconds: retryAfter(reset.Sub(now)),
+		}
+	}
+
+	tl, ok := c.tools[tool]
+	if !ok {
+		tl = limit.Limit.limiter()
+		c.tools[tool] = tl
+	}
+	res := tl.ReserveN(now, 1)
+	if delay := res.DelayFrom(now); !res.OK() || delay > 0 {
+		res.CancelAt(now)
+		c.rejected++
+		if !res.OK() {
+			delay = time.Minute
+		}
+		remaining := 0
+		if limit.DailyQuota > 0 {
+			remaining = limit.DailyQuota - l.quotas[qk]
+		}
+		return nil, &Rejection{
+			Code:              RateLimited,
+			ErrorCode:         toolerr.RateLimited,
+			Scope:             ScopeTool,
+			Tool:              tool,
+			Limit:             limit.RequestsPerMinute,
+			Period:            "minute",
+			Remaining:         remaining,
+			ResetAt:           now.Add(delay).UTC(),
+			RetryAfterSeconds: retryAfter(delay),
+		}
+	}
+
+	r := &Reservation{l: l, key: qk, day: l.quotaDay, res: res}
+	if limit.DailyQuota > 0 {
+		l.quotas[qk]++
+		r.quota = true
+	}
+	return r, nil
+}
+
+// Cancel refunds the reserved call. It is safe to call on a nil reservation.
+func (r *Reservation) Cancel() {
+	if r == nil {
+		return
+	}
+	r.l.mu.Lock()
+	defer r.l.mu.Unlock()
+
+	r.res.Cancel()
+	if r.quota && r.l.quotaDay.Equal(r.day) && r.l.quotas[r.key] > 0 {
+		r.l.quotas[r.key]--
+	}
+}
+
+// resetQuotasLocked clears quota usage when a new UTC day starts. l.mu must
+// be held.
+func (l *Limiter) resetQuotasLocked(now time.Time) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(l.quotaDay) {
+		l.quotaDay = day
+		clear(l.quotas)
+	}
+}
+
+// toolStatesLocked returns the client's usage of every limited tool it has
+// called, sorted by tool. l.mu must be held.
+func (l *Limiter) toolStatesLocked(key string, c *client, now time.Time) []ToolState {
+	var states []ToolState
+	for tool, tl := range c.tools {
+		limit := l.toolLimits[tool]
+		states = append(states, ToolState{
+			Tool:              tool,
+			RequestsPerMinute: limit.RequestsPerMinute,
+			BurstSize:         limit.BurstSize,
+			Tokens:            tl.TokensAt(now),
+			DailyQuota:        limit.DailyQuota,
+			UsedToday:         l.quotas[quotaKey{client: key, tool: tool}],
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Tool < states[j].Tool
+	})
+	return states
+}
+
+func retryAfter(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
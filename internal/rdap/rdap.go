@@ -0,0 +1,340 @@
+// Package rdap looks up the registration date of domains with the
+// Registration Data Access Protocol (RFC 9082, RFC 9083), the structured
+// successor of WHOIS.
+//
+// The RDAP server of a top-level domain is found in the IANA bootstrap
+// registry (RFC 9224), which is downloaded on first use and refreshed when
+// the cache TTL passes. Lookups are made for the registrable domain, so
+// mail.example.com and example.com share one cached result.
+//
+// Security considerations:
+//   - Only https servers are queried, and redirects are followed only to
+//     https; plain http is accepted only for loopback servers
+//   - Response bodies are bounded
+package rdap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/config"
+)
+
+const (
+	// maxResponseSize bounds the responses read from RDAP servers.
+	maxResponseSize = 256 << 10
+
+	// maxBootstrapSize bounds the IANA bootstrap file.
+	maxBootstrapSize = 2 << 20
+
+	// maxRedirects bounds the redirects followed by one lookup.
+	maxRedirects = 5
+)
+
+var (
+	// ErrNoServer is returned for domains whose top-level domain has no
+	// RDAP server in the bootstrap registry.
+	ErrNoServer = errors.New("no RDAP server for the top-level domain")
+
+	// ErrNotRegistered is returned for domains the registry does not know.
+	ErrNotRegistered = errors.New("domain is not registered")
+)
+
+// Registration is what the registry reports about a domain. Cached is set
+// when it was served from the cache rather than looked up.
+type Registration struct {
+	Domain    string     `json:"domain"`
+	Created   *time.Time `json:"created,omitempty"`
+	Registrar string     `json:"registrar,omitempty"`
+	Server    string     `json:"server"`
+	Cached    bool       `json:"-"`
+}
+
+// AgeDays returns the whole days from the registration of the domain to
+// now, or -1 when the registry gave no registration date.
+func (r *Registration) AgeDays(now time.Time) int {
+	if r.Created == nil {
+		return -1
+	}
+	return int(now.Sub(*r.Created) / (24 * time.Hour))
+}
+
+type entry struct {
+	registration Registration
+	expires      time.Time
+}
+
+// Client looks up domains over RDAP and caches the registrations.
+type Client struct {
+	bootstrapURL string
+	cacheTTL     time.Duration
+	cacheSize    int
+	http         *http.Client
+
+	mu    sync.Mutex
+	cache map[string]entry
+
+	// bootstrap registry; see server
+	bootstrapMu sync.Mutex
+	servers     map[string]string
+	refreshAt   time.Time
+}
+
+// New returns a client for cfg, or nil when RDAP lookups are disabled.
+func New(cfg config.RDAPConfig) *Client {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Client{
+		bootstrapURL: cfg.BootstrapURL,
+		cacheTTL:     cfg.CacheTTL,
+		cacheSize:    cfg.CacheSize,
+		cache:        make(map[string]entry),
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				if !secure(req.URL) {
+					return fmt.Errorf("refusing redirect to %s", req.URL.Redacted())
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// Lookup returns the registration of the registrable domain of domain,
+// from the cache when a lookup is recent enough.
+func (c *Client) Lookup(ctx context.Context, domain string) (*Registration, error) {
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), "."))
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain %q", domain)
+	}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(ascii)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a registrable domain", ascii)
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.cache[registrable]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		registration := e.registration
+		registration.Cached = true
+		return &registration, nil
+	}
+	c.mu.Unlock()
+
+	server, err := c.server(ctx, registrable[strings.LastIndex(registrable, ".")+1:])
+	if err != nil {
+		return nil, err
+	}
+	registration, err := c.lookup(ctx, server, registrable)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= c.cacheSize {
+		c.evict(now)
+	}
+	c.cache[registrable] = entry{registration: *registration, expires: now.Add(c.cacheTTL)}
+	return registration, nil
+}
+
+// Prune drops the expired registrations from the cache and returns how
+// many were dropped.
+func (c *Client) Prune(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			n++
+		}
+	}
+	return n
+}
+
+// evict makes room in the cache by dropping expired registrations, or the
+// one expiring first when none has.
+func (c *Client) evict(now time.Time) {
+	var oldest string
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.cache[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.cache) >= c.cacheSize {
+		delete(c.cache, oldest)
+	}
+}
+
+// server returns the base URL of the RDAP server for tld, downloading the
+// bootstrap registry when it is not loaded or out of date. A registry that
+// fails to refresh is used until the next attempt.
+func (c *Client) server(ctx context.Context, tld string) (string, error) {
+	c.bootstrapMu.Lock()
+	defer c.bootstrapMu.Unlock()
+	if c.servers == nil || !time.Now().Before(c.refreshAt) {
+		servers, err := c.bootstrap(ctx)
+		if err != nil && c.servers == nil {
+			return "", err
+		}
+		if err == nil {
+			c.servers = servers
+		}
+		c.refreshAt = time.Now().Add(c.cacheTTL)
+	}
+	server, ok := c.servers[tld]
+	if !ok {
+		return "", fmt.Errorf("%w .%s", ErrNoServer, tld)
+	}
+	return server, nil
+}
+
+// bootstrap downloads the bootstrap registry and returns the first usable
+// server of each top-level domain.
+func (c *Client) bootstrap(ctx context.Context) (map[string]string, error) {
+	var registry struct {
+		Services [][][]string `json:"services"`
+	}
+	if err := c.get(ctx, c.bootstrapURL, maxBootstrapSize, &registry); err != nil {
+		return nil, fmt.Errorf("failed to load the RDAP bootstrap registry: %w", err)
+	}
+	servers := make(map[string]string)
+	for _, service := range registry.Services {
+		if len(service) != 2 {
+			continue
+		}
+		for _, base := range service[1] {
+			u, err := url.Parse(base)
+			if err != nil || !secure(u) {
+				continue
+			}
+			for _, tld := range service[0] {
+				servers[strings.ToLower(tld)] = strings.TrimSuffix(base, "/") + "/"
+			}
+			break
+		}
+	}
+	return servers, nil
+}
+
+// lookup queries server for the registration of domain.
+func (c *Client) lookup(ctx context.Context, server, domain string) (*Registration, error) {
+	var body struct {
+		Events []struct {
+			Action string    `json:"eventAction"`
+			Date   time.Time `json:"eventDate"`
+		} `json:"events"`
+		Entities []struct {
+			Roles []string          `json:"roles"`
+			VCard []json.RawMessage `json:"vcardArray"`
+		} `json:"entities"`
+	}
+	if err := c.get(ctx, server+"domain/"+domain, maxResponseSize, &body); err != nil {
+		return nil, err
+	}
+	registration := &Registration{Domain: domain, Server: server}
+	for _, event := range body.Events {
+		if event.Action == "registration" {
+			created := event.Date.UTC()
+			registration.Created = &created
+			break
+		}
+	}
+	for _, entity := range body.Entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" && len(entity.VCard) == 2 {
+				registration.Registrar = formattedName(entity.VCard[1])
+			}
+		}
+	}
+	return registration, nil
+}
+
+// get fetches an RDAP resource into v.
+func (c *Client) get(ctx context.Context, target string, maxSize int64, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/rdap+json, application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("RDAP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotRegistered
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("RDAP error: %s", resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read RDAP response: %w", err)
+	}
+	if int64(len(content)) > maxSize {
+		return fmt.Errorf("RDAP response exceeds %d bytes", maxSize)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("invalid RDAP response: %w", err)
+	}
+	return nil
+}
+
+// formattedName returns the fn property of a jCard (RFC 7095) property
+// list.
+func formattedName(properties json.RawMessage) string {
+	var list [][]json.RawMessage
+	if json.Unmarshal(properties, &list) != nil {
+		return ""
+	}
+	for _, property := range list {
+		var name, value string
+		if len(property) == 4 && json.Unmarshal(property[0], &name) == nil && name == "fn" &&
+			json.Unmarshal(property[3], &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// secure reports whether u is an https URL, or an http URL of a loopback
+// server.
+func secure(u *url.URL) bool {
+	if u.Scheme == "https" {
+		return true
+	}
+	if u.Scheme != "http" {
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
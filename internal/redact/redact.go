@@ -0,0 +1,154 @@
+// Package redact masks personal data before it is written to logs or the
+// audit log.
+//
+// Three classes of data can be masked independently:
+//   - Email addresses keep their domain, which is rarely personal and is what
+//     reputation investigations need: alice@example.com becomes ***@example.com
+//   - Message content, recognised by field name or by an RFC 5322 header
+//     block, is replaced by its size
+//   - IP addresses keep their network: the last octet of IPv4 and everything
+//     past the /48 of IPv6 are masked; loopback and unspecified addresses are
+//     left alone
+//
+// The Redactor is installed as a logrus hook so every entry is masked,
+// including its message and error, before any formatter sees it.
+package redact
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,})`)
+	ipv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern  = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}x?`)
+	headerField  = regexp.MustCompile(`(?i)(?:^|\s)(?:from|to|cc|subject|date|received|return-path|reply-to|message-id|mime-version|content-type|delivered-to):`)
+)
+
+// bodyFields are log field names whose values are message content.
+var bodyFields = map[string]bool{
+	"content":     true,
+	"body":        true,
+	"email":       true,
+	"raw":         true,
+	"test_emails": true,
+}
+
+// Redactor masks the configured classes of personal data.
+type Redactor struct {
+	emails bool
+	bodies bool
+	ips    bool
+}
+
+// New creates a redactor for cfg.
+func New(cfg config.RedactionConfig) *Redactor {
+	return &Redactor{emails: cfg.Emails, bodies: cfg.Bodies, ips: cfg.IPs}
+}
+
+// String masks email addresses, IP addresses and message bodies in s.
+// Masking is idempotent.
+func (r *Redactor) String(s string) string {
+	if r.bodies {
+		if start := messageStart(s); start >= 0 {
+			return s[:start] + body(len(s)-start)
+		}
+	}
+	if r.emails {
+		s = emailPattern.ReplaceAllString(s, "***@$1")
+	}
+	if r.ips {
+		s = ipv6Pattern.ReplaceAllStringFunc(s, maskIP)
+		s = ipv4Pattern.ReplaceAllStringFunc(s, maskIP)
+	}
+	return s
+}
+
+// Value masks a named value. Strings, errors and string slices are masked;
+// other values are returned unchanged.
+func (r *Redactor) Value(name string, v any) any {
+	if r.bodies && bodyFields[name] {
+		switch v := v.(type) {
+		case string:
+			return body(len(v))
+		case []string:
+			masked := make([]string, len(v))
+			for i, s := range v {
+				masked[i] = body(len(s))
+			}
+			return masked
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case error:
+		return r.String(v.Error())
+	case []string:
+		masked := make([]string, len(v))
+		for i, s := range v {
+			masked[i] = r.String(s)
+		}
+		return masked
+	}
+	return v
+}
+
+// Levels implements logrus.Hook.
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook by masking the entry's message and fields in
+// place, before it is formatted.
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.String(entry.Message)
+	for name, value := range entry.Data {
+		entry.Data[name] = r.Value(name, value)
+	}
+	return nil
+}
+
+func body(size int) string {
+	return fmt.Sprintf("[redacted message body, %d bytes]", size)
+}
+
+// messageStart returns the offset of an embedded RFC 5322 message in s: a
+// common header field followed, somewhere after it, by the blank line that
+// ends the header block. It returns -1 if s contains no message.
+func messageStart(s string) int {
+	loc := headerField.FindStringIndex(s)
+	if loc == nil {
+		return -1
+	}
+	start := loc[0]
+	if strings.ContainsRune(" \t\r\n", rune(s[start])) {
+		start++ // the match includes the preceding whitespace
+	}
+	rest := s[start:]
+	if !strings.Contains(rest, "\n\n") && !strings.Contains(rest, "\r\n\r\n") {
+		return -1
+	}
+	return start
+}
+
+func maskIP(s string) string {
+	if strings.HasSuffix(s, "x") {
+		return s // already masked
+	}
+	ip := net.ParseIP(s)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return s
+	}
+	if v4 := ip.To4(); v4 != nil && strings.Contains(s, ".") {
+		return fmt.Sprintf("%d.%d.%d.x", v4[0], v4[1], v4[2])
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "x"
+}
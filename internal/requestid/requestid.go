@@ -0,0 +1,57 @@
+// Package requestid correlates everything one MCP request produces: its log
+// entries, its audit record and its result.
+//
+// An ID is generated when a request arrives and carried in its context. Log
+// entries made with logrus.WithContext pick it up through Hook, so an
+// operator can find every entry of a scan from the ID a client reports.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Field is the name of the ID in log entries and result metadata.
+const Field = "request_id"
+
+type idKey struct{}
+
+// New returns a random request ID.
+func New() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// With returns a context carrying the request ID id.
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey{}, id)
+}
+
+// From returns the request ID stored in ctx, or "" if there is none.
+func From(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Hook adds the request ID of an entry's context to the entry's fields.
+type Hook struct{}
+
+// Levels implements logrus.Hook.
+func (Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (Hook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if id := From(entry.Context); id != "" {
+		entry.Data[Field] = id
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Package resolver provides the DNS resolver used by the sender
+// authentication checks (SPF, DKIM, DMARC).
+//
+// By default the system resolver is used. A specific server can be
+// configured instead, e.g. a local validating resolver, so lookups made on
+// behalf of analysts do not depend on the host's resolver configuration.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// New returns the resolver configured by cfg.
+func New(cfg config.DNSConfig) *net.Resolver {
+	if cfg.Server == "" {
+		return net.DefaultResolver
+	}
+
+	var dialer net.Dialer
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, cfg.Server)
+		},
+	}
+}
+
+// NotFound reports whether err means the name does not exist or has no
+// records of the requested type, as opposed to a lookup failure.
+func NotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// FQDN returns name as an absolute domain name, so search domains from the
+// host's resolver configuration are never appended.
+func FQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
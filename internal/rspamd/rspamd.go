@@ -0,0 +1,146 @@
+// Package rspamd scans messages with an rspamd worker over its HTTP
+// protocol, for comparison with SpamAssassin.
+//
+// Messages are scanned with /checkv2 only; the client never trains rspamd
+// or changes its configuration.
+//
+// Security considerations:
+//   - The password is sent only to the configured worker; redirects are not
+//     followed
+//   - Response bodies are bounded
+package rspamd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// maxResponseSize bounds the responses read from rspamd.
+const maxResponseSize = 1 << 20
+
+// Spam actions; the others are "no action", "greylist" and "soft reject".
+var spamActions = map[string]bool{
+	"reject":          true,
+	"add header":      true,
+	"rewrite subject": true,
+}
+
+// Symbol is a symbol rspamd inserted, with its weighted score.
+type Symbol struct {
+	Name        string   `json:"name"`
+	Score       float64  `json:"score"`
+	Description string   `json:"description,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// Result is the verdict of rspamd on a message. RequiredScore is the score
+// of the reject action; IsSpam is set for the reject, add header and rewrite
+// subject actions.
+type Result struct {
+	Score         float64  `json:"score"`
+	RequiredScore float64  `json:"required_score"`
+	Action        string   `json:"action"`
+	IsSpam        bool     `json:"is_spam"`
+	Skipped       bool     `json:"skipped,omitempty"`
+	Symbols       []Symbol `json:"symbols"`
+}
+
+// Client scans messages with one rspamd worker.
+type Client struct {
+	url      string
+	password string
+	http     *http.Client
+}
+
+// New returns a client for cfg, or nil when no worker is configured.
+func New(cfg config.RspamdConfig) *Client {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &Client{
+		url:      strings.TrimSuffix(cfg.URL, "/") + "/checkv2",
+		password: cfg.Password,
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Check scans message. Symbols are ordered by descending score, then name.
+func (c *Client) Check(ctx context.Context, message []byte) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "message/rfc822")
+	if c.password != "" {
+		req.Header.Set("Password", c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rspamd request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("rspamd request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("rspamd returned %s: %s", resp.Status, e.Error)
+		}
+		return nil, fmt.Errorf("rspamd returned %s", resp.Status)
+	}
+
+	var reply struct {
+		IsSkipped     bool    `json:"is_skipped"`
+		Score         float64 `json:"score"`
+		RequiredScore float64 `json:"required_score"`
+		Action        string  `json:"action"`
+		Symbols       map[string]struct {
+			Name        string   `json:"name"`
+			Score       float64  `json:"score"`
+			Description string   `json:"description"`
+			Options     []string `json:"options"`
+		} `json:"symbols"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("invalid rspamd response: %w", err)
+	}
+	result := &Result{
+		Score:         reply.Score,
+		RequiredScore: reply.RequiredScore,
+		Action:        reply.Action,
+		IsSpam:        spamActions[reply.Action],
+		Skipped:       reply.IsSkipped,
+		Symbols:       make([]Symbol, 0, len(reply.Symbols)),
+	}
+	for name, s := range reply.Symbols {
+		if s.Name != "" {
+			name = s.Name
+		}
+		result.Symbols = append(result.Symbols, Symbol{Name: name, Score: s.Score, Description: s.Description, Options: s.Options})
+	}
+	sort.Slice(result.Symbols, func(i, j int) bool {
+		a, b := result.Symbols[i], result.Symbols[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
@@ -0,0 +1,282 @@
+// Package ruledeploy keeps the versions of custom rules deployed with
+// deploy_rules and switches the rule file spamd loads between them.
+//
+// Every deployment is stored as a numbered file in the deployment directory,
+// e.g. 000042.cf, starting with a header that names its version, who
+// deployed it and when. The active version is copied to the rule file in
+// spamd's site configuration directory. A deployment is staged, which makes
+// it active, and then either committed or rolled back, which restores the
+// previous rule file.
+//
+// Security considerations:
+//   - Only rules that passed sandbox.Validate and lint are staged
+//   - Files are replaced atomically, and only one deployment is staged at a
+//     time
+//   - Header values are single lines, so they cannot inject directives
+package ruledeploy
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/localcf"
+)
+
+// MaxCommentLength is the longest comment accepted for a deployment.
+const MaxCommentLength = 200
+
+// headerPrefix starts the first line of every version file.
+const headerPrefix = "# spamassassin-mcp rule deployment version "
+
+// ErrBusy is returned when another deployment is staged.
+var ErrBusy = errors.New("another rule deployment is in progress")
+
+var (
+	versionFileRegex = regexp.MustCompile(`^(\d{6})\.cf$`)
+	headerFieldRegex = regexp.MustCompile(`^# (deployed_at|deployed_by|comment): (.*)$`)
+)
+
+// Version describes a deployed version of the managed rules.
+type Version struct {
+	Number     int       `json:"version"`
+	DeployedAt time.Time `json:"deployed_at"`
+	DeployedBy string    `json:"deployed_by,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+}
+
+// Store keeps the deployed versions.
+type Store struct {
+	mu   sync.Mutex
+	dir  string
+	file string
+	keep int
+}
+
+// New creates a store for cfg. It returns nil when deployment is disabled.
+// The directory is created by the first deployment.
+func New(cfg config.RuleDeploymentConfig) *Store {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &Store{dir: cfg.Dir, file: cfg.File, keep: cfg.Keep}
+}
+
+// File returns the rule file spamd loads.
+func (s *Store) File() string {
+	return s.file
+}
+
+// ValidateComment checks that a comment fits on one header line.
+func ValidateComment(comment string) error {
+	if len(comment) > MaxCommentLength {
+		return fmt.Errorf("comment exceeds %d characters", MaxCommentLength)
+	}
+	if strings.ContainsFunc(comment, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return fmt.Errorf("comment must be a single line without control characters")
+	}
+	return nil
+}
+
+// Deployment is a staged version. Its rules are active until it is rolled
+// back; Commit or Rollback must be called to end it.
+type Deployment struct {
+	store *Store
+
+	// Version is the staged version and Previous the version it replaced,
+	// nil when the rule file did not exist or was not written by a
+	// deployment.
+	Version  Version
+	Previous *Version
+
+	previous []byte
+	perm     fs.FileMode
+	done     bool
+}
+
+// Stage stores rules as the next version and makes it active. Number is
+// assigned; the other fields of v are recorded in the version's header.
+func (s *Store) Stage(rules string, v Version) (*Deployment, error) {
+	if !s.mu.TryLock() {
+		return nil, ErrBusy
+	}
+	d, err := s.stage(rules, v)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Store) stage(rules string, v Version) (*Deployment, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create deployment directory: %w", err)
+	}
+	numbers, err := s.numbers()
+	if err != nil {
+		return nil, err
+	}
+	v.Number = 1
+	if len(numbers) > 0 {
+		v.Number = numbers[len(numbers)-1] + 1
+	}
+
+	d := &Deployment{store: s, Version: v, perm: 0o644}
+	d.previous, err = os.ReadFile(s.file)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read %s: %w", s.file, err)
+	default:
+		if info, err := os.Stat(s.file); err == nil {
+			d.perm = info.Mode().Perm()
+		}
+		d.Previous = parseHeader(d.previous)
+	}
+
+	content := render(rules, v)
+	path := s.versionPath(v.Number)
+	if err := localcf.WriteAtomic(path, content, 0o640); err != nil {
+		return nil, fmt.Errorf("failed to store version %d: %w", v.Number, err)
+	}
+	if err := localcf.WriteAtomic(s.file, content, d.perm); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write %s: %w", s.file, err)
+	}
+	return d, nil
+}
+
+// Commit keeps the staged version and removes the oldest versions beyond
+// the configured number to keep.
+func (d *Deployment) Commit() error {
+	if d.done {
+		return nil
+	}
+	d.done = true
+	defer d.store.mu.Unlock()
+
+	numbers, err := d.store.numbers()
+	if err != nil {
+		return err
+	}
+	for len(numbers) > d.store.keep {
+		if err := os.Remove(d.store.versionPath(numbers[0])); err != nil {
+			return fmt.Errorf("failed to remove old version %d: %w", numbers[0], err)
+		}
+		numbers = numbers[1:]
+	}
+	return nil
+}
+
+// Rollback restores the rule file that was active before the deployment,
+// or removes it if there was none, and discards the staged version.
+func (d *Deployment) Rollback() error {
+	if d.done {
+		return nil
+	}
+	d.done = true
+	defer d.store.mu.Unlock()
+
+	var err error
+	if d.previous != nil {
+		err = localcf.WriteAtomic(d.store.file, d.previous, d.perm)
+	} else {
+		err = os.Remove(d.store.file)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to restore %s: %w", d.store.file, err)
+	}
+	if err := os.Remove(d.store.versionPath(d.Version.Number)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to discard version %d: %w", d.Version.Number, err)
+	}
+	return nil
+}
+
+// numbers returns the stored version numbers in ascending order.
+func (s *Store) numbers() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployment directory: %w", err)
+	}
+	var numbers []int
+	for _, entry := range entries {
+		if m := versionFileRegex.FindStringSubmatch(entry.Name()); m != nil && entry.Type().IsRegular() {
+			n, _ := strconv.Atoi(m[1])
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+func (s *Store) versionPath(n int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d.cf", n))
+}
+
+// render prefixes rules with the version header.
+func render(rules string, v Version) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s%d\n", headerPrefix, v.Number)
+	fmt.Fprintf(&b, "# deployed_at: %s\n", v.DeployedAt.UTC().Format(time.RFC3339))
+	if v.DeployedBy != "" {
+		fmt.Fprintf(&b, "# deployed_by: %s\n", singleLine(v.DeployedBy))
+	}
+	if v.Comment != "" {
+		fmt.Fprintf(&b, "# comment: %s\n", singleLine(v.Comment))
+	}
+	b.WriteString("\n")
+	b.WriteString(rules)
+	if !strings.HasSuffix(rules, "\n") {
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+// parseHeader reads the version header of a rule file, returning nil if it
+// has none.
+func parseHeader(data []byte) *Version {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(scanner.Text(), headerPrefix))
+	if !strings.HasPrefix(scanner.Text(), headerPrefix) || err != nil {
+		return nil
+	}
+	v := &Version{Number: n}
+	for scanner.Scan() {
+		m := headerFieldRegex.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			break
+		}
+		switch m[1] {
+		case "deployed_at":
+			v.DeployedAt, _ = time.Parse(time.RFC3339, m[2])
+		case "deployed_by":
+			v.DeployedBy = m[2]
+		case "comment":
+			v.Comment = m[2]
+		}
+	}
+	return v
+}
+
+func singleLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
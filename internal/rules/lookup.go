@@ -0,0 +1,239 @@
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrRuleNotFound is returned when no rule file mentions a rule.
+var ErrRuleNotFound = errors.New("rule not found")
+
+var ruleNameRegex = regexp.MustCompile(`^[A-Za-z0-9_]{1,128}$`)
+
+// definitionTypes are the configuration keywords that define a rule.
+var definitionTypes = map[string]bool{
+	"header": true, "body": true, "rawbody": true, "full": true, "uri": true,
+	"meta": true, "mimeheader": true, "uri_detail": true, "askdns": true,
+	"uridnsbl": true, "urirhsbl": true, "urirhssub": true, "urinsrhsbl": true,
+	"urinsrhssub": true, "urifullnsrhsbl": true, "urifullnsrhssub": true,
+}
+
+// Scoresets are the four score columns SpamAssassin chooses from depending
+// on which engines are enabled: 0 neither Bayes nor network tests, 1 network
+// tests only, 2 Bayes only, 3 both.
+type Scoresets [4]float64
+
+// Definition is one line defining a rule.
+type Definition struct {
+	// Type is the definition keyword, such as header, body or meta.
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+
+	// Conditions are the enclosing if and ifplugin blocks, outermost first.
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// ScoreLine is one score line of a rule.
+type ScoreLine struct {
+	Scores Scoresets `json:"scores"`
+	File   string    `json:"file"`
+	Line   int       `json:"line"`
+}
+
+// RuleInfo describes a rule as configured by the installed rule files.
+type RuleInfo struct {
+	Name        string       `json:"name"`
+	Definitions []Definition `json:"definitions"`
+	Description string       `json:"description,omitempty"`
+	TFlags      []string     `json:"tflags,omitempty"`
+
+	// ScoreLines lists every score line in load order; the last one sets
+	// Score. When there is none, Score is SpamAssassin's implicit default
+	// and ScoreImplicit is set. Sub-rules (named __*) have no score.
+	ScoreLines    []ScoreLine `json:"score_lines"`
+	Score         *Scoresets  `json:"score,omitempty"`
+	ScoreImplicit bool        `json:"score_implicit,omitempty"`
+
+	// Files are the rule files that mention the rule, in load order.
+	Files []string `json:"files"`
+}
+
+// ValidRuleName reports whether name is an acceptable rule name.
+func ValidRuleName(name string) bool {
+	return ruleNameRegex.MatchString(name)
+}
+
+// Lookup returns the definition, description, flags and scores of a rule,
+// reading the rule files in the order SpamAssassin loads them: directories
+// of lower precedence first (so site configuration overrides the
+// distributed rules), files in name order within each.
+func (c *Catalog) Lookup(name string) (*RuleInfo, error) {
+	if !ValidRuleName(name) {
+		return nil, fmt.Errorf("invalid rule name: %q", name)
+	}
+
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return c.precedence(files[i].Path) > c.precedence(files[j].Path)
+	})
+
+	info := &RuleInfo{Name: name, Definitions: make([]Definition, 0), ScoreLines: make([]ScoreLine, 0), Files: make([]string, 0)}
+	for _, f := range files {
+		data, err := readFile(&f)
+		if err != nil {
+			return nil, err
+		}
+		if info.scan(f.Name, data) && !slices.Contains(info.Files, f.Name) {
+			info.Files = append(info.Files, f.Name)
+		}
+	}
+	if len(info.Files) == 0 {
+		return nil, ErrRuleNotFound
+	}
+
+	if n := len(info.ScoreLines); n > 0 {
+		score := info.ScoreLines[n-1].Scores
+		info.Score = &score
+	} else if !strings.HasPrefix(name, "__") {
+		score := implicitScore(info)
+		info.Score = &score
+		info.ScoreImplicit = true
+	}
+	return info, nil
+}
+
+// precedence returns the index of the catalog directory containing path.
+func (c *Catalog) precedence(path string) int {
+	for i, dir := range c.dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return i
+		}
+	}
+	return len(c.dirs)
+}
+
+// scan records the lines of a rule file that concern the rule, reporting
+// whether there were any.
+func (info *RuleInfo) scan(file string, data []byte) bool {
+	found := false
+	var conditions []string
+	lineNo := 0
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), MaxFileSize)
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		keyword, rest := cutField(line)
+
+		switch keyword {
+		case "if", "ifplugin":
+			conditions = append(conditions, line)
+			continue
+		case "else":
+			if n := len(conditions); n > 0 {
+				conditions[n-1] = "else of " + conditions[n-1]
+			}
+			continue
+		case "endif":
+			if n := len(conditions); n > 0 {
+				conditions = conditions[:n-1]
+			}
+			continue
+		}
+
+		name, value := cutField(rest)
+		if name != info.Name {
+			continue
+		}
+
+		switch {
+		case definitionTypes[keyword]:
+			info.Definitions = append(info.Definitions, Definition{
+				Type:       keyword,
+				Value:      value,
+				File:       file,
+				Line:       lineNo,
+				Conditions: slices.Clone(conditions),
+			})
+		case keyword == "describe":
+			info.Description = value
+		case keyword == "tflags":
+			info.TFlags = strings.Fields(value)
+		case keyword == "score":
+			scores, ok := parseScores(value)
+			if !ok {
+				continue
+			}
+			info.ScoreLines = append(info.ScoreLines, ScoreLine{Scores: scores, File: file, Line: lineNo})
+		default:
+			continue
+		}
+		found = true
+	}
+	return found
+}
+
+// parseScores parses the values of a score line: one score for every
+// scoreset, or four.
+func parseScores(value string) (Scoresets, bool) {
+	var s Scoresets
+	fields := strings.Fields(value)
+	if len(fields) != 1 && len(fields) != 4 {
+		return s, false
+	}
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.Trim(f, "()"), 64)
+		if err != nil {
+			return s, false
+		}
+		s[i] = v
+	}
+	if len(fields) == 1 {
+		s = Scoresets{s[0], s[0], s[0], s[0]}
+	}
+	return s, true
+}
+
+// implicitScore is the score SpamAssassin assigns a rule without a score
+// line: 0.01 for T_ test rules, -1 for rules flagged nice, otherwise 1.
+func implicitScore(info *RuleInfo) Scoresets {
+	switch {
+	case strings.HasPrefix(info.Name, "T_"):
+		return Scoresets{0.01, 0.01, 0.01, 0.01}
+	case slices.Contains(info.TFlags, "nice"):
+		return Scoresets{-1, -1, -1, -1}
+	}
+	return Scoresets{1, 1, 1, 1}
+}
+
+// cutField splits s around its first run of blanks.
+func cutField(s string) (field, rest string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// stripComment removes a trailing # comment; \# is a literal hash.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] != '\\') {
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,147 @@
+// Package rules provides read-only access to the SpamAssassin rule files
+// installed on the host.
+//
+// Rule files are discovered by walking a list of configured directories, such
+// as the sa-update channel directories under /var/lib/spamassassin and the
+// site configuration in /etc/spamassassin. Files are identified by their base
+// name (e.g. 72_active.cf, local.cf); when the same name exists in more than
+// one directory the first configured directory wins.
+//
+// Security considerations:
+//   - Only *.cf and *.pre files are exposed
+//   - File names are validated to prevent path traversal
+//   - Reads are capped to avoid loading unexpectedly large files
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxFileSize is the largest rule file that will be read.
+const MaxFileSize = 4 * 1024 * 1024 // 4MB
+
+// ErrNotFound is returned when a rule file does not exist in any configured directory.
+var ErrNotFound = errors.New("rule file not found")
+
+var fileNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.(cf|pre)$`)
+
+// File describes a single rule file on disk.
+type File struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Catalog locates rule files within a fixed set of directories.
+type Catalog struct {
+	dirs []string
+}
+
+// NewCatalog creates a catalog over the given directories, in precedence order.
+func NewCatalog(dirs []string) *Catalog {
+	return &Catalog{dirs: dirs}
+}
+
+// ValidName reports whether name is an acceptable rule file name.
+func ValidName(name string) bool {
+	return fileNameRegex.MatchString(name)
+}
+
+// Files returns all rule files found in the catalog directories, sorted by name.
+// Missing directories are skipped silently.
+func (c *Catalog) Files() ([]File, error) {
+	seen := make(map[string]bool)
+	var files []File
+
+	for _, dir := range c.dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				// Skip hidden directories such as per-user .spamassassin state
+				if path != dir && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !ValidName(d.Name()) || seen[d.Name()] {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			seen[d.Name()] = true
+			files = append(files, File{
+				Name:    d.Name(),
+				Path:    path,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rule directory %s: %w", dir, err)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// Find returns the rule file with the given base name.
+func (c *Catalog) Find(name string) (*File, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid rule file name: %q", name)
+	}
+
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if files[i].Name == name {
+			return &files[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Read returns the contents of the rule file with the given base name.
+func (c *Catalog) Read(name string) ([]byte, error) {
+	file, err := c.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	return readFile(file)
+}
+
+// readFile returns the contents of a rule file found by the catalog.
+func readFile(file *File) ([]byte, error) {
+	if file.Size > MaxFileSize {
+		return nil, fmt.Errorf("rule file %s exceeds size limit of %d bytes", file.Name, MaxFileSize)
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(io.LimitReader(f, MaxFileSize))
+}
@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"bufio"
+	"bytes"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Summary is the site configuration as the installed rule files set it.
+type Summary struct {
+	// Files is the number of rule files read.
+	Files int `json:"files"`
+
+	// Rules is the number of distinct rules defined, not counting sub-rules
+	// (named __*), which RulesByType does include.
+	Rules       int            `json:"rules"`
+	SubRules    int            `json:"sub_rules"`
+	RulesByType map[string]int `json:"rules_by_type"`
+
+	// Plugins are the plugins loaded with loadplugin or tryplugin, in load
+	// order.
+	Plugins []string `json:"plugins"`
+
+	// Bayes holds the last value of every use_bayes* and bayes_* option.
+	Bayes map[string]string `json:"bayes"`
+
+	TrustedNetworks  []string `json:"trusted_networks"`
+	InternalNetworks []string `json:"internal_networks"`
+}
+
+// BayesEnabled reports whether use_bayes leaves Bayes on; it is on by
+// default.
+func (s *Summary) BayesEnabled() bool {
+	value, ok := s.Bayes["use_bayes"]
+	return !ok || value != "0"
+}
+
+// Summarize reads every rule file in the order SpamAssassin loads them and
+// summarizes the rules, plugins, Bayes options and networks they configure.
+// Conditional blocks are not evaluated, so rules and plugins inside if and
+// ifplugin blocks are counted whether or not they are active.
+func (c *Catalog) Summarize() (*Summary, error) {
+	files, err := c.Files()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return c.precedence(files[i].Path) > c.precedence(files[j].Path)
+	})
+
+	s := &Summary{
+		Files:            len(files),
+		RulesByType:      make(map[string]int),
+		Plugins:          make([]string, 0),
+		Bayes:            make(map[string]string),
+		TrustedNetworks:  make([]string, 0),
+		InternalNetworks: make([]string, 0),
+	}
+	defined := make(map[string]bool)
+	for _, f := range files {
+		data, err := readFile(&f)
+		if err != nil {
+			return nil, err
+		}
+		s.scan(data, defined)
+	}
+	return s, nil
+}
+
+func (s *Summary) scan(data []byte, defined map[string]bool) {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), MaxFileSize)
+	for sc.Scan() {
+		keyword, rest := cutField(strings.TrimSpace(stripComment(sc.Text())))
+		switch {
+		case definitionTypes[keyword]:
+			name, _ := cutField(rest)
+			if !ValidRuleName(name) || defined[name] {
+				continue
+			}
+			defined[name] = true
+			s.RulesByType[keyword]++
+			if strings.HasPrefix(name, "__") {
+				s.SubRules++
+			} else {
+				s.Rules++
+			}
+		case keyword == "loadplugin" || keyword == "tryplugin":
+			if plugin, _ := cutField(rest); plugin != "" && !slices.Contains(s.Plugins, plugin) {
+				s.Plugins = append(s.Plugins, plugin)
+			}
+		case keyword == "use_bayes" || keyword == "use_bayes_rules" || strings.HasPrefix(keyword, "bayes_"):
+			s.Bayes[keyword] = rest
+		case keyword == "trusted_networks":
+			s.TrustedNetworks = append(s.TrustedNetworks, strings.Fields(rest)...)
+		case keyword == "clear_trusted_networks":
+			s.TrustedNetworks = s.TrustedNetworks[:0]
+		case keyword == "internal_networks":
+			s.InternalNetworks = append(s.InternalNetworks, strings.Fields(rest)...)
+		case keyword == "clear_internal_networks":
+			s.InternalNetworks = s.InternalNetworks[:0]
+		}
+	}
+}
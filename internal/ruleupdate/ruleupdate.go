@@ -0,0 +1,370 @@
+// Package ruleupdate installs rule updates with sa-update and reports what
+// they changed.
+//
+// sa-update fetches the configured channels and verifies their GPG
+// signatures. The rule files are snapshotted before and after the run, so
+// the report names the files added, removed and modified and the version of
+// each channel. After an update the live configuration is checked with
+// spamassassin --lint before anyone reloads spamd with it.
+//
+// Security considerations:
+//   - sa-update and spamassassin are executed directly, never through a
+//     shell, with a minimal environment; only configured channels can be
+//     requested
+//   - Signature verification is on unless explicitly disabled in the
+//     configuration
+//   - Runs are bounded by a timeout, and only one update runs at a time
+package ruleupdate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/rules"
+	"spamassassin-mcp/internal/spamdreload"
+)
+
+// Report statuses.
+const (
+	StatusUpdated   = "updated"
+	StatusPartial   = "partial"
+	StatusUpToDate  = "up_to_date"
+	StatusAvailable = "available"
+)
+
+// maxMessages bounds the sa-update output lines included in a report.
+const maxMessages = 50
+
+var (
+	// ErrUnavailable is returned when sa-update or spamassassin cannot be
+	// run.
+	ErrUnavailable = errors.New("rule update tools are not available")
+
+	// ErrBusy is returned when another update is running.
+	ErrBusy = errors.New("a rule update is already running")
+
+	// versionRegex matches the version line sa-update writes at the top of
+	// a channel's include file, e.g. updates_spamassassin_org.cf.
+	versionRegex = regexp.MustCompile(`(?m)^# UPDATE version (\d+)`)
+
+	// logPrefixRegex matches the timestamp and level spamassassin puts
+	// before warnings, e.g. "Oct 15 10:00:00.123 [4242] warn: ".
+	logPrefixRegex = regexp.MustCompile(`^(?:.*?\[\d+\]\s+)?(?:warn|error|info|dbg):\s*`)
+)
+
+// Options select what an update does.
+type Options struct {
+	// Channels limits the update to some of the configured channels; empty
+	// updates all of them.
+	Channels []string
+	// CheckOnly reports whether updates are available without installing
+	// them.
+	CheckOnly bool
+}
+
+// ChannelVersion is the rule version of a channel before and after the run.
+// Versions are empty when the channel has not been installed.
+type ChannelVersion struct {
+	Channel         string `json:"channel"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	Version         string `json:"version,omitempty"`
+	Updated         bool   `json:"updated"`
+}
+
+// LintResult is the outcome of spamassassin --lint on the live
+// configuration after an update.
+type LintResult struct {
+	Valid  bool     `json:"valid"`
+	Issues []string `json:"issues"`
+}
+
+// Report describes an update run. Added, Removed and Modified are paths of
+// rule files. ReloadRequired is set when rules changed and spamd still has
+// to reload to use them; it should not be reloaded while Lint is not valid.
+// Reload is the outcome of the automatic sa-compile and reload, when
+// configured.
+type Report struct {
+	Status         string              `json:"status"`
+	ExitCode       int                 `json:"exit_code"`
+	CheckOnly      bool                `json:"check_only"`
+	Channels       []ChannelVersion    `json:"channels"`
+	Added          []string            `json:"added"`
+	Removed        []string            `json:"removed"`
+	Modified       []string            `json:"modified"`
+	Lint           *LintResult         `json:"lint,omitempty"`
+	ReloadRequired bool                `json:"reload_required"`
+	Reload         *spamdreload.Result `json:"reload,omitempty"`
+	Messages       []string            `json:"messages"`
+}
+
+// Updater runs sa-update.
+type Updater struct {
+	mu        sync.Mutex
+	cfg       config.RuleUpdatesConfig
+	lintTool  string
+	rulesDirs []string
+}
+
+// New creates an updater for cfg. The spamassassin tool of sa lints the
+// updated configuration, and the rule files in its rule directories and the
+// update directory are compared before and after each run.
+func New(cfg config.RuleUpdatesConfig, sa config.SpamAssassinConfig) *Updater {
+	return &Updater{cfg: cfg, lintTool: sa.Binary, rulesDirs: sa.RulesDirs}
+}
+
+// Channels returns the configured channels.
+func (u *Updater) Channels() []string {
+	return slices.Clone(u.cfg.Channels)
+}
+
+// Update runs sa-update for opts. Exit statuses 0, 1 and 3 (some channels
+// updated, others failed) produce a report; 2 (the site configuration fails
+// lint, so nothing was attempted) and 4 or higher (no channel updated) are
+// errors.
+func (u *Updater) Update(ctx context.Context, opts Options) (*Report, error) {
+	channels := opts.Channels
+	if len(channels) == 0 {
+		channels = u.cfg.Channels
+	}
+	for _, ch := range channels {
+		if !slices.Contains(u.cfg.Channels, ch) {
+			return nil, fmt.Errorf("channel %q is not configured in rule_updates.channels", ch)
+		}
+	}
+
+	if !u.mu.TryLock() {
+		return nil, ErrBusy
+	}
+	defer u.mu.Unlock()
+
+	before, err := u.snapshot(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	output, exitCode, err := u.exec(ctx, u.cfg.SaUpdate, u.args(channels, opts.CheckOnly)...)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{
+		ExitCode:  exitCode,
+		CheckOnly: opts.CheckOnly,
+		Added:     make([]string, 0),
+		Removed:   make([]string, 0),
+		Modified:  make([]string, 0),
+		Messages:  messages(output),
+	}
+	switch {
+	case exitCode == 0 && opts.CheckOnly:
+		report.Status = StatusAvailable
+	case exitCode == 0:
+		report.Status = StatusUpdated
+	case exitCode == 1:
+		report.Status = StatusUpToDate
+	case exitCode == 2:
+		return nil, fmt.Errorf("sa-update did not run because the site configuration fails lint: %s", lastMessage(report.Messages))
+	case exitCode == 3 && !opts.CheckOnly:
+		report.Status = StatusPartial
+	default:
+		return nil, fmt.Errorf("sa-update failed with exit status %d: %s", exitCode, lastMessage(report.Messages))
+	}
+
+	after, err := u.snapshot(channels)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range channels {
+		report.Channels = append(report.Channels, ChannelVersion{
+			Channel:         ch,
+			PreviousVersion: before.versions[ch],
+			Version:         after.versions[ch],
+			Updated:         before.versions[ch] != after.versions[ch],
+		})
+	}
+	for path, sum := range after.files {
+		previous, ok := before.files[path]
+		switch {
+		case !ok:
+			report.Added = append(report.Added, path)
+		case previous != sum:
+			report.Modified = append(report.Modified, path)
+		}
+	}
+	for path := range before.files {
+		if _, ok := after.files[path]; !ok {
+			report.Removed = append(report.Removed, path)
+		}
+	}
+	slices.Sort(report.Added)
+	slices.Sort(report.Removed)
+	slices.Sort(report.Modified)
+
+	if len(report.Added)+len(report.Removed)+len(report.Modified) > 0 {
+		report.Lint, err = u.Lint(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.ReloadRequired = true
+	}
+	return report, nil
+}
+
+func (u *Updater) args(channels []string, checkOnly bool) []string {
+	args := []string{"-v"}
+	for _, ch := range channels {
+		args = append(args, "--channel", ch)
+	}
+	if u.cfg.VerifyGPG {
+		for _, key := range u.cfg.GPGKeys {
+			args = append(args, "--gpgkey", key)
+		}
+		if u.cfg.GPGHomedir != "" {
+			args = append(args, "--gpghomedir", u.cfg.GPGHomedir)
+		}
+	} else {
+		args = append(args, "--nogpg")
+	}
+	if u.cfg.UpdateDir != "" {
+		args = append(args, "--updatedir", u.cfg.UpdateDir)
+	}
+	if checkOnly {
+		args = append(args, "--checkonly")
+	}
+	return args
+}
+
+// Lint checks the live configuration with spamassassin --lint. It runs
+// after every update that changed rules, and is used to check other rule
+// changes before spamd reloads them.
+func (u *Updater) Lint(ctx context.Context) (*LintResult, error) {
+	output, exitCode, err := u.exec(ctx, u.lintTool, "--lint")
+	if err != nil {
+		return nil, fmt.Errorf("live configuration lint: %w", err)
+	}
+	result := &LintResult{Issues: make([]string, 0)}
+	for _, line := range messages(output) {
+		result.Issues = append(result.Issues, logPrefixRegex.ReplaceAllString(line, ""))
+	}
+	result.Valid = exitCode == 0 && len(result.Issues) == 0
+	return result, nil
+}
+
+// exec runs a tool, returning its combined output. A non-zero exit status
+// is not an error; it is reported through exitCode.
+func (u *Updater) exec(ctx context.Context, binary string, args ...string) (output string, exitCode int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME"), "LANG=C"}
+	// sa-update downloads through the proxy configured for the server.
+	for _, name := range []string{"http_proxy", "https_proxy", "no_proxy", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"} {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", 0, fmt.Errorf("%s did not finish within %s", filepath.Base(binary), u.cfg.Timeout)
+	case errors.As(err, &exitErr):
+		return out.String(), exitErr.ExitCode(), nil
+	case err != nil:
+		return "", 0, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return out.String(), 0, nil
+}
+
+// snapshot is the content digest of every rule file and the installed
+// version of each channel.
+type snapshot struct {
+	files    map[string][sha256.Size]byte
+	versions map[string]string
+}
+
+func (u *Updater) snapshot(channels []string) (*snapshot, error) {
+	// sa-update writes channel updates.example.org to updates_example_org/
+	// and includes it from updates_example_org.cf.
+	includes := make(map[string]string)
+	for _, ch := range channels {
+		includes[strings.ReplaceAll(ch, ".", "_")+".cf"] = ch
+	}
+
+	s := &snapshot{files: make(map[string][sha256.Size]byte), versions: make(map[string]string)}
+	roots := u.rulesDirs
+	if u.cfg.UpdateDir != "" {
+		roots = append([]string{u.cfg.UpdateDir}, roots...)
+	}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root && errors.Is(err, fs.ErrNotExist) {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, seen := s.files[path]; seen || !d.Type().IsRegular() || !rules.ValidName(d.Name()) {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			s.files[path] = sha256.Sum256(data)
+			if ch, ok := includes[d.Name()]; ok {
+				if m := versionRegex.FindSubmatch(data); m != nil {
+					s.versions[ch] = string(m[1])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rule directory %s: %w", root, err)
+		}
+	}
+	return s, nil
+}
+
+// messages returns the non-empty lines of output, keeping the last
+// maxMessages.
+func messages(output string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxMessages {
+		lines = lines[len(lines)-maxMessages:]
+	}
+	return lines
+}
+
+func lastMessage(lines []string) string {
+	if len(lines) == 0 {
+		return "no output"
+	}
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,144 @@
+// Package s3test provides an in-process S3-compatible server for tests.
+//
+// The server answers path-style GET requests for objects stored with
+// PutObject and checks the AWS Signature Version 4 signature of every
+// request, recomputed with the objectstore signer. Every request is
+// recorded, so tests can check that a client only reads.
+//
+// Typical use:
+//
+//	srv := s3test.NewServer("AKIDEXAMPLE", "secret")
+//	defer srv.Close()
+//	srv.PutObject("archive", "journal/1.eml", raw)
+//	client, err := objectstore.New(srv.Config(config.ObjectBucket{Name: "archive"}))
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/objectstore"
+)
+
+// Region is the region the server expects requests to be signed for.
+const Region = "us-east-1"
+
+// Server is a fake S3-compatible server.
+type Server struct {
+	srv         *httptest.Server
+	credentials objectstore.Credentials
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	requests []string
+}
+
+// NewServer starts a fake S3 server on a loopback port accepting requests
+// signed with the given credentials.
+func NewServer(accessKeyID, secretAccessKey string) *Server {
+	s := &Server{
+		credentials: objectstore.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey},
+		objects:     make(map[string][]byte),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns an object store configuration pointing at the server and
+// allowing the given buckets.
+func (s *Server) Config(buckets ...config.ObjectBucket) config.ObjectStoreConfig {
+	return config.ObjectStoreConfig{
+		Endpoint:        s.srv.URL,
+		Region:          Region,
+		PathStyle:       true,
+		AccessKeyID:     s.credentials.AccessKeyID,
+		SecretAccessKey: s.credentials.SecretAccessKey,
+		Buckets:         buckets,
+		Timeout:         5 * time.Second,
+		MaxObjectSize:   1 << 20,
+		MaxMessages:     100,
+	}
+}
+
+// PutObject stores an object.
+func (s *Server) PutObject(bucket, key string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = content
+}
+
+// Requests returns the requests received so far as "METHOD /path", with the
+// path as sent.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.EscapedPath())
+	s.mu.Unlock()
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+		return
+	}
+	if !s.verify(r) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+		return
+	}
+
+	s.mu.Lock()
+	content, ok := s.objects[strings.TrimPrefix(r.URL.Path, "/")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	sum := md5.Sum(content)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("Last-Modified", time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content)
+}
+
+// verify recomputes the signature of r and compares it with the one sent.
+func (s *Server) verify(r *http.Request) bool {
+	signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	check, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return false
+	}
+	for name, values := range r.Header {
+		if lower := strings.ToLower(name); lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			check.Header[name] = values
+		}
+	}
+	credentials := s.credentials
+	credentials.SessionToken = r.Header.Get("X-Amz-Security-Token")
+	objectstore.SignV4(check, credentials, Region, signedAt)
+	return check.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+}
@@ -0,0 +1,126 @@
+package sandbox
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+var (
+	// logPrefixRegex matches the timestamp and level spamassassin puts
+	// before warnings, e.g. "Oct 15 10:00:00.123 [4242] warn: ".
+	logPrefixRegex = regexp.MustCompile(`^(?:.*?\[\d+\]\s+)?(warn|error|info|dbg):\s*`)
+
+	// summaryRegex matches the closing "lint: N issues detected" line.
+	summaryRegex = regexp.MustCompile(`^lint: \d+ issues? detected`)
+
+	ruleTokenRegex = regexp.MustCompile(`\b[A-Za-z0-9_]{3,}\b`)
+)
+
+// definingDirectives are the directives whose second field names a rule.
+var definingDirectives = map[string]bool{
+	"header": true, "body": true, "rawbody": true, "full": true, "uri": true,
+	"meta": true, "mimeheader": true, "uri_detail": true, "askdns": true,
+	"describe": true, "score": true, "tflags": true, "priority": true,
+}
+
+// LintIssue is a problem reported by spamassassin --lint. Line is the line
+// of the submitted rules it concerns, when it can be told.
+type LintIssue struct {
+	Line    int    `json:"line,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// LintResult is the outcome of linting submitted rules.
+type LintResult struct {
+	Valid  bool        `json:"valid"`
+	Issues []LintIssue `json:"issues"`
+
+	// Rules are the names of the rules the submission defines.
+	Rules []string `json:"rules"`
+}
+
+// Lint checks submitted rules with spamassassin --lint in a sandbox
+// configuration. The rules must have passed Validate.
+func (s *Sandbox) Lint(ctx context.Context, ruleText string) (*LintResult, error) {
+	r, err := s.prepare(ruleText)
+	if err != nil {
+		return nil, err
+	}
+	defer r.cleanup()
+
+	output, exitCode, err := s.exec(ctx, r, nil, "--lint")
+	if err != nil {
+		return nil, err
+	}
+
+	src := parseSource(ruleText)
+	result := &LintResult{Issues: make([]LintIssue, 0), Rules: src.names}
+	for _, line := range strings.Split(output, "\n") {
+		m := logPrefixRegex.FindStringSubmatch(line)
+		if m == nil || (m[1] != "warn" && m[1] != "error") {
+			continue
+		}
+		msg := strings.TrimSpace(line[len(m[0]):])
+		if msg == "" || summaryRegex.MatchString(msg) {
+			continue
+		}
+		result.Issues = append(result.Issues, src.locate(msg))
+	}
+	if exitCode != 0 && len(result.Issues) == 0 {
+		msg := strings.TrimSpace(output)
+		if msg == "" {
+			msg = "spamassassin --lint failed without a message"
+		}
+		result.Issues = append(result.Issues, LintIssue{Message: msg})
+	}
+	result.Valid = exitCode == 0 && len(result.Issues) == 0
+	return result, nil
+}
+
+// source indexes submitted rules to attribute lint messages to lines.
+type source struct {
+	lines       []string
+	names       []string
+	definitions map[string]int
+}
+
+func parseSource(ruleText string) *source {
+	src := &source{names: make([]string, 0), definitions: make(map[string]int)}
+	for i, line := range strings.Split(ruleText, "\n") {
+		line = strings.TrimSpace(line)
+		src.lines = append(src.lines, line)
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !definingDirectives[fields[0]] {
+			continue
+		}
+		if _, ok := src.definitions[fields[1]]; !ok {
+			src.definitions[fields[1]] = i + 1
+			src.names = append(src.names, fields[1])
+		}
+	}
+	return src
+}
+
+// locate attributes a message to the submitted line it quotes, or else to
+// the definition of a rule it names.
+func (src *source) locate(msg string) LintIssue {
+	issue := LintIssue{Message: msg}
+	best := 0
+	for i, line := range src.lines {
+		if len(line) > best && len(line) >= 5 && !strings.HasPrefix(line, "#") && strings.Contains(msg, line) {
+			issue.Line, best = i+1, len(line)
+		}
+	}
+	for _, token := range ruleTokenRegex.FindAllString(msg, -1) {
+		if line, ok := src.definitions[token]; ok {
+			issue.Rule = token
+			if issue.Line == 0 {
+				issue.Line = line
+			}
+			break
+		}
+	}
+	return issue
+}
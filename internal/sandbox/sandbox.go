@@ -0,0 +1,203 @@
+// Package sandbox runs the spamassassin command-line tool against submitted
+// rules in an isolated, throw-away configuration.
+//
+// Every run gets a private temporary directory holding a site configuration
+// made of the host's plugin loader files (*.pre) and the submitted rules as
+// local.cf, and an empty user preferences file. The live site configuration,
+// including its local.cf, never affects the result and submitted rules never
+// reach it. The directory is removed when the run ends.
+//
+// Security considerations:
+//   - The tool is executed directly, never through a shell, with a minimal
+//     environment and HOME pointing into the sandbox
+//   - Directives that load code or files, or name external programs, are
+//     rejected before anything is run
+//   - Runs are bounded by a timeout, and submitted rules and captured output
+//     are size-limited
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/rules"
+)
+
+const (
+	// MaxRulesSize is the largest rule set accepted.
+	MaxRulesSize = 256 * 1024
+
+	// maxOutput bounds the output captured from one run.
+	maxOutput = 1024 * 1024
+)
+
+// ErrUnavailable is returned when the spamassassin tool cannot be run.
+var ErrUnavailable = errors.New("spamassassin command-line tool is not available")
+
+// forbiddenDirectives load code or other files, or configure external
+// programs, and are never accepted in submitted rules.
+var forbiddenDirectives = map[string]bool{
+	"include": true, "loadplugin": true, "tryplugin": true,
+}
+
+// forbiddenSuffixes mark directives naming paths, programs or their options,
+// such as pyzor_path, dcc_home, razor_config and pyzor_options.
+var forbiddenSuffixes = []string{"_path", "_home", "_config", "_options"}
+
+// Sandbox runs the spamassassin tool in isolated configurations.
+type Sandbox struct {
+	binary  string
+	timeout time.Duration
+	catalog *rules.Catalog
+}
+
+// New creates a sandbox for the configured tool. The plugin loader files
+// are taken from the rule directories.
+func New(cfg config.SpamAssassinConfig) *Sandbox {
+	return &Sandbox{
+		binary:  cfg.Binary,
+		timeout: cfg.SandboxTimeout,
+		catalog: rules.NewCatalog(cfg.RulesDirs),
+	}
+}
+
+// Validate checks the size of submitted rules and rejects forbidden
+// directives, naming the offending line.
+func Validate(ruleText string) error {
+	if strings.TrimSpace(ruleText) == "" {
+		return fmt.Errorf("rules cannot be empty")
+	}
+	if len(ruleText) > MaxRulesSize {
+		return fmt.Errorf("rules exceed size limit of %d bytes", MaxRulesSize)
+	}
+	for i, line := range strings.Split(ruleText, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		directive := strings.ToLower(fields[0])
+		if forbiddenDirectives[directive] {
+			return fmt.Errorf("line %d: %s is not allowed in submitted rules", i+1, directive)
+		}
+		for _, suffix := range forbiddenSuffixes {
+			if strings.HasSuffix(directive, suffix) {
+				return fmt.Errorf("line %d: %s is not allowed in submitted rules", i+1, directive)
+			}
+		}
+	}
+	return nil
+}
+
+// run is one invocation of the tool in a fresh sandbox directory.
+type run struct {
+	dir     string
+	siteDir string
+}
+
+// prepare creates a sandbox directory with the plugin loader files and the
+// submitted rules.
+func (s *Sandbox) prepare(ruleText string) (*run, error) {
+	dir, err := os.MkdirTemp("", "sa-mcp-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	r := &run{dir: dir, siteDir: filepath.Join(dir, "site")}
+	if err := r.populate(s.catalog, ruleText); err != nil {
+		r.cleanup()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *run) populate(catalog *rules.Catalog, ruleText string) error {
+	if err := os.Mkdir(r.siteDir, 0o700); err != nil {
+		return fmt.Errorf("failed to create sandbox: %w", err)
+	}
+	files, err := catalog.Files()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if filepath.Ext(f.Name) != ".pre" {
+			continue
+		}
+		data, err := catalog.Read(f.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(r.siteDir, f.Name), data, 0o600); err != nil {
+			return fmt.Errorf("failed to write sandbox configuration: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(r.siteDir, "local.cf"), []byte(ruleText), 0o600); err != nil {
+		return fmt.Errorf("failed to write sandbox configuration: %w", err)
+	}
+	if err := os.WriteFile(r.prefs(), nil, 0o600); err != nil {
+		return fmt.Errorf("failed to write sandbox configuration: %w", err)
+	}
+	return nil
+}
+
+func (r *run) prefs() string {
+	return filepath.Join(r.dir, "user_prefs")
+}
+
+func (r *run) cleanup() {
+	os.RemoveAll(r.dir)
+}
+
+// exec runs the tool with the sandbox configuration and extra arguments,
+// returning its combined output. A non-zero exit status is not an error;
+// it is reported through exitCode.
+func (s *Sandbox) exec(ctx context.Context, r *run, stdin []byte, args ...string) (output string, exitCode int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	args = append([]string{
+		"--siteconfigpath=" + r.siteDir,
+		"--prefspath=" + r.prefs(),
+		"--nocreate-prefs",
+	}, args...)
+	cmd := exec.CommandContext(ctx, s.binary, args...)
+	cmd.Dir = r.dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + r.dir, "LANG=C"}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out := &cappedBuffer{max: maxOutput}
+	cmd.Stdout, cmd.Stderr = out, out
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", 0, fmt.Errorf("spamassassin did not finish within %s", s.timeout)
+	case errors.As(err, &exitErr):
+		return out.String(), exitErr.ExitCode(), nil
+	case err != nil:
+		return "", 0, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return out.String(), 0, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
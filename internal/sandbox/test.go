@@ -0,0 +1,76 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"spamassassin-mcp/internal/spamassassin"
+)
+
+// MaxTestEmails is the maximum number of sample messages tested per call.
+const MaxTestEmails = 20
+
+// Session scans messages with and without submitted rules. Both
+// configurations are built the same way, so score differences are due to
+// the submitted rules alone.
+type Session struct {
+	sandbox  *Sandbox
+	baseline *run
+	test     *run
+}
+
+// NewSession prepares the baseline and test configurations for ruleText,
+// which must have passed Validate. The session must be closed.
+func (s *Sandbox) NewSession(ruleText string) (*Session, error) {
+	baseline, err := s.prepare("")
+	if err != nil {
+		return nil, err
+	}
+	test, err := s.prepare(ruleText)
+	if err != nil {
+		baseline.cleanup()
+		return nil, err
+	}
+	return &Session{sandbox: s, baseline: baseline, test: test}, nil
+}
+
+// Compare scans a message without and with the submitted rules. Network
+// tests are disabled in both scans.
+func (ss *Session) Compare(ctx context.Context, email string) (baseline, result *spamassassin.ScanResult, err error) {
+	if baseline, err = ss.scan(ctx, ss.baseline, email); err != nil {
+		return nil, nil, err
+	}
+	if result, err = ss.scan(ctx, ss.test, email); err != nil {
+		return nil, nil, err
+	}
+	return baseline, result, nil
+}
+
+func (ss *Session) scan(ctx context.Context, r *run, email string) (*spamassassin.ScanResult, error) {
+	output, exitCode, err := ss.sandbox.exec(ctx, r, []byte(email), "--local", "--test-mode")
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("spamassassin exited with status %d: %s", exitCode, lastLine(output))
+	}
+	return spamassassin.ParseReport(output)
+}
+
+// Close removes the session's configurations.
+func (ss *Session) Close() {
+	ss.baseline.cleanup()
+	ss.test.cleanup()
+}
+
+// RuleNames returns the names of the rules defined or scored by ruleText,
+// in order of appearance.
+func RuleNames(ruleText string) []string {
+	return parseSource(ruleText).names
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
@@ -0,0 +1,31 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// versionRegex matches the version spamassassin --version prints, e.g.
+// "SpamAssassin version 4.0.1".
+var versionRegex = regexp.MustCompile(`SpamAssassin version (\S+)`)
+
+// Version returns the version of the spamassassin tool, which is installed
+// alongside spamd and shares its rules and plugins.
+func (s *Sandbox) Version(ctx context.Context) (string, error) {
+	r, err := s.prepare("")
+	if err != nil {
+		return "", err
+	}
+	defer r.cleanup()
+
+	output, exitCode, err := s.exec(ctx, r, nil, "--version")
+	if err != nil {
+		return "", err
+	}
+	m := versionRegex.FindStringSubmatch(output)
+	if exitCode != 0 || m == nil {
+		return "", fmt.Errorf("unexpected spamassassin --version output: %s", lastLine(output))
+	}
+	return m[1], nil
+}
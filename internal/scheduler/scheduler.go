@@ -0,0 +1,201 @@
+// Package scheduler runs maintenance jobs on cron schedules and keeps the
+// outcome of their last run.
+//
+// Each configured job runs one task, such as a rule update or pruning the
+// scan history, whenever its schedule fires. Schedules are evaluated in
+// UTC. A run that is still going when the schedule fires again makes the
+// job skip that time rather than overlap with itself.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/cron"
+	"spamassassin-mcp/internal/requestid"
+)
+
+// Task performs the work of a job and returns a one-line summary of what
+// it did.
+type Task func(ctx context.Context, job config.ScheduledJob) (string, error)
+
+// Outcomes of a run.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// JobStatus is the state of a job. Last* describe its most recent finished
+// run and are omitted until it has run once.
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Task         string     `json:"task"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastOutcome  string     `json:"last_outcome,omitempty"`
+	LastResult   string     `json:"last_result,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Runs         int        `json:"runs"`
+	Failures     int        `json:"failures"`
+}
+
+// Run is a finished run, as passed to the onRun callback of New. Its
+// RequestID is also carried in the context the task was given.
+type Run struct {
+	Job       config.ScheduledJob
+	RequestID string
+	Started   time.Time
+	Duration  time.Duration
+	Result    string
+	Err       error
+}
+
+type job struct {
+	cfg      config.ScheduledJob
+	schedule *cron.Schedule
+	task     Task
+	status   JobStatus
+}
+
+// Scheduler runs jobs on their schedules.
+type Scheduler struct {
+	mu    sync.Mutex
+	jobs  []*job
+	onRun func(Run)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a scheduler for the jobs of cfg. Each job runs the task that
+// tasks maps its Task name to. onRun, when not nil, is called after every
+// run. Jobs do not run until Start is called.
+func New(cfg config.SchedulerConfig, tasks map[string]Task, onRun func(Run)) (*Scheduler, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{onRun: onRun, ctx: ctx, cancel: cancel}
+	for _, jc := range cfg.Jobs {
+		schedule, err := cron.Parse(jc.Schedule)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("job %s: %w", jc.Name, err)
+		}
+		task, ok := tasks[jc.Task]
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("job %s: unknown task %q", jc.Name, jc.Task)
+		}
+		s.jobs = append(s.jobs, &job{
+			cfg:      jc,
+			schedule: schedule,
+			task:     task,
+			status:   JobStatus{Name: jc.Name, Task: jc.Task, Schedule: jc.Schedule},
+		})
+	}
+	return s, nil
+}
+
+// Start runs every job on its schedule until Close is called.
+func (s *Scheduler) Start() {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+	for {
+		next := j.schedule.Next(time.Now().UTC())
+		if next.IsZero() {
+			logrus.WithField("job", j.cfg.Name).Warn("Scheduled job never fires")
+			return
+		}
+		s.mu.Lock()
+		j.status.NextRun = &next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.run(j)
+	}
+}
+
+// run runs a job once and records its outcome.
+func (s *Scheduler) run(j *job) {
+	s.mu.Lock()
+	j.status.Running = true
+	s.mu.Unlock()
+
+	id := requestid.New()
+	ctx := requestid.With(s.ctx, id)
+	logrus.WithContext(ctx).WithFields(logrus.Fields{
+		"job":  j.cfg.Name,
+		"task": j.cfg.Task,
+	}).Info("Running scheduled job")
+
+	started := time.Now().UTC()
+	result, err := j.task(ctx, j.cfg)
+	duration := time.Since(started)
+
+	s.mu.Lock()
+	j.status.Running = false
+	j.status.LastRun = &started
+	j.status.LastDuration = duration.Round(time.Millisecond).String()
+	j.status.LastResult = result
+	j.status.LastError = ""
+	j.status.Runs++
+	if err != nil {
+		j.status.LastOutcome = OutcomeFailure
+		j.status.LastError = err.Error()
+		j.status.Failures++
+	} else {
+		j.status.LastOutcome = OutcomeSuccess
+	}
+	s.mu.Unlock()
+
+	fields := logrus.Fields{
+		"job":         j.cfg.Name,
+		"task":        j.cfg.Task,
+		"duration_ms": duration.Milliseconds(),
+	}
+	if err != nil {
+		logrus.WithContext(ctx).WithFields(fields).WithError(err).Error("Scheduled job failed")
+	} else {
+		logrus.WithContext(ctx).WithFields(fields).WithField("result", result).Info("Scheduled job completed")
+	}
+	if s.onRun != nil {
+		s.onRun(Run{Job: j.cfg, RequestID: id, Started: started, Duration: duration, Result: result, Err: err})
+	}
+}
+
+// Status returns the state of every job, in configuration order.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]JobStatus, len(s.jobs))
+	for i, j := range s.jobs {
+		statuses[i] = j.status
+	}
+	return statuses
+}
+
+// Close stops the schedules, cancelling the runs in progress, and waits for
+// them to return.
+func (s *Scheduler) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
@@ -0,0 +1,413 @@
+// Package siem exports scan verdicts to a SIEM collector as CEF (ArcSight
+// Common Event Format) or LEEF 2.0 (QRadar Log Event Extended Format)
+// events.
+//
+// Each event is the message of an RFC 5424 syslog record, sent over UDP or a
+// TCP or TLS stream with one record per line. Events are queued and sent by
+// a background goroutine, so a slow or unreachable collector never delays a
+// scan; events are dropped, with a warning, when the queue is full.
+//
+// Security considerations:
+//   - Values are escaped for the format, and line breaks are replaced, so a
+//     crafted subject or sender cannot forge attributes or further events
+//   - Message content is never exported; the subject is left out unless
+//     mapped explicitly
+package siem
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+const (
+	vendor  = "spamassassin-mcp"
+	product = "spamassassin-mcp"
+	version = "1.0.0"
+
+	// dialTimeout and writeTimeout bound each attempt to reach the collector.
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	// redialDelay is how long events are dropped after a failed connection
+	// attempt before the next one.
+	redialDelay = 5 * time.Second
+)
+
+// facilities maps syslog facility names to their codes (RFC 5424 §6.2.1).
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// defaultFields maps verdict fields to event keys for each format. CEF
+// custom fields (cs1, cfp1, ...) get a matching label attribute.
+var defaultFields = map[string]map[string]string{
+	"cef": {
+		"time":       "rt",
+		"verdict":    "act",
+		"score":      "cfp1",
+		"threshold":  "cfp2",
+		"rules":      "cs1",
+		"tags":       "cs2",
+		"profile":    "cs3",
+		"message_id": "cs4",
+		"user":       "duser",
+		"hash":       "fileHash",
+		"sender":     "suser",
+	},
+	"leef": {
+		"time":       "devTime",
+		"verdict":    "cat",
+		"severity":   "sev",
+		"score":      "score",
+		"threshold":  "threshold",
+		"rules":      "rules",
+		"tags":       "tags",
+		"profile":    "profile",
+		"message_id": "messageId",
+		"user":       "usrName",
+		"hash":       "fileHash",
+		"sender":     "sender",
+	},
+}
+
+// Verdict is the outcome of one scan.
+type Verdict struct {
+	Time      time.Time
+	Score     float64
+	Threshold float64
+	IsSpam    bool
+	Rules     []string
+	Tags      []string
+	Profile   string
+	User      string
+	Hash      string
+	Sender    string
+	MessageID string
+	Subject   string
+}
+
+// Severity rates the verdict on the 0-10 scale both formats use: 2 for ham,
+// 6 for spam and 9 for spam scoring at least twice the threshold.
+func (v Verdict) Severity() int {
+	switch {
+	case !v.IsSpam:
+		return 2
+	case v.Threshold > 0 && v.Score >= 2*v.Threshold:
+		return 9
+	default:
+		return 6
+	}
+}
+
+// values returns the verdict fields as event values.
+func (v Verdict) values() map[string]string {
+	verdict := "ham"
+	if v.IsSpam {
+		verdict = "spam"
+	}
+	return map[string]string{
+		"verdict":    verdict,
+		"severity":   strconv.Itoa(v.Severity()),
+		"score":      strconv.FormatFloat(v.Score, 'f', -1, 64),
+		"threshold":  strconv.FormatFloat(v.Threshold, 'f', -1, 64),
+		"rules":      strings.Join(v.Rules, ","),
+		"tags":       strings.Join(v.Tags, ","),
+		"profile":    v.Profile,
+		"user":       v.User,
+		"hash":       v.Hash,
+		"sender":     v.Sender,
+		"message_id": v.MessageID,
+		"subject":    v.Subject,
+	}
+}
+
+// Exporter sends verdicts to a SIEM collector.
+type Exporter struct {
+	format   string
+	network  string
+	address  string
+	tls      *tls.Config
+	facility int
+	hostname string
+	appName  string
+	pid      int
+	fields   map[string]string
+
+	queue   chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// closed is set, under mu, when the queue is closed
+	mu     sync.RWMutex
+	closed bool
+
+	// used by the sending goroutine only
+	conn    net.Conn
+	retryAt time.Time
+}
+
+// New starts an exporter for cfg, or returns nil when cfg.Address is empty.
+// The collector is connected to in the background, so an unreachable
+// collector does not prevent startup.
+func New(cfg config.SIEMConfig) (*Exporter, error) {
+	if cfg.Address == "" {
+		return nil, nil
+	}
+	facility, ok := facilities[cfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility %q", cfg.Facility)
+	}
+	defaults, ok := defaultFields[cfg.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown SIEM format %q", cfg.Format)
+	}
+	fields := make(map[string]string, len(defaults)+len(cfg.Fields))
+	for field, key := range defaults {
+		fields[field] = key
+	}
+	for field, key := range cfg.Fields {
+		if key == "" {
+			delete(fields, field)
+		} else {
+			fields[field] = key
+		}
+	}
+
+	e := &Exporter{
+		format:   cfg.Format,
+		network:  cfg.Network,
+		address:  cfg.Address,
+		facility: facility,
+		appName:  cfg.AppName,
+		pid:      os.Getpid(),
+		fields:   fields,
+		queue:    make(chan []byte, cfg.QueueSize),
+		done:     make(chan struct{}),
+	}
+	if e.appName == "" {
+		e.appName = "-"
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		e.hostname = hostname
+	} else {
+		e.hostname = "-"
+	}
+	if cfg.Network == "tls" {
+		e.network = "tcp"
+		e.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SIEM CA file: %w", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("SIEM CA file %s holds no certificates", cfg.CAFile)
+			}
+			e.tls.RootCAs = roots
+		}
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// Export queues v for sending. It never blocks; when the queue is full the
+// event is dropped. Export on a nil or closed Exporter does nothing.
+func (e *Exporter) Export(v Verdict) {
+	if e == nil {
+		return
+	}
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- e.message(v):
+	default:
+		// Warn on the first drop and then every 1000th, not on every event
+		if n := e.dropped.Add(1); n%1000 == 1 {
+			logrus.WithField("dropped", n).Warn("SIEM export queue full, dropping verdict events")
+		}
+	}
+}
+
+// Close sends the queued events, waiting at most timeout, and closes the
+// connection.
+func (e *Exporter) Close(timeout time.Duration) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+	case <-time.After(timeout):
+		logrus.WithField("queued", len(e.queue)).Warn("SIEM export did not finish before shutdown")
+	}
+}
+
+// run sends queued messages until the queue is closed. A failed send is
+// retried once on a fresh connection, so a restarted collector is picked up
+// again; after a failed connection attempt, events are dropped for
+// redialDelay rather than dialing for each one.
+func (e *Exporter) run() {
+	defer close(e.done)
+	for msg := range e.queue {
+		if err := e.send(msg); err != nil {
+			logrus.WithError(err).WithField("address", e.address).Error("Failed to export verdict to SIEM")
+		}
+	}
+	if e.conn != nil {
+		e.conn.Close()
+	}
+}
+
+func (e *Exporter) send(msg []byte) error {
+	if e.conn != nil {
+		if err := e.write(msg); err == nil {
+			return nil
+		}
+		e.conn.Close()
+		e.conn = nil
+	}
+	if time.Now().Before(e.retryAt) {
+		return fmt.Errorf("collector unreachable, retrying after %s", e.retryAt.Format(time.RFC3339))
+	}
+	if err := e.dial(); err != nil {
+		e.retryAt = time.Now().Add(redialDelay)
+		return err
+	}
+	return e.write(msg)
+}
+
+func (e *Exporter) write(msg []byte) error {
+	e.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := e.conn.Write(msg)
+	return err
+}
+
+func (e *Exporter) dial() error {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if e.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, e.network, e.address, e.tls)
+	} else {
+		conn, err = dialer.Dial(e.network, e.address)
+	}
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	return nil
+}
+
+// message formats v as an RFC 5424 message carrying the event:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID verdict - EVENT
+//
+// Stream transports end it with a newline.
+func (e *Exporter) message(v Verdict) []byte {
+	// Syslog severity: notice for ham, warning for spam
+	severity := 5
+	if v.IsSpam {
+		severity = 4
+	}
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d verdict - %s", e.facility*8+severity,
+		v.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"), e.hostname, e.appName, e.pid, e.Event(v))
+	if e.network != "udp" {
+		msg += "\n"
+	}
+	return []byte(msg)
+}
+
+// Event formats v as a CEF or LEEF event.
+func (e *Exporter) Event(v Verdict) string {
+	values := v.values()
+	if e.format == "leef" {
+		values["time"] = v.Time.UTC().Format("Jan 02 2006 15:04:05.000 MST")
+	} else {
+		values["time"] = strconv.FormatInt(v.Time.UnixMilli(), 10)
+	}
+
+	var attrs []string
+	for _, field := range config.SIEMFields {
+		key, ok := e.fields[field]
+		if !ok || values[field] == "" {
+			continue
+		}
+		if e.format == "leef" {
+			attrs = append(attrs, key+"="+leefValue(values[field]))
+			continue
+		}
+		attrs = append(attrs, key+"="+cefValue(values[field]))
+		if isCEFCustomField(key) {
+			attrs = append(attrs, key+"Label="+cefValue(field))
+		}
+	}
+
+	id := values["verdict"]
+	if e.format == "leef" {
+		// LEEF 2.0 with a tab delimiter, named in the header as x09
+		return fmt.Sprintf("LEEF:2.0|%s|%s|%s|%s|x09|%s", leefHeader(vendor), leefHeader(product), leefHeader(version), leefHeader(id), strings.Join(attrs, "\t"))
+	}
+	name := "Ham verdict"
+	if v.IsSpam {
+		name = "Spam verdict"
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s", cefHeader(vendor), cefHeader(product), cefHeader(version), cefHeader(id), cefHeader(name), v.Severity(), strings.Join(attrs, " "))
+}
+
+// isCEFCustomField reports whether key is a CEF custom field, such as cs1 or
+// cfp2, that is described by a label attribute.
+func isCEFCustomField(key string) bool {
+	for _, prefix := range []string{"cs", "cn", "cfp", "c6a", "flexString", "flexNumber", "deviceCustomDate"} {
+		if n, ok := strings.CutPrefix(key, prefix); ok && n != "" && strings.Trim(n, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cefHeader escapes a CEF header field: backslash and pipe.
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+// cefValue escapes a CEF extension value: backslash, equals sign and line
+// breaks.
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// leefHeader removes the header delimiter and line breaks from a LEEF header
+// field, which has no escaping.
+func leefHeader(s string) string {
+	return strings.NewReplacer("|", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// leefValue replaces the attribute delimiter and line breaks in a LEEF value,
+// which has no escaping.
+func leefValue(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
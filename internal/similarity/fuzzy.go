@@ -0,0 +1,213 @@
+package similarity
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"spamassassin-mcp/internal/model"
+)
+
+// Parameters of the context-triggered piecewise hash, those of ssdeep.
+const (
+	rollingWindow = 7
+	minBlockSize  = 3
+	hashLength    = 64
+	hashPrime     = 0x01000193
+	hashInit      = 0x28021967
+	base64Chars   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+// FuzzyHash returns an ssdeep-style context-triggered piecewise hash of the
+// visible body text of email, in the form blocksize:hash:hash. Unlike the
+// SHA-256 of the raw message, it changes only locally when a campaign varies
+// a name, an amount or a link, so FuzzyScore still finds the variants
+// related. The text is normalized as for the content shingles, so numbers,
+// URLs, case, markup and line wrapping do not count as differences. It
+// returns "" for a message without body text.
+func FuzzyHash(email *model.ParsedEmail) string {
+	text := email.TextBody()
+	if doc := email.HTMLBody(); doc != "" {
+		text += "\n" + scanHTML(doc).text
+	}
+	words := normalizedWords(text)
+	if len(words) == 0 {
+		return ""
+	}
+	return ctph([]byte(strings.Join(words, " ")))
+}
+
+// rollingHash is the hash of the last rollingWindow bytes that decides
+// where the pieces of the input end.
+type rollingHash struct {
+	window     [rollingWindow]uint32
+	h1, h2, h3 uint32
+	n          int
+}
+
+func (r *rollingHash) roll(c byte) uint32 {
+	r.h2 -= r.h1
+	r.h2 += rollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= r.window[r.n%rollingWindow]
+	r.window[r.n%rollingWindow] = uint32(c)
+	r.n++
+	r.h3 = r.h3<<5 ^ uint32(c)
+	return r.h1 + r.h2 + r.h3
+}
+
+// ctph hashes data with the smallest block size that yields at least half
+// a hash of pieces.
+func ctph(data []byte) string {
+	blockSize := uint32(minBlockSize)
+	for blockSize*hashLength < uint32(len(data)) {
+		blockSize *= 2
+	}
+	for {
+		var (
+			roll       rollingHash
+			h1, h2     uint32 = hashInit, hashInit
+			sig1, sig2 []byte
+		)
+		for _, c := range data {
+			h1 = h1*hashPrime ^ uint32(c)
+			h2 = h2*hashPrime ^ uint32(c)
+			rh := roll.roll(c)
+			if rh%blockSize == blockSize-1 {
+				if len(sig1) < hashLength-1 {
+					sig1 = append(sig1, base64Chars[h1%64])
+					h1 = hashInit
+				}
+				if rh%(blockSize*2) == blockSize*2-1 && len(sig2) < hashLength/2-1 {
+					sig2 = append(sig2, base64Chars[h2%64])
+					h2 = hashInit
+				}
+			}
+		}
+		if h1 != hashInit {
+			sig1 = append(sig1, base64Chars[h1%64])
+		}
+		if h2 != hashInit {
+			sig2 = append(sig2, base64Chars[h2%64])
+		}
+		if blockSize > minBlockSize && len(sig1) < hashLength/2 {
+			blockSize /= 2
+			continue
+		}
+		return fmt.Sprintf("%d:%s:%s", blockSize, sig1, sig2)
+	}
+}
+
+// FuzzyScore compares two hashes returned by FuzzyHash and returns their
+// similarity from 0 (unrelated) to 100 (identical text). Hashes whose block
+// sizes are not equal or a factor of two apart cannot be compared and score
+// 0, as do malformed hashes.
+func FuzzyScore(a, b string) int {
+	bsA, a1, a2, ok := parseFuzzy(a)
+	if !ok {
+		return 0
+	}
+	bsB, b1, b2, ok := parseFuzzy(b)
+	if !ok {
+		return 0
+	}
+	if bsA == bsB && a1 == b1 && a2 == b2 {
+		return 100
+	}
+	switch {
+	case bsA == bsB:
+		return max(scoreSignatures(a1, b1, bsA), scoreSignatures(a2, b2, bsA*2))
+	case bsA == bsB*2:
+		return scoreSignatures(a1, b2, bsA)
+	case bsB == bsA*2:
+		return scoreSignatures(a2, b1, bsB)
+	}
+	return 0
+}
+
+// parseFuzzy splits a hash into its block size and signatures, with runs
+// of more than three identical characters shortened, since they carry
+// little information.
+func parseFuzzy(hash string) (int, string, string, bool) {
+	parts := strings.Split(hash, ":")
+	if len(parts) != 3 {
+		return 0, "", "", false
+	}
+	bs, err := strconv.Atoi(parts[0])
+	if err != nil || bs < minBlockSize || len(parts[1]) > hashLength || len(parts[2]) > hashLength {
+		return 0, "", "", false
+	}
+	return bs, collapseRuns(parts[1]), collapseRuns(parts[2]), true
+}
+
+func collapseRuns(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// scoreSignatures scores two signatures of the same block size by their
+// edit distance. Signatures without a common run of rollingWindow
+// characters score 0, which keeps chance similarities of short signatures
+// out; the score of small block sizes is capped by the signature length
+// for the same reason.
+func scoreSignatures(s1, s2 string, blockSize int) int {
+	if !commonSubstring(s1, s2) {
+		return 0
+	}
+	score := editDistance(s1, s2) * hashLength / (len(s1) + len(s2))
+	score = 100 * score / hashLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+	if blockSize >= (99+rollingWindow)/rollingWindow*minBlockSize {
+		return score
+	}
+	return min(score, blockSize/minBlockSize*min(len(s1), len(s2)))
+}
+
+// commonSubstring reports whether s1 and s2 share a substring of
+// rollingWindow characters.
+func commonSubstring(s1, s2 string) bool {
+	if len(s1) < rollingWindow || len(s2) < rollingWindow {
+		return false
+	}
+	seen := make(map[string]bool, len(s1))
+	for i := 0; i+rollingWindow <= len(s1); i++ {
+		seen[s1[i:i+rollingWindow]] = true
+	}
+	for i := 0; i+rollingWindow <= len(s2); i++ {
+		if seen[s2[i:i+rollingWindow]] {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance with substitutions costing two,
+// as an insertion and a deletion.
+func editDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	cur := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(s2); j++ {
+			cost := 2
+			if s1[i-1] == s2[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
@@ -0,0 +1,73 @@
+package similarity
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxTags bounds the HTML tags recorded per message.
+const maxTags = 5000
+
+// htmlFeatures are the parts of an HTML document compared between messages.
+type htmlFeatures struct {
+	text    string
+	tags    []string
+	markers []string
+}
+
+// scanHTML returns the visible text, the start tag sequence and the template
+// markers (class and id names, comments) of an HTML document.
+func scanHTML(doc string) htmlFeatures {
+	var f htmlFeatures
+	var text strings.Builder
+	skip := ""
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			f.text = text.String()
+			return f
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if len(f.tags) < maxTags {
+				f.tags = append(f.tags, tok.Data)
+			}
+			if tok.Type == html.StartTagToken && (tok.Data == "script" || tok.Data == "style") {
+				skip = tok.Data
+			}
+			for _, a := range tok.Attr {
+				switch a.Key {
+				case "class":
+					for _, c := range strings.Fields(a.Val) {
+						f.markers = append(f.markers, "class:"+c)
+					}
+				case "id":
+					if a.Val != "" {
+						f.markers = append(f.markers, "id:"+a.Val)
+					}
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skip {
+				skip = ""
+			}
+
+		case html.CommentToken:
+			if c := strings.Join(strings.Fields(string(z.Text())), " "); c != "" {
+				if len(c) > 80 {
+					c = c[:80]
+				}
+				f.markers = append(f.markers, "comment:"+c)
+			}
+
+		case html.TextToken:
+			if skip == "" {
+				text.Write(z.Text())
+				text.WriteString(" ")
+			}
+		}
+	}
+}
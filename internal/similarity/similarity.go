@@ -0,0 +1,370 @@
+// Package similarity compares messages to tell whether they belong to the
+// same campaign.
+//
+// Campaigns send many variants of one message: the recipient name, amounts
+// and tracking tokens change, but the wording, the MIME and HTML skeleton,
+// the link infrastructure and the template leftovers stay the same. Compare
+// measures each of these between every pair of messages:
+//
+//   - content: word shingles of the visible text, with numbers and URLs
+//     masked, compared by Jaccard similarity; a 64-bit SimHash of the same
+//     shingles is reported as a fuzzy hash for clustering beyond one call
+//   - structure: header field names, the MIME tree and the HTML tag sequence
+//   - indicators: shared URLs, link domains and template markers such as
+//     unfilled merge tags, HTML class names and comments, and X-Mailer
+//
+// The measures are combined into a similarity and a verdict per pair, and
+// messages linked by same-campaign verdicts are grouped into clusters.
+//
+// FuzzyHash computes an ssdeep-style piecewise hash of the body text for
+// recording with each scan, so FuzzyScore can later match a sample against
+// past messages without keeping their content.
+package similarity
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strings"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/urls"
+)
+
+// MaxMessages is the maximum number of messages compared in one call.
+const MaxMessages = 10
+
+// Verdicts.
+const (
+	SameCampaign = "same_campaign"
+	Related      = "related"
+	Unrelated    = "unrelated"
+)
+
+const (
+	// maxTokens bounds the words shingled per message.
+	maxTokens = 20000
+
+	// maxMarkers bounds the template markers collected per message.
+	maxMarkers = 500
+
+	// maxShared bounds the shared items listed per pair.
+	maxShared = 50
+)
+
+// weights of the measures in the combined similarity. A measure with nothing
+// to compare on either side, such as indicators of two messages without
+// links, is left out and the others are scaled up.
+const (
+	contentWeight   = 0.5
+	structureWeight = 0.25
+	indicatorWeight = 0.25
+)
+
+var (
+	wordRegex = regexp.MustCompile(`[\pL\pN]+(?:['’][\pL]+)?`)
+	urlRegex  = regexp.MustCompile(`(?i)\b(?:https?|ftp)://\S+|\bwww\.\S+`)
+
+	// mergeTagRegex matches unfilled personalization placeholders of common
+	// mailing tools: {{name}}, %FIRSTNAME%, [[email]] and *|FNAME|*.
+	mergeTagRegex = regexp.MustCompile(`\{\{\s*[\w.]+\s*\}\}|%[A-Z][A-Z_]+%|\[\[\s*[\w.]+\s*\]\]|\*\|[A-Z_]+\|\*`)
+)
+
+// Sample is the fingerprint of one message.
+type Sample struct {
+	Index     int    `json:"index"`
+	Subject   string `json:"subject,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+
+	// SimHash is the 64-bit SimHash of the content shingles in hex. Similar
+	// texts have hashes a small Hamming distance apart.
+	SimHash string `json:"simhash"`
+
+	URLs    int `json:"urls"`
+	Markers int `json:"markers"`
+
+	shingles  map[string]bool
+	simhash   uint64
+	structure map[string]bool
+	urls      map[string]bool
+	domains   map[string]bool
+	markers   map[string]bool
+}
+
+// Pair is the comparison of two messages, identified by their indexes.
+type Pair struct {
+	A int `json:"a"`
+	B int `json:"b"`
+
+	Content    float64  `json:"content_similarity"`
+	Structure  float64  `json:"structure_similarity"`
+	Indicators *float64 `json:"indicator_similarity,omitempty"`
+
+	// SimHashDistance is the Hamming distance between the SimHashes, 0-64.
+	SimHashDistance int `json:"simhash_distance"`
+
+	Similarity float64 `json:"similarity"`
+	Verdict    string  `json:"verdict"`
+
+	SharedURLs    []string `json:"shared_urls"`
+	SharedDomains []string `json:"shared_domains"`
+	SharedMarkers []string `json:"shared_markers"`
+}
+
+// Result is the comparison of a set of messages.
+type Result struct {
+	Samples []*Sample `json:"samples"`
+	Pairs   []*Pair   `json:"pairs"`
+
+	// Clusters groups the indexes of messages connected by same-campaign
+	// verdicts; messages on their own are not listed.
+	Clusters [][]int `json:"clusters"`
+}
+
+// Compare fingerprints the messages and compares every pair.
+func Compare(emails []*model.ParsedEmail) *Result {
+	r := &Result{Samples: make([]*Sample, 0, len(emails)), Pairs: make([]*Pair, 0), Clusters: make([][]int, 0)}
+	for i, email := range emails {
+		r.Samples = append(r.Samples, fingerprint(i, email))
+	}
+
+	parent := make([]int, len(emails))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(r.Samples); i++ {
+		for j := i + 1; j < len(r.Samples); j++ {
+			p := compare(r.Samples[i], r.Samples[j])
+			r.Pairs = append(r.Pairs, p)
+			if p.Verdict == SameCampaign {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range emails {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+	for i := range emails {
+		if g := groups[i]; len(g) > 1 {
+			r.Clusters = append(r.Clusters, g)
+		}
+	}
+	return r
+}
+
+func fingerprint(index int, email *model.ParsedEmail) *Sample {
+	s := &Sample{
+		Index:     index,
+		Subject:   email.Subject,
+		MessageID: email.MessageID,
+		structure: make(map[string]bool),
+		urls:      make(map[string]bool),
+		domains:   make(map[string]bool),
+		markers:   make(map[string]bool),
+	}
+	addMarker := func(m string) {
+		if len(s.markers) < maxMarkers {
+			s.markers[m] = true
+		}
+	}
+
+	for _, h := range email.Headers {
+		s.structure["header:"+strings.ToLower(h.Name)] = true
+	}
+	for _, p := range email.Parts {
+		s.structure["part:"+p.Path+":"+p.ContentType] = true
+	}
+	if mailer := email.Header("X-Mailer"); mailer != "" {
+		addMarker("x-mailer:" + mailer)
+	}
+
+	text := email.Subject + "\n" + email.TextBody()
+	if doc := email.HTMLBody(); doc != "" {
+		h := scanHTML(doc)
+		text += "\n" + h.text
+		for i, tag := range h.tags {
+			s.structure["tag:"+tag] = true
+			if i > 0 {
+				s.structure["tags:"+h.tags[i-1]+">"+tag] = true
+			}
+		}
+		for _, m := range h.markers {
+			addMarker(m)
+		}
+	}
+	for _, m := range mergeTagRegex.FindAllString(text, -1) {
+		addMarker("merge_tag:" + m)
+	}
+
+	for _, u := range urls.Extract(email) {
+		s.urls[u.URL] = true
+		if u.Domain != "" {
+			s.domains[u.Domain] = true
+		} else {
+			s.domains[u.Host] = true
+		}
+		if i := strings.IndexByte(u.URL, '?'); i >= 0 {
+			for _, kv := range strings.Split(u.URL[i+1:], "&") {
+				name, _, _ := strings.Cut(kv, "=")
+				if name != "" && !strings.HasPrefix(name, "utm_") {
+					addMarker("url_parameter:" + name)
+				}
+			}
+		}
+	}
+
+	s.shingles = shingles(text)
+	s.simhash = simhash(s.shingles)
+	s.SimHash = fmt.Sprintf("%016x", s.simhash)
+	s.URLs = len(s.urls)
+	s.Markers = len(s.markers)
+	return s
+}
+
+// normalizedWords returns the lowercased words of text, with numbers and
+// URLs masked so per-recipient values do not count as differences.
+func normalizedWords(text string) []string {
+	text = urlRegex.ReplaceAllString(strings.ToLower(text), " _url_ ")
+	words := wordRegex.FindAllString(text, maxTokens)
+	for i, w := range words {
+		if strings.ContainsAny(w, "0123456789") {
+			words[i] = "_num_"
+		}
+	}
+	return words
+}
+
+// shingles returns the three-word shingles of the normalized words of
+// text. Texts of fewer than three words yield their words.
+func shingles(text string) map[string]bool {
+	words := normalizedWords(text)
+	set := make(map[string]bool)
+	if len(words) < 3 {
+		for _, w := range words {
+			set[w] = true
+		}
+		return set
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		set[strings.Join(words[i:i+3], " ")] = true
+	}
+	return set
+}
+
+// simhash returns the 64-bit SimHash of a shingle set.
+func simhash(set map[string]bool) uint64 {
+	var v [64]int
+	for s := range set {
+		h := fnv.New64a()
+		h.Write([]byte(s))
+		x := h.Sum64()
+		for i := range v {
+			if x&(1<<i) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+	var hash uint64
+	for i, c := range v {
+		if c > 0 {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+func compare(a, b *Sample) *Pair {
+	p := &Pair{
+		A:               a.Index,
+		B:               b.Index,
+		SimHashDistance: bits.OnesCount64(a.simhash ^ b.simhash),
+		SharedURLs:      shared(a.urls, b.urls),
+		SharedDomains:   shared(a.domains, b.domains),
+		SharedMarkers:   shared(a.markers, b.markers),
+	}
+	p.Content, _ = jaccard(a.shingles, b.shingles)
+	p.Structure, _ = jaccard(a.structure, b.structure)
+
+	total, weight := contentWeight*p.Content+structureWeight*p.Structure, contentWeight+structureWeight
+	if v, ok := jaccard(indicators(a), indicators(b)); ok {
+		v = round(v)
+		p.Indicators = &v
+		total += indicatorWeight * v
+		weight += indicatorWeight
+	}
+	p.Content, p.Structure = round(p.Content), round(p.Structure)
+	p.Similarity = round(total / weight)
+
+	switch {
+	case p.Similarity >= 0.75:
+		p.Verdict = SameCampaign
+	case p.Similarity >= 0.45:
+		p.Verdict = Related
+	default:
+		p.Verdict = Unrelated
+	}
+	return p
+}
+
+// jaccard returns the Jaccard similarity of two sets, and false when both
+// are empty.
+func jaccard(a, b map[string]bool) (float64, bool) {
+	if len(a) == 0 && len(b) == 0 {
+		return 0, false
+	}
+	common := 0
+	for k := range a {
+		if b[k] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common), true
+}
+
+// indicators returns the link domains and template markers of a sample as
+// one set.
+func indicators(s *Sample) map[string]bool {
+	set := make(map[string]bool, len(s.domains)+len(s.markers))
+	for k := range s.domains {
+		set["domain:"+k] = true
+	}
+	for k := range s.markers {
+		set[k] = true
+	}
+	return set
+}
+
+// shared returns the sorted items in both sets, up to maxShared.
+func shared(a, b map[string]bool) []string {
+	list := make([]string, 0)
+	for k := range a {
+		if b[k] {
+			list = append(list, k)
+		}
+	}
+	sort.Strings(list)
+	if len(list) > maxShared {
+		list = list[:maxShared]
+	}
+	return list
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,89 @@
+package spamassassin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Autolearn decisions SpamAssassin reports in the autolearn field of
+// X-Spam-Status.
+const (
+	AutolearnHam         = "ham"
+	AutolearnSpam        = "spam"
+	AutolearnNo          = "no"
+	AutolearnDisabled    = "disabled"
+	AutolearnFailed      = "failed"
+	AutolearnUnavailable = "unavailable"
+)
+
+// Default Bayes auto-learning score bands, used when the rule files do not
+// set bayes_auto_learn_threshold_nonspam or bayes_auto_learn_threshold_spam.
+const (
+	DefaultAutolearnHamThreshold  = 0.1
+	DefaultAutolearnSpamThreshold = 12.0
+)
+
+// Autolearn is the Bayes auto-learning decision spamd made while scanning.
+// Learned is set when the message was trained into the Bayes database as
+// Decision, and Forced when a rule with the autolearn_force tflag made it
+// spam regardless of the header and body points SpamAssassin otherwise
+// requires. The thresholds and Reason are filled in by Explain.
+type Autolearn struct {
+	Decision      string  `json:"decision"`
+	Learned       bool    `json:"learned"`
+	Forced        bool    `json:"forced"`
+	HamThreshold  float64 `json:"ham_threshold"`
+	SpamThreshold float64 `json:"spam_threshold"`
+	Reason        string  `json:"reason,omitempty"`
+}
+
+// ParseAutolearn returns the autolearn decision of an X-Spam-Status header,
+// or nil when it has none.
+func ParseAutolearn(status *SpamStatus) *Autolearn {
+	if status == nil || status.Autolearn == "" {
+		return nil
+	}
+	decision := strings.ToLower(status.Autolearn)
+	return &Autolearn{
+		Decision: decision,
+		Learned:  decision == AutolearnHam || decision == AutolearnSpam,
+		Forced:   strings.EqualFold(status.Fields["autolearn_force"], "yes"),
+	}
+}
+
+// Explain records the auto-learning score bands and explains the decision
+// for a message that scored score. SpamAssassin decides on a learning score
+// that leaves out Bayes, network and noautolearn rules, so a score inside a
+// band does not guarantee learning; the reason says so when the two
+// disagree.
+func (a *Autolearn) Explain(score, hamThreshold, spamThreshold float64) {
+	a.HamThreshold = hamThreshold
+	a.SpamThreshold = spamThreshold
+	switch a.Decision {
+	case AutolearnHam:
+		a.Reason = fmt.Sprintf("learned as ham: the learning score is below bayes_auto_learn_threshold_nonspam %.1f", hamThreshold)
+	case AutolearnSpam:
+		if a.Forced {
+			a.Reason = "learned as spam: forced by a rule with the autolearn_force tflag"
+		} else {
+			a.Reason = fmt.Sprintf("learned as spam: the learning score is at least bayes_auto_learn_threshold_spam %.1f, with at least 3 header and 3 body points", spamThreshold)
+		}
+	case AutolearnNo:
+		switch {
+		case score < hamThreshold:
+			a.Reason = fmt.Sprintf("not learned: the score %.1f is below %.1f, but the learning score, without Bayes, network and noautolearn rules, is not", score, hamThreshold)
+		case score >= spamThreshold:
+			a.Reason = fmt.Sprintf("not learned: the score %.1f is at least %.1f, but the learning score, without Bayes, network and noautolearn rules, is lower or lacks 3 header and 3 body points", score, spamThreshold)
+		default:
+			a.Reason = fmt.Sprintf("not learned: the score %.1f is between the ham threshold %.1f and the spam threshold %.1f", score, hamThreshold, spamThreshold)
+		}
+	case AutolearnDisabled:
+		a.Reason = "not learned: auto-learning is disabled with bayes_auto_learn 0 or use_bayes 0"
+	case AutolearnFailed:
+		a.Reason = "not learned: training failed, for example because the Bayes database was locked"
+	case AutolearnUnavailable:
+		a.Reason = "not learned: the Bayes database is unavailable"
+	default:
+		a.Reason = fmt.Sprintf("unrecognized autolearn decision %q", a.Decision)
+	}
+}
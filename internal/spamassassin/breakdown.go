@@ -0,0 +1,136 @@
+package spamassassin
+
+import (
+	"math"
+	"strings"
+)
+
+// Kinds of network test.
+const (
+	NetworkDNSBL          = "dnsbl"
+	NetworkURIBL          = "uribl"
+	NetworkChecksum       = "checksum"
+	NetworkAuthentication = "authentication"
+)
+
+// networkPrefixes maps the name prefixes of the stock rule families that
+// query the network (tflags net) to their kind.
+var networkPrefixes = []struct {
+	prefix, kind string
+}{
+	{"RCVD_IN_", NetworkDNSBL},
+	{"URIBL_", NetworkURIBL},
+	{"SURBL_", NetworkURIBL},
+	{"RAZOR2_", NetworkChecksum},
+	{"PYZOR_", NetworkChecksum},
+	{"DCC_", NetworkChecksum},
+	{"SPF_", NetworkAuthentication},
+	{"DKIM_", NetworkAuthentication},
+	{"DMARC_", NetworkAuthentication},
+}
+
+// bayesRanges are the spam probability bands of the BAYES_nn rules.
+var bayesRanges = map[string]string{
+	"BAYES_00":  "0-1%",
+	"BAYES_05":  "1-5%",
+	"BAYES_20":  "5-20%",
+	"BAYES_40":  "20-40%",
+	"BAYES_50":  "40-60%",
+	"BAYES_60":  "60-80%",
+	"BAYES_80":  "80-95%",
+	"BAYES_95":  "95-99%",
+	"BAYES_99":  "99-100%",
+	"BAYES_999": "99.9-100%",
+}
+
+// NetworkTest is a rule hit that depends on a network query.
+type NetworkTest struct {
+	Name        string  `json:"name"`
+	Kind        string  `json:"kind"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description"`
+}
+
+// BayesResult is the contribution of the Bayesian classifier.
+type BayesResult struct {
+	Rules []RuleMatch `json:"rules"`
+	Score float64     `json:"score"`
+
+	// Probability is the spam probability band of the most specific BAYES
+	// rule hit, e.g. "99-100%".
+	Probability string `json:"probability,omitempty"`
+}
+
+// ScoreSplit divides a score between local rules, the Bayesian classifier
+// and network tests.
+type ScoreSplit struct {
+	Local   float64 `json:"local"`
+	Bayes   float64 `json:"bayes"`
+	Network float64 `json:"network"`
+}
+
+// Breakdown groups rule hits into Bayes, network and local contributions.
+type Breakdown struct {
+	Bayes        *BayesResult  `json:"bayes,omitempty"`
+	NetworkTests []NetworkTest `json:"network_tests"`
+	Split        ScoreSplit    `json:"score_split"`
+}
+
+// NetworkKind returns the kind of network test a rule is, or "" for rules
+// evaluated locally.
+func NetworkKind(rule string) string {
+	for _, p := range networkPrefixes {
+		if strings.HasPrefix(rule, p.prefix) {
+			return p.kind
+		}
+	}
+	return ""
+}
+
+// IsBayesRule reports whether rule reports the Bayesian classifier result.
+func IsBayesRule(rule string) bool {
+	return strings.HasPrefix(rule, "BAYES_")
+}
+
+// Break groups the rule hits of a scan into Bayes, network and local
+// contributions. Bayes is nil when no BAYES rule hit, because the classifier
+// is disabled or not trained enough to decide.
+func Break(rules []RuleMatch) *Breakdown {
+	b := &Breakdown{NetworkTests: make([]NetworkTest, 0)}
+	bayesBand := ""
+	for _, r := range rules {
+		switch {
+		case IsBayesRule(r.Name):
+			if b.Bayes == nil {
+				b.Bayes = &BayesResult{}
+			}
+			b.Bayes.Rules = append(b.Bayes.Rules, r)
+			b.Bayes.Score += r.Score
+			// BAYES_999 hits together with BAYES_99 and narrows it.
+			if p, ok := bayesRanges[r.Name]; ok && len(r.Name) > len(bayesBand) {
+				bayesBand = r.Name
+				b.Bayes.Probability = p
+			}
+			b.Split.Bayes += r.Score
+		case NetworkKind(r.Name) != "":
+			b.NetworkTests = append(b.NetworkTests, NetworkTest{
+				Name:        r.Name,
+				Kind:        NetworkKind(r.Name),
+				Score:       r.Score,
+				Description: r.Description,
+			})
+			b.Split.Network += r.Score
+		default:
+			b.Split.Local += r.Score
+		}
+	}
+	if b.Bayes != nil {
+		b.Bayes.Score = round(b.Bayes.Score)
+	}
+	b.Split.Local, b.Split.Bayes, b.Split.Network = round(b.Split.Local), round(b.Split.Bayes), round(b.Split.Network)
+	return b
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,177 @@
+package spamassassin
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Capabilities describes the spamd the client talks to. Protocol is the
+// SPAMD protocol version spamd answers PING with and Version the
+// SpamAssassin version it stamps into X-Spam-Checker-Version, empty when it
+// could not be read. The feature flags follow from the protocol version:
+// TELL needs 1.3, HEADERS 1.4 and zlib-compressed requests 1.5.
+type Capabilities struct {
+	Version  string `json:"version,omitempty"`
+	Protocol string `json:"protocol"`
+	Tell     bool   `json:"tell"`
+	Headers  bool   `json:"headers"`
+	Compress bool   `json:"compress"`
+}
+
+// protocolVersion is the SPAMC protocol version sent with uncompressed
+// requests; TELL requests need tellProtocolVersion and compressed requests
+// compressProtocolVersion.
+const (
+	protocolVersion         = "1.2"
+	tellProtocolVersion     = "1.3"
+	compressProtocolVersion = "1.5"
+)
+
+var (
+	statusLineRegex     = regexp.MustCompile(`^SPAMD/(\d+)\.(\d+) `)
+	checkerVersionRegex = regexp.MustCompile(`(?mi)^X-Spam-Checker-Version:\s*SpamAssassin\s+(\S+)`)
+)
+
+// DetectCapabilities asks spamd for its protocol and SpamAssassin versions
+// and stores the result, which Capabilities returns from then on.
+func (c *Client) DetectCapabilities() (*Capabilities, error) {
+	status, err := c.ping()
+	if err != nil {
+		return nil, err
+	}
+	m := statusLineRegex.FindStringSubmatch(status)
+	if m == nil {
+		return nil, fmt.Errorf("unexpected response: %s", status)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	atLeast := func(wantMajor, wantMinor int) bool {
+		return major > wantMajor || major == wantMajor && minor >= wantMinor
+	}
+	caps := &Capabilities{
+		Protocol: m[1] + "." + m[2],
+		Tell:     atLeast(1, 3),
+		Headers:  atLeast(1, 4),
+		Compress: atLeast(1, 5),
+	}
+
+	// PROCESS returns the probe with the headers SpamAssassin adds, and has
+	// been supported by every spamd.
+	processed, err := c.process(probeEmail)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to read SpamAssassin version from spamd")
+	} else if m := checkerVersionRegex.FindStringSubmatch(processed); m != nil {
+		caps.Version = m[1]
+	}
+
+	c.capabilities.Store(caps)
+	logrus.WithFields(logrus.Fields{
+		"version":  caps.Version,
+		"protocol": caps.Protocol,
+		"tell":     caps.Tell,
+		"headers":  caps.Headers,
+		"compress": caps.Compress,
+	}).Info("Detected spamd capabilities")
+	return caps, nil
+}
+
+// Capabilities returns what DetectCapabilities last found, or nil if it has
+// not succeeded.
+func (c *Client) Capabilities() *Capabilities {
+	return c.capabilities.Load()
+}
+
+// headersCommand returns the command that returns the headers spamd adds:
+// HEADERS, or PROCESS, which also returns the body, for spamd without it.
+func (c *Client) headersCommand() string {
+	if caps := c.Capabilities(); caps != nil && caps.Headers {
+		return "HEADERS"
+	}
+	return "PROCESS"
+}
+
+// compressing reports whether requests are compressed: it must be
+// configured and spamd must be known to support it.
+func (c *Client) compressing() bool {
+	caps := c.Capabilities()
+	return c.compress && caps != nil && caps.Compress
+}
+
+// encodeRequest renders a request for command with the given extra header
+// lines, compressing content when enabled.
+func (c *Client) encodeRequest(command, content string, headers []string) ([]byte, error) {
+	version, body := protocolVersion, []byte(content)
+	if command == "TELL" {
+		version = tellProtocolVersion
+	}
+	if c.compressing() {
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		version, body = compressProtocolVersion, b.Bytes()
+		headers = append(headers, "Compress: zlib")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s SPAMC/%s\r\nContent-length: %d\r\n", command, version, len(body))
+	for _, h := range headers {
+		b.WriteString(h + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes(), nil
+}
+
+// process sends content with PROCESS and returns the message spamd returns.
+func (c *Client) process(content string) (string, error) {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.host, c.port), c.timeout)
+	if err != nil {
+		return "", toolerr.Errorf(toolerr.SpamdUnavailable, "connection failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	request, err := c.encodeRequest("PROCESS", content, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return "", fmt.Errorf("send failed: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	status, err := readLine(r)
+	if err != nil {
+		return "", fmt.Errorf("no response from SpamAssassin: %w", err)
+	}
+	if err := c.parseStatusLine(status); err != nil {
+		return "", err
+	}
+	compress := ""
+	for {
+		line, err := readLine(r)
+		if err != nil || line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Compress") {
+			compress = strings.TrimSpace(value)
+		}
+	}
+	return readBody(r, compress)
+}
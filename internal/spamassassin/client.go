@@ -2,22 +2,49 @@ package spamassassin
 
 import (
 	"bufio"
+	"compress/zlib"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/toolerr"
 )
 
 type Client struct {
-	host      string
-	port      int
-	timeout   time.Duration
-	threshold float64
+	host    string
+	port    int
+	timeout time.Duration
+
+	// threshold holds the float64 bits of the configured spam threshold so
+	// it can be changed on configuration reload
+	threshold atomic.Uint64
+
+	// scanSlots bounds concurrent scans; nil means unlimited
+	scanSlots    chan struct{}
+	queueTimeout time.Duration
+	waiting      atomic.Int64
+
+	compress     bool
+	capabilities atomic.Pointer[Capabilities]
+}
+
+// ErrBusy is returned when no scan slot frees up within the queue timeout.
+var ErrBusy = errors.New("spamd is busy")
+
+// ScanStats reports scan slot usage.
+type ScanStats struct {
+	MaxConcurrent int   `json:"max_concurrent_scans"`
+	Active        int   `json:"active_scans"`
+	Waiting       int64 `json:"waiting_scans"`
 }
 
 type ScanResult struct {
@@ -27,6 +54,14 @@ type ScanResult struct {
 	RulesHit  []RuleMatch
 	Summary   string
 	Headers   map[string]string
+
+	// SpamHeaders are the X-Spam-* headers spamd added, requested with
+	// ScanOptions.SpamHeaders.
+	SpamHeaders *SpamHeaders
+
+	// Autolearn is the Bayes auto-learning decision from X-Spam-Status,
+	// present when spamd added that header.
+	Autolearn *Autolearn
 }
 
 type RuleMatch struct {
@@ -35,47 +70,94 @@ type RuleMatch struct {
 	Description string  `json:"description"`
 }
 
+// ConfigInfo describes the SpamAssassin installation. Threshold is the
+// server's configured threshold and RequiredScore the one spamd applies,
+// omitted when spamd cannot be reached; Spamd describes the capabilities
+// detected when the client connected. Profiles and Users list the values the
+// profile and user scan parameters accept. The remaining fields come from the
+// installed rule files and the spamassassin tool; Version is "unknown" when
+// neither the tool nor spamd report it.
 type ConfigInfo struct {
-	Version      string         `json:"version"`
-	Threshold    float64        `json:"threshold"`
-	BayesEnabled bool           `json:"bayes_enabled"`
-	RuleCount    int            `json:"rule_count"`
-	Settings     map[string]any `json:"settings"`
+	Version          string            `json:"version"`
+	Threshold        float64           `json:"threshold"`
+	RequiredScore    *float64          `json:"required_score,omitempty"`
+	SpamdReachable   bool              `json:"spamd_reachable"`
+	Spamd            *Capabilities     `json:"spamd,omitempty"`
+	BayesEnabled     bool              `json:"bayes_enabled"`
+	Bayes            map[string]string `json:"bayes"`
+	RuleCount        int               `json:"rule_count"`
+	SubRuleCount     int               `json:"sub_rule_count"`
+	RulesByType      map[string]int    `json:"rules_by_type"`
+	RuleFiles        int               `json:"rule_files"`
+	Plugins          []string          `json:"plugins"`
+	TrustedNetworks  []string          `json:"trusted_networks"`
+	InternalNetworks []string          `json:"internal_networks"`
+	Settings         map[string]any    `json:"settings"`
+	Scans            ScanStats         `json:"scans"`
+	Profiles         []string          `json:"profiles,omitempty"`
+	Users            []string          `json:"users,omitempty"`
 }
 
 var (
-	scoreRegex = regexp.MustCompile(`(-?\d+\.?\d*)/(-?\d+\.?\d*)`)
+	scoreRegex = regexp.MustCompile(`(-?\d+\.?\d*)\s*/\s*(-?\d+\.?\d*)`)
 	ruleRegex  = regexp.MustCompile(`\s*(-?\d+\.?\d*)\s+(\w+)\s+(.*)`)
 )
 
 func NewClient(cfg config.SpamAssassinConfig) (*Client, error) {
 	client := &Client{
-		host:      cfg.Host,
-		port:      cfg.Port,
-		timeout:   cfg.Timeout,
-		threshold: cfg.Threshold,
+		host:         cfg.Host,
+		port:         cfg.Port,
+		timeout:      cfg.Timeout,
+		queueTimeout: cfg.QueueTimeout,
+		compress:     cfg.Compress,
+	}
+	client.SetThreshold(cfg.Threshold)
+	if cfg.MaxConcurrentScans > 0 {
+		client.scanSlots = make(chan struct{}, cfg.MaxConcurrentScans)
 	}
 
 	// Test connection
-	if err := client.ping(); err != nil {
+	if err := client.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to connect to SpamAssassin: %w", err)
 	}
 
 	logrus.Infof("Connected to SpamAssassin at %s:%d", client.host, client.port)
+	if _, err := client.DetectCapabilities(); err != nil {
+		logrus.WithError(err).Warn("Failed to detect spamd capabilities; compression is disabled")
+	}
 	return client, nil
 }
 
-func (c *Client) ping() error {
+// Threshold returns the configured spam threshold, reported when spamd's
+// reply does not include one.
+func (c *Client) Threshold() float64 {
+	return math.Float64frombits(c.threshold.Load())
+}
+
+// SetThreshold changes the configured spam threshold.
+func (c *Client) SetThreshold(threshold float64) {
+	c.threshold.Store(math.Float64bits(threshold))
+}
+
+// Ping checks that spamd is reachable and answering requests.
+func (c *Client) Ping() error {
+	_, err := c.ping()
+	return err
+}
+
+// ping sends PING and returns spamd's PONG status line.
+func (c *Client) ping() (string, error) {
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.host, c.port), c.timeout)
 	if err != nil {
-		return err
+		return "", toolerr.Wrap(toolerr.SpamdUnavailable, err)
 	}
 	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
 
 	// Send PING command
 	_, err = conn.Write([]byte("PING SPAMC/1.2\r\n\r\n"))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// Read response
@@ -83,55 +165,124 @@ func (c *Client) ping() error {
 	if scanner.Scan() {
 		response := scanner.Text()
 		if strings.Contains(response, "PONG") {
-			return nil
+			return response, nil
 		}
-		return fmt.Errorf("unexpected response: %s", response)
+		return "", fmt.Errorf("unexpected response: %s", response)
 	}
 
-	return fmt.Errorf("no response from SpamAssassin")
+	return "", fmt.Errorf("no response from SpamAssassin")
 }
 
 func (c *Client) ScanEmail(content string, options ScanOptions) (*ScanResult, error) {
+	release, err := c.acquireScanSlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.scan(content, options)
+}
+
+// scan sends one request to spamd, without waiting for a scan slot.
+func (c *Client) scan(content string, options ScanOptions) (*ScanResult, error) {
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.host, c.port), c.timeout)
 	if err != nil {
-		return nil, fmt.Errorf("connection failed: %w", err)
+		return nil, toolerr.Errorf(toolerr.SpamdUnavailable, "connection failed: %w", err)
 	}
 	defer conn.Close()
 
 	// Build command
 	cmd := "CHECK"
-	if options.Verbose {
+	switch {
+	case options.SpamHeaders:
+		cmd = c.headersCommand()
+	case options.Verbose, options.Rules == RuleScores:
 		cmd = "REPORT"
+	case options.Rules == RuleNames:
+		cmd = "SYMBOLS"
 	}
 
-	// Send headers
-	headers := fmt.Sprintf("%s SPAMC/1.2\r\nContent-length: %d\r\n", cmd, len(content))
-	if options.CheckBayes {
-		headers += "User: bayes\r\n"
+	// Build headers
+	var headers []string
+	if options.User != "" {
+		headers = append(headers, "User: "+options.User)
+	}
+	request, err := c.encodeRequest(cmd, content, headers)
+	if err != nil {
+		return nil, err
 	}
-	headers += "\r\n"
 
 	// Send request
-	_, err = conn.Write([]byte(headers + content))
+	_, err = conn.Write(request)
 	if err != nil {
 		return nil, fmt.Errorf("send failed: %w", err)
 	}
 
 	// Read response
-	return c.parseResponse(conn, options.Verbose)
+	return c.parseResponse(conn, options)
 }
 
-func (c *Client) parseResponse(conn net.Conn, verbose bool) (*ScanResult, error) {
-	scanner := bufio.NewScanner(conn)
+// acquireScanSlot waits up to the queue timeout for a free scan slot. Waiting
+// scans are admitted in no particular order.
+func (c *Client) acquireScanSlot() (release func(), err error) {
+	if c.scanSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case c.scanSlots <- struct{}{}:
+		return func() { <-c.scanSlots }, nil
+	default:
+	}
+
+	c.waiting.Add(1)
+	defer c.waiting.Add(-1)
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case c.scanSlots <- struct{}{}:
+		return func() { <-c.scanSlots }, nil
+	case <-timer.C:
+		logrus.WithField("max_concurrent_scans", cap(c.scanSlots)).Warn("Timed out waiting for a scan slot")
+		return nil, fmt.Errorf("%w: all %d scan slots stayed in use for %s; retry later", ErrBusy, cap(c.scanSlots), c.queueTimeout)
+	}
+}
+
+// ScanStats returns current scan slot usage.
+func (c *Client) ScanStats() ScanStats {
+	return ScanStats{
+		MaxConcurrent: cap(c.scanSlots),
+		Active:        len(c.scanSlots),
+		Waiting:       c.waiting.Load(),
+	}
+}
+
+func (c *Client) parseResponse(conn net.Conn, options ScanOptions) (*ScanResult, error) {
+	r := bufio.NewReader(conn)
 	result := &ScanResult{
-		Threshold: c.threshold,
+		Threshold: c.Threshold(),
 		Headers:   make(map[string]string),
 		RulesHit:  make([]RuleMatch, 0),
 	}
 
+	// Parse status line, e.g. "SPAMD/1.1 0 EX_OK"
+	status, err := readLine(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("no response from SpamAssassin")
+		}
+		return nil, err
+	}
+	if err := c.parseStatusLine(status); err != nil {
+		return nil, err
+	}
+
 	// Parse response headers
-	for scanner.Scan() {
-		line := scanner.Text()
+	sawSpamLine := false
+	for {
+		line, err := readLine(r)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
 		if line == "" {
 			break // End of headers
 		}
@@ -141,6 +292,7 @@ func (c *Client) parseResponse(conn net.Conn, verbose bool) (*ScanResult, error)
 			if err := c.parseSpamLine(line, result); err != nil {
 				return nil, err
 			}
+			sawSpamLine = true
 		} else {
 			// Store other headers
 			parts := strings.SplitN(line, ":", 2)
@@ -148,21 +300,106 @@ func (c *Client) parseResponse(conn net.Conn, verbose bool) (*ScanResult, error)
 				result.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
 			}
 		}
+		if err == io.EOF {
+			break
+		}
 	}
 
-	// Parse message body if verbose
-	if verbose {
-		var body strings.Builder
-		for scanner.Scan() {
-			body.WriteString(scanner.Text() + "\n")
+	if !sawSpamLine {
+		return nil, fmt.Errorf("incomplete response from SpamAssassin: missing Spam header")
+	}
+
+	switch {
+	case options.SpamHeaders:
+		// The body is the message, or only its headers, as spamd would
+		// deliver it; the report is in X-Spam-Report when spamd adds it.
+		body, err := readBody(r, result.Headers["Compress"])
+		if err != nil {
+			return nil, err
+		}
+		result.SpamHeaders = ParseSpamHeaders(body)
+		if result.SpamHeaders != nil {
+			result.Autolearn = ParseAutolearn(result.SpamHeaders.Status)
+		}
+		if result.SpamHeaders != nil && result.SpamHeaders.Report != "" {
+			result.Summary = result.SpamHeaders.Report
+			result.RulesHit = append(result.RulesHit, result.SpamHeaders.ReportRules...)
+		}
+	case options.Verbose:
+		// Parse message body if verbose
+		body, err := readBody(r, result.Headers["Compress"])
+		if err != nil {
+			return nil, err
 		}
-		result.Summary = body.String()
+		result.Summary = strings.ReplaceAll(body, "\r\n", "\n")
 		c.parseRules(result.Summary, result)
+	case options.Rules == RuleScores:
+		body, err := readBody(r, result.Headers["Compress"])
+		if err != nil {
+			return nil, err
+		}
+		c.parseRules(strings.ReplaceAll(body, "\r\n", "\n"), result)
+	case options.Rules == RuleNames:
+		// The body is the comma-separated names of the rules that hit
+		body, err := readBody(r, result.Headers["Compress"])
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(strings.TrimSpace(body), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				result.RulesHit = append(result.RulesHit, RuleMatch{Name: name})
+			}
+		}
 	}
 
+	if options.Threshold != nil {
+		result.Threshold = *options.Threshold
+	}
 	result.IsSpam = result.Score >= result.Threshold
 
-	return result, scanner.Err()
+	return result, nil
+}
+
+// readLine reads one line of a response without its line ending.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readBody reads the rest of a response, which spamd compresses when the
+// request was compressed.
+func readBody(r *bufio.Reader, compress string) (string, error) {
+	var body io.Reader = r
+	if strings.EqualFold(compress, "zlib") {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return "", fmt.Errorf("invalid compressed response: %w", err)
+		}
+		defer zr.Close()
+		body = zr
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *Client) parseStatusLine(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "SPAMD/") {
+		return fmt.Errorf("invalid response from SpamAssassin: %s", line)
+	}
+	switch fields[1] {
+	case "0":
+		return nil
+	case "69", "75": // EX_UNAVAILABLE, EX_TEMPFAIL
+		return toolerr.Errorf(toolerr.SpamdUnavailable, "SpamAssassin error: %s", strings.Join(fields[1:], " "))
+	}
+	return fmt.Errorf("SpamAssassin error: %s", strings.Join(fields[1:], " "))
 }
 
 func (c *Client) parseSpamLine(line string, result *ScanResult) error {
@@ -189,6 +426,13 @@ func (c *Client) parseSpamLine(line string, result *ScanResult) error {
 }
 
 func (c *Client) parseRules(content string, result *ScanResult) {
+	result.RulesHit = append(result.RulesHit, parseRuleTable(content)...)
+}
+
+// parseRuleTable returns the rule hits listed in the "pts rule name" table
+// of a content analysis report.
+func parseRuleTable(content string) []RuleMatch {
+	hits := make([]RuleMatch, 0)
 	lines := strings.Split(content, "\n")
 	inRulesSection := false
 
@@ -213,35 +457,79 @@ func (c *Client) parseRules(content string, result *ScanResult) {
 					Score:       score,
 					Description: matches[3],
 				}
-				result.RulesHit = append(result.RulesHit, rule)
+				hits = append(hits, rule)
 			}
 		}
 	}
+	return hits
 }
 
+// probeEmail is scanned by GetConfig to learn the required score spamd
+// applies.
+const probeEmail = "Subject: spamassassin-mcp configuration probe\r\n\r\nprobe\r\n"
+
+// GetConfig reports the connection settings, scan slot usage and spamd's
+// capabilities, and asks spamd for its required score by scanning a probe
+// message. The probe does not take a scan slot, so it is answered while
+// every slot is busy. An unreachable spamd is reported rather than returned
+// as an error. Capabilities are detected again if detection failed when the
+// client connected.
 func (c *Client) GetConfig() (*ConfigInfo, error) {
-	// This would require additional SpamAssassin integration
-	// For now, return basic info
-	return &ConfigInfo{
-		Version:      "3.4.x",
-		Threshold:    c.threshold,
-		BayesEnabled: true,
-		RuleCount:    1000, // Approximate
+	info := &ConfigInfo{
+		Threshold: c.Threshold(),
 		Settings: map[string]any{
 			"host":    c.host,
 			"port":    c.port,
 			"timeout": c.timeout.String(),
 		},
-	}, nil
-}
+		Scans: c.ScanStats(),
+	}
+	result, err := c.scan(probeEmail, ScanOptions{})
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to query spamd configuration")
+		return info, nil
+	}
+	info.SpamdReachable = true
+	info.RequiredScore = &result.Threshold
 
-func (c *Client) UpdateRules() error {
-	// In a real implementation, this would trigger rule updates
-	logrus.Info("Rule update requested (not implemented in basic client)")
-	return nil
+	info.Spamd = c.Capabilities()
+	if info.Spamd == nil {
+		if info.Spamd, err = c.DetectCapabilities(); err != nil {
+			logrus.WithError(err).Warn("Failed to detect spamd capabilities")
+		}
+	}
+	return info, nil
 }
 
 type ScanOptions struct {
-	CheckBayes bool
-	Verbose    bool
-}
\ No newline at end of file
+	Verbose bool
+
+	// SpamHeaders asks for the X-Spam-* headers spamd adds, with HEADERS or
+	// PROCESS, instead of a REPORT when Verbose is set too.
+	SpamHeaders bool
+
+	// User selects spamd's per-user preferences and Bayes database, sent as
+	// the User header; spamd's own user is used when it is empty.
+	User string
+	// Threshold, when set, replaces the required score spamd reports.
+	Threshold *float64
+
+	// Rules asks for the rule hits when neither Verbose nor SpamHeaders is
+	// set, for verdicts that depend on them.
+	Rules RuleDetail
+}
+
+// RuleDetail selects which rule hits a scan without Verbose or SpamHeaders
+// asks spamd for.
+type RuleDetail int
+
+const (
+	// NoRules sends CHECK, which reports only the score.
+	NoRules RuleDetail = iota
+	// RuleNames sends SYMBOLS and keeps the names of the rules that hit,
+	// without their scores.
+	RuleNames
+	// RuleScores sends REPORT and keeps the rule hits with their scores,
+	// but not the report as the summary.
+	RuleScores
+)
@@ -0,0 +1,79 @@
+package spamassassin
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Collaborative filters, as named in results.
+const (
+	FilterRazor2 = "razor2"
+	FilterPyzor  = "pyzor"
+	FilterDCC    = "dcc"
+)
+
+// collaborativeFilters are the rule prefixes of each filter and the rule
+// that hits when the message is listed on it.
+var collaborativeFilters = []struct {
+	name, prefix, check string
+}{
+	{FilterRazor2, "RAZOR2_", "RAZOR2_CHECK"},
+	{FilterPyzor, "PYZOR_", "PYZOR_CHECK"},
+	{FilterDCC, "DCC_", "DCC_CHECK"},
+}
+
+// bandRegex extracts the band of the Razor2 confidence rules
+// (RAZOR2_CF_RANGE_51_100, RAZOR2_CF_RANGE_E8_51_100) and the DCC
+// reputation rules (DCC_REPUT_95_98).
+var bandRegex = regexp.MustCompile(`^(?:RAZOR2_CF_RANGE_(?:E\d+_)?|DCC_REPUT_)(\d+)_(\d+)$`)
+
+// CollaborativeFilter is what one collaborative filter said about a
+// message. Listed is set when the message's checksum is reported on it.
+// Band is the Razor2 confidence or the DCC reputation range of the sender,
+// in percent, when a rule reported one.
+type CollaborativeFilter struct {
+	Name   string      `json:"name"`
+	Listed bool        `json:"listed"`
+	Band   string      `json:"band,omitempty"`
+	Score  float64     `json:"score"`
+	Rules  []RuleMatch `json:"rules"`
+}
+
+// CollaborativeResult is the collaborative filters section of a scan: the
+// Razor2, Pyzor and DCC checksum networks, in that order. Setting is
+// "enable" or "disable" when the scan switched the tests on or off.
+type CollaborativeResult struct {
+	Filters []CollaborativeFilter `json:"filters"`
+	Score   float64               `json:"score"`
+	Setting string                `json:"setting,omitempty"`
+}
+
+// CollaborativeFilters groups the Razor2, Pyzor and DCC rule hits of a
+// scan. Every filter is listed, so one that did not hit shows as not
+// listed; a filter that is disabled or unreachable cannot be told apart
+// from one that has no report of the message.
+func CollaborativeFilters(rules []RuleMatch) *CollaborativeResult {
+	result := &CollaborativeResult{Filters: make([]CollaborativeFilter, len(collaborativeFilters))}
+	for i, f := range collaborativeFilters {
+		filter := &result.Filters[i]
+		filter.Name = f.name
+		filter.Rules = make([]RuleMatch, 0)
+		for _, r := range rules {
+			if !strings.HasPrefix(r.Name, f.prefix) {
+				continue
+			}
+			filter.Rules = append(filter.Rules, r)
+			filter.Score += r.Score
+			if r.Name == f.check {
+				filter.Listed = true
+			}
+			if m := bandRegex.FindStringSubmatch(r.Name); m != nil {
+				filter.Band = m[1] + "-" + m[2]
+			}
+		}
+		filter.Score = round(filter.Score)
+		result.Score += filter.Score
+	}
+	result.Score = round(result.Score)
+	return result
+}
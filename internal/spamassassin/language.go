@@ -0,0 +1,165 @@
+package spamassassin
+
+import (
+	"slices"
+	"strings"
+)
+
+// Kinds of language rule.
+const (
+	LanguageKindLanguage = "language"
+	LanguageKindLocale   = "locale"
+)
+
+// languageRules maps the stock rules that flag a message for its language
+// or locale to their kind. The TextCat plugin adds UNWANTED_LANGUAGE_BODY
+// when the body is written in a language missing from ok_languages; the
+// CHARSET_FARAWAY rules hit when the message uses a charset of a locale
+// missing from ok_locales.
+var languageRules = map[string]string{
+	"UNWANTED_LANGUAGE_BODY": LanguageKindLanguage,
+	"CHARSET_FARAWAY":        LanguageKindLocale,
+	"CHARSET_FARAWAY_HEADER": LanguageKindLocale,
+	"MIME_CHARSET_FARAWAY":   LanguageKindLocale,
+}
+
+// charsetLocales maps charsets to the ok_locales locale SpamAssassin
+// assigns them. Other charsets, such as us-ascii, iso-8859-1 and utf-8,
+// are accepted in every locale.
+var charsetLocales = map[string]string{
+	"iso-2022-jp":     "ja",
+	"euc-jp":          "ja",
+	"shift_jis":       "ja",
+	"shift-jis":       "ja",
+	"sjis":            "ja",
+	"euc-kr":          "ko",
+	"iso-2022-kr":     "ko",
+	"ks_c_5601-1987":  "ko",
+	"koi8-r":          "ru",
+	"koi8-u":          "ru",
+	"iso-8859-5":      "ru",
+	"windows-1251":    "ru",
+	"cp1251":          "ru",
+	"cp866":           "ru",
+	"tis-620":         "th",
+	"windows-874":     "th",
+	"iso-8859-11":     "th",
+	"gb2312":          "zh",
+	"gbk":             "zh",
+	"gb18030":         "zh",
+	"hz-gb-2312":      "zh",
+	"big5":            "zh",
+	"big5-hkscs":      "zh",
+	"euc-tw":          "zh",
+	"iso-2022-cn":     "zh",
+	"iso-2022-cn-ext": "zh",
+}
+
+// LanguageHit is a language or locale rule hit. Suppressed hits were
+// overridden by the profile's ok_languages or ok_locales and do not count
+// towards the score.
+type LanguageHit struct {
+	Name        string  `json:"name"`
+	Kind        string  `json:"kind"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description"`
+	Suppressed  bool    `json:"suppressed"`
+}
+
+// LanguageResult is the language section of a scan: the language and
+// locale rules that hit, and what the message declares that they depend
+// on. Adjustment is the score removed by suppressed hits, zero or negative.
+type LanguageResult struct {
+	Hits        []LanguageHit `json:"hits"`
+	Charsets    []string      `json:"charsets"`
+	Locales     []string      `json:"locales"`
+	Languages   []string      `json:"languages"`
+	OkLanguages string        `json:"ok_languages,omitempty"`
+	OkLocales   string        `json:"ok_locales,omitempty"`
+	Adjustment  float64       `json:"adjustment"`
+}
+
+// LanguageKind returns the kind of language rule a rule is, or "" for
+// other rules.
+func LanguageKind(rule string) string {
+	return languageRules[rule]
+}
+
+// CharsetLocale returns the ok_locales locale of a charset, or "" for
+// charsets accepted in every locale.
+func CharsetLocale(charset string) string {
+	return charsetLocales[strings.ToLower(charset)]
+}
+
+// LanguageOverrides replace the ok_languages and ok_locales settings spamd
+// scanned with. Each is "all" or a space-separated list of codes; empty
+// keeps spamd's verdict.
+type LanguageOverrides struct {
+	OkLanguages string
+	OkLocales   string
+}
+
+// Languages classifies the language and locale rule hits of a scan. charsets
+// are the charsets the message declares and languages the languages of its
+// Content-Language headers. A locale hit is suppressed when OkLocales
+// accepts the locale of every charset, mirroring SpamAssassin's check. The
+// language TextCat detected is not reported by spamd, so a language hit is
+// suppressed when OkLanguages is "all" or lists every declared language. It
+// returns nil when no language or locale rule hit.
+func Languages(rules []RuleMatch, charsets, languages []string, overrides LanguageOverrides) *LanguageResult {
+	r := &LanguageResult{
+		Hits:        make([]LanguageHit, 0),
+		Charsets:    charsets,
+		Locales:     make([]string, 0),
+		Languages:   languages,
+		OkLanguages: overrides.OkLanguages,
+		OkLocales:   overrides.OkLocales,
+	}
+	for _, charset := range charsets {
+		if locale := CharsetLocale(charset); locale != "" && !slices.Contains(r.Locales, locale) {
+			r.Locales = append(r.Locales, locale)
+		}
+	}
+
+	for _, rule := range rules {
+		kind := LanguageKind(rule.Name)
+		if kind == "" {
+			continue
+		}
+		hit := LanguageHit{Name: rule.Name, Kind: kind, Score: rule.Score, Description: rule.Description}
+		switch kind {
+		case LanguageKindLanguage:
+			hit.Suppressed = accepts(overrides.OkLanguages, languages)
+		case LanguageKindLocale:
+			hit.Suppressed = accepts(overrides.OkLocales, r.Locales)
+		}
+		if hit.Suppressed {
+			r.Adjustment -= rule.Score
+		}
+		r.Hits = append(r.Hits, hit)
+	}
+	if len(r.Hits) == 0 {
+		return nil
+	}
+	r.Adjustment = round(r.Adjustment)
+	return r
+}
+
+// accepts reports whether an ok_languages or ok_locales setting accepts
+// every code in codes. An empty setting accepts nothing, so spamd's verdict
+// stands, and a list accepts nothing when there is nothing to compare.
+func accepts(setting string, codes []string) bool {
+	allowed := strings.Fields(strings.ToLower(setting))
+	if slices.Contains(allowed, "all") {
+		return true
+	}
+	if len(allowed) == 0 || len(codes) == 0 {
+		return false
+	}
+	for _, code := range codes {
+		if !slices.Contains(allowed, code) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package spamassassin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// reportScoreRegex matches the heading of a content analysis report, e.g.
+// "Content analysis details:   (7.2 points, 5.0 required)".
+var reportScoreRegex = regexp.MustCompile(`Content analysis details:\s*\((-?\d+(?:\.\d+)?) points?, (-?\d+(?:\.\d+)?) required\)`)
+
+// ParseReport parses the content analysis report that the spamassassin
+// command-line tool appends in test mode (-t), the same report spamd returns
+// for REPORT. IsSpam is set against the threshold in the report. The last
+// report is used, as test mode appends it after the message, which may
+// quote one.
+func ParseReport(report string) (*ScanResult, error) {
+	all := reportScoreRegex.FindAllStringSubmatchIndex(report, -1)
+	if all == nil {
+		return nil, fmt.Errorf("no content analysis report in spamassassin output")
+	}
+	m := all[len(all)-1]
+	score, err := strconv.ParseFloat(report[m[2]:m[3]], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid score: %s", report[m[2]:m[3]])
+	}
+	threshold, err := strconv.ParseFloat(report[m[4]:m[5]], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold: %s", report[m[4]:m[5]])
+	}
+	return &ScanResult{
+		Score:     score,
+		Threshold: threshold,
+		IsSpam:    score >= threshold,
+		RulesHit:  parseRuleTable(report[m[1]:]),
+		Summary:   report,
+		Headers:   make(map[string]string),
+	}, nil
+}
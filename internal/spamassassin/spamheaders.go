@@ -0,0 +1,179 @@
+package spamassassin
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SpamHeaders are the X-Spam-* headers SpamAssassin adds to a message, as
+// returned by HEADERS and PROCESS requests. Which headers are present
+// depends on spamd's add_header and report_safe settings.
+type SpamHeaders struct {
+	// Flag is set by X-Spam-Flag: YES, added to spam only.
+	Flag   bool        `json:"flag"`
+	Status *SpamStatus `json:"status,omitempty"`
+
+	// Level is the number of stars in X-Spam-Level, one per point of score.
+	Level int `json:"level"`
+
+	// Report is X-Spam-Report, unfolded to one line per rule, and
+	// ReportRules the rule hits listed in it.
+	Report      string      `json:"report,omitempty"`
+	ReportRules []RuleMatch `json:"report_rules,omitempty"`
+
+	Checker *CheckerVersion `json:"checker,omitempty"`
+
+	// Other holds the remaining X-Spam-* headers, such as those added with
+	// custom add_header lines, keyed by name without the X-Spam- prefix.
+	Other map[string]string `json:"other,omitempty"`
+}
+
+// SpamStatus is the parsed X-Spam-Status header, e.g. "Yes, score=15.3
+// required=5.0 tests=BAYES_99,URIBL_BLACK autolearn=spam version=4.0.1".
+// Fields is every key=value pair, including ones without a typed field.
+type SpamStatus struct {
+	IsSpam    bool              `json:"is_spam"`
+	Score     float64           `json:"score"`
+	Required  float64           `json:"required"`
+	Tests     []string          `json:"tests"`
+	Autolearn string            `json:"autolearn,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// CheckerVersion is the parsed X-Spam-Checker-Version header, e.g.
+// "SpamAssassin 4.0.1 (2024-03-26) on mx.example.com".
+type CheckerVersion struct {
+	Version string `json:"version"`
+	Date    string `json:"date,omitempty"`
+	Host    string `json:"host,omitempty"`
+}
+
+var (
+	statusFieldRegex = regexp.MustCompile(`(\w+)=(\S*)`)
+	foldedCommaRegex = regexp.MustCompile(`,\s+`)
+	reportRuleRegex  = regexp.MustCompile(`^\s*(-?\d+(?:\.\d+)?)\s+(\w+)\s*(.*)$`)
+	checkerRegex     = regexp.MustCompile(`^SpamAssassin\s+(\S+)(?:\s+\(([^)]*)\))?(?:\s+on\s+(\S+))?`)
+)
+
+// ParseSpamHeaders extracts the X-Spam-* headers from the header block of
+// a message. It returns nil when there are none.
+func ParseSpamHeaders(message string) *SpamHeaders {
+	var h *SpamHeaders
+	for _, field := range headerFields(message) {
+		name, value := field[0], field[1]
+		if len(name) <= len("X-Spam-") || !strings.EqualFold(name[:len("X-Spam-")], "X-Spam-") {
+			continue
+		}
+		if h == nil {
+			h = &SpamHeaders{}
+		}
+		key := name[len("X-Spam-"):]
+		switch strings.ToLower(key) {
+		case "flag":
+			h.Flag = strings.EqualFold(strings.TrimSpace(value), "YES")
+		case "status":
+			h.Status = parseSpamStatus(unfold(value))
+		case "level":
+			h.Level = strings.Count(value, "*")
+		case "report":
+			h.Report = reportLines(value)
+			h.ReportRules = parseReportRules(h.Report)
+		case "checker-version":
+			if m := checkerRegex.FindStringSubmatch(unfold(value)); m != nil {
+				h.Checker = &CheckerVersion{Version: m[1], Date: m[2], Host: m[3]}
+			}
+		default:
+			if h.Other == nil {
+				h.Other = make(map[string]string)
+			}
+			h.Other[key] = unfold(value)
+		}
+	}
+	return h
+}
+
+// headerFields splits the header block of message into name and raw value
+// pairs. Folded values keep their line breaks.
+func headerFields(message string) [][2]string {
+	var fields [][2]string
+	for _, line := range strings.Split(strings.ReplaceAll(message, "\r\n", "\n"), "\n") {
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) > 0 {
+				fields[len(fields)-1][1] += "\n" + line
+			}
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			fields = append(fields, [2]string{strings.TrimSpace(name), value})
+		}
+	}
+	return fields
+}
+
+func unfold(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// reportLines returns a folded X-Spam-Report value with one trimmed line per
+// folded line, dropping the empty first line SpamAssassin emits.
+func reportLines(value string) string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseReportRules returns the rule hits of an X-Spam-Report, whose lines
+// have the form "*  3.5 URIBL_BLACK Contains an URL listed in the URIBL
+// blacklist". Lines continuing a description start with "*" and
+// whitespace only and are appended to the previous rule.
+func parseReportRules(report string) []RuleMatch {
+	rules := make([]RuleMatch, 0)
+	for _, line := range strings.Split(report, "\n") {
+		rest, ok := strings.CutPrefix(line, "*")
+		if !ok {
+			continue
+		}
+		if m := reportRuleRegex.FindStringSubmatch(rest); m != nil {
+			if score, err := strconv.ParseFloat(m[1], 64); err == nil {
+				rules = append(rules, RuleMatch{Name: m[2], Score: score, Description: strings.TrimSpace(m[3])})
+				continue
+			}
+		}
+		if len(rules) > 0 && strings.TrimSpace(rest) != "" {
+			last := &rules[len(rules)-1]
+			last.Description += " " + strings.TrimSpace(rest)
+		}
+	}
+	return rules
+}
+
+func parseSpamStatus(value string) *SpamStatus {
+	verdict, _, _ := strings.Cut(value, ",")
+	s := &SpamStatus{
+		IsSpam: strings.EqualFold(strings.TrimSpace(verdict), "Yes"),
+		Tests:  make([]string, 0),
+		Fields: make(map[string]string),
+	}
+	// Folding may leave spaces after the commas of the tests list.
+	value = foldedCommaRegex.ReplaceAllString(value, ",")
+	for _, m := range statusFieldRegex.FindAllStringSubmatch(value, -1) {
+		s.Fields[m[1]] = m[2]
+	}
+	s.Score, _ = strconv.ParseFloat(s.Fields["score"], 64)
+	s.Required, _ = strconv.ParseFloat(s.Fields["required"], 64)
+	if tests := s.Fields["tests"]; tests != "" && tests != "none" {
+		s.Tests = strings.Split(tests, ",")
+	}
+	s.Autolearn = s.Fields["autolearn"]
+	s.Version = s.Fields["version"]
+	return s
+}
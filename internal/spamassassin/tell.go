@@ -0,0 +1,79 @@
+package spamassassin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// Message classes Learn trains Bayes with.
+const (
+	ClassSpam = "spam"
+	ClassHam  = "ham"
+)
+
+// ErrTellUnsupported is returned by Learn when spamd is known to predate
+// the TELL command.
+var ErrTellUnsupported = errors.New("spamd does not support TELL (protocol 1.3)")
+
+// Learn trains the Bayes database of user, or of spamd's own user when user
+// is empty, with content as class, using the TELL command. spamd must run
+// with --allow-tell. It reports whether spamd learned the message; a
+// message already learned as class is not learned again.
+func (c *Client) Learn(content, class, user string) (bool, error) {
+	if class != ClassSpam && class != ClassHam {
+		return false, fmt.Errorf("invalid message class %q", class)
+	}
+	if caps := c.Capabilities(); caps != nil && !caps.Tell {
+		return false, ErrTellUnsupported
+	}
+	release, err := c.acquireScanSlot()
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", c.host, c.port), c.timeout)
+	if err != nil {
+		return false, toolerr.Errorf(toolerr.SpamdUnavailable, "connection failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	headers := []string{"Message-class: " + class, "Set: local"}
+	if user != "" {
+		headers = append(headers, "User: "+user)
+	}
+	request, err := c.encodeRequest("TELL", content, headers)
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return false, fmt.Errorf("send failed: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	status, err := readLine(r)
+	if err != nil {
+		return false, fmt.Errorf("no response from SpamAssassin: %w", err)
+	}
+	if err := c.parseStatusLine(status); err != nil {
+		return false, err
+	}
+	learned := false
+	for {
+		line, err := readLine(r)
+		if err != nil || line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "DidSet") {
+			learned = strings.Contains(value, "local")
+		}
+	}
+	return learned, nil
+}
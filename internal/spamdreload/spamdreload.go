@@ -0,0 +1,186 @@
+// Package spamdreload makes installed rule changes take effect: it runs
+// sa-compile and tells spamd to reload, then waits for spamd to answer
+// again.
+//
+// spamd reloads its configuration on SIGHUP, so the signal method sends it
+// to the process named by spamd's PID file. Where spamd runs under a
+// supervisor, such as systemd or s6, the command method runs the
+// supervisor's reload command instead.
+//
+// Security considerations:
+//   - sa-compile and the reload command are executed directly, never through
+//     a shell, with a minimal environment; only the configured command runs
+//   - Each step is bounded by a timeout, and only one reload runs at a time
+package spamdreload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Reload methods.
+const (
+	MethodNone    = "none"
+	MethodSignal  = "signal"
+	MethodCommand = "command"
+)
+
+// pingInterval is how often spamd is pinged while waiting for it to answer
+// after a reload.
+const pingInterval = 250 * time.Millisecond
+
+// Result reports what Apply did. Error describes the step that failed;
+// later steps are skipped. Responding is set once spamd answers a PING after
+// the reload.
+type Result struct {
+	Compiled   bool   `json:"compiled"`
+	Method     string `json:"method"`
+	Reloaded   bool   `json:"reloaded"`
+	Responding bool   `json:"responding"`
+	Error      string `json:"error,omitempty"`
+}
+
+// OK reports whether every configured step succeeded.
+func (r *Result) OK() bool {
+	return r.Error == ""
+}
+
+// Reloader compiles rules and reloads spamd.
+type Reloader struct {
+	mu   sync.Mutex
+	cfg  config.SpamdReloadConfig
+	ping func() error
+}
+
+// New creates a reloader for cfg. ping checks that spamd answers requests.
+func New(cfg config.SpamdReloadConfig, ping func() error) *Reloader {
+	return &Reloader{cfg: cfg, ping: ping}
+}
+
+// Enabled reports whether Apply does anything.
+func (r *Reloader) Enabled() bool {
+	return r.cfg.Compile || r.cfg.Method != MethodNone
+}
+
+// Apply runs sa-compile when configured, then reloads spamd with the
+// configured method and waits until it answers or the timeout expires.
+// Failures are reported in the result rather than returned, since the rule
+// changes they follow have already been installed.
+func (r *Reloader) Apply(ctx context.Context) *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &Result{Method: r.cfg.Method}
+	if r.cfg.Compile {
+		if err := r.run(ctx, r.cfg.SaCompile); err != nil {
+			result.Error = fmt.Sprintf("sa-compile failed: %v", err)
+			return result
+		}
+		result.Compiled = true
+	}
+
+	var err error
+	switch r.cfg.Method {
+	case MethodSignal:
+		err = r.signal()
+	case MethodCommand:
+		err = r.run(ctx, r.cfg.Command[0], r.cfg.Command[1:]...)
+	default:
+		return result
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("spamd reload failed: %v", err)
+		return result
+	}
+	result.Reloaded = true
+
+	if err := r.waitForSpamd(ctx); err != nil {
+		result.Error = fmt.Sprintf("spamd did not answer after the reload: %v", err)
+		return result
+	}
+	result.Responding = true
+	return result
+}
+
+// signal sends SIGHUP to the spamd process named in the PID file.
+func (r *Reloader) signal() error {
+	data, err := os.ReadFile(r.cfg.PIDFile)
+	if err != nil {
+		return fmt.Errorf("failed to read PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 1 {
+		return fmt.Errorf("PID file %s does not contain a process ID", r.cfg.PIDFile)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		return fmt.Errorf("failed to signal process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// waitForSpamd pings spamd until it answers. spamd stops answering while it
+// re-reads its configuration, which can take a while with many rules.
+func (r *Reloader) waitForSpamd(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		err := r.ping()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// run executes a tool, failing on a non-zero exit status with the last line
+// of its output.
+func (r *Reloader) run(ctx context.Context, binary string, args ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME"), "LANG=C"}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("%s did not finish within %s", filepath.Base(binary), r.cfg.Timeout)
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("exit status %d: %s", exitErr.ExitCode(), lastLine(out.String()))
+	}
+	return err
+}
+
+func lastLine(output string) string {
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return "no output"
+	}
+	return output[strings.LastIndex(output, "\n")+1:]
+}
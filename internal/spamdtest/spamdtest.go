@@ -0,0 +1,460 @@
+// Package spamdtest provides a scriptable in-process spamd server for tests.
+//
+// The server speaks the spamc/spamd protocol over TCP on a loopback port, so
+// the real SpamAssassin client can be exercised end to end without a
+// SpamAssassin installation. Responses are canned per command and can be
+// replaced with a custom handler; faults and latency can be injected to test
+// error handling and timeouts. Like spamd, the server accepts zlib-compressed
+// requests and compresses its reply to them.
+//
+// Typical use:
+//
+//	srv := spamdtest.NewServer()
+//	defer srv.Close()
+//	srv.SetResponse("REPORT", spamdtest.Response{
+//		Spam:  true,
+//		Score: 12.5,
+//		Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 3.5, Description: "Contains an URL listed in the URIBL blacklist"}},
+//	})
+//	client, err := spamassassin.NewClient(srv.Config())
+package spamdtest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// DefaultThreshold is the required score reported when a response does not
+// set one.
+const DefaultThreshold = 5.0
+
+// DefaultProtocol is the protocol version the server answers PING with, and
+// Version the SpamAssassin version it stamps into PROCESS replies.
+const (
+	DefaultProtocol = "1.5"
+	Version         = "4.0.1"
+)
+
+// Request is a request received by the fake server. Body is decompressed
+// when the request was compressed.
+type Request struct {
+	Command string
+	Version string
+	Headers textproto.MIMEHeader
+	Body    []byte
+}
+
+// Rule is a rule hit listed in REPORT and SYMBOLS responses.
+type Rule struct {
+	Name        string
+	Score       float64
+	Description string
+}
+
+// Response describes the reply to a request. The zero value is a successful
+// ham result.
+type Response struct {
+	// Code and Message form the status line; zero means "0 EX_OK".
+	Code    int
+	Message string
+
+	Spam      bool
+	Score     float64
+	Threshold float64
+	Rules     []Rule
+
+	// Autolearn and AutolearnForce are the autolearn and autolearn_force
+	// values of X-Spam-Status; they default to "no".
+	Autolearn      string
+	AutolearnForce bool
+
+	// Headers are extra response headers, e.g. DidSet for TELL.
+	Headers map[string]string
+
+	// Body replaces the generated response body when non-empty.
+	Body string
+}
+
+// Fault is a failure mode injected in place of a normal response.
+type Fault int
+
+const (
+	// FaultNone responds normally.
+	FaultNone Fault = iota
+
+	// FaultDrop closes the connection without replying.
+	FaultDrop
+
+	// FaultUnavailable replies with "69 EX_UNAVAILABLE".
+	FaultUnavailable
+
+	// FaultGarbage replies with a malformed status and spam line.
+	FaultGarbage
+
+	// FaultTruncate sends the status line and closes mid-response.
+	FaultTruncate
+)
+
+// HandlerFunc computes the response for a request.
+type HandlerFunc func(req *Request) Response
+
+// Server is a fake spamd server.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	responses  map[string]Response
+	handler    HandlerFunc
+	fault      Fault
+	faultCount int
+	latency    time.Duration
+	protocol   string
+	requests   []*Request
+}
+
+// NewServer starts a fake spamd server on a loopback port. It panics if no
+// port can be allocated, like net/http/httptest.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("spamdtest: failed to listen: %v", err))
+	}
+
+	s := &Server{
+		listener:  ln,
+		responses: make(map[string]Response),
+		protocol:  DefaultProtocol,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the host and port the server listens on.
+func (s *Server) Addr() (string, int) {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Config returns a SpamAssassin client configuration pointing at the server.
+func (s *Server) Config() config.SpamAssassinConfig {
+	host, port := s.Addr()
+	return config.SpamAssassinConfig{
+		Host:      host,
+		Port:      port,
+		Timeout:   5 * time.Second,
+		Threshold: DefaultThreshold,
+	}
+}
+
+// SetResponse sets the canned response for a command (CHECK, REPORT,
+// SYMBOLS, TELL, ...). An empty command sets the fallback for all commands.
+func (s *Server) SetResponse(command string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[strings.ToUpper(command)] = resp
+}
+
+// Handle replaces canned responses with a custom handler. Pass nil to
+// restore canned responses.
+func (s *Server) Handle(fn HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = fn
+}
+
+// InjectFault makes the next count requests, or all requests if count <= 0,
+// fail with the given fault. PING requests are not affected so clients can
+// still connect.
+func (s *Server) InjectFault(f Fault, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fault = f
+	s.faultCount = count
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetProtocol sets the protocol version the server answers PING with, to
+// imitate older spamd releases.
+func (s *Server) SetProtocol(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocol = version
+}
+
+// Requests returns the requests received so far, excluding PING.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// ClearRequests forgets the requests received so far.
+func (s *Server) ClearRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// Close stops the server and waits for in-flight connections to finish.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handleConn(conn)
+		}()
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	req, err := readRequest(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+
+	if req.Command == "PING" {
+		s.mu.Lock()
+		protocol := s.protocol
+		s.mu.Unlock()
+		fmt.Fprintf(conn, "SPAMD/%s 0 PONG\r\n", protocol)
+		return
+	}
+
+	resp, fault, latency := s.dispatch(req)
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	switch fault {
+	case FaultDrop:
+		return
+	case FaultUnavailable:
+		fmt.Fprintf(conn, "SPAMD/1.5 69 EX_UNAVAILABLE\r\n\r\n")
+		return
+	case FaultGarbage:
+		fmt.Fprintf(conn, "GARBAGE\r\nSpam: maybe ; lots\r\n\r\n")
+		return
+	case FaultTruncate:
+		fmt.Fprintf(conn, "SPAMD/1.5 0 EX_OK\r\n")
+		return
+	}
+
+	io.WriteString(conn, formatResponse(req, resp))
+}
+
+// dispatch records the request and selects its response and fault. A
+// handler runs without the lock held, so a handler that blocks does not
+// hold up other connections.
+func (s *Server) dispatch(req *Request) (Response, Fault, time.Duration) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+
+	fault := s.fault
+	if fault != FaultNone && s.faultCount > 0 {
+		s.faultCount--
+		if s.faultCount == 0 {
+			s.fault = FaultNone
+		}
+	}
+	handler, latency := s.handler, s.latency
+	resp, ok := s.responses[req.Command]
+	if !ok {
+		resp = s.responses[""]
+	}
+	s.mu.Unlock()
+
+	if handler != nil {
+		return handler(req), fault, latency
+	}
+	return resp, fault, latency
+}
+
+func readRequest(r *bufio.Reader) (*Request, error) {
+	tp := textproto.NewReader(r)
+
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	command, version, _ := strings.Cut(line, " ")
+
+	headers, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	req := &Request{
+		Command: strings.ToUpper(command),
+		Version: version,
+		Headers: headers,
+	}
+
+	if cl := headers.Get("Content-Length"); cl != "" {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid Content-length %q", cl)
+		}
+		req.Body = make([]byte, n)
+		if _, err := io.ReadFull(r, req.Body); err != nil {
+			return nil, err
+		}
+	}
+	if compressed(req) {
+		zr, err := zlib.NewReader(bytes.NewReader(req.Body))
+		if err != nil {
+			return nil, err
+		}
+		if req.Body, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func compressed(req *Request) bool {
+	return strings.EqualFold(req.Headers.Get("Compress"), "zlib")
+}
+
+// formatResponse renders resp in spamd wire format as the reply to req.
+func formatResponse(req *Request, resp Response) string {
+	command := req.Command
+	code, message := resp.Code, resp.Message
+	if message == "" {
+		message = "EX_OK"
+	}
+	threshold := resp.Threshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+
+	body := resp.Body
+	if body == "" {
+		switch command {
+		case "REPORT":
+			body = formatReport(resp, threshold)
+		case "SYMBOLS":
+			names := make([]string, len(resp.Rules))
+			for i, rule := range resp.Rules {
+				names[i] = rule.Name
+			}
+			body = strings.Join(names, ",") + "\r\n"
+		case "PROCESS":
+			body = formatSpamHeaders(resp, threshold) + string(req.Body)
+		case "HEADERS":
+			header, _, _ := strings.Cut(string(req.Body), "\r\n\r\n")
+			body = formatSpamHeaders(resp, threshold) + header + "\r\n\r\n"
+		}
+	}
+	compress := compressed(req) && body != ""
+	if compress {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write([]byte(body))
+		zw.Close()
+		body = b.String()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SPAMD/1.1 %d %s\r\n", code, message)
+	if code == 0 && command != "TELL" {
+		spam := "False"
+		if resp.Spam {
+			spam = "True"
+		}
+		fmt.Fprintf(&b, "Spam: %s ; %.1f / %.1f\r\n", spam, resp.Score, threshold)
+	}
+	for name, value := range resp.Headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	if compress {
+		b.WriteString("Compress: zlib\r\n")
+	}
+	fmt.Fprintf(&b, "Content-length: %d\r\n\r\n", len(body))
+	b.WriteString(body)
+	return b.String()
+}
+
+// formatSpamHeaders renders the X-Spam-* headers SpamAssassin adds with its
+// default add_header settings and report_safe 0.
+func formatSpamHeaders(resp Response, threshold float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "X-Spam-Checker-Version: SpamAssassin %s (2024-03-26) on spamdtest\r\n", Version)
+	verdict := "No"
+	if resp.Spam {
+		verdict = "Yes"
+		b.WriteString("X-Spam-Flag: YES\r\n")
+	}
+	fmt.Fprintf(&b, "X-Spam-Level: %s\r\n", strings.Repeat("*", max(int(resp.Score), 0)))
+	tests := make([]string, len(resp.Rules))
+	for i, rule := range resp.Rules {
+		tests[i] = rule.Name
+	}
+	if len(tests) == 0 {
+		tests = []string{"none"}
+	}
+	autolearn, force := "no", "no"
+	if resp.Autolearn != "" {
+		autolearn = resp.Autolearn
+	}
+	if resp.AutolearnForce {
+		force = "yes"
+	}
+	fmt.Fprintf(&b, "X-Spam-Status: %s, score=%.1f required=%.1f tests=%s\r\n\tautolearn=%s autolearn_force=%s version=%s\r\n",
+		verdict, resp.Score, threshold, strings.Join(tests, ",\r\n\t"), autolearn, force, Version)
+	if resp.Spam && len(resp.Rules) > 0 {
+		b.WriteString("X-Spam-Report: \r\n")
+		for _, rule := range resp.Rules {
+			fmt.Fprintf(&b, "\t* %4.1f %s %s\r\n", rule.Score, rule.Name, rule.Description)
+		}
+	}
+	return b.String()
+}
+
+func formatReport(resp Response, threshold float64) string {
+	var b strings.Builder
+	b.WriteString("Spam detection software, running on the system \"spamdtest\", has\r\n")
+	if resp.Spam {
+		b.WriteString("identified this incoming email as possible spam.\r\n\r\n")
+	} else {
+		b.WriteString("NOT identified this incoming email as spam.\r\n\r\n")
+	}
+	fmt.Fprintf(&b, "Content analysis details:   (%.1f points, %.1f required)\r\n\r\n", resp.Score, threshold)
+	b.WriteString(" pts rule name              description\r\n")
+	b.WriteString("---- ---------------------- --------------------------------------------------\r\n")
+	for _, rule := range resp.Rules {
+		fmt.Fprintf(&b, "%4.1f %-22s %s\r\n", rule.Score, rule.Name, rule.Description)
+	}
+	return b.String()
+}
@@ -0,0 +1,246 @@
+package spf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// delimiters are the characters a macro may split its value on.
+const delimiters = ".-+,/_="
+
+// checkMacroString validates the syntax of a macro-string without
+// expanding it, so malformed records are rejected before evaluation.
+func checkMacroString(s string) error {
+	_, err := expandMacros(s, false, func(byte) (string, error) { return "", nil })
+	return err
+}
+
+// expand expands the macros in s for the current domain. The c, r and t
+// macros are only allowed in explanation strings.
+func (e *evaluator) expand(ctx context.Context, s, domain string, explanation bool) (string, error) {
+	out, err := expandMacros(s, explanation, func(letter byte) (string, error) {
+		return e.macroValue(ctx, letter, domain, explanation)
+	})
+	if err != nil {
+		return "", permError("%s: %v", s, err)
+	}
+	if explanation {
+		return out, nil
+	}
+	return truncateDomain(out), nil
+}
+
+// expandMacros expands s, calling value for each macro letter.
+func expandMacros(s string, explanation bool, value func(letter byte) (string, error)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			if !explanation && (c < 0x21 || c > 0x7e) {
+				return "", fmt.Errorf("invalid character %q", c)
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", errors.New("incomplete macro")
+		}
+		switch s[i] {
+		case '%':
+			b.WriteByte('%')
+		case '_':
+			b.WriteByte(' ')
+		case '-':
+			b.WriteString("%20")
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", errors.New("unterminated macro")
+			}
+			expanded, err := expandMacro(s[i+1:i+end], explanation, value)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(expanded)
+			i += end
+		default:
+			return "", fmt.Errorf("invalid macro %%%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// expandMacro expands the body of a %{...} macro: a letter, an optional
+// number of parts to keep, an optional "r" to reverse, and optional
+// delimiters.
+func expandMacro(body string, explanation bool, value func(letter byte) (string, error)) (string, error) {
+	if body == "" {
+		return "", errors.New("empty macro")
+	}
+	letter := body[0]
+	lower := letter | 0x20
+	switch lower {
+	case 's', 'l', 'o', 'd', 'i', 'p', 'v', 'h':
+	case 'c', 'r', 't':
+		if !explanation {
+			return "", fmt.Errorf("macro %%{%c} is only allowed in explanations", letter)
+		}
+	default:
+		return "", fmt.Errorf("unknown macro letter %q", letter)
+	}
+
+	rest := body[1:]
+	digits := 0
+	for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+		digits++
+	}
+	keep := 0
+	if digits > 0 {
+		n, err := strconv.Atoi(rest[:digits])
+		if err != nil || n == 0 {
+			return "", fmt.Errorf("invalid macro transformer %q", rest[:digits])
+		}
+		keep = n
+	}
+	rest = rest[digits:]
+	reverse := false
+	if rest != "" && (rest[0] == 'r' || rest[0] == 'R') {
+		reverse = true
+		rest = rest[1:]
+	}
+	for i := 0; i < len(rest); i++ {
+		if strings.IndexByte(delimiters, rest[i]) < 0 {
+			return "", fmt.Errorf("invalid macro delimiter %q", rest[i])
+		}
+	}
+	delims := rest
+	if delims == "" {
+		delims = "."
+	}
+
+	v, err := value(lower)
+	if err != nil {
+		return "", err
+	}
+
+	if keep > 0 || reverse || delims != "." {
+		parts := strings.FieldsFunc(v, func(r rune) bool { return strings.ContainsRune(delims, r) })
+		if reverse {
+			for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+				parts[i], parts[j] = parts[j], parts[i]
+			}
+		}
+		if keep > 0 && keep < len(parts) {
+			parts = parts[len(parts)-keep:]
+		}
+		v = strings.Join(parts, ".")
+	}
+
+	if letter != lower {
+		v = urlEscape(v)
+	}
+	return v, nil
+}
+
+// macroValue returns the value of a macro letter.
+func (e *evaluator) macroValue(ctx context.Context, letter byte, domain string, explanation bool) (string, error) {
+	at := strings.LastIndex(e.sender, "@")
+	switch letter {
+	case 's':
+		return e.sender, nil
+	case 'l':
+		return e.sender[:at], nil
+	case 'o':
+		return e.sender[at+1:], nil
+	case 'd':
+		return domain, nil
+	case 'i':
+		return dottedIP(e.ip), nil
+	case 'p':
+		return e.validatedName(ctx, domain, explanation)
+	case 'v':
+		if e.ip.To4() != nil {
+			return "in-addr", nil
+		}
+		return "ip6", nil
+	case 'h':
+		return e.helo, nil
+	case 'c':
+		return e.ip.String(), nil
+	case 'r':
+		return "unknown", nil
+	case 't':
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	}
+	return "", fmt.Errorf("unknown macro letter %q", letter)
+}
+
+// validatedName returns the name for the %{p} macro: a validated PTR name
+// of the client IP, preferring domain or one of its subdomains, or
+// "unknown". Outside explanations the lookup counts towards the limit.
+func (e *evaluator) validatedName(ctx context.Context, domain string, explanation bool) (string, error) {
+	if !explanation {
+		if err := e.count(); err != nil {
+			return "", err
+		}
+	}
+	names := e.validatedNames(ctx)
+	for _, name := range names {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return name, nil
+		}
+	}
+	if len(names) > 0 {
+		return names[0], nil
+	}
+	return "unknown", nil
+}
+
+// dottedIP returns ip for the %{i} macro: dotted-quad for IPv4 and
+// dot-separated nibbles for IPv6.
+func dottedIP(ip []byte) string {
+	if len(ip) == 4 {
+		return fmt.Sprintf("%d.%d.%d.%d", ip[0], ip[1], ip[2], ip[3])
+	}
+	const hex = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for _, b := range ip {
+		nibbles = append(nibbles, string(hex[b>>4]), string(hex[b&0xf]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// urlEscape escapes every character outside the RFC 3986 unreserved set,
+// as required for upper-case macro letters.
+func urlEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// truncateDomain drops leading labels until the expanded domain fits in
+// 253 characters.
+func truncateDomain(domain string) string {
+	domain = strings.TrimSuffix(domain, ".")
+	for len(domain) > maxDomainLen {
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	return domain
+}
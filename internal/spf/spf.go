@@ -0,0 +1,651 @@
+// Package spf evaluates Sender Policy Framework records as specified by
+// RFC 7208.
+//
+// Check implements the check_host() function: it fetches the SPF record of
+// a domain and evaluates its mechanisms against the connecting IP address,
+// following include and redirect terms and expanding macros. DNS processing
+// limits (10 lookups, 2 void lookups, 10 MX or PTR names) are enforced, so
+// a hostile record cannot make the server issue unbounded queries.
+package spf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"spamassassin-mcp/internal/resolver"
+)
+
+// Result is an SPF verdict.
+type Result string
+
+// Results defined by RFC 7208, section 2.6.
+const (
+	None      Result = "none"
+	Neutral   Result = "neutral"
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	SoftFail  Result = "softfail"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+const (
+	maxLookups     = 10
+	maxVoidLookups = 2
+	maxNames       = 10
+	maxDomainLen   = 253
+)
+
+// Resolver is the subset of *net.Resolver used for SPF lookups.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Query holds the inputs of an SPF check.
+type Query struct {
+	// IP is the address of the connecting SMTP client.
+	IP net.IP
+
+	// Domain is the domain whose policy is checked. It defaults to the
+	// domain of Sender.
+	Domain string
+
+	// Sender is the MAIL FROM address. It defaults to postmaster@Domain.
+	Sender string
+
+	// Helo is the HELO/EHLO name, used only for the %{h} macro.
+	Helo string
+}
+
+// Evaluation is the outcome of an SPF check.
+type Evaluation struct {
+	Result Result `json:"result"`
+
+	// Mechanism is the term that determined the result, as written in the
+	// record, and MatchedDomain the domain whose record contained it. Both
+	// are empty when no mechanism matched.
+	Mechanism     string `json:"mechanism,omitempty"`
+	MatchedDomain string `json:"matched_domain,omitempty"`
+
+	Domain      string `json:"domain"`
+	Record      string `json:"record,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+	Error       string `json:"error,omitempty"`
+	DNSLookups  int    `json:"dns_lookups"`
+}
+
+// Check evaluates the SPF policy for q. DNS failures and malformed records
+// are reported as temperror and permerror results rather than errors.
+func Check(ctx context.Context, r Resolver, q Query) *Evaluation {
+	sender := q.Sender
+	domain := strings.ToLower(strings.TrimSuffix(q.Domain, "."))
+	at := strings.LastIndex(sender, "@")
+	if domain == "" && at >= 0 {
+		domain = strings.ToLower(sender[at+1:])
+	}
+	switch {
+	case sender == "":
+		sender = "postmaster@" + domain
+	case at == 0:
+		sender = "postmaster" + sender
+	case at < 0:
+		sender = "postmaster@" + sender
+	}
+
+	ip := q.IP
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	helo := q.Helo
+	if helo == "" {
+		helo = "unknown"
+	}
+
+	e := &evaluator{resolver: r, ip: ip, sender: sender, helo: helo}
+	eval := &Evaluation{Domain: domain}
+	res, err := e.checkHost(ctx, domain, eval)
+	eval.Result = res
+	eval.DNSLookups = e.lookups
+	if err != nil {
+		eval.Error = err.Error()
+	}
+	return eval
+}
+
+// evaluator holds the state shared by every check_host() invocation of a
+// single check, including the lookup counters.
+type evaluator struct {
+	resolver Resolver
+	ip       net.IP
+	sender   string
+	helo     string
+
+	lookups     int
+	voidLookups int
+}
+
+// checkHost evaluates the record of domain. Details of the matching term are
+// written to eval, which is also where the top-level record is recorded.
+func (e *evaluator) checkHost(ctx context.Context, domain string, eval *Evaluation) (Result, error) {
+	if !validDomain(domain) {
+		return None, fmt.Errorf("invalid domain %q", domain)
+	}
+
+	record, res, err := e.fetchRecord(ctx, domain)
+	if res != "" {
+		return res, err
+	}
+	if eval.Record == "" {
+		eval.Record = record
+	}
+
+	terms, redirect, exp, err := parseRecord(record)
+	if err != nil {
+		return PermError, fmt.Errorf("%s: %w", domain, err)
+	}
+
+	for _, t := range terms {
+		matched, err := e.match(ctx, domain, t)
+		if err != nil {
+			return errorResult(err), err
+		}
+		if !matched {
+			continue
+		}
+		eval.Mechanism = t.text
+		eval.MatchedDomain = domain
+		res := t.result()
+		if res == Fail && exp != "" {
+			eval.Explanation = e.explain(ctx, domain, exp)
+		}
+		return res, nil
+	}
+
+	if redirect != "" {
+		if err := e.count(); err != nil {
+			return PermError, err
+		}
+		target, err := e.expand(ctx, redirect, domain, false)
+		if err != nil {
+			return PermError, err
+		}
+		res, err := e.checkHost(ctx, target, eval)
+		if res == None {
+			return PermError, fmt.Errorf("redirect target %s has no SPF record", target)
+		}
+		return res, err
+	}
+	return Neutral, nil
+}
+
+// fetchRecord returns the SPF record of domain. A non-empty result means
+// the check ends there: none when there is no record, temperror or
+// permerror when it cannot be determined.
+func (e *evaluator) fetchRecord(ctx context.Context, domain string) (string, Result, error) {
+	txts, err := e.resolver.LookupTXT(ctx, resolver.FQDN(domain))
+	if err != nil {
+		if resolver.NotFound(err) {
+			return "", None, nil
+		}
+		return "", TempError, fmt.Errorf("TXT lookup for %s failed: %w", domain, err)
+	}
+
+	var records []string
+	for _, txt := range txts {
+		if v := strings.ToLower(txt); v == "v=spf1" || strings.HasPrefix(v, "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", None, nil
+	case 1:
+		return records[0], "", nil
+	default:
+		return "", PermError, fmt.Errorf("%s publishes %d SPF records", domain, len(records))
+	}
+}
+
+// match reports whether mechanism t matches the client IP.
+func (e *evaluator) match(ctx context.Context, domain string, t term) (bool, error) {
+	switch t.name {
+	case "all":
+		return true, nil
+
+	case "include":
+		if err := e.count(); err != nil {
+			return false, err
+		}
+		target, err := e.expand(ctx, t.domain, domain, false)
+		if err != nil {
+			return false, err
+		}
+		var nested Evaluation
+		switch res, err := e.checkHost(ctx, target, &nested); res {
+		case Pass:
+			return true, nil
+		case Fail, SoftFail, Neutral:
+			return false, nil
+		case None:
+			return false, permError("included domain %s has no SPF record", target)
+		default:
+			return false, &evalError{result: res, msg: err.Error()}
+		}
+
+	case "a", "mx", "exists", "ptr":
+		if err := e.count(); err != nil {
+			return false, err
+		}
+		target := domain
+		if t.domain != "" {
+			var err error
+			if target, err = e.expand(ctx, t.domain, domain, false); err != nil {
+				return false, err
+			}
+		}
+		switch t.name {
+		case "a":
+			return e.matchA(ctx, target, t)
+		case "mx":
+			return e.matchMX(ctx, target, t)
+		case "exists":
+			ips, err := e.lookupIP(ctx, "ip4", target)
+			return len(ips) > 0, err
+		default:
+			return e.matchPTR(ctx, target), nil
+		}
+
+	case "ip4", "ip6":
+		return t.network.Contains(e.ip), nil
+	}
+	return false, permError("unknown mechanism %q", t.name)
+}
+
+func (e *evaluator) matchA(ctx context.Context, host string, t term) (bool, error) {
+	ips, err := e.lookupIP(ctx, e.network(), host)
+	if err != nil {
+		return false, err
+	}
+	return t.containsAny(e.ip, ips), nil
+}
+
+func (e *evaluator) matchMX(ctx context.Context, domain string, t term) (bool, error) {
+	mxs, err := e.resolver.LookupMX(ctx, resolver.FQDN(domain))
+	if err != nil && !resolver.NotFound(err) {
+		return false, tempError("MX lookup for %s failed: %v", domain, err)
+	}
+	if len(mxs) == 0 {
+		return false, e.void()
+	}
+	if len(mxs) > maxNames {
+		return false, permError("%s has more than %d MX records", domain, maxNames)
+	}
+	for _, mx := range mxs {
+		ips, err := e.resolver.LookupIP(ctx, e.network(), resolver.FQDN(mx.Host))
+		if err != nil && !resolver.NotFound(err) {
+			return false, tempError("address lookup for %s failed: %v", mx.Host, err)
+		}
+		if t.containsAny(e.ip, ips) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchPTR reports whether a validated name of the client IP is domain or
+// one of its subdomains. DNS errors are treated as no match.
+func (e *evaluator) matchPTR(ctx context.Context, domain string) bool {
+	for _, name := range e.validatedNames(ctx) {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatedNames returns the PTR names of the client IP whose addresses
+// include the client IP, lower-cased and without the trailing dot.
+func (e *evaluator) validatedNames(ctx context.Context) []string {
+	names, err := e.resolver.LookupAddr(ctx, e.ip.String())
+	if err != nil || len(names) == 0 {
+		if err == nil || resolver.NotFound(err) {
+			e.voidLookups++
+		}
+		return nil
+	}
+	if len(names) > maxNames {
+		names = names[:maxNames]
+	}
+
+	var validated []string
+	for _, name := range names {
+		ips, err := e.resolver.LookupIP(ctx, e.network(), resolver.FQDN(name))
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.Equal(e.ip) {
+				validated = append(validated, strings.ToLower(strings.TrimSuffix(name, ".")))
+				break
+			}
+		}
+	}
+	return validated
+}
+
+// lookupIP resolves host, counting empty answers as void lookups.
+func (e *evaluator) lookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	ips, err := e.resolver.LookupIP(ctx, network, resolver.FQDN(host))
+	if err != nil && !resolver.NotFound(err) {
+		return nil, tempError("address lookup for %s failed: %v", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, e.void()
+	}
+	return ips, nil
+}
+
+// explain returns the expanded explanation published at the exp domain, or
+// "" when it cannot be retrieved. Explanation lookups do not count towards
+// the DNS lookup limit.
+func (e *evaluator) explain(ctx context.Context, domain, exp string) string {
+	target, err := e.expand(ctx, exp, domain, false)
+	if err != nil {
+		return ""
+	}
+	txts, err := e.resolver.LookupTXT(ctx, resolver.FQDN(target))
+	if err != nil || len(txts) != 1 {
+		return ""
+	}
+	explanation, err := e.expand(ctx, txts[0], domain, true)
+	if err != nil {
+		return ""
+	}
+	return explanation
+}
+
+// count records a DNS-querying term against the lookup limit.
+func (e *evaluator) count() error {
+	e.lookups++
+	if e.lookups > maxLookups {
+		return permError("more than %d DNS lookups", maxLookups)
+	}
+	return nil
+}
+
+// void records a lookup that returned no answers.
+func (e *evaluator) void() error {
+	e.voidLookups++
+	if e.voidLookups > maxVoidLookups {
+		return permError("more than %d void DNS lookups", maxVoidLookups)
+	}
+	return nil
+}
+
+// network returns the LookupIP network matching the client address family.
+func (e *evaluator) network() string {
+	if e.ip.To4() != nil {
+		return "ip4"
+	}
+	return "ip6"
+}
+
+// evalError is an error that determines the SPF result.
+type evalError struct {
+	result Result
+	msg    string
+}
+
+func (e *evalError) Error() string { return e.msg }
+
+func permError(format string, args ...any) error {
+	return &evalError{result: PermError, msg: fmt.Sprintf(format, args...)}
+}
+
+func tempError(format string, args ...any) error {
+	return &evalError{result: TempError, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorResult returns the result an evaluation error maps to.
+func errorResult(err error) Result {
+	var e *evalError
+	if errors.As(err, &e) {
+		return e.result
+	}
+	return TempError
+}
+
+// term is a parsed mechanism.
+type term struct {
+	text      string
+	qualifier byte
+	name      string
+	domain    string
+	network   *net.IPNet // ip4 and ip6
+	cidr4     int        // a and mx
+	cidr6     int
+}
+
+// result returns the result of a match of t.
+func (t term) result() Result {
+	switch t.qualifier {
+	case '-':
+		return Fail
+	case '~':
+		return SoftFail
+	case '?':
+		return Neutral
+	default:
+		return Pass
+	}
+}
+
+// containsAny reports whether ip lies within the dual-cidr range of any of
+// addrs.
+func (t term) containsAny(ip net.IP, addrs []net.IP) bool {
+	bits, size := t.cidr6, 128
+	if ip.To4() != nil {
+		bits, size = t.cidr4, 32
+	}
+	mask := net.CIDRMask(bits, size)
+	for _, addr := range addrs {
+		if a4 := addr.To4(); a4 != nil {
+			addr = a4
+		}
+		if len(addr) != len(ip) {
+			continue
+		}
+		if addr.Mask(mask).Equal(ip.Mask(mask)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRecord splits an SPF record into its mechanisms and the redirect and
+// exp modifiers. Any syntax error makes the whole record invalid, even when
+// an earlier mechanism would have matched.
+func parseRecord(record string) (terms []term, redirect, exp string, err error) {
+	fields := strings.Fields(record)
+	seen := make(map[string]bool)
+	for _, field := range fields[1:] {
+		if name, value, ok := modifier(field); ok {
+			if name == "redirect" || name == "exp" {
+				if seen[name] {
+					return nil, "", "", fmt.Errorf("duplicate %s modifier", name)
+				}
+				seen[name] = true
+				if err := checkMacroString(value); err != nil {
+					return nil, "", "", fmt.Errorf("%s: %w", field, err)
+				}
+				if name == "redirect" {
+					redirect = value
+				} else {
+					exp = value
+				}
+			}
+			continue
+		}
+		t, err := parseMechanism(field)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("%s: %w", field, err)
+		}
+		terms = append(terms, t)
+	}
+
+	// redirect is ignored when the record contains an all mechanism.
+	for _, t := range terms {
+		if t.name == "all" {
+			redirect = ""
+		}
+	}
+	return terms, redirect, exp, nil
+}
+
+// modifier splits a name=value term. Mechanisms never contain "=" before a
+// ":" or "/".
+func modifier(field string) (name, value string, ok bool) {
+	i := strings.IndexByte(field, '=')
+	if i <= 0 || strings.ContainsAny(field[:i], ":/") {
+		return "", "", false
+	}
+	name = strings.ToLower(field[:i])
+	for j, c := range name {
+		if !(c >= 'a' && c <= 'z' || j > 0 && (c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')) {
+			return "", "", false
+		}
+	}
+	return name, field[i+1:], true
+}
+
+func parseMechanism(field string) (term, error) {
+	t := term{text: field, qualifier: '+', cidr4: 32, cidr6: 128}
+	rest := field
+	if strings.IndexByte("+-~?", rest[0]) >= 0 {
+		t.qualifier = rest[0]
+		rest = rest[1:]
+	}
+
+	name, arg := rest, ""
+	if i := strings.IndexAny(rest, ":/"); i >= 0 {
+		name, arg = rest[:i], rest[i:]
+	}
+	t.name = strings.ToLower(name)
+
+	switch t.name {
+	case "all":
+		if arg != "" {
+			return t, errors.New("all takes no arguments")
+		}
+
+	case "include", "exists":
+		if !strings.HasPrefix(arg, ":") || len(arg) == 1 {
+			return t, fmt.Errorf("%s requires a domain", t.name)
+		}
+		t.domain = arg[1:]
+		if err := checkMacroString(t.domain); err != nil {
+			return t, err
+		}
+
+	case "a", "mx", "ptr":
+		spec := arg
+		if t.name != "ptr" {
+			var err error
+			if spec, t.cidr4, t.cidr6, err = splitDualCIDR(arg); err != nil {
+				return t, err
+			}
+		}
+		if spec != "" {
+			if !strings.HasPrefix(spec, ":") || len(spec) == 1 {
+				return t, errors.New("invalid domain")
+			}
+			t.domain = spec[1:]
+			if err := checkMacroString(t.domain); err != nil {
+				return t, err
+			}
+		}
+
+	case "ip4", "ip6":
+		if !strings.HasPrefix(arg, ":") {
+			return t, fmt.Errorf("%s requires an address", t.name)
+		}
+		addr, bits := arg[1:], ""
+		if i := strings.IndexByte(addr, '/'); i >= 0 {
+			addr, bits = addr[:i], addr[i+1:]
+		}
+		ip := net.ParseIP(addr)
+		size := 32
+		if t.name == "ip6" {
+			size = 128
+		}
+		if ip == nil || (t.name == "ip4") != (ip.To4() != nil && !strings.Contains(addr, ":")) {
+			return t, fmt.Errorf("invalid address %q", addr)
+		}
+		prefix := size
+		if bits != "" {
+			n, err := parseCIDR(bits, size)
+			if err != nil {
+				return t, err
+			}
+			prefix = n
+		}
+		if t.name == "ip4" {
+			ip = ip.To4()
+		}
+		t.network = &net.IPNet{IP: ip.Mask(net.CIDRMask(prefix, size)), Mask: net.CIDRMask(prefix, size)}
+
+	default:
+		return t, fmt.Errorf("unknown mechanism %q", name)
+	}
+	return t, nil
+}
+
+// splitDualCIDR separates the optional "/ip4-cidr" and "//ip6-cidr" suffixes
+// of an a or mx argument.
+func splitDualCIDR(arg string) (spec string, cidr4, cidr6 int, err error) {
+	cidr4, cidr6 = 32, 128
+	spec = arg
+	if i := strings.Index(spec, "//"); i >= 0 {
+		if cidr6, err = parseCIDR(spec[i+2:], 128); err != nil {
+			return "", 0, 0, err
+		}
+		spec = spec[:i]
+	}
+	if i := strings.LastIndexByte(spec, '/'); i >= 0 {
+		if cidr4, err = parseCIDR(spec[i+1:], 32); err != nil {
+			return "", 0, 0, err
+		}
+		spec = spec[:i]
+	}
+	return spec, cidr4, cidr6, nil
+}
+
+func parseCIDR(s string, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > max || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("invalid prefix length %q", s)
+	}
+	return n, nil
+}
+
+// validDomain reports whether domain is a syntactically valid, fully
+// qualified domain name.
+func validDomain(domain string) bool {
+	domain = strings.TrimSuffix(domain, ".")
+	if len(domain) == 0 || len(domain) > maxDomainLen || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
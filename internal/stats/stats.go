@@ -0,0 +1,242 @@
+// Package stats collects runtime analytics about the scans the server
+// performs: volumes, verdicts, scores, latency and the rules hit most often.
+//
+// Counters live in memory. When a path is configured they are also saved to
+// a JSON file, periodically and on Close, and restored by Open, so totals
+// survive restarts.
+//
+// Security considerations:
+//   - Only aggregate counts are kept; message content, senders and clients
+//     are never recorded
+//   - The state file is written atomically with owner-only permissions
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+const (
+	// topRules is the number of rules reported by Snapshot.
+	topRules = 20
+
+	// latencySamples is the number of most recent scan latencies the p95 is
+	// computed over.
+	latencySamples = 1000
+)
+
+// Snapshot is a point-in-time view of the collected statistics.
+type Snapshot struct {
+	Since               time.Time  `json:"since"`
+	MessagesScanned     uint64     `json:"messages_scanned"`
+	SpamDetected        uint64     `json:"spam_detected"`
+	AverageScore        float64    `json:"average_score"`
+	P95LatencyMS        float64    `json:"p95_latency_ms"`
+	RateLimitRejections uint64     `json:"rate_limit_rejections"`
+	TopRules            []RuleHits `json:"top_rules"`
+}
+
+// RuleHits is the number of scans that matched a rule.
+type RuleHits struct {
+	Rule string `json:"rule"`
+	Hits uint64 `json:"hits"`
+}
+
+// state is the persisted form of the counters.
+type state struct {
+	Since      time.Time         `json:"since"`
+	Scanned    uint64            `json:"scanned"`
+	Spam       uint64            `json:"spam"`
+	ScoreSum   float64           `json:"score_sum"`
+	Rejections uint64            `json:"rejections"`
+	Rules      map[string]uint64 `json:"rules"`
+	LatencyMS  []float64         `json:"latency_ms"`
+}
+
+// Collector accumulates statistics. It is safe for concurrent use.
+type Collector struct {
+	path string
+
+	mu    sync.Mutex
+	state state
+	next  int // position in state.LatencyMS overwritten by the next sample
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a collector that keeps statistics in memory only.
+func New() *Collector {
+	return &Collector{state: state{Since: time.Now().UTC(), Rules: make(map[string]uint64)}}
+}
+
+// Open returns a collector for cfg. With an empty Path it is the same as
+// New; otherwise totals saved at cfg.Path by a previous run are restored and
+// saved again every cfg.FlushInterval and on Close.
+func Open(cfg config.StatsConfig) (*Collector, error) {
+	c := New()
+	if cfg.Path == "" {
+		return c, nil
+	}
+	c.path = cfg.Path
+
+	data, err := os.ReadFile(cfg.Path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read stats file: %w", err)
+	default:
+		var saved state
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse stats file %s: %w", cfg.Path, err)
+		}
+		if saved.Rules == nil {
+			saved.Rules = make(map[string]uint64)
+		}
+		if len(saved.LatencyMS) > latencySamples {
+			saved.LatencyMS = saved.LatencyMS[len(saved.LatencyMS)-latencySamples:]
+		}
+		c.state = saved
+		c.next = len(saved.LatencyMS) % latencySamples
+	}
+
+	if cfg.FlushInterval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.flush(cfg.FlushInterval)
+	}
+	return c, nil
+}
+
+// RecordScan counts a completed scan.
+func (c *Collector) RecordScan(score float64, spam bool, rules []string, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Scanned++
+	if spam {
+		c.state.Spam++
+	}
+	c.state.ScoreSum += score
+	for _, rule := range rules {
+		c.state.Rules[rule]++
+	}
+
+	ms := float64(latency) / float64(time.Millisecond)
+	if len(c.state.LatencyMS) < latencySamples {
+		c.state.LatencyMS = append(c.state.LatencyMS, ms)
+	} else {
+		c.state.LatencyMS[c.next] = ms
+	}
+	c.next = (c.next + 1) % latencySamples
+}
+
+// RecordRejection counts a request refused by a rate limit or quota.
+func (c *Collector) RecordRejection() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Rejections++
+}
+
+// Snapshot returns the current totals.
+func (c *Collector) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Snapshot{
+		Since:               c.state.Since,
+		MessagesScanned:     c.state.Scanned,
+		SpamDetected:        c.state.Spam,
+		RateLimitRejections: c.state.Rejections,
+		TopRules:            make([]RuleHits, 0, min(len(c.state.Rules), topRules)),
+	}
+	if c.state.Scanned > 0 {
+		s.AverageScore = c.state.ScoreSum / float64(c.state.Scanned)
+	}
+	if n := len(c.state.LatencyMS); n > 0 {
+		sorted := slices.Sorted(slices.Values(c.state.LatencyMS))
+		s.P95LatencyMS = sorted[(n*95+99)/100-1]
+	}
+
+	rules := make([]RuleHits, 0, len(c.state.Rules))
+	for rule, hits := range c.state.Rules {
+		rules = append(rules, RuleHits{Rule: rule, Hits: hits})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Hits != rules[j].Hits {
+			return rules[i].Hits > rules[j].Hits
+		}
+		return rules[i].Rule < rules[j].Rule
+	})
+	s.TopRules = append(s.TopRules, rules[:min(len(rules), topRules)]...)
+	return s
+}
+
+// Save writes the totals to the stats file, if one is configured.
+func (c *Collector) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.Marshal(c.state)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	return nil
+}
+
+// Close stops periodic saving and saves the totals a final time.
+func (c *Collector) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+	return c.Save()
+}
+
+func (c *Collector) flush(interval time.Duration) {
+	defer close(c.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Save(); err != nil {
+				logrus.WithError(err).Error("Failed to save statistics")
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
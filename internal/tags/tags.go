@@ -0,0 +1,90 @@
+// Package tags applies operator-defined tagging rules to scan results.
+//
+// Tags let an organization encode its own triage taxonomy (for example
+// "finance-phish" or "exec-impersonation") in the server configuration, so
+// results carry consistent labels regardless of which client requested them.
+package tags
+
+import (
+	"sort"
+	"strings"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// Tagger evaluates a fixed set of tag rules.
+type Tagger struct {
+	rules []rule
+}
+
+type rule struct {
+	tag      string
+	ruleHits map[string]bool
+	minScore *float64
+}
+
+// NewTagger compiles the configured tag rules. SpamAssassin rule names are
+// matched case-insensitively.
+func NewTagger(cfg []config.TagRule) *Tagger {
+	t := &Tagger{rules: make([]rule, 0, len(cfg))}
+	for _, c := range cfg {
+		r := rule{
+			tag:      c.Tag,
+			ruleHits: make(map[string]bool, len(c.Rules)),
+			minScore: c.MinScore,
+		}
+		for _, name := range c.Rules {
+			r.ruleHits[strings.ToUpper(strings.TrimSpace(name))] = true
+		}
+		t.rules = append(t.rules, r)
+	}
+	return t
+}
+
+// MatchesRules reports whether any tag rule matches on rule hits, which
+// then need to be known for every result.
+func (t *Tagger) MatchesRules() bool {
+	for _, r := range t.rules {
+		if len(r.ruleHits) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags returns the sorted, de-duplicated tags matching a result with the
+// given score and triggered rule names.
+func (t *Tagger) Tags(score float64, rulesHit []string) []string {
+	if len(t.rules) == 0 {
+		return nil
+	}
+
+	hits := make(map[string]bool, len(rulesHit))
+	for _, name := range rulesHit {
+		hits[strings.ToUpper(name)] = true
+	}
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, r := range t.rules {
+		if seen[r.tag] || !r.matches(score, hits) {
+			continue
+		}
+		seen[r.tag] = true
+		tags = append(tags, r.tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (r rule) matches(score float64, hits map[string]bool) bool {
+	if r.minScore != nil && score >= *r.minScore {
+		return true
+	}
+	for name := range r.ruleHits {
+		if hits[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,394 @@
+// Package taxii publishes the indicators of spam messages to a TAXII 2.1
+// collection as STIX 2.1 indicator objects.
+//
+// The Publisher accumulates the URLs, link domains and attachment hashes of
+// spam verdicts and periodically adds them to the collection. Each
+// indicator has a confidence score that grows with the number of distinct
+// spam messages it was seen in and with how far those messages scored above
+// the threshold; indicators are published once the score reaches the
+// configured minimum. Indicator IDs are derived from their patterns, so a
+// rising confidence is published as a new version of the same object
+// rather than as a duplicate.
+//
+// Sender addresses and domains are not published: they are often forged,
+// and would name the impersonated party rather than the attacker.
+package taxii
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ioc"
+)
+
+const (
+	// mediaType is the TAXII 2.1 content type.
+	mediaType = "application/taxii+json;version=2.1"
+	// batchSize bounds the objects sent in one request.
+	batchSize = 100
+	// maxSightings bounds the distinct messages counted per indicator; the
+	// confidence no longer grows beyond it.
+	maxSightings = 10
+	// maxResponseSize bounds the responses read from the server.
+	maxResponseSize = 1 << 20
+)
+
+// namespace derives indicator IDs from patterns (the STIX 2.1 namespace for
+// deterministic identifiers).
+var namespace = uuid.MustParse("00abedb4-aa42-466c-9c01-fed23315a9b7")
+
+// Report summarizes one publishing run.
+type Report struct {
+	Sent      int
+	Succeeded int
+	Failed    int
+	Pending   int
+}
+
+// indicator is an observable accumulated from spam verdicts.
+type indicator struct {
+	id        string
+	name      string
+	pattern   string
+	firstSeen time.Time
+	messages  []string
+	maxRatio  float64
+	modified  time.Time
+	published int // confidence last published; 0 if never
+}
+
+// confidence scores the indicator from 0 to 100: 40 when seen in a message
+// scoring just over the threshold, 55 at 1.5 times and 70 at twice the
+// threshold, plus 10 for each further spam message it was seen in, up to 95.
+func (ind *indicator) confidence() int {
+	base := 40
+	switch {
+	case ind.maxRatio >= 2:
+		base = 70
+	case ind.maxRatio >= 1.5:
+		base = 55
+	}
+	return min(95, base+10*(len(ind.messages)-1))
+}
+
+// Publisher accumulates indicators and publishes them to a collection.
+type Publisher struct {
+	cfg        config.TAXIIConfig
+	objectsURL string
+	http       *http.Client
+
+	// publishing serializes Publish calls
+	publishing sync.Mutex
+
+	mu         sync.Mutex
+	indicators map[string]*indicator
+	warnedFull bool
+}
+
+// New returns a publisher for the collection in cfg, or nil when
+// cfg.APIRoot is empty.
+func New(cfg config.TAXIIConfig) (*Publisher, error) {
+	if cfg.APIRoot == "" {
+		return nil, nil
+	}
+	root, err := url.Parse(cfg.APIRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TAXII API root: %w", err)
+	}
+	root.Path = strings.TrimSuffix(root.Path, "/") + "/collections/" + url.PathEscape(cfg.CollectionID) + "/objects/"
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TAXII CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("TAXII CA file %s holds no certificates", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Publisher{
+		cfg:        cfg,
+		objectsURL: root.String(),
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// A redirect could carry the credentials elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		indicators: make(map[string]*indicator),
+	}, nil
+}
+
+// Observe accumulates the indicators of a spam message. messageHash
+// identifies the message, so a message scanned twice counts once. Observe
+// on a nil Publisher does nothing.
+func (p *Publisher) Observe(messageHash string, score, threshold float64, set *ioc.Set, seen time.Time) {
+	if p == nil {
+		return
+	}
+	ratio := 1.0
+	if threshold > 0 {
+		ratio = score / threshold
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	add := func(name, pattern, host string) {
+		if host != "" && p.excluded(host) {
+			return
+		}
+		ind, ok := p.indicators[pattern]
+		if !ok {
+			if len(p.indicators) >= p.cfg.MaxIndicators {
+				if !p.warnedFull {
+					p.warnedFull = true
+					logrus.WithField("max_indicators", p.cfg.MaxIndicators).Warn("TAXII indicator limit reached, ignoring new indicators")
+				}
+				return
+			}
+			ind = &indicator{
+				id:        "indicator--" + uuid.NewSHA1(namespace, []byte(pattern)).String(),
+				name:      name,
+				pattern:   pattern,
+				firstSeen: seen,
+			}
+			p.indicators[pattern] = ind
+		}
+		if !slices.Contains(ind.messages, messageHash) && len(ind.messages) < maxSightings {
+			ind.messages = append(ind.messages, messageHash)
+		}
+		ind.maxRatio = max(ind.maxRatio, ratio)
+	}
+
+	for _, u := range set.URLs {
+		host := ""
+		if parsed, err := url.Parse(u.Value); err == nil {
+			host = parsed.Hostname()
+		}
+		add("Spam URL "+u.Value, ioc.URLPattern(u.Value), host)
+	}
+	for _, domain := range set.Domains {
+		// Link domains only; sender domains are often forged
+		if slices.Contains(domain.Sources, ioc.SourceURL) {
+			add("Spam link domain "+domain.Value, ioc.DomainPattern(domain.Value), domain.Value)
+		}
+	}
+	for _, f := range set.Files {
+		name := "Spam attachment " + f.SHA256
+		if f.Name != "" {
+			name = "Spam attachment " + f.Name
+		}
+		add(name, ioc.FilePattern(f.SHA256, f.MD5), "")
+	}
+}
+
+// excluded reports whether host is, or is under, an excluded domain.
+func (p *Publisher) excluded(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, domain := range p.cfg.ExcludeDomains {
+		domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run publishes every configured interval until ctx is done.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.publish(ctx)
+		}
+	}
+}
+
+// Flush publishes what accumulated since the last run, waiting at most the
+// configured timeout, so indicators are not lost at shutdown. Flush on a nil
+// Publisher does nothing.
+func (p *Publisher) Flush() {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	p.publish(ctx)
+}
+
+func (p *Publisher) publish(ctx context.Context) {
+	report, err := p.Publish(ctx)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to publish indicators to TAXII collection")
+	}
+	if report.Sent > 0 {
+		logrus.WithFields(logrus.Fields{
+			"sent":      report.Sent,
+			"succeeded": report.Succeeded,
+			"failed":    report.Failed,
+			"pending":   report.Pending,
+		}).Info("Published indicators to TAXII collection")
+	}
+}
+
+// Publish adds the indicators that reached the minimum confidence, and were
+// not yet published at that confidence, to the collection. Indicators the
+// server rejects, or that could not be sent, are retried on the next call.
+func (p *Publisher) Publish(ctx context.Context) (Report, error) {
+	p.publishing.Lock()
+	defer p.publishing.Unlock()
+
+	var report Report
+	objects := p.pending(time.Now())
+	for start := 0; start < len(objects); start += batchSize {
+		batch := objects[start:min(start+batchSize, len(objects))]
+		status, err := p.add(ctx, batch)
+		if err != nil {
+			return report, err
+		}
+		report.Sent += len(batch)
+		report.Succeeded += status.SuccessCount
+		report.Failed += status.FailureCount
+		report.Pending += status.PendingCount
+
+		failed := make(map[string]bool, len(status.Failures))
+		for _, f := range status.Failures {
+			failed[f.ID] = true
+		}
+		p.mu.Lock()
+		for _, object := range batch {
+			if !failed[object.ID] {
+				if ind, ok := p.indicators[object.Pattern]; ok {
+					ind.published = object.Confidence
+				}
+			}
+		}
+		p.mu.Unlock()
+	}
+	return report, nil
+}
+
+// pending returns the indicators to publish as STIX objects, most
+// confident first.
+func (p *Publisher) pending(now time.Time) []*ioc.STIXIndicator {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var objects []*ioc.STIXIndicator
+	for _, ind := range p.indicators {
+		confidence := ind.confidence()
+		if confidence < p.cfg.MinConfidence || confidence <= ind.published {
+			continue
+		}
+		// Each version needs a later modified time than the one before
+		modified := now.UTC().Truncate(time.Millisecond)
+		if !modified.After(ind.modified) {
+			modified = ind.modified.Add(time.Millisecond)
+		}
+		ind.modified = modified
+		objects = append(objects, &ioc.STIXIndicator{
+			Type:           "indicator",
+			SpecVersion:    "2.1",
+			ID:             ind.id,
+			Created:        ind.firstSeen.UTC().Format(ioc.STIXTime),
+			Modified:       modified.Format(ioc.STIXTime),
+			Name:           ind.name,
+			Description:    fmt.Sprintf("Seen in %d spam message(s)", len(ind.messages)),
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        ind.pattern,
+			PatternType:    "stix",
+			ValidFrom:      ind.firstSeen.UTC().Format(ioc.STIXTime),
+			Confidence:     confidence,
+			Labels:         []string{"spam"},
+		})
+	}
+	slices.SortFunc(objects, func(a, b *ioc.STIXIndicator) int {
+		if a.Confidence != b.Confidence {
+			return b.Confidence - a.Confidence
+		}
+		return strings.Compare(a.Pattern, b.Pattern)
+	})
+	return objects
+}
+
+// status is a TAXII 2.1 status resource.
+type status struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	SuccessCount int    `json:"success_count"`
+	FailureCount int    `json:"failure_count"`
+	PendingCount int    `json:"pending_count"`
+	Failures     []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+	} `json:"failures"`
+}
+
+// add posts objects to the collection in an envelope.
+func (p *Publisher) add(ctx context.Context, objects []*ioc.STIXIndicator) (*status, error) {
+	body, err := json.Marshal(map[string]any{"objects": objects})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.objectsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Content-Type", mediaType)
+	switch {
+	case p.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+p.cfg.Token)
+	case p.cfg.Username != "":
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("TAXII request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TAXII response: %w", err)
+	}
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		var taxiiErr struct {
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		}
+		json.Unmarshal(content, &taxiiErr)
+		if taxiiErr.Title != "" {
+			return nil, fmt.Errorf("TAXII error %s: %s %s", resp.Status, taxiiErr.Title, taxiiErr.Description)
+		}
+		return nil, fmt.Errorf("TAXII error: %s", resp.Status)
+	}
+	var result status
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("invalid TAXII status response: %w", err)
+	}
+	return &result, nil
+}
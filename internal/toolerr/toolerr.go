@@ -0,0 +1,112 @@
+// Package toolerr classifies the errors of tool calls with machine-readable
+// codes, so client automations can branch on the class of a failure instead
+// of parsing its message.
+//
+// Errors are classified where they arise with Errorf or Wrap; the code of an
+// error is the code of the outermost classified error it wraps. Timeouts,
+// cancellation and network failures are recognized without classification.
+// Anything else is INTERNAL.
+package toolerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Error codes.
+const (
+	// ValidationFailed: the arguments or the message are invalid.
+	ValidationFailed = "VALIDATION_FAILED"
+	// SizeExceeded: a message, archive or collection is over its limit.
+	SizeExceeded = "SIZE_EXCEEDED"
+	// UnsupportedFormat: the requested or submitted format is not supported.
+	UnsupportedFormat = "UNSUPPORTED_FORMAT"
+	// NotFound: the named item does not exist.
+	NotFound = "NOT_FOUND"
+	// NotConfigured: the feature is disabled in the configuration, or a
+	// program it needs is not installed.
+	NotConfigured = "NOT_CONFIGURED"
+	// Forbidden: the caller may not use the tool or the item it names.
+	Forbidden = "FORBIDDEN"
+	// RateLimited: a per-minute budget refused the call.
+	RateLimited = "RATE_LIMITED"
+	// QuotaExceeded: a daily quota refused the call.
+	QuotaExceeded = "QUOTA_EXCEEDED"
+	// Busy: another operation that cannot run concurrently is in progress.
+	Busy = "BUSY"
+	// SpamdUnavailable: spamd could not be reached or had no capacity.
+	SpamdUnavailable = "SPAMD_UNAVAILABLE"
+	// UpstreamFailed: another service, such as a mailbox or reputation
+	// API, could not be reached.
+	UpstreamFailed = "UPSTREAM_FAILED"
+	// Timeout: the call or a request it made timed out.
+	Timeout = "TIMEOUT"
+	// Cancelled: the call was cancelled.
+	Cancelled = "CANCELLED"
+	// ShuttingDown: the server is draining and accepts no new calls.
+	ShuttingDown = "SHUTTING_DOWN"
+	// Internal: any other failure.
+	Internal = "INTERNAL"
+)
+
+// Error is an error classified with a code.
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errorf formats an error as fmt.Errorf does and classifies it with code.
+func Errorf(code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap classifies err with code. It returns nil for a nil err.
+func Wrap(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code of err.
+func CodeOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, context.Canceled):
+		return Cancelled
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return Timeout
+		}
+		return UpstreamFailed
+	}
+	return Internal
+}
+
+// Result is the structured content of a failed tool call.
+type Result struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ResultOf returns the structured content reporting err.
+func ResultOf(err error) *Result {
+	return &Result{Code: CodeOf(err), Message: err.Error()}
+}
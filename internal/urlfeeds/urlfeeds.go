@@ -0,0 +1,401 @@
+// Package urlfeeds checks URLs against the URLhaus and PhishTank datasets of
+// known malware distribution and phishing URLs.
+//
+// The datasets are held in memory and refreshed periodically, either by
+// downloading them or by reading a local copy, so lookups are instant and
+// the URLs of a message are never sent anywhere. Reading local copies
+// supports air-gapped deployments where the datasets are mirrored by other
+// means. Feed URLs are normalized like extracted URLs, so a listed URL
+// matches however the message writes it.
+//
+// Supported formats:
+//   - URLhaus: the CSV exports, such as
+//     https://urlhaus.abuse.ch/downloads/csv_online/
+//   - PhishTank: the JSON database, such as
+//     https://data.phishtank.com/data/<app key>/online-valid.json.gz
+//
+// Either may be gzip-compressed.
+package urlfeeds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/urls"
+)
+
+// Names of the feeds, as used in listings.
+const (
+	URLhaus   = "urlhaus"
+	PhishTank = "phishtank"
+)
+
+// userAgent identifies downloads; PhishTank requires a descriptive one.
+const userAgent = "spamassassin-mcp/1.0.0"
+
+// errTooLarge is returned for datasets larger than url_feeds.max_size.
+var errTooLarge = errors.New("dataset exceeds url_feeds.max_size")
+
+// Match is a URL listed on a feed.
+type Match struct {
+	URL       string `json:"url"`
+	Feed      string `json:"feed"`
+	Threat    string `json:"threat"`
+	Reference string `json:"reference,omitempty"`
+}
+
+type entry struct {
+	threat    string
+	reference string
+}
+
+// feed is one dataset and where it is read from.
+type feed struct {
+	name  string
+	cfg   config.URLFeedSource
+	parse func(io.Reader) (map[string]entry, error)
+
+	mu      sync.RWMutex
+	entries map[string]entry
+
+	// refresh state, only used by the refreshing goroutine
+	modTime      time.Time
+	etag         string
+	lastModified string
+}
+
+// Store holds the configured feeds.
+type Store struct {
+	feeds   []*feed
+	maxSize int64
+	http    *http.Client
+}
+
+// New returns a store for the feeds in cfg, or nil when none is configured.
+// Local copies are loaded right away; downloads start with Run.
+func New(cfg config.URLFeedsConfig) *Store {
+	s := &Store{maxSize: cfg.MaxSize, http: &http.Client{Timeout: cfg.Timeout}}
+	if cfg.URLhaus.Enabled() {
+		s.feeds = append(s.feeds, &feed{name: URLhaus, cfg: cfg.URLhaus, parse: parseURLhaus})
+	}
+	if cfg.PhishTank.Enabled() {
+		s.feeds = append(s.feeds, &feed{name: PhishTank, cfg: cfg.PhishTank, parse: parsePhishTank})
+	}
+	if len(s.feeds) == 0 {
+		return nil
+	}
+	for _, f := range s.feeds {
+		if f.cfg.Path == "" {
+			continue
+		}
+		if err := s.load(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logrus.WithError(err).WithField("feed", f.name).Warn("Failed to load URL feed")
+		}
+	}
+	return s
+}
+
+// Run refreshes each feed right away and then on its interval until ctx is
+// done. Failures are logged and keep the previous dataset.
+func (s *Store) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, f := range s.feeds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(f.cfg.Refresh)
+			defer ticker.Stop()
+			for {
+				if err := s.refresh(ctx, f); err != nil && ctx.Err() == nil {
+					logrus.WithError(err).WithField("feed", f.name).Warn("Failed to refresh URL feed")
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Refresh refreshes every feed once and returns the failures. It must not
+// be called while Run is running.
+func (s *Store) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, f := range s.feeds {
+		if err := s.refresh(ctx, f); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the URLs of list that a feed lists, and adds a listing for
+// each to the URL so urls.Assess counts it as malicious. Match on a nil
+// Store returns nothing.
+func (s *Store) Match(list []*urls.URL) []Match {
+	if s == nil {
+		return nil
+	}
+	var matches []Match
+	for _, f := range s.feeds {
+		f.mu.RLock()
+		for _, u := range list {
+			if e, ok := f.entries[u.URL]; ok {
+				matches = append(matches, Match{URL: u.URL, Feed: f.name, Threat: e.threat, Reference: e.reference})
+				u.Listings = append(u.Listings, urls.Listing{List: f.name, Result: e.threat, Reference: e.reference})
+			}
+		}
+		f.mu.RUnlock()
+	}
+	return matches
+}
+
+// Sizes returns the number of URLs loaded per feed.
+func (s *Store) Sizes() map[string]int {
+	sizes := make(map[string]int)
+	for _, f := range s.feeds {
+		f.mu.RLock()
+		sizes[f.name] = len(f.entries)
+		f.mu.RUnlock()
+	}
+	return sizes
+}
+
+// refresh downloads the feed when it has a URL, mirroring it to its path if
+// set, or else reloads the local copy when it changed.
+func (s *Store) refresh(ctx context.Context, f *feed) error {
+	if f.cfg.URL == "" {
+		info, err := os.Stat(f.cfg.Path)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Equal(f.modTime) {
+			return nil
+		}
+		return s.load(f)
+	}
+
+	data, err := s.download(ctx, f)
+	if err != nil || data == nil {
+		return err
+	}
+	entries, err := s.decode(f, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	f.set(entries)
+	if f.cfg.Path != "" {
+		if err := writeFile(f.cfg.Path, data); err != nil {
+			return fmt.Errorf("failed to update the local copy: %w", err)
+		}
+	}
+	return nil
+}
+
+// load reads the local copy of the feed.
+func (s *Store) load(f *feed) error {
+	file, err := os.Open(f.cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	entries, err := s.decode(f, file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.cfg.Path, err)
+	}
+	f.modTime = info.ModTime()
+	f.set(entries)
+	return nil
+}
+
+// download fetches the feed, returning nil data when it has not changed
+// since the last download.
+func (s *Store) download(ctx context.Context, f *feed) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		// The URL may carry an application key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, errTooLarge
+	}
+	f.etag, f.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return data, nil
+}
+
+// decode parses a dataset, decompressing it first when it is gzipped.
+func (s *Store) decode(f *feed, r io.Reader) (map[string]entry, error) {
+	br := bufio.NewReader(io.LimitReader(r, s.maxSize+1))
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(io.LimitReader(zr, s.maxSize+1))
+	}
+	counter := &countingReader{r: br}
+	entries, err := f.parse(counter)
+	if counter.n > s.maxSize {
+		return nil, errTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (f *feed) set(entries map[string]entry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = entries
+	logrus.WithFields(logrus.Fields{"feed": f.name, "urls": len(entries)}).Info("URL feed loaded")
+}
+
+// parseURLhaus reads a URLhaus CSV export: id, dateadded, url, url_status,
+// last_online, threat, tags, urlhaus_link, reporter, after # comments.
+func parseURLhaus(r io.Reader) (map[string]entry, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+	entries := make(map[string]entry)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid URLhaus CSV: %w", err)
+		}
+		if len(rec) < 3 || rec[0] == "id" {
+			continue
+		}
+		u, ok := urls.Normalize(rec[2])
+		if !ok {
+			continue
+		}
+		e := entry{threat: "malware_download"}
+		if len(rec) > 5 && rec[5] != "" {
+			e.threat = rec[5]
+		}
+		if len(rec) > 7 {
+			e.reference = rec[7]
+		}
+		entries[u] = e
+	}
+	return entries, nil
+}
+
+// parsePhishTank reads the PhishTank JSON database, an array of verified
+// phishing URLs.
+func parsePhishTank(r io.Reader) (map[string]entry, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("invalid PhishTank database: not a JSON array")
+	}
+	entries := make(map[string]entry)
+	for dec.More() {
+		var phish struct {
+			URL       string `json:"url"`
+			DetailURL string `json:"phish_detail_url"`
+			Target    string `json:"target"`
+			Verified  string `json:"verified"`
+		}
+		if err := dec.Decode(&phish); err != nil {
+			return nil, fmt.Errorf("invalid PhishTank database: %w", err)
+		}
+		if phish.Verified == "no" {
+			continue
+		}
+		u, ok := urls.Normalize(phish.URL)
+		if !ok {
+			continue
+		}
+		e := entry{threat: "phishing", reference: phish.DetailURL}
+		if phish.Target != "" && phish.Target != "Other" {
+			e.threat = "phishing: " + phish.Target
+		}
+		entries[u] = e
+	}
+	return entries, nil
+}
+
+// writeFile replaces path with data atomically.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
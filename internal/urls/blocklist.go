@@ -0,0 +1,107 @@
+package urls
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"spamassassin-mcp/internal/dnsbl"
+)
+
+// maxLookupDomains bounds the distinct domains queried per message.
+const maxLookupDomains = 25
+
+// Verdict is the risk assessment of a URL.
+type Verdict string
+
+const (
+	// Malicious URLs are listed on a URI blocklist, a URL feed or a blocked
+	// domain.
+	Malicious Verdict = "malicious"
+
+	// Suspicious URLs are not listed but use an obfuscation or redirect
+	// technique.
+	Suspicious Verdict = "suspicious"
+
+	Clean Verdict = "clean"
+)
+
+// BlockedDomainsList names the configured blocked domains in listings.
+const BlockedDomainsList = "blocked_domains"
+
+// Listing is a blocklist entry matching a URL. Result is the answer of a
+// DNS blocklist, the matching configured domain or the threat a URL feed
+// lists; Reference links to a feed's entry.
+type Listing struct {
+	List      string `json:"list"`
+	Result    string `json:"result"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Resolver is the subset of *net.Resolver used for blocklist lookups.
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// Assess checks the URLs against the configured blocked domains and, when r
+// is not nil, the URI DNS blocklists in zones, and sets their verdicts.
+// Lookup failures are returned; they leave the URL unlisted, and a zone
+// that fails is not queried again for the message. Listings already present,
+// such as URL feed matches, are kept and count toward the verdict.
+func Assess(ctx context.Context, r Resolver, zones []dnsbl.Zone, blocked []string, list []*URL) []string {
+	for _, u := range list {
+		for _, d := range blocked {
+			d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+			if d != "" && (u.Host == d || strings.HasSuffix(u.Host, "."+d)) {
+				u.Listings = append(u.Listings, Listing{List: BlockedDomainsList, Result: d})
+			}
+		}
+	}
+
+	var errs []string
+	if r != nil && len(zones) > 0 {
+		results := make(map[string][]Listing)
+		failed := make(map[dnsbl.Zone]bool)
+		for _, u := range list {
+			if u.Domain == "" {
+				continue
+			}
+			listings, seen := results[u.Domain]
+			if !seen {
+				if len(results) == maxLookupDomains {
+					continue
+				}
+				for _, zone := range zones {
+					if failed[zone] {
+						continue
+					}
+					result, err := zone.LookupDomain(ctx, r, u.Domain)
+					if err != nil {
+						// A zone that fails once is likely to fail for every
+						// domain; report it once and stop querying it.
+						failed[zone] = true
+						errs = append(errs, err.Error())
+						continue
+					}
+					if result.Listed {
+						listings = append(listings, Listing{List: zone.Name, Result: result.Answers[0]})
+					}
+				}
+				results[u.Domain] = listings
+			}
+			u.Listings = append(u.Listings, listings...)
+		}
+	}
+
+	for _, u := range list {
+		switch {
+		case len(u.Listings) > 0:
+			u.Verdict = Malicious
+		case len(u.Flags) > 0:
+			u.Verdict = Suspicious
+		default:
+			u.Verdict = Clean
+		}
+	}
+	return errs
+}
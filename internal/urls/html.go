@@ -0,0 +1,113 @@
+package urls
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttributes maps the attributes that hold URLs to the source reported
+// for them.
+var urlAttributes = map[string]string{
+	"href":       SourceLink,
+	"src":        SourceResource,
+	"background": SourceResource,
+	"action":     SourceForm,
+	"formaction": SourceForm,
+}
+
+// maxAnchorText bounds the link text kept per anchor.
+const maxAnchorText = 200
+
+// scanHTML extracts URLs from the attributes and visible text of an HTML
+// part, recording the link text of anchors.
+func (x *extractor) scanHTML(doc, part string) {
+	z := html.NewTokenizer(strings.NewReader(doc))
+	var anchor *URL
+	var anchorText strings.Builder
+	skip := ""
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			// Raw is only valid until the token is parsed.
+			entities := strings.Contains(string(z.Raw()), "&#")
+			tok := z.Token()
+			switch tok.Data {
+			case "style", "script":
+				skip = tok.Data
+			}
+			refresh := tok.Data == "meta" && strings.EqualFold(attr(tok, "http-equiv"), "refresh")
+			for _, a := range tok.Attr {
+				value := a.Val
+				source, ok := urlAttributes[a.Key]
+				if refresh && a.Key == "content" {
+					value, source, ok = refreshURL(a.Val), SourceRefresh, true
+				}
+				if !ok || !isURL(value) {
+					continue
+				}
+				original := value
+				var flags []string
+				if entities {
+					flags = append(flags, HTMLEntities)
+				}
+				if strings.HasPrefix(strings.ToLower(value), "www.") {
+					value = "http://" + value
+					flags = append(flags, MissingScheme)
+				}
+				u := x.add(value, original, part, source, flags...)
+				if tok.Data == "a" && a.Key == "href" && u != nil && u.Text == "" {
+					anchor = u
+					anchorText.Reset()
+				}
+			}
+
+		case html.EndTagToken:
+			tok := z.Token()
+			if tok.Data == skip {
+				skip = ""
+			}
+			if tok.Data == "a" && anchor != nil {
+				anchor.Text = strings.Join(strings.Fields(anchorText.String()), " ")
+				anchor = nil
+			}
+
+		case html.TextToken:
+			if skip != "" {
+				continue
+			}
+			text := string(z.Text())
+			if anchor != nil && anchorText.Len() < maxAnchorText {
+				anchorText.WriteString(text)
+			}
+			x.scanText(text, part, SourceHTMLText)
+		}
+	}
+}
+
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// refreshURL returns the URL of a meta refresh content value such as
+// "0; url=https://example.com/".
+func refreshURL(content string) string {
+	_, rest, ok := strings.Cut(content, ";")
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) > 4 && strings.EqualFold(rest[:4], "url=") {
+		rest = rest[4:]
+	}
+	return strings.Trim(rest, `'" `)
+}
@@ -0,0 +1,199 @@
+package urls
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// maxHeaderBytes bounds the response headers read per request; no body is
+// ever read.
+const maxHeaderBytes = 64 << 10
+
+// Unshortener follows the redirects of URL shortener links to find their
+// destination. Only HEAD requests are made, so no page is downloaded, and
+// only to public addresses, so a link cannot reach an internal service.
+type Unshortener struct {
+	http         *http.Client
+	timeout      time.Duration
+	maxRedirects int
+	maxURLs      int
+	shorteners   map[string]bool
+}
+
+// NewUnshortener returns an unshortener for cfg, which resolves hosts with
+// the system resolver and connects only to public addresses.
+func NewUnshortener(cfg config.UnshortenConfig) *Unshortener {
+	return NewUnshortenerWithDialer(cfg, &net.Dialer{
+		Timeout: cfg.Timeout,
+		// Resolved addresses are checked at connect time, so neither a link
+		// nor a redirect can lead to an internal service
+		Control: RefuseNonPublic,
+	})
+}
+
+// NewUnshortenerWithDialer returns an unshortener for cfg that connects with
+// dialer, whose Resolver and Control decide where links lead and which
+// addresses may be reached. Tests use it to follow links to local servers.
+func NewUnshortenerWithDialer(cfg config.UnshortenConfig, dialer *net.Dialer) *Unshortener {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	transport.DisableKeepAlives = true
+	transport.MaxResponseHeaderBytes = maxHeaderBytes
+
+	s := &Unshortener{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// Redirects are followed one at a time by resolve
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		timeout:      cfg.Timeout,
+		maxRedirects: cfg.MaxRedirects,
+		maxURLs:      cfg.MaxURLs,
+		shorteners:   make(map[string]bool, len(cfg.Shorteners)),
+	}
+	for _, domain := range cfg.Shorteners {
+		s.shorteners[strings.ToLower(strings.TrimSuffix(domain, "."))] = true
+	}
+	return s
+}
+
+// specialPrefixes are the special-purpose ranges of the IANA registries that
+// IsGlobalUnicast and IsPrivate let through: shared address space used for
+// carrier-grade NAT, documentation, benchmarking and reserved ranges, and the
+// IPv6 transition prefixes that embed an IPv4 address.
+var specialPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("3fff::/20"),
+}
+
+// RefuseNonPublic is a net.Dialer Control refusing connections to loopback,
+// private, carrier-grade NAT and other non-public addresses. Tests wrap it
+// to let their loopback servers through.
+func RefuseNonPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	special := slices.ContainsFunc(specialPrefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || special {
+		return fmt.Errorf("refusing to connect to non-public address %s", addr)
+	}
+	return nil
+}
+
+// Shortener reports whether u is a link of a built-in or configured URL
+// shortener.
+func (s *Unshortener) Shortener(u *URL) bool {
+	for _, flag := range u.Flags {
+		if flag == URLShortener {
+			return true
+		}
+	}
+	return s.shorteners[u.Host] || (u.Domain != "" && s.shorteners[u.Domain])
+}
+
+// Unshorten resolves the shortener links among list concurrently, setting
+// their RedirectChain and FinalURL. Failures, and the links skipped over
+// the configured limit, are returned as messages rather than failing the
+// call; a link that fails part way keeps the redirects seen so far.
+func (s *Unshortener) Unshorten(ctx context.Context, list []*URL) []string {
+	var links []*URL
+	for _, u := range list {
+		if s.Shortener(u) {
+			links = append(links, u)
+		}
+	}
+	var problems []string
+	if len(links) > s.maxURLs {
+		problems = append(problems, fmt.Sprintf("unshorten: %d link(s) skipped, over the limit of %d per call", len(links)-s.maxURLs, s.maxURLs))
+		links = links[:s.maxURLs]
+	}
+
+	errs := make([]error, len(links))
+	var wg sync.WaitGroup
+	for i, u := range links {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.RedirectChain, errs[i] = s.resolve(ctx, u.URL)
+			if errs[i] == nil {
+				u.FinalURL = u.RedirectChain[len(u.RedirectChain)-1]
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unshorten %s: %v", links[i].URL, err))
+		}
+	}
+	return problems
+}
+
+// resolve follows the redirects of target and returns the locations
+// redirected to, the last being the destination.
+func (s *Unshortener) resolve(ctx context.Context, target string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var chain []string
+	current := target
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, current, nil)
+		if err != nil {
+			return chain, err
+		}
+		resp, err := s.http.Do(req)
+		if err != nil {
+			return chain, err
+		}
+		resp.Body.Close()
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			if len(chain) == 0 {
+				return nil, fmt.Errorf("answered %s without redirecting", resp.Status)
+			}
+			return chain, nil
+		}
+		next, err := req.URL.Parse(location)
+		if err != nil {
+			return chain, fmt.Errorf("invalid redirect location %q", location)
+		}
+		if next.Scheme != "http" && next.Scheme != "https" {
+			return chain, fmt.Errorf("refusing redirect to %s", next.Redacted())
+		}
+		if len(chain) == s.maxRedirects {
+			return chain, fmt.Errorf("stopped after %d redirects", s.maxRedirects)
+		}
+		chain = append(chain, next.String())
+		current = next.String()
+	}
+}
@@ -0,0 +1,403 @@
+// Package urls extracts and assesses the URLs of a message.
+//
+// Extract collects URLs from the text and HTML parts of a parsed message,
+// including forms meant to evade naive extraction: defanged URLs
+// (hxxp://example[.]com), scheme-less www. links, HTML entity encoding and
+// numeric IP hosts. Every URL is normalized so the same destination written
+// differently is reported once, and flagged with the obfuscation and
+// redirect techniques it uses. QR codes in image parts are decoded and the
+// URLs they carry extracted too, since they bypass text-based filters.
+// Assess then checks each URL against URI DNS
+// blocklists (URIBL, SURBL, Spamhaus DBL) and the configured blocked
+// domains and assigns a verdict. An Unshortener, when requested, follows
+// the redirects of URL shortener links to their destination.
+//
+// Security considerations:
+//   - Extract and Assess never fetch URLs; redirects are detected from the
+//     URL alone. The Unshortener makes HEAD requests to public addresses
+//     only, without reading a body
+//   - The number of URLs and blocklist lookups per message is bounded
+package urls
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/qrcode"
+	"spamassassin-mcp/internal/virustotal"
+)
+
+// MaxURLs is the maximum number of distinct URLs reported per message.
+const MaxURLs = 200
+
+// maxImages is the number of image parts scanned for QR codes per message.
+const maxImages = 10
+
+// Flags describing how a URL is written.
+const (
+	// Obfuscation techniques.
+	Defanged      = "defanged"
+	MissingScheme = "missing_scheme"
+	HTMLEntities  = "html_entities"
+	EncodedHost   = "encoded_host"
+	EncodedIP     = "encoded_ip"
+	Userinfo      = "userinfo"
+	IDN           = "idn"
+	QRCode        = "qr_code"
+
+	// Hosts that are not plain domain names on the default port.
+	IPHost          = "ip_host"
+	NonstandardPort = "nonstandard_port"
+
+	// Redirect techniques that hide the final destination.
+	RedirectParameter = "redirect_parameter"
+	EmbeddedURL       = "embedded_url"
+	URLShortener      = "url_shortener"
+)
+
+// Sources of an extracted URL.
+const (
+	SourceText     = "text"
+	SourceLink     = "html_link"
+	SourceResource = "html_resource"
+	SourceForm     = "html_form"
+	SourceRefresh  = "html_refresh"
+	SourceHTMLText = "html_text"
+	SourceQRCode   = "qr_code"
+)
+
+var (
+	// schemeURLRegex matches URLs with a scheme, including defanged forms.
+	schemeURLRegex = regexp.MustCompile(`(?i)\b(?:h(?:tt|xx)ps?|ftp)(?:\[:\]|:)//(?:[^\s<>"'\x60{}|\\^\[\]()]|\[\.\]|\(\.\)|\[dot\]|\(dot\))+`)
+
+	// bareURLRegex matches www. host names written without a scheme.
+	bareURLRegex = regexp.MustCompile(`(?i)\bwww(?:\.|\[\.\]|\(\.\))[a-z0-9-]+(?:(?:\.|\[\.\]|\(\.\))[a-z0-9-]+)+(?:/[^\s<>"'\x60{}|\\^\[\]()]*)?`)
+
+	refanger = strings.NewReplacer(
+		"[.]", ".", "(.)", ".", "[dot]", ".", "(dot)", ".", "[DOT]", ".", "(DOT)", ".",
+		"[:]", ":", "hxxp", "http", "HXXP", "HTTP",
+	)
+
+	numericHostRegex = regexp.MustCompile(`^(?:0[xX][0-9a-fA-F]+|[0-9]+)$`)
+)
+
+// shorteners are URL shortening services, which hide the destination until
+// the link is followed.
+var shorteners = map[string]bool{
+	"bit.ly": true, "bitly.com": true, "tinyurl.com": true, "t.co": true, "goo.gl": true,
+	"ow.ly": true, "is.gd": true, "buff.ly": true, "rebrand.ly": true, "cutt.ly": true,
+	"shorturl.at": true, "t.ly": true, "rb.gy": true, "tiny.cc": true, "s.id": true,
+	"lnkd.in": true, "trib.al": true, "v.gd": true,
+}
+
+// defaultPorts are the ports dropped during normalization.
+var defaultPorts = map[string]string{"http": "80", "https": "443", "ftp": "21"}
+
+// URL is one distinct URL found in a message.
+type URL struct {
+	// URL is the normalized form and Original the first occurrence as
+	// written in the message.
+	URL      string `json:"url"`
+	Original string `json:"original"`
+	Host     string `json:"host"`
+
+	// Domain is the registrable domain of Host, empty for IP hosts.
+	Domain string `json:"domain,omitempty"`
+
+	// Parts are the MIME part paths and Sources the places within them
+	// the URL was found.
+	Parts   []string `json:"parts"`
+	Sources []string `json:"sources"`
+
+	// Text is the link text of the first HTML anchor pointing at the URL.
+	Text string `json:"text,omitempty"`
+
+	Flags []string `json:"flags,omitempty"`
+
+	// RedirectTarget is the destination passed in a redirect parameter or
+	// embedded in the path.
+	RedirectTarget string `json:"redirect_target,omitempty"`
+
+	// RedirectChain is the locations a shortener link redirected to, in
+	// order, and FinalURL the last of them, its destination; both are set
+	// when unshortening is requested.
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+	FinalURL      string   `json:"final_url,omitempty"`
+
+	Listings []Listing `json:"listings,omitempty"`
+	Verdict  Verdict   `json:"verdict"`
+
+	// VirusTotal is the VirusTotal report on the URL, when requested.
+	VirusTotal *virustotal.Report `json:"virustotal,omitempty"`
+}
+
+// Extract returns the distinct URLs of the text and HTML parts of email, and
+// of the QR codes in its images, in order of first appearance.
+func Extract(email *model.ParsedEmail) []*URL {
+	x := &extractor{index: make(map[string]*URL)}
+	images := 0
+	for _, p := range email.Parts {
+		if strings.HasPrefix(p.ContentType, "image/") && len(p.Content) > 0 && images < maxImages {
+			images++
+			// Images that cannot be decoded are not an error here
+			codes, _ := qrcode.Scan(p.Content)
+			for _, text := range codes {
+				x.scanText(text, p.Path, SourceQRCode, QRCode)
+			}
+			continue
+		}
+		if p.Text == "" || p.Disposition == "attachment" {
+			continue
+		}
+		switch p.ContentType {
+		case "text/html":
+			x.scanHTML(p.Text, p.Path)
+		case "text/plain":
+			x.scanText(p.Text, p.Path, SourceText)
+		}
+	}
+	if x.urls == nil {
+		return make([]*URL, 0)
+	}
+	return x.urls
+}
+
+type extractor struct {
+	urls  []*URL
+	index map[string]*URL
+}
+
+// add records an occurrence of raw, written as original in the message,
+// merging it with earlier occurrences of the same normalized URL.
+func (x *extractor) add(raw, original, part, source string, flags ...string) *URL {
+	n, ok := normalize(raw)
+	if !ok {
+		return nil
+	}
+	u, seen := x.index[n.url]
+	if !seen {
+		if len(x.urls) >= MaxURLs {
+			return nil
+		}
+		u = &URL{
+			URL:            n.url,
+			Original:       original,
+			Host:           n.host,
+			Domain:         n.domain,
+			RedirectTarget: n.redirect,
+		}
+		x.index[n.url] = u
+		x.urls = append(x.urls, u)
+	}
+	if !slices.Contains(u.Parts, part) {
+		u.Parts = append(u.Parts, part)
+	}
+	if !slices.Contains(u.Sources, source) {
+		u.Sources = append(u.Sources, source)
+	}
+	for _, f := range append(flags, n.flags...) {
+		if !slices.Contains(u.Flags, f) {
+			u.Flags = append(u.Flags, f)
+		}
+	}
+	return u
+}
+
+// scanText extracts URLs written in plain text, refanging defanged forms and
+// completing www. host names.
+func (x *extractor) scanText(text, part, source string, flags ...string) {
+	for _, m := range schemeURLRegex.FindAllString(text, -1) {
+		x.addText(m, part, source, flags...)
+	}
+	remaining := schemeURLRegex.ReplaceAllString(text, " ")
+	for _, m := range bareURLRegex.FindAllString(remaining, -1) {
+		x.addText(m, part, source, append(flags, MissingScheme)...)
+	}
+}
+
+func (x *extractor) addText(match, part, source string, flags ...string) {
+	match = strings.TrimRight(match, ".,;:!?'\"")
+	refanged := refanger.Replace(match)
+	if refanged != match {
+		flags = append(flags, Defanged)
+	}
+	if slices.Contains(flags, MissingScheme) {
+		refanged = "http://" + refanged
+	}
+	x.add(refanged, match, part, source, flags...)
+}
+
+// Normalize returns the canonical form of raw that URLs are reported in, or
+// false when raw is not an http, https or ftp URL.
+func Normalize(raw string) (string, bool) {
+	n, ok := normalize(raw)
+	if !ok {
+		return "", false
+	}
+	return n.url, true
+}
+
+// normalized is the canonical form of a URL and what it reveals.
+type normalized struct {
+	url      string
+	host     string
+	domain   string
+	redirect string
+	flags    []string
+}
+
+// normalize canonicalizes raw: the scheme and host are lower-cased, IDNs
+// converted to punycode, numeric IP hosts written in dotted decimal, the
+// default port, userinfo and fragment dropped and an empty path set to /.
+// Only http, https and ftp URLs are accepted.
+func normalize(raw string) (*normalized, bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "//") {
+		raw = "http:" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok || u.Host == "" {
+		return nil, false
+	}
+
+	n := &normalized{}
+	authority := raw[strings.Index(raw, "//")+2:]
+	if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+	if strings.Contains(authority, "%") {
+		n.flags = append(n.flags, EncodedHost)
+	}
+	if u.User != nil {
+		n.flags = append(n.flags, Userinfo)
+		u.User = nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil, false
+	}
+	switch ip := net.ParseIP(host); {
+	case ip != nil:
+		n.flags = append(n.flags, IPHost)
+	case numericIP(host) != nil:
+		host = numericIP(host).String()
+		n.flags = append(n.flags, EncodedIP, IPHost)
+	default:
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return nil, false
+		}
+		if strings.HasPrefix(ascii, "xn--") || strings.Contains(ascii, ".xn--") {
+			n.flags = append(n.flags, IDN)
+		}
+		host = ascii
+		n.domain, _ = publicsuffix.EffectiveTLDPlusOne(host)
+		if shorteners[host] || shorteners[n.domain] {
+			n.flags = append(n.flags, URLShortener)
+		}
+	}
+	n.host = host
+
+	hostport := host
+	if strings.Contains(host, ":") {
+		hostport = "[" + host + "]"
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		n.flags = append(n.flags, NonstandardPort)
+		hostport = net.JoinHostPort(host, port)
+	}
+	u.Host = hostport
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", ""
+	}
+
+	for _, values := range u.Query() {
+		for _, v := range values {
+			if isURL(v) {
+				n.flags = append(n.flags, RedirectParameter)
+				if n.redirect == "" {
+					n.redirect = v
+				}
+			}
+		}
+	}
+	if i := embeddedURLIndex(u.Path); i >= 0 {
+		n.flags = append(n.flags, EmbeddedURL)
+		if n.redirect == "" {
+			n.redirect = strings.TrimPrefix(u.Path[i:], "/")
+		}
+	}
+
+	n.url = u.String()
+	return n, true
+}
+
+// isURL reports whether a query parameter value is an absolute URL.
+func isURL(v string) bool {
+	lower := strings.ToLower(strings.TrimSpace(v))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") ||
+		strings.HasPrefix(lower, "//") || strings.HasPrefix(lower, "www.")
+}
+
+// embeddedURLIndex returns the index of an absolute URL embedded in a path,
+// as used by redirectors such as https://example.com/r/https://target, or
+// -1.
+func embeddedURLIndex(path string) int {
+	lower := strings.ToLower(path)
+	for _, scheme := range []string{"http://", "https://", "http:/", "https:/"} {
+		if i := strings.Index(lower, scheme); i > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// numericIP parses the IPv4 forms accepted by inet_aton, used to disguise
+// addresses: a single 32-bit number (3232235777, 0xc0a80001) or dotted
+// parts in octal or hex (0300.0250.0.1). Plain dotted decimal is left to
+// net.ParseIP. It returns nil if host is not such a form.
+func numericIP(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	values := make([]uint64, len(parts))
+	for i, p := range parts {
+		if !numericHostRegex.MatchString(p) {
+			return nil
+		}
+		v, err := strconv.ParseUint(p, 0, 32)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+
+	last := len(values) - 1
+	var ip uint64
+	for i, v := range values[:last] {
+		if v > 255 {
+			return nil
+		}
+		ip |= v << (24 - 8*i)
+	}
+	if values[last] >= 1<<(8*(4-last)) {
+		return nil
+	}
+	ip |= values[last]
+	return net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+}
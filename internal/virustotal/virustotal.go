@@ -0,0 +1,252 @@
+// Package virustotal looks up file hashes and URLs on VirusTotal with its
+// v3 API.
+//
+// Only existing reports are read: files are never uploaded and URLs are
+// never submitted for scanning, so nothing from a message leaves the server
+// except the hashes and URLs looked up. Lookups count against the quota of
+// the API key, so reports are cached for a configured time and a quota
+// response stops further requests for a while.
+//
+// Security considerations:
+//   - The API key is sent only to the configured endpoint; redirects are
+//     not followed
+//   - Response bodies are bounded
+package virustotal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+)
+
+// maxResponseSize bounds the responses read from VirusTotal. URL and file
+// objects carry the results of every engine, so they are larger than most.
+const maxResponseSize = 4 << 20
+
+// quotaBackoff is how long lookups stop after VirusTotal reports the quota
+// of the key exceeded.
+const quotaBackoff = time.Minute
+
+// Report is the latest VirusTotal analysis of a file or URL. Found is false
+// when VirusTotal has never seen it. Cached is set when the report was
+// served from the cache rather than looked up.
+type Report struct {
+	Found      bool       `json:"found"`
+	Malicious  int        `json:"malicious"`
+	Suspicious int        `json:"suspicious"`
+	Engines    int        `json:"engines"`
+	Ratio      string     `json:"detection_ratio,omitempty"`
+	FirstSeen  *time.Time `json:"first_seen,omitempty"`
+	LastSeen   *time.Time `json:"last_analysis,omitempty"`
+	Link       string     `json:"link,omitempty"`
+	Cached     bool       `json:"cached"`
+}
+
+type entry struct {
+	report  Report
+	expires time.Time
+}
+
+// Client looks up reports on VirusTotal and caches them.
+type Client struct {
+	base      string
+	apiKey    string
+	cacheTTL  time.Duration
+	cacheSize int
+	http      *http.Client
+
+	mu          sync.Mutex
+	cache       map[string]entry
+	backoffTill time.Time
+}
+
+// New returns a client for cfg, or nil when no API key is configured.
+func New(cfg config.VirusTotalConfig) *Client {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	return &Client{
+		base:      strings.TrimSuffix(cfg.URL, "/"),
+		apiKey:    cfg.APIKey,
+		cacheTTL:  cfg.CacheTTL,
+		cacheSize: cfg.CacheSize,
+		cache:     make(map[string]entry),
+		http: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect could carry the API key elsewhere
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// File returns the report on the file with the given SHA-256, MD5 or SHA-1
+// hash.
+func (c *Client) File(ctx context.Context, hash string) (*Report, error) {
+	hash = strings.ToLower(hash)
+	return c.check(ctx, "/files/"+hash, "https://www.virustotal.com/gui/file/"+hash)
+}
+
+// URL returns the report on u, which VirusTotal identifies by its unpadded
+// URL-safe base64 encoding.
+func (c *Client) URL(ctx context.Context, u string) (*Report, error) {
+	id := base64.RawURLEncoding.EncodeToString([]byte(u))
+	return c.check(ctx, "/urls/"+id, "https://www.virustotal.com/gui/url/"+id)
+}
+
+func (c *Client) check(ctx context.Context, path, link string) (*Report, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.cache[path]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		report := e.report
+		report.Cached = true
+		return &report, nil
+	}
+	if now.Before(c.backoffTill) {
+		until := c.backoffTill
+		c.mu.Unlock()
+		return nil, fmt.Errorf("VirusTotal quota exceeded, retrying after %s", until.Format(time.RFC3339))
+	}
+	c.mu.Unlock()
+
+	report, err := c.lookup(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if report.Found {
+		report.Link = link
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= c.cacheSize {
+		c.evict(now)
+	}
+	c.cache[path] = entry{report: *report, expires: now.Add(c.cacheTTL)}
+	return report, nil
+}
+
+// Prune drops the expired reports from the cache and returns how many were
+// dropped.
+func (c *Client) Prune(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			n++
+		}
+	}
+	return n
+}
+
+// evict makes room in the cache by dropping expired reports, or the one
+// expiring first when none has.
+func (c *Client) evict(now time.Time) {
+	var oldest string
+	for key, e := range c.cache {
+		if !now.Before(e.expires) {
+			delete(c.cache, key)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.cache[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.cache) >= c.cacheSize {
+		delete(c.cache, oldest)
+	}
+}
+
+func (c *Client) lookup(ctx context.Context, path string) (*Report, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-apikey", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("VirusTotal request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VirusTotal response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return &Report{}, nil
+	case http.StatusTooManyRequests:
+		c.mu.Lock()
+		c.backoffTill = time.Now().Add(quotaBackoff)
+		c.mu.Unlock()
+		return nil, responseError(resp.Status, content)
+	default:
+		return nil, responseError(resp.Status, content)
+	}
+
+	var body struct {
+		Data struct {
+			Attributes struct {
+				FirstSubmissionDate int64          `json:"first_submission_date"`
+				LastAnalysisDate    int64          `json:"last_analysis_date"`
+				LastAnalysisStats   map[string]int `json:"last_analysis_stats"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(content, &body); err != nil {
+		return nil, fmt.Errorf("invalid VirusTotal response: %w", err)
+	}
+	attrs := body.Data.Attributes
+	report := &Report{
+		Found:      true,
+		Malicious:  attrs.LastAnalysisStats["malicious"],
+		Suspicious: attrs.LastAnalysisStats["suspicious"],
+		FirstSeen:  unixTime(attrs.FirstSubmissionDate),
+		LastSeen:   unixTime(attrs.LastAnalysisDate),
+	}
+	// Engines that could not handle the file type or timed out gave no
+	// verdict and are not counted.
+	for _, category := range []string{"malicious", "suspicious", "harmless", "undetected"} {
+		report.Engines += attrs.LastAnalysisStats[category]
+	}
+	report.Ratio = fmt.Sprintf("%d/%d", report.Malicious, report.Engines)
+	return report, nil
+}
+
+func unixTime(sec int64) *time.Time {
+	if sec <= 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
+}
+
+// responseError turns a VirusTotal error response into an error with its
+// code and message.
+func responseError(status string, content []byte) error {
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(content, &body)
+	if body.Error.Code == "" {
+		return fmt.Errorf("VirusTotal error: %s", status)
+	}
+	return fmt.Errorf("VirusTotal error %s: %s: %s", status, body.Error.Code, body.Error.Message)
+}
@@ -0,0 +1,191 @@
+// Package webhook routes tagged scan verdicts to HTTP endpoints.
+//
+// Each configured webhook receives, as a JSON POST, the verdict of every
+// scan carrying one of its tags, so an organization can send each class of
+// its triage taxonomy to the team or system handling it. Verdicts are queued
+// per webhook and posted by a background goroutine, so a slow or unreachable
+// endpoint never delays a scan or the other webhooks; verdicts are dropped,
+// with a warning, when a webhook's queue is full.
+//
+// Security considerations:
+//   - Message content is never sent, only the verdict and message metadata
+//   - Redirects are not followed, so an endpoint cannot bounce verdicts to
+//     another host
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+const (
+	// queueSize bounds the verdicts waiting for each webhook.
+	queueSize = 100
+
+	// defaultTimeout bounds each POST when the webhook sets no timeout.
+	defaultTimeout = 10 * time.Second
+)
+
+// Verdict is the outcome of one scan, as posted to a webhook.
+type Verdict struct {
+	Time      time.Time `json:"time"`
+	Tags      []string  `json:"tags"`
+	Verdict   string    `json:"verdict"`
+	Score     float64   `json:"score"`
+	Threshold float64   `json:"threshold"`
+	Rules     []string  `json:"rules"`
+	Profile   string    `json:"profile,omitempty"`
+	Hash      string    `json:"hash"`
+	Sender    string    `json:"sender,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+}
+
+// Router posts verdicts to the webhooks routed their tags.
+type Router struct {
+	hooks []*hook
+
+	// closed is set, under mu, when the queues are closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+type hook struct {
+	url     string
+	tags    []string
+	headers map[string]string
+	client  *http.Client
+
+	queue   chan []byte
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// New starts a router for cfg, or returns nil when no webhook is configured.
+func New(cfg []config.TagWebhookConfig) *Router {
+	if len(cfg) == 0 {
+		return nil
+	}
+	r := &Router{}
+	for _, c := range cfg {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		h := &hook{
+			url:     c.URL,
+			tags:    c.Tags,
+			headers: c.Headers,
+			client: &http.Client{
+				Timeout: timeout,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			},
+			queue: make(chan []byte, queueSize),
+			done:  make(chan struct{}),
+		}
+		go h.run()
+		r.hooks = append(r.hooks, h)
+	}
+	return r
+}
+
+// Route queues v for every webhook routed one of its tags. It never blocks.
+// Route on a nil or closed Router does nothing.
+func (r *Router) Route(v Verdict) {
+	if r == nil || len(v.Tags) == 0 {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+
+	var body []byte
+	for _, h := range r.hooks {
+		if !slices.ContainsFunc(v.Tags, func(tag string) bool { return slices.Contains(h.tags, tag) }) {
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(v)
+		}
+		select {
+		case h.queue <- body:
+		default:
+			// Warn on the first drop and then every 1000th
+			if n := h.dropped.Add(1); n%1000 == 1 {
+				logrus.WithFields(logrus.Fields{"url": h.url, "dropped": n}).Warn("Webhook queue full, dropping tagged verdicts")
+			}
+		}
+	}
+}
+
+// Close posts the queued verdicts, waiting at most timeout for all
+// webhooks.
+func (r *Router) Close(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		for _, h := range r.hooks {
+			close(h.queue)
+		}
+	}
+	r.mu.Unlock()
+
+	deadline := time.After(timeout)
+	for _, h := range r.hooks {
+		select {
+		case <-h.done:
+		case <-deadline:
+			logrus.WithField("url", h.url).Warn("Webhook delivery did not finish before shutdown")
+			return
+		}
+	}
+}
+
+// run posts queued verdicts until the queue is closed. Failed posts are
+// logged and not retried.
+func (h *hook) run() {
+	defer close(h.done)
+	for body := range h.queue {
+		if err := h.post(body); err != nil {
+			logrus.WithError(err).WithField("url", h.url).Error("Failed to post verdict to webhook")
+		}
+	}
+}
+
+func (h *hook) post(body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
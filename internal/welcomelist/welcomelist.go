@@ -0,0 +1,231 @@
+// Package welcomelist keeps the senders whose mail SpamAssassin should
+// always accept, managed at runtime with the welcomelist tools.
+//
+// Entries live in memory. When a path is configured they are also saved to a
+// JSON file on every change and restored by Open. When a local.cf is
+// configured, every change also rewrites a managed block of welcomelist_from
+// lines in it, so spamd applies the entries once it reloads its
+// configuration. The rest of local.cf is left as it is; see package localcf.
+//
+// Security considerations:
+//   - Addresses are validated against a strict pattern, so entries cannot
+//     inject other configuration directives
+//   - The state file is written atomically with owner-only permissions
+package welcomelist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/localcf"
+)
+
+// MaxCommentLength bounds the comment of an entry.
+const MaxCommentLength = 200
+
+// ErrNotFound is returned when removing an address that is not listed.
+var ErrNotFound = errors.New("address is not on the welcomelist")
+
+// Entry is one welcomelisted address or pattern.
+type Entry struct {
+	Address string    `json:"address"`
+	Comment string    `json:"comment,omitempty"`
+	AddedBy string    `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Store holds the welcomelist entries.
+type Store struct {
+	mu        sync.Mutex
+	path      string
+	localCF   *localcf.Block
+	directive string
+	entries   []Entry
+}
+
+// New returns an empty store kept in memory only.
+func New() *Store {
+	return &Store{entries: make([]Entry, 0)}
+}
+
+// Open returns the store for cfg, restoring the entries saved at cfg.Path by
+// a previous run.
+func Open(cfg config.WelcomelistConfig) (*Store, error) {
+	s := New()
+	s.path = cfg.Path
+	if cfg.LocalCF != "" {
+		s.localCF = &localcf.Block{Path: cfg.LocalCF, Name: "welcomelist"}
+		s.directive = cfg.Directive
+	}
+	if s.path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read welcomelist file: %w", err)
+	default:
+		var saved []Entry
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return nil, fmt.Errorf("failed to parse welcomelist file %s: %w", s.path, err)
+		}
+		for _, e := range saved {
+			if err := ValidateAddress(e.Address); err != nil {
+				return nil, fmt.Errorf("welcomelist file %s: %w", s.path, err)
+			}
+		}
+		s.entries = append(s.entries, saved...)
+	}
+	return s, nil
+}
+
+// Normalize returns address in the form entries are stored in.
+func Normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// ValidateAddress checks that a normalized address is an email address or
+// a SpamAssassin wildcard pattern.
+func ValidateAddress(address string) error {
+	if !localcf.ValidPattern(address) {
+		return fmt.Errorf("invalid welcomelist address %q: use an email address, optionally with * and ? wildcards, e.g. *@example.com", address)
+	}
+	return nil
+}
+
+// ValidateComment checks that a comment is a single printable line.
+func ValidateComment(comment string) error {
+	if len(comment) > MaxCommentLength {
+		return fmt.Errorf("comment exceeds %d characters", MaxCommentLength)
+	}
+	if strings.ContainsFunc(comment, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return fmt.Errorf("comment must be a single line without control characters")
+	}
+	return nil
+}
+
+// Entries returns the entries in the order they were added.
+func (s *Store) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.entries)
+}
+
+// Add lists e.Address, which must be normalized and valid. It reports false
+// without changing anything when the address is already listed.
+func (s *Store) Add(e Entry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(e.Address) >= 0 {
+		return false, nil
+	}
+	if err := s.update(append(slices.Clone(s.entries), e)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove delists address, returning the removed entry.
+func (s *Store) Remove(address string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(address)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	removed := s.entries[i]
+	if err := s.update(slices.Delete(slices.Clone(s.entries), i, i+1)); err != nil {
+		return nil, err
+	}
+	return &removed, nil
+}
+
+// Get returns the entry for a normalized address or pattern, if listed.
+func (s *Store) Get(address string) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.index(address); i >= 0 {
+		e := s.entries[i]
+		return &e
+	}
+	return nil
+}
+
+// Match returns the entry matching sender, if any, honouring wildcards.
+func (s *Store) Match(sender string) *Entry {
+	sender = Normalize(sender)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if localcf.MatchPattern(e.Address, sender) {
+			return &e
+		}
+	}
+	return nil
+}
+
+// LocalCF returns the local.cf the store writes, or "" if none.
+func (s *Store) LocalCF() string {
+	if s.localCF == nil {
+		return ""
+	}
+	return s.localCF.Path
+}
+
+func (s *Store) index(address string) int {
+	return slices.IndexFunc(s.entries, func(e Entry) bool { return e.Address == address })
+}
+
+// update saves entries and writes them to local.cf before making them
+// current. If local.cf cannot be written, the saved entries are restored.
+func (s *Store) update(entries []Entry) error {
+	if err := s.save(entries); err != nil {
+		return err
+	}
+	if s.localCF != nil {
+		if err := s.localCF.Write(s.lines(entries)); err != nil {
+			// Best effort: the error that matters is the local.cf one.
+			s.save(s.entries)
+			return err
+		}
+	}
+	s.entries = entries
+	return nil
+}
+
+func (s *Store) save(entries []Entry) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := localcf.WriteAtomic(s.path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to save welcomelist: %w", err)
+	}
+	return nil
+}
+
+// lines renders entries as local.cf lines, each preceded by its comment.
+func (s *Store) lines(entries []Entry) []string {
+	var lines []string
+	for _, e := range entries {
+		if e.Comment != "" {
+			lines = append(lines, "# "+e.Comment)
+		}
+		lines = append(lines, s.directive+" "+e.Address)
+	}
+	return lines
+}
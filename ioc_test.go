@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/ioc"
+)
+
+const iocEmail = "Received: from mx.example.net (mx.example.net [10.0.0.2])\r\n" +
+	"\tby inbox.example.net with LMTP id 7Hq2; Tue, 1 Oct 2024 10:00:30 +0000\r\n" +
+	"Received: from sender.bad-example.com (unknown [203.0.113.5])\r\n" +
+	"\tby mx.example.net (Postfix) with ESMTP id 4XyZ; Tue, 1 Oct 2024 10:00:20 +0000\r\n" +
+	"Return-Path: <bounce@bad-example.com>\r\n" +
+	"From: Billing <billing@bad-example.com>\r\n" +
+	"Reply-To: payments@collect.example.net\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: Invoice\r\n" +
+	"Message-ID: <inv-7@bad-example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=B1\r\n" +
+	"\r\n" +
+	"--B1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Dear bob@example.org, pay at http://203.0.113.9/pay or https://Pay.Bad-Example.com/inv?id=7.\r\n" +
+	"Questions: support[@]bad-example.com, or our backup server 198.51.100[.]7 (not 10.1.2.3).\r\n" +
+	"--B1\r\n" +
+	"Content-Type: application/octet-stream; name=\"invoice.txt\"\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.txt\"\r\n" +
+	"\r\n" +
+	"invoice body\r\n" +
+	"--B1--\r\n"
+
+func TestExtractIOCs(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var result handlers.ExtractIOCsResult
+	if res := env.call(t, "extract_iocs", map[string]any{"content": iocEmail}, &result); res.IsError {
+		t.Fatalf("extract_iocs failed: %s", resultText(res))
+	}
+	set := result.IOCs
+	if result.Bundle != nil {
+		t.Error("bundle returned without format stix")
+	}
+
+	values := func(list []*ioc.Indicator) []string {
+		var v []string
+		for _, ind := range list {
+			v = append(v, ind.Value)
+		}
+		return v
+	}
+	sources := func(list []*ioc.Indicator, value string) []string {
+		for _, ind := range list {
+			if ind.Value == value {
+				return ind.Sources
+			}
+		}
+		return nil
+	}
+
+	if got, want := values(set.IPs), []string{"203.0.113.5", "203.0.113.9", "198.51.100.7"}; !slices.Equal(got, want) {
+		t.Errorf("ips = %v, want %v", got, want)
+	}
+	if got := sources(set.IPs, "203.0.113.5"); !slices.Equal(got, []string{ioc.SourceOrigin}) {
+		t.Errorf("originating ip sources = %v", got)
+	}
+	if got, want := values(set.Domains), []string{"bad-example.com", "collect.example.net", "pay.bad-example.com"}; !slices.Equal(got, want) {
+		t.Errorf("domains = %v, want %v", got, want)
+	}
+	if got, want := sources(set.Domains, "bad-example.com"), []string{ioc.SourceFrom, ioc.SourceReturnPath, ioc.SourceBody}; !slices.Equal(got, want) {
+		t.Errorf("sender domain sources = %v, want %v", got, want)
+	}
+	if got := values(set.URLs); len(got) != 2 || got[0] != "http://203.0.113.9/pay" {
+		t.Errorf("urls = %v", got)
+	}
+	// Recipient addresses identify the victim and are left out.
+	if got, want := values(set.EmailAddresses), []string{"billing@bad-example.com", "payments@collect.example.net", "bounce@bad-example.com", "support@bad-example.com"}; !slices.Equal(got, want) {
+		t.Errorf("email addresses = %v, want %v", got, want)
+	}
+	sum := sha256.Sum256([]byte("invoice body"))
+	if len(set.Files) != 1 || set.Files[0].Name != "invoice.txt" || set.Files[0].SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("files = %+v", set.Files)
+	}
+
+	res := env.call(t, "extract_iocs", map[string]any{"content": iocEmail, "format": "stix"}, &result)
+	if res.IsError {
+		t.Fatalf("extract_iocs stix failed: %s", resultText(res))
+	}
+	bundle := result.Bundle
+	if bundle == nil || bundle.Type != "bundle" || !strings.HasPrefix(bundle.ID, "bundle--") {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+	if len(bundle.Objects) != result.IOCs.Count() {
+		t.Errorf("bundle has %d objects, want %d", len(bundle.Objects), result.IOCs.Count())
+	}
+	patterns := make(map[string]bool)
+	for _, o := range bundle.Objects {
+		if o.Type != "indicator" || o.SpecVersion != "2.1" || o.PatternType != "stix" || !strings.HasPrefix(o.ID, "indicator--") || o.ValidFrom == "" {
+			t.Errorf("malformed indicator: %+v", o)
+		}
+		patterns[o.Pattern] = true
+	}
+	for _, want := range []string{
+		"[ipv4-addr:value = '203.0.113.5']",
+		"[domain-name:value = 'bad-example.com']",
+		"[email-addr:value = 'payments@collect.example.net']",
+		"[file:hashes.'SHA-256' = '" + hex.EncodeToString(sum[:]) + "' OR file:hashes.MD5 = '" + set.Files[0].MD5 + "']",
+	} {
+		if !patterns[want] {
+			t.Errorf("missing pattern %s", want)
+		}
+	}
+	if !strings.Contains(resultText(res), `"spec_version": "2.1"`) {
+		t.Error("text content is not the STIX bundle")
+	}
+
+	if res := env.call(t, "extract_iocs", map[string]any{"content": iocEmail, "format": "csv"}, nil); !res.IsError {
+		t.Error("unsupported format accepted")
+	}
+}
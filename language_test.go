@@ -0,0 +1,91 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanLanguageHits(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Profiles = map[string]config.Profile{
+			"international": {OkLanguages: "en de", OkLocales: "en ja"},
+			"locales-only":  {OkLocales: "all"},
+		}
+	})
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 7.0,
+		Rules: []spamdtest.Rule{
+			{Name: "UNWANTED_LANGUAGE_BODY", Score: 2.8, Description: "Message written in an undesired language"},
+			{Name: "CHARSET_FARAWAY_HEADER", Score: 3.2, Description: "A foreign language charset used in headers"},
+			{Name: "HTML_MESSAGE", Score: 1.0, Description: "HTML included in message"},
+		},
+	})
+	email := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.org\r\n" +
+		"Subject: =?ISO-2022-JP?B?GyRCJDMkcyRLJEEkTxsoQg==?=\r\n" +
+		"Content-Language: de-AT\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Guten Tag, anbei der Bericht.\r\n"
+
+	scan := func(profile string) handlers.ScanEmailResult {
+		t.Helper()
+		var result handlers.ScanEmailResult
+		res := env.call(t, "scan_email", map[string]any{"content": email, "verbose": true, "profile": profile}, &result)
+		if res.IsError {
+			t.Fatalf("scan_email failed: %s", resultText(res))
+		}
+		return result
+	}
+
+	result := scan("")
+	lang := result.Language
+	if lang == nil || len(lang.Hits) != 2 || lang.Hits[0].Kind != "language" || lang.Hits[1].Kind != "locale" {
+		t.Fatalf("unexpected language section: %+v", lang)
+	}
+	if !slices.Equal(lang.Charsets, []string{"iso-2022-jp", "utf-8"}) || !slices.Equal(lang.Locales, []string{"ja"}) || !slices.Equal(lang.Languages, []string{"de"}) {
+		t.Errorf("charsets %v, locales %v, languages %v", lang.Charsets, lang.Locales, lang.Languages)
+	}
+	if lang.Adjustment != 0 || lang.Hits[0].Suppressed || result.Score != 7 || !result.IsSpam {
+		t.Errorf("without overrides spamd's verdict must stand: %+v, score %v", lang, result.Score)
+	}
+
+	// German and Japanese are acceptable, so both hits are discounted.
+	result = scan("international")
+	if !result.Language.Hits[0].Suppressed || !result.Language.Hits[1].Suppressed || result.Language.Adjustment != -6 || result.Score != 1 || result.IsSpam {
+		t.Errorf("expected both hits suppressed: %+v, score %v", result.Language, result.Score)
+	}
+
+	result = scan("locales-only")
+	if result.Language.Hits[0].Suppressed || !result.Language.Hits[1].Suppressed || result.Score != 3.8 || result.IsSpam {
+		t.Errorf("expected only the locale hit suppressed: %+v, score %v", result.Language, result.Score)
+	}
+
+	// Non-verbose scans under a profile with overrides fetch the rule
+	// scores too, so the verdict does not depend on verbose.
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Spam: true, Score: 7.0})
+	var quick handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": email, "profile": "international"}, &quick); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	reqs := env.spamd.Requests()
+	if cmd := reqs[len(reqs)-1].Command; cmd != "REPORT" || quick.Score != 1 || quick.IsSpam || quick.Language == nil || quick.Summary != "" {
+		t.Errorf("non-verbose scan sent %s: score %v, spam %v, language %+v", cmd, quick.Score, quick.IsSpam, quick.Language)
+	}
+	env.call(t, "scan_email", map[string]any{"content": email}, &quick)
+	reqs = env.spamd.Requests()
+	if cmd := reqs[len(reqs)-1].Command; cmd != "CHECK" || !quick.IsSpam {
+		t.Errorf("non-verbose scan without overrides sent %s, spam %v", cmd, quick.IsSpam)
+	}
+
+	// Scans without language or locale hits have no language section.
+	env.spamd.SetResponse("REPORT", spamdtest.Response{Score: 1.0, Rules: []spamdtest.Rule{{Name: "HTML_MESSAGE", Score: 1.0}}})
+	if result = scan(""); result.Language != nil {
+		t.Errorf("unexpected language section: %+v", result.Language)
+	}
+}
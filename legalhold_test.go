@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestLegalHold(t *testing.T) {
+	dir := t.TempDir()
+	quarantineCfg := config.QuarantineConfig{
+		Dir:       filepath.Join(dir, "quarantine"),
+		Key:       base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)),
+		Retention: 720 * time.Hour,
+	}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(dir, "history.db")}
+		cfg.Quarantine = quarantineCfg
+		cfg.Audit = config.AuditConfig{Path: filepath.Join(dir, "audit.log")}
+		cfg.Scheduler.Jobs = []config.ScheduledJob{
+			{Name: "history", Task: config.TaskPruneHistory, Schedule: "@every 1s", MaxAge: time.Nanosecond},
+		}
+	})
+	other := strings.Replace(testEmail, "alice@example.com", "mallory@example.net", 1)
+	sum := sha256.Sum256([]byte(testEmail))
+	hash := hex.EncodeToString(sum[:])
+
+	env.spamd.SetResponse("", spamdtest.Response{Spam: true, Score: 12, Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 12}}})
+	var held, notHeld handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, &held)
+	env.call(t, "scan_email", map[string]any{"content": other}, &notHeld)
+	if held.QuarantineID == "" || notHeld.QuarantineID == "" {
+		t.Fatal("messages not quarantined")
+	}
+
+	var result handlers.LegalHoldResult
+	res := env.call(t, "set_legal_hold", map[string]any{"sender": "Alice@example.com", "hold": true, "reason": "Case 2025-014"}, &result)
+	if res.IsError || !result.Hold || result.HistoryEntries != 1 || len(result.Quarantined) != 1 || result.Quarantined[0] != held.QuarantineID {
+		t.Fatalf("unexpected hold result: %+v (%s)", result, resultText(res))
+	}
+	// Placing the hold again changes no history entry
+	env.call(t, "set_legal_hold", map[string]any{"sender": "alice@example.com", "hold": true, "reason": "Case 2025-014"}, &result)
+	if result.HistoryEntries != 0 || len(result.Quarantined) != 1 {
+		t.Errorf("unexpected repeated hold result: %+v", result)
+	}
+
+	// The audit log records the change, with the sender redacted
+	var records listquery.Page[*audit.Record]
+	env.call(t, "query_audit_log", map[string]any{"filter": map[string]string{"tool": "set_legal_hold"}}, &records)
+	if records.Total != 2 || !strings.Contains(records.Items[1].Change, "legal hold: placed on sender ***@example.com (1 history entries, 1 quarantined messages): Case 2025-014") {
+		t.Errorf("hold not audited: %+v", records.Items)
+	}
+
+	// The scheduled prune keeps the held entry
+	env.handler.StartScheduler()
+	var status handlers.GetSchedulerStatusResult
+	deadline := time.Now().Add(5 * time.Second)
+	for env.call(t, "get_scheduler_status", map[string]any{}, &status); status.Jobs[0].Runs == 0; env.call(t, "get_scheduler_status", map[string]any{}, &status) {
+		if time.Now().After(deadline) {
+			t.Fatalf("prune_history did not run: %+v", status.Jobs)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	var page listquery.Page[*history.Entry]
+	env.call(t, "query_history", map[string]any{}, &page)
+	if page.Total != 1 || page.Items[0].Hash != hash || !page.Items[0].LegalHold {
+		t.Fatalf("unexpected history after pruning: %+v", page)
+	}
+	env.call(t, "query_history", map[string]any{"filter": map[string]string{"legal_hold": "false"}}, &page)
+	if page.Total != 0 {
+		t.Errorf("%d entries not under hold", page.Total)
+	}
+
+	// The quarantine purge keeps the held message, past its retention
+	var items listquery.Page[*quarantine.Item]
+	env.call(t, "list_quarantine", map[string]any{"filter": map[string]string{"legal_hold": "true"}}, &items)
+	if items.Total != 1 || items.Items[0].ID != held.QuarantineID {
+		t.Fatalf("unexpected held messages: %+v", items)
+	}
+	store, err := quarantine.Open(quarantineCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := store.Prune(time.Now().Add(time.Hour)); err != nil || n != 1 {
+		t.Errorf("prune removed %d messages: %v", n, err)
+	}
+	if remaining := store.Items(); len(remaining) != 1 || remaining[0].ID != held.QuarantineID || !remaining[0].LegalHold {
+		t.Errorf("unexpected messages after pruning: %+v", remaining)
+	}
+	store.Close()
+
+	// Once lifted, the entry is pruned by the next run
+	env.call(t, "set_legal_hold", map[string]any{"hash": hash, "hold": false, "reason": "Case 2025-014 closed"}, &result)
+	if result.Hold || result.HistoryEntries != 1 {
+		t.Errorf("unexpected release result: %+v", result)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for env.call(t, "query_history", map[string]any{}, &page); page.Total != 0; env.call(t, "query_history", map[string]any{}, &page) {
+		if time.Now().After(deadline) {
+			t.Fatalf("lifted entry not pruned: %+v", page)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	env.call(t, "list_quarantine", map[string]any{"filter": map[string]string{"legal_hold": "true"}}, &items)
+	if items.Total != 0 {
+		t.Errorf("hold not lifted from quarantined messages: %+v", items)
+	}
+
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"sender": "alice@example.com", "reason": "case"}, "hold is required"},
+		{map[string]any{"hold": true, "reason": "case"}, "one of hash, sender or quarantine_id is required"},
+		{map[string]any{"quarantine_id": held.QuarantineID, "sender": "alice@example.com", "hold": true, "reason": "case"}, "cannot be combined"},
+		{map[string]any{"hash": "abc", "hold": true, "reason": "case"}, "SHA-256"},
+		{map[string]any{"sender": "alice@example.com", "hold": true}, "reason is required"},
+		{map[string]any{"quarantine_id": "20250115T103000Z-0000000000000000", "hold": true, "reason": "case"}, "no quarantined message"},
+	} {
+		if res := env.call(t, "set_legal_hold", tc.args, nil); !res.IsError || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("set_legal_hold %v: expected %q, got %s", tc.args, tc.want, resultText(res))
+		}
+	}
+}
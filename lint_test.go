@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/sandbox"
+)
+
+// fakeSpamAssassin installs a shell script standing in for the spamassassin
+// command-line tool and returns its path. The script sees the sandbox site
+// directory as $site.
+func fakeSpamAssassin(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake spamassassin tool is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "spamassassin")
+	script := "#!/bin/sh\nfor arg; do case $arg in --siteconfigpath=*) site=${arg#*=};; esac; done\n" + body
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLintRules(t *testing.T) {
+	var rulesDir string
+	binary := fakeSpamAssassin(t, `
+[ -f "$site/init.pre" ] || { echo "warn: plugin loader missing"; exit 2; }
+[ -f "$site/local.cf" ] && [ ! -f "$site/live.cf" ] || { echo "warn: sandbox not isolated"; exit 2; }
+if grep -q bodyy "$site/local.cf"; then
+	echo "Oct 15 10:00:00.123 [42] warn: config: failed to parse line, skipping, in \"$site/local.cf\": bodyy LOCAL_TYPO /typo/"
+	echo "Oct 15 10:00:00.124 [42] warn: rules: failed to run LOCAL_BAD_RE test, skipping:"
+	echo "Oct 15 10:00:00.125 [42] warn: lint: 2 issues detected, please rerun with debug enabled for more information"
+	exit 2
+fi
+exit 0
+`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		rulesDir = cfg.SpamAssassin.RulesDirs[0]
+		cfg.SpamAssassin.Binary = binary
+	})
+	for name, content := range map[string]string{"init.pre": "loadplugin Mail::SpamAssassin::Plugin::URIDNSBL\n", "live.cf": "score LIVE 1\n"} {
+		if err := os.WriteFile(filepath.Join(rulesDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lint := func(t *testing.T, ruleText string) *sandbox.LintResult {
+		t.Helper()
+		var result sandbox.LintResult
+		if res := env.call(t, "lint_rules", map[string]any{"rules": ruleText}, &result); res.IsError {
+			t.Fatalf("lint_rules failed: %s", resultText(res))
+		}
+		return &result
+	}
+
+	good := "header LOCAL_TEST Subject =~ /test/i\ndescribe LOCAL_TEST Test rule\nscore LOCAL_TEST 2.0\n"
+	if result := lint(t, good); !result.Valid || len(result.Issues) != 0 || strings.Join(result.Rules, ",") != "LOCAL_TEST" {
+		t.Errorf("valid rules rejected: %+v", result)
+	}
+
+	bad := "# typo below\nbodyy LOCAL_TYPO /typo/\nbody LOCAL_BAD_RE /(unclosed/\nscore LOCAL_BAD_RE 1.0\n"
+	result := lint(t, bad)
+	if result.Valid || len(result.Issues) != 2 {
+		t.Fatalf("unexpected lint result: %+v", result)
+	}
+	if issue := result.Issues[0]; issue.Line != 2 || !strings.Contains(issue.Message, "failed to parse line") {
+		t.Errorf("parse error not located: %+v", issue)
+	}
+	if issue := result.Issues[1]; issue.Line != 3 || issue.Rule != "LOCAL_BAD_RE" {
+		t.Errorf("rule error not located: %+v", issue)
+	}
+
+	for _, ruleText := range []string{"", "loadplugin Evil /tmp/evil.pm", "header OK Subject =~ /x/\npyzor_path /tmp/evil"} {
+		if res := env.call(t, "lint_rules", map[string]any{"rules": ruleText}, nil); !res.IsError {
+			t.Errorf("%q: expected rejection", ruleText)
+		}
+	}
+}
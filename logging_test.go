@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+)
+
+func TestLogSinks(t *testing.T) {
+	syslogd, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syslogd.Close()
+
+	path := filepath.Join(t.TempDir(), "mcp.log")
+	cfg := &config.Config{
+		LogLevel:  "info",
+		Redaction: config.RedactionConfig{Emails: true, Bodies: true},
+		Logging: config.LoggingConfig{
+			File: config.LogFileConfig{Path: path, MaxSizeMB: 1, MaxBackups: 2},
+			Syslog: config.SyslogConfig{
+				Network:  "udp",
+				Address:  syslogd.LocalAddr().String(),
+				Facility: "mail",
+				AppName:  "spamassassin-mcp",
+			},
+		},
+	}
+	sinks, err := setupLogging(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		sinks.Close()
+		logrus.SetOutput(io.Discard)
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	}()
+
+	logrus.WithField("sender", "alice@example.com").Warn("Sender blocked")
+
+	buf := make([]byte, 64*1024)
+	syslogd.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := syslogd.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// mail (2) * 8 + warning (4) = 20
+	header := regexp.MustCompile(`^<20>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ spamassassin-mcp \d+ - - \{`)
+	msg := string(buf[:n])
+	if !header.MatchString(msg) || !strings.Contains(msg, `"msg":"Sender blocked"`) || !strings.Contains(msg, "***@example.com") {
+		t.Errorf("unexpected syslog message: %s", msg)
+	}
+
+	// Filling the file past 1MB rotates it to mcp.log.1.
+	filler := strings.Repeat("x", 1024)
+	for i := 0; i < 1100; i++ {
+		logrus.WithField("filler", filler).Info("Filling log")
+	}
+	for _, name := range []string{path, path + ".1"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s: %v", name, err)
+		}
+		if info.Size() > 1<<20 {
+			t.Errorf("%s is %d bytes, larger than max_size_mb", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("more backups kept than max_backups")
+	}
+	data, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "***@example.com") || strings.Contains(string(data), "alice@") {
+		t.Error("rotated file missing the redacted warning")
+	}
+}
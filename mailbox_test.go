@@ -0,0 +1,211 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/imaptest"
+	"spamassassin-mcp/internal/pop3test"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanMailbox(t *testing.T) {
+	mailbox := imaptest.NewServer("scanner", `pa"ss`)
+	t.Cleanup(mailbox.Close)
+	now := time.Now().UTC()
+	mailbox.AddMessage(strings.Replace(testEmail, "Quarterly report", "Old news", 1), now.AddDate(0, 0, -10))
+	mailbox.AddMessage(testEmail, now.AddDate(0, 0, -1))
+	mailbox.AddMessage("Subject: Huge\r\n\r\n"+strings.Repeat("x", 4096)+"\r\n", now)
+	mailbox.AddMessage("From: deals@promo.example\r\nSubject: You have won\r\nMessage-ID: <offer-7@promo.example>\r\n\r\npharmacy\r\n", now)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.IMAP = mailbox.Config()
+		cfg.IMAP.MaxMessages = 3
+		cfg.Security.MaxEmailSize = 2048
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		if strings.Contains(string(req.Body), "pharmacy") {
+			return spamdtest.Response{Spam: true, Score: 14.2, Rules: []spamdtest.Rule{{Name: "BAYES_99", Score: 14.2, Description: "Bayes spam probability is 99 to 100%"}}}
+		}
+		return spamdtest.Response{Score: 0.4}
+	})
+
+	var result handlers.ScanMailboxResult
+	res := env.call(t, "scan_mailbox", map[string]any{"limit": 3}, &result)
+	if res.IsError {
+		t.Fatalf("scan_mailbox failed: %s", resultText(res))
+	}
+	if result.Folder != "INBOX" || result.Matched != 4 || result.Scanned != 3 || result.Spam != 1 || result.Errors != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	spam, huge, ham := result.Messages[0], result.Messages[1], result.Messages[2]
+	if spam.UID != 4 || !spam.IsSpam || spam.Score != 14.2 || spam.From != "deals@promo.example" || spam.MessageID != "<offer-7@promo.example>" || !slices.Equal(spam.Rules, []string{"BAYES_99"}) {
+		t.Errorf("unexpected spam verdict: %+v", spam)
+	}
+	if huge.UID != 3 || !strings.Contains(huge.Error, "exceeds limit") {
+		t.Errorf("oversized message: %+v", huge)
+	}
+	if ham.UID != 2 || ham.IsSpam || ham.Subject != "Quarterly report" || ham.Date == nil {
+		t.Errorf("unexpected ham verdict: %+v", ham)
+	}
+	if len(env.spamd.Requests()) != 2 {
+		t.Errorf("spamd received %d scans, want 2", len(env.spamd.Requests()))
+	}
+
+	// The mailbox is left untouched and the oversized message never fetched.
+	for uid := uint32(1); uid <= 4; uid++ {
+		if mailbox.Seen(uid) {
+			t.Errorf("message %d was marked seen", uid)
+		}
+	}
+	for _, cmd := range mailbox.Commands() {
+		verb := strings.ToUpper(strings.Fields(cmd)[0])
+		if verb == "SELECT" || verb == "STORE" || verb == "EXPUNGE" || strings.HasPrefix(cmd, "UID FETCH 3 ") {
+			t.Errorf("unexpected command %q", cmd)
+		}
+	}
+
+	// since filters by received date and the default limit applies.
+	result = handlers.ScanMailboxResult{}
+	env.call(t, "scan_mailbox", map[string]any{"since": now.AddDate(0, 0, -2).Format("2006-01-02")}, &result)
+	if result.Matched != 3 || result.Scanned != 3 || result.Messages[2].UID != 2 {
+		t.Errorf("unexpected since result: %+v", result)
+	}
+
+	for _, args := range []map[string]any{{"limit": 4}, {"since": "yesterday"}} {
+		if res := env.call(t, "scan_mailbox", args, nil); !res.IsError {
+			t.Errorf("scan_mailbox accepted %v", args)
+		}
+	}
+}
+
+func TestScanMailboxLoginFailure(t *testing.T) {
+	mailbox := imaptest.NewServer("scanner", "secret")
+	t.Cleanup(mailbox.Close)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.IMAP = mailbox.Config()
+		cfg.IMAP.Password = "wrong"
+	})
+	res := env.call(t, "scan_mailbox", map[string]any{}, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "IMAP LOGIN failed") || strings.Contains(resultText(res), "wrong") {
+		t.Errorf("expected a login error without the password, got %s", resultText(res))
+	}
+
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "scan_mailbox", map[string]any{}, nil); !res.IsError || !strings.Contains(resultText(res), "imap.addr") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestScanMailboxPOP3(t *testing.T) {
+	maildrop := pop3test.NewServer("scanner", "secret")
+	t.Cleanup(maildrop.Close)
+	now := time.Now().UTC()
+	dated := func(subject string, date time.Time) string {
+		return "From: alice@example.com\r\nSubject: " + subject + "\r\nDate: " + date.Format(time.RFC1123Z) + "\r\n\r\nHello\r\n.hidden line\r\n"
+	}
+	maildrop.AddMessage(dated("Old news", now.AddDate(0, 0, -10)))
+	maildrop.AddMessage(dated("Yesterday", now.AddDate(0, 0, -1)))
+	maildrop.AddMessage("Subject: Huge\r\n\r\n" + strings.Repeat("x", 4096) + "\r\n")
+	maildrop.AddMessage("From: deals@promo.example\r\nSubject: You have won\r\n\r\npharmacy\r\n")
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.POP3 = maildrop.Config()
+		cfg.POP3.MaxMessages = 3
+		cfg.Security.MaxEmailSize = 2048
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		if strings.Contains(string(req.Body), "pharmacy") {
+			return spamdtest.Response{Spam: true, Score: 9.1, Rules: []spamdtest.Rule{{Name: "BAYES_99", Score: 9.1, Description: "Bayes spam probability is 99 to 100%"}}}
+		}
+		return spamdtest.Response{Score: 0.2}
+	})
+
+	// With only POP3 configured, it is the default source.
+	var result handlers.ScanMailboxResult
+	res := env.call(t, "scan_mailbox", map[string]any{"limit": 3}, &result)
+	if res.IsError {
+		t.Fatalf("scan_mailbox failed: %s", resultText(res))
+	}
+	if result.Source != "pop3" || result.Folder != "" || result.Matched != 4 || result.Scanned != 3 || result.Spam != 1 || result.Errors != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	spam, huge, ham := result.Messages[0], result.Messages[1], result.Messages[2]
+	if spam.Number != 4 || spam.UIDL != "uid-0004" || !spam.IsSpam || !slices.Equal(spam.Rules, []string{"BAYES_99"}) {
+		t.Errorf("unexpected spam verdict: %+v", spam)
+	}
+	if huge.Number != 3 || !strings.Contains(huge.Error, "exceeds limit") {
+		t.Errorf("oversized message: %+v", huge)
+	}
+	if ham.Number != 2 || ham.IsSpam || ham.Subject != "Yesterday" || ham.Date == nil {
+		t.Errorf("unexpected ham verdict: %+v", ham)
+	}
+	for _, req := range env.spamd.Requests() {
+		if strings.Contains(string(req.Body), "..hidden") {
+			t.Errorf("message was not dot-unstuffed: %q", req.Body)
+		}
+	}
+
+	// Nothing is deleted, the session is reset before quitting, and the
+	// oversized message is never retrieved.
+	commands := maildrop.Commands()
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, "DELE") || cmd == "RETR 3" {
+			t.Errorf("unexpected command %q", cmd)
+		}
+	}
+	if n := len(commands); n < 2 || commands[n-2] != "RSET" || commands[n-1] != "QUIT" {
+		t.Errorf("session did not end with RSET and QUIT: %v", commands)
+	}
+	if maildrop.Messages() != 4 {
+		t.Errorf("maildrop has %d messages, want 4", maildrop.Messages())
+	}
+
+	// since filters by the Date header; messages without one are kept.
+	maildrop.DisableUIDL()
+	result = handlers.ScanMailboxResult{}
+	env.call(t, "scan_mailbox", map[string]any{"source": "pop3", "since": now.AddDate(0, 0, -2).Format("2006-01-02")}, &result)
+	if result.Matched != 3 || result.Scanned != 3 || result.Messages[2].Number != 2 || result.Messages[0].UIDL != "" {
+		t.Errorf("unexpected since result: %+v", result)
+	}
+
+	for _, args := range []map[string]any{{"source": "imap"}, {"source": "smtp"}} {
+		if res := env.call(t, "scan_mailbox", args, nil); !res.IsError {
+			t.Errorf("scan_mailbox accepted %v", args)
+		}
+	}
+}
+
+func TestIMAPConfigValidation(t *testing.T) {
+	yaml := "imap:\n  addr: \"imap.example.com:143\"\n  tls: \"none\"\n  folder: \"\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"imap.tls: none sends the password in clear and is only allowed for a loopback server",
+		"imap.username: required when imap.addr is set",
+		`imap.folder: must be a non-empty name of printable ASCII characters, got ""`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestPOP3ConfigValidation(t *testing.T) {
+	yaml := "pop3:\n  addr: \"pop.example.com\"\n  tls: \"none\"\n  max_messages: 0\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{"pop3.addr:", "pop3.username: required when pop3.addr is set", "pop3.max_messages:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -11,14 +11,92 @@
 // The server provides the following MCP tools:
 //   - scan_email: Analyze email content for spam probability and rule matches
 //   - check_reputation: Check sender reputation and domain/IP blacklists
+//   - check_spf: Evaluate a sender domain's SPF policy for a connecting IP
+//   - check_dkim: Verify the DKIM signatures of a message
+//   - check_dmarc: Evaluate DMARC alignment and the requested disposition
+//   - check_arc: Validate the ARC chain added by forwarding intermediaries
+//   - check_bimi: Check the BIMI record, DMARC enforcement and VMC of a domain
+//   - analyze_headers: Reconstruct the Received hop chain and flag header anomalies
+//   - check_header_sanity: Score Message-ID, Date, Subject, mailer and HELO anomalies as weighted findings
+//   - extract_urls: Extract URLs, including obfuscated ones, and assess each one
+//   - analyze_attachments: List attachments with detected types, hashes and risk flags
+//   - analyze_mime: Report the MIME tree and flag boundary and nesting anomalies
+//   - scan_attachments_av: Scan decoded attachments for malware with ClamAV
+//   - detect_phishing: Rate phishing likelihood from heuristics with an evidence list
+//   - detect_homoglyphs: Flag mixed-script, confusable and IDN homograph spoofing of protected brands
+//   - extract_iocs: Collect IPs, domains, URLs, addresses and hashes as IOCs or STIX
+//   - publish_iocs: Publish the IOCs of a message as a MISP event
+//   - generate_arf_report: Wrap a scanned message in an ARF abuse report, without sending it
+//   - ingest_fbl_report: Scan and record the message of a feedback-loop complaint, optionally learning it
+//   - compare_emails: Measure the similarity of messages to group campaign samples
+//   - compare_engines: Scan a message with SpamAssassin and rspamd side by side
 //   - explain_score: Provide detailed explanation of spam score calculation
 //   - get_config: Retrieve current SpamAssassin configuration
-//   - update_rules: Update SpamAssassin rule definitions (defensive updates only)
+//   - get_rate_limits: Inspect global and per-client rate limiter state
+//   - get_stats: Report scan volumes, verdicts, latency and top rules
+//   - get_scheduler_status: Report the scheduled maintenance jobs and their last runs
+//   - get_peer_status: Report the reputation shared with peer instances
+//   - bayes_status: Report whether the Bayes database is trained
+//   - import_corpus: Train Bayes with a labeled mbox, Maildir or archive corpus in batches
+//   - query_history: Search the recorded verdicts of past scans
+//   - get_message_history: Look up prior verdicts for a message or sender
+//   - get_trends: Report spam volume and emerging rules over time windows
+//   - find_similar: Find near-duplicate campaign variants of a message in the scan history
+//   - list_quarantine: List the messages held in quarantine
+//   - inspect_quarantined: Review a quarantined message without releasing it
+//   - release_quarantined: Export a quarantined message for redelivery
+//   - set_legal_hold: Exempt scan history and quarantined messages from pruning
+//   - scan_mailbox: Scan the latest messages of a read-only IMAP folder or POP3 maildrop
+//   - scan_object: Scan an .eml or mbox object from allowed S3-compatible buckets
+//   - query_audit_log: Search the tamper-evident audit log
+//   - update_rules: Install signed rule updates with sa-update (defensive updates only)
+//   - add_welcomelist_entry: Welcomelist a trusted sender, also in local.cf
+//   - remove_welcomelist_entry: Remove a sender from the welcomelist
+//   - list_welcomelist: List welcomelisted senders with filtering and pagination
+//   - add_blocklist_entry: Blocklist a sender, domain or IP, also in local.cf
+//   - remove_blocklist_entry: Remove an entry from the blocklist
+//   - list_blocklist: List blocklisted senders, domains and IPs with filtering and pagination
 //   - test_rules: Test custom rules against sample emails in safe environment
+//   - get_rule_info: Look up a rule's definition, description, scores and source file
+//   - lint_rules: Check custom rules with spamassassin --lint before deployment
+//   - deploy_rules: Deploy custom rules to spamd, rolling back if the self-test fails
+//   - run_regression: Scan a labeled ham/spam corpus and report false positives and negatives
+//   - tune_threshold: Recommend a spam threshold from precision and recall on the corpus
+//   - parse_email: Return the canonical parsed representation of a message
+//   - get_scan_result: Poll the status and result of a deferred scan
+//   - list_scans: List deferred scans with filtering and pagination
+//
+// Installed rule files are also published as read-only MCP resources under
+// sa://rules/<file> (e.g. sa://rules/72_active.cf, sa://rules/local.cf), and
+// the sanitized effective configuration is available as sa-mcp://config.
+// Deferred scans of very large messages are exposed as sa-mcp://scans/<scan_id>.
+//
+// Prompt templates (triage_email, explain_email_score, draft_defensive_rule)
+// guide LLM clients through common analysis workflows using these tools.
+//
+// With maildir_watch.dir set, the server also scans messages as they are
+// delivered to that Maildir, records the verdicts in the scan history and
+// sends high-scoring ones to sessions as notifications/message.
+//
+// With siem.address set, every scan verdict is also exported to a SIEM
+// collector as a CEF or LEEF event over syslog. With taxii.api_root set, the
+// URLs, link domains and attachment hashes of spam are published to a TAXII
+// 2.1 collection as STIX indicators. With url_feeds configured, the URLs of
+// scanned messages are checked against local copies of the URLhaus and
+// PhishTank datasets, which are refreshed periodically.
+//
+// The jobs listed in scheduler.jobs run on cron schedules: rule updates with
+// sa-update, Bayes token expiry with sa-learn, and pruning of the
+// reputation caches and the scan history. Each run is recorded in the audit
+// log, and get_scheduler_status reports how the last one went.
+//
+// The binary runs the server by default (or with `serve`). For operations
+// without an MCP client, `scan file.eml` scans one message and prints the
+// result as JSON, and `check` verifies that spamd is reachable.
 //
 // All operations include comprehensive security controls:
 //   - Input validation and sanitization
-//   - Rate limiting (60 requests/minute with burst capacity)
+//   - Rate limiting (60 requests/minute globally, 30 per client, with burst capacity)
 //   - Email size limits (10MB maximum)
 //   - Timeout protection (60 second scan limit)
 //   - Audit logging of all operations
@@ -32,18 +110,43 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/sirupsen/logrus"
 
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/auth"
+	"spamassassin-mcp/internal/blocklist"
 	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/geoip"
 	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/health"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/logging"
+	"spamassassin-mcp/internal/maildir"
+	"spamassassin-mcp/internal/peer"
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/redact"
+	"spamassassin-mcp/internal/requestid"
+	"spamassassin-mcp/internal/rules"
+	"spamassassin-mcp/internal/siem"
 	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/stats"
+	"spamassassin-mcp/internal/taxii"
+	"spamassassin-mcp/internal/urlfeeds"
+	"spamassassin-mcp/internal/welcomelist"
 )
 
 // isRunningInContainer detects if the application is running inside a container.
@@ -66,7 +169,15 @@ func isRunningInContainer() bool {
 	return false
 }
 
-// main is the entry point for the SpamAssassin MCP server.
+// main is the entry point for the spamassassin-mcp command line; see
+// newRootCommand for its subcommands.
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the SpamAssassin MCP server.
 //
 // It initializes the configuration, sets up logging, creates the SpamAssassin
 // client, registers MCP tools, and starts the server with graceful shutdown support.
@@ -76,20 +187,24 @@ func isRunningInContainer() bool {
 //  2. Initialize structured JSON logging with configurable level
 //  3. Create and test SpamAssassin client connection
 //  4. Initialize MCP server with defensive security tools
-//  5. Set up signal handlers for graceful shutdown
+//  5. Set up signal handlers for graceful shutdown and configuration reload
 //  6. Start the MCP server and listen for connections
 //
 // Security: All components are initialized with security-first defaults and
 // comprehensive error handling to prevent information disclosure.
-func main() {
+func serve() {
 	// Initialize configuration from files and environment variables
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Setup structured JSON logging with configurable level
-	setupLogging(cfg.LogLevel)
+	// Setup structured JSON logging with configurable level, sinks and redaction
+	sinks, err := setupLogging(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer sinks.Close()
 
 	logrus.Info("Starting SpamAssassin MCP Server v1.0.0")
 
@@ -105,12 +220,121 @@ func main() {
 		Version: "1.0.0",
 	}, nil)
 
+	// Open the persistent, hash-chained audit log when configured
+	var auditLog *audit.Log
+	if cfg.Audit.Path != "" {
+		auditLog, err = audit.Open(cfg.Audit)
+		if err != nil {
+			logrus.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		logrus.Infof("Persistent audit log enabled at %s", cfg.Audit.Path)
+	}
+
+	// Collect scan statistics, restoring saved totals when persistence is configured
+	collector, err := stats.Open(cfg.Stats)
+	if err != nil {
+		logrus.Fatalf("Failed to open statistics: %v", err)
+	}
+	defer func() {
+		if err := collector.Close(); err != nil {
+			logrus.WithError(err).Error("Failed to save statistics")
+		}
+	}()
+
+	// Open the scan history store when configured
+	scanHistory, err := history.Open(cfg.History)
+	if err != nil {
+		logrus.Fatalf("Failed to open scan history: %v", err)
+	}
+	if scanHistory != nil {
+		defer scanHistory.Close()
+		logrus.Infof("Scan history enabled (%s)", cfg.History.Driver)
+	}
+
+	// Open the encrypted quarantine for high-scoring messages when configured
+	held, err := quarantine.Open(cfg.Quarantine)
+	if err != nil {
+		logrus.Fatalf("Failed to open quarantine: %v", err)
+	}
+	if held != nil {
+		defer held.Close()
+		logrus.Infof("Quarantining high-scoring messages in %s", cfg.Quarantine.Dir)
+	}
+
+	// Restore the sender welcomelist managed with the welcomelist tools
+	welcome, err := welcomelist.Open(cfg.Welcomelist)
+	if err != nil {
+		logrus.Fatalf("Failed to open welcomelist: %v", err)
+	}
+
+	// Restore the blocklist managed with the blocklist tools
+	blocked, err := blocklist.Open(cfg.Blocklist)
+	if err != nil {
+		logrus.Fatalf("Failed to open blocklist: %v", err)
+	}
+
+	// Export scan verdicts to the SIEM collector as CEF or LEEF events,
+	// sending what is still queued at shutdown
+	exporter, err := siem.New(cfg.SIEM)
+	if err != nil {
+		logrus.Fatalf("Failed to start SIEM export: %v", err)
+	}
+	if exporter != nil {
+		defer exporter.Close(cfg.Server.ShutdownTimeout)
+		logrus.Infof("Exporting scan verdicts to %s as %s events", cfg.SIEM.Address, strings.ToUpper(cfg.SIEM.Format))
+	}
+
+	// Accumulate the indicators of spam verdicts for the TAXII collection,
+	// publishing what is left at shutdown
+	feed, err := taxii.New(cfg.TAXII)
+	if err != nil {
+		logrus.Fatalf("Failed to set up TAXII publishing: %v", err)
+	}
+	if feed != nil {
+		defer feed.Flush()
+	}
+
+	// Load the local copies of the URLhaus and PhishTank datasets URLs are
+	// checked against; downloads start with the server
+	urlFeeds := urlfeeds.New(cfg.URLFeeds)
+	peers := peersync.New(cfg.PeerSync)
+
+	// Load the GeoIP databases the Received hops are located with
+	locator, err := geoip.Open(cfg.GeoIP)
+	if err != nil {
+		logrus.Fatalf("Failed to load GeoIP databases: %v", err)
+	}
+
 	// Initialize request handlers with security configuration and rate limiting
-	h := handlers.New(saClient, cfg.Security)
+	h := handlers.New(saClient, cfg, auditLog, collector, scanHistory, held, welcome, blocked, exporter, feed, urlFeeds, peers, locator)
+	defer h.Close()
+
+	// Run the scheduled maintenance jobs: rule updates, Bayes expiry and
+	// pruning of caches and history
+	h.StartScheduler()
+	if n := len(cfg.Scheduler.Jobs); n > 0 {
+		logrus.Infof("Scheduled %d maintenance jobs", n)
+	}
+
+	// Attribute every request to its client and API key in the audit log, and
+	// enforce claims-based tool policies for bearer token callers, then
+	// per-tool budgets and daily quotas; failed tool calls report the code of
+	// their error
+	server.AddReceivingMiddleware(h.AuditMiddleware, h.AuthorizationMiddleware, h.ToolLimitMiddleware, h.ErrorMiddleware)
+
+	// Track in-flight tool calls so shutdown can drain them
+	server.AddReceivingMiddleware(h.DrainMiddleware)
 
 	// Register only defensive security analysis tools (no offensive capabilities)
 	registerTools(server, h)
 
+	// Publish installed rule files and effective configuration as read-only resources
+	registerResources(server, h)
+
+	// Offer prompt templates that pre-wire the analysis tools for common workflows
+	registerPrompts(server, h)
+
 	// Create context for coordinated graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -124,36 +348,132 @@ func main() {
 		cancel()
 	}()
 
+	// Apply threshold, rate limit, sender list and log level changes on
+	// SIGHUP or, when enabled, as soon as the configuration file changes
+	go newConfigReloader(cfg, h, server).run(ctx)
+
+	// Scan messages as they are delivered to the watched Maildir, recording
+	// the verdicts in the scan history and notifying sessions of high scores
+	if cfg.MaildirWatch.Dir != "" {
+		watcher, err := maildir.New(cfg.MaildirWatch, cfg.Security.MaxEmailSize, func(ctx context.Context, name, content string) {
+			h.ScanDelivered(ctx, server, name, content)
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to watch Maildir: %v", err)
+		}
+		go watcher.Run(ctx)
+		logrus.Infof("Watching Maildir %s for delivered messages", cfg.MaildirWatch.Dir)
+	}
+
+	// Publish the accumulated indicators to the TAXII collection periodically
+	if feed != nil {
+		go feed.Run(ctx)
+		logrus.Infof("Publishing spam indicators to TAXII collection %s every %s", cfg.TAXII.CollectionID, cfg.TAXII.Interval)
+	}
+
+	// Refresh the URL feeds periodically
+	if urlFeeds != nil {
+		go urlFeeds.Run(ctx)
+		logrus.Info("Checking URLs against the configured URLhaus and PhishTank feeds")
+	}
+
+	// Fetch the reputation shared by peer instances periodically
+	if peers != nil {
+		go peers.Run(ctx)
+		logrus.Infof("Fetching reputation from %d peer instances every %s", len(cfg.PeerSync.Peers), cfg.PeerSync.Interval)
+	}
+
 	// Choose transport and handling based on environment
 	if isRunningInContainer() {
 		// Container mode: Use SSE transport for HTTP-based MCP communication
 		logrus.Infof("Starting MCP server with SSE transport on %s", cfg.Server.BindAddr)
 		
-		// Set up HTTP server for SSE transport
+		// Require API keys or bearer tokens on the HTTP endpoint when configured
+		authenticator := auth.New(cfg.Auth)
+		if authenticator.Enabled() {
+			logrus.WithFields(logrus.Fields{
+				"api_keys": len(cfg.Auth.APIKeys),
+				"oidc":     cfg.Auth.OIDC.Enabled(),
+			}).Info("HTTP authentication enabled")
+		} else {
+			logrus.Warn("No API keys or OIDC provider configured; HTTP endpoint is unauthenticated")
+		}
+
+		// Set up HTTP server for SSE transport. Each connection gets its own MCP
+		// session, and the remote address is recorded for per-client rate limits.
+		mux := http.NewServeMux()
+		mux.Handle("/mcp", peer.Middleware(authenticator.Middleware(mcp.NewSSEHandler(func(*http.Request) *mcp.Server {
+			return server
+		}))))
+		// Share the reputation in the scan history with peer instances
+		// presenting peer_sync.token
+		if peerHandler := h.PeerSyncHandler(); peerHandler != nil {
+			mux.Handle(peersync.Path, peerHandler)
+			logrus.Infof("Serving reputation to peer instances at %s", peersync.Path)
+		}
+		httpServer := &http.Server{Addr: cfg.Server.BindAddr, Handler: mux}
+
+		// Serve HTTPS when a certificate is configured, requiring trusted client
+		// certificates when a client CA bundle is set
+		tlsCfg := cfg.Server.TLS
+		if tlsCfg.Enabled() {
+			httpServer.TLSConfig, err = serverTLSConfig(tlsCfg)
+			if err != nil {
+				logrus.Fatalf("Failed to configure TLS: %v", err)
+			}
+			if tlsCfg.ClientCAFile != "" {
+				logrus.Info("Mutual TLS enabled; clients must present a trusted certificate")
+			}
+		}
+
 		go func() {
-			http.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
-				transport := mcp.NewLoggingTransport(
-					mcp.NewSSEServerTransport("/mcp", w),
-					os.Stderr,
-				)
-				if err := server.Run(ctx, transport); err != nil {
-					logrus.Errorf("SSE transport error: %v", err)
-				}
-			})
-			
-			logrus.Infof("HTTP server listening on %s", cfg.Server.BindAddr)
-			if err := http.ListenAndServe(cfg.Server.BindAddr, nil); err != nil {
+			logrus.Infof("HTTP server listening on %s (tls=%t)", cfg.Server.BindAddr, tlsCfg.Enabled())
+			var err error
+			if tlsCfg.Enabled() {
+				err = httpServer.ListenAndServeTLS(tlsCfg.CertFile, tlsCfg.KeyFile)
+			} else {
+				err = httpServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
 				logrus.Errorf("HTTP server error: %v", err)
 			}
 		}()
 		
-		// Keep container alive
+		// Serve liveness and readiness probes on the admin port so orchestrator
+		// health checks never touch the MCP endpoint
+		var adminServer *http.Server
+		var checker *health.Checker
+		if cfg.Server.Admin.BindAddr != "" {
+			checker = health.NewChecker(cfg.Server.Admin.ProbeInterval, cfg.Server.Admin.ProbeTimeout)
+			registerHealthChecks(checker, saClient, cfg)
+			go checker.Run(ctx)
+
+			adminServer = &http.Server{Addr: cfg.Server.Admin.BindAddr, Handler: checker.Handler()}
+			go func() {
+				logrus.Infof("Admin server listening on %s", cfg.Server.Admin.BindAddr)
+				if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logrus.Errorf("Admin server error: %v", err)
+				}
+			}()
+		}
+
+		// Keep container alive until shutdown is requested
 		<-ctx.Done()
+
+		shutdownCtx, stop := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer stop()
+		shutdownHTTP(shutdownCtx, server, h, httpServer, checker)
+		if adminServer != nil {
+			adminServer.Shutdown(shutdownCtx)
+		}
 	} else {
 		// Direct mode: Use stdio transport for client connections
 		logrus.Info("Starting MCP server with stdio transport")
+		if cfg.PeerSync.Token != "" {
+			logrus.Warnf("peer_sync.token is ignored: %s is only served by the HTTP transport, so peers cannot fetch this instance's reputation", peersync.Path)
+		}
 		transport := mcp.NewLoggingTransport(mcp.NewStdioTransport(), os.Stderr)
-		if err := server.Run(ctx, transport); err != nil {
+		if err := server.Run(ctx, transport); err != nil && !errors.Is(err, context.Canceled) {
 			logrus.Fatalf("Server error: %v", err)
 		}
 	}
@@ -161,13 +481,98 @@ func main() {
 	logrus.Info("SpamAssassin MCP Server stopped")
 }
 
-// setupLogging configures structured JSON logging with the specified level.
+// shutdownHTTP stops the HTTP transport gracefully: readiness fails so load
+// balancers stop routing new clients, new tool calls are rejected, in-flight
+// calls and deferred scans are drained, and finally the SSE streams are closed
+// so the HTTP server can stop. Steps still running when ctx is done are
+// abandoned.
+func shutdownHTTP(ctx context.Context, server *mcp.Server, h *handlers.Handler, httpServer *http.Server, checker *health.Checker) {
+	if checker != nil {
+		checker.SetDraining()
+	}
+
+	if err := h.Drain(ctx); err != nil {
+		logrus.Warnf("Drain incomplete, abandoning in-flight work: %v", err)
+	} else {
+		logrus.Info("All in-flight requests drained")
+	}
+
+	// SSE streams never go idle, so end the sessions before shutting the
+	// server down or Shutdown would wait for the full timeout
+	sessions := 0
+	for ss := range server.Sessions() {
+		ss.Close()
+		sessions++
+	}
+	logrus.Infof("Closed %d MCP sessions", sessions)
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logrus.Warnf("HTTP server shutdown: %v", err)
+	}
+}
+
+// registerHealthChecks adds the readiness checks served on /readyz: spamd
+// must answer PING and at least one rule file must be installed.
+func registerHealthChecks(checker *health.Checker, saClient *spamassassin.Client, cfg *config.Config) {
+	checker.Register("spamd", func(ctx context.Context) error {
+		return saClient.Ping()
+	})
+
+	catalog := rules.NewCatalog(cfg.SpamAssassin.RulesDirs)
+	checker.Register("rules", func(ctx context.Context) error {
+		files, err := catalog.Files()
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no rule files found in %s", strings.Join(cfg.SpamAssassin.RulesDirs, ", "))
+		}
+		return nil
+	})
+}
+
+// serverTLSConfig builds the TLS configuration for the HTTP transport. The
+// server certificate is loaded up front so a bad key pair fails at startup
+// rather than on the first handshake. When a client CA bundle is configured,
+// connections without a certificate signed by one of those CAs are rejected
+// during the handshake.
+func serverTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// setupLogging configures structured JSON logging with the configured level
+// and sinks. The returned sinks must be closed on exit.
 //
 // The logging configuration uses:
 //   - JSON formatter for structured, machine-readable logs
-//   - Standard output for container-friendly log collection
+//   - Standard output for container-friendly log collection, plus an
+//     optional rotating file and syslog server
 //   - Configurable log levels from debug to error
 //   - Default to info level for production safety
+//   - Redaction of email addresses, message bodies and, optionally, IP
+//     addresses before entries are formatted
 //
 // Log levels:
 //   - debug: Verbose debugging information
@@ -176,11 +581,24 @@ func main() {
 //   - error: Error conditions that require attention
 //
 // Security: Debug level may include sensitive information and should only
-// be used in development environments.
-func setupLogging(level string) {
+// be used in development environments unless redaction is enabled.
+func setupLogging(cfg *config.Config) (*logging.Sinks, error) {
+	sinks, err := logging.Open(cfg.Logging)
+	if err != nil {
+		return nil, err
+	}
+
 	logrus.SetFormatter(&logrus.JSONFormatter{})
-	logrus.SetOutput(os.Stdout)
+	logrus.AddHook(requestid.Hook{})
+	logrus.AddHook(redact.New(cfg.Redaction))
+	sinks.Install(logrus.StandardLogger())
 
+	setLogLevel(cfg.LogLevel)
+	return sinks, nil
+}
+
+// setLogLevel applies a configured log level, defaulting to info.
+func setLogLevel(level string) {
 	switch level {
 	case "debug":
 		logrus.SetLevel(logrus.DebugLevel)
@@ -195,6 +613,72 @@ func setupLogging(level string) {
 	}
 }
 
+// configReloader applies configuration changes to the running server on
+// SIGHUP and, when watch_config is set, whenever the configuration file is
+// written. Reloads are serialized, and one that fails to read or validate is
+// rejected, leaving the previous configuration in effect. Each applied
+// reload re-publishes the sa-mcp://config resource on server.
+type configReloader struct {
+	h      *handlers.Handler
+	server *mcp.Server
+	load   func() (*config.Config, error)
+
+	mu      sync.Mutex
+	current *config.Config
+}
+
+func newConfigReloader(cfg *config.Config, h *handlers.Handler, server *mcp.Server) *configReloader {
+	return &configReloader{h: h, server: server, load: config.Reload, current: cfg}
+}
+
+// run reloads on SIGHUP, and on file changes when enabled, until ctx is done.
+func (r *configReloader) run(ctx context.Context) {
+	if r.current.WatchConfig {
+		if config.Watch(func() { r.reload("file") }) {
+			logrus.Info("Watching configuration file for changes")
+		} else {
+			logrus.Warn("watch_config is set but no configuration file is in use")
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	for {
+		select {
+		case <-sigChan:
+			r.reload("sighup")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload loads the configuration and applies the settings that can change
+// without a restart; see config.Config.Reloaded.
+func (r *configReloader) reload(trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		logrus.WithError(err).WithField("trigger", trigger).Error("Configuration reload rejected; keeping previous configuration")
+		return err
+	}
+
+	if sections := r.current.RestartRequired(next); len(sections) > 0 {
+		logrus.WithField("sections", sections).Warn("Changed settings in these sections take effect only after a restart")
+	}
+	applied := r.current.Reloaded(next)
+	setLogLevel(applied.LogLevel)
+	r.h.Reload(applied)
+	r.current = applied
+	publishConfigResource(r.server, r.h)
+
+	logrus.WithField("trigger", trigger).Info("Configuration reloaded")
+	return nil
+}
+
 // registerTools registers all available MCP tools with the server.
 //
 // This function implements the defensive-only security posture by registering
@@ -206,53 +690,604 @@ func setupLogging(level string) {
 // Email Analysis Tools:
 //   - scan_email: Comprehensive spam analysis with rule matching
 //   - check_reputation: Sender and domain reputation verification
+//   - check_spf: SPF evaluation with include, redirect and macro handling
+//   - check_dkim: Per-signature DKIM verification with key lookup
+//   - check_dmarc: DMARC policy discovery, alignment and disposition
+//   - check_arc: Per-hop ARC-Seal and ARC-Message-Signature validation
+//   - check_bimi: BIMI record lookup and Verified Mark Certificate validation
+//   - analyze_headers: Received-chain forensics without scoring
+//   - check_header_sanity: Weighted header anomaly findings that complement SpamAssassin scores
+//   - extract_urls: URL extraction with URIBL and blocked-domain verdicts, with optional VirusTotal URL lookups and shortener unshortening
+//   - analyze_attachments: MIME decomposition, type detection and hashing, PDF active content, with optional VirusTotal hash lookups
+//   - analyze_mime: MIME part hierarchy with boundary, nesting and encoding anomalies, independent of SpamAssassin rules
+//   - scan_attachments_av: clamd INSTREAM scanning of decoded attachments, detection only
+//   - detect_phishing: Heuristic phishing likelihood with evidence
+//   - detect_homoglyphs: Unicode confusable and mixed-script detection with skeleton-normalized forms
+//   - extract_iocs: Indicator extraction with optional STIX 2.1 bundle output
+//   - compare_emails: Fuzzy-hash, structure and shared-marker campaign comparison
+//   - compare_engines: SpamAssassin and rspamd scores, verdicts and symbol overlap for migration evaluation
 //   - explain_score: Detailed score breakdown and rule explanations
+//   - parse_email: Canonical parsed-email representation without scoring
+//   - get_scan_result: Status and result of deferred (asynchronous) scans
+//   - list_scans: Paginated listing of deferred scans
+//   - query_history: Paginated search of recorded scan verdicts
+//   - get_message_history: Prior verdicts for a message hash or sender
+//   - get_trends: Time-bucketed spam volume, scores and emerging rules
+//   - find_similar: Fuzzy-hash matching of a sample against recorded scans
+//   - list_quarantine: Paginated listing of the encrypted quarantine
+//   - inspect_quarantined: Parsed content and verdict of a held message
+//   - release_quarantined: Raw content export of a held message, marked released; never delivered
+//   - set_legal_hold: Legal hold on the history entries and quarantined messages of a hash, sender or quarantine ID, recorded in the audit log
+//   - scan_mailbox: Verdicts for the latest IMAP or POP3 messages, fetched without marking them seen or deleting them
+//   - scan_object: Verdicts for the messages of an .eml or mbox object in S3-compatible storage
+//   - publish_iocs: MISP event creation from extracted indicators, tagged with a TLP level
+//   - generate_arf_report: RFC 5965 abuse report generation for the operator to submit
+//   - ingest_fbl_report: ARF complaint parsing, scanning and history recording, with optional Bayes training through spamd TELL
 //
 // Configuration Management Tools:
 //   - get_config: Read-only configuration inspection
-//   - update_rules: Defensive rule updates from trusted sources
+//   - get_rate_limits: Read-only rate limiter inspection
+//   - get_stats: Read-only runtime statistics
+//   - get_scheduler_status: Read-only schedule, next run and last outcome of each maintenance job
+//   - get_peer_status: Read-only state of the reputation shared with and fetched from peer instances
+//   - bayes_status: Read-only Bayes database statistics via sa-learn --dump magic
+//   - import_corpus: Batched Bayes training through spamd TELL from safelisted mbox and Maildir corpora or uploaded archives, with a dry run
+//   - query_audit_log: Read-only audit trail search and chain verification
+//   - update_rules: Defensive rule updates from GPG-verified sa-update channels
+//   - add_welcomelist_entry: Persistent sender welcomelist, written to local.cf with backup
+//   - remove_welcomelist_entry: Welcomelist entry removal
+//   - list_welcomelist: Paginated listing of managed and configured welcomelist entries
+//   - add_blocklist_entry: Persistent sender, domain and IP blocklist, written to local.cf with backup
+//   - remove_blocklist_entry: Blocklist entry removal
+//   - list_blocklist: Paginated listing of managed and configured blocklist entries
 //
 // Rule Development Tools:
 //   - test_rules: Safe testing of custom rules in isolated environment
+//   - get_rule_info: Rule definition and per-scoreset score lookup from installed .cf files
+//   - lint_rules: spamassassin --lint in an isolated configuration, with line numbers
+//   - deploy_rules: Versioned rule deployment with spamd reload, self-test and automatic rollback
+//   - run_regression: Detection quality gate over a labeled corpus with the current rules
+//   - tune_threshold: Precision, recall and F1 at candidate thresholds over the corpus
+//
+// Every tool carries MCP annotations so hosts can apply confirmation policies:
+// analysis tools are advertised as read-only, while update_rules,
+// deploy_rules, publish_iocs, ingest_fbl_report, import_corpus,
+// release_quarantined, set_legal_hold, add_welcomelist_entry and
+// add_blocklist_entry are marked as mutating (but non-destructive) and the
+// remove_*_entry tools as destructive. scan_email, scan_mailbox and
+// scan_object are mutating and not idempotent: every scan records history,
+// may quarantine the message, exports to the SIEM and TAXII feed and posts
+// tag webhooks. Tools that may cause SpamAssassin to query DNSBLs or update
+// mirrors, that query DNS directly (including the DNS blocklists and reverse
+// DNS checks of check_reputation), or that may look up AbuseIPDB or RDAP
+// (check_reputation) or VirusTotal (analyze_attachments, extract_urls) are
+// marked open-world.
 //
 // Security: All tools include comprehensive input validation, rate limiting,
-// and audit logging. No tools provide offensive capabilities or data modification.
+// and audit logging. No tools provide offensive capabilities; the mutating
+// tools only change the server's own state and SpamAssassin configuration,
+// and never send mail.
 func registerTools(server *mcp.Server, h *handlers.Handler) {
 	// Email analysis tools - core spam detection and analysis functionality
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "scan_email",
 		Description: "Analyze email content for spam probability and rule matches",
+		Annotations: scanAnnotations("Scan Email"),
 	}, h.ScanEmail)
-	
-	// TODO: Re-enable other tools once handlers are updated for MCP SDK v0.2.0
-	/*
-	mcp.AddTool(server, &mcp.Tool{
-		Name:        "check_reputation", 
+
+	addTool(server, &mcp.Tool{
+		Name:        "parse_email",
+		Description: "Parse an email into headers, MIME parts, URLs and authentication results",
+		Annotations: readOnlyAnnotations("Parse Email", false),
+	}, h.ParseEmail)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_scan_result",
+		Description: "Get the status and result of an asynchronous scan_email request",
+		Annotations: readOnlyAnnotations("Get Scan Result", false),
+	}, h.GetScanResult)
+
+	addTool(server, &mcp.Tool{
+		Name:        "list_scans",
+		Description: "List deferred scans with filtering, sorting and cursor pagination",
+		Annotations: readOnlyAnnotations("List Scans", false),
+	}, h.ListScans)
+
+	addTool(server, &mcp.Tool{
+		Name:        "query_history",
+		Description: "Search recorded scan verdicts by hash, sender, verdict, profile or time with sorting and cursor pagination",
+		Annotations: readOnlyAnnotations("Query Scan History", false),
+	}, h.QueryHistory)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_message_history",
+		Description: "Look up prior verdicts for a message, by hash or content, or for a sender",
+		Annotations: readOnlyAnnotations("Get Message History", false),
+	}, h.GetMessageHistory)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_trends",
+		Description: "Report time-bucketed spam volume, average score and emerging rule hits for the last hour, day or week",
+		Annotations: readOnlyAnnotations("Get Spam Trends", false),
+	}, h.GetTrends)
+
+	addTool(server, &mcp.Tool{
+		Name:        "find_similar",
+		Description: "Match the ssdeep-style fuzzy hash of a message body against the recorded scans to find near-duplicate campaign variants that exact hashes miss, with their verdicts and scan counts",
+		Annotations: readOnlyAnnotations("Find Similar Messages", false),
+	}, h.FindSimilar)
+
+	addTool(server, &mcp.Tool{
+		Name:        "list_quarantine",
+		Description: "List the messages held in quarantine by hash, sender, score, profile, release state or time with sorting and cursor pagination",
+		Annotations: readOnlyAnnotations("List Quarantine", false),
+	}, h.ListQuarantine)
+
+	addTool(server, &mcp.Tool{
+		Name:        "inspect_quarantined",
+		Description: "Return the verdict and parsed content (headers, MIME parts, URLs) of a quarantined message without releasing it",
+		Annotations: readOnlyAnnotations("Inspect Quarantined Message", false),
+	}, h.InspectQuarantined)
+
+	addTool(server, &mcp.Tool{
+		Name:        "release_quarantined",
+		Description: "Mark a quarantined message as released and return its raw content for the operator to redeliver; nothing is delivered or sent",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Release Quarantined Message",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.ReleaseQuarantined)
+
+	addTool(server, &mcp.Tool{
+		Name:        "set_legal_hold",
+		Description: "Place the scan history entries and quarantined messages of a message hash, sender or quarantine ID under legal hold, exempting them from retention and scheduled pruning, or lift the hold; the reason is recorded in the audit log",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Set Legal Hold",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.SetLegalHold)
+
+	addTool(server, &mcp.Tool{
+		Name:        "scan_mailbox",
+		Description: "Fetch the latest messages, or those received since a date, from the configured IMAP folder or POP3 maildrop and scan each; the IMAP folder is opened read-only and messages are not marked seen, and POP3 messages are never deleted",
+		Annotations: scanAnnotations("Scan Mailbox"),
+	}, h.ScanMailbox)
+
+	addTool(server, &mcp.Tool{
+		Name:        "scan_object",
+		Description: "Fetch an .eml or mbox object from a configured S3-compatible bucket, within its allowed prefixes, and scan its messages; objects are only read",
+		Annotations: scanAnnotations("Scan Object"),
+	}, h.ScanObject)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_reputation",
 		Description: "Check sender reputation and domain/IP blacklists",
+		Annotations: readOnlyAnnotations("Check Reputation", true),
 	}, h.CheckReputation)
-	
-	mcp.AddTool(server, &mcp.Tool{
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_spf",
+		Description: "Evaluate the SPF policy of a sender domain for a connecting IP and report the result and matched mechanism",
+		Annotations: readOnlyAnnotations("Check SPF", true),
+	}, h.CheckSPF)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_dkim",
+		Description: "Verify the DKIM signatures of an email and report the result of each signature",
+		Annotations: readOnlyAnnotations("Check DKIM", true),
+	}, h.CheckDKIM)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_dmarc",
+		Description: "Evaluate the DMARC policy of a message's From domain: SPF/DKIM alignment, disposition, percentage and report addresses",
+		Annotations: readOnlyAnnotations("Check DMARC", true),
+	}, h.CheckDMARC)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_arc",
+		Description: "Validate the ARC chain of a forwarded email and report each intermediary's seal, signature and authentication results",
+		Annotations: readOnlyAnnotations("Check ARC", true),
+	}, h.CheckARC)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_bimi",
+		Description: "Look up the BIMI record of a domain, check that its DMARC policy is enforcing and validate the Verified Mark Certificate it references",
+		Annotations: readOnlyAnnotations("Check BIMI", true),
+	}, h.CheckBIMI)
+
+	addTool(server, &mcp.Tool{
+		Name:        "analyze_headers",
+		Description: "Reconstruct the Received hop chain of an email with timestamps and delays, identify the originating IP and flag header anomalies",
+		Annotations: readOnlyAnnotations("Analyze Headers", true),
+	}, h.AnalyzeHeaders)
+
+	addTool(server, &mcp.Tool{
+		Name:        "check_header_sanity",
+		Description: "Check the headers of an email for missing, duplicate or malformed Message-ID and Date headers, Dates far from the Received timestamps, unencoded subjects, bulk mailer software and HELO inconsistencies, returned as findings weighted in SpamAssassin score points",
+		Annotations: readOnlyAnnotations("Check Header Sanity", false),
+	}, h.CheckHeaderSanity)
+
+	addTool(server, &mcp.Tool{
+		Name:        "extract_urls",
+		Description: "Extract the URLs of an email, including obfuscated ones and those in QR code images, and check each against URI blocklists and blocked domains, optionally following URL shortener links to their destination",
+		Annotations: readOnlyAnnotations("Extract URLs", true),
+	}, h.ExtractURLs)
+
+	addTool(server, &mcp.Tool{
+		Name:        "analyze_attachments",
+		Description: "List the attachments of an email with declared and detected types, size, SHA-256/MD5 hashes and flags for executables, double extensions, encrypted archives, macros and PDF JavaScript, launch actions, embedded files and form submissions",
+		Annotations: readOnlyAnnotations("Analyze Attachments", true),
+	}, h.AnalyzeAttachments)
+
+	addTool(server, &mcp.Tool{
+		Name:        "analyze_mime",
+		Description: "Return the MIME tree of an email with the content type, charset, transfer encoding and size of every part, and flag mismatched or colliding boundaries, hidden preamble and epilogue text, abusive nesting and invalid encodings",
+		Annotations: readOnlyAnnotations("Analyze MIME Structure", false),
+	}, h.AnalyzeMIME)
+
+	addTool(server, &mcp.Tool{
+		Name:        "scan_attachments_av",
+		Description: "Scan the decoded attachments of an email for malware with the configured ClamAV daemon and report the signatures matched; nothing is disinfected or quarantined",
+		Annotations: readOnlyAnnotations("Scan Attachments with ClamAV", false),
+	}, h.ScanAttachmentsAV)
+
+	addTool(server, &mcp.Tool{
+		Name:        "detect_phishing",
+		Description: "Rate the phishing likelihood of an email from link text mismatches, brand impersonation, credential forms, urgency language, Reply-To divergence and QR code links, with the evidence found",
+		Annotations: readOnlyAnnotations("Detect Phishing", false),
+	}, h.DetectPhishing)
+
+	addTool(server, &mcp.Tool{
+		Name:        "detect_homoglyphs",
+		Description: "Flag mixed-script domains and words, confusable characters in display names, subjects, link texts and URLs, and IDN homographs of the configured protected brands, reporting the skeleton each string is mistaken for",
+		Annotations: readOnlyAnnotations("Detect Homoglyphs", false),
+	}, h.DetectHomoglyphs)
+
+	addTool(server, &mcp.Tool{
+		Name:        "extract_iocs",
+		Description: "Extract the indicators of compromise of an email (originating and linked IPs, domains, URLs, sender and in-body email addresses, attachment hashes) as a structured set or a STIX 2.1 bundle",
+		Annotations: readOnlyAnnotations("Extract IOCs", false),
+	}, h.ExtractIOCs)
+
+	addTool(server, &mcp.Tool{
+		Name:        "publish_iocs",
+		Description: "Extract the indicators of compromise of an email and create a MISP event holding them as attributes, tagged with a TLP level and the configured tags; optionally only when the message scans as spam",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Publish IOCs",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  false,
+			OpenWorldHint:   boolPtr(true),
+		},
+	}, h.PublishIOCs)
+
+	addTool(server, &mcp.Tool{
+		Name:        "generate_arf_report",
+		Description: "Scan an email and wrap it in an RFC 5965 Abuse Reporting Format report (feedback type, source IP, reporting MTA and the original message or its headers), returned as text for the operator to submit; nothing is sent",
+		Annotations: readOnlyAnnotations("Generate ARF Report", true),
+	}, h.GenerateARFReport)
+
+	addTool(server, &mcp.Tool{
+		Name:        "ingest_fbl_report",
+		Description: "Parse an ARF feedback-loop complaint, extract and scan the reported message, record the complaint in the scan history and optionally train Bayes with the message as spam through spamd TELL",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Ingest FBL Report",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  false,
+			OpenWorldHint:   boolPtr(true),
+		},
+	}, h.IngestFBLReport)
+
+	addTool(server, &mcp.Tool{
+		Name:        "compare_emails",
+		Description: "Compare two to ten emails by content (shingles and SimHash fuzzy hash), MIME and HTML structure, shared URLs and shared template markers, and group the ones that belong to the same campaign",
+		Annotations: readOnlyAnnotations("Compare Emails", false),
+	}, h.CompareEmails)
+
+	addTool(server, &mcp.Tool{
+		Name:        "compare_engines",
+		Description: "Scan an email with both SpamAssassin and the configured rspamd worker and compare their scores, verdicts and the rules and symbols they hit, to help evaluate a migration",
+		Annotations: readOnlyAnnotations("Compare Engines", true),
+	}, h.CompareEngines)
+
+	addTool(server, &mcp.Tool{
 		Name:        "explain_score",
-		Description: "Explain how a spam score was calculated", 
+		Description: "Explain how a spam score was calculated",
+		Annotations: readOnlyAnnotations("Explain Score", true),
 	}, h.ExplainScore)
 
 	// Configuration management tools - read-only system inspection and defensive updates
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "update_rules",
-		Description: "Update SpamAssassin rule definitions",
+		Description: "Install rule updates from the configured sa-update channels with GPG verification, lint the result, compile and reload spamd when configured, and report the files and channel versions that changed",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Update Rules",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(true),
+		},
 	}, h.UpdateRules)
-	
-	mcp.AddTool(server, &mcp.Tool{
+
+	addTool(server, &mcp.Tool{
+		Name:        "add_welcomelist_entry",
+		Description: "Add a trusted sender address or *@domain pattern to the persistent welcomelist and write it to local.cf as welcomelist_from, backing up the previous file",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Add Welcomelist Entry",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.AddWelcomelistEntry)
+
+	addTool(server, &mcp.Tool{
+		Name:        "remove_welcomelist_entry",
+		Description: "Remove a sender from the persistent welcomelist and from local.cf, backing up the previous file",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Remove Welcomelist Entry",
+			DestructiveHint: boolPtr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.RemoveWelcomelistEntry)
+
+	addTool(server, &mcp.Tool{
+		Name:        "list_welcomelist",
+		Description: "List welcomelisted senders, both managed entries and the configured allowed_senders, with filtering, sorting and pagination",
+		Annotations: readOnlyAnnotations("List Welcomelist", false),
+	}, h.ListWelcomelist)
+
+	addTool(server, &mcp.Tool{
+		Name:        "add_blocklist_entry",
+		Description: "Add a sender address or pattern, domain or IP address to the persistent blocklist and write it to local.cf as blocklist_from or an IP rule, backing up the previous file",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Add Blocklist Entry",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.AddBlocklistEntry)
+
+	addTool(server, &mcp.Tool{
+		Name:        "remove_blocklist_entry",
+		Description: "Remove a sender, domain or IP address from the persistent blocklist and from local.cf, backing up the previous file",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Remove Blocklist Entry",
+			DestructiveHint: boolPtr(true),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.RemoveBlocklistEntry)
+
+	addTool(server, &mcp.Tool{
+		Name:        "list_blocklist",
+		Description: "List blocklisted senders, domains and IP addresses, both managed entries and the configured blocked_domains, with filtering, sorting and pagination",
+		Annotations: readOnlyAnnotations("List Blocklist", false),
+	}, h.ListBlocklist)
+
+	addTool(server, &mcp.Tool{
 		Name:        "get_config",
 		Description: "Retrieve current SpamAssassin configuration",
+		Annotations: readOnlyAnnotations("Get Configuration", false),
 	}, h.GetConfig)
 
+	addTool(server, &mcp.Tool{
+		Name:        "get_rate_limits",
+		Description: "Inspect global and per-client rate limiter state",
+		Annotations: readOnlyAnnotations("Get Rate Limits", false),
+	}, h.GetRateLimits)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_stats",
+		Description: "Report messages scanned, spam detected, average score, p95 latency, top rules hit and rate limit rejections",
+		Annotations: readOnlyAnnotations("Get Statistics", false),
+	}, h.GetStats)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_scheduler_status",
+		Description: "List the scheduled maintenance jobs (rule updates, Bayes expiry, cache and history pruning) with their schedule, next run and the time, duration and outcome of their last run",
+		Annotations: readOnlyAnnotations("Get Scheduler Status", false),
+	}, h.GetSchedulerStatus)
+
+	addTool(server, &mcp.Tool{
+		Name:        "get_peer_status",
+		Description: "Report whether this instance shares the reputation in its scan history with peer instances, and when the reputation of each configured peer was last fetched",
+		Annotations: readOnlyAnnotations("Get Peer Status", false),
+	}, h.GetPeerStatus)
+
+	addTool(server, &mcp.Tool{
+		Name:        "bayes_status",
+		Description: "Report Bayes database statistics from sa-learn: spam and ham learned, token count, last expiry and database size, and whether Bayes is trained enough to be used",
+		Annotations: readOnlyAnnotations("Bayes Status", false),
+	}, h.BayesStatus)
+
+	addTool(server, &mcp.Tool{
+		Name:        "import_corpus",
+		Description: "Train Bayes through spamd TELL with every message of an mbox, Maildir or message directory under bayes.import_dirs, or of an uploaded mbox, zip or tar archive, labeled as ham or spam; learns in batches with progress notifications, and dry_run reports how many messages would be learned",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Import Corpus",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  true,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.ImportCorpus)
+
+	addTool(server, &mcp.Tool{
+		Name:        "query_audit_log",
+		Description: "Query the persistent audit log by time, tool, method, actor or outcome and verify its hash chain",
+		Annotations: readOnlyAnnotations("Query Audit Log", false),
+	}, h.QueryAuditLog)
+
 	// Rule development tools - safe testing and validation in isolated environment
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "test_rules",
-		Description: "Test custom rules against sample emails",
+		Description: "Test custom rules against sample emails in a sandbox configuration and report the score change they cause for each email",
+		Annotations: readOnlyAnnotations("Test Rules", false),
 	}, h.TestRules)
-	*/
 
-	logrus.Info("Registered 1 defensive security tool (others temporarily disabled)")
-}
\ No newline at end of file
+	addTool(server, &mcp.Tool{
+		Name:        "get_rule_info",
+		Description: "Look up a SpamAssassin rule by name (e.g. URIBL_BLACK) in the installed rule files and return its definition, description, tflags, scores per scoreset and source files",
+		Annotations: readOnlyAnnotations("Get Rule Info", false),
+	}, h.GetRuleInfo)
+
+	addTool(server, &mcp.Tool{
+		Name:        "lint_rules",
+		Description: "Validate custom rule definitions with spamassassin --lint in an isolated temporary configuration and return parse errors with line numbers",
+		Annotations: readOnlyAnnotations("Lint Rules", false),
+	}, h.LintRules)
+
+	addTool(server, &mcp.Tool{
+		Name:        "deploy_rules",
+		Description: "Lint custom rules, deploy them as a new version of the managed rule file, reload spamd and verify with a GTUBE and ham self-test, rolling back to the previous version on any failure",
+		Annotations: &mcp.ToolAnnotations{
+			Title:           "Deploy Rules",
+			DestructiveHint: boolPtr(false),
+			IdempotentHint:  false,
+			OpenWorldHint:   boolPtr(false),
+		},
+	}, h.DeployRules)
+
+	addTool(server, &mcp.Tool{
+		Name:        "run_regression",
+		Description: "Scan the configured labeled corpus of ham and spam samples with the current rules and report false positives, false negatives and score distributions; optional limits turn the run into a pass/fail gate for rule updates",
+		Annotations: readOnlyAnnotations("Run Regression", true),
+	}, h.RunRegression)
+
+	addTool(server, &mcp.Tool{
+		Name:        "tune_threshold",
+		Description: "Scan the configured labeled corpus and report precision, recall and F1 at candidate spam thresholds, with a recommended threshold that stays within a false positive rate limit; the configured threshold is not changed",
+		Annotations: readOnlyAnnotations("Tune Threshold", true),
+	}, h.TuneThreshold)
+
+	logrus.Info("Registered 54 defensive security tools")
+}
+
+// addTool registers a tool whose errors are returned with a machine-readable
+// code (see handlers.ErrorMiddleware).
+func addTool[In, Out any](server *mcp.Server, tool *mcp.Tool, handler mcp.ToolHandlerFor[In, Out]) {
+	mcp.AddTool(server, tool, handlers.ReportErrors(handler))
+}
+
+// readOnlyAnnotations describes an analysis tool that does not modify any state.
+func readOnlyAnnotations(title string, openWorld bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:          title,
+		ReadOnlyHint:   true,
+		IdempotentHint: true,
+		OpenWorldHint:  boolPtr(openWorld),
+	}
+}
+
+// scanAnnotations describes the scanning tools. They never change the
+// message, but each call records it in the scan history and may quarantine,
+// export and route it, so calling one twice repeats those side effects.
+func scanAnnotations(title string) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		DestructiveHint: boolPtr(false),
+		OpenWorldHint:   boolPtr(true),
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// registerResources publishes SpamAssassin rule files as MCP resources.
+//
+// Each rule file found at startup is listed individually so clients can browse
+// them, and a sa://rules/{file} template covers files installed later (e.g. by
+// sa-update) without requiring a restart.
+//
+// Security: Resources are read-only; file names are validated against the
+// configured rule directories to prevent path traversal.
+func registerResources(server *mcp.Server, h *handlers.Handler) {
+	resources, err := h.RuleResources()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to enumerate rule files")
+	}
+	for _, resource := range resources {
+		server.AddResource(resource, h.ReadRuleFile)
+	}
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "rule_file",
+		URITemplate: handlers.RuleResourcePrefix + "{file}",
+		Description: "SpamAssassin rule file by name",
+		MIMEType:    "text/plain",
+	}, h.ReadRuleFile)
+
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "scan_result",
+		URITemplate: handlers.ScanResourcePrefix + "{scan_id}",
+		Description: "Status and result of a deferred email scan",
+		MIMEType:    "application/json",
+	}, h.ReadScanResource)
+
+	publishConfigResource(server, h)
+
+	logrus.Infof("Registered %d rule file resources", len(resources))
+}
+
+// publishConfigResource (re)publishes the sa-mcp://config resource.
+//
+// It must be called again whenever the configuration is reloaded: re-adding
+// the resource notifies connected clients that the resource list changed so
+// they re-read the new effective configuration. go-sdk v0.2.0 neither
+// handles resources/subscribe nor can send notifications/resources/updated,
+// so list_changed is the only notification clients get; sending updated to
+// subscribers needs a newer SDK.
+func publishConfigResource(server *mcp.Server, h *handlers.Handler) {
+	server.AddResource(h.ConfigResource(), h.ReadConfig)
+}
+
+// registerPrompts registers prompt templates for common email-analysis workflows.
+//
+// Each prompt embeds the submitted message and instructs the client which tools
+// to call and in what order, so LLM clients get consistent, structured analyses.
+//
+// Security: Prompts only reference defensive analysis tools. The rule-drafting
+// prompt is constrained to detection rules that are validated with test_rules
+// and never deployed automatically.
+func registerPrompts(server *mcp.Server, h *handlers.Handler) {
+	emailArg := &mcp.PromptArgument{
+		Name:        "email",
+		Description: "Raw email content including headers",
+		Required:    true,
+	}
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "triage_email",
+		Title:       "Triage this email",
+		Description: "Scan, check sender reputation and inspect structure, then give a verdict with recommended action",
+		Arguments: []*mcp.PromptArgument{
+			emailArg,
+			{Name: "context", Description: "Optional context, e.g. how the message was reported"},
+		},
+	}, h.TriageEmailPrompt)
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "explain_email_score",
+		Title:       "Explain why this message scored X",
+		Description: "Break down the SpamAssassin score of a message rule by rule",
+		Arguments: []*mcp.PromptArgument{
+			emailArg,
+			{Name: "score", Description: "Score the message was observed to receive, if known"},
+		},
+	}, h.ExplainScorePrompt)
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "draft_defensive_rule",
+		Title:       "Draft a custom rule to catch this pattern",
+		Description: "Draft a defensive SpamAssassin detection rule for a sample and validate it with test_rules",
+		Arguments: []*mcp.PromptArgument{
+			emailArg,
+			{Name: "pattern", Description: "Description of the pattern to detect"},
+		},
+	}, h.DraftRulePrompt)
+
+	logrus.Info("Registered 3 analysis prompts")
+}
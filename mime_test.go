@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/mimetree"
+)
+
+func TestAnalyzeMIME(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	const clean = "From: alice@example.com\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"This is a multi-part message in MIME format.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Hello\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>Hello</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"invoice.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0xLjQK\r\n" +
+		"--outer--\r\n"
+
+	var report mimetree.Report
+	res := env.call(t, "analyze_mime", map[string]any{"content": clean}, &report)
+	if res.IsError {
+		t.Fatalf("analyze_mime failed: %s", resultText(res))
+	}
+	if len(report.Parts) != 5 || report.Leaves != 3 || report.MaxDepth != 2 || len(report.Anomalies) != 0 {
+		t.Errorf("unexpected report of a clean message: %+v", report)
+	} else if root, alt, html, pdf := report.Parts[0], report.Parts[1], report.Parts[3], report.Parts[4]; root.ContentType != "multipart/mixed" ||
+		strings.Join(root.Children, ",") != "1.1,1.2" || alt.ContentType != "multipart/alternative" ||
+		strings.Join(alt.Children, ",") != "1.1.1,1.1.2" || html.TransferEncoding != "quoted-printable" || html.Charset != "utf-8" ||
+		html.Parent != "1.1" || pdf.Filename != "invoice.pdf" || pdf.Size != 9 || root.Preamble == 0 {
+		t.Errorf("unexpected MIME tree: %+v %+v %+v %+v", root, alt, html, pdf)
+	}
+	if !strings.Contains(resultText(res), "5 MIME parts (3 leaves), nested 2 levels deep, 0 anomalies") ||
+		!strings.Contains(resultText(res), "\n    1.1.2 text/html (12 bytes)") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	// An evasive message: the inner boundary collides with the outer one,
+	// text hides after the closing delimiter, the container claims base64,
+	// and the last multipart never finds its boundary or closes.
+	const evasive = "From: alice@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"abc\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"--abc\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"abcd\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"--abcd\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"visible\r\n" +
+		"--abcd--\r\n" +
+		"--abc\r\n" +
+		"Content-Type: multipart/related; boundary=\"nowhere\"\r\n" +
+		"\r\n" +
+		"no delimiter here\r\n" +
+		"--abc\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Transfer-Encoding: x-uuencode\r\n" +
+		"\r\n" +
+		"begin 644 x\r\n" +
+		"--abc--\r\n" +
+		"hidden text for the reader only\r\n"
+
+	res = env.call(t, "analyze_mime", map[string]any{"content": evasive}, &report)
+	if res.IsError {
+		t.Fatalf("analyze_mime failed: %s", resultText(res))
+	}
+	found := map[string]string{}
+	for _, a := range report.Anomalies {
+		found[a.Type] = a.Path
+	}
+	for kind, path := range map[string]string{
+		mimetree.BoundaryCollision:       "1.1",
+		mimetree.EncodedContainer:        "1.1",
+		mimetree.BoundaryNotFound:        "1.2",
+		mimetree.EpilogueContent:         "1",
+		mimetree.UnknownTransferEncoding: "1.3",
+		mimetree.DuplicateHeader:         "",
+		mimetree.MissingMIMEVersion:      "",
+	} {
+		if got, ok := found[kind]; !ok || got != path {
+			t.Errorf("%s: want anomaly at %q, got %v", kind, path, report.Anomalies)
+		}
+	}
+	if report.HighRisk != 4 || !strings.Contains(resultText(res), "boundary_collision [high] 1.1") {
+		t.Errorf("unexpected severity summary %d: %s", report.HighRisk, resultText(res))
+	}
+
+	// Nesting beyond what mail clients produce, left unterminated.
+	var nested strings.Builder
+	nested.WriteString("From: alice@example.com\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"b0\"\r\n\r\n")
+	for i := 0; i < 7; i++ {
+		nested.WriteString("--b" + string(rune('0'+i)) + "\r\nContent-Type: multipart/mixed; boundary=\"b" + string(rune('1'+i)) + "\"\r\n\r\n")
+	}
+	nested.WriteString("--b7\r\nContent-Type: text/plain\r\n\r\ndeep\r\n")
+	env.call(t, "analyze_mime", map[string]any{"content": nested.String()}, &report)
+	found = map[string]string{}
+	for _, a := range report.Anomalies {
+		found[a.Type] = a.Path
+	}
+	if report.MaxDepth != 8 || found[mimetree.DeepNesting] != "1.1.1.1.1.1.1.1.1" || found[mimetree.Unterminated] == "" {
+		t.Errorf("unexpected report of a deeply nested message: depth %d, %+v", report.MaxDepth, report.Anomalies)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/misp"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+// fakeMISP records the events created and the events published.
+type fakeMISP struct {
+	mu        sync.Mutex
+	events    []misp.Event
+	published []string
+}
+
+func (f *fakeMISP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "misp-key" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"name":"Authentication failed.","message":"Authentication failed. Please make sure you pass the API key of an API enabled user along in the Authorization header.","url":"/events/add"}`))
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/events/add":
+		var body struct {
+			Event misp.Event `json:"Event"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.events = append(f.events, body.Event)
+		body.Event.ID = "1482"
+		body.Event.UUID = "5f0c2b1e-8d7a-4c3e-9b1a-2f6d8e4a7c90"
+		json.NewEncoder(w).Encode(body)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/events/publish/"):
+		f.published = append(f.published, strings.TrimPrefix(r.URL.Path, "/events/publish/"))
+		w.Write([]byte(`{"saved":true,"success":true,"name":"Job queued","message":"Job queued"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPublishIOCs(t *testing.T) {
+	instance := &fakeMISP{}
+	srv := httptest.NewServer(instance)
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.MISP = config.MISPConfig{
+			URL:          srv.URL,
+			APIKey:       "misp-key",
+			Timeout:      5 * time.Second,
+			TLP:          "amber",
+			Tags:         []string{"source:spamassassin-mcp"},
+			Distribution: 0,
+			ThreatLevel:  3,
+			Publish:      true,
+		}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		if strings.Contains(string(req.Body), "pharmacy") {
+			return spamdtest.Response{Spam: true, Score: 12.5}
+		}
+		return spamdtest.Response{Score: 0.4}
+	})
+
+	var result handlers.PublishIOCsResult
+	res := env.call(t, "publish_iocs", map[string]any{"content": testEmail, "tlp": "red", "tags": []string{"campaign:q1"}}, &result)
+	if res.IsError {
+		t.Fatalf("publish_iocs failed: %s", resultText(res))
+	}
+	if result.EventID != "1482" || !result.Published || result.TLP != "red" ||
+		!slices.Equal(result.Tags, []string{"tlp:red", "source:spamassassin-mcp", "campaign:q1"}) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(instance.events) != 1 || !slices.Equal(instance.published, []string{"1482"}) {
+		t.Fatalf("unexpected MISP calls: %d events, published %v", len(instance.events), instance.published)
+	}
+	event := instance.events[0]
+	if event.Info != "Email indicators: Quarterly report <report-1@example.com>" || event.Distribution != "0" || event.ThreatLevelID != "3" || len(event.Tags) != 3 {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	attributes := make(map[string]string)
+	for _, attr := range event.Attributes {
+		attributes[attr.Value] = attr.Type
+		if attr.ToIDS {
+			t.Errorf("to_ids set without misp.to_ids: %+v", attr)
+		}
+	}
+	for value, typ := range map[string]string{"alice@example.com": "email-src", "example.com": "domain", "https://example.com/q1": "url"} {
+		if attributes[value] != typ {
+			t.Errorf("attribute %s: got type %q, want %q (%v)", value, attributes[value], typ, attributes)
+		}
+	}
+	if result.Attributes != len(event.Attributes) {
+		t.Errorf("attributes = %d, sent %d", result.Attributes, len(event.Attributes))
+	}
+
+	// Ham is not published when require_spam is set.
+	result = handlers.PublishIOCsResult{}
+	env.call(t, "publish_iocs", map[string]any{"content": testEmail, "require_spam": true}, &result)
+	if result.EventID != "" || result.Published || !strings.HasPrefix(result.Skipped, "not spam") || result.IsSpam == nil || *result.IsSpam {
+		t.Errorf("ham published: %+v", result)
+	}
+	spam := strings.Replace(testEmail, "the report is at", "cheap pharmacy at", 1)
+	result = handlers.PublishIOCsResult{}
+	env.call(t, "publish_iocs", map[string]any{"content": spam, "require_spam": true}, &result)
+	if result.EventID == "" || len(instance.events) != 2 {
+		t.Errorf("spam not published: %+v", result)
+	}
+
+	for _, tc := range []struct {
+		args map[string]any
+		want string
+	}{
+		{map[string]any{"content": testEmail, "tlp": "green"}, "less restrictive than the configured tlp:amber"},
+		{map[string]any{"content": testEmail, "tlp": "white"}, "tlp must be one of"},
+		{map[string]any{"content": testEmail, "tags": []string{"tlp:clear"}}, "set the TLP level with tlp"},
+		{map[string]any{"content": testEmail, "tags": []string{"a\nb"}}, "invalid tag"},
+	} {
+		if res := env.call(t, "publish_iocs", tc.args, nil); !res.IsError || !strings.Contains(resultText(res), tc.want) {
+			t.Errorf("publish_iocs %v: got %s, want an error containing %q", tc.args, resultText(res), tc.want)
+		}
+	}
+	if len(instance.events) != 2 {
+		t.Errorf("rejected calls reached MISP: %d events", len(instance.events))
+	}
+
+	// A rejected key surfaces MISP's message.
+	env = newTestEnv(t, func(cfg *config.Config) {
+		cfg.MISP = config.MISPConfig{URL: srv.URL, APIKey: "wrong", Timeout: 5 * time.Second, TLP: "amber", ThreatLevel: 3}
+	})
+	if res := env.call(t, "publish_iocs", map[string]any{"content": testEmail}, nil); !res.IsError || !strings.Contains(resultText(res), "Authentication failed") {
+		t.Errorf("expected an authentication error, got %s", resultText(res))
+	}
+}
+
+func TestMISPConfigValidation(t *testing.T) {
+	yaml := "misp:\n  url: \"http://misp.internal\"\n  tlp: \"white\"\n  tags: [\"tlp:green\"]\n  distribution: 4\n  threat_level: 0\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"misp.url: http sends the API key in clear and is only allowed for a loopback server",
+		"misp.api_key: required when misp.url is set",
+		`misp.tlp: must be one of clear, green, amber, amber+strict, red, got "white"`,
+		`misp.tags[0]: must be non-empty and not a TLP tag (set misp.tlp), got "tlp:green"`,
+		"misp.distribution: must be between 0 and 3, got 4",
+		"misp.threat_level: must be between 1 (high) and 4 (undefined), got 0",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
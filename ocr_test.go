@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/phishing"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+// fakeTesseract writes a shell script standing in for tesseract.
+func fakeTesseract(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tesseract tool is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "tesseract")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOCRImageSpam(t *testing.T) {
+	binary := fakeTesseract(t, `
+[ "$*" = "stdin stdout -l eng+deu" ] || { echo "unexpected arguments $*" >&2; exit 2; }
+cat >/dev/null
+printf 'Your mailbox is full.\n\n  Verify your account within 24 hours  \n'
+`)
+	ocrConfig := config.OCRConfig{
+		Enabled: true, Tesseract: binary, Languages: []string{"eng", "deu"},
+		Timeout: 5 * time.Second, Budget: 10 * time.Second, MaxImages: 1, MaxPixels: 1 << 20,
+	}
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.OCR = ocrConfig })
+
+	image := base64.StdEncoding.EncodeToString(qrPNG(t, [][]bool{{true, false}, {false, true}}, 8))
+	imageSpam := "From: Mail Admin <admin@mailbox-notice.example>\r\nTo: bob@example.org\r\nSubject: Notice\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/related; boundary=B1\r\n\r\n" +
+		"--B1\r\nContent-Type: text/html\r\n\r\n<p><img src=\"cid:a\"><img src=\"cid:b\"></p>\r\n" +
+		"--B1\r\nContent-Type: image/png\r\nContent-ID: <a>\r\nContent-Transfer-Encoding: base64\r\n\r\n" + image + "\r\n" +
+		"--B1\r\nContent-Type: image/png\r\nContent-ID: <b>\r\nContent-Transfer-Encoding: base64\r\n\r\n" + image + "\r\n" +
+		"--B1--\r\n"
+	want := "Your mailbox is full.\nVerify your account within 24 hours"
+
+	var scan handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": imageSpam, "ocr": true}, &scan); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if o := scan.OCR; o == nil || !o.ImageOnly || len(o.Images) != 1 || o.Images[0].Part != "1.2" || o.Text != want ||
+		!slices.Equal(o.Errors, []string{"ocr: images after the first 1 skipped"}) {
+		t.Fatalf("unexpected OCR result: %+v", scan.OCR)
+	}
+	// spamd scans the message with the text read as an extra part
+	requests := env.spamd.Requests()
+	body := string(requests[len(requests)-1].Body)
+	if !strings.Contains(body, "Content-Type: multipart/mixed; boundary=\"ocr-") ||
+		!strings.Contains(body, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\nContent-Disposition: inline\r\n\r\n"+strings.ReplaceAll(want, "\n", "\r\n")) ||
+		!strings.Contains(body, "Subject: Notice\r\n") || !strings.Contains(body, "\r\nContent-Type: multipart/related; boundary=B1\r\n") {
+		t.Errorf("OCR text not scanned with the message:\n%s", body)
+	}
+
+	var report phishing.Report
+	if res := env.call(t, "detect_phishing", map[string]any{"content": imageSpam, "ocr": true}, &report); res.IsError {
+		t.Fatalf("detect_phishing failed: %s", resultText(res))
+	} else if !strings.Contains(resultText(res), "OCR read 57 characters from 1 image(s)") {
+		t.Errorf("unexpected text: %s", resultText(res))
+	}
+	if !slices.ContainsFunc(report.Evidence, func(e phishing.Evidence) bool {
+		return e.Indicator == phishing.UrgencyLanguage && strings.Contains(e.Description, "within 24 hours")
+	}) {
+		t.Errorf("pressure language in the image not found: %+v", report.Evidence)
+	}
+
+	// Messages with text of their own are scanned unchanged
+	var plain handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail, "ocr": true}, &plain); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	requests = env.spamd.Requests()
+	if plain.OCR == nil || plain.OCR.ImageOnly || len(plain.OCR.Images) != 0 || strings.Contains(string(requests[len(requests)-1].Body), "ocr-") {
+		t.Errorf("message with text read: %+v", plain.OCR)
+	}
+
+	for name, configure := range map[string]func(*config.Config){
+		"disabled": nil,
+		"missing tesseract": func(cfg *config.Config) {
+			cfg.OCR = ocrConfig
+			cfg.OCR.Tesseract = filepath.Join(t.TempDir(), "missing")
+		},
+	} {
+		res := newTestEnv(t, configure).call(t, "scan_email", map[string]any{"content": imageSpam, "ocr": true}, nil)
+		code := ""
+		if sc, ok := res.StructuredContent.(map[string]any); ok {
+			code, _ = sc["code"].(string)
+		}
+		if !res.IsError || code != toolerr.NotConfigured {
+			t.Errorf("%s: got %s (%s)", name, resultText(res), code)
+		}
+	}
+}
+
+func TestOCRConfigValidation(t *testing.T) {
+	yaml := "ocr:\n  enabled: true\n  languages: [\"eng\", \"-c tessedit\"]\n  timeout: \"20s\"\n  budget: \"10s\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`ocr.languages[1]: must be a tesseract language such as eng or chi_sim, got "-c tessedit"`,
+		"ocr.budget: must be at least ocr.timeout, got 10s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/auth"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/peer"
+)
+
+const (
+	testIssuer   = "https://idp.example.com/"
+	testAudience = "spamassassin-mcp"
+)
+
+// testIdP publishes an RSA signing key as a JWKS document and mints tokens.
+type testIdP struct {
+	key    *rsa.PrivateKey
+	kid    string
+	server *httptest.Server
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key, kid: "test-key"}
+	idp.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) config() config.OIDCConfig {
+	return config.OIDCConfig{
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		JWKSURL:  idp.server.URL,
+	}
+}
+
+// token signs claims with RS256, filling in valid registered claims unless
+// overridden.
+func (idp *testIdP) token(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	full := map[string]any{
+		"iss": testIssuer,
+		"aud": testAudience,
+		"sub": "analyst@example.com",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+	return signRS256(t, idp.key, idp.kid, full)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCBearerToken(t *testing.T) {
+	idp := newTestIdP(t)
+	authenticator := auth.New(config.AuthConfig{
+		APIKeys: []config.APIKey{{Name: "ci", Key: "0123456789abcdef"}},
+		OIDC:    idp.config(),
+	})
+
+	ts := httptest.NewServer(authenticator.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tok := peer.TokenFrom(r.Context()); tok != nil {
+			io.WriteString(w, "sub:"+tok.Subject)
+			return
+		}
+		io.WriteString(w, "key:"+peer.Principal(r.Context()))
+	})))
+	defer ts.Close()
+
+	get := func(credential string) (int, string) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Authorization", "Bearer "+credential)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	if code, body := get(idp.token(t, nil)); code != http.StatusOK || body != "sub:analyst@example.com" {
+		t.Errorf("valid token: got %d %q", code, body)
+	}
+	if code, body := get("0123456789abcdef"); code != http.StatusOK || body != "key:ci" {
+		t.Errorf("API key alongside OIDC: got %d %q", code, body)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := map[string]string{
+		"wrong audience": idp.token(t, map[string]any{"aud": []string{"someone-else"}}),
+		"wrong issuer":   idp.token(t, map[string]any{"iss": "https://evil.example.com/"}),
+		"expired":        idp.token(t, map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}),
+		"not yet valid":  idp.token(t, map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}),
+		"forged":         signRS256(t, otherKey, idp.kid, map[string]any{"iss": testIssuer, "aud": testAudience, "sub": "x", "exp": time.Now().Add(time.Hour).Unix()}),
+		"alg none":       "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x"}`)) + ".",
+		"garbage":        "not-a-token",
+	}
+	for name, token := range rejected {
+		if code, _ := get(token); code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, code)
+		}
+	}
+}
+
+func TestToolPolicies(t *testing.T) {
+	policies := []config.ToolPolicy{{
+		Tools:  []string{"test_rules", "update_rules"},
+		Claim:  "realm_access.roles",
+		Values: []string{"analyst"},
+	}}
+	configure := func(cfg *config.Config) {
+		cfg.Auth.OIDC = config.OIDCConfig{
+			Issuer:       testIssuer,
+			Audience:     testAudience,
+			JWKSURL:      "http://127.0.0.1/jwks",
+			ToolPolicies: policies,
+		}
+	}
+	rulesArgs := map[string]any{
+		"rules":       "header LOCAL_TEST Subject =~ /report/\nscore LOCAL_TEST 1.0",
+		"test_emails": []string{testEmail},
+	}
+
+	viewer := peer.WithToken(context.Background(), &peer.Token{
+		Subject: "viewer@example.com",
+		Claims:  map[string]any{"realm_access": map[string]any{"roles": []any{"viewer"}}},
+	})
+	env := newTestEnvContext(t, viewer, configure)
+	res := env.call(t, "test_rules", rulesArgs, nil)
+	if !res.IsError || !strings.Contains(resultText(res), "Not authorized") {
+		t.Errorf("expected viewer to be denied test_rules, got %s", resultText(res))
+	}
+	if res := env.call(t, "parse_email", map[string]any{"content": testEmail}, nil); res.IsError {
+		t.Errorf("expected unrestricted tool to be allowed: %s", resultText(res))
+	}
+	if len(env.spamd.Requests()) != 0 {
+		t.Error("denied call reached spamd")
+	}
+
+	analyst := peer.WithToken(context.Background(), &peer.Token{
+		Subject: "analyst@example.com",
+		Claims:  map[string]any{"realm_access": map[string]any{"roles": []any{"viewer", "analyst"}}},
+	})
+	env = newTestEnvContext(t, analyst, configure)
+	if res := env.call(t, "test_rules", rulesArgs, nil); strings.Contains(resultText(res), "Not authorized") {
+		t.Errorf("expected analyst to be allowed test_rules, got %s", resultText(res))
+	}
+}
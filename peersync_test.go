@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/peersync"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+const testPeerToken = "0123456789abcdef0123456789abcdef"
+
+func TestPeerSync(t *testing.T) {
+	// Instance A shares the reputation in its history
+	a := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+		cfg.PeerSync = config.PeerSyncConfig{Token: testPeerToken, Window: 168 * time.Hour, MaxEntries: 100}
+	})
+	a.spamd.SetResponse("", spamdtest.Response{Spam: true, Score: 9, Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 9}}})
+	for range 2 {
+		a.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	}
+	peerHandler := a.handler.PeerSyncHandler()
+	if peerHandler == nil {
+		t.Fatal("peer sync handler not configured")
+	}
+	server := httptest.NewServer(peerHandler)
+	defer server.Close()
+
+	// The snapshot needs the token and holds domains and fingerprints but,
+	// without share_senders, no addresses
+	resp, err := http.Get(server.URL + peersync.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unauthenticated fetch returned %s", resp.Status)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+peersync.Path, nil)
+	req.Header.Set("Authorization", "Bearer "+testPeerToken)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot peersync.Snapshot
+	err = json.NewDecoder(resp.Body).Decode(&snapshot)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Senders) != 0 || len(snapshot.Domains) != 1 || *snapshot.Domains[0] != (peersync.Source{Value: "example.com", Scans: 2, Spam: 2, LastSeen: snapshot.Domains[0].LastSeen}) ||
+		len(snapshot.Fingerprints) != 1 || snapshot.Fingerprints[0].Scans != 2 {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	// Instance B fetches it, and reports it in check_reputation and
+	// find_similar
+	b := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+		cfg.PeerSync = config.PeerSyncConfig{
+			Window:     168 * time.Hour,
+			MaxEntries: 100,
+			Peers: []config.PeerConfig{
+				{Name: "site-a", URL: server.URL, Token: testPeerToken},
+				{Name: "site-c", URL: server.URL, Token: "wrong-token"},
+			},
+			Interval: time.Hour,
+			Timeout:  5 * time.Second,
+			MaxSize:  1 << 20,
+		}
+	})
+	if err := b.peers.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "peer site-c: fetch failed: 401 Unauthorized") {
+		t.Errorf("expected site-c to fail, got %v", err)
+	}
+
+	var reputation handlers.ReputationResult
+	res := b.call(t, "check_reputation", map[string]any{"sender": "carol@example.com", "skip_dns": true}, &reputation)
+	if len(reputation.Peers) != 1 || reputation.Peers[0].Peer != "site-a" || reputation.Peers[0].Kind != peersync.KindDomain || reputation.Peers[0].Spam != 2 {
+		t.Fatalf("unexpected peer reputation: %+v", reputation.Peers)
+	}
+	if reputation.Reputation != "unknown" || !strings.Contains(resultText(res), "Peer site-a: 2 of 2 scans of domain example.com were spam") {
+		t.Errorf("unexpected reputation: %s (%s)", reputation.Reputation, resultText(res))
+	}
+
+	// B never scanned the campaign itself
+	var similar handlers.FindSimilarResult
+	b.call(t, "find_similar", map[string]any{"content": testEmail}, &similar)
+	if similar.Scans != 0 || len(similar.PeerMatches) != 1 || similar.PeerMatches[0].Peer != "site-a" ||
+		similar.PeerMatches[0].Similarity != 100 || similar.PeerMatches[0].Spam != 2 {
+		t.Errorf("unexpected similar messages: %+v", similar)
+	}
+
+	var status handlers.PeerStatusResult
+	b.call(t, "get_peer_status", map[string]any{}, &status)
+	if status.Serving || len(status.Peers) != 2 || status.Peers[0].LastSync == nil || status.Peers[0].Domains != 1 ||
+		status.Peers[1].LastSync != nil || !strings.Contains(status.Peers[1].LastError, "401") {
+		t.Errorf("unexpected peer status: %+v", status)
+	}
+	a.call(t, "get_peer_status", map[string]any{}, &status)
+	if !status.Serving || status.ShareSenders || len(status.Peers) != 0 {
+		t.Errorf("unexpected serving status: %+v", status)
+	}
+
+	// Sharing is off by default
+	if res := newTestEnv(t, nil).call(t, "get_peer_status", map[string]any{}, nil); !res.IsError || !strings.Contains(resultText(res), "peer_sync") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestPeerSyncValidation(t *testing.T) {
+	yaml := `peer_sync:
+  token: "short"
+  interval: "10s"
+  peers:
+    - name: "site-a"
+      url: "http://peer.example.com:8080"
+      token: "secret"
+    - name: "site-a"
+      url: "ftp://peer.example.com"
+`
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"peer_sync.token: must be at least 32 characters",
+		"peer_sync.token: sharing reputation requires the scan history (set history.dsn)",
+		"peer_sync.interval: must be at least 1m, got 10s",
+		"peer_sync.peers[0].url: http sends the token in clear and is only allowed for a loopback server; use https",
+		`peer_sync.peers[1].name: duplicate peer name "site-a"`,
+		`peer_sync.peers[1].url: must be the base URL of the peer, such as https://mcp.example.com:8080, got "ftp://peer.example.com"`,
+		"peer_sync.peers[1].token: required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"spamassassin-mcp/internal/phishing"
+)
+
+const phishingEmail = "From: \"PayPal Security\" <service@paypa1-secure.com>\r\n" +
+	"Reply-To: recovery@mail-support.net\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: Urgent: unusual sign-in activity\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=B1\r\n" +
+	"\r\n" +
+	"--B1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your account will be suspended within 24 hours unless you verify your account.\r\n" +
+	"--B1\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Sign in at <a href=\"http://203.0.113.9/login\">https://www.paypal.com/signin</a> or below.</p>\r\n" +
+	"<form action=\"https://collect.paypa1-secure.com/post\"><input name=\"email\"><input type=\"password\" name=\"pw\"></form>\r\n" +
+	"--B1--\r\n"
+
+const paypalEmail = "From: PayPal <service@paypal.com>\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: Your receipt\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>View your receipt at <a href=\"https://www.paypal.com/activity\">paypal.com</a>.</p>\r\n" +
+	"<p>Attached: <a href=\"https://www.paypal.com/r/1\">receipt.pdf</a></p>\r\n"
+
+func TestDetectPhishing(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	detect := func(t *testing.T, content string) *phishing.Report {
+		t.Helper()
+		var report phishing.Report
+		if res := env.call(t, "detect_phishing", map[string]any{"content": content}, &report); res.IsError {
+			t.Fatalf("detect_phishing failed: %s", resultText(res))
+		}
+		return &report
+	}
+
+	report := detect(t, phishingEmail)
+	found := make(map[string]phishing.Evidence)
+	for _, e := range report.Evidence {
+		found[e.Indicator] = e
+	}
+	for _, indicator := range []string{
+		phishing.LinkTextMismatch,
+		phishing.BrandImpersonation,
+		phishing.CredentialForm,
+		phishing.UrgencyLanguage,
+		phishing.ReplyToDivergence,
+	} {
+		if _, ok := found[indicator]; !ok {
+			t.Errorf("missing %s evidence: %+v", indicator, report.Evidence)
+		}
+	}
+	if e := found[phishing.UrgencyLanguage]; e.Weight != 0.2 {
+		t.Errorf("urgency weight = %v, want 0.2 for several phrases", e.Weight)
+	}
+	// 1 - (0.65 * 0.65 * 0.6 * 0.8 * 0.85)
+	if report.Likelihood != 0.83 || report.Level != phishing.High {
+		t.Errorf("likelihood = %v (%s), want 0.83 (high)", report.Likelihood, report.Level)
+	}
+
+	// Mail from the brand itself, and links whose text is a file name or
+	// the same site, are not evidence.
+	for name, content := range map[string]string{"brand": paypalEmail, "plain": testEmail} {
+		if report := detect(t, content); report.Likelihood != 0 || report.Level != phishing.Low || len(report.Evidence) != 0 {
+			t.Errorf("%s: unexpected report %+v", name, report)
+		}
+	}
+}
+
+func TestLinkTextMismatches(t *testing.T) {
+	email := "From: Support <support@example.org>\r\nTo: bob@example.org\r\nSubject: Your invoice\r\n" +
+		"Content-Type: text/html\r\n\r\n" +
+		"<p><a href=\"https://www.paypal.com.account-check.example/login\">www.paypal.com</a>\r\n" +
+		"<a href=\"https://www.paypal.com.account-check.example/login\">Log in to <b>PayPal.com</b></a>\r\n" +
+		"<a href=\"https://www.paypal.com.account-check.example/login\">www.paypal.com</a>\r\n" +
+		"<a href=\"http://203.0.113.9/x\">https://appleid.apple.com/</a>\r\n" +
+		"<a href=\"www.example.net/a\">example.net</a> <a href=\"https://docs.example.org/\">invoice.pdf</a>\r\n" +
+		"<a href=\"mailto:billing@evil.example\">billing@example.org</a></p>\r\n"
+
+	env := newTestEnv(t, nil)
+	var report phishing.Report
+	if res := env.call(t, "detect_phishing", map[string]any{"content": email}, &report); res.IsError {
+		t.Fatalf("detect_phishing failed: %s", resultText(res))
+	}
+	want := []phishing.LinkMismatch{
+		{Part: "1", Text: "www.paypal.com", TextDomain: "paypal.com", Href: "https://www.paypal.com.account-check.example/login", HrefDomain: "account-check.example"},
+		{Part: "1", Text: "Log in to PayPal.com", TextDomain: "paypal.com", Href: "https://www.paypal.com.account-check.example/login", HrefDomain: "account-check.example"},
+		{Part: "1", Text: "https://appleid.apple.com/", TextDomain: "apple.com", Href: "http://203.0.113.9/x", HrefDomain: "203.0.113.9"},
+	}
+	if !slices.Equal(report.LinkMismatches, want) {
+		t.Errorf("got mismatches %+v", report.LinkMismatches)
+	}
+	var evidence []string
+	for _, e := range report.Evidence {
+		if e.Indicator == phishing.LinkTextMismatch {
+			evidence = append(evidence, e.Description)
+		}
+	}
+	if len(evidence) != 3 || evidence[2] != `link text "https://appleid.apple.com/" names apple.com but the link goes to http://203.0.113.9/x` {
+		t.Errorf("unexpected evidence: %q", evidence)
+	}
+}
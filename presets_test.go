@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScoringPresets(t *testing.T) {
+	lenient := 4.5
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.AllowedUsers = []string{"alice"}
+		cfg.SpamAssassin.CollaborativeFilters = config.CollaborativeFiltersConfig{EnabledUser: "cf-on"}
+		cfg.Profiles = map[string]config.Profile{"balanced": {Threshold: &lenient}}
+	})
+	env.spamd.SetResponse("", spamdtest.Response{Score: 4.0})
+
+	for _, tc := range []struct {
+		profile   string
+		threshold float64
+		spam      bool
+		user      string
+		setting   string
+	}{
+		// aggressive enables the collaborative filters
+		{"Aggressive", 3.0, true, "cf-on", "enable"},
+		// A configured profile replaces the preset of the same name
+		{"balanced", lenient, false, "", ""},
+		// No disabled_user is configured, so spamd's own setting applies
+		{"permissive", 8.0, false, "", ""},
+	} {
+		var result handlers.ScanEmailResult
+		res := env.call(t, "scan_email", map[string]any{"content": testEmail, "profile": tc.profile, "verbose": true}, &result)
+		if res.IsError {
+			t.Fatalf("%s: scan_email failed: %s", tc.profile, resultText(res))
+		}
+		if result.Profile != strings.ToLower(tc.profile) || result.Threshold != tc.threshold || result.IsSpam != tc.spam {
+			t.Errorf("%s: unexpected result: profile %q, threshold %v, spam %v", tc.profile, result.Profile, result.Threshold, result.IsSpam)
+		}
+		reqs := env.spamd.Requests()
+		if user := reqs[len(reqs)-1].Headers.Get("User"); user != tc.user {
+			t.Errorf("%s: scanned as %q, want %q", tc.profile, user, tc.user)
+		}
+		if cf := result.CollaborativeFilters; cf == nil || cf.Setting != tc.setting {
+			t.Errorf("%s: unexpected collaborative filters: %+v", tc.profile, cf)
+		}
+	}
+
+	// A requested user replaces the preset's collaborative filters user
+	var result handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "profile": "aggressive", "user": "alice", "verbose": true}, &result)
+	reqs := env.spamd.Requests()
+	if user := reqs[len(reqs)-1].Headers.Get("User"); user != "alice" || result.CollaborativeFilters.Setting != "" {
+		t.Errorf("scanned as %q with setting %q, want alice", user, result.CollaborativeFilters.Setting)
+	}
+}
+
+func TestProfileCollaborativeFiltersValidation(t *testing.T) {
+	yaml := `spamassassin:
+  collaborative_filters:
+    disabled_user: "cf-off"
+profiles:
+  soc:
+    collaborative_filters: "enable"
+  finance:
+    spamd_user: "finance"
+    collaborative_filters: "disable"
+  support:
+    collaborative_filters: "off"
+`
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"profiles.soc.collaborative_filters: enable needs spamassassin.collaborative_filters.enabled_user",
+		"profiles.finance.collaborative_filters: cannot be combined with spamd_user; both select the spamd user",
+		`profiles.support.collaborative_filters: must be "enable" or "disable", got "off"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
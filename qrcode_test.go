@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/phishing"
+	"spamassassin-mcp/internal/qrcode"
+	"spamassassin-mcp/internal/urls"
+)
+
+// qrLayout is the block structure of a QR code version and error
+// correction level.
+type qrLayout struct {
+	version, level  int // level bits: 1 L, 0 M, 3 Q, 2 H
+	blocks, ecc     int
+	alignment       []int
+	totalCodewords  int
+	countBits, mask int
+}
+
+// encodeQR encodes text as a byte segment and returns the modules of the
+// code, row by row.
+func encodeQR(t *testing.T, text string, l qrLayout) [][]bool {
+	t.Helper()
+	size := 17 + 4*l.version
+	dataCodewords := l.totalCodewords - l.blocks*l.ecc
+
+	// Data bits: mode, count, bytes, terminator and padding
+	var bits []bool
+	put := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	put(4, 4)
+	put(len(text), l.countBits)
+	for i := 0; i < len(text); i++ {
+		put(int(text[i]), 8)
+	}
+	if len(bits) > dataCodewords*8 {
+		t.Fatalf("%d bytes do not fit version %d", len(text), l.version)
+	}
+	put(0, min(4, dataCodewords*8-len(bits)))
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	data := make([]byte, 0, dataCodewords)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for _, bit := range bits[i : i+8] {
+			b <<= 1
+			if bit {
+				b |= 1
+			}
+		}
+		data = append(data, b)
+	}
+	for pad := byte(0xec); len(data) < dataCodewords; pad ^= 0xec ^ 0x11 {
+		data = append(data, pad)
+	}
+
+	// Reed-Solomon error correction per block, then interleaving
+	gfMul := func(x, y byte) byte {
+		var z byte
+		for i := 7; i >= 0; i-- {
+			z = z<<1 ^ (z>>7)*0x1d
+			z ^= (y >> i & 1) * x
+		}
+		return z
+	}
+	divisor := make([]byte, l.ecc)
+	divisor[l.ecc-1] = 1
+	root := byte(1)
+	for i := 0; i < l.ecc; i++ {
+		for j := range divisor {
+			divisor[j] = gfMul(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	short := l.blocks - l.totalCodewords%l.blocks
+	shortLen := l.totalCodewords / l.blocks
+	var blocks [][]byte
+	for i, k := 0, 0; i < l.blocks; i++ {
+		n := shortLen - l.ecc
+		if i >= short {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		rem := make([]byte, l.ecc)
+		for _, b := range block {
+			factor := b ^ rem[0]
+			rem = append(rem[1:], 0)
+			for j := range rem {
+				rem[j] ^= gfMul(divisor[j], factor)
+			}
+		}
+		if i < short {
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, rem...))
+	}
+	var codewords []byte
+	for i := 0; i <= shortLen; i++ {
+		for j, block := range blocks {
+			if i != shortLen-l.ecc || j >= short {
+				codewords = append(codewords, block[i])
+			}
+		}
+	}
+
+	modules := make([][]bool, size)
+	function := make([][]bool, size)
+	for i := range modules {
+		modules[i], function[i] = make([]bool, size), make([]bool, size)
+	}
+	set := func(x, y int, dark bool) {
+		modules[y][x], function[y][x] = dark, true
+	}
+	// ring returns the ring of a pattern (dx, dy) lies on
+	ring := func(dx, dy int) int {
+		return max(dx, -dx, dy, -dy)
+	}
+	for i := 0; i < size; i++ {
+		set(6, i, i%2 == 0)
+		set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && y >= 0 && x < size && y < size {
+					d := ring(dx, dy)
+					set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	last := len(l.alignment) - 1
+	for i, y := range l.alignment {
+		for j, x := range l.alignment {
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					set(x+dx, y+dy, ring(dx, dy) != 1)
+				}
+			}
+		}
+	}
+	format := l.level<<3 | l.mask
+	rem := format
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	format = (format<<10 | rem) ^ 0x5412
+	bit := func(v, i int) bool { return v>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		set(8, i, bit(format, i))
+	}
+	set(8, 7, bit(format, 6))
+	set(8, 8, bit(format, 7))
+	set(7, 8, bit(format, 8))
+	for i := 9; i < 15; i++ {
+		set(14-i, 8, bit(format, i))
+	}
+	for i := 0; i < 8; i++ {
+		set(size-1-i, 8, bit(format, i))
+	}
+	for i := 8; i < 15; i++ {
+		set(8, size-15+i, bit(format, i))
+	}
+	set(8, size-8, true)
+	if l.version >= 7 {
+		rem := l.version
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		v := l.version<<12 | rem
+		for i := 0; i < 18; i++ {
+			a, b := size-11+i%3, i/3
+			set(a, b, bit(v, i))
+			set(b, a, bit(v, i))
+		}
+	}
+
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = size - 1 - vert
+				}
+				if function[y][x] {
+					continue
+				}
+				if i < len(codewords)*8 {
+					modules[y][x] = codewords[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+				// Mask 2: x % 3 == 0
+				if x%3 == 0 {
+					modules[y][x] = !modules[y][x]
+				}
+			}
+		}
+	}
+	return modules
+}
+
+// qrPNG renders modules as a PNG with a four-module quiet zone.
+func qrPNG(t *testing.T, modules [][]bool, scale int) []byte {
+	t.Helper()
+	size := (len(modules) + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			mx, my := x/scale-4, y/scale-4
+			c := color.Gray{Y: 0xff}
+			if mx >= 0 && my >= 0 && mx < len(modules) && my < len(modules) && modules[my][mx] {
+				c = color.Gray{Y: 0x10}
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestQRCodeURLs(t *testing.T) {
+	// Version 2-M: one block of 28 data and 16 error correction codewords.
+	// Version 7-Q: two blocks of 14 and four of 15 data codewords with 18
+	// error correction codewords each, alignment patterns and version
+	// information.
+	v2 := qrLayout{version: 2, level: 0, blocks: 1, ecc: 16, totalCodewords: 44, countBits: 8, mask: 2, alignment: []int{6, 18}}
+	v7 := qrLayout{version: 7, level: 3, blocks: 6, ecc: 18, totalCodewords: 196, countBits: 8, mask: 2, alignment: []int{6, 22, 38}}
+
+	short := "https://evil.example/q"
+	long := "https://login.evil.example/microsoft365/verify?session=8f14e45fceea167a5a36dedd"
+	damaged := encodeQR(t, short, v2)
+	for _, m := range [][2]int{{10, 12}, {20, 22}, {15, 18}} {
+		damaged[m[1]][m[0]] = !damaged[m[1]][m[0]]
+	}
+
+	for name, tt := range map[string]struct {
+		modules [][]bool
+		want    string
+	}{
+		"version 2":         {encodeQR(t, short, v2), short},
+		"version 7":         {encodeQR(t, long, v7), long},
+		"corrected modules": {damaged, short},
+	} {
+		got, err := qrcode.Scan(qrPNG(t, tt.modules, 3))
+		if err != nil || !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+	if got, err := qrcode.Scan(qrPNG(t, [][]bool{{true, false}, {false, true}}, 8)); err != nil || len(got) != 0 {
+		t.Errorf("codes found in a plain image: %q %v", got, err)
+	}
+
+	// A phishing message whose only link is in a QR code
+	env := newTestEnv(t, nil)
+	email := "From: IT Support <it@corp-helpdesk.example>\r\nTo: bob@example.org\r\nSubject: MFA re-enrollment\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: multipart/related; boundary=B1\r\n\r\n" +
+		"--B1\r\nContent-Type: text/html\r\n\r\n<p>Scan the code to keep your account.</p><img src=\"cid:qr\">\r\n" +
+		"--B1\r\nContent-Type: image/png\r\nContent-ID: <qr>\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(qrPNG(t, encodeQR(t, long, v7), 4)) + "\r\n--B1--\r\n"
+
+	var links handlers.ExtractURLsResult
+	if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true}, &links); res.IsError {
+		t.Fatalf("extract_urls failed: %s", resultText(res))
+	}
+	if len(links.URLs) != 1 {
+		t.Fatalf("got %d URLs", len(links.URLs))
+	}
+	u := links.URLs[0]
+	if u.URL != long || !slices.Equal(u.Parts, []string{"1.2"}) || !slices.Equal(u.Sources, []string{urls.SourceQRCode}) ||
+		!slices.Contains(u.Flags, urls.QRCode) || u.Verdict != urls.Suspicious {
+		t.Errorf("unexpected QR code URL: %+v", u)
+	}
+
+	var report phishing.Report
+	if res := env.call(t, "detect_phishing", map[string]any{"content": email}, &report); res.IsError {
+		t.Fatalf("detect_phishing failed: %s", resultText(res))
+	}
+	if !slices.ContainsFunc(report.Evidence, func(e phishing.Evidence) bool {
+		return e.Indicator == phishing.QRCodeLink && strings.Contains(e.Description, "login.evil.example")
+	}) {
+		t.Errorf("QR code link not reported: %+v", report.Evidence)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/quarantine"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestQuarantine(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "quarantine")
+	cfg := config.QuarantineConfig{
+		Dir:       dir,
+		Key:       base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)),
+		MinScore:  10,
+		Retention: 720 * time.Hour,
+	}
+	env := newTestEnv(t, func(c *config.Config) { c.Quarantine = cfg })
+	spam := "From: Billing <billing@bad-example.com>\r\n" +
+		"To: bob@example.org\r\n" +
+		"Subject: Your invoice\r\n" +
+		"Message-ID: <inv-1@bad-example.com>\r\n" +
+		"\r\n" +
+		"Pay now at http://bad-example.com/pay\r\n"
+
+	// Spam below min_score is not held.
+	env.spamd.SetResponse("REPORT", spamdtest.Response{Spam: true, Score: 6, Rules: []spamdtest.Rule{{Name: "BAYES_99", Score: 3.5, Description: "Bayes spam probability is 99 to 100%"}}})
+	var low handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": spam, "verbose": true}, &low)
+	if low.QuarantineID != "" {
+		t.Errorf("score 6 quarantined with min_score 10: %s", low.QuarantineID)
+	}
+
+	env.spamd.SetResponse("REPORT", spamdtest.Response{Spam: true, Score: 12.5, Rules: []spamdtest.Rule{
+		{Name: "URIBL_BLACK", Score: 9, Description: "Contains an URL listed in the URIBL blacklist"},
+		{Name: "BAYES_99", Score: 3.5, Description: "Bayes spam probability is 99 to 100%"},
+	}})
+	var scan handlers.ScanEmailResult
+	env.call(t, "scan_email", map[string]any{"content": spam, "verbose": true}, &scan)
+	if scan.QuarantineID == "" {
+		t.Fatal("score 12.5 not quarantined")
+	}
+
+	// Nothing readable is written to disk.
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 2 {
+		t.Fatalf("expected a message and a metadata file, got %v", files)
+	}
+	for _, name := range files {
+		data, _ := os.ReadFile(name)
+		if bytes.Contains(data, []byte("bad-example.com")) {
+			t.Errorf("%s is not encrypted", name)
+		}
+		if info, _ := os.Stat(name); info.Mode().Perm() != 0o600 {
+			t.Errorf("%s has mode %v", name, info.Mode().Perm())
+		}
+	}
+
+	var page listquery.Page[*quarantine.Item]
+	env.call(t, "list_quarantine", map[string]any{"filter": map[string]string{"released": "false"}}, &page)
+	if page.Total != 1 || page.Items[0].ID != scan.QuarantineID || page.Items[0].Sender != "billing@bad-example.com" ||
+		page.Items[0].Score != 12.5 || len(page.Items[0].Rules) != 2 || page.Items[0].ExpiresAt == nil {
+		t.Fatalf("unexpected listing: %+v", page)
+	}
+
+	var inspected handlers.InspectQuarantinedResult
+	res := env.call(t, "inspect_quarantined", map[string]any{"id": scan.QuarantineID}, &inspected)
+	if inspected.Email == nil || inspected.Email.Subject != "Your invoice" || len(inspected.Email.URLs) != 1 || inspected.Released() {
+		t.Errorf("unexpected inspection: %+v", inspected)
+	}
+	if !strings.Contains(resultText(res), "from billing@bad-example.com") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	var released handlers.ReleaseQuarantinedResult
+	res = env.call(t, "release_quarantined", map[string]any{"id": scan.QuarantineID}, &released)
+	if released.Content != spam || !released.Released() || !strings.Contains(resultText(res), "not delivered") {
+		t.Errorf("unexpected release: %+v", released)
+	}
+	var again handlers.ReleaseQuarantinedResult
+	env.call(t, "release_quarantined", map[string]any{"id": scan.QuarantineID}, &again)
+	if again.ReleasedAt == nil || !again.ReleasedAt.Equal(*released.ReleasedAt) {
+		t.Errorf("second release changed the release time: %v", again.ReleasedAt)
+	}
+	var pending listquery.Page[*quarantine.Item]
+	env.call(t, "list_quarantine", map[string]any{"filter": map[string]string{"released": "false"}}, &pending)
+	if pending.Total != 0 {
+		t.Errorf("released message still pending: %+v", pending)
+	}
+
+	if res := env.call(t, "inspect_quarantined", map[string]any{"id": "20250115T103000Z-0000000000000000"}, nil); !res.IsError || !strings.Contains(resultText(res), "no quarantined message") {
+		t.Errorf("expected a not-found error, got %s", resultText(res))
+	}
+
+	// The store survives a restart, and refuses altered files.
+	store, err := quarantine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	items := store.Items()
+	if len(items) != 1 || !items[0].Released() {
+		t.Fatalf("unexpected items after reopening: %+v", items)
+	}
+	message := filepath.Join(dir, scan.QuarantineID+".eml")
+	data, _ := os.ReadFile(message)
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(message, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Get(scan.QuarantineID); err == nil || !strings.Contains(err.Error(), "decryption failed") {
+		t.Errorf("altered message accepted: %v", err)
+	}
+
+	// Expired messages are pruned.
+	if n, err := store.Prune(items[0].QuarantinedAt.Add(1)); err != nil || n != 1 || len(store.Items()) != 0 {
+		t.Errorf("prune removed %d messages: %v", n, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("files left after pruning: %v", files)
+	}
+
+	// The tools need a quarantine directory.
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "list_quarantine", map[string]any{}, nil); !res.IsError || !strings.Contains(resultText(res), "quarantine.dir") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestQuarantineConfigValidation(t *testing.T) {
+	yaml := "quarantine:\n  dir: \"/var/lib/quarantine\"\n  key: \"c2hvcnQ=\"\n  min_score: -1\n  retention: \"-1h\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"quarantine.key: must be 32 bytes encoded in base64",
+		"quarantine.min_score: must not be negative (0 quarantines spam verdicts), got -1",
+		"quarantine.retention: must not be negative (0 keeps messages forever), got -1h0m0s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "c2hvcnQ=") {
+		t.Errorf("key revealed in: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+)
+
+func TestRDAPDomainAge(t *testing.T) {
+	created := time.Now().Add(-3*24*time.Hour - time.Hour).UTC().Format(time.RFC3339)
+	var lookups, bootstraps atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rdap+json")
+		switch r.URL.Path {
+		case "/dns.json":
+			bootstraps.Add(1)
+			fmt.Fprintf(w, `{"version":"1.0","services":[[["test","example"],["%s/rdap/"]],[["insecure"],["http://rdap.insecure.example/"]]]}`, srv.URL)
+		case "/rdap/domain/fresh-bank.test":
+			lookups.Add(1)
+			fmt.Fprintf(w, `{"objectClassName":"domain","ldhName":"FRESH-BANK.TEST","events":[{"eventAction":"registration","eventDate":%q},{"eventAction":"expiration","eventDate":"2030-01-01T00:00:00Z"}],
+				"entities":[{"objectClassName":"entity","roles":["registrar"],"vcardArray":["vcard",[["version",{},"text","4.0"],["fn",{},"text","Example Registrar, Inc."]]]}]}`, created)
+		case "/rdap/domain/established.test":
+			lookups.Add(1)
+			w.Write([]byte(`{"objectClassName":"domain","events":[{"eventAction":"registration","eventDate":"1997-09-15T04:00:00Z"}]}`))
+		default:
+			lookups.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":404,"title":"Not Found"}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.RDAP = config.RDAPConfig{
+			Enabled:       true,
+			BootstrapURL:  srv.URL + "/dns.json",
+			Timeout:       5 * time.Second,
+			NewDomainDays: 30,
+			CacheTTL:      time.Hour,
+			CacheSize:     100,
+		}
+	})
+	check := func(sender string) handlers.ReputationResult {
+		t.Helper()
+		var rep handlers.ReputationResult
+		if res := env.call(t, "check_reputation", map[string]any{"sender": sender, "skip_dns": true}, &rep); res.IsError {
+			t.Fatalf("check_reputation failed: %s", resultText(res))
+		}
+		return rep
+	}
+
+	// A domain registered three days ago makes the reputation bad; the
+	// registrable domain of a subdomain is looked up.
+	rep := check("billing@mail.fresh-bank.test")
+	if rep.DomainAgeDays == nil || *rep.DomainAgeDays != 3 || rep.Reputation != "bad" ||
+		len(rep.Reasons) != 1 || rep.Reasons[0] != "Domain fresh-bank.test was registered 3 days ago" {
+		t.Errorf("fresh domain not flagged: %+v", rep)
+	}
+	for key, want := range map[string]string{
+		"domain_created": created,
+		"rdap_domain":    "fresh-bank.test",
+		"rdap_registrar": "Example Registrar, Inc.",
+		"rdap_server":    srv.URL + "/rdap/",
+		"rdap_cached":    "false",
+	} {
+		if rep.Details[key] != want {
+			t.Errorf("%s = %q, want %q (%v)", key, rep.Details[key], want, rep.Details)
+		}
+	}
+
+	// The second check of the domain is answered from the cache, and the
+	// bootstrap registry is only loaded once.
+	if rep := check("info@fresh-bank.test"); rep.Details["rdap_cached"] != "true" || lookups.Load() != 1 {
+		t.Errorf("not cached: %d lookups, %v", lookups.Load(), rep.Details)
+	}
+
+	rep = check("info@established.test")
+	if rep.DomainAgeDays == nil || *rep.DomainAgeDays < 9000 || rep.Reputation != "unknown" || len(rep.Reasons) != 0 {
+		t.Errorf("established domain flagged: %+v", rep)
+	}
+
+	// Unknown domains and top-level domains without a server, or with only
+	// an insecure one, are skipped without failing the check.
+	for sender, want := range map[string]string{
+		"a@unregistered.test": "domain is not registered",
+		"a@example.invalid":   "no RDAP server for the top-level domain .invalid",
+		"a@plain.insecure":    "no RDAP server for the top-level domain .insecure",
+	} {
+		if rep := check(sender); rep.Details["rdap_skipped"] != want || rep.DomainAgeDays != nil || rep.Reputation != "unknown" {
+			t.Errorf("%s: got %+v, want rdap_skipped %q", sender, rep, want)
+		}
+	}
+	if bootstraps.Load() != 1 {
+		t.Errorf("bootstrap registry loaded %d times", bootstraps.Load())
+	}
+}
+
+func TestRDAPConfigValidation(t *testing.T) {
+	yaml := "rdap:\n  enabled: true\n  bootstrap_url: \"http://rdap.internal/dns.json\"\n  new_domain_days: 0\n  cache_ttl: \"10s\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"rdap.bootstrap_url: must use https, or http only for a loopback server",
+		"rdap.new_domain_days: must be between 1 and 3650, got 0",
+		"rdap.cache_ttl: must be at least 1m, got 10s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
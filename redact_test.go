@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/peer"
+	"spamassassin-mcp/internal/redact"
+)
+
+func TestRedaction(t *testing.T) {
+	redaction := config.RedactionConfig{Emails: true, Bodies: true, IPs: true}
+
+	var logs bytes.Buffer
+	logger := logrus.StandardLogger()
+	logger.SetOutput(&logs)
+	logger.SetLevel(logrus.DebugLevel)
+	logger.AddHook(redact.New(redaction))
+	defer func() {
+		logger.SetOutput(io.Discard)
+		logger.SetLevel(logrus.InfoLevel)
+		logger.ReplaceHooks(make(logrus.LevelHooks))
+	}()
+
+	ctx := peer.WithAddr(context.Background(), "203.0.113.57")
+	ctx = peer.WithToken(ctx, &peer.Token{Subject: "analyst@corp.example"})
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	env := newTestEnvContext(t, ctx, func(cfg *config.Config) {
+		cfg.Audit.Path = path
+		cfg.Redaction = redaction
+	})
+
+	env.call(t, "check_reputation", map[string]any{"sender": "mallory@spam.example", "ip": "198.51.100.23"}, nil)
+	env.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+	logrus.WithField("content", testEmail).Debug("Email received")
+	logrus.Debugf("Raw submission: %s", testEmail)
+
+	auditData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"logs": logs.String(), "audit log": string(auditData)} {
+		for _, secret := range []string{"mallory@", "analyst@", "alice@", "203.0.113.57", "198.51.100.23", "Quarterly report"} {
+			if strings.Contains(data, secret) {
+				t.Errorf("%s contain %q", name, secret)
+			}
+		}
+	}
+	for _, want := range []string{"***@spam.example", "198.51.100.x", "Raw submission: [redacted message body"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("logs missing masked value %q", want)
+		}
+	}
+	if !strings.Contains(string(auditData), `"remote_addr":"203.0.113.x"`) || !strings.Contains(string(auditData), `"subject":"***@corp.example"`) {
+		t.Errorf("audit log identities not masked: %s", auditData)
+	}
+
+	var page struct {
+		Total int `json:"total"`
+	}
+	env.call(t, "query_audit_log", map[string]any{"filter": map[string]string{"actor": "sub:***@corp.example"}}, &page)
+	if page.Total == 0 {
+		t.Error("redacted actor not queryable")
+	}
+}
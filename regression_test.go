@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestRunRegression(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"ham/0001.eml":       "newsletter",
+		"ham/0002.eml":       "pharmacy discount",
+		"ham/.0003.eml.swp":  "pharmacy",
+		"spam/2024/0001.eml": "pharmacy",
+		"spam/2024/0002.eml": "hello",
+		"unlabeled/0001.eml": "pharmacy",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("Subject: sample\r\n\r\n"+body+"\r\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Corpus = config.CorpusConfig{Path: dir, MaxMessages: 10}
+		lenient := 8.0
+		cfg.Profiles = map[string]config.Profile{"lenient": {Threshold: &lenient}}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		if strings.Contains(string(req.Body), "pharmacy") {
+			return spamdtest.Response{Spam: true, Score: 7.5, Rules: []spamdtest.Rule{{Name: "LOCAL_PHARMACY", Score: 7.5, Description: "Pharmacy spam"}}}
+		}
+		return spamdtest.Response{Score: 1.0}
+	})
+
+	var result handlers.RegressionResult
+	res := env.call(t, "run_regression", map[string]any{"max_false_positives": 0}, &result)
+	if res.IsError {
+		t.Fatalf("run_regression failed: %s", resultText(res))
+	}
+	if result.Ham != 2 || result.Spam != 2 || result.TruePositives != 1 || result.FalsePositives != 1 ||
+		result.TrueNegatives != 1 || result.FalseNegatives != 1 || result.Errors != 0 {
+		t.Errorf("unexpected counts: %+v", result.Report)
+	}
+	if result.FalsePositiveRate != 0.5 || result.FalseNegativeRate != 0.5 {
+		t.Errorf("rates = %v, %v", result.FalsePositiveRate, result.FalseNegativeRate)
+	}
+	if result.HamScores.Count != 2 || result.HamScores.Min != 1.0 || result.HamScores.Max != 7.5 || result.HamScores.Mean != 4.25 {
+		t.Errorf("ham scores = %+v", result.HamScores)
+	}
+	if len(result.Misclassified) != 2 || result.Misclassified[0].Name != "ham/0002.eml" ||
+		result.Misclassified[0].Rules[0] != "LOCAL_PHARMACY" || result.Misclassified[1].Name != "spam/2024/0002.eml" {
+		t.Errorf("misclassified = %+v", result.Misclassified)
+	}
+	if result.Passed || len(result.Failures) != 1 || !strings.HasPrefix(resultText(res), "FAILED") {
+		t.Errorf("expected the false positive limit to fail the run: %v, %s", result.Failures, resultText(res))
+	}
+
+	// Corpus scans stay out of the statistics.
+	var stats struct {
+		MessagesScanned int `json:"messages_scanned"`
+	}
+	env.call(t, "get_stats", map[string]any{}, &stats)
+	if stats.MessagesScanned != 0 {
+		t.Errorf("corpus scans were recorded in statistics: %d", stats.MessagesScanned)
+	}
+
+	result = handlers.RegressionResult{}
+	env.call(t, "run_regression", map[string]any{"max_false_positives": 1, "max_false_negatives": 1}, &result)
+	if !result.Passed {
+		t.Errorf("expected the run to pass: %v", result.Failures)
+	}
+
+	// A profile threshold changes the verdicts.
+	result = handlers.RegressionResult{}
+	env.call(t, "run_regression", map[string]any{"profile": "lenient"}, &result)
+	if result.Threshold != 8 || result.TruePositives != 0 || result.FalsePositives != 0 {
+		t.Errorf("unexpected lenient run: %+v", result.Report)
+	}
+}
+
+func TestRunRegressionNotConfigured(t *testing.T) {
+	env := newTestEnv(t, nil)
+	if res := env.call(t, "run_regression", map[string]any{}, nil); !res.IsError || !strings.Contains(resultText(res), "corpus.path") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestTuneThreshold(t *testing.T) {
+	dir := t.TempDir()
+	scores := map[string]string{
+		"ham/1.eml": "0.5", "ham/2.eml": "2.0", "ham/3.eml": "4.5",
+		"spam/1.eml": "3.0", "spam/2.eml": "6.0", "spam/3.eml": "9.0",
+	}
+	for name, score := range scores {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("Subject: sample\r\n\r\nscore="+score+"\r\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Corpus = config.CorpusConfig{Path: dir, MaxMessages: 10}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		_, score, _ := strings.Cut(strings.TrimSpace(string(req.Body)), "score=")
+		v, _ := strconv.ParseFloat(score, 64)
+		return spamdtest.Response{Score: v}
+	})
+
+	var result handlers.TuningResult
+	res := env.call(t, "tune_threshold", map[string]any{"thresholds": []float64{6, 3, 4, 5}}, &result)
+	if res.IsError {
+		t.Fatalf("tune_threshold failed: %s", resultText(res))
+	}
+	if len(result.Candidates) != 4 || result.Candidates[0].Threshold != 3 {
+		t.Fatalf("unexpected candidates: %+v", result.Candidates)
+	}
+	c := result.Candidates[2]
+	if c.Threshold != 5 || c.TruePositives != 2 || c.FalsePositives != 0 || c.Precision != 1 || c.Recall != 0.6667 || c.F1 != 0.8 {
+		t.Errorf("unexpected stats at 5.0: %+v", c)
+	}
+	if result.Current.Threshold != 5 || result.Current.F1 != 0.8 {
+		t.Errorf("unexpected current stats: %+v", result.Current)
+	}
+	// 5.0 and 6.0 tie without false positives; the higher threshold wins.
+	if result.Recommended == nil || result.Recommended.Threshold != 6 {
+		t.Errorf("recommended = %+v, want 6.0", result.Recommended)
+	}
+
+	// Allowing false positives favours the recall of a lower threshold.
+	result = handlers.TuningResult{}
+	env.call(t, "tune_threshold", map[string]any{"thresholds": []float64{3, 4, 5, 6}, "max_false_positive_rate": 0.5}, &result)
+	if result.Recommended == nil || result.Recommended.Threshold != 3 || result.Recommended.F1 != 0.8571 {
+		t.Errorf("recommended = %+v, want 3.0", result.Recommended)
+	}
+
+	if res := env.call(t, "tune_threshold", map[string]any{"max_false_positive_rate": 2}, nil); !res.IsError {
+		t.Error("expected an out-of-range rate to be rejected")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/ratelimit"
+)
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(yaml string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("log_level: error\n")
+	config.SetFile(path)
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	defer logrus.SetLevel(logrus.InfoLevel)
+
+	env := newTestEnv(t, nil)
+	cfg := testConfig(t, env.spamd)
+	reloader := newConfigReloader(cfg, env.handler, env.server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.run(ctx)
+
+	reputation := func() handlers.ReputationResult {
+		t.Helper()
+		var rep handlers.ReputationResult
+		env.call(t, "check_reputation", map[string]any{"sender": "bob@spam.example"}, &rep)
+		return rep
+	}
+	if reputation().Blocked {
+		t.Fatal("sender blocked before reload")
+	}
+
+	// SIGHUP applies the new threshold, blocked domains, log level and rate
+	// limits without restarting.
+	writeConfig(`log_level: debug
+spamassassin:
+  threshold: 7.5
+security:
+  blocked_domains: [spam.example]
+  rate_limiting:
+    requests_per_minute: 600
+    burst_size: 100
+    tools:
+      explain_score:
+        daily_quota: 1
+`)
+	// Give run a moment to install its signal handler.
+	time.Sleep(50 * time.Millisecond)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reputation().Blocked {
+		if time.Now().After(deadline) {
+			t.Fatal("blocked_domains not applied after SIGHUP")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if logrus.GetLevel() != logrus.DebugLevel {
+		t.Errorf("log level = %s, want debug", logrus.GetLevel())
+	}
+	var info struct {
+		Threshold float64 `json:"threshold"`
+	}
+	env.call(t, "get_config", map[string]any{}, &info)
+	if info.Threshold != 7.5 {
+		t.Errorf("threshold = %v, want 7.5", info.Threshold)
+	}
+	env.call(t, "explain_score", map[string]any{"email_content": testEmail}, nil)
+	res := env.call(t, "explain_score", map[string]any{"email_content": testEmail}, nil)
+	var r ratelimit.Rejection
+	data, _ := json.Marshal(res.StructuredContent)
+	if !res.IsError || json.Unmarshal(data, &r) != nil || r.Code != ratelimit.QuotaExceeded {
+		t.Errorf("explain_score quota not applied: %s", resultText(res))
+	}
+
+	// An invalid configuration is rejected and the previous one stays.
+	writeConfig(`log_level: info
+security:
+  blocked_domains: []
+  rate_limiting:
+    tools:
+      scan_email:
+        requests_per_minute: -1
+`)
+	if err := reloader.reload("test"); err == nil {
+		t.Fatal("invalid configuration was applied")
+	}
+	if !reputation().Blocked || logrus.GetLevel() != logrus.DebugLevel {
+		t.Error("rejected reload changed the configuration")
+	}
+
+	// Settings that need new listeners keep their startup values.
+	writeConfig(`log_level: debug
+server:
+  bind_addr: 127.0.0.1:9999
+security:
+  blocked_domains: [spam.example]
+`)
+	if err := reloader.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	if reloader.current.Server.BindAddr != cfg.Server.BindAddr {
+		t.Errorf("bind_addr changed by reload to %q", reloader.current.Server.BindAddr)
+	}
+}
+
+// TestConfigReloadNotifiesClients checks the list_changed notification sent
+// on reload; go-sdk v0.2.0 has no resources/subscribe, so no
+// notifications/resources/updated is sent and there is none to assert.
+func TestConfigReloadNotifiesClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("log_level: error\nspamassassin:\n  threshold: 6.5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.SetFile(path)
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv(t, nil)
+	changed := make(chan struct{}, 10)
+	session := env.connect(t, &mcp.ClientOptions{
+		ResourceListChangedHandler: func(context.Context, *mcp.ClientSession, *mcp.ResourceListChangedParams) {
+			changed <- struct{}{}
+		},
+	})
+
+	reloader := newConfigReloader(testConfig(t, env.spamd), env.handler, env.server)
+	if err := reloader.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resource notification after reload")
+	}
+
+	res, err := session.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: handlers.ConfigResourceURI})
+	if err != nil {
+		t.Fatalf("read config failed: %v", err)
+	}
+	if text := res.Contents[0].Text; !strings.Contains(text, `"threshold": 6.5`) {
+		t.Errorf("config resource does not show the reloaded threshold: %s", text)
+	}
+}
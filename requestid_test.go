@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/listquery"
+)
+
+func TestRequestIDCorrelation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "mcp.log")
+	sinks, err := setupLogging(&config.Config{
+		LogLevel: "info",
+		Logging:  config.LoggingConfig{File: config.LogFileConfig{Path: logPath, MaxSizeMB: 1, MaxBackups: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		sinks.Close()
+		logrus.SetOutput(io.Discard)
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	}()
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Audit = config.AuditConfig{Path: filepath.Join(dir, "audit.log")}
+	})
+
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	id, _ := res.Meta["request_id"].(string)
+	if res.IsError || len(id) != 16 {
+		t.Fatalf("no request ID in result: %+v", res.Meta)
+	}
+	other := env.call(t, "get_config", map[string]any{}, nil)
+	if other.Meta["request_id"] == id {
+		t.Error("request ID reused")
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		if entry["request_id"] == id {
+			seen[entry["msg"].(string)] = true
+		}
+	}
+	for _, msg := range []string{"Processing email scan request", "Email scan completed", "MCP request"} {
+		if !seen[msg] {
+			t.Errorf("%q not logged with request ID %s; logged: %v", msg, id, seen)
+		}
+	}
+
+	var records listquery.Page[*audit.Record]
+	env.call(t, "query_audit_log", map[string]any{"filter": map[string]string{"request_id": id}}, &records)
+	if records.Total != 1 || records.Items[0].Tool != "scan_email" || records.Items[0].RequestID != id {
+		t.Errorf("unexpected audit records for %s: %+v", id, records)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+const rspamdReply = `{
+  "is_skipped": false,
+  "score": 11.2,
+  "required_score": 15.0,
+  "action": "add header",
+  "thresholds": {"reject": 15.0, "add header": 6.0, "greylist": 4.0},
+  "symbols": {
+    "URIBL_BLACK": {"name": "URIBL_BLACK", "score": 7.5, "metric_score": 7.5, "description": "uribl.com black url", "options": ["evil.example"]},
+    "BAYES_SPAM": {"name": "BAYES_SPAM", "score": 5.1, "metric_score": 5.1, "description": "Message probably spam, probability: ", "options": ["99.99%"]},
+    "R_SPF_FAIL": {"name": "R_SPF_FAIL", "score": 1.0, "metric_score": 1.0, "description": "SPF verification failed"},
+    "MIME_GOOD": {"name": "MIME_GOOD", "score": -0.1, "metric_score": -0.1, "description": "Known content-type"}
+  },
+  "message-id": "campaign-1@evil.example",
+  "time_real": 0.412
+}`
+
+func TestCompareEngines(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/checkv2" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Password") != "q1" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(rspamdReply))
+	}))
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Rspamd = config.RspamdConfig{URL: srv.URL + "/", Password: "q1", Timeout: 5 * time.Second}
+	})
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 6.1,
+		Rules: []spamdtest.Rule{
+			{Name: "BAYES_99", Score: 3.5, Description: "Bayes spam probability is 99 to 100%"},
+			{Name: "URIBL_BLACK", Score: 1.7, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "SPF_FAIL", Score: 0.9, Description: "SPF: sender does not match SPF record (fail)"},
+			{Name: "HTML_MESSAGE", Score: 0.001, Description: "HTML included in message"},
+		},
+	})
+
+	email := "From: alice@evil.example\r\nTo: bob@example.org\r\nSubject: Offer\r\nMessage-ID: <campaign-1@evil.example>\r\n\r\nVisit http://evil.example/\r\n"
+	var result handlers.CompareEnginesResult
+	res := env.call(t, "compare_engines", map[string]any{"content": email}, &result)
+	if res.IsError {
+		t.Fatalf("compare_engines failed: %s", resultText(res))
+	}
+	if received != email {
+		t.Errorf("rspamd received %q", received)
+	}
+	if result.SpamAssassin.Score != 6.1 || !result.SpamAssassin.IsSpam || len(result.SpamAssassin.Rules) != 4 {
+		t.Errorf("unexpected SpamAssassin verdict: %+v", result.SpamAssassin)
+	}
+	if rs := result.Rspamd; rs.Score != 11.2 || rs.RequiredScore != 15 || rs.Action != "add header" || !rs.IsSpam ||
+		len(rs.Symbols) != 4 || rs.Symbols[0].Name != "URIBL_BLACK" || rs.Symbols[3].Name != "MIME_GOOD" {
+		t.Errorf("unexpected rspamd verdict: %+v", rs)
+	}
+	if !result.Agree {
+		t.Error("verdicts should agree")
+	}
+	want := []handlers.SymbolPair{
+		{SpamAssassin: "BAYES_99", Rspamd: "BAYES_SPAM", SpamAssassinScore: 3.5, RspamdScore: 5.1},
+		{SpamAssassin: "URIBL_BLACK", Rspamd: "URIBL_BLACK", SpamAssassinScore: 1.7, RspamdScore: 7.5},
+		{SpamAssassin: "SPF_FAIL", Rspamd: "R_SPF_FAIL", SpamAssassinScore: 0.9, RspamdScore: 1.0},
+	}
+	if !slices.Equal(result.Shared, want) {
+		t.Errorf("unexpected shared symbols: %+v", result.Shared)
+	}
+	if !slices.Equal(result.SpamAssassinOnly, []string{"HTML_MESSAGE"}) || !slices.Equal(result.RspamdOnly, []string{"MIME_GOOD"}) {
+		t.Errorf("unexpected engine-only symbols: %v %v", result.SpamAssassinOnly, result.RspamdOnly)
+	}
+	if result.Overlap != 0.6 {
+		t.Errorf("overlap %v, want 0.6", result.Overlap)
+	}
+	if text := resultText(res); !strings.Contains(text, "engines agree") || !strings.Contains(text, "SPF_FAIL=R_SPF_FAIL") {
+		t.Errorf("unexpected text result: %s", text)
+	}
+
+	// rspamd errors fail the call; the tool needs a worker.
+	env = newTestEnv(t, func(cfg *config.Config) {
+		cfg.Rspamd = config.RspamdConfig{URL: srv.URL, Password: "wrong", Timeout: 5 * time.Second}
+	})
+	if res := env.call(t, "compare_engines", map[string]any{"content": email}, nil); !res.IsError || !strings.Contains(resultText(res), "Unauthorized") {
+		t.Errorf("expected an rspamd error, got %s", resultText(res))
+	}
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "compare_engines", map[string]any{"content": email}, nil); !res.IsError || !strings.Contains(resultText(res), "rspamd.url") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestRspamdConfigValidation(t *testing.T) {
+	yaml := "rspamd:\n  url: \"http://rspamd.internal:11333\"\n  password: \"q1\"\n  timeout: \"0s\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"rspamd.url: http sends the password in clear and is only allowed for a loopback server; use https",
+		"rspamd.timeout: must be positive, got 0s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
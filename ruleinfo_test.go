@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/rules"
+)
+
+func TestGetRuleInfo(t *testing.T) {
+	siteDir, defaultDir := t.TempDir(), t.TempDir()
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.RulesDirs = []string{siteDir, defaultDir}
+	})
+
+	write := func(dir, name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(defaultDir, "25_uribl.cf", "ifplugin Mail::SpamAssassin::Plugin::URIDNSBL\n"+
+		"urirhssub\tURIBL_BLACK  multi.uribl.com.  A   2\n"+
+		"body URIBL_BLACK eval:check_uridnsbl('URIBL_BLACK')\n"+
+		"describe URIBL_BLACK Contains an URL listed in the URIBL blacklist\n"+
+		"tflags URIBL_BLACK net\n"+
+		"endif # Mail::SpamAssassin::Plugin::URIDNSBL\n"+
+		"body T_URIBL_TEST /test\\#1/\n")
+	write(defaultDir, "50_scores.cf", "score URIBL_BLACK 0 1.7 0 1.7 # net only\n")
+	write(siteDir, "local.cf", "score URIBL_BLACK 3.0\n")
+
+	var info rules.RuleInfo
+	if res := env.call(t, "get_rule_info", map[string]any{"name": "URIBL_BLACK"}, &info); res.IsError {
+		t.Fatalf("get_rule_info failed: %s", resultText(res))
+	}
+	if len(info.Definitions) != 2 {
+		t.Fatalf("got %d definitions, want 2: %+v", len(info.Definitions), info.Definitions)
+	}
+	d := info.Definitions[0]
+	if d.Type != "urirhssub" || d.Value != "multi.uribl.com.  A   2" || d.File != "25_uribl.cf" || d.Line != 2 ||
+		len(d.Conditions) != 1 || d.Conditions[0] != "ifplugin Mail::SpamAssassin::Plugin::URIDNSBL" {
+		t.Errorf("unexpected definition: %+v", d)
+	}
+	if info.Description != "Contains an URL listed in the URIBL blacklist" || strings.Join(info.TFlags, ",") != "net" {
+		t.Errorf("description %q, tflags %v", info.Description, info.TFlags)
+	}
+	// The site configuration is loaded last and overrides the distributed
+	// score in every scoreset.
+	if len(info.ScoreLines) != 2 || info.ScoreLines[0].Scores != (rules.Scoresets{0, 1.7, 0, 1.7}) || info.ScoreLines[1].File != "local.cf" {
+		t.Errorf("unexpected score lines: %+v", info.ScoreLines)
+	}
+	if info.Score == nil || *info.Score != (rules.Scoresets{3, 3, 3, 3}) || info.ScoreImplicit {
+		t.Errorf("score = %v (implicit %v), want 3 in every scoreset", info.Score, info.ScoreImplicit)
+	}
+	if strings.Join(info.Files, ",") != "25_uribl.cf,50_scores.cf,local.cf" {
+		t.Errorf("files = %v", info.Files)
+	}
+
+	// Test rules without a score line get the implicit 0.01, and an escaped
+	// hash is not a comment.
+	info = rules.RuleInfo{}
+	env.call(t, "get_rule_info", map[string]any{"name": "T_URIBL_TEST"}, &info)
+	if len(info.Definitions) != 1 || info.Definitions[0].Value != `/test\#1/` || !info.ScoreImplicit || info.Score[0] != 0.01 {
+		t.Errorf("unexpected test rule info: %+v", info)
+	}
+
+	for _, name := range []string{"NOT_A_RULE", "../local.cf"} {
+		if res := env.call(t, "get_rule_info", map[string]any{"name": name}, nil); !res.IsError {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
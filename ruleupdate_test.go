@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ruleupdate"
+)
+
+func TestUpdateRules(t *testing.T) {
+	dir := t.TempDir()
+	updateDir := filepath.Join(dir, "4.000000")
+	mode := filepath.Join(dir, "mode")
+	saUpdate := fakeSaLearn(t, `
+args="$*"
+case "$args" in
+	"-v --channel updates.spamassassin.org --gpgkey 5244EC45 --updatedir `+updateDir+`"*) ;;
+	*) echo "unexpected arguments: $args"; exit 9;;
+esac
+case "$(cat `+mode+`)" in
+check) case "$args" in *--checkonly) echo "Update available for channel updates.spamassassin.org"; exit 0;; esac; exit 9;;
+install)
+	mkdir -p `+updateDir+`/updates_spamassassin_org
+	printf '# UPDATE version 1917402\ninclude updates_spamassassin_org/*.cf\n' > `+updateDir+`/updates_spamassassin_org.cf
+	echo 'body LOCAL_NEW /new/' > `+updateDir+`/updates_spamassassin_org/72_active.cf
+	echo "channel: updates.spamassassin.org: update complete"
+	exit 0;;
+current) echo "channel: updates.spamassassin.org: already at latest version"; exit 1;;
+broken)
+	printf '# UPDATE version 1917500\ninclude updates_spamassassin_org/*.cf\n' > `+updateDir+`/updates_spamassassin_org.cf
+	echo 'bodyy LOCAL_NEW /new/' > `+updateDir+`/updates_spamassassin_org/72_active.cf
+	exit 0;;
+*) echo "error: GPG validation failed for channel updates.spamassassin.org"; exit 4;;
+esac
+`)
+	lint := fakeSpamAssassin(t, `
+[ "$1" = "--lint" ] || exit 9
+if grep -q bodyy `+updateDir+`/updates_spamassassin_org/72_active.cf; then
+	echo "Oct 15 10:00:00.123 [42] warn: config: failed to parse line, skipping: bodyy LOCAL_NEW /new/"
+	exit 2
+fi
+exit 0
+`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Binary = lint
+		cfg.RuleUpdates.SaUpdate = saUpdate
+		cfg.RuleUpdates.GPGKeys = []string{"5244EC45"}
+		cfg.RuleUpdates.UpdateDir = updateDir
+	})
+	setMode := func(m string) {
+		if err := os.WriteFile(mode, []byte(m), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var report ruleupdate.Report
+	setMode("check")
+	if res := env.call(t, "update_rules", map[string]any{"check_only": true}, &report); res.IsError || report.Status != "available" || report.Lint != nil {
+		t.Fatalf("unexpected check: %s %+v", resultText(res), report)
+	}
+
+	setMode("install")
+	report = ruleupdate.Report{}
+	res := env.call(t, "update_rules", map[string]any{}, &report)
+	if res.IsError {
+		t.Fatalf("update_rules failed: %s", resultText(res))
+	}
+	channel := ruleupdate.ChannelVersion{Channel: "updates.spamassassin.org", Version: "1917402", Updated: true}
+	if report.Status != "updated" || len(report.Channels) != 1 || report.Channels[0] != channel {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(report.Added) != 2 || !strings.HasSuffix(report.Added[1], "updates_spamassassin_org/72_active.cf") || len(report.Modified) != 0 {
+		t.Errorf("unexpected file changes: added %v, modified %v", report.Added, report.Modified)
+	}
+	if report.Lint == nil || !report.Lint.Valid || !report.ReloadRequired || report.Messages[0] != "channel: updates.spamassassin.org: update complete" {
+		t.Errorf("unexpected lint or messages: %+v", report)
+	}
+
+	setMode("current")
+	report = ruleupdate.Report{}
+	if env.call(t, "update_rules", map[string]any{}, &report); report.Status != "up_to_date" || report.Channels[0].Updated || report.ReloadRequired || report.Lint != nil {
+		t.Errorf("unexpected report without updates: %+v", report)
+	}
+
+	// An update that breaks the configuration is reported, not hidden.
+	setMode("broken")
+	report = ruleupdate.Report{}
+	res = env.call(t, "update_rules", map[string]any{}, &report)
+	if len(report.Modified) != 2 || report.Channels[0].PreviousVersion != "1917402" || report.Channels[0].Version != "1917500" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if report.Lint.Valid || len(report.Lint.Issues) != 1 || report.Lint.Issues[0] != "config: failed to parse line, skipping: bodyy LOCAL_NEW /new/" {
+		t.Errorf("unexpected lint: %+v", report.Lint)
+	}
+	if !strings.Contains(resultText(res), "do not reload spamd") {
+		t.Errorf("expected a lint warning, got %s", resultText(res))
+	}
+
+	setMode("gpg")
+	if res := env.call(t, "update_rules", map[string]any{}, nil); !strings.Contains(resultText(res), "exit status 4: error: GPG validation failed") {
+		t.Errorf("expected the sa-update failure, got %s", resultText(res))
+	}
+	if res := env.call(t, "update_rules", map[string]any{"channels": []string{"evil.example"}}, nil); !strings.Contains(resultText(res), "not configured") {
+		t.Errorf("expected an unconfigured channel to be refused, got %s", resultText(res))
+	}
+}
+
+func TestUpdateRulesReload(t *testing.T) {
+	dir := t.TempDir()
+	updateDir := filepath.Join(dir, "updates")
+	counter := filepath.Join(dir, "counter")
+	saUpdate := fakeSaLearn(t, `
+n=$(cat `+counter+` 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > `+counter+`
+mkdir -p `+updateDir+`
+printf '# UPDATE version %d\n' $n > `+updateDir+`/updates_spamassassin_org.cf
+exit 0
+`)
+	lint := fakeSpamAssassin(t, `exit 0`)
+	compiled := filepath.Join(dir, "compiled")
+	saCompile := fakeSaLearn(t, `echo compiled >> `+compiled)
+	reloaded := filepath.Join(dir, "reloaded")
+	reload := fakeSaLearn(t, `
+[ "$1 $2" = "reload spamd" ] || { echo "unexpected arguments: $*"; exit 9; }
+[ -f `+filepath.Join(dir, "fail")+` ] && { echo "Job for spamd.service failed"; exit 1; }
+echo reloaded >> `+reloaded+`
+`)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Binary = lint
+		cfg.RuleUpdates.SaUpdate = saUpdate
+		cfg.RuleUpdates.UpdateDir = updateDir
+		cfg.SpamdReload.Compile = true
+		cfg.SpamdReload.SaCompile = saCompile
+		cfg.SpamdReload.Method = "command"
+		cfg.SpamdReload.Command = []string{reload, "reload", "spamd"}
+	})
+
+	var report ruleupdate.Report
+	res := env.call(t, "update_rules", map[string]any{}, &report)
+	if res.IsError {
+		t.Fatalf("update_rules failed: %s", resultText(res))
+	}
+	if r := report.Reload; r == nil || !r.Compiled || !r.Reloaded || !r.Responding || r.Error != "" || report.ReloadRequired {
+		t.Fatalf("unexpected reload: %+v", report)
+	}
+	for path, want := range map[string]string{compiled: "compiled\n", reloaded: "reloaded\n"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(path), data, err, want)
+		}
+	}
+	if !strings.Contains(resultText(res), "spamd reloaded") {
+		t.Errorf("expected the reload in the summary, got %s", resultText(res))
+	}
+
+	// A failed reload is reported, and spamd still has to be reloaded.
+	if err := os.WriteFile(filepath.Join(dir, "fail"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report = ruleupdate.Report{}
+	res = env.call(t, "update_rules", map[string]any{}, &report)
+	if res.IsError || report.Reload == nil || report.Reload.Reloaded || !report.ReloadRequired {
+		t.Fatalf("unexpected report: %s %+v", resultText(res), report)
+	}
+	if want := "spamd reload failed: exit status 1: Job for spamd.service failed"; report.Reload.Error != want || !strings.Contains(resultText(res), "WARNING: "+want) {
+		t.Errorf("unexpected reload error: %+v, %s", report.Reload, resultText(res))
+	}
+}
+
+func TestUpdateRulesReloadSignal(t *testing.T) {
+	dir := t.TempDir()
+	updateDir := filepath.Join(dir, "updates")
+	saUpdate := fakeSaLearn(t, `
+mkdir -p `+updateDir+`
+printf '# UPDATE version 1\n' > `+updateDir+`/updates_spamassassin_org.cf
+exit 0
+`)
+	spamd := exec.Command("sleep", "60")
+	if err := spamd.Start(); err != nil {
+		t.Skip("sleep is not available")
+	}
+	t.Cleanup(func() { spamd.Process.Kill() })
+	pidFile := filepath.Join(dir, "spamd.pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(spamd.Process.Pid)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.Binary = fakeSpamAssassin(t, `exit 0`)
+		cfg.RuleUpdates.SaUpdate = saUpdate
+		cfg.RuleUpdates.UpdateDir = updateDir
+		cfg.SpamdReload.Method = "signal"
+		cfg.SpamdReload.PIDFile = pidFile
+	})
+
+	var report ruleupdate.Report
+	if res := env.call(t, "update_rules", map[string]any{}, &report); res.IsError || report.Reload == nil || !report.Reload.Reloaded || report.Reload.Compiled {
+		t.Fatalf("unexpected report: %s %+v", resultText(res), report)
+	}
+	spamd.Wait()
+	if status, ok := spamd.ProcessState.Sys().(syscall.WaitStatus); !ok || !status.Signaled() || status.Signal() != syscall.SIGHUP {
+		t.Errorf("expected spamd to receive SIGHUP, got %v", spamd.ProcessState)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/audit"
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/scheduler"
+)
+
+func TestScheduler(t *testing.T) {
+	dir := t.TempDir()
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(dir, "history.db")}
+		cfg.Audit = config.AuditConfig{Path: filepath.Join(dir, "audit.log")}
+		cfg.Bayes.SaLearn = filepath.Join(dir, "missing-sa-learn")
+		cfg.Scheduler.Jobs = []config.ScheduledJob{
+			{Name: "history", Task: config.TaskPruneHistory, Schedule: "@every 1s", MaxAge: time.Nanosecond},
+			{Name: "expiry", Task: config.TaskBayesExpire, Schedule: "@every 1s"},
+			{Name: "nightly-rules", Task: config.TaskUpdateRules, Schedule: "30 3 * * 1-5"},
+		}
+	})
+
+	var before handlers.GetSchedulerStatusResult
+	res := env.call(t, "get_scheduler_status", map[string]any{}, &before)
+	if len(before.Jobs) != 3 || before.Jobs[0].Name != "history" || before.Jobs[0].LastRun != nil || before.Timezone != "UTC" {
+		t.Fatalf("unexpected status before start: %+v", before)
+	}
+	if !strings.Contains(resultText(res), "3 scheduled jobs: 0 failed their last run, 3 have not run yet") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	env.handler.StartScheduler()
+
+	var status handlers.GetSchedulerStatusResult
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		env.call(t, "get_scheduler_status", map[string]any{}, &status)
+		if status.Jobs[0].Runs > 0 && status.Jobs[1].Runs > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("jobs did not run: %+v", status.Jobs)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	prune, expiry, rules := status.Jobs[0], status.Jobs[1], status.Jobs[2]
+	if prune.LastOutcome != scheduler.OutcomeSuccess || !strings.Contains(prune.LastResult, "history entries older than 1ns deleted") || prune.LastRun == nil {
+		t.Errorf("unexpected prune_history status: %+v", prune)
+	}
+	var page listquery.Page[*history.Entry]
+	env.call(t, "query_history", map[string]any{}, &page)
+	if page.Total != 0 {
+		t.Errorf("history not pruned: %d entries left", page.Total)
+	}
+	if expiry.LastOutcome != scheduler.OutcomeFailure || !strings.Contains(expiry.LastError, "sa-learn is not available") || expiry.Failures == 0 {
+		t.Errorf("unexpected bayes_expire status: %+v", expiry)
+	}
+	if rules.Runs != 0 || rules.NextRun == nil || rules.NextRun.Hour() != 3 || rules.NextRun.Minute() != 30 ||
+		rules.NextRun.Weekday() == time.Saturday || rules.NextRun.Weekday() == time.Sunday || rules.NextRun.Location() != time.UTC {
+		t.Errorf("unexpected next run of the cron job: %+v", rules)
+	}
+
+	var records listquery.Page[*audit.Record]
+	env.call(t, "query_audit_log", map[string]any{"filter": map[string]string{"method": "scheduler/run", "tool": "prune_history"}}, &records)
+	if records.Total == 0 || records.Items[0].Actor != "scheduler:history" || records.Items[0].Outcome != "success" || records.Items[0].Change == "" {
+		t.Errorf("scheduled run not audited: %+v", records)
+	}
+}
+
+func TestSchedulerConfigValidation(t *testing.T) {
+	yaml := `scheduler:
+  jobs:
+    - name: "rules"
+      task: "update_rules"
+      schedule: "61 * * * *"
+    - name: "rules"
+      task: "defragment"
+      schedule: "@daily"
+      max_age: "1h"
+    - name: "history"
+      task: "prune_history"
+      schedule: "*/15 * * *"
+`
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`scheduler.jobs[0] (rules): invalid schedule: minute must be between 0 and 59, got "61"`,
+		`scheduler.jobs[1]: duplicate job name "rules"`,
+		`scheduler.jobs[1] (rules): task must be one of update_rules, bayes_expire, prune_caches, prune_history, got "defragment"`,
+		"scheduler.jobs[1] (rules): max_age only applies to prune_history",
+		`scheduler.jobs[2] (history): invalid schedule: schedule "*/15 * * *" must have 5 fields`,
+		"scheduler.jobs[2] (history): prune_history needs the scan history (set history.dsn)",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
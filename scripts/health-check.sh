@@ -4,53 +4,32 @@ set -euo pipefail
 # SpamAssassin MCP Server Health Check
 
 # Configuration
-MCP_HOST=${SA_MCP_SERVER_BIND_ADDR:-"0.0.0.0:8080"}
-MCP_PORT=$(echo "$MCP_HOST" | cut -d':' -f2)
+ADMIN_ADDR=${SA_MCP_SERVER_ADMIN_BIND_ADDR:-"0.0.0.0:8081"}
 TIMEOUT=5
 
-# Extract just the port if host is specified
-if [[ "$MCP_HOST" == *":"* ]]; then
-    MCP_PORT=$(echo "$MCP_HOST" | cut -d':' -f2)
+# Probe the admin port, not the MCP endpoint
+if [[ "$ADMIN_ADDR" == *":"* ]]; then
+    ADMIN_PORT="${ADMIN_ADDR##*:}"
 else
-    MCP_PORT="8080"
+    ADMIN_PORT="8081"
 fi
 
 # Health check functions
 check_mcp_server() {
-    # Check if MCP server port is open using TCP test
-    if ! timeout 3 bash -c "echo >/dev/tcp/localhost/$MCP_PORT" 2>/dev/null; then
-        echo "ERROR: MCP server not responding on port $MCP_PORT"
+    # Liveness: the server process is up and serving HTTP
+    if ! curl -f -s --max-time "$TIMEOUT" "http://localhost:$ADMIN_PORT/healthz" >/dev/null 2>&1; then
+        echo "ERROR: MCP server not responding on admin port $ADMIN_PORT"
         return 1
     fi
-    
-    # Try to connect via HTTP (basic connectivity test)
-    if command -v curl >/dev/null 2>&1; then
-        # Test HTTP connection to the root endpoint
-        if curl -f -s --max-time "$TIMEOUT" "http://localhost:$MCP_PORT/" >/dev/null 2>&1; then
-            return 0
-        fi
-        # Fallback: just test that the port accepts HTTP requests
-        if curl -s --max-time "$TIMEOUT" "http://localhost:$MCP_PORT/mcp" >/dev/null 2>&1; then
-            return 0
-        fi
-    fi
-    
     return 0
 }
 
 check_spamassassin() {
-    # Check if SpamAssassin daemon is running
-    if ! pgrep spamd >/dev/null 2>&1; then
-        echo "WARNING: SpamAssassin daemon not running"
+    # Readiness: spamd answers PING and rule files are installed
+    if ! curl -f -s --max-time "$TIMEOUT" "http://localhost:$ADMIN_PORT/readyz" >/dev/null 2>&1; then
+        echo "WARNING: Server not ready (spamd unreachable or no rules loaded)"
         return 1
     fi
-    
-    # Check if spamd port is accessible
-    if ! timeout 3 bash -c "echo >/dev/tcp/localhost/783" 2>/dev/null; then
-        echo "WARNING: SpamAssassin daemon not responding on port 783"
-        return 1
-    fi
-    
     return 0
 }
 
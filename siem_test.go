@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestSIEMExport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SIEM = config.SIEMConfig{
+			Format:    "cef",
+			Network:   "tcp",
+			Address:   listener.Addr().String(),
+			Facility:  "mail",
+			AppName:   "spamassassin-mcp",
+			Fields:    map[string]string{"subject": "cs5", "user": ""},
+			QueueSize: 10,
+		}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		return spamdtest.Response{Spam: true, Score: 12.5, Rules: []spamdtest.Rule{{Name: "BAYES_99", Score: 12.5, Description: "Bayes spam probability is 99 to 100%"}}}
+	})
+
+	// The subject tries to forge an attribute and a second event.
+	email := strings.Replace(testEmail, "Subject: Quarterly report", "Subject: a=b\\c act=ham", 1)
+	if res := env.call(t, "scan_email", map[string]any{"content": email, "verbose": true}, nil); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+
+	var line string
+	select {
+	case line = <-lines:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	if !strings.HasPrefix(line, "<20>1 ") || !strings.Contains(line, " spamassassin-mcp ") {
+		t.Errorf("unexpected syslog header: %q", line)
+	}
+	_, event, ok := strings.Cut(line, " verdict - ")
+	if !ok || !strings.HasPrefix(event, "CEF:0|spamassassin-mcp|spamassassin-mcp|1.0.0|spam|Spam verdict|9|") {
+		t.Fatalf("unexpected CEF header: %q", line)
+	}
+	for _, want := range []string{
+		"act=spam", "cfp1=12.5 cfp1Label=score", "cfp2=5 cfp2Label=threshold",
+		"cs1=BAYES_99 cs1Label=rules", "cs4=<report-1@example.com>", "suser=alice@example.com",
+		`cs5=a\=b\\c act\=ham cs5Label=subject`, "fileHash=",
+	} {
+		if !strings.Contains(event, want) {
+			t.Errorf("missing %q in %q", want, event)
+		}
+	}
+	if strings.Contains(event, "duser=") {
+		t.Errorf("unmapped field exported: %q", event)
+	}
+}
+
+func TestSIEMExportLEEF(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SIEM = config.SIEMConfig{
+			Format:    "leef",
+			Network:   "udp",
+			Address:   conn.LocalAddr().String(),
+			Facility:  "local3",
+			Fields:    map[string]string{"sender": "usrName", "user": ""},
+			QueueSize: 10,
+		}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		return spamdtest.Response{Score: 0.4}
+	})
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail}, nil); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no event received: %v", err)
+	}
+	line := string(buf[:n])
+	if !strings.HasPrefix(line, "<157>1 ") || strings.HasSuffix(line, "\n") {
+		t.Errorf("unexpected syslog message: %q", line)
+	}
+	_, event, _ := strings.Cut(line, " verdict - ")
+	header, attrs, ok := strings.Cut(event, "|x09|")
+	if !ok || header != "LEEF:2.0|spamassassin-mcp|spamassassin-mcp|1.0.0|ham" {
+		t.Fatalf("unexpected LEEF header: %q", event)
+	}
+	got := make(map[string]string)
+	for _, attr := range strings.Split(attrs, "\t") {
+		key, value, _ := strings.Cut(attr, "=")
+		got[key] = value
+	}
+	for key, want := range map[string]string{"cat": "ham", "sev": "2", "score": "0.4", "usrName": "alice@example.com", "messageId": "<report-1@example.com>"} {
+		if got[key] != want {
+			t.Errorf("%s = %q, want %q (event %q)", key, got[key], want, event)
+		}
+	}
+	if _, err := time.Parse("Jan 02 2006 15:04:05.000 MST", got["devTime"]); err != nil {
+		t.Errorf("devTime: %v", err)
+	}
+	if _, ok := got["sender"]; ok {
+		t.Errorf("default sender key still exported: %q", event)
+	}
+}
+
+func TestSIEMConfigValidation(t *testing.T) {
+	yaml := "siem:\n  format: \"json\"\n  network: \"unix\"\n  address: \"/dev/log\"\n  ca_file: \"/etc/ssl/siem.pem\"\n" +
+		"  facility: \"mail2\"\n  fields:\n    body: \"msg\"\n    score: \"spam score\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		`siem.format: must be cef or leef, got "json"`,
+		`siem.network: must be udp, tcp or tls, got "unix"`,
+		"siem.ca_file: requires network tls",
+		`siem.facility: unknown facility "mail2"`,
+		`siem.fields: unknown verdict field "body"`,
+		`siem.fields.score: invalid event key "spam score"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
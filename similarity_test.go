@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/similarity"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+// campaignEmail renders one variant of a templated campaign message.
+func campaignEmail(name, amount, token string) string {
+	return "From: Accounts <billing@invoices-example.com>\r\n" +
+		"To: " + name + "@example.org\r\n" +
+		"Subject: Invoice " + token + " overdue\r\n" +
+		"X-Mailer: BulkSender 2.1\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<html><body><!-- tpl:invoice-v3 --><div class=\"wrap\"><p>Hello " + name + ",</p>" +
+		"<p>Your invoice of $" + amount + " is overdue. Please settle the outstanding balance " +
+		"today to avoid a late fee being added to your account.</p>" +
+		"<p><a class=\"btn-pay\" href=\"https://pay.invoices-example.com/i?ref=" + token + "&uid={{uid}}\">Pay now</a></p>" +
+		"<p>Regards, the accounts team</p></div></body></html>\r\n"
+}
+
+func TestCompareEmails(t *testing.T) {
+	env := newTestEnv(t, nil)
+
+	var result similarity.Result
+	args := map[string]any{"emails": []string{
+		campaignEmail("carol", "1,250.00", "A7F3"),
+		campaignEmail("dave", "89.99", "Q2K9"),
+		testEmail,
+	}}
+	if res := env.call(t, "compare_emails", args, &result); res.IsError {
+		t.Fatalf("compare_emails failed: %s", resultText(res))
+	}
+
+	if len(result.Samples) != 3 || len(result.Pairs) != 3 {
+		t.Fatalf("got %d samples and %d pairs, want 3 and 3", len(result.Samples), len(result.Pairs))
+	}
+	for _, s := range result.Samples {
+		if len(s.SimHash) != 16 {
+			t.Errorf("sample %d simhash = %q", s.Index, s.SimHash)
+		}
+	}
+
+	variants := result.Pairs[0]
+	if variants.A != 0 || variants.B != 1 || variants.Verdict != similarity.SameCampaign {
+		t.Errorf("variants not matched: %+v", variants)
+	}
+	// Names, amounts and the tracking token differ; everything else is the
+	// template.
+	if variants.Content < 0.6 || variants.Structure != 1 || variants.SimHashDistance > 16 {
+		t.Errorf("variant similarity too low: %+v", variants)
+	}
+	if !slices.Equal(variants.SharedDomains, []string{"invoices-example.com"}) || len(variants.SharedURLs) != 0 {
+		t.Errorf("shared links = %v / %v", variants.SharedDomains, variants.SharedURLs)
+	}
+	for _, m := range []string{"class:btn-pay", "comment:tpl:invoice-v3", "url_parameter:uid", "x-mailer:BulkSender 2.1"} {
+		if !slices.Contains(variants.SharedMarkers, m) {
+			t.Errorf("missing shared marker %s in %v", m, variants.SharedMarkers)
+		}
+	}
+
+	for _, p := range result.Pairs[1:] {
+		if p.Verdict != similarity.Unrelated {
+			t.Errorf("pair %d/%d = %s (%.2f), want unrelated", p.A, p.B, p.Verdict, p.Similarity)
+		}
+	}
+	if fmt.Sprint(result.Clusters) != "[[0 1]]" {
+		t.Errorf("clusters = %v, want [[0 1]]", result.Clusters)
+	}
+
+	if res := env.call(t, "compare_emails", map[string]any{"emails": []string{testEmail}}, nil); !res.IsError {
+		t.Error("a single email was accepted")
+	}
+}
+
+func TestFindSimilar(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+	})
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Spam: true, Score: 8.2})
+	for _, content := range []string{
+		campaignEmail("carol", "1,250.00", "A7F3"),
+		campaignEmail("dave", "89.99", "Q2K9"),
+		campaignEmail("dave", "89.99", "Q2K9"),
+		testEmail,
+	} {
+		var scan handlers.ScanEmailResult
+		env.call(t, "scan_email", map[string]any{"content": content}, &scan)
+		if !strings.HasPrefix(scan.FuzzyHash, "3:") {
+			t.Fatalf("unexpected fuzzy hash %q", scan.FuzzyHash)
+		}
+	}
+
+	var result handlers.FindSimilarResult
+	res := env.call(t, "find_similar", map[string]any{"content": campaignEmail("erin", "310.00", "Z8M1")}, &result)
+	if res.IsError {
+		t.Fatalf("find_similar failed: %s", resultText(res))
+	}
+	if result.Searched != 4 || result.Variants != 2 || result.Scans != 3 || result.Spam != 3 || len(result.Matches) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for _, m := range result.Matches {
+		if m.Similarity < 50 || m.Identical || !m.IsSpam || m.Score != 8.2 || m.Sender != "billing@invoices-example.com" {
+			t.Errorf("unexpected match: %+v", m)
+		}
+	}
+	if result.Matches[0].Similarity < result.Matches[1].Similarity {
+		t.Errorf("matches not ordered by similarity: %d, %d", result.Matches[0].Similarity, result.Matches[1].Similarity)
+	}
+	if !strings.Contains(resultText(res), "2 variant(s)") {
+		t.Errorf("unexpected text result: %s", resultText(res))
+	}
+
+	// A scanned sample is found as itself, and does not count as a variant.
+	var again handlers.FindSimilarResult
+	env.call(t, "find_similar", map[string]any{"content": campaignEmail("dave", "89.99", "Q2K9"), "min_similarity": 100}, &again)
+	if again.Variants != 0 || len(again.Matches) != 1 || !again.Matches[0].Identical || again.Matches[0].Scans != 2 || again.Matches[0].Similarity != 100 {
+		t.Errorf("unexpected self match: %+v", again)
+	}
+
+	if res := env.call(t, "find_similar", map[string]any{"content": testEmail, "min_similarity": 101}, nil); !res.IsError {
+		t.Error("min_similarity 101 accepted")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamassassin"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestScanSpamHeaders(t *testing.T) {
+	env := newTestEnv(t, nil)
+	env.spamd.SetResponse("HEADERS", spamdtest.Response{
+		Spam:  true,
+		Score: 12.5,
+		Rules: []spamdtest.Rule{
+			{Name: "URIBL_BLACK", Score: 3.5, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "BAYES_99", Score: 9.0, Description: "Bayes spam probability is 99 to 100%"},
+		},
+	})
+
+	var result handlers.ScanEmailResult
+	res := env.call(t, "scan_email", map[string]any{"content": testEmail, "spam_headers": true}, &result)
+	if res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if cmd := env.spamd.Requests()[0].Command; cmd != "HEADERS" {
+		t.Errorf("sent %s, want HEADERS", cmd)
+	}
+	h := result.SpamHeaders
+	if h == nil || !h.Flag || h.Level != 12 || h.Checker == nil || h.Checker.Version != spamdtest.Version || h.Checker.Host != "spamdtest" {
+		t.Fatalf("unexpected spam headers: %+v", h)
+	}
+	if s := h.Status; s == nil || !s.IsSpam || s.Score != 12.5 || s.Required != 5 || !slices.Equal(s.Tests, []string{"URIBL_BLACK", "BAYES_99"}) ||
+		s.Autolearn != "no" || s.Fields["autolearn_force"] != "no" || s.Version != spamdtest.Version {
+		t.Errorf("unexpected status: %+v", s)
+	}
+	if len(result.RulesHit) != 2 || result.RulesHit[1].Name != "BAYES_99" || result.RulesHit[1].Score != 9 || result.RulesHit[1].Description != "Bayes spam probability is 99 to 100%" {
+		t.Errorf("rules not taken from X-Spam-Report: %+v", result.RulesHit)
+	}
+
+	// Report lines continue descriptions, and custom headers are kept.
+	env.spamd.SetResponse("HEADERS", spamdtest.Response{Score: 0.5, Body: "X-Spam-Status: No, score=0.5 required=5.0 tests=URIBL_BLOCKED\r\n" +
+		"\tautolearn=ham autolearn_force=no version=4.0.1\r\n" +
+		"X-Spam-Level: \r\n" +
+		"X-Spam-Languages: de en\r\n" +
+		"X-Spam-Report: \r\n" +
+		"\t*  0.0 URIBL_BLOCKED ADMINISTRATOR NOTICE: The query to URIBL was blocked.\r\n" +
+		"\t*      See https://uribl.com/refused.shtml for more information.\r\n" +
+		"\t*  0.5 LOCAL_TEST\r\n" +
+		"Subject: Quarterly report\r\n\r\n"})
+	result = handlers.ScanEmailResult{}
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "spam_headers": true}, &result)
+	h = result.SpamHeaders
+	if h == nil || h.Flag || h.Level != 0 || h.Status.Autolearn != "ham" || h.Other["Languages"] != "de en" {
+		t.Fatalf("unexpected spam headers: %+v", h)
+	}
+	if len(h.ReportRules) != 2 || !strings.HasSuffix(h.ReportRules[0].Description, "was blocked. See https://uribl.com/refused.shtml for more information.") || h.ReportRules[1].Name != "LOCAL_TEST" {
+		t.Errorf("unexpected report rules: %+v", h.ReportRules)
+	}
+}
+
+func TestScanSpamHeadersProcess(t *testing.T) {
+	spamd := spamdtest.NewServer()
+	t.Cleanup(spamd.Close)
+	spamd.SetProtocol("1.3")
+	client, err := spamassassin.NewClient(spamd.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spamd.SetResponse("PROCESS", spamdtest.Response{Spam: true, Score: 6, Rules: []spamdtest.Rule{{Name: "LOCAL_RULE", Score: 6}}})
+	spamd.ClearRequests()
+
+	// spamd before protocol 1.4 has no HEADERS command.
+	result, err := client.ScanEmail(testEmail, spamassassin.ScanOptions{SpamHeaders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := spamd.Requests()[0].Command; cmd != "PROCESS" {
+		t.Errorf("sent %s, want PROCESS", cmd)
+	}
+	if result.SpamHeaders == nil || !result.SpamHeaders.Flag || len(result.RulesHit) != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/spf"
+)
+
+func TestCheckSPF(t *testing.T) {
+	env := newTestEnv(t, nil)
+	dns := env.dns
+	dns.AddTXT("example.com", "v=spf1 ip4:192.0.2.0/24 include:_spf.%{d} -all exp=explain.%{d}")
+	dns.AddTXT("example.com", "google-site-verification=abc")
+	dns.AddTXT("_spf.example.com", "v=spf1 ip6:2001:db8::/32 ~all")
+	dns.AddTXT("explain.example.com", "%{i} is not authorized to send mail for %{d}")
+	dns.AddTXT("redirect.example", "v=spf1 redirect=example.com")
+	dns.AddTXT("mx.example", "v=spf1 mx/24 -all")
+	dns.AddMX("mx.example", 10, "mail.mx.example")
+	dns.AddA("mail.mx.example", "203.0.113.5")
+	dns.AddTXT("macro.example", "v=spf1 exists:%{ir}.%{l1r-}.allow.%{o} ?all")
+	dns.AddA("3.2.0.192.foo.allow.macro.example", "127.0.0.2")
+	dns.AddTXT("loop.example", "v=spf1 include:loop.example -all")
+	dns.AddTXT("twice.example", "v=spf1 -all")
+	dns.AddTXT("twice.example", "v=spf1 +all")
+	dns.Fail("broken.example")
+
+	tests := []struct {
+		name      string
+		args      map[string]any
+		result    spf.Result
+		mechanism string
+		matched   string
+	}{
+		{"ip4", map[string]any{"domain": "example.com", "ip": "192.0.2.10"}, spf.Pass, "ip4:192.0.2.0/24", "example.com"},
+		{"include", map[string]any{"sender": "alice@example.com", "ip": "2001:db8::1"}, spf.Pass, "include:_spf.%{d}", "example.com"},
+		{"fail", map[string]any{"domain": "example.com", "ip": "198.51.100.7"}, spf.Fail, "-all", "example.com"},
+		{"redirect", map[string]any{"domain": "redirect.example", "ip": "192.0.2.1"}, spf.Pass, "ip4:192.0.2.0/24", "example.com"},
+		{"mx", map[string]any{"domain": "mx.example", "ip": "203.0.113.99"}, spf.Pass, "mx/24", "mx.example"},
+		{"macro", map[string]any{"sender": "foo-bar@macro.example", "ip": "192.0.2.3"}, spf.Pass, "exists:%{ir}.%{l1r-}.allow.%{o}", "macro.example"},
+		{"macro neutral", map[string]any{"sender": "bar-foo@macro.example", "ip": "192.0.2.3"}, spf.Neutral, "?all", "macro.example"},
+		{"lookup limit", map[string]any{"domain": "loop.example", "ip": "192.0.2.1"}, spf.PermError, "", ""},
+		{"multiple records", map[string]any{"domain": "twice.example", "ip": "192.0.2.1"}, spf.PermError, "", ""},
+		{"dns failure", map[string]any{"domain": "broken.example", "ip": "192.0.2.1"}, spf.TempError, "", ""},
+		{"no record", map[string]any{"domain": "nothing.example", "ip": "192.0.2.1"}, spf.None, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got spf.Evaluation
+			if res := env.call(t, "check_spf", tt.args, &got); res.IsError {
+				t.Fatalf("check_spf failed: %s", resultText(res))
+			}
+			if got.Result != tt.result || got.Mechanism != tt.mechanism || got.MatchedDomain != tt.matched {
+				t.Errorf("got %s (%q in %q, error %q), want %s (%q in %q)",
+					got.Result, got.Mechanism, got.MatchedDomain, got.Error, tt.result, tt.mechanism, tt.matched)
+			}
+		})
+	}
+
+	var failed spf.Evaluation
+	env.call(t, "check_spf", map[string]any{"domain": "example.com", "ip": "198.51.100.7"}, &failed)
+	if failed.Explanation != "198.51.100.7 is not authorized to send mail for example.com" {
+		t.Errorf("explanation = %q", failed.Explanation)
+	}
+	if failed.DNSLookups != 1 || !strings.HasPrefix(failed.Record, "v=spf1 ip4:") {
+		t.Errorf("unexpected evaluation: %+v", failed)
+	}
+
+	for _, args := range []map[string]any{
+		{"domain": "example.com", "ip": "not-an-ip"},
+		{"ip": "192.0.2.1"},
+		{"domain": "-bad-.example", "ip": "192.0.2.1"},
+	} {
+		if res := env.call(t, "check_spf", args, nil); !res.IsError {
+			t.Errorf("invalid arguments %v accepted", args)
+		}
+	}
+}
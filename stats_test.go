@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/spamdtest"
+	"spamassassin-mcp/internal/stats"
+)
+
+func TestStats(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.RateLimiting.Tools = map[string]config.ToolRateLimit{
+			"parse_email": {DailyQuota: 1},
+		}
+	})
+
+	env.spamd.SetResponse("REPORT", spamdtest.Response{
+		Spam:  true,
+		Score: 12.0,
+		Rules: []spamdtest.Rule{
+			{Name: "URIBL_BLACK", Score: 3.0, Description: "Contains an URL listed in the URIBL blacklist"},
+			{Name: "BAYES_99", Score: 9.0, Description: "Bayes spam probability is 99 to 100%"},
+		},
+	})
+	env.spamd.SetResponse("CHECK", spamdtest.Response{Score: 2.0})
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true}, nil)
+	env.call(t, "scan_email", map[string]any{"content": testEmail, "verbose": true}, nil)
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+
+	// The second call exceeds the quota and counts as a rejection.
+	env.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+	env.call(t, "parse_email", map[string]any{"content": testEmail}, nil)
+
+	var snapshot stats.Snapshot
+	env.call(t, "get_stats", map[string]any{}, &snapshot)
+	if snapshot.MessagesScanned != 3 || snapshot.SpamDetected != 2 || snapshot.AverageScore != 26.0/3 {
+		t.Errorf("unexpected totals: %+v", snapshot)
+	}
+	if snapshot.RateLimitRejections != 1 {
+		t.Errorf("rate_limit_rejections = %d, want 1", snapshot.RateLimitRejections)
+	}
+	if len(snapshot.TopRules) != 2 || snapshot.TopRules[0] != (stats.RuleHits{Rule: "BAYES_99", Hits: 2}) {
+		t.Errorf("unexpected top rules: %+v", snapshot.TopRules)
+	}
+	if snapshot.P95LatencyMS <= 0 || snapshot.Since.IsZero() {
+		t.Errorf("latency or start time missing: %+v", snapshot)
+	}
+
+	// Persisted totals survive a restart.
+	cfg := config.StatsConfig{Path: filepath.Join(t.TempDir(), "stats.json")}
+	c, err := stats.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 100; i++ {
+		c.RecordScan(1, false, []string{"RULE"}, time.Duration(i)*time.Millisecond)
+	}
+	c.RecordRejection()
+	want := c.Snapshot()
+	if want.P95LatencyMS != 95 {
+		t.Errorf("p95 = %v, want 95", want.P95LatencyMS)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = stats.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := c.Snapshot()
+	if got.MessagesScanned != 100 || got.RateLimitRejections != 1 || got.P95LatencyMS != 95 || !got.Since.Equal(want.Since) || got.TopRules[0].Hits != 100 {
+		t.Errorf("restored %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/spamdtest"
+	"spamassassin-mcp/internal/webhook"
+)
+
+func TestTagRouting(t *testing.T) {
+	posts := make(chan webhook.Verdict, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v webhook.Verdict
+		if r.Header.Get("Authorization") != "Bearer secret" || json.NewDecoder(r.Body).Decode(&v) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		posts <- v
+	}))
+	defer hook.Close()
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Tags = []config.TagRule{
+			{Tag: "finance-phish", Rules: []string{"FREEMAIL_FORGED_REPLYTO"}},
+			{Tag: "uribl", Rules: []string{"URIBL_BLACK"}},
+		}
+		cfg.TagWebhooks = []config.TagWebhookConfig{{
+			URL:     hook.URL,
+			Tags:    []string{"finance-phish"},
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		}}
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+	})
+
+	// Rule-keyed tags apply to non-verbose scans, which ask for the rule names
+	env.spamd.SetResponse("", spamdtest.Response{Spam: true, Score: 8, Rules: []spamdtest.Rule{{Name: "FREEMAIL_FORGED_REPLYTO", Score: 8}}})
+	var result handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": testEmail}, &result); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if cmd := env.spamd.Requests()[0].Command; cmd != "SYMBOLS" {
+		t.Errorf("scan sent %s, want SYMBOLS", cmd)
+	}
+	if strings.Join(result.Tags, ",") != "finance-phish" || len(result.RulesHit) != 1 {
+		t.Errorf("unexpected result: tags %v, rules %+v", result.Tags, result.RulesHit)
+	}
+
+	select {
+	case v := <-posts:
+		if v.Verdict != "spam" || v.Score != 8 || strings.Join(v.Tags, ",") != "finance-phish" || v.Hash == "" {
+			t.Errorf("unexpected webhook verdict: %+v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+
+	// A tag not routed to the webhook is not posted
+	env.spamd.SetResponse("", spamdtest.Response{Spam: true, Score: 8, Rules: []spamdtest.Rule{{Name: "URIBL_BLACK", Score: 8}}})
+	env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)
+	select {
+	case v := <-posts:
+		t.Errorf("webhook called for an unrouted tag: %+v", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// History records the tags and filters on them
+	var page listquery.Page[*history.Entry]
+	if res := env.call(t, "query_history", map[string]any{"filter": map[string]string{"tags": "FINANCE-PHISH,other"}}, &page); res.IsError {
+		t.Fatalf("query_history failed: %s", resultText(res))
+	}
+	if page.Total != 1 || strings.Join(page.Items[0].Tags, ",") != "finance-phish" {
+		t.Errorf("unexpected tag filter result: %+v", page)
+	}
+	// Tags match whole items, not substrings
+	env.call(t, "query_history", map[string]any{"filter": map[string]string{"tags": "finance"}}, &page)
+	if page.Total != 0 {
+		t.Errorf("partial tag matched %d entries", page.Total)
+	}
+}
+
+func TestTagWebhookValidation(t *testing.T) {
+	yaml := `tags:
+  - tag: finance-phish
+    min_score: 10
+tag_webhooks:
+  - url: "http://hooks.example.com/finance"
+    tags: ["finance-phish", "unknown"]
+  - url: "ftp://hooks.example.com"
+`
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"tag_webhooks[0].url: http sends verdicts in clear and is only allowed for a loopback server",
+		`tag_webhooks[0].tags: "unknown" is not defined in tags`,
+		`tag_webhooks[1].url: must be an http or https URL, got "ftp://hooks.example.com"`,
+		"tag_webhooks[1].tags: at least one tag is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/ioc"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+// fakeTAXII is a TAXII 2.1 collection that records the objects added.
+type fakeTAXII struct {
+	mu       sync.Mutex
+	requests int
+	objects  []*ioc.STIXIndicator
+}
+
+func (f *fakeTAXII) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/taxii+json;version=2.1")
+	if user, pass, ok := r.BasicAuth(); !ok || user != "publisher" || pass != "taxii-secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"title":"Unauthorized","description":"Invalid credentials"}`))
+		return
+	}
+	if r.Method != http.MethodPost || r.URL.Path != "/api1/collections/spam-iocs/objects/" ||
+		r.Header.Get("Content-Type") != "application/taxii+json;version=2.1" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var envelope struct {
+		Objects []*ioc.STIXIndicator `json:"objects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests++
+	f.objects = append(f.objects, envelope.Objects...)
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"id": "2d086da7-4bdc-4f91-900e-d77486753710", "status": "complete",
+		"total_count": len(envelope.Objects), "success_count": len(envelope.Objects),
+	})
+}
+
+// taken returns and forgets the objects added so far.
+func (f *fakeTAXII) taken() map[string]*ioc.STIXIndicator {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects := make(map[string]*ioc.STIXIndicator)
+	for _, o := range f.objects {
+		objects[o.Pattern] = o
+	}
+	f.objects = nil
+	return objects
+}
+
+func TestTAXIIPublishing(t *testing.T) {
+	collection := &fakeTAXII{}
+	srv := httptest.NewServer(collection)
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.TAXII = config.TAXIIConfig{
+			APIRoot:        srv.URL + "/api1/",
+			CollectionID:   "spam-iocs",
+			Username:       "publisher",
+			Password:       "taxii-secret",
+			Interval:       time.Hour,
+			Timeout:        5 * time.Second,
+			MinConfidence:  50,
+			ExcludeDomains: []string{"Example.com"},
+			MaxIndicators:  100,
+		}
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		switch {
+		case strings.Contains(string(req.Body), "pharmacy"):
+			return spamdtest.Response{Spam: true, Score: 12.5}
+		case strings.Contains(string(req.Body), "discount"):
+			return spamdtest.Response{Spam: true, Score: 6}
+		}
+		return spamdtest.Response{Score: 0.4}
+	})
+	scan := func(id, body string) {
+		t.Helper()
+		email := "From: deals@promo.example\r\nSubject: Offer\r\nMessage-ID: <" + id + "@promo.example>\r\n\r\n" + body + "\r\n"
+		if res := env.call(t, "scan_email", map[string]any{"content": email}, nil); res.IsError {
+			t.Fatalf("scan_email failed: %s", resultText(res))
+		}
+	}
+	publish := func() {
+		t.Helper()
+		if _, err := env.feed.Publish(context.Background()); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+
+	scan("1", "Cheap pharmacy at http://pills.bad.example/buy - unsubscribe at https://www.example.com/u")
+	scan("2", "A discount at http://cheap.bad.example/deal")
+	scan("3", "Minutes at https://ham.example.net/minutes")
+	publish()
+
+	// Only indicators scoring 50 or more: seen once in a message at 2.5
+	// times the threshold (70), not at 1.2 times (40).
+	objects := collection.taken()
+	url, domain := objects["[url:value = 'http://pills.bad.example/buy']"], objects["[domain-name:value = 'pills.bad.example']"]
+	if len(objects) != 2 || url == nil || domain == nil {
+		t.Fatalf("unexpected objects: %v", objects)
+	}
+	if url.Confidence != 70 || url.Type != "indicator" || url.SpecVersion != "2.1" || !strings.HasPrefix(url.ID, "indicator--") ||
+		len(url.IndicatorTypes) != 1 || url.IndicatorTypes[0] != "malicious-activity" || url.Description != "Seen in 1 spam message(s)" {
+		t.Errorf("unexpected indicator: %+v", url)
+	}
+
+	// Nothing new, nothing sent.
+	publish()
+	if collection.requests != 1 {
+		t.Errorf("unchanged indicators sent again: %d requests", collection.requests)
+	}
+
+	// More sightings raise the confidence; the same message scanned again
+	// counts once.
+	scan("1", "Cheap pharmacy at http://pills.bad.example/buy - unsubscribe at https://www.example.com/u")
+	scan("4", "Another discount at http://cheap.bad.example/deal")
+	scan("5", "More pharmacy at http://pills.bad.example/buy")
+	publish()
+	objects = collection.taken()
+	cheap, again := objects["[url:value = 'http://cheap.bad.example/deal']"], objects["[url:value = 'http://pills.bad.example/buy']"]
+	if cheap == nil || cheap.Confidence != 50 {
+		t.Errorf("second sighting not published: %+v", cheap)
+	}
+	if again == nil || again.Confidence != 80 || again.ID != url.ID || again.Created != url.Created || again.Modified <= url.Modified {
+		t.Errorf("not a new version of %+v: %+v", url, again)
+	}
+	for pattern := range objects {
+		if strings.Contains(pattern, "example.com") || strings.Contains(pattern, "example.net") || strings.Contains(pattern, "promo.example") {
+			t.Errorf("excluded, ham or sender indicator published: %s", pattern)
+		}
+	}
+}
+
+func TestTAXIIConfigValidation(t *testing.T) {
+	yaml := "taxii:\n  api_root: \"http://taxii.internal/api1/\"\n  collection_id: \"a/b\"\n  username: \"publisher\"\n" +
+		"  token: \"t\"\n  interval: \"10s\"\n  min_confidence: 120\n  exclude_domains: [\"*.example.com\"]\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"taxii.api_root: http sends credentials in clear and is only allowed for a loopback server",
+		`taxii.collection_id: must be the ID of a collection, got "a/b"`,
+		"taxii: set either token or username and password, not both",
+		"taxii.username and password: must be set together",
+		"taxii.interval: must be at least 1m, got 10s",
+		"taxii.min_confidence: must be between 0 and 100, got 120",
+		`taxii.exclude_domains[0]: must be a domain name, got "*.example.com"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
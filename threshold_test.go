@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+func TestRequestThreshold(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.SpamAssassin.ThresholdMin = 2.0
+		cfg.SpamAssassin.ThresholdMax = 10.0
+	})
+	env.spamd.SetResponse("", spamdtest.Response{Score: 4.0})
+
+	for _, tc := range []struct {
+		args      map[string]any
+		threshold float64
+		spam      bool
+		requested float64
+		text      string
+	}{
+		{map[string]any{}, spamdtest.DefaultThreshold, false, 0, "Spam: false"},
+		{map[string]any{"threshold": 3.0}, 3.0, true, 0, "Spam: true, threshold: 3.00"},
+		// The request replaces the profile's threshold
+		{map[string]any{"threshold": 4.5, "profile": "aggressive"}, 4.5, false, 0, "Spam: false, threshold: 4.50"},
+		{map[string]any{"threshold": 0.5}, 2.0, true, 0.5, "threshold: 2.00 (requested 0.50, clamped)"},
+		{map[string]any{"threshold": 50}, 10.0, false, 50, "threshold: 10.00 (requested 50.00, clamped)"},
+	} {
+		tc.args["content"] = testEmail
+		var result handlers.ScanEmailResult
+		res := env.call(t, "scan_email", tc.args, &result)
+		if res.IsError {
+			t.Fatalf("%v: scan_email failed: %s", tc.args, resultText(res))
+		}
+		if result.Threshold != tc.threshold || result.IsSpam != tc.spam || !strings.Contains(resultText(res), tc.text) {
+			t.Errorf("%v: threshold %v, spam %v: %s", tc.args["threshold"], result.Threshold, result.IsSpam, resultText(res))
+		}
+		if requested := result.RequestedThreshold; (requested == nil) != (tc.requested == 0) || requested != nil && *requested != tc.requested {
+			t.Errorf("%v: unexpected requested threshold %v", tc.args["threshold"], requested)
+		}
+	}
+}
+
+func TestThresholdBoundsValidation(t *testing.T) {
+	yaml := "spamassassin:\n  threshold_min: 8.0\n  threshold_max: 4.0\n"
+	err := validateConfig(t, yaml)
+	if err == nil || !strings.Contains(err.Error(), "spamassassin.threshold_max: must be at least spamassassin.threshold_min (8), got 4") {
+		t.Errorf("unexpected validation result: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/spamdtest"
+	"spamassassin-mcp/internal/toolerr"
+)
+
+func TestToolErrorCodes(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.MaxEmailSize = 1024
+		cfg.Security.RateLimiting.Tools = map[string]config.ToolRateLimit{
+			"get_config": {DailyQuota: 1},
+		}
+	})
+
+	code := func(res *mcp.CallToolResult) toolerr.Result {
+		t.Helper()
+		var r toolerr.Result
+		data, _ := json.Marshal(res.StructuredContent)
+		if !res.IsError || json.Unmarshal(data, &r) != nil || r.Code == "" {
+			t.Fatalf("expected structured error, got %s", resultText(res))
+		}
+		return r
+	}
+
+	for _, tc := range []struct {
+		tool string
+		args map[string]any
+		want string
+	}{
+		{"scan_email", map[string]any{"content": strings.Repeat("x", 2048)}, toolerr.SizeExceeded},
+		{"scan_email", map[string]any{"content": ""}, toolerr.ValidationFailed},
+		{"scan_email", map[string]any{"content": testEmail, "profile": "missing"}, toolerr.NotFound},
+		{"check_reputation", map[string]any{"sender": "not an address"}, toolerr.ValidationFailed},
+		{"query_history", map[string]any{}, toolerr.NotConfigured},
+		{"extract_iocs", map[string]any{"content": testEmail, "format": "csv"}, toolerr.UnsupportedFormat},
+		{"remove_blocklist_entry", map[string]any{"value": "never-added.example"}, toolerr.NotFound},
+		{"get_scan_result", map[string]any{"scan_id": "unknown"}, toolerr.NotFound},
+	} {
+		res := env.call(t, tc.tool, tc.args, nil)
+		r := code(res)
+		if r.Code != tc.want || r.Message != resultText(res) {
+			t.Errorf("%s %v: got %+v, want code %s", tc.tool, tc.args, r, tc.want)
+		}
+	}
+
+	// Rate limit rejections share the code field.
+	env.call(t, "get_config", map[string]any{}, nil)
+	if r := code(env.call(t, "get_config", map[string]any{}, nil)); r.Code != toolerr.QuotaExceeded {
+		t.Errorf("unexpected quota rejection: %+v", r)
+	}
+
+	env.spamd.InjectFault(spamdtest.FaultUnavailable, 1)
+	if r := code(env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)); r.Code != toolerr.SpamdUnavailable {
+		t.Errorf("unexpected error for an unavailable spamd: %+v", r)
+	}
+	env.spamd.Close()
+	if r := code(env.call(t, "scan_email", map[string]any{"content": testEmail}, nil)); r.Code != toolerr.SpamdUnavailable || !strings.Contains(r.Message, "connection failed") {
+		t.Errorf("unexpected error for an unreachable spamd: %+v", r)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/dnstest"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/model"
+	"spamassassin-mcp/internal/resolver"
+	"spamassassin-mcp/internal/urls"
+)
+
+func TestUnshortenURLs(t *testing.T) {
+	// A shortener on the loopback interface, which must not be contacted
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		http.Redirect(w, r, "http://evil.example/login", http.StatusMovedPermanently)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	link := "http://localhost:" + u.Port() + "/abc"
+
+	email := "From: alice@example.com\r\nSubject: Links\r\n\r\n" +
+		"Short: " + link + "\r\nAlso: https://bit.ly/abc123\r\nPlain: https://example.com/docs\r\n"
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Unshorten = config.UnshortenConfig{Enabled: true, Timeout: 5 * time.Second, MaxRedirects: 5, MaxURLs: 1, Shorteners: []string{"localhost"}}
+	})
+	var links handlers.ExtractURLsResult
+	if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true, "unshorten": true}, &links); res.IsError {
+		t.Fatalf("extract_urls failed: %s", resultText(res))
+	}
+	if len(links.URLs) != 3 {
+		t.Fatalf("got %d URLs", len(links.URLs))
+	}
+	problems := strings.Join(links.Errors, "\n")
+	if requested || links.URLs[0].FinalURL != "" || len(links.URLs[0].RedirectChain) != 0 ||
+		!strings.Contains(problems, "unshorten "+link+": ") || !strings.Contains(problems, "refusing to connect to non-public address") {
+		t.Errorf("shortener on a loopback address contacted: %+v %v", links.URLs[0], links.Errors)
+	}
+	// The built-in shortener is over the limit; other links are left alone.
+	if links.URLs[1].FinalURL != "" || !strings.Contains(problems, "unshorten: 1 link(s) skipped, over the limit of 1 per call") {
+		t.Errorf("link limit not applied: %+v %v", links.URLs[1], links.Errors)
+	}
+	if len(links.URLs[2].RedirectChain) != 0 || len(links.Errors) != 2 {
+		t.Errorf("unexpected unshortening: %+v %v", links.URLs[2], links.Errors)
+	}
+
+	// Unshortening is opt-in per call and must be enabled.
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true, "unshorten": true}, nil); !res.IsError || !strings.Contains(resultText(res), "unshorten.enabled") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestUnshortenRedirectChain(t *testing.T) {
+	// A shortener redirecting through a tracker to the destination, all on
+	// loopback servers reached through names the test resolver maps there
+	var (
+		mu      sync.Mutex
+		methods []string
+	)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		methods = append(methods, r.Method)
+	}
+	dest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+	}))
+	t.Cleanup(dest.Close)
+	_, destPort, _ := net.SplitHostPort(strings.TrimPrefix(dest.URL, "http://"))
+	final := "http://landing.example:" + destPort + "/offer?id=7"
+
+	tracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.Redirect(w, r, final, http.StatusFound)
+	}))
+	t.Cleanup(tracker.Close)
+	_, trackerPort, _ := net.SplitHostPort(strings.TrimPrefix(tracker.URL, "http://"))
+	hop := "http://track.example:" + trackerPort + "/c/42"
+
+	shortener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.Redirect(w, r, hop, http.StatusMovedPermanently)
+	}))
+	t.Cleanup(shortener.Close)
+	_, shortenerPort, _ := net.SplitHostPort(strings.TrimPrefix(shortener.URL, "http://"))
+	link := "http://sho.rt:" + shortenerPort + "/abc"
+
+	dns := dnstest.NewServer()
+	t.Cleanup(dns.Close)
+	for _, name := range []string{"sho.rt", "track.example", "landing.example"} {
+		dns.AddA(name, "127.0.0.1")
+	}
+
+	// The test servers are let through; every other address is checked as
+	// in production
+	control := func(network, address string, c syscall.RawConn) error {
+		if host, _, _ := net.SplitHostPort(address); host == "127.0.0.1" {
+			return nil
+		}
+		return urls.RefuseNonPublic(network, address, c)
+	}
+	cfg := config.UnshortenConfig{Enabled: true, Timeout: 5 * time.Second, MaxRedirects: 5, MaxURLs: 10, Shorteners: []string{"sho.rt", "cgn.rt"}}
+	unshortener := urls.NewUnshortenerWithDialer(cfg, &net.Dialer{
+		Timeout:  cfg.Timeout,
+		Resolver: resolver.New(config.DNSConfig{Server: dns.Addr()}),
+		Control:  control,
+	})
+	email, err := model.Parse("From: alice@example.com\r\nSubject: Link\r\n\r\nOpen " + link + "\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := urls.Extract(email)
+	if problems := unshortener.Unshorten(context.Background(), list); len(problems) != 0 {
+		t.Fatalf("unshortening failed: %v", problems)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d URLs", len(list))
+	}
+	if got := strings.Join(list[0].RedirectChain, " "); got != hop+" "+final || list[0].FinalURL != final {
+		t.Errorf("redirect chain %q, final URL %q", got, list[0].FinalURL)
+	}
+	mu.Lock()
+	if got := strings.Join(methods, ","); got != "HEAD,HEAD,HEAD" {
+		t.Errorf("requests made: %s", got)
+	}
+	mu.Unlock()
+
+	// A chain longer than max_redirects stops with what was followed
+	cfg.MaxRedirects = 1
+	unshortener = urls.NewUnshortenerWithDialer(cfg, &net.Dialer{
+		Timeout:  cfg.Timeout,
+		Resolver: resolver.New(config.DNSConfig{Server: dns.Addr()}),
+		Control:  control,
+	})
+	list = urls.Extract(email)
+	problems := unshortener.Unshorten(context.Background(), list)
+	if len(problems) != 1 || !strings.Contains(problems[0], "stopped after 1 redirects") || strings.Join(list[0].RedirectChain, " ") != hop || list[0].FinalURL != "" {
+		t.Errorf("unexpected result over the redirect limit: %+v %v", list[0], problems)
+	}
+
+	// A hop to a carrier-grade NAT address is refused before connecting
+	carrier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://cpe.carrier.example/admin", http.StatusFound)
+	}))
+	t.Cleanup(carrier.Close)
+	_, carrierPort, _ := net.SplitHostPort(strings.TrimPrefix(carrier.URL, "http://"))
+	dns.AddA("cgn.rt", "127.0.0.1")
+	dns.AddA("cpe.carrier.example", "100.64.0.1")
+	cfg.MaxRedirects = 5
+	unshortener = urls.NewUnshortenerWithDialer(cfg, &net.Dialer{
+		Timeout:  cfg.Timeout,
+		Resolver: resolver.New(config.DNSConfig{Server: dns.Addr()}),
+		Control:  control,
+	})
+	email, err = model.Parse("From: alice@example.com\r\nSubject: Link\r\n\r\nOpen http://cgn.rt:" + carrierPort + "/x\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list = urls.Extract(email)
+	problems = unshortener.Unshorten(context.Background(), list)
+	if len(problems) != 1 || !strings.Contains(problems[0], "refusing to connect to non-public address 100.64.0.1") ||
+		strings.Join(list[0].RedirectChain, " ") != "http://cpe.carrier.example/admin" || list[0].FinalURL != "" {
+		t.Errorf("redirect to a carrier-grade NAT address followed: %+v %v", list[0], problems)
+	}
+}
+
+func TestUnshortenConfigValidation(t *testing.T) {
+	yaml := "unshorten:\n  enabled: true\n  max_redirects: 50\n  shorteners: [\"https://sho.rt/\"]\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"unshorten.max_redirects: must be between 1 and 20, got 50",
+		`unshorten.shorteners[0]: must be a domain name, got "https://sho.rt/"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/urls"
+)
+
+const urlhausCSV = `################################################################
+# abuse.ch URLhaus Database Dump (CSV - online URLs only)      #
+################################################################
+#
+# id,dateadded,url,url_status,last_online,threat,tags,urlhaus_link,reporter
+"2771011","2024-01-03 10:12:05","http://malware.example/bins/x.exe","online","2024-01-03 10:12:05","malware_download","exe,AgentTesla","https://urlhaus.abuse.ch/url/2771011/","abuse_ch"
+"2771010","2024-01-03 10:11:44","http://198.51.100.7:8080/i","online","2024-01-03 10:11:44","malware_download","elf,mirai","https://urlhaus.abuse.ch/url/2771010/","geenensp"
+`
+
+const phishTankJSON = `[
+ {"phish_id":"8412345","url":"https://login.paypa1.example/verify","phish_detail_url":"http://www.phishtank.com/phish_detail.php?phish_id=8412345",
+  "submission_time":"2024-01-03T09:58:14+00:00","verified":"yes","verification_time":"2024-01-03T10:04:31+00:00","online":"yes","details":[],"target":"PayPal"},
+ {"phish_id":"8412346","url":"https://unverified.example/","phish_detail_url":"http://www.phishtank.com/phish_detail.php?phish_id=8412346","verified":"no","target":"Other"}
+]`
+
+func TestURLFeeds(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(urlhausCSV))
+	zw.Close()
+
+	var downloads, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/downloads/csv_online/" || r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(gz.Bytes())
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	mirror := filepath.Join(dir, "urlhaus.csv.gz")
+	phishtank := filepath.Join(dir, "online-valid.json")
+	if err := os.WriteFile(phishtank, []byte(phishTankJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.URLFeeds = config.URLFeedsConfig{
+			URLhaus:   config.URLFeedSource{URL: srv.URL + "/downloads/csv_online/", Path: mirror, Refresh: time.Hour},
+			PhishTank: config.URLFeedSource{Path: phishtank, Refresh: time.Hour},
+			Timeout:   5 * time.Second,
+			MaxSize:   1 << 20,
+		}
+	})
+	if sizes := env.urlFeeds.Sizes(); sizes["phishtank"] != 1 || sizes["urlhaus"] != 0 {
+		t.Fatalf("local copy not loaded at startup: %v", sizes)
+	}
+	if err := env.urlFeeds.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if sizes := env.urlFeeds.Sizes(); sizes["urlhaus"] != 2 {
+		t.Fatalf("download not loaded: %v", sizes)
+	}
+	if data, err := os.ReadFile(mirror); err != nil || !bytes.Equal(data, gz.Bytes()) {
+		t.Errorf("download not mirrored to %s: %v", mirror, err)
+	}
+
+	// Listed URLs match however the message writes them.
+	email := "From: alice@example.com\r\nSubject: Invoice\r\n\r\nDownload HTTP://Malware.Example:80/bins/x.exe#now or sign in at " +
+		"https://login.paypa1.example/verify, not https://unverified.example/ or https://example.com/\r\n"
+	var scan handlers.ScanEmailResult
+	if res := env.call(t, "scan_email", map[string]any{"content": email}, &scan); res.IsError {
+		t.Fatalf("scan_email failed: %s", resultText(res))
+	}
+	if len(scan.URLFeedMatches) != 2 {
+		t.Fatalf("unexpected matches: %+v", scan.URLFeedMatches)
+	}
+	for _, m := range scan.URLFeedMatches {
+		switch m.URL {
+		case "http://malware.example/bins/x.exe":
+			if m.Feed != "urlhaus" || m.Threat != "malware_download" || m.Reference != "https://urlhaus.abuse.ch/url/2771011/" {
+				t.Errorf("unexpected URLhaus match: %+v", m)
+			}
+		case "https://login.paypa1.example/verify":
+			if m.Feed != "phishtank" || m.Threat != "phishing: PayPal" || !strings.Contains(m.Reference, "8412345") {
+				t.Errorf("unexpected PhishTank match: %+v", m)
+			}
+		default:
+			t.Errorf("unexpected match: %+v", m)
+		}
+	}
+
+	var extracted handlers.ExtractURLsResult
+	if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true}, &extracted); res.IsError {
+		t.Fatalf("extract_urls failed: %s", resultText(res))
+	}
+	for _, u := range extracted.URLs {
+		listed := u.URL == "http://malware.example/bins/x.exe" || u.URL == "https://login.paypa1.example/verify"
+		if listed != (u.Verdict == urls.Malicious) || listed != (len(u.Listings) == 1) {
+			t.Errorf("%s: verdict %s, listings %+v", u.URL, u.Verdict, u.Listings)
+		}
+	}
+
+	// An unchanged download is not fetched again.
+	if err := env.urlFeeds.Refresh(context.Background()); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if downloads.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("got %d downloads and %d not modified responses", downloads.Load(), notModified.Load())
+	}
+	if sizes := env.urlFeeds.Sizes(); sizes["urlhaus"] != 2 {
+		t.Errorf("dataset lost on an unchanged download: %v", sizes)
+	}
+}
+
+func TestURLFeedsConfigValidation(t *testing.T) {
+	yaml := "url_feeds:\n  urlhaus:\n    url: \"http://urlhaus.abuse.ch/downloads/csv_online/\"\n" +
+		"  phishtank:\n    path: \"/var/lib/feeds/online-valid.json\"\n    refresh: \"30s\"\n  max_size: 0\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"url_feeds.urlhaus.url: must be https; http is only allowed for a loopback server",
+		"url_feeds.phishtank.refresh: must be at least 1m, got 30s",
+		"url_feeds.max_size: must be positive, got 0",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/urls"
+)
+
+const linkEmail = "From: alice@example.com\r\n" +
+	"To: bob@example.org\r\n" +
+	"Subject: Links\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=B1\r\n" +
+	"\r\n" +
+	"--B1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Log in at hxxps://evil[.]example/login or read www.example.org/docs.\r\n" +
+	"Short: https://bit.ly/abc123\r\n" +
+	"Redirect: https://www.google.com/url?q=https://evil.example/x\r\n" +
+	"Admin: http://0xC0A80001/admin\r\n" +
+	"Account: http://paypal.com@phish.example/\r\n" +
+	"Report: https://Example.COM:443/q1#top\r\n" +
+	"--B1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<html><head><meta http-equiv=\"refresh\" content=\"5; url=https://refused.example/\"></head><body>\r\n" +
+	"<a href=\"https://shop.blocked.example/cart\">https://shop.example.com/cart</a>\r\n" +
+	"<img src=\"https://cdn.example.net/logo.png\">\r\n" +
+	"<a href=\"&#104;ttps://example.com/q1\">the <b>report</b></a>\r\n" +
+	"<form action=\"https://evil.example/login\"></form>\r\n" +
+	"<style>body { background: url(https://style.example/bg.png) }</style>\r\n" +
+	"</body></html>\r\n" +
+	"--B1--\r\n"
+
+func TestExtractURLs(t *testing.T) {
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Security.BlockedDomains = []string{"blocked.example"}
+	})
+	env.dns.AddA("evil.example.dbl.spamhaus.org", "127.0.1.2")
+	env.dns.AddA("refused.example.multi.uribl.com", "127.0.0.1")
+
+	extract := func(t *testing.T, args map[string]any) (*handlers.ExtractURLsResult, map[string]*urls.URL) {
+		t.Helper()
+		var result handlers.ExtractURLsResult
+		if res := env.call(t, "extract_urls", args, &result); res.IsError {
+			t.Fatalf("extract_urls failed: %s", resultText(res))
+		}
+		byURL := make(map[string]*urls.URL)
+		for _, u := range result.URLs {
+			byURL[u.URL] = u
+		}
+		return &result, byURL
+	}
+
+	result, found := extract(t, map[string]any{"content": linkEmail})
+	tests := []struct {
+		url     string
+		verdict urls.Verdict
+		flags   []string
+	}{
+		{"https://evil.example/login", urls.Malicious, []string{urls.Defanged}},
+		{"http://www.example.org/docs", urls.Suspicious, []string{urls.MissingScheme}},
+		{"https://bit.ly/abc123", urls.Suspicious, []string{urls.URLShortener}},
+		{"https://www.google.com/url?q=https://evil.example/x", urls.Suspicious, []string{urls.RedirectParameter}},
+		{"http://192.168.0.1/admin", urls.Suspicious, []string{urls.EncodedIP, urls.IPHost}},
+		{"http://phish.example/", urls.Suspicious, []string{urls.Userinfo}},
+		{"https://example.com/q1", urls.Suspicious, []string{urls.HTMLEntities}},
+		{"https://shop.blocked.example/cart", urls.Malicious, nil},
+		{"https://shop.example.com/cart", urls.Clean, nil},
+		{"https://cdn.example.net/logo.png", urls.Clean, nil},
+		{"https://refused.example/", urls.Clean, nil},
+	}
+	if len(result.URLs) != len(tests) {
+		t.Errorf("got %d URLs, want %d", len(result.URLs), len(tests))
+		for _, u := range result.URLs {
+			t.Logf("  %s %v", u.URL, u.Flags)
+		}
+	}
+	for _, tt := range tests {
+		u := found[tt.url]
+		if u == nil {
+			t.Errorf("%s not extracted", tt.url)
+			continue
+		}
+		if u.Verdict != tt.verdict || !slices.Equal(u.Flags, tt.flags) {
+			t.Errorf("%s: got %s %v, want %s %v", tt.url, u.Verdict, u.Flags, tt.verdict, tt.flags)
+		}
+	}
+	if result.Malicious != 2 || result.Suspicious != 6 {
+		t.Errorf("got %d malicious and %d suspicious, want 2 and 6", result.Malicious, result.Suspicious)
+	}
+
+	// Occurrences of the same destination are merged across parts.
+	if u := found["https://evil.example/login"]; u == nil || u.Original != "hxxps://evil[.]example/login" ||
+		!slices.Equal(u.Sources, []string{urls.SourceText, urls.SourceForm}) ||
+		len(u.Listings) != 1 || u.Listings[0] != (urls.Listing{List: "dbl.spamhaus.org", Result: "127.0.1.2"}) {
+		t.Errorf("unexpected defanged URL: %+v", u)
+	}
+	if u := found["https://example.com/q1"]; u == nil || !slices.Equal(u.Parts, []string{"1.1", "1.2"}) || u.Text != "the report" {
+		t.Errorf("unexpected report URL: %+v", u)
+	}
+	if u := found["https://shop.blocked.example/cart"]; u == nil || u.Text != "https://shop.example.com/cart" ||
+		u.Listings[0] != (urls.Listing{List: urls.BlockedDomainsList, Result: "blocked.example"}) {
+		t.Errorf("unexpected blocked URL: %+v", u)
+	}
+	if u := found["https://www.google.com/url?q=https://evil.example/x"]; u == nil || u.RedirectTarget != "https://evil.example/x" {
+		t.Errorf("unexpected redirect URL: %+v", u)
+	}
+	if u := found["https://refused.example/"]; u == nil || !slices.Equal(u.Sources, []string{urls.SourceRefresh}) {
+		t.Errorf("unexpected refresh URL: %+v", u)
+	}
+
+	// A refused query is an error, and the refusing zone is not queried
+	// again.
+	if len(result.Errors) != 1 {
+		t.Errorf("got errors %v, want one refused query", result.Errors)
+	}
+
+	// Without DNS only the blocked domains apply.
+	queries := len(env.dns.Queries())
+	result, found = extract(t, map[string]any{"content": linkEmail, "skip_dns": true})
+	if u := found["https://evil.example/login"]; u == nil || u.Verdict != urls.Suspicious || result.Malicious != 1 {
+		t.Errorf("unexpected result without DNS: %+v", u)
+	}
+	if len(env.dns.Queries()) != queries {
+		t.Error("skip_dns still queried DNS")
+	}
+}
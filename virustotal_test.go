@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+)
+
+func TestVirusTotalLookups(t *testing.T) {
+	exe := append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 120)...)
+	sum := sha256.Sum256(exe)
+	knownHash := hex.EncodeToString(sum[:])
+	knownURL := base64.RawURLEncoding.EncodeToString([]byte("http://evil.example/login"))
+
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodGet || r.Header.Get("x-apikey") != "vt-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"WrongCredentialsError","message":"Wrong API key"}}`))
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v3/files/" + knownHash, "/api/v3/urls/" + knownURL:
+			w.Write([]byte(`{"data":{"type":"file","attributes":{"first_submission_date":1704183295,"last_analysis_date":1704302411,
+				"last_analysis_stats":{"harmless":0,"type-unsupported":4,"suspicious":1,"confirmed-timeout":0,"timeout":0,"failure":0,"malicious":52,"undetected":18}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"NotFoundError","message":"Resource not found"}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.VirusTotal = config.VirusTotalConfig{
+			APIKey:     "vt-key",
+			URL:        srv.URL + "/api/v3",
+			Timeout:    5 * time.Second,
+			MaxLookups: 2,
+			CacheTTL:   time.Hour,
+			CacheSize:  100,
+		}
+	})
+
+	var b strings.Builder
+	b.WriteString("From: alice@example.com\r\nTo: bob@example.org\r\nSubject: Files\r\nMIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=B1\r\n\r\n--B1\r\nContent-Type: text/plain\r\n\r\n")
+	b.WriteString("Log in at http://evil.example/login or http://new.example/a or http://third.example/b\r\n")
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{"invoice.exe", exe}, {"notes.txt", []byte("nothing to see")}} {
+		b.WriteString("--B1\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: base64\r\n")
+		b.WriteString("Content-Disposition: attachment; filename=\"" + f.name + "\"\r\n\r\n")
+		b.WriteString(base64.StdEncoding.EncodeToString(f.content) + "\r\n")
+	}
+	b.WriteString("--B1--\r\n")
+	email := b.String()
+
+	var files handlers.AnalyzeAttachmentsResult
+	if res := env.call(t, "analyze_attachments", map[string]any{"content": email, "virustotal": true}, &files); res.IsError {
+		t.Fatalf("analyze_attachments failed: %s", resultText(res))
+	}
+	if len(files.Attachments) != 2 {
+		t.Fatalf("got %d attachments", len(files.Attachments))
+	}
+	known, unknown := files.Attachments[0].VirusTotal, files.Attachments[1].VirusTotal
+	if known == nil || !known.Found || known.Ratio != "52/71" || known.Suspicious != 1 || known.FirstSeen == nil ||
+		known.FirstSeen.Format(time.RFC3339) != "2024-01-02T08:14:55Z" || !strings.HasSuffix(known.Link, knownHash) {
+		t.Errorf("unexpected report on a known file: %+v", known)
+	}
+	if unknown == nil || unknown.Found || unknown.Ratio != "" {
+		t.Errorf("unexpected report on an unknown file: %+v", unknown)
+	}
+
+	// Two uncached lookups per call: the third URL is skipped, and the
+	// second call serves the first two from the cache.
+	for i := range 2 {
+		var links handlers.ExtractURLsResult
+		if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true, "virustotal": true}, &links); res.IsError {
+			t.Fatalf("extract_urls failed: %s", resultText(res))
+		}
+		if len(links.URLs) != 3 {
+			t.Fatalf("got %d URLs", len(links.URLs))
+		}
+		if vt := links.URLs[0].VirusTotal; vt == nil || vt.Malicious != 52 || vt.Cached != (i == 1) {
+			t.Errorf("call %d: unexpected report on a known URL: %+v", i, vt)
+		}
+		if links.URLs[1].VirusTotal == nil || links.URLs[1].VirusTotal.Found {
+			t.Errorf("call %d: unexpected report on an unknown URL: %+v", i, links.URLs[1].VirusTotal)
+		}
+		if i == 0 && (links.URLs[2].VirusTotal != nil || len(links.Errors) != 1 || !strings.Contains(links.Errors[0], "1 lookup(s) skipped")) {
+			t.Errorf("lookup limit not applied: %+v %v", links.URLs[2].VirusTotal, links.Errors)
+		}
+	}
+	if len(requests) != 5 {
+		t.Errorf("got %d requests, want 5: %v", len(requests), requests)
+	}
+
+	// Lookups are opt-in per call and need a key.
+	env = newTestEnv(t, nil)
+	if res := env.call(t, "extract_urls", map[string]any{"content": email, "skip_dns": true, "virustotal": true}, nil); !res.IsError || !strings.Contains(resultText(res), "virustotal.api_key") {
+		t.Errorf("expected a configuration error, got %s", resultText(res))
+	}
+}
+
+func TestVirusTotalConfigValidation(t *testing.T) {
+	yaml := "virustotal:\n  api_key: \"k\"\n  url: \"ftp://vt.internal\"\n  max_lookups: 0\n  cache_ttl: \"0s\"\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"virustotal.url: http sends the API key in clear",
+		"virustotal.max_lookups: must be positive, got 0",
+		"virustotal.cache_ttl: must be at least 1m, got 0s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/history"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/maildir"
+	"spamassassin-mcp/internal/spamdtest"
+)
+
+// deliver writes a message to tmp/ and renames it into new/, as a delivery
+// agent does.
+func deliver(t *testing.T, dir, name, content string) {
+	t.Helper()
+	tmp := filepath.Join(dir, "tmp", name)
+	if err := os.WriteFile(tmp, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "new", name)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaildirWatch(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watch := config.MaildirWatchConfig{Dir: dir, PollInterval: 50 * time.Millisecond, NotifyScore: 8}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.History = config.HistoryConfig{Driver: "sqlite", DSN: filepath.Join(t.TempDir(), "history.db")}
+		cfg.MaildirWatch = watch
+		cfg.Security.MaxEmailSize = 4096
+	})
+	env.spamd.Handle(func(req *spamdtest.Request) spamdtest.Response {
+		switch {
+		case strings.Contains(string(req.Body), "pharmacy"):
+			return spamdtest.Response{Spam: true, Score: 12.5, Rules: []spamdtest.Rule{{Name: "BAYES_99", Score: 12.5, Description: "Bayes spam probability is 99 to 100%"}}}
+		case strings.Contains(string(req.Body), "discount"):
+			return spamdtest.Response{Spam: true, Score: 6.1, Rules: []spamdtest.Rule{{Name: "BAYES_80", Score: 6.1, Description: "Bayes spam probability is 80 to 95%"}}}
+		}
+		return spamdtest.Response{Score: 0.3}
+	})
+
+	notifications := make(chan *mcp.LoggingMessageParams, 10)
+	listener := env.connect(t, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, _ *mcp.ClientSession, p *mcp.LoggingMessageParams) {
+			notifications <- p
+		},
+	})
+	if err := listener.SetLevel(context.Background(), &mcp.SetLevelParams{Level: "info"}); err != nil {
+		t.Fatalf("setLevel failed: %v", err)
+	}
+
+	// Already delivered when the watcher is created, so not scanned.
+	deliver(t, dir, "1000.backlog.host", testEmail)
+	watcher, err := maildir.New(watch, 4096, func(ctx context.Context, name, content string) {
+		env.handler.ScanDelivered(ctx, env.server, name, content)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deliver(t, dir, "1001.ham.host", strings.Replace(testEmail, "Quarterly report", "Minutes", 1))
+	deliver(t, dir, "1002.huge.host", "Subject: Huge\r\n\r\n"+strings.Repeat("pharmacy ", 1000)+"\r\n")
+	deliver(t, dir, "1003.grey.host", "From: sales@shop.example\r\nSubject: Offer\r\n\r\ndiscount\r\n")
+	deliver(t, dir, "1004.spam.host", "From: deals@promo.example\r\nSubject: You have won\r\nMessage-ID: <offer-9@promo.example>\r\n\r\npharmacy\r\n")
+	if err := os.Symlink(filepath.Join(dir, "cur"), filepath.Join(dir, "new", "1005.link.host")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the message scoring notify_score or more is announced.
+	var verdict handlers.DeliveredVerdict
+	select {
+	case n := <-notifications:
+		if n.Level != "warning" || n.Logger != "maildir_watch" {
+			t.Errorf("unexpected notification: %+v", n)
+		}
+		data, _ := json.Marshal(n.Data)
+		if err := json.Unmarshal(data, &verdict); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no notification for the high-scoring message (%d scans)", len(env.spamd.Requests()))
+	}
+	if verdict.File != "1004.spam.host" || verdict.Score != 12.5 || !verdict.IsSpam || verdict.From != "deals@promo.example" ||
+		verdict.MessageID != "<offer-9@promo.example>" || len(verdict.Hash) != 64 || !slices.Equal(verdict.Rules, []string{"BAYES_99"}) {
+		t.Errorf("unexpected verdict: %+v", verdict)
+	}
+
+	// The scans are recorded in the history; the backlog, the oversized
+	// message and the symbolic link are skipped.
+	var page listquery.Page[*history.Entry]
+	env.call(t, "query_history", map[string]any{}, &page)
+	if page.Total != 3 {
+		t.Fatalf("history has %d entries, want 3: %+v", page.Total, page.Items)
+	}
+	if got := page.Items[0].Rules; !slices.Equal(got, []string{"BAYES_99"}) {
+		t.Errorf("rules not recorded: %v", got)
+	}
+	if len(env.spamd.Requests()) != 3 {
+		t.Errorf("spamd received %d scans, want 3", len(env.spamd.Requests()))
+	}
+	select {
+	case n := <-notifications:
+		t.Errorf("unexpected notification: %+v", n.Data)
+	default:
+	}
+
+	// A message is handled once, even after further deliveries.
+	deliver(t, dir, "1006.ham.host", testEmail)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(env.spamd.Requests()) < 4 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(env.spamd.Requests()) != 4 {
+		t.Errorf("spamd received %d scans, want 4", len(env.spamd.Requests()))
+	}
+}
+
+func TestMaildirWatchValidation(t *testing.T) {
+	if _, err := maildir.New(config.MaildirWatchConfig{Dir: t.TempDir(), PollInterval: time.Second}, 1024, nil); err == nil {
+		t.Error("accepted a Maildir without new/")
+	}
+
+	yaml := "maildir_watch:\n  dir: \"/var/mail/quarantine\"\n  poll_interval: \"100ms\"\n  profile: \"nope\"\n  notify_score: -1\n"
+	err := validateConfig(t, yaml)
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, want := range []string{
+		"maildir_watch.poll_interval: must be at least 1s, got 100ms",
+		"maildir_watch.notify_score: must be a finite, non-negative number",
+		`maildir_watch.profile: unknown profile "nope"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+}
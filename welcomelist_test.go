@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spamassassin-mcp/internal/config"
+	"spamassassin-mcp/internal/handlers"
+	"spamassassin-mcp/internal/listquery"
+	"spamassassin-mcp/internal/welcomelist"
+)
+
+func TestWelcomelist(t *testing.T) {
+	dir := t.TempDir()
+	localCF := filepath.Join(dir, "local.cf")
+	if err := os.WriteFile(localCF, []byte("required_score 5.0\nscore LOCAL_X 1.0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wl := config.WelcomelistConfig{Path: filepath.Join(dir, "welcomelist.json"), LocalCF: localCF, Directive: "welcomelist_from"}
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Welcomelist = wl
+		cfg.Security.AllowedSenders = []string{"ops@example.org"}
+	})
+
+	var change handlers.WelcomelistChange
+	res := env.call(t, "add_welcomelist_entry", map[string]any{"address": " *@Partner.Example ", "comment": "Supplier invoices"}, &change)
+	if res.IsError {
+		t.Fatalf("add_welcomelist_entry failed: %s", resultText(res))
+	}
+	if !change.Changed || change.Entry.Address != "*@partner.example" || change.Entries != 1 || change.LocalCF != localCF {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	env.call(t, "add_welcomelist_entry", map[string]any{"address": "alice@example.com"}, nil)
+	if env.call(t, "add_welcomelist_entry", map[string]any{"address": "alice@example.com"}, &change); change.Changed {
+		t.Error("adding a listed address must not change anything")
+	}
+
+	data, _ := os.ReadFile(localCF)
+	want := "required_score 5.0\nscore LOCAL_X 1.0\n\n" +
+		"# BEGIN spamassassin-mcp welcomelist - managed by spamassassin-mcp, edits here are overwritten\n" +
+		"# Supplier invoices\nwelcomelist_from *@partner.example\nwelcomelist_from alice@example.com\n" +
+		"# END spamassassin-mcp welcomelist\n"
+	if string(data) != want {
+		t.Errorf("local.cf =\n%s", data)
+	}
+	if backup, _ := os.ReadFile(localCF + ".bak"); !strings.Contains(string(backup), "*@partner.example") || strings.Contains(string(backup), "alice") {
+		t.Errorf("backup should hold the previous version, got\n%s", backup)
+	}
+
+	for _, bad := range []string{"alice@example.com\nloadplugin Evil", "not an address", "a b@example.com"} {
+		if res := env.call(t, "add_welcomelist_entry", map[string]any{"address": bad}, nil); !res.IsError {
+			t.Errorf("%q: expected a validation error", bad)
+		}
+	}
+	if res := env.call(t, "add_welcomelist_entry", map[string]any{"address": "bob@example.com", "comment": "line\nwelcomelist_from *"}, nil); !res.IsError {
+		t.Error("expected a multi-line comment to be rejected")
+	}
+
+	// Wildcard entries apply to reputation checks alongside allowed_senders.
+	var rep handlers.ReputationResult
+	env.call(t, "check_reputation", map[string]any{"sender": "billing@partner.example"}, &rep)
+	if rep.Reputation != "good" {
+		t.Errorf("welcomelisted sender reputation = %q", rep.Reputation)
+	}
+
+	var page listquery.Page[*handlers.WelcomelistItem]
+	env.call(t, "list_welcomelist", map[string]any{}, &page)
+	if page.Total != 3 || page.Items[0].Address != "*@partner.example" || page.Items[2].Source != "config" {
+		t.Errorf("unexpected list: %+v", page.Items)
+	}
+	env.call(t, "list_welcomelist", map[string]any{"filter": map[string]string{"source": "welcomelist"}}, &page)
+	if page.Total != 2 || page.Items[0].AddedBy == "" {
+		t.Errorf("unexpected filtered list: %+v", page.Items)
+	}
+
+	if res := env.call(t, "remove_welcomelist_entry", map[string]any{"address": "ops@example.org"}, nil); !strings.Contains(resultText(res), "security.allowed_senders") {
+		t.Errorf("expected removal of a configured sender to be refused, got %s", resultText(res))
+	}
+	if res := env.call(t, "remove_welcomelist_entry", map[string]any{"address": "*@partner.example"}, &change); res.IsError || change.Entries != 1 {
+		t.Fatalf("remove_welcomelist_entry failed: %s", resultText(res))
+	}
+	if data, _ := os.ReadFile(localCF); strings.Contains(string(data), "partner") || !strings.Contains(string(data), "alice@example.com") {
+		t.Errorf("local.cf after removal =\n%s", data)
+	}
+
+	// Entries survive a restart.
+	store, err := welcomelist.Open(wl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := store.Entries(); len(entries) != 1 || entries[0].Address != "alice@example.com" {
+		t.Errorf("restored entries = %+v", entries)
+	}
+
+	// A damaged managed block is refused and leaves local.cf untouched.
+	damaged := strings.Replace(string(data), "# END spamassassin-mcp welcomelist\n", "", 1)
+	if err := os.WriteFile(localCF, []byte(damaged), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res := env.call(t, "add_welcomelist_entry", map[string]any{"address": "carol@example.com"}, nil); !res.IsError {
+		t.Error("expected a damaged block to be refused")
+	}
+	if data, _ := os.ReadFile(localCF); string(data) != damaged {
+		t.Error("local.cf was changed despite the damaged block")
+	}
+	if store, _ := welcomelist.Open(wl); len(store.Entries()) != 1 {
+		t.Error("a failed change must not be saved")
+	}
+}